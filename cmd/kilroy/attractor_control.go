@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/danshapiro/kilroy/internal/attractor/runstate"
+)
+
+func attractorControl(command string, args []string) {
+	os.Exit(runAttractorControl(command, args, os.Stdout, os.Stderr))
+}
+
+// runAttractorControl implements attractor pause|unpause|step. It only writes
+// the run's control file; the engine picks it up at the next node boundary.
+func runAttractorControl(command string, args []string, stdout io.Writer, stderr io.Writer) int {
+	mode, err := runstate.ParseControlMode(command)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	var logsRoot string
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--logs-root":
+			i++
+			if i >= len(args) {
+				fmt.Fprintln(stderr, "--logs-root requires a value")
+				return 1
+			}
+			logsRoot = args[i]
+		default:
+			fmt.Fprintf(stderr, "unknown arg: %s\n", args[i])
+			return 1
+		}
+	}
+	if logsRoot == "" {
+		fmt.Fprintln(stderr, "--logs-root is required")
+		return 1
+	}
+
+	snapshot, err := runstate.LoadSnapshot(logsRoot)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	if snapshot.State == runstate.StateSuccess || snapshot.State == runstate.StateFail {
+		fmt.Fprintf(stderr, "run state is %q; refusing to %s a finished run\n", snapshot.State, command)
+		return 1
+	}
+	// A run that is not alive may still be resumed; the control file persists
+	// and is honored by attractor resume.
+	if err := runstate.WriteControl(logsRoot, mode, "cli"); err != nil {
+		fmt.Fprintf(stderr, "write %s: %v\n", runstate.ControlFileName, err)
+		return 1
+	}
+	fmt.Fprintf(stdout, "control=%s\n", mode)
+	if snapshot.CurrentNodeID != "" {
+		fmt.Fprintf(stdout, "node=%s\n", snapshot.CurrentNodeID)
+	}
+	fmt.Fprintf(stdout, "pid_alive=%t\n", snapshot.PIDAlive)
+	return 0
+}
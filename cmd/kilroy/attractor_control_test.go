@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/danshapiro/kilroy/internal/attractor/runstate"
+)
+
+func TestAttractorControl_WritesControlFileAndStatusShowsIt(t *testing.T) {
+	logs := t.TempDir()
+	_ = os.WriteFile(filepath.Join(logs, "live.json"), []byte(`{"event":"run_paused","node_id":"verify"}`), 0o644)
+
+	for _, tc := range []struct {
+		command string
+		want    runstate.ControlMode
+	}{
+		{"pause", runstate.ControlPause},
+		{"step", runstate.ControlStep},
+		{"unpause", runstate.ControlRun},
+	} {
+		var stdout, stderr bytes.Buffer
+		if code := runAttractorControl(tc.command, []string{"--logs-root", logs}, &stdout, &stderr); code != 0 {
+			t.Fatalf("%s: exit %d: %s", tc.command, code, stderr.String())
+		}
+		if !strings.Contains(stdout.String(), "control="+string(tc.want)+"\nnode=verify\n") {
+			t.Fatalf("%s output: %s", tc.command, stdout.String())
+		}
+		c, err := runstate.LoadControl(logs)
+		if err != nil || c.Mode != tc.want || c.Source != "cli" {
+			t.Fatalf("%s: control file %+v, %v", tc.command, c, err)
+		}
+	}
+
+	_ = runstate.WriteControl(logs, runstate.ControlPause, "cli")
+	var stdout, stderr bytes.Buffer
+	if code := runAttractorStatus([]string{"--logs-root", logs}, &stdout, &stderr); code != 0 {
+		t.Fatalf("status: exit %d: %s", code, stderr.String())
+	}
+	if !strings.Contains(stdout.String(), "paused=true\ncontrol=pause\n") {
+		t.Fatalf("status output: %s", stdout.String())
+	}
+}
+
+func TestAttractorControl_RefusesFinishedRun(t *testing.T) {
+	logs := t.TempDir()
+	_ = os.WriteFile(filepath.Join(logs, "final.json"), []byte(`{"status":"success"}`), 0o644)
+	var stdout, stderr bytes.Buffer
+	if code := runAttractorControl("pause", []string{"--logs-root", logs}, &stdout, &stderr); code == 0 {
+		t.Fatalf("expected pause of a finished run to fail; stdout=%s", stdout.String())
+	}
+	if _, err := os.Stat(filepath.Join(logs, runstate.ControlFileName)); err == nil {
+		t.Fatal("control file written for a finished run")
+	}
+}
+
+func TestAttractorSteer_QueuesMessageForCurrentNode(t *testing.T) {
+	logs := t.TempDir()
+	_ = os.WriteFile(filepath.Join(logs, "live.json"), []byte(`{"event":"stage_heartbeat","node_id":"impl"}`), 0o644)
+
+	var stdout, stderr bytes.Buffer
+	if code := runAttractorSteer([]string{"--logs-root", logs, "use", "the existing parser"}, &stdout, &stderr); code != 0 {
+		t.Fatalf("steer: exit %d: %s", code, stderr.String())
+	}
+	if !strings.Contains(stdout.String(), "node=impl\npending_steering=1\n") {
+		t.Fatalf("steer output: %s", stdout.String())
+	}
+	msgs, err := runstate.PendingSteers(logs)
+	if err != nil || len(msgs) != 1 || msgs[0].Message != "use the existing parser" || msgs[0].NodeID != "impl" || msgs[0].Source != "cli" {
+		t.Fatalf("queued: %+v, %v", msgs, err)
+	}
+
+	stdout.Reset()
+	stderr.Reset()
+	if code := runAttractorSteer([]string{"--logs-root", logs}, &stdout, &stderr); code == 0 {
+		t.Fatal("expected steer without a message to fail")
+	}
+}
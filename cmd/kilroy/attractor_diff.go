@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/danshapiro/kilroy/internal/attractor/engine"
+	"github.com/danshapiro/kilroy/internal/attractor/rundiff"
+)
+
+func attractorDiff(args []string) {
+	var refs []string
+	var repoPath string
+	var asJSON, includePatch bool
+
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--json":
+			asJSON = true
+		case "--patch":
+			includePatch = true
+		case "--repo":
+			i++
+			if i >= len(args) {
+				fmt.Fprintln(os.Stderr, "--repo requires a value")
+				os.Exit(1)
+			}
+			repoPath = args[i]
+		default:
+			if strings.HasPrefix(args[i], "-") {
+				fmt.Fprintf(os.Stderr, "unknown arg: %s\n", args[i])
+				os.Exit(1)
+			}
+			refs = append(refs, args[i])
+		}
+	}
+	if len(refs) != 2 {
+		usage()
+		os.Exit(1)
+	}
+
+	runs := make([]*rundiff.Run, 0, 2)
+	for _, ref := range refs {
+		logsRoot, err := resolveDiffLogsRoot(ref)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		r, err := rundiff.LoadRun(logsRoot)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		runs = append(runs, r)
+	}
+
+	rep := rundiff.Compare(runs[0], runs[1], rundiff.Options{RepoPath: repoPath, IncludePatch: includePatch})
+	if asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		_ = enc.Encode(rep)
+		return
+	}
+	rep.WriteText(os.Stdout)
+}
+
+// resolveDiffLogsRoot accepts a logs root directory or a run branch name.
+func resolveDiffLogsRoot(ref string) (string, error) {
+	if st, err := os.Stat(ref); err == nil && st.IsDir() {
+		return filepath.Abs(ref)
+	}
+	logsRoot, err := engine.LogsRootForRunBranch(ref)
+	if err != nil {
+		return "", fmt.Errorf("%s is neither a logs root nor a known run branch: %w", ref, err)
+	}
+	return logsRoot, nil
+}
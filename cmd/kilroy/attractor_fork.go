@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/danshapiro/kilroy/internal/attractor/engine"
+)
+
+func attractorFork(args []string) {
+	var opts engine.ForkOptions
+	var graphPath string
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--logs-root", "--from-node", "--graph", "--set-attr", "--run-id", "--new-logs-root":
+			flag := args[i]
+			i++
+			if i >= len(args) {
+				fmt.Fprintf(os.Stderr, "%s requires a value\n", flag)
+				os.Exit(1)
+			}
+			switch flag {
+			case "--logs-root":
+				opts.SourceLogsRoot = args[i]
+			case "--from-node":
+				opts.FromNode = args[i]
+			case "--graph":
+				graphPath = args[i]
+			case "--set-attr":
+				opts.SetAttrs = append(opts.SetAttrs, args[i])
+			case "--run-id":
+				opts.RunID = args[i]
+			case "--new-logs-root":
+				opts.LogsRoot = args[i]
+			}
+		default:
+			fmt.Fprintf(os.Stderr, "unknown arg: %s\n", args[i])
+			os.Exit(1)
+		}
+	}
+	if opts.SourceLogsRoot == "" || opts.FromNode == "" {
+		usage()
+		os.Exit(1)
+	}
+	if graphPath != "" {
+		b, err := os.ReadFile(graphPath)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		opts.GraphDOT = b
+	}
+
+	ctx, cleanupSignalCtx := signalCancelContext()
+	res, err := engine.Fork(ctx, opts)
+	cleanupSignalCtx()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	fmt.Printf("run_id=%s\n", res.RunID)
+	fmt.Printf("logs_root=%s\n", res.LogsRoot)
+	fmt.Printf("worktree=%s\n", res.WorktreeDir)
+	fmt.Printf("run_branch=%s\n", res.RunBranch)
+	fmt.Printf("final_commit=%s\n", res.FinalCommitSHA)
+	if res.CXDBUIURL != "" {
+		fmt.Printf("cxdb_ui=%s\n", res.CXDBUIURL)
+	}
+
+	if string(res.FinalStatus) == "success" {
+		os.Exit(0)
+	}
+	os.Exit(1)
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/danshapiro/kilroy/internal/attractor/forge"
+	"github.com/danshapiro/kilroy/internal/attractor/gitutil"
+	"github.com/danshapiro/kilroy/internal/attractor/land"
+	"github.com/danshapiro/kilroy/internal/llmclient"
+	"github.com/danshapiro/kilroy/internal/modelmeta"
+)
+
+func attractorLand(args []string) {
+	var opts land.Options
+	var strategy, modelSpec, pushRemote string
+	var noLLM, openPR, draftPR, asJSON bool
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--logs-root", "--onto", "--branch", "--strategy", "--repo", "--model", "--push":
+			flag := args[i]
+			i++
+			if i >= len(args) {
+				fmt.Fprintf(os.Stderr, "%s requires a value\n", flag)
+				os.Exit(1)
+			}
+			switch flag {
+			case "--logs-root":
+				opts.LogsRoot = args[i]
+			case "--onto":
+				opts.Onto = args[i]
+			case "--branch":
+				opts.Branch = args[i]
+			case "--strategy":
+				strategy = args[i]
+			case "--repo":
+				opts.RepoPath = args[i]
+			case "--model":
+				modelSpec = args[i]
+			case "--push":
+				pushRemote = args[i]
+			}
+		case "--force":
+			opts.Force = true
+		case "--allow-failed":
+			opts.AllowFailed = true
+		case "--no-llm":
+			noLLM = true
+		case "--open-pr":
+			openPR = true
+		case "--draft":
+			draftPR = true
+		case "--json":
+			asJSON = true
+		default:
+			fmt.Fprintf(os.Stderr, "unknown arg: %s\n", args[i])
+			os.Exit(1)
+		}
+	}
+	if opts.LogsRoot == "" || opts.Onto == "" {
+		usage()
+		os.Exit(1)
+	}
+	s, err := land.ParseStrategy(strategy)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	opts.Strategy = s
+	if openPR && pushRemote == "" {
+		pushRemote = "origin"
+	}
+	if openPR {
+		opts.OntoBranchRemote = pushRemote
+	}
+	if !noLLM {
+		opts.Drafter = landDrafter(modelSpec)
+	}
+
+	ctx, cleanupSignalCtx := signalCancelContext()
+	defer cleanupSignalCtx()
+	res, err := land.Land(ctx, opts)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	for _, w := range res.Warnings {
+		fmt.Fprintln(os.Stderr, "warning:", w)
+	}
+
+	prURL := ""
+	if pushRemote != "" {
+		refspec := res.Branch
+		if opts.Force {
+			refspec = "+" + refspec
+		}
+		if err := gitutil.PushBranch(res.RepoPath, pushRemote, refspec); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+	if openPR {
+		prURL, err = openLandPullRequest(ctx, pushRemote, res, opts.LogsRoot, draftPR)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+
+	if asJSON {
+		out := struct {
+			*land.Result
+			PullRequestURL string `json:"pull_request_url,omitempty"`
+		}{res, prURL}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		_ = enc.Encode(out)
+		return
+	}
+	fmt.Printf("branch=%s\n", res.Branch)
+	fmt.Printf("onto=%s (%s)\n", res.Onto, shortRevision(res.OntoSHA))
+	for _, c := range res.Commits {
+		fmt.Printf("commit=%s %s\n", shortRevision(c.SHA), c.Subject)
+	}
+	if prURL != "" {
+		fmt.Printf("pull_request=%s\n", prURL)
+	}
+}
+
+// landDrafter returns an LLM drafter for --model provider/model (default
+// anthropic), or nil so land falls back to stage notes when no provider is
+// configured in the environment.
+func landDrafter(spec string) land.Drafter {
+	provider, model := "anthropic", modelmeta.DefaultAnthropicModel
+	if spec = strings.TrimSpace(spec); spec != "" {
+		p, m, ok := strings.Cut(spec, "/")
+		if !ok || p == "" || m == "" {
+			fmt.Fprintln(os.Stderr, "--model must be <provider>/<model>")
+			os.Exit(1)
+		}
+		provider, model = modelmeta.NormalizeProvider(p), m
+	}
+	client, err := llmclient.NewFromEnv()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "warning: %v; commit messages will use stage notes\n", err)
+		return nil
+	}
+	return land.LLMDrafter{Client: client, Provider: provider, Model: model}
+}
+
+// openLandPullRequest opens a GitHub pull request for the pushed branch. The
+// repository comes from the remote URL and the token from GITHUB_TOKEN.
+func openLandPullRequest(ctx context.Context, remote string, res *land.Result, logsRoot string, draft bool) (string, error) {
+	remoteURL, err := gitutil.RemoteURL(res.RepoPath, remote)
+	if err != nil {
+		return "", err
+	}
+	repo, err := forge.RepoFromRemoteURL(remoteURL)
+	if err != nil {
+		return "", err
+	}
+	token := strings.TrimSpace(os.Getenv("GITHUB_TOKEN"))
+	if token == "" {
+		return "", fmt.Errorf("--open-pr requires GITHUB_TOKEN")
+	}
+	title := res.Commits[0].Subject
+	if len(res.Commits) > 1 && res.Goal != "" {
+		title, _, _ = strings.Cut(res.Goal, "\n")
+	}
+	var body strings.Builder
+	fmt.Fprintf(&body, "Landed from Kilroy run `%s` (logs: `%s`).\n\n", res.RunID, logsRoot)
+	for _, c := range res.Commits {
+		fmt.Fprintf(&body, "- %s %s\n", shortRevision(c.SHA), c.Subject)
+	}
+	c := &forge.Client{Kind: forge.GitHub, BaseURL: os.Getenv("GITHUB_API_URL"), Token: token}
+	return c.Create(ctx, forge.PullRequest{
+		Repo:  repo,
+		Head:  res.Branch,
+		Base:  res.OntoBranch,
+		Title: title,
+		Body:  body.String(),
+		Draft: draft,
+	})
+}
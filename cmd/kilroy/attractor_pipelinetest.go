@@ -0,0 +1,129 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/danshapiro/kilroy/internal/attractor/pipelinetest"
+)
+
+func attractorTest(args []string) {
+	var paths []string
+	var junitPath string
+	var runFilter *regexp.Regexp
+	var asJSON, verbose bool
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--junit", "--run":
+			flag := args[i]
+			i++
+			if i >= len(args) {
+				fmt.Fprintf(os.Stderr, "%s requires a value\n", flag)
+				os.Exit(1)
+			}
+			switch flag {
+			case "--junit":
+				junitPath = args[i]
+			case "--run":
+				re, err := regexp.Compile(args[i])
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "--run: %v\n", err)
+					os.Exit(1)
+				}
+				runFilter = re
+			}
+		case "--json":
+			asJSON = true
+		case "-v", "--verbose":
+			verbose = true
+		default:
+			if strings.HasPrefix(args[i], "-") {
+				fmt.Fprintf(os.Stderr, "unknown arg: %s\n", args[i])
+				os.Exit(1)
+			}
+			paths = append(paths, args[i])
+		}
+	}
+
+	files, err := pipelinetest.Discover(paths)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if len(files) == 0 {
+		fmt.Fprintln(os.Stderr, "no *.kilroytest.yaml files found")
+		os.Exit(1)
+	}
+	var results []pipelinetest.Result
+	for _, f := range files {
+		for _, r := range pipelinetest.RunFile(f) {
+			if runFilter != nil && r.Error == "" && !runFilter.MatchString(r.Scenario) {
+				continue
+			}
+			results = append(results, r)
+		}
+	}
+
+	passed, failed, errored := 0, 0, 0
+	for _, r := range results {
+		switch {
+		case r.Error != "":
+			errored++
+		case r.Passed:
+			passed++
+		default:
+			failed++
+		}
+	}
+
+	if junitPath != "" {
+		out, err := os.Create(junitPath)
+		if err == nil {
+			err = pipelinetest.WriteJUnit(out, results)
+			if cerr := out.Close(); err == nil {
+				err = cerr
+			}
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "write junit: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		_ = enc.Encode(struct {
+			Passed  int                   `json:"passed"`
+			Failed  int                   `json:"failed"`
+			Errored int                   `json:"errored"`
+			Results []pipelinetest.Result `json:"results"`
+		}{passed, failed, errored, results})
+	} else {
+		for _, r := range results {
+			switch {
+			case r.Error != "":
+				fmt.Printf("ERROR %s :: %s\n    %s\n", r.File, r.Scenario, r.Error)
+			case r.Passed:
+				fmt.Printf("ok    %s :: %s (%s)\n", r.File, r.Scenario, r.Duration.Round(time.Microsecond))
+			default:
+				fmt.Printf("FAIL  %s :: %s\n", r.File, r.Scenario)
+				for _, f := range r.Failures {
+					fmt.Printf("    %s\n", strings.ReplaceAll(f, "\n", "\n    "))
+				}
+				if verbose && r.Sim != nil {
+					for _, s := range r.Sim.Steps {
+						fmt.Printf("      | %s\n", s.String())
+					}
+				}
+			}
+		}
+		fmt.Printf("%d passed, %d failed, %d errors\n", passed, failed, errored)
+	}
+	if failed > 0 || errored > 0 {
+		os.Exit(1)
+	}
+}
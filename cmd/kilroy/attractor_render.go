@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/danshapiro/kilroy/internal/attractor/engine"
+	"github.com/danshapiro/kilroy/internal/attractor/render"
+)
+
+func attractorRender(args []string) {
+	var graphPath, logsRoot, formatName, outPath string
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--graph", "--logs-root", "--format", "--output", "-o":
+			flag := args[i]
+			i++
+			if i >= len(args) {
+				fmt.Fprintf(os.Stderr, "%s requires a value\n", flag)
+				os.Exit(1)
+			}
+			switch flag {
+			case "--graph":
+				graphPath = args[i]
+			case "--logs-root":
+				logsRoot = args[i]
+			case "--format":
+				formatName = args[i]
+			case "--output", "-o":
+				outPath = args[i]
+			}
+		default:
+			fmt.Fprintf(os.Stderr, "unknown arg: %s\n", args[i])
+			os.Exit(1)
+		}
+	}
+	if graphPath == "" {
+		usage()
+		os.Exit(1)
+	}
+	// The format defaults to the output file's extension, then svg.
+	if formatName == "" {
+		formatName = "svg"
+		if ext := filepath.Ext(outPath); ext != "" {
+			formatName = ext
+		}
+	}
+	format, err := render.ParseFormat(formatName)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	dotSource, err := os.ReadFile(graphPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	g, _, err := engine.Prepare(dotSource)
+	if g == nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if err != nil {
+		// A graph that fails validation still draws; that is often when a
+		// picture helps most.
+		fmt.Fprintf(os.Stderr, "warning: %v\n", err)
+	}
+	var ov *render.Overlay
+	if logsRoot != "" {
+		if ov, err = render.LoadOverlay(logsRoot); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+
+	out := os.Stdout
+	if outPath != "" {
+		if out, err = os.Create(outPath); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+	bw := bufio.NewWriter(out)
+	err = render.Render(bw, g, ov, format)
+	if err == nil {
+		err = bw.Flush()
+	}
+	if outPath != "" {
+		if cerr := out.Close(); err == nil {
+			err = cerr
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "render: %v\n", err)
+		os.Exit(1)
+	}
+}
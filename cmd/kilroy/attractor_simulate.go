@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/danshapiro/kilroy/internal/attractor/engine"
+	"github.com/danshapiro/kilroy/internal/attractor/runtime"
+)
+
+func attractorSimulate(args []string) {
+	var graphPath, scriptPath string
+	var opts engine.SimOptions
+	var asJSON bool
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--graph", "--script", "--max-steps":
+			flag := args[i]
+			i++
+			if i >= len(args) {
+				fmt.Fprintf(os.Stderr, "%s requires a value\n", flag)
+				os.Exit(1)
+			}
+			switch flag {
+			case "--graph":
+				graphPath = args[i]
+			case "--script":
+				scriptPath = args[i]
+			case "--max-steps":
+				n, err := strconv.Atoi(args[i])
+				if err != nil || n < 1 {
+					fmt.Fprintln(os.Stderr, "--max-steps must be a positive integer")
+					os.Exit(1)
+				}
+				opts.MaxSteps = n
+			}
+		case "--json":
+			asJSON = true
+		default:
+			fmt.Fprintf(os.Stderr, "unknown arg: %s\n", args[i])
+			os.Exit(1)
+		}
+	}
+	if graphPath == "" {
+		usage()
+		os.Exit(1)
+	}
+	dotSource, err := os.ReadFile(graphPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	g, _, err := engine.Prepare(dotSource)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	var script *engine.SimScript
+	if scriptPath != "" {
+		if script, err = engine.LoadSimScript(scriptPath); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+	res, err := engine.Simulate(g, script, opts)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	if asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		_ = enc.Encode(res)
+	} else {
+		for _, s := range res.Steps {
+			fmt.Println(s.String())
+		}
+		fmt.Printf("path=%s\n", strings.Join(res.Path, " "))
+		if len(res.GoalGatesFired) > 0 {
+			fmt.Printf("goal_gates_fired=%s\n", strings.Join(res.GoalGatesFired, ","))
+		}
+		if res.Restarts > 0 {
+			fmt.Printf("restarts=%d\n", res.Restarts)
+		}
+		fmt.Printf("final=%s\n", res.FinalStatus)
+		if res.FailureReason != "" {
+			fmt.Printf("failure_reason=%s\n", res.FailureReason)
+		}
+	}
+	if res.FinalStatus != runtime.FinalSuccess {
+		os.Exit(1)
+	}
+}
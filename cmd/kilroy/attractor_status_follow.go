@@ -410,6 +410,15 @@ func printSnapshot(logsRoot string, stdout io.Writer, stderr io.Writer, asJSON b
 	fmt.Fprintf(stdout, "run_id=%s\n", snapshot.RunID)
 	fmt.Fprintf(stdout, "node=%s\n", snapshot.CurrentNodeID)
 	fmt.Fprintf(stdout, "event=%s\n", snapshot.LastEvent)
+	if snapshot.Paused {
+		fmt.Fprintln(stdout, "paused=true")
+	}
+	if snapshot.Control != "" {
+		fmt.Fprintf(stdout, "control=%s\n", snapshot.Control)
+	}
+	if snapshot.PendingSteering > 0 {
+		fmt.Fprintf(stdout, "pending_steering=%d\n", snapshot.PendingSteering)
+	}
 	if snapshot.CurrentAttempt > 0 {
 		fmt.Fprintf(stdout, "attempt=%d/%d\n", snapshot.CurrentAttempt, snapshot.MaxAttempts)
 	}
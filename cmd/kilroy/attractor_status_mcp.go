@@ -0,0 +1,27 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/danshapiro/kilroy/internal/attractor/engine"
+)
+
+// attractorStatusMCP is the stdio MCP shim that CLI agents launch for
+// status_tool=mcp; it is not meant to be run by hand.
+func attractorStatusMCP(args []string) {
+	if len(args) > 0 {
+		fmt.Fprintf(os.Stderr, "unknown arg: %s\n", args[0])
+		os.Exit(1)
+	}
+	path := strings.TrimSpace(os.Getenv("KILROY_STAGE_STATUS_PATH"))
+	if path == "" {
+		fmt.Fprintln(os.Stderr, "KILROY_STAGE_STATUS_PATH is not set")
+		os.Exit(1)
+	}
+	if err := engine.ServeStatusMCP(os.Stdin, os.Stdout, path); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
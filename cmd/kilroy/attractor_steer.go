@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/danshapiro/kilroy/internal/attractor/runstate"
+)
+
+func attractorSteer(args []string) {
+	os.Exit(runAttractorSteer(args, os.Stdout, os.Stderr))
+}
+
+// runAttractorSteer queues an operator message for the running codergen
+// stage. API agent_loop stages receive it before their next model call; other
+// stages get it in the prompt of their next attempt.
+func runAttractorSteer(args []string, stdout io.Writer, stderr io.Writer) int {
+	var logsRoot string
+	var parts []string
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--logs-root":
+			i++
+			if i >= len(args) {
+				fmt.Fprintln(stderr, "--logs-root requires a value")
+				return 1
+			}
+			logsRoot = args[i]
+		default:
+			if strings.HasPrefix(args[i], "--") {
+				fmt.Fprintf(stderr, "unknown arg: %s\n", args[i])
+				return 1
+			}
+			parts = append(parts, args[i])
+		}
+	}
+	if logsRoot == "" {
+		fmt.Fprintln(stderr, "--logs-root is required")
+		return 1
+	}
+	message := strings.TrimSpace(strings.Join(parts, " "))
+	if message == "" {
+		fmt.Fprintln(stderr, "a steering message is required")
+		return 1
+	}
+
+	snapshot, err := runstate.LoadSnapshot(logsRoot)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	if snapshot.State == runstate.StateSuccess || snapshot.State == runstate.StateFail {
+		fmt.Fprintf(stderr, "run state is %q; refusing to steer a finished run\n", snapshot.State)
+		return 1
+	}
+	m, err := runstate.EnqueueSteer(logsRoot, message, "cli", snapshot.CurrentNodeID)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	fmt.Fprintf(stdout, "steer_id=%s\n", m.ID)
+	if m.NodeID != "" {
+		fmt.Fprintf(stdout, "node=%s\n", m.NodeID)
+	}
+	fmt.Fprintf(stdout, "pending_steering=%d\n", snapshot.PendingSteering+1)
+	return 0
+}
@@ -110,14 +110,22 @@ func loadEnvFile(args []string) []string {
 func usage() {
 	fmt.Fprintln(os.Stderr, "usage:")
 	fmt.Fprintln(os.Stderr, "  kilroy --version")
-	fmt.Fprintln(os.Stderr, "  kilroy [--env-file <path>] attractor run [--detach] [--preflight|--test-run] [--allow-test-shim] [--confirm-stale-build] [--no-cxdb] [--force-model <provider=model>] --graph <file.dot> --config <run.yaml> [--run-id <id>] [--logs-root <dir>]")
+	fmt.Fprintln(os.Stderr, "  kilroy [--env-file <path>] attractor run [--detach] [--preflight|--test-run] [--allow-test-shim] [--confirm-stale-build] [--no-cxdb] [--force-model <provider=model>] [--profile <name>] --graph <file.dot> --config <run.yaml> [--run-id <id>] [--logs-root <dir>]")
 	fmt.Fprintln(os.Stderr, "  kilroy attractor resume --logs-root <dir>")
 	fmt.Fprintln(os.Stderr, "  kilroy attractor resume --cxdb <http_base_url> --context-id <id>")
 	fmt.Fprintln(os.Stderr, "  kilroy attractor resume --run-branch <attractor/run/...> [--repo <path>]")
+	fmt.Fprintln(os.Stderr, "  kilroy attractor fork --logs-root <dir> --from-node <id> [--graph <file.dot>] [--set-attr <node.attr=value>]... [--run-id <id>] [--new-logs-root <dir>]")
 	fmt.Fprintln(os.Stderr, "  kilroy attractor status [--logs-root <dir> | --latest] [--json] [-v|--verbose] [--follow|-f] [--cxdb] [--raw] [--watch] [--interval <sec>]")
 	fmt.Fprintln(os.Stderr, "  kilroy attractor stop --logs-root <dir> [--grace-ms <ms>] [--force]")
+	fmt.Fprintln(os.Stderr, "  kilroy attractor pause|unpause|step --logs-root <dir>")
+	fmt.Fprintln(os.Stderr, "  kilroy attractor steer --logs-root <dir> <message>")
+	fmt.Fprintln(os.Stderr, "  kilroy attractor diff <logs-root|run-branch> <logs-root|run-branch> [--json] [--patch] [--repo <path>]")
+	fmt.Fprintln(os.Stderr, "  kilroy attractor land --logs-root <dir> --onto <branch> [--branch <name>] [--strategy squash|per-stage] [--repo <path>] [--model <provider/model> | --no-llm] [--force] [--allow-failed] [--push <remote>] [--open-pr [--draft]] [--json]")
 	fmt.Fprintln(os.Stderr, "  kilroy attractor validate --graph <file.dot>")
 	fmt.Fprintln(os.Stderr, "  kilroy attractor validate --batch <file.dot> [<file.dot> ...] [--json]")
+	fmt.Fprintln(os.Stderr, "  kilroy attractor simulate --graph <file.dot> [--script <outcomes.yaml>] [--max-steps <n>] [--json]")
+	fmt.Fprintln(os.Stderr, "  kilroy attractor test [<path>...] [--run <regexp>] [--junit <file>] [--json] [-v]")
+	fmt.Fprintln(os.Stderr, "  kilroy attractor render --graph <file.dot> [--logs-root <dir>] [--format svg|png|html|mermaid] [--output <file>]")
 	fmt.Fprintln(os.Stderr, "  kilroy attractor ingest [--output <file.dot>] [--model <model>] [--skill <skill.md>] [--repo <path>] [--max-turns <n>] <requirements>")
 	fmt.Fprintln(os.Stderr, "  kilroy attractor serve [--addr <host:port>]")
 	fmt.Fprintln(os.Stderr, "  kilroy attractor modeldb suggest [--refresh] [--ttl <duration>] [--provider <name>]")
@@ -136,12 +144,28 @@ func attractor(args []string) {
 		attractorRun(args[1:])
 	case "resume":
 		attractorResume(args[1:])
+	case "fork":
+		attractorFork(args[1:])
 	case "status":
 		attractorStatus(args[1:])
 	case "stop":
 		attractorStop(args[1:])
+	case "pause", "unpause", "step":
+		attractorControl(args[0], args[1:])
+	case "steer":
+		attractorSteer(args[1:])
+	case "diff":
+		attractorDiff(args[1:])
+	case "land":
+		attractorLand(args[1:])
 	case "validate":
 		attractorValidate(args[1:])
+	case "simulate":
+		attractorSimulate(args[1:])
+	case "test":
+		attractorTest(args[1:])
+	case "render":
+		attractorRender(args[1:])
 	case "ingest":
 		attractorIngest(args[1:])
 	case "serve":
@@ -152,6 +176,8 @@ func attractor(args []string) {
 		attractorReview(args[1:])
 	case "runs":
 		attractorRuns(args[1:])
+	case "status-mcp":
+		attractorStatusMCP(args[1:])
 	default:
 		usage()
 		os.Exit(1)
@@ -170,6 +196,7 @@ func attractorRun(args []string) {
 	var noCXDB bool
 	var skipCLIHeadlessWarning bool
 	var forceModelSpecs []string
+	var profile string
 
 	for i := 0; i < len(args); i++ {
 		switch args[i] {
@@ -194,6 +221,13 @@ func attractorRun(args []string) {
 				os.Exit(1)
 			}
 			forceModelSpecs = append(forceModelSpecs, args[i])
+		case "--profile":
+			i++
+			if i >= len(args) {
+				fmt.Fprintln(os.Stderr, "--profile requires a value")
+				os.Exit(1)
+			}
+			profile = args[i]
 		case "--graph":
 			i++
 			if i >= len(args) {
@@ -252,6 +286,10 @@ func attractorRun(args []string) {
 			fmt.Fprintln(os.Stderr, err)
 			os.Exit(1)
 		}
+		if err := cfg.ApplyProfile(profile); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
 		if !skipCLIHeadlessWarning && runConfigUsesCLIProviders(cfg) {
 			if !confirmCLIHeadlessWarning(os.Stdin, os.Stderr) {
 				fmt.Fprintln(os.Stderr, "preflight aborted: declined provider CLI headless-risk warning")
@@ -304,6 +342,9 @@ func attractorRun(args []string) {
 		for _, spec := range canonicalForceSpecs {
 			childArgs = append(childArgs, "--force-model", spec)
 		}
+		if profile != "" {
+			childArgs = append(childArgs, "--profile", profile)
+		}
 
 		if err := launchDetached(childArgs, logsRoot); err != nil {
 			fmt.Fprintln(os.Stderr, err)
@@ -323,6 +364,10 @@ func attractorRun(args []string) {
 		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
 	}
+	if err := cfg.ApplyProfile(profile); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
 	if !skipCLIHeadlessWarning && runConfigUsesCLIProviders(cfg) {
 		if !confirmCLIHeadlessWarning(os.Stdin, os.Stderr) {
 			fmt.Fprintln(os.Stderr, "preflight aborted: declined provider CLI headless-risk warning")
@@ -337,6 +382,7 @@ func attractorRun(args []string) {
 			AllowTestShim: allowTestShim,
 			DisableCXDB:   noCXDB,
 			ForceModels:   forceModels,
+			Profile:       profile,
 			OnCXDBStartup: func(info *engine.CXDBStartupInfo) {
 				if info == nil {
 					return
@@ -378,6 +424,7 @@ func attractorRun(args []string) {
 		AllowTestShim: allowTestShim,
 		DisableCXDB:   noCXDB,
 		ForceModels:   forceModels,
+		Profile:       profile,
 		OnCXDBStartup: func(info *engine.CXDBStartupInfo) {
 			if info == nil {
 				return
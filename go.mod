@@ -10,11 +10,11 @@ require github.com/santhosh-tekuri/jsonschema/v5 v5.3.1
 
 require (
 	github.com/bmatcuk/doublestar/v4 v4.8.1
+	github.com/vmihailenco/msgpack/v5 v5.4.1
 	github.com/zeebo/blake3 v0.2.4
 )
 
 require (
 	github.com/klauspost/cpuid/v2 v2.0.12 // indirect
-	github.com/vmihailenco/msgpack/v5 v5.4.1 // indirect
 	github.com/vmihailenco/tagparser/v2 v2.0.0 // indirect
 )
@@ -8,8 +8,13 @@ import (
 )
 
 // ApplyPatch applies a codex-rs-style apply_patch v4a patch to files under rootDir.
+// Unified diffs (`diff -u` / `git diff` output) are detected and applied too.
 // This is a best-effort implementation intended for local agent loops.
 func ApplyPatch(rootDir string, patch string) (string, error) {
+	patch = stripCodeFence(patch)
+	if !strings.HasPrefix(strings.TrimSpace(patch), "*** Begin Patch") && looksLikeUnifiedDiff(patch) {
+		return applyUnifiedDiff(rootDir, patch)
+	}
 	ops, err := parseV4APatch(patch)
 	if err != nil {
 		return "", err
@@ -1,7 +1,9 @@
 package agent
 
 import (
+	"fmt"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"strings"
 	"testing"
@@ -84,3 +86,203 @@ func TestApplyPatch_RejectsPathTraversalAndAbsolutePaths(t *testing.T) {
 		}
 	}
 }
+
+func TestApplyPatch_GitDiffRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	initGitRepo(t, dir)
+	git := func(args ...string) string {
+		t.Helper()
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+		return string(out)
+	}
+	write := func(name, content string) {
+		t.Helper()
+		_ = os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0o755)
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var long strings.Builder
+	for i := 1; i <= 40; i++ {
+		fmt.Fprintf(&long, "line %d\n", i)
+	}
+	write("edit.txt", long.String())
+	write("old/name.txt", "alpha\nbeta\ngamma\ndelta\nepsilon\nzeta\neta\n")
+	write("gone.txt", "bye\n")
+	write("noeol.txt", "a\nb")
+	git("add", "-A")
+	git("commit", "-m", "base")
+
+	write("edit.txt", strings.Replace(strings.Replace(long.String(), "line 3\n", "line three\n", 1), "line 30\n", "line 30\nline 30.5\n", 1))
+	_ = os.Remove(filepath.Join(dir, "old/name.txt"))
+	write("new/name.txt", "alpha\nbeta\ngamma\nDELTA\nepsilon\nzeta\neta\n")
+	_ = os.Remove(filepath.Join(dir, "gone.txt"))
+	write("noeol.txt", "a\nB\n")
+	write("added.txt", "fresh\n")
+	write("logo.bin", "\x89PNG\x00\x01\x02\xff binary payload \x00\x00\x00")
+	git("add", "-A")
+	patch := git("diff", "--cached", "--binary", "-M", "HEAD")
+	want := map[string]string{}
+	for _, name := range []string{"edit.txt", "new/name.txt", "noeol.txt", "added.txt", "logo.bin"} {
+		b, _ := os.ReadFile(filepath.Join(dir, name))
+		want[name] = string(b)
+	}
+	git("reset", "--hard", "HEAD")
+	git("clean", "-fdq")
+
+	out, err := ApplyPatch(dir, patch)
+	if err != nil {
+		t.Fatalf("ApplyPatch: %v\npatch:\n%s", err, patch)
+	}
+	for name, content := range want {
+		if b, err := os.ReadFile(filepath.Join(dir, name)); err != nil || string(b) != content {
+			t.Fatalf("%s = %q (%v), want %q\noutput: %s", name, b, err, content, out)
+		}
+	}
+	for _, name := range []string{"old/name.txt", "gone.txt"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err == nil {
+			t.Fatalf("%s should be gone", name)
+		}
+	}
+	if st := git("status", "--porcelain", "--untracked-files=no"); st == "" {
+		t.Fatalf("expected changes in the worktree")
+	}
+}
+
+func TestApplyPatch_UnifiedDiffToleratesOffsetAndWhitespace(t *testing.T) {
+	dir := t.TempDir()
+	var b strings.Builder
+	for i := 1; i <= 20; i++ {
+		fmt.Fprintf(&b, "\tfield%d int\n", i)
+	}
+	_ = os.WriteFile(filepath.Join(dir, "s.go"), []byte(b.String()), 0o644)
+
+	// Line numbers are off by five, context indentation uses spaces, and the
+	// blank context line lost its leading space.
+	patch := "```diff\n--- a/s.go\n+++ b/s.go\n@@ -3,3 +3,3 @@\n    field8 int\n-\tfield9 int\n+\tfield9 string\n \tfield10 int\n```\n"
+	out, err := ApplyPatch(dir, patch)
+	if err != nil {
+		t.Fatalf("ApplyPatch: %v", err)
+	}
+	if !strings.Contains(out, "s.go hunk 1: applied at line 8 (offset +5, ignoring whitespace)") {
+		t.Fatalf("output should note the offset: %q", out)
+	}
+	got, _ := os.ReadFile(filepath.Join(dir, "s.go"))
+	if want := strings.Replace(b.String(), "field9 int", "field9 string", 1); string(got) != want {
+		t.Fatalf("s.go:\n%s", got)
+	}
+
+	// A stale first context line is dropped (fuzz) rather than failing.
+	patch = "--- a/s.go\n+++ b/s.go\n@@ -14,4 +14,4 @@\n \tfield13 bool\n \tfield14 int\n-\tfield15 int\n+\tfield15 error\n \tfield16 int\n"
+	out, err = ApplyPatch(dir, patch)
+	if err != nil || !strings.Contains(out, "applied at line 14 (fuzz 1)") {
+		t.Fatalf("fuzzy hunk: %q %v", out, err)
+	}
+	if got, _ := os.ReadFile(filepath.Join(dir, "s.go")); !strings.Contains(string(got), "\tfield14 int\n\tfield15 error\n\tfield16 int\n") {
+		t.Fatalf("s.go after fuzzy hunk:\n%s", got)
+	}
+}
+
+func TestApplyPatch_UnifiedDiffFailingHunkChangesNothing(t *testing.T) {
+	dir := t.TempDir()
+	orig := "one\ntwo\nthree\nfour\nfive\nsix\nseven\neight\n"
+	_ = os.WriteFile(filepath.Join(dir, "a.txt"), []byte(orig), 0o644)
+	patch := `--- a/new.txt
++++ b/new.txt
+@@ -0,0 +1 @@
++created
+--- a/a.txt
++++ b/a.txt
+@@ -1,3 +1,3 @@
+ one
+-two
++TWO
+ three
+@@ -6,3 +6,3 @@
+ six
+-SEVEN
++7
+ eight
+`
+	_, err := ApplyPatch(dir, patch)
+	if err == nil {
+		t.Fatalf("expected the second hunk to fail")
+	}
+	for _, want := range []string{
+		"hunk 2 of a.txt (@@ -6,3 +6,3 @@) did not apply",
+		"closest match in the file, at line 6:\n  |six\n  |seven\n  |eight",
+		"a.txt hunk 1: applied at line 1",
+		"a.txt hunk 2 (@@ -6,3 +6,3 @@): FAILED",
+		"No files were changed",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Fatalf("error missing %q:\n%v", want, err)
+		}
+	}
+	if b, _ := os.ReadFile(filepath.Join(dir, "a.txt")); string(b) != orig {
+		t.Fatalf("a.txt modified: %q", b)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "new.txt")); err == nil {
+		t.Fatalf("new.txt should not have been created")
+	}
+}
+
+func TestApplyPatch_UnifiedDiffKeepsCRLFLineEndings(t *testing.T) {
+	dir := t.TempDir()
+	_ = os.WriteFile(filepath.Join(dir, "w.bat"), []byte("@echo off\r\nset A=1\r\necho %A%\r\n"), 0o644)
+	patch := "--- a/w.bat\n+++ b/w.bat\n@@ -1,3 +1,4 @@\n @echo off\n-set A=1\n+set A=2\n+set B=3\n echo %A%\n"
+	if _, err := ApplyPatch(dir, patch); err != nil {
+		t.Fatalf("ApplyPatch: %v", err)
+	}
+	if got, _ := os.ReadFile(filepath.Join(dir, "w.bat")); string(got) != "@echo off\r\nset A=2\r\nset B=3\r\necho %A%\r\n" {
+		t.Fatalf("w.bat: %q", got)
+	}
+}
+
+func TestApplyPatch_UnifiedDiffSectionsForOnePathApplyInSequence(t *testing.T) {
+	dir := t.TempDir()
+	_ = os.WriteFile(filepath.Join(dir, "a.txt"), []byte("one\ntwo\nthree\n"), 0o644)
+	// Two sections for a.txt, the second matching the first's output.
+	patch := `--- a/a.txt
++++ b/a.txt
+@@ -1,3 +1,3 @@
+ one
+-two
++TWO
+ three
+--- a/a.txt
++++ b/a.txt
+@@ -1,3 +1,4 @@
+ one
+ TWO
+ three
++four
+`
+	out, err := ApplyPatch(dir, patch)
+	if err != nil {
+		t.Fatalf("ApplyPatch: %v", err)
+	}
+	if got, _ := os.ReadFile(filepath.Join(dir, "a.txt")); string(got) != "one\nTWO\nthree\nfour\n" {
+		t.Fatalf("a.txt: %q", got)
+	}
+	if strings.Count(out, "a.txt") != 1 {
+		t.Fatalf("a.txt should be listed once: %q", out)
+	}
+}
+
+func TestApplyPatch_UnifiedDiffRejectsPathTraversal(t *testing.T) {
+	dir := t.TempDir()
+	for _, p := range []string{
+		"--- /dev/null\n+++ b/../x.txt\n@@ -0,0 +1 @@\n+nope\n",
+		"diff --git a/x b/y\nrename from x\nrename to /etc/y\n",
+	} {
+		if _, err := ApplyPatch(dir, p); err == nil {
+			t.Fatalf("expected error for patch:\n%s", p)
+		}
+	}
+}
@@ -0,0 +1,769 @@
+package agent
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// A unified diff (plain `diff -u` or `git diff` output) is applied
+// atomically: every hunk of every file is located first, and nothing is
+// written unless all of them apply. Hunks may land at an offset from their
+// header line numbers, match modulo whitespace, or drop up to
+// unifiedMaxFuzz lines of leading/trailing context, like patch(1).
+
+const unifiedMaxFuzz = 2
+
+type unifiedFilePatch struct {
+	oldPath, newPath string // "" for /dev/null
+	isNew, isDelete  bool
+	isCopy           bool
+	newMode          string
+	hunks            []unifiedHunk
+	binary           []byte // new content from a GIT binary patch literal
+	hasBinary        bool
+}
+
+type unifiedHunk struct {
+	header   string
+	oldStart int
+	lines    []hunkLine
+	// noEOL records "\ No newline at end of file" for each side.
+	oldNoEOL, newNoEOL bool
+}
+
+type hunkLine struct {
+	kind byte // ' ', '-', '+'
+	text string
+}
+
+func (h unifiedHunk) sides() (oldSide, newSide []hunkLine) {
+	for _, l := range h.lines {
+		if l.kind != '+' {
+			oldSide = append(oldSide, l)
+		}
+		if l.kind != '-' {
+			newSide = append(newSide, l)
+		}
+	}
+	return oldSide, newSide
+}
+
+// hunkResult describes where (or why not) one hunk applied.
+type hunkResult struct {
+	file       string
+	index      int // 1-based within the file
+	header     string
+	line       int // 1-based line the hunk applied at
+	offset     int
+	fuzz       int
+	whitespace bool
+	err        string
+}
+
+func (r hunkResult) String() string {
+	if r.err != "" {
+		return fmt.Sprintf("%s hunk %d (%s): FAILED: %s", r.file, r.index, r.header, r.err)
+	}
+	var notes []string
+	if r.offset != 0 {
+		notes = append(notes, fmt.Sprintf("offset %+d", r.offset))
+	}
+	if r.fuzz > 0 {
+		notes = append(notes, fmt.Sprintf("fuzz %d", r.fuzz))
+	}
+	if r.whitespace {
+		notes = append(notes, "ignoring whitespace")
+	}
+	s := fmt.Sprintf("%s hunk %d: applied at line %d", r.file, r.index, r.line)
+	if len(notes) > 0 {
+		s += " (" + strings.Join(notes, ", ") + ")"
+	}
+	return s
+}
+
+// unifiedPatchError reports the first hunk that failed, with the content it
+// expected, the closest region of the file, and every hunk's result.
+type unifiedPatchError struct {
+	file     string
+	hunk     int
+	header   string
+	reason   string
+	expected []string
+	nearLine int // 1-based; 0 when nothing similar was found
+	near     []string
+	results  []hunkResult
+}
+
+func (e *unifiedPatchError) Error() string {
+	var b strings.Builder
+	if e.hunk > 0 {
+		fmt.Fprintf(&b, "apply_patch: hunk %d of %s (%s) did not apply: %s\n", e.hunk, e.file, e.header, e.reason)
+	} else {
+		fmt.Fprintf(&b, "apply_patch: %s: %s\n", e.file, e.reason)
+	}
+	if len(e.expected) > 0 {
+		b.WriteString("expected these lines:\n")
+		for _, l := range e.expected {
+			b.WriteString("  |" + l + "\n")
+		}
+	}
+	if e.nearLine > 0 {
+		fmt.Fprintf(&b, "closest match in the file, at line %d:\n", e.nearLine)
+		for _, l := range e.near {
+			b.WriteString("  |" + l + "\n")
+		}
+	}
+	if len(e.results) > 1 {
+		b.WriteString("hunk results:\n")
+		for _, r := range e.results {
+			b.WriteString("  " + r.String() + "\n")
+		}
+	}
+	b.WriteString("No files were changed. Fix the failing hunk (re-read the file for exact context) and resend the whole patch.")
+	return b.String()
+}
+
+var (
+	unifiedHunkHeaderRE = regexp.MustCompile(`^@@ -(\d+)(?:,(\d+))? \+(\d+)(?:,(\d+))? @@`)
+	gitDiffHeaderRE     = regexp.MustCompile(`^diff --git (\S+|"[^"]+") (\S+|"[^"]+")$`)
+)
+
+// stripCodeFence removes a markdown ``` fence wrapped around a whole patch.
+func stripCodeFence(patch string) string {
+	t := strings.TrimSpace(patch)
+	if !strings.HasPrefix(t, "```") || !strings.HasSuffix(t, "```") {
+		return patch
+	}
+	nl := strings.IndexByte(t, '\n')
+	if nl < 0 {
+		return patch
+	}
+	return strings.TrimSuffix(t[nl+1:], "```")
+}
+
+// looksLikeUnifiedDiff reports whether patch has unified-diff file headers
+// or hunk headers.
+func looksLikeUnifiedDiff(patch string) bool {
+	for _, l := range strings.Split(patch, "\n") {
+		if strings.HasPrefix(l, "diff --git ") || strings.HasPrefix(l, "+++ ") || unifiedHunkHeaderRE.MatchString(l) {
+			return true
+		}
+	}
+	return false
+}
+
+func parseUnifiedDiff(patch string) ([]*unifiedFilePatch, error) {
+	lines := strings.Split(strings.ReplaceAll(patch, "\r\n", "\n"), "\n")
+	var files []*unifiedFilePatch
+	var cur *unifiedFilePatch
+	startFile := func() *unifiedFilePatch {
+		cur = &unifiedFilePatch{}
+		files = append(files, cur)
+		return cur
+	}
+	for i := 0; i < len(lines); {
+		l := lines[i]
+		switch {
+		case strings.HasPrefix(l, "diff --git "):
+			f := startFile()
+			if m := gitDiffHeaderRE.FindStringSubmatch(l); m != nil {
+				f.oldPath, f.newPath = diffPath(m[1]), diffPath(m[2])
+			}
+			i++
+		case strings.HasPrefix(l, "--- ") && i+1 < len(lines) && strings.HasPrefix(lines[i+1], "+++ "):
+			if cur == nil || len(cur.hunks) > 0 || cur.hasBinary {
+				startFile()
+			}
+			cur.oldPath, cur.newPath = diffPath(l[4:]), diffPath(lines[i+1][4:])
+			cur.isNew = cur.isNew || cur.oldPath == ""
+			cur.isDelete = cur.isDelete || cur.newPath == ""
+			i += 2
+		case cur != nil && strings.HasPrefix(l, "new file mode "):
+			cur.isNew, cur.oldPath = true, ""
+			cur.newMode = strings.TrimSpace(strings.TrimPrefix(l, "new file mode "))
+			i++
+		case cur != nil && strings.HasPrefix(l, "deleted file mode "):
+			cur.isDelete, cur.newPath = true, ""
+			i++
+		case cur != nil && strings.HasPrefix(l, "new mode "):
+			cur.newMode = strings.TrimSpace(strings.TrimPrefix(l, "new mode "))
+			i++
+		case cur != nil && (strings.HasPrefix(l, "rename from ") || strings.HasPrefix(l, "copy from ")):
+			_, p, _ := strings.Cut(l, " from ")
+			cur.oldPath = diffPathNoPrefix(p)
+			cur.isCopy = strings.HasPrefix(l, "copy")
+			i++
+		case cur != nil && (strings.HasPrefix(l, "rename to ") || strings.HasPrefix(l, "copy to ")):
+			_, p, _ := strings.Cut(l, " to ")
+			cur.newPath = diffPathNoPrefix(p)
+			i++
+		case cur != nil && strings.HasPrefix(l, "Binary files "):
+			return nil, fmt.Errorf("apply_patch: %s: binary diff has no content (use `git diff --binary`, or write the file directly)", firstNonEmptyString(cur.newPath, cur.oldPath))
+		case cur != nil && l == "GIT binary patch":
+			data, next, err := parseGitBinaryLiteral(lines, i+1)
+			if err != nil {
+				return nil, fmt.Errorf("apply_patch: %s: %w", firstNonEmptyString(cur.newPath, cur.oldPath), err)
+			}
+			cur.binary, cur.hasBinary = data, true
+			i = next
+		case unifiedHunkHeaderRE.MatchString(l):
+			if cur == nil {
+				return nil, fmt.Errorf("apply_patch: hunk %q has no file header ('--- a/<path>' and '+++ b/<path>')", l)
+			}
+			h, next := parseUnifiedHunk(lines, i)
+			cur.hunks = append(cur.hunks, h)
+			i = next
+		default:
+			// index lines, similarity, commit messages, trailing blank lines...
+			i++
+		}
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("apply_patch: no file headers found in unified diff")
+	}
+	for _, f := range files {
+		if f.oldPath == "" && f.newPath == "" {
+			return nil, fmt.Errorf("apply_patch: unified diff file section without a path")
+		}
+	}
+	return files, nil
+}
+
+func parseUnifiedHunk(lines []string, i int) (unifiedHunk, int) {
+	header := lines[i]
+	m := unifiedHunkHeaderRE.FindStringSubmatch(header)
+	h := unifiedHunk{header: m[0]}
+	h.oldStart, _ = strconv.Atoi(m[1])
+	i++
+	for ; i < len(lines); i++ {
+		l := lines[i]
+		if unifiedHunkHeaderRE.MatchString(l) || strings.HasPrefix(l, "diff --git ") ||
+			(strings.HasPrefix(l, "--- ") && i+1 < len(lines) && strings.HasPrefix(lines[i+1], "+++ ")) {
+			break
+		}
+		if strings.HasPrefix(l, `\`) {
+			if n := len(h.lines); n > 0 {
+				switch h.lines[n-1].kind {
+				case '-':
+					h.oldNoEOL = true
+				case '+':
+					h.newNoEOL = true
+				default:
+					h.oldNoEOL, h.newNoEOL = true, true
+				}
+			}
+			continue
+		}
+		if l == "" {
+			// Models often drop the leading space of blank context lines.
+			h.lines = append(h.lines, hunkLine{kind: ' '})
+			continue
+		}
+		switch l[0] {
+		case ' ', '-', '+':
+			h.lines = append(h.lines, hunkLine{kind: l[0], text: l[1:]})
+		default:
+			return trimTrailingBlankContext(h), i
+		}
+	}
+	return trimTrailingBlankContext(h), i
+}
+
+// trimTrailingBlankContext drops blank context lines at the end of a hunk,
+// which are usually the patch's own trailing newline rather than content.
+func trimTrailingBlankContext(h unifiedHunk) unifiedHunk {
+	for n := len(h.lines); n > 0 && h.lines[n-1].kind == ' ' && h.lines[n-1].text == ""; n-- {
+		h.lines = h.lines[:n-1]
+	}
+	return h
+}
+
+// diffPath normalizes a ---/+++/diff --git path: unquotes, drops timestamps
+// and the a/ b/ prefixes, and maps /dev/null to "".
+func diffPath(p string) string {
+	p = strings.TrimSpace(p)
+	if strings.HasPrefix(p, `"`) {
+		if end := strings.LastIndex(p, `"`); end > 0 {
+			if u, err := strconv.Unquote(p[:end+1]); err == nil {
+				p = u
+			}
+		}
+	} else if tab := strings.IndexByte(p, '\t'); tab >= 0 {
+		p = p[:tab]
+	}
+	if p == "/dev/null" {
+		return ""
+	}
+	if strings.HasPrefix(p, "a/") || strings.HasPrefix(p, "b/") {
+		p = p[2:]
+	}
+	return p
+}
+
+// diffPathNoPrefix normalizes rename/copy header paths, which carry no a/ b/.
+func diffPathNoPrefix(p string) string {
+	p = strings.TrimSpace(p)
+	if u, err := strconv.Unquote(p); err == nil {
+		return u
+	}
+	return p
+}
+
+const gitBase85Alphabet = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz!#$%&()*+-;<=>?@^_`{|}~"
+
+// parseGitBinaryLiteral decodes the forward "literal <size>" block of a GIT
+// binary patch starting at lines[i] and returns the index after the patch.
+func parseGitBinaryLiteral(lines []string, i int) ([]byte, int, error) {
+	if i >= len(lines) || !strings.HasPrefix(lines[i], "literal ") {
+		return nil, i, fmt.Errorf("only literal binary patches are supported (binary deltas are not); write the file instead")
+	}
+	size, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(lines[i], "literal ")))
+	if err != nil {
+		return nil, i, fmt.Errorf("bad binary literal header %q", lines[i])
+	}
+	i++
+	var z []byte
+	for ; i < len(lines) && lines[i] != ""; i++ {
+		chunk, err := decodeGitBase85Line(lines[i])
+		if err != nil {
+			return nil, i, err
+		}
+		z = append(z, chunk...)
+	}
+	// Skip the reverse block (literal/delta back to the old content).
+	for i < len(lines) && lines[i] == "" {
+		i++
+	}
+	if i < len(lines) && (strings.HasPrefix(lines[i], "literal ") || strings.HasPrefix(lines[i], "delta ")) {
+		for i++; i < len(lines) && lines[i] != ""; i++ {
+		}
+	}
+	r, err := zlib.NewReader(bytes.NewReader(z))
+	if err != nil {
+		return nil, i, fmt.Errorf("binary literal: %w", err)
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, i, fmt.Errorf("binary literal: %w", err)
+	}
+	if len(data) != size {
+		return nil, i, fmt.Errorf("binary literal: got %d bytes, header says %d", len(data), size)
+	}
+	return data, i, nil
+}
+
+func decodeGitBase85Line(l string) ([]byte, error) {
+	if l == "" {
+		return nil, nil
+	}
+	var n int
+	switch c := l[0]; {
+	case c >= 'A' && c <= 'Z':
+		n = int(c-'A') + 1
+	case c >= 'a' && c <= 'z':
+		n = int(c-'a') + 27
+	default:
+		return nil, fmt.Errorf("bad binary line length %q", c)
+	}
+	enc := l[1:]
+	if len(enc)%5 != 0 {
+		return nil, fmt.Errorf("bad binary line %q", l)
+	}
+	out := make([]byte, 0, len(enc)/5*4)
+	for j := 0; j < len(enc); j += 5 {
+		var acc uint64
+		for _, c := range []byte(enc[j : j+5]) {
+			v := strings.IndexByte(gitBase85Alphabet, c)
+			if v < 0 {
+				return nil, fmt.Errorf("bad base85 character %q", c)
+			}
+			acc = acc*85 + uint64(v)
+		}
+		if acc > 0xffffffff {
+			return nil, fmt.Errorf("bad base85 group %q", enc[j:j+5])
+		}
+		out = append(out, byte(acc>>24), byte(acc>>16), byte(acc>>8), byte(acc))
+	}
+	if n > len(out) {
+		return nil, fmt.Errorf("binary line shorter than its length byte")
+	}
+	return out[:n], nil
+}
+
+// applyUnifiedDiff applies a parsed unified diff under rootDir.
+func applyUnifiedDiff(rootDir string, patch string) (string, error) {
+	files, err := parseUnifiedDiff(patch)
+	if err != nil {
+		return "", err
+	}
+
+	// Sections apply in order to an in-memory view of the tree, so several
+	// sections for one path build on each other. Nothing is written until
+	// every section applies.
+	type fileState struct {
+		content []byte
+		mode    os.FileMode
+		exists  bool
+	}
+	staged := map[string]*fileState{}
+	var order []string
+	lookup := func(rel string) (*fileState, error) {
+		if st, ok := staged[rel]; ok {
+			return st, nil
+		}
+		abs, _ := safeJoin(rootDir, rel)
+		info, err := os.Stat(abs)
+		if os.IsNotExist(err) {
+			return &fileState{}, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		b, err := os.ReadFile(abs)
+		if err != nil {
+			return nil, err
+		}
+		return &fileState{content: b, mode: info.Mode().Perm(), exists: true}, nil
+	}
+	stage := func(rel string, st *fileState) {
+		if _, ok := staged[rel]; !ok {
+			order = append(order, rel)
+		}
+		staged[rel] = st
+	}
+	var touched []string
+	seen := map[string]bool{}
+	touch := func(rel string) {
+		if !seen[rel] {
+			seen[rel] = true
+			touched = append(touched, rel)
+		}
+	}
+	var results []hunkResult
+	var notes []string
+
+	for _, f := range files {
+		src, dst := f.oldPath, f.newPath
+		name := firstNonEmptyString(dst, src)
+		for _, p := range []string{src, dst} {
+			if p == "" {
+				continue
+			}
+			if _, err := safeJoin(rootDir, p); err != nil {
+				return "", fmt.Errorf("apply_patch: %w", err)
+			}
+		}
+		mode := os.FileMode(0o644)
+		if f.newMode == "100755" {
+			mode = 0o755
+		}
+		cur := &fileState{}
+		if src != "" {
+			if cur, err = lookup(src); err != nil {
+				return "", &unifiedPatchError{file: src, reason: fmt.Sprintf("cannot read: %v", err), results: results}
+			}
+		}
+		if !f.isNew && !f.isDelete && src == dst && onlyInsertsAtTop(f.hunks) && !cur.exists {
+			// `--- a/x` + `@@ -0,0 +1,N @@` for a file that does not exist yet.
+			f.isNew, src = true, ""
+		}
+
+		switch {
+		case f.isDelete:
+			if !cur.exists {
+				return "", &unifiedPatchError{file: src, reason: "cannot delete: file does not exist", results: results}
+			}
+			stage(src, &fileState{})
+			touch(src)
+			continue
+		case f.isNew && dst != "":
+			st, err := lookup(dst)
+			if err != nil {
+				return "", &unifiedPatchError{file: dst, reason: fmt.Sprintf("cannot read: %v", err), results: results}
+			}
+			if st.exists {
+				return "", &unifiedPatchError{file: dst, reason: "cannot create: file already exists", results: results}
+			}
+		}
+
+		if f.hasBinary {
+			stage(dst, &fileState{content: f.binary, mode: mode, exists: true})
+			touch(dst)
+			if !f.isNew && !f.isCopy && src != dst {
+				stage(src, &fileState{})
+			}
+			continue
+		}
+
+		var orig string
+		crlf := false
+		if !f.isNew {
+			if !cur.exists {
+				return "", &unifiedPatchError{file: src, reason: "cannot read: file does not exist", results: results}
+			}
+			// Hunks match LF text; a CRLF file gets its line endings back on
+			// write.
+			orig = string(cur.content)
+			crlf = usesCRLF(orig)
+			orig = strings.ReplaceAll(orig, "\r\n", "\n")
+			if f.newMode == "" {
+				mode = cur.mode
+			}
+		}
+		newText, fileResults, perr := applyHunks(name, orig, f.hunks)
+		results = append(results, fileResults...)
+		if perr != nil {
+			perr.results = results
+			return "", perr
+		}
+		for _, r := range fileResults {
+			if r.offset != 0 || r.fuzz > 0 || r.whitespace {
+				notes = append(notes, r.String())
+			}
+		}
+		if crlf {
+			newText = strings.ReplaceAll(newText, "\n", "\r\n")
+		}
+		stage(dst, &fileState{content: []byte(newText), mode: mode, exists: true})
+		touch(dst)
+		if src != "" && dst != src && !f.isCopy {
+			stage(src, &fileState{})
+			touch(src)
+		}
+	}
+
+	for _, rel := range order {
+		st := staged[rel]
+		if !st.exists {
+			continue
+		}
+		p, _ := safeJoin(rootDir, rel)
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			return "", err
+		}
+		if err := os.WriteFile(p, st.content, st.mode); err != nil {
+			return "", err
+		}
+		_ = os.Chmod(p, st.mode)
+	}
+	for _, rel := range order {
+		if staged[rel].exists {
+			continue
+		}
+		p, _ := safeJoin(rootDir, rel)
+		if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+			return "", err
+		}
+	}
+	if len(touched) == 0 {
+		return "no changes", nil
+	}
+	out := "applied patch to:\n" + strings.Join(touched, "\n")
+	if len(notes) > 0 {
+		out += "\nnotes:\n" + strings.Join(notes, "\n")
+	}
+	return out, nil
+}
+
+// usesCRLF reports whether most of text's line endings are CRLF.
+func usesCRLF(text string) bool {
+	crlf := strings.Count(text, "\r\n")
+	return crlf > 0 && crlf >= strings.Count(text, "\n")-crlf
+}
+
+func onlyInsertsAtTop(hunks []unifiedHunk) bool {
+	for _, h := range hunks {
+		if oldSide, _ := h.sides(); h.oldStart != 0 || len(oldSide) > 0 {
+			return false
+		}
+	}
+	return len(hunks) > 0
+}
+
+// applyHunks applies hunks in order to text and returns the new text.
+func applyHunks(file string, text string, hunks []unifiedHunk) (string, []hunkResult, *unifiedPatchError) {
+	hasFinalNL := text == "" || strings.HasSuffix(text, "\n")
+	var lines []string
+	if text != "" {
+		lines = strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+	}
+	var results []hunkResult
+	delta, minPos := 0, 0
+	for idx, h := range hunks {
+		res := hunkResult{file: file, index: idx + 1, header: h.header}
+		oldSide, _ := h.sides()
+		// A hunk without old lines inserts after line oldStart.
+		expect := h.oldStart - 1 + delta
+		if len(oldSide) == 0 {
+			expect = h.oldStart + delta
+		}
+		if expect < 0 {
+			expect = 0
+		}
+		pos, hl, fuzz, ws, ok := locateHunk(lines, h.lines, expect, minPos)
+		if !ok {
+			perr := &unifiedPatchError{file: file, hunk: idx + 1, header: h.header, reason: "the context/removed lines were not found in the file"}
+			if nearestMatch(lines, oldSide, expect, 0, trimSpaceEqual) >= 0 {
+				perr.reason = "the hunk only matches before an earlier hunk (hunks must be in file order)"
+			}
+			for _, l := range oldSide {
+				perr.expected = append(perr.expected, l.text)
+			}
+			perr.nearLine, perr.near = closestRegion(lines, oldSide, expect)
+			res.err = perr.reason
+			return "", append(results, res), perr
+		}
+		usedOld, usedNew := unifiedHunk{lines: hl}.sides()
+		segment := make([]string, 0, len(usedNew))
+		oi := 0
+		for _, l := range hl {
+			switch l.kind {
+			case ' ':
+				segment = append(segment, lines[pos+oi]) // keep the file's own text
+				oi++
+			case '-':
+				oi++
+			case '+':
+				segment = append(segment, l.text)
+			}
+		}
+		tail := append([]string{}, lines[pos+len(usedOld):]...)
+		lines = append(append(lines[:pos], segment...), tail...)
+		if len(tail) == 0 {
+			// The hunk reaches the end of the file, so it decides the final newline.
+			hasFinalNL = !h.newNoEOL
+		}
+		res.line = pos + 1
+		res.offset = pos - expect
+		res.fuzz, res.whitespace = fuzz, ws
+		results = append(results, res)
+		delta += len(usedNew) - len(usedOld)
+		minPos = pos + len(segment)
+	}
+	out := strings.Join(lines, "\n")
+	if hasFinalNL && len(lines) > 0 {
+		out += "\n"
+	}
+	return out, results, nil
+}
+
+func trimSpaceEqual(a, b string) bool { return strings.TrimSpace(a) == strings.TrimSpace(b) }
+
+// locateHunk finds where a hunk's old side matches, nearest to expect and
+// not before minPos. It tries an exact match, then ignoring trailing and then
+// all surrounding whitespace, then again with up to unifiedMaxFuzz context
+// lines dropped from each end. It returns the (possibly trimmed) hunk lines.
+func locateHunk(lines []string, hl []hunkLine, expect, minPos int) (pos int, used []hunkLine, fuzz int, whitespace bool, ok bool) {
+	eqs := []func(a, b string) bool{
+		func(a, b string) bool { return a == b },
+		func(a, b string) bool { return strings.TrimRight(a, " \t") == strings.TrimRight(b, " \t") },
+		trimSpaceEqual,
+	}
+	for fuzz = 0; fuzz <= unifiedMaxFuzz; fuzz++ {
+		trimmed, lead, ok := trimContext(hl, fuzz)
+		if !ok {
+			break
+		}
+		oldSide, _ := unifiedHunk{lines: trimmed}.sides()
+		for level, eq := range eqs {
+			if p := nearestMatch(lines, oldSide, expect+lead, minPos, eq); p >= 0 {
+				return p, trimmed, fuzz, level > 0, true
+			}
+		}
+	}
+	return 0, nil, 0, false, false
+}
+
+// trimContext drops up to n context lines from each end of a hunk and
+// reports how many were dropped from the front; ok is false when there is
+// no context left to drop at this fuzz level.
+func trimContext(hl []hunkLine, n int) (trimmed []hunkLine, lead int, ok bool) {
+	if n == 0 {
+		return hl, 0, true
+	}
+	trail := 0
+	for lead < n && lead < len(hl) && hl[lead].kind == ' ' {
+		lead++
+	}
+	for trail < n && len(hl)-1-trail > lead && hl[len(hl)-1-trail].kind == ' ' {
+		trail++
+	}
+	if lead < n && trail < n {
+		return nil, 0, false
+	}
+	return hl[lead : len(hl)-trail], lead, true
+}
+
+func nearestMatch(lines []string, old []hunkLine, expect, minPos int, eq func(a, b string) bool) int {
+	if len(old) == 0 {
+		if expect < minPos {
+			expect = minPos
+		}
+		if expect > len(lines) {
+			expect = len(lines)
+		}
+		return expect
+	}
+	matchAt := func(p int) bool {
+		if p < minPos || p+len(old) > len(lines) {
+			return false
+		}
+		for i, l := range old {
+			if !eq(lines[p+i], l.text) {
+				return false
+			}
+		}
+		return true
+	}
+	for d := 0; d <= len(lines); d++ {
+		if matchAt(expect - d) {
+			return expect - d
+		}
+		if d > 0 && matchAt(expect+d) {
+			return expect + d
+		}
+	}
+	return -1
+}
+
+// closestRegion finds the file region that best resembles the hunk's old
+// side (most lines equal modulo whitespace), preferring regions near expect.
+func closestRegion(lines []string, old []hunkLine, expect int) (int, []string) {
+	if len(old) == 0 || len(lines) == 0 {
+		return 0, nil
+	}
+	best, bestScore := -1, 0
+	for p := 0; p < len(lines); p++ {
+		score := 0
+		for i, l := range old {
+			if p+i < len(lines) && strings.TrimSpace(lines[p+i]) == strings.TrimSpace(l.text) && strings.TrimSpace(l.text) != "" {
+				score++
+			}
+		}
+		if score > bestScore || (score == bestScore && score > 0 && abs(p-expect) < abs(best-expect)) {
+			best, bestScore = p, score
+		}
+	}
+	if best < 0 {
+		return 0, nil
+	}
+	end := best + len(old)
+	if end > len(lines) {
+		end = len(lines)
+	}
+	return best + 1, lines[best:end]
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
@@ -33,3 +33,31 @@ type ExecutionEnvironment interface {
 
 	ExecCommand(ctx context.Context, command string, timeoutMS int, workingDir string, envVars map[string]string) (ExecResult, error)
 }
+
+// RootableEnvironment is implemented by environments that can produce a copy
+// rooted at another directory (used for isolated subagent worktrees).
+type RootableEnvironment interface {
+	WithRootDir(dir string) ExecutionEnvironment
+}
+
+// CommandEnvironment is implemented by environments that apply an env policy
+// to the commands they run. Long-lived helpers the session starts itself
+// (language servers) take their environment from it.
+type CommandEnvironment interface {
+	// CommandEnv returns the environment for a command with extra set.
+	CommandEnv(extra map[string]string) []string
+}
+
+// commandEnv is env's command environment, or the default filtered process
+// environment when env has no policy of its own. Keys in extra were declared
+// in config, so they pass the sensitive-name deny list.
+func commandEnv(env ExecutionEnvironment, extra map[string]string) []string {
+	if ce, ok := env.(CommandEnvironment); ok {
+		return ce.CommandEnv(extra)
+	}
+	allow := make(map[string]bool, len(extra))
+	for k := range extra {
+		allow[k] = true
+	}
+	return filteredEnv(extra, nil, allow)
+}
@@ -50,6 +50,10 @@ func NewLocalExecutionEnvironment(rootDir string) *LocalExecutionEnvironment {
 
 func (e *LocalExecutionEnvironment) WorkingDirectory() string { return e.RootDir }
 
+func (e *LocalExecutionEnvironment) WithRootDir(dir string) ExecutionEnvironment {
+	return NewLocalExecutionEnvironmentWithPolicy(dir, e.BaseEnv, e.StripEnvKeys)
+}
+
 func (e *LocalExecutionEnvironment) Platform() string {
 	switch runtime.GOOS {
 	case "darwin":
@@ -254,6 +258,39 @@ func (e *LocalExecutionEnvironment) Grep(pattern string, path string, globFilter
 	return res.Stdout + res.Stderr, err
 }
 
+// CommandEnv applies the environment's policy to a command with extra set.
+// Keys in extra were declared in config, like BaseEnv, so they pass the
+// sensitive-name deny list.
+func (e *LocalExecutionEnvironment) CommandEnv(extra map[string]string) []string {
+	allow := make(map[string]bool, len(extra))
+	for k := range extra {
+		allow[k] = true
+	}
+	return e.policyEnv(extra, allow)
+}
+
+func (e *LocalExecutionEnvironment) policyEnv(extra map[string]string, allowSensitive map[string]bool) []string {
+	mergedEnv := map[string]string{}
+	for k, v := range e.BaseEnv {
+		mergedEnv[k] = v
+	}
+	for k, v := range extra {
+		mergedEnv[k] = v
+	}
+	// BaseEnv keys were explicitly declared by the operator (e.g. via
+	// artifact_policy.env.overrides in the run config).  Allow them through
+	// the sensitive-name deny list so that keys like GEMINI_API_KEY reach
+	// the agent shell when intentionally configured.
+	allow := make(map[string]bool, len(e.BaseEnv)+len(allowSensitive))
+	for k := range e.BaseEnv {
+		allow[k] = true
+	}
+	for k := range allowSensitive {
+		allow[k] = true
+	}
+	return filteredEnv(mergedEnv, e.StripEnvKeys, allow)
+}
+
 func (e *LocalExecutionEnvironment) ExecCommand(ctx context.Context, command string, timeoutMS int, workingDir string, envVars map[string]string) (ExecResult, error) {
 	if timeoutMS <= 0 {
 		timeoutMS = 10_000
@@ -270,22 +307,7 @@ func (e *LocalExecutionEnvironment) ExecCommand(ctx context.Context, command str
 	cmd := exec.Command("bash", "-lc", command)
 	cmd.Dir = dir
 	setSysProcAttr(cmd)
-	mergedEnv := map[string]string{}
-	for k, v := range e.BaseEnv {
-		mergedEnv[k] = v
-	}
-	for k, v := range envVars {
-		mergedEnv[k] = v
-	}
-	// BaseEnv keys were explicitly declared by the operator (e.g. via
-	// artifact_policy.env.overrides in the run config).  Allow them through
-	// the sensitive-name deny list so that keys like GEMINI_API_KEY reach
-	// the agent shell when intentionally configured.
-	allowSensitive := make(map[string]bool, len(e.BaseEnv))
-	for k := range e.BaseEnv {
-		allowSensitive[k] = true
-	}
-	cmd.Env = filteredEnv(mergedEnv, e.StripEnvKeys, allowSensitive)
+	cmd.Env = e.policyEnv(envVars, nil)
 
 	var stdout, stderr bytes.Buffer
 	cmd.Stdout = &stdout
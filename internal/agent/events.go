@@ -19,6 +19,7 @@ const (
 	EventLoopDetection       EventKind = "LOOP_DETECTION"
 	EventWarning             EventKind = "WARNING"
 	EventError               EventKind = "ERROR"
+	EventSubagentUsage       EventKind = "SUBAGENT_USAGE" // one LLM call by a subagent at any depth
 )
 
 type SessionEvent struct {
@@ -0,0 +1,183 @@
+package agent
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/danshapiro/kilroy/internal/llm"
+)
+
+// Journal entry kinds besides the TurnKinds.
+const (
+	journalSessionStart = "SESSION_START"
+	journalSessionEnd   = "SESSION_END"
+)
+
+// journalEntry is one line of a session journal (NDJSON). The first line is a
+// SESSION_START header, followed by one line per history turn; a session that
+// finished (rather than being interrupted) ends with SESSION_END.
+type journalEntry struct {
+	Kind      string       `json:"kind"`
+	Timestamp time.Time    `json:"ts"`
+	Provider  string       `json:"provider,omitempty"`
+	Model     string       `json:"model,omitempty"`
+	Message   *llm.Message `json:"message,omitempty"`
+	Usage     *llm.Usage   `json:"usage,omitempty"`
+}
+
+// Journal is a session transcript loaded back from disk.
+type Journal struct {
+	Provider string
+	Model    string
+	Turns    []Turn
+	// Ended reports whether the session closed normally. A journal without
+	// an end marker belongs to a session that was interrupted (aborted, or the
+	// process died) and can be resumed.
+	Ended bool
+}
+
+// LoadJournal reads a session journal. A truncated final line (the process
+// died mid-write) is ignored.
+func LoadJournal(path string) (*Journal, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+	j := &Journal{}
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64*1024), 256*1024*1024)
+	line := 0
+	for sc.Scan() {
+		line++
+		var e journalEntry
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+			break
+		}
+		switch e.Kind {
+		case journalSessionStart:
+			j.Provider, j.Model = e.Provider, e.Model
+		case journalSessionEnd:
+			j.Ended = true
+		default:
+			if e.Message == nil {
+				return nil, fmt.Errorf("%s:%d: %s entry without message", path, line, e.Kind)
+			}
+			j.Turns = append(j.Turns, Turn{Kind: TurnKind(e.Kind), Message: *e.Message})
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return j, nil
+}
+
+// sessionJournal appends a session's turns to its journal file as they happen.
+type sessionJournal struct {
+	mu  sync.Mutex
+	f   *os.File
+	enc *json.Encoder
+}
+
+// openSessionJournal starts a journal at path with a header and the restored
+// turns (if any), replacing whatever was there. The initial content is written
+// to a temporary file and renamed into place so a crash never loses the
+// transcript being resumed.
+func openSessionJournal(path string, profile ProviderProfile, restored []Turn) (*sessionJournal, error) {
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return nil, err
+	}
+	enc := json.NewEncoder(f)
+	err = enc.Encode(journalEntry{Kind: journalSessionStart, Timestamp: time.Now().UTC(), Provider: profile.ID(), Model: profile.Model()})
+	for i := 0; err == nil && i < len(restored); i++ {
+		m := restored[i].Message
+		err = enc.Encode(journalEntry{Kind: string(restored[i].Kind), Timestamp: time.Now().UTC(), Message: &m})
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+		return nil, err
+	}
+	f, err = os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		return nil, err
+	}
+	return &sessionJournal{f: f, enc: json.NewEncoder(f)}, nil
+}
+
+func (j *sessionJournal) append(kind string, m *llm.Message, usage *llm.Usage) error {
+	if j == nil {
+		return nil
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.f == nil {
+		return nil
+	}
+	return j.enc.Encode(journalEntry{Kind: kind, Timestamp: time.Now().UTC(), Message: m, Usage: usage})
+}
+
+// close ends the journal; ended records that the session finished rather than
+// being interrupted.
+func (j *sessionJournal) close(ended bool) {
+	if j == nil {
+		return
+	}
+	if ended {
+		_ = j.append(journalSessionEnd, nil, nil)
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.f != nil {
+		_ = j.f.Close()
+		j.f = nil
+	}
+}
+
+// reconcileInterruptedTurns prepares a restored transcript for continuation:
+// tool calls whose results were never recorded get an error result, so the
+// history stays well-formed for every provider.
+func reconcileInterruptedTurns(turns []Turn) []Turn {
+	out := append([]Turn{}, turns...)
+	for i := len(out) - 1; i >= 0; i-- {
+		if out[i].Kind != TurnAssistant {
+			continue
+		}
+		answered := map[string]bool{}
+		for _, t := range out[i+1:] {
+			if t.Kind == TurnTool {
+				answered[t.Message.ToolCallID] = true
+				for _, p := range t.Message.Content {
+					if p.ToolResult != nil {
+						answered[p.ToolResult.ToolCallID] = true
+					}
+				}
+			}
+		}
+		var missing []Turn
+		for _, call := range (llm.Response{Message: out[i].Message}).ToolCalls() {
+			if !answered[call.ID] {
+				missing = append(missing, Turn{Kind: TurnTool, Message: llm.ToolResultNamed(call.ID, call.Name,
+					"interrupted: the session stopped before this tool call completed; its effects (if any) are unknown", true)})
+			}
+		}
+		if len(missing) > 0 {
+			// Results must directly follow their calls.
+			tail := append([]Turn{}, out[i+1:]...)
+			out = append(append(out[:i+1], missing...), tail...)
+		}
+		break
+	}
+	return out
+}
@@ -0,0 +1,109 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/danshapiro/kilroy/internal/llm"
+)
+
+func TestSession_Journal_InterruptLoadAndResume(t *testing.T) {
+	dir := t.TempDir()
+	journal := filepath.Join(t.TempDir(), "session_journal.ndjson")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	toolCall := func(id, file string) llm.Response {
+		args, _ := json.Marshal(map[string]any{"file_path": file, "content": id + "\n"})
+		call := llm.ToolCallData{ID: id, Name: "write_file", Arguments: args, Type: "function"}
+		return llm.Response{
+			Message: llm.Message{Role: llm.RoleAssistant, Content: []llm.ContentPart{{Kind: llm.ContentToolCall, ToolCall: &call}}},
+			Usage:   llm.Usage{InputTokens: 11, OutputTokens: 2, TotalTokens: 13},
+		}
+	}
+	c := llm.NewClient()
+	c.Register(&fakeAdapter{name: "openai", steps: []func(req llm.Request) llm.Response{
+		func(req llm.Request) llm.Response { return toolCall("c1", "a.txt") },
+		func(req llm.Request) llm.Response {
+			cancel() // the process is stopped while the second call is in flight
+			return toolCall("c2", "b.txt")
+		},
+	}})
+	sess, err := NewSession(c, NewOpenAIProfile("gpt-5.4"), NewLocalExecutionEnvironment(dir), SessionConfig{JournalPath: journal})
+	if err != nil {
+		t.Fatalf("NewSession: %v", err)
+	}
+	if _, err := sess.ProcessInput(ctx, "write two files"); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected cancellation, got %v", err)
+	}
+	sess.Close()
+
+	j, err := LoadJournal(journal)
+	if err != nil {
+		t.Fatalf("LoadJournal: %v", err)
+	}
+	if j.Ended || j.Provider != "openai" || j.Model != "gpt-5.4" || len(j.Turns) < 3 {
+		t.Fatalf("interrupted journal: ended=%v provider=%q model=%q turns=%d", j.Ended, j.Provider, j.Model, len(j.Turns))
+	}
+	raw, _ := os.ReadFile(journal)
+	if !strings.Contains(string(raw), `"usage":{"input_tokens":11`) {
+		t.Fatalf("assistant turns should carry usage:\n%s", raw)
+	}
+
+	// Simulate a crash mid-tool-call: keep the turns up to the second
+	// assistant message and leave a torn final line behind.
+	var keep []string
+	for _, line := range strings.Split(strings.TrimSpace(string(raw)), "\n") {
+		keep = append(keep, line)
+		if strings.Contains(line, `"id":"c2"`) {
+			break
+		}
+	}
+	if err := os.WriteFile(journal, []byte(strings.Join(keep, "\n")+"\n{\"kind\":\"TOOL\",\"mess"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	j, err = LoadJournal(journal)
+	if err != nil {
+		t.Fatalf("LoadJournal (torn): %v", err)
+	}
+	if j.Ended || j.Turns[len(j.Turns)-1].Kind != TurnAssistant {
+		t.Fatalf("torn journal should end at the dangling assistant turn: %+v", j.Turns[len(j.Turns)-1])
+	}
+
+	f := &fakeAdapter{name: "openai"}
+	c2 := llm.NewClient()
+	c2.Register(f)
+	resumed, err := NewSession(c2, NewOpenAIProfile("gpt-5.4"), NewLocalExecutionEnvironment(dir), SessionConfig{JournalPath: journal, ResumeHistory: j.Turns})
+	if err != nil {
+		t.Fatalf("NewSession (resume): %v", err)
+	}
+	if out, err := resumed.ProcessInput(context.Background(), "you were interrupted; continue"); err != nil || out != "done" {
+		t.Fatalf("resumed ProcessInput: %q %v", out, err)
+	}
+	resumed.Close()
+
+	msgs := f.Requests()[0].Messages
+	if msgs[1].Text() != "write two files" {
+		t.Fatalf("resumed request should replay the original input, got %q", msgs[1].Text())
+	}
+	dangling := msgs[len(msgs)-2]
+	if dangling.Role != llm.RoleTool || dangling.ToolCallID != "c2" || !strings.Contains(dangling.Content[0].ToolResult.Content.(string), "interrupted") {
+		t.Fatalf("dangling call c2 should get a synthesized error result: %+v", dangling)
+	}
+	if msgs[len(msgs)-1].Text() != "you were interrupted; continue" {
+		t.Fatalf("last message: %q", msgs[len(msgs)-1].Text())
+	}
+
+	j, err = LoadJournal(journal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !j.Ended || len(j.Turns) != len(msgs) {
+		t.Fatalf("resumed journal: ended=%v turns=%d want %d", j.Ended, len(j.Turns), len(msgs))
+	}
+}
@@ -0,0 +1,546 @@
+package agent
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/textproto"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// LSPServerConfig declares a language server backing the code-intelligence
+// tools (find_definition, find_references, document_symbols, diagnostics)
+// for files with the given extensions. The server is launched over stdio in
+// the session's working directory the first time one of its files is queried,
+// and shut down by Close.
+type LSPServerConfig struct {
+	Name       string
+	Command    []string
+	Env        map[string]string
+	Extensions []string // e.g. ".go"; matched case-insensitively
+	// LanguageID is the textDocument languageId; it defaults to a guess from
+	// the file extension.
+	LanguageID string
+
+	// StartupTimeout bounds launch and initialize (default 60s).
+	StartupTimeout time.Duration
+	// RequestTimeout bounds a single request (default 60s).
+	RequestTimeout time.Duration
+}
+
+const (
+	lspDefaultStartupTimeout = 60 * time.Second
+	lspDefaultRequestTimeout = 60 * time.Second
+	// lspDiagnosticsWait is how long diagnostics waits for a server that only
+	// pushes diagnostics (textDocument/publishDiagnostics).
+	lspDiagnosticsWait = 10 * time.Second
+)
+
+// lspSet owns a session's language servers, started on demand.
+type lspSet struct {
+	cfgs []LSPServerConfig
+	env  ExecutionEnvironment
+	root string
+
+	mu      sync.Mutex
+	clients map[string]*lspClient
+	closed  bool
+}
+
+func newLSPSet(cfgs []LSPServerConfig, env ExecutionEnvironment) *lspSet {
+	return &lspSet{cfgs: cfgs, env: env, root: env.WorkingDirectory(), clients: map[string]*lspClient{}}
+}
+
+// clientFor returns the (started) server for path's extension.
+func (s *lspSet) clientFor(ctx context.Context, path string) (*lspClient, error) {
+	ext := strings.ToLower(filepath.Ext(path))
+	var cfg *LSPServerConfig
+	var names []string
+	for i := range s.cfgs {
+		names = append(names, s.cfgs[i].Name)
+		for _, e := range s.cfgs[i].Extensions {
+			if strings.EqualFold(e, ext) && cfg == nil {
+				cfg = &s.cfgs[i]
+			}
+		}
+	}
+	if cfg == nil {
+		return nil, fmt.Errorf("no language server configured for %q files (configured: %s)", ext, strings.Join(names, ", "))
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil, fmt.Errorf("session is closed")
+	}
+	if c := s.clients[cfg.Name]; c != nil && !c.exited() {
+		return c, nil
+	}
+	c, err := startLSPClient(ctx, *cfg, s.root, commandEnv(s.env, cfg.Env))
+	if err != nil {
+		return nil, fmt.Errorf("language server %s: %w", cfg.Name, err)
+	}
+	s.clients[cfg.Name] = c
+	return c, nil
+}
+
+func (s *lspSet) close() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.closed = true
+	clients := s.clients
+	s.clients = map[string]*lspClient{}
+	s.mu.Unlock()
+	for _, c := range clients {
+		c.close()
+	}
+}
+
+type lspDiagnostic struct {
+	Range    lspRange `json:"range"`
+	Severity int      `json:"severity"`
+	Source   string   `json:"source"`
+	Message  string   `json:"message"`
+}
+
+type lspPosition struct {
+	Line      int `json:"line"`
+	Character int `json:"character"`
+}
+
+type lspRange struct {
+	Start lspPosition `json:"start"`
+	End   lspPosition `json:"end"`
+}
+
+type lspLocation struct {
+	URI   string   `json:"uri"`
+	Range lspRange `json:"range"`
+}
+
+type lspClient struct {
+	cfg     LSPServerConfig
+	root    string
+	cmd     *exec.Cmd
+	stdin   io.WriteCloser
+	stderr  *tailBuffer
+	writeMu sync.Mutex
+
+	mu           sync.Mutex
+	nextID       int64
+	pending      map[int64]chan *mcpMessage
+	opened       map[string]lspOpenDoc
+	diags        map[string][]lspDiagnostic
+	diagsChanged chan struct{} // closed and replaced on every publishDiagnostics
+	pullDiags    bool
+	done         chan struct{}
+	readErr      error
+}
+
+type lspOpenDoc struct {
+	version int
+	text    string
+}
+
+// startLSPClient starts cfg's server in root with environ, which comes from
+// the session's execution environment so its env policy applies.
+func startLSPClient(ctx context.Context, cfg LSPServerConfig, root string, environ []string) (*lspClient, error) {
+	if len(cfg.Command) == 0 {
+		return nil, fmt.Errorf("command is required")
+	}
+	if cfg.StartupTimeout <= 0 {
+		cfg.StartupTimeout = lspDefaultStartupTimeout
+	}
+	if cfg.RequestTimeout <= 0 {
+		cfg.RequestTimeout = lspDefaultRequestTimeout
+	}
+	cmd := exec.Command(cfg.Command[0], cfg.Command[1:]...)
+	cmd.Dir = root
+	cmd.Env = environ
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	c := &lspClient{
+		cfg:          cfg,
+		root:         root,
+		cmd:          cmd,
+		stdin:        stdin,
+		stderr:       &tailBuffer{max: 4096},
+		pending:      map[int64]chan *mcpMessage{},
+		opened:       map[string]lspOpenDoc{},
+		diags:        map[string][]lspDiagnostic{},
+		diagsChanged: make(chan struct{}),
+		done:         make(chan struct{}),
+	}
+	cmd.Stderr = c.stderr
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("start %s: %w", cfg.Command[0], err)
+	}
+	go c.readLoop(stdout)
+
+	startCtx, cancel := context.WithTimeout(ctx, cfg.StartupTimeout)
+	defer cancel()
+	rootURI := pathToURI(root)
+	var res struct {
+		Capabilities struct {
+			DiagnosticProvider json.RawMessage `json:"diagnosticProvider"`
+		} `json:"capabilities"`
+	}
+	if err := c.request(startCtx, "initialize", map[string]any{
+		"processId":        os.Getpid(),
+		"clientInfo":       map[string]any{"name": "kilroy", "version": "1"},
+		"rootUri":          rootURI,
+		"workspaceFolders": []any{map[string]any{"uri": rootURI, "name": filepath.Base(root)}},
+		"capabilities": map[string]any{
+			"textDocument": map[string]any{
+				"synchronization":    map[string]any{"didSave": false},
+				"definition":         map[string]any{"linkSupport": true},
+				"references":         map[string]any{},
+				"documentSymbol":     map[string]any{"hierarchicalDocumentSymbolSupport": true},
+				"publishDiagnostics": map[string]any{},
+				"diagnostic":         map[string]any{},
+			},
+			"workspace": map[string]any{"workspaceFolders": true, "configuration": true},
+		},
+	}, &res); err != nil {
+		c.close()
+		return nil, err
+	}
+	d := strings.TrimSpace(string(res.Capabilities.DiagnosticProvider))
+	c.pullDiags = d != "" && d != "null" && d != "false"
+	if err := c.notify("initialized", map[string]any{}); err != nil {
+		c.close()
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *lspClient) readLoop(r io.Reader) {
+	tp := textproto.NewReader(bufio.NewReaderSize(r, 64*1024))
+	var err error
+	for {
+		var hdr textproto.MIMEHeader
+		hdr, err = tp.ReadMIMEHeader()
+		if err != nil {
+			break
+		}
+		n, cerr := strconv.Atoi(hdr.Get("Content-Length"))
+		if cerr != nil || n < 0 {
+			err = fmt.Errorf("bad Content-Length %q", hdr.Get("Content-Length"))
+			break
+		}
+		body := make([]byte, n)
+		if _, err = io.ReadFull(tp.R, body); err != nil {
+			break
+		}
+		var msg struct {
+			mcpMessage
+			Params json.RawMessage `json:"params,omitempty"`
+		}
+		if json.Unmarshal(body, &msg) != nil {
+			continue
+		}
+		switch {
+		case msg.isResponse():
+			id, _ := strconv.ParseInt(string(msg.ID), 10, 64)
+			c.mu.Lock()
+			ch := c.pending[id]
+			delete(c.pending, id)
+			c.mu.Unlock()
+			if ch != nil {
+				resp := msg.mcpMessage
+				ch <- &resp
+			}
+		case len(msg.ID) > 0:
+			c.answerServerRequest(msg.ID, msg.Method, msg.Params)
+		case msg.Method == "textDocument/publishDiagnostics":
+			var p struct {
+				URI         string          `json:"uri"`
+				Diagnostics []lspDiagnostic `json:"diagnostics"`
+			}
+			if json.Unmarshal(msg.Params, &p) == nil {
+				c.mu.Lock()
+				c.diags[p.URI] = p.Diagnostics
+				close(c.diagsChanged)
+				c.diagsChanged = make(chan struct{})
+				c.mu.Unlock()
+			}
+		}
+	}
+	_, _ = io.Copy(io.Discard, r)
+	if waitErr := c.cmd.Wait(); err == nil || err == io.EOF {
+		if waitErr != nil {
+			err = waitErr
+		}
+	}
+	c.mu.Lock()
+	c.readErr = err
+	c.mu.Unlock()
+	close(c.done)
+}
+
+// answerServerRequest replies to server-initiated requests. Kilroy has no
+// settings to offer, so configuration requests get nulls and everything else
+// (capability registration, progress tokens...) is simply acknowledged.
+func (c *lspClient) answerServerRequest(id json.RawMessage, method string, params json.RawMessage) {
+	var result any
+	switch method {
+	case "workspace/configuration":
+		var p struct {
+			Items []any `json:"items"`
+		}
+		_ = json.Unmarshal(params, &p)
+		result = make([]any, len(p.Items))
+	case "workspace/workspaceFolders":
+		result = []any{map[string]any{"uri": pathToURI(c.root), "name": filepath.Base(c.root)}}
+	}
+	_ = c.write(map[string]any{"jsonrpc": "2.0", "id": id, "result": result})
+}
+
+func (c *lspClient) write(msg any) error {
+	b, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if _, err := fmt.Fprintf(c.stdin, "Content-Length: %d\r\n\r\n", len(b)); err != nil {
+		return err
+	}
+	_, err = c.stdin.Write(b)
+	return err
+}
+
+func (c *lspClient) notify(method string, params any) error {
+	return c.write(map[string]any{"jsonrpc": "2.0", "method": method, "params": params})
+}
+
+func (c *lspClient) request(ctx context.Context, method string, params any, out any) error {
+	ch := make(chan *mcpMessage, 1)
+	c.mu.Lock()
+	c.nextID++
+	id := c.nextID
+	c.pending[id] = ch
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		delete(c.pending, id)
+		c.mu.Unlock()
+	}()
+	if err := c.write(map[string]any{"jsonrpc": "2.0", "id": id, "method": method, "params": params}); err != nil {
+		return c.exitError(err)
+	}
+	select {
+	case resp := <-ch:
+		if resp.Error != nil {
+			return fmt.Errorf("%s: lsp error %d: %s", method, resp.Error.Code, resp.Error.Message)
+		}
+		if out != nil && len(resp.Result) > 0 {
+			if err := json.Unmarshal(resp.Result, out); err != nil {
+				return fmt.Errorf("%s: decode result: %w", method, err)
+			}
+		}
+		return nil
+	case <-c.done:
+		return c.exitError(nil)
+	case <-ctx.Done():
+		return fmt.Errorf("%s: %w", method, ctx.Err())
+	}
+}
+
+func (c *lspClient) exited() bool {
+	select {
+	case <-c.done:
+		return true
+	default:
+		return false
+	}
+}
+
+func (c *lspClient) exitError(err error) error {
+	select {
+	case <-c.done:
+		c.mu.Lock()
+		err = c.readErr
+		c.mu.Unlock()
+	case <-time.After(time.Second):
+	}
+	if tail := strings.TrimSpace(c.stderr.String()); tail != "" {
+		return fmt.Errorf("language server exited (%v); stderr: %s", err, tail)
+	}
+	return fmt.Errorf("language server exited: %v", err)
+}
+
+// close performs the shutdown/exit handshake, then kills the server if it
+// lingers.
+func (c *lspClient) close() {
+	if !c.exited() {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		if c.request(ctx, "shutdown", nil, nil) == nil {
+			_ = c.notify("exit", nil)
+		}
+		cancel()
+	}
+	_ = c.stdin.Close()
+	select {
+	case <-c.done:
+	case <-time.After(2 * time.Second):
+		_ = c.cmd.Process.Kill()
+		<-c.done
+	}
+}
+
+// sync opens path in the server, or sends its current content if the file
+// changed since it was last sent, and returns the document URI and text.
+func (c *lspClient) sync(path string) (string, string, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return "", "", err
+	}
+	text := string(b)
+	uri := pathToURI(path)
+	c.mu.Lock()
+	doc, ok := c.opened[uri]
+	if ok && doc.text == text {
+		c.mu.Unlock()
+		return uri, text, nil
+	}
+	doc = lspOpenDoc{version: doc.version + 1, text: text}
+	c.opened[uri] = doc
+	c.mu.Unlock()
+	if !ok {
+		err = c.notify("textDocument/didOpen", map[string]any{"textDocument": map[string]any{
+			"uri": uri, "languageId": c.languageID(path), "version": doc.version, "text": text,
+		}})
+	} else {
+		err = c.notify("textDocument/didChange", map[string]any{
+			"textDocument":   map[string]any{"uri": uri, "version": doc.version},
+			"contentChanges": []any{map[string]any{"text": text}},
+		})
+	}
+	return uri, text, err
+}
+
+func (c *lspClient) languageID(path string) string {
+	if c.cfg.LanguageID != "" {
+		return c.cfg.LanguageID
+	}
+	switch ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(path), ".")); ext {
+	case "go":
+		return "go"
+	case "rs":
+		return "rust"
+	case "py", "pyi":
+		return "python"
+	case "ts", "mts", "cts":
+		return "typescript"
+	case "tsx":
+		return "typescriptreact"
+	case "js", "mjs", "cjs":
+		return "javascript"
+	case "jsx":
+		return "javascriptreact"
+	default:
+		return ext
+	}
+}
+
+// diagnostics returns the current diagnostics for a synced document, pulling
+// them when the server supports it and otherwise waiting briefly for the
+// server to publish them.
+func (c *lspClient) diagnostics(ctx context.Context, uri string, changed bool) ([]lspDiagnostic, error) {
+	if c.pullDiags {
+		var rep struct {
+			Kind  string          `json:"kind"`
+			Items []lspDiagnostic `json:"items"`
+		}
+		if err := c.request(ctx, "textDocument/diagnostic", map[string]any{"textDocument": map[string]any{"uri": uri}}, &rep); err == nil {
+			return rep.Items, nil
+		}
+	}
+	deadline := time.After(lspDiagnosticsWait)
+	for {
+		c.mu.Lock()
+		d, ok := c.diags[uri]
+		wait := c.diagsChanged
+		c.mu.Unlock()
+		if ok && !changed {
+			return d, nil
+		}
+		select {
+		case <-wait:
+			changed = false
+		case <-deadline:
+			return d, nil
+		case <-c.done:
+			return nil, c.exitError(nil)
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+func pathToURI(p string) string {
+	return (&url.URL{Scheme: "file", Path: filepath.ToSlash(p)}).String()
+}
+
+func uriToPath(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme != "file" {
+		return uri
+	}
+	return filepath.FromSlash(u.Path)
+}
+
+// utf16Offset converts a byte offset within line to LSP's UTF-16 code units.
+func utf16Offset(line string, byteOff int) int {
+	if byteOff > len(line) {
+		byteOff = len(line)
+	}
+	n := 0
+	for _, r := range line[:byteOff] {
+		n += len(utf16.Encode([]rune{r}))
+	}
+	return n
+}
+
+// runeColumn converts an LSP UTF-16 character offset within line to a
+// 1-based character column.
+func runeColumn(line string, utf16Off int) int {
+	col, units := 1, 0
+	for _, r := range line {
+		if units >= utf16Off {
+			break
+		}
+		units += len(utf16.Encode([]rune{r}))
+		col++
+	}
+	return col
+}
+
+// runeByteOffset converts a 1-based character column to a byte offset.
+func runeByteOffset(line string, col int) int {
+	off := 0
+	for i := 1; i < col && off < len(line); i++ {
+		_, size := utf8.DecodeRuneInString(line[off:])
+		off += size
+	}
+	return off
+}
@@ -0,0 +1,239 @@
+package agent
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/danshapiro/kilroy/internal/llm"
+)
+
+// TestLSPHelperServer is not a real test: it is re-executed as a stdio
+// language server by the tests below.
+func TestLSPHelperServer(t *testing.T) {
+	if os.Getenv("KILROY_TEST_LSP_SERVER") != "1" {
+		t.Skip("helper process")
+	}
+	tp := textproto.NewReader(bufio.NewReader(os.Stdin))
+	send := func(v map[string]any) {
+		v["jsonrpc"] = "2.0"
+		b, _ := json.Marshal(v)
+		fmt.Printf("Content-Length: %d\r\n\r\n%s", len(b), b)
+	}
+	for {
+		hdr, err := tp.ReadMIMEHeader()
+		if err != nil {
+			os.Exit(0)
+		}
+		n, _ := strconv.Atoi(hdr.Get("Content-Length"))
+		body := make([]byte, n)
+		if _, err := io.ReadFull(tp.R, body); err != nil {
+			os.Exit(0)
+		}
+		var req struct {
+			ID     json.RawMessage `json:"id"`
+			Method string          `json:"method"`
+			Params struct {
+				TextDocument struct {
+					URI  string `json:"uri"`
+					Text string `json:"text"`
+				} `json:"textDocument"`
+				ContentChanges []struct {
+					Text string `json:"text"`
+				} `json:"contentChanges"`
+				Position lspPosition `json:"position"`
+			} `json:"params"`
+		}
+		if json.Unmarshal(body, &req) != nil {
+			continue
+		}
+		uri := req.Params.TextDocument.URI
+		var result any
+		switch req.Method {
+		case "initialize":
+			send(map[string]any{"id": "srv-1", "method": "workspace/configuration", "params": map[string]any{"items": []any{map[string]any{}}}})
+			result = map[string]any{"capabilities": map[string]any{"definitionProvider": true}}
+		case "textDocument/didOpen", "textDocument/didChange":
+			text := req.Params.TextDocument.Text
+			if len(req.Params.ContentChanges) > 0 {
+				text = req.Params.ContentChanges[0].Text
+			}
+			diags := []any{}
+			if strings.Contains(text, "return bar") {
+				diags = append(diags, map[string]any{
+					"range":    lspRange{Start: lspPosition{Line: 2, Character: 24}, End: lspPosition{Line: 2, Character: 27}},
+					"severity": 1, "source": "compiler", "message": "undefined: bar",
+				})
+			}
+			send(map[string]any{"method": "textDocument/publishDiagnostics", "params": map[string]any{"uri": uri, "diagnostics": diags}})
+			continue
+		case "textDocument/definition":
+			result = []any{map[string]any{"targetUri": uri,
+				"targetRange":          lspRange{Start: lspPosition{Line: 3}, End: lspPosition{Line: 3, Character: 20}},
+				"targetSelectionRange": lspRange{Start: lspPosition{Line: 3, Character: 4}, End: lspPosition{Line: 3, Character: 7}}}}
+		case "textDocument/references":
+			// Echo the queried position back so the test can check it.
+			result = []any{
+				lspLocation{URI: uri, Range: lspRange{Start: req.Params.Position}},
+				lspLocation{URI: uri, Range: lspRange{Start: lspPosition{Line: 3, Character: 4}}},
+			}
+		case "textDocument/documentSymbol":
+			result = []any{map[string]any{"name": "Foo", "kind": 12, "detail": "func() int",
+				"range": lspRange{}, "selectionRange": lspRange{Start: lspPosition{Line: 2, Character: 5}},
+				"children": []any{map[string]any{"name": "x", "kind": 13, "range": lspRange{}, "selectionRange": lspRange{Start: lspPosition{Line: 2}}}}}}
+		case "shutdown":
+		case "exit":
+			os.Exit(0)
+		}
+		if len(req.ID) > 0 && req.Method != "" {
+			send(map[string]any{"id": req.ID, "result": result})
+		}
+	}
+}
+
+func TestSession_LSPTools_DefinitionReferencesSymbolsDiagnostics(t *testing.T) {
+	dir := t.TempDir()
+	src := "package main\n\nfunc Foo() int { return bar }\nvar bar = 1\n"
+	if err := os.WriteFile(filepath.Join(dir, "main.go"), []byte(src), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	c := llm.NewClient()
+	c.Register(&fakeAdapter{name: "openai"})
+	sess, err := NewSession(c, NewOpenAIProfile("gpt-5.4"), NewLocalExecutionEnvironment(dir), SessionConfig{
+		LSPServers: []LSPServerConfig{{
+			Name:       "fake",
+			Command:    []string{os.Args[0], "-test.run=^TestLSPHelperServer$"},
+			Env:        map[string]string{"KILROY_TEST_LSP_SERVER": "1"},
+			Extensions: []string{".go"},
+		}},
+	})
+	if err != nil {
+		t.Fatalf("NewSession: %v", err)
+	}
+	defer sess.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+	call := func(name string, args map[string]any) ToolExecResult {
+		t.Helper()
+		b, _ := json.Marshal(args)
+		return sess.reg.ExecuteCall(ctx, sess.env, llm.ToolCallData{ID: name, Name: name, Arguments: b})
+	}
+
+	if res := call("find_definition", map[string]any{"file_path": "main.go", "line": 3, "symbol": "bar"}); res.IsError || strings.TrimSpace(res.Output) != "main.go:4:5: var bar = 1" {
+		t.Fatalf("find_definition: %+v", res)
+	}
+	res := call("find_references", map[string]any{"file_path": "main.go", "line": 3, "symbol": "bar"})
+	if res.IsError || !strings.HasPrefix(res.Output, "main.go:3:25: func Foo()") || !strings.Contains(res.Output, "main.go:4:5:") {
+		t.Fatalf("find_references: %+v", res)
+	}
+	if res := call("find_references", map[string]any{"file_path": "main.go", "line": 3, "symbol": "nope"}); !res.IsError || !strings.Contains(res.Output, "not found on line 3") {
+		t.Fatalf("unknown symbol: %+v", res)
+	}
+	if res := call("document_symbols", map[string]any{"file_path": "main.go"}); res.IsError || res.Output != "function Foo func() int (line 3)\n  variable x (line 3)\n" {
+		t.Fatalf("document_symbols: %q", res.Output)
+	}
+	if res := call("diagnostics", map[string]any{"file_paths": []string{"main.go", "notes.txt"}}); res.IsError ||
+		!strings.Contains(res.Output, "main.go:3:25: error: undefined: bar (compiler)") || !strings.Contains(res.Output, `notes.txt: [ERROR] no language server configured for ".txt"`) {
+		t.Fatalf("diagnostics: %+v", res)
+	}
+	_ = os.WriteFile(filepath.Join(dir, "main.go"), []byte(strings.Replace(src, "return bar", "return 1", 1)), 0o644)
+	if res := call("diagnostics", map[string]any{"file_paths": []string{"main.go"}}); res.IsError || strings.TrimSpace(res.Output) != "main.go: no diagnostics" {
+		t.Fatalf("diagnostics after edit should reflect the new content: %+v", res)
+	}
+
+	proc := sess.lsp.clients["fake"].cmd
+	sess.Close()
+	if proc.ProcessState == nil {
+		t.Fatalf("language server still running after Close")
+	}
+}
+
+func TestLSPSet_ServerEnvFollowsExecutionEnvironmentPolicy(t *testing.T) {
+	t.Setenv("KILROY_TEST_LSP_STRIPPED", "1")
+	dir := t.TempDir()
+	_ = os.WriteFile(filepath.Join(dir, "main.go"), []byte("package main\n"), 0o644)
+	env := NewLocalExecutionEnvironmentWithPolicy(dir, map[string]string{"KILROY_TEST_LSP_BASE": "base"}, []string{"KILROY_TEST_LSP_STRIPPED"})
+	set := newLSPSet([]LSPServerConfig{{
+		Name:       "fake",
+		Command:    []string{os.Args[0], "-test.run=^TestLSPHelperServer$"},
+		Env:        map[string]string{"KILROY_TEST_LSP_SERVER": "1", "LSP_API_KEY": "declared"},
+		Extensions: []string{".go"},
+	}}, env)
+	defer set.close()
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+	c, err := set.clientFor(ctx, filepath.Join(dir, "main.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := strings.Join(c.cmd.Env, "\n")
+	for _, want := range []string{"KILROY_TEST_LSP_BASE=base", "KILROY_TEST_LSP_SERVER=1", "LSP_API_KEY=declared"} {
+		if !strings.Contains(got, want) {
+			t.Fatalf("server env missing %s", want)
+		}
+	}
+	if strings.Contains(got, "KILROY_TEST_LSP_STRIPPED") {
+		t.Fatal("stripped key reached the language server")
+	}
+}
+
+func TestSession_SharedSubagentUsesParentLanguageServers(t *testing.T) {
+	dir := t.TempDir()
+	_ = os.WriteFile(filepath.Join(dir, "main.go"), []byte("package main\n\nfunc Foo() int { return 1 }\n"), 0o644)
+	c := llm.NewClient()
+	c.Register(&fakeAdapter{name: "openai"})
+	sess, err := NewSession(c, NewOpenAIProfile("gpt-5.4"), NewLocalExecutionEnvironment(dir), SessionConfig{
+		LSPServers: []LSPServerConfig{{
+			Name:       "fake",
+			Command:    []string{os.Args[0], "-test.run=^TestLSPHelperServer$"},
+			Env:        map[string]string{"KILROY_TEST_LSP_SERVER": "1"},
+			Extensions: []string{".go"},
+		}},
+	})
+	if err != nil {
+		t.Fatalf("NewSession: %v", err)
+	}
+	defer sess.Close()
+	out, err := sess.spawnAgent(context.Background(), "x", spawnOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var spawned map[string]any
+	_ = json.Unmarshal([]byte(fmt.Sprint(out)), &spawned)
+	sub := sess.getSub(fmt.Sprint(spawned["agent_id"])).sess
+	if sub.lsp != nil || sub.sharedLSP != sess.lsp || len(sub.cfg.LSPServers) != 0 {
+		t.Fatalf("subagent should share the parent's language servers: lsp=%p shared=%p parent=%p", sub.lsp, sub.sharedLSP, sess.lsp)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+	b, _ := json.Marshal(map[string]any{"file_path": "main.go"})
+	if res := sub.reg.ExecuteCall(ctx, sub.env, llm.ToolCallData{ID: "1", Name: "document_symbols", Arguments: b}); res.IsError {
+		t.Fatalf("document_symbols from the subagent: %+v", res)
+	}
+	if len(sess.lsp.clients) != 1 {
+		t.Fatalf("parent set should own the started server: %v", sess.lsp.clients)
+	}
+}
+
+func TestLSPPositionConversions_UTF16(t *testing.T) {
+	line := "x := \"é😀\" + y"
+	off := strings.Index(line, "y")
+	if got := utf16Offset(line, off); got != 13 {
+		t.Fatalf("utf16Offset = %d, want 13", got)
+	}
+	if got := runeColumn(line, 13); got != 13 {
+		t.Fatalf("runeColumn = %d, want 13", got)
+	}
+	if got := runeByteOffset(line, 13); got != off {
+		t.Fatalf("runeByteOffset = %d, want %d", got, off)
+	}
+}
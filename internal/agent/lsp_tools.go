@@ -0,0 +1,314 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/danshapiro/kilroy/internal/llm"
+)
+
+// registerLSPTools registers the code-intelligence tools backed by the
+// session's language servers and returns their definitions.
+func registerLSPTools(reg *ToolRegistry, set *lspSet) ([]llm.ToolDefinition, error) {
+	tools := []RegisteredTool{
+		{
+			Definition: defFindDefinition(),
+			Exec: func(ctx context.Context, env ExecutionEnvironment, args map[string]any) (any, error) {
+				return lspLocationsQuery(ctx, env, set, args, "textDocument/definition", nil, 0)
+			},
+		},
+		{
+			Definition: defFindReferences(),
+			Exec: func(ctx context.Context, env ExecutionEnvironment, args map[string]any) (any, error) {
+				includeDecl := true
+				if v, ok := args["include_declaration"].(bool); ok {
+					includeDecl = v
+				}
+				max := 100
+				if v, ok := args["max_results"].(float64); ok && v > 0 {
+					max = int(v)
+				}
+				return lspLocationsQuery(ctx, env, set, args, "textDocument/references",
+					map[string]any{"context": map[string]any{"includeDeclaration": includeDecl}}, max)
+			},
+		},
+		{
+			Definition: defDocumentSymbols(),
+			Exec: func(ctx context.Context, env ExecutionEnvironment, args map[string]any) (any, error) {
+				return lspDocumentSymbols(ctx, env, set, argStr(args, "file_path"))
+			},
+		},
+		{
+			Definition: defDiagnostics(),
+			Exec: func(ctx context.Context, env ExecutionEnvironment, args map[string]any) (any, error) {
+				return lspDiagnostics(ctx, env, set, argStrings(args, "file_paths"))
+			},
+		},
+	}
+	var defs []llm.ToolDefinition
+	for _, t := range tools {
+		if err := reg.Register(t); err != nil {
+			return nil, err
+		}
+		defs = append(defs, t.Definition)
+	}
+	return defs, nil
+}
+
+func lspAbsPath(env ExecutionEnvironment, p string) string {
+	p = strings.TrimSpace(p)
+	if filepath.IsAbs(p) {
+		return filepath.Clean(p)
+	}
+	return filepath.Join(env.WorkingDirectory(), p)
+}
+
+// lspDisplayPath shows paths inside the working directory relative to it.
+func lspDisplayPath(env ExecutionEnvironment, p string) string {
+	if rel, err := filepath.Rel(env.WorkingDirectory(), p); err == nil && !strings.HasPrefix(rel, "..") {
+		return rel
+	}
+	return p
+}
+
+// lspRequestContext applies the server's per-request timeout.
+func lspRequestContext(ctx context.Context, c *lspClient) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, c.cfg.RequestTimeout)
+}
+
+// lspPositionFromArgs resolves file_path/line/symbol|column to an LSP
+// position in a synced document.
+func lspPositionFromArgs(ctx context.Context, env ExecutionEnvironment, set *lspSet, args map[string]any) (*lspClient, string, lspPosition, error) {
+	path := lspAbsPath(env, argStr(args, "file_path"))
+	c, err := set.clientFor(ctx, path)
+	if err != nil {
+		return nil, "", lspPosition{}, err
+	}
+	uri, text, err := c.sync(path)
+	if err != nil {
+		return nil, "", lspPosition{}, err
+	}
+	lines := strings.Split(text, "\n")
+	lineNo := 0
+	if v, ok := args["line"].(float64); ok {
+		lineNo = int(v)
+	}
+	if lineNo < 1 || lineNo > len(lines) {
+		return nil, "", lspPosition{}, fmt.Errorf("line %d is out of range (file has %d lines)", lineNo, len(lines))
+	}
+	line := strings.TrimSuffix(lines[lineNo-1], "\r")
+	var off int
+	if sym := argStr(args, "symbol"); sym != "" {
+		off = strings.Index(line, sym)
+		if off < 0 {
+			return nil, "", lspPosition{}, fmt.Errorf("symbol %q not found on line %d: %s", sym, lineNo, strings.TrimSpace(line))
+		}
+	} else if v, ok := args["column"].(float64); ok && v >= 1 {
+		off = runeByteOffset(line, int(v))
+	} else {
+		off = len(line) - len(strings.TrimLeft(line, " \t"))
+	}
+	return c, uri, lspPosition{Line: lineNo - 1, Character: utf16Offset(line, off)}, nil
+}
+
+func lspLocationsQuery(ctx context.Context, env ExecutionEnvironment, set *lspSet, args map[string]any, method string, extra map[string]any, max int) (string, error) {
+	c, uri, pos, err := lspPositionFromArgs(ctx, env, set, args)
+	if err != nil {
+		return "", err
+	}
+	params := map[string]any{"textDocument": map[string]any{"uri": uri}, "position": pos}
+	for k, v := range extra {
+		params[k] = v
+	}
+	rctx, cancel := lspRequestContext(ctx, c)
+	defer cancel()
+	var raw json.RawMessage
+	if err := c.request(rctx, method, params, &raw); err != nil {
+		return "", err
+	}
+	locs := decodeLSPLocations(raw)
+	if len(locs) == 0 {
+		return "no results", nil
+	}
+	sort.SliceStable(locs, func(i, j int) bool {
+		if locs[i].URI != locs[j].URI {
+			return locs[i].URI < locs[j].URI
+		}
+		return locs[i].Range.Start.Line < locs[j].Range.Start.Line
+	})
+	total := len(locs)
+	if max > 0 && total > max {
+		locs = locs[:max]
+	}
+	files := map[string][]string{}
+	var b strings.Builder
+	for _, l := range locs {
+		p := uriToPath(l.URI)
+		lines, ok := files[p]
+		if !ok {
+			data, _ := os.ReadFile(p)
+			lines = strings.Split(string(data), "\n")
+			files[p] = lines
+		}
+		src := ""
+		if l.Range.Start.Line < len(lines) {
+			src = strings.TrimSuffix(lines[l.Range.Start.Line], "\r")
+		}
+		fmt.Fprintf(&b, "%s:%d:%d: %s\n", lspDisplayPath(env, p), l.Range.Start.Line+1, runeColumn(src, l.Range.Start.Character), strings.TrimSpace(src))
+	}
+	if total > len(locs) {
+		fmt.Fprintf(&b, "... %d more (raise max_results to see them)\n", total-len(locs))
+	}
+	return b.String(), nil
+}
+
+// decodeLSPLocations accepts Location, Location[] and LocationLink[].
+func decodeLSPLocations(raw json.RawMessage) []lspLocation {
+	var items []struct {
+		lspLocation
+		TargetURI            string    `json:"targetUri"`
+		TargetSelectionRange *lspRange `json:"targetSelectionRange"`
+	}
+	if err := json.Unmarshal(raw, &items); err != nil {
+		var one lspLocation
+		if json.Unmarshal(raw, &one) != nil || one.URI == "" {
+			return nil
+		}
+		return []lspLocation{one}
+	}
+	var out []lspLocation
+	for _, it := range items {
+		switch {
+		case it.URI != "":
+			out = append(out, it.lspLocation)
+		case it.TargetURI != "" && it.TargetSelectionRange != nil:
+			out = append(out, lspLocation{URI: it.TargetURI, Range: *it.TargetSelectionRange})
+		}
+	}
+	return out
+}
+
+var lspSymbolKinds = []string{"", "file", "module", "namespace", "package", "class", "method", "property", "field",
+	"constructor", "enum", "interface", "function", "variable", "constant", "string", "number", "boolean", "array",
+	"object", "key", "null", "enum member", "struct", "event", "operator", "type parameter"}
+
+type lspDocumentSymbol struct {
+	Name           string              `json:"name"`
+	Detail         string              `json:"detail"`
+	Kind           int                 `json:"kind"`
+	SelectionRange *lspRange           `json:"selectionRange"`
+	Children       []lspDocumentSymbol `json:"children"`
+	// SymbolInformation (flat) results.
+	Location      *lspLocation `json:"location"`
+	ContainerName string       `json:"containerName"`
+}
+
+func lspDocumentSymbols(ctx context.Context, env ExecutionEnvironment, set *lspSet, file string) (string, error) {
+	path := lspAbsPath(env, file)
+	c, err := set.clientFor(ctx, path)
+	if err != nil {
+		return "", err
+	}
+	uri, _, err := c.sync(path)
+	if err != nil {
+		return "", err
+	}
+	rctx, cancel := lspRequestContext(ctx, c)
+	defer cancel()
+	var syms []lspDocumentSymbol
+	if err := c.request(rctx, "textDocument/documentSymbol", map[string]any{"textDocument": map[string]any{"uri": uri}}, &syms); err != nil {
+		return "", err
+	}
+	if len(syms) == 0 {
+		return "no symbols", nil
+	}
+	var b strings.Builder
+	var walk func(items []lspDocumentSymbol, depth int)
+	walk = func(items []lspDocumentSymbol, depth int) {
+		for _, s := range items {
+			kind := ""
+			if s.Kind > 0 && s.Kind < len(lspSymbolKinds) {
+				kind = lspSymbolKinds[s.Kind] + " "
+			}
+			line := 0
+			switch {
+			case s.SelectionRange != nil:
+				line = s.SelectionRange.Start.Line + 1
+			case s.Location != nil:
+				line = s.Location.Range.Start.Line + 1
+			}
+			name := s.Name
+			if s.ContainerName != "" {
+				name = s.ContainerName + "." + name
+			}
+			fmt.Fprintf(&b, "%s%s%s", strings.Repeat("  ", depth), kind, name)
+			if d := strings.TrimSpace(s.Detail); d != "" {
+				fmt.Fprintf(&b, " %s", d)
+			}
+			fmt.Fprintf(&b, " (line %d)\n", line)
+			walk(s.Children, depth+1)
+		}
+	}
+	walk(syms, 0)
+	return b.String(), nil
+}
+
+var lspSeverities = []string{"", "error", "warning", "info", "hint"}
+
+func lspDiagnostics(ctx context.Context, env ExecutionEnvironment, set *lspSet, files []string) (string, error) {
+	if len(files) == 0 {
+		return "", fmt.Errorf("file_paths is required")
+	}
+	var b strings.Builder
+	for _, file := range files {
+		path := lspAbsPath(env, file)
+		display := lspDisplayPath(env, path)
+		c, err := set.clientFor(ctx, path)
+		if err != nil {
+			fmt.Fprintf(&b, "%s: [ERROR] %v\n", display, err)
+			continue
+		}
+		c.mu.Lock()
+		prev, known := c.opened[pathToURI(path)]
+		c.mu.Unlock()
+		uri, text, err := c.sync(path)
+		if err != nil {
+			fmt.Fprintf(&b, "%s: [ERROR] %v\n", display, err)
+			continue
+		}
+		rctx, cancel := lspRequestContext(ctx, c)
+		diags, err := c.diagnostics(rctx, uri, !known || prev.text != text)
+		cancel()
+		if err != nil {
+			fmt.Fprintf(&b, "%s: [ERROR] %v\n", display, err)
+			continue
+		}
+		if len(diags) == 0 {
+			fmt.Fprintf(&b, "%s: no diagnostics\n", display)
+			continue
+		}
+		lines := strings.Split(text, "\n")
+		sort.SliceStable(diags, func(i, j int) bool { return diags[i].Range.Start.Line < diags[j].Range.Start.Line })
+		for _, d := range diags {
+			sev := "error"
+			if d.Severity > 0 && d.Severity < len(lspSeverities) {
+				sev = lspSeverities[d.Severity]
+			}
+			src := ""
+			if d.Range.Start.Line < len(lines) {
+				src = lines[d.Range.Start.Line]
+			}
+			msg := strings.ReplaceAll(strings.TrimSpace(d.Message), "\n", " ")
+			if d.Source != "" {
+				msg += " (" + d.Source + ")"
+			}
+			fmt.Fprintf(&b, "%s:%d:%d: %s: %s\n", display, d.Range.Start.Line+1, runeColumn(src, d.Range.Start.Character), sev, msg)
+		}
+	}
+	return b.String(), nil
+}
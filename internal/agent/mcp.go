@@ -0,0 +1,634 @@
+package agent
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os/exec"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/danshapiro/kilroy/internal/llm"
+)
+
+// MCPServerConfig declares a Model Context Protocol server whose tools are
+// exposed to the session as "mcp__<name>__<tool>". Exactly one of Command
+// (stdio transport) or URL (streamable HTTP transport) must be set.
+type MCPServerConfig struct {
+	Name string
+
+	Command []string
+	// Env is set on top of the execution environment's command environment,
+	// which withholds sensitive variables such as provider API keys.
+	Env map[string]string
+	// Dir defaults to the execution environment's working directory.
+	Dir string
+
+	URL     string
+	Headers map[string]string
+
+	// StartupTimeout bounds launch, initialize and tools/list (default 30s).
+	StartupTimeout time.Duration
+	// CallTimeout bounds a single tools/call (default 5m).
+	CallTimeout time.Duration
+}
+
+const (
+	mcpProtocolVersion       = "2025-06-18"
+	mcpDefaultStartupTimeout = 30 * time.Second
+	mcpDefaultCallTimeout    = 5 * time.Minute
+	mcpToolPrefix            = "mcp__"
+)
+
+type mcpTool struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description,omitempty"`
+	InputSchema map[string]any `json:"inputSchema,omitempty"`
+}
+
+type mcpRPCError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *mcpRPCError) Error() string { return fmt.Sprintf("mcp error %d: %s", e.Code, e.Message) }
+
+// mcpMessage is any JSON-RPC 2.0 message on the wire.
+type mcpMessage struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Params  any             `json:"params,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *mcpRPCError    `json:"error,omitempty"`
+}
+
+func (m *mcpMessage) isResponse() bool { return len(m.ID) > 0 && m.Method == "" }
+
+type mcpTransport interface {
+	// roundTrip sends a request and waits for the response with its ID.
+	roundTrip(ctx context.Context, msg mcpMessage) (*mcpMessage, error)
+	notify(ctx context.Context, msg mcpMessage) error
+	close() error
+}
+
+type mcpClient struct {
+	cfg    MCPServerConfig
+	t      mcpTransport
+	nextID atomic.Int64
+	tools  []mcpTool
+}
+
+// startMCPClient connects to cfg's server. A stdio server runs in workDir
+// (unless cfg.Dir is set) with environ as its environment.
+func startMCPClient(ctx context.Context, cfg MCPServerConfig, workDir string, environ []string) (*mcpClient, error) {
+	if cfg.StartupTimeout <= 0 {
+		cfg.StartupTimeout = mcpDefaultStartupTimeout
+	}
+	if cfg.CallTimeout <= 0 {
+		cfg.CallTimeout = mcpDefaultCallTimeout
+	}
+	var (
+		t   mcpTransport
+		err error
+	)
+	switch {
+	case len(cfg.Command) > 0 && strings.TrimSpace(cfg.URL) == "":
+		dir := firstNonEmptyString(cfg.Dir, workDir)
+		t, err = startMCPStdio(cfg.Command, environ, dir)
+	case len(cfg.Command) == 0 && strings.TrimSpace(cfg.URL) != "":
+		t = newMCPHTTP(cfg.URL, cfg.Headers)
+	default:
+		err = fmt.Errorf("exactly one of command or url is required")
+	}
+	if err != nil {
+		return nil, err
+	}
+	c := &mcpClient{cfg: cfg, t: t}
+
+	startCtx, cancel := context.WithTimeout(ctx, cfg.StartupTimeout)
+	defer cancel()
+	if err := c.initialize(startCtx); err != nil {
+		_ = t.close()
+		return nil, err
+	}
+	tools, err := c.listTools(startCtx)
+	if err != nil {
+		_ = t.close()
+		return nil, err
+	}
+	c.tools = tools
+	return c, nil
+}
+
+func (c *mcpClient) call(ctx context.Context, method string, params any, out any) error {
+	id, _ := json.Marshal(c.nextID.Add(1))
+	resp, err := c.t.roundTrip(ctx, mcpMessage{JSONRPC: "2.0", ID: id, Method: method, Params: params})
+	if err != nil {
+		return fmt.Errorf("%s: %w", method, err)
+	}
+	if resp.Error != nil {
+		return fmt.Errorf("%s: %w", method, resp.Error)
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.Unmarshal(resp.Result, out); err != nil {
+		return fmt.Errorf("%s: decode result: %w", method, err)
+	}
+	return nil
+}
+
+func (c *mcpClient) initialize(ctx context.Context) error {
+	var res struct {
+		ProtocolVersion string `json:"protocolVersion"`
+	}
+	if err := c.call(ctx, "initialize", map[string]any{
+		"protocolVersion": mcpProtocolVersion,
+		"capabilities":    map[string]any{},
+		"clientInfo":      map[string]any{"name": "kilroy", "version": "1"},
+	}, &res); err != nil {
+		return err
+	}
+	if h, ok := c.t.(*mcpHTTPTransport); ok {
+		h.setProtocolVersion(firstNonEmptyString(res.ProtocolVersion, mcpProtocolVersion))
+	}
+	return c.t.notify(ctx, mcpMessage{JSONRPC: "2.0", Method: "notifications/initialized"})
+}
+
+func (c *mcpClient) listTools(ctx context.Context) ([]mcpTool, error) {
+	var tools []mcpTool
+	cursor := ""
+	for {
+		params := map[string]any{}
+		if cursor != "" {
+			params["cursor"] = cursor
+		}
+		var page struct {
+			Tools      []mcpTool `json:"tools"`
+			NextCursor string    `json:"nextCursor"`
+		}
+		if err := c.call(ctx, "tools/list", params, &page); err != nil {
+			return nil, err
+		}
+		tools = append(tools, page.Tools...)
+		if page.NextCursor == "" || page.NextCursor == cursor {
+			return tools, nil
+		}
+		cursor = page.NextCursor
+	}
+}
+
+// callTool forwards a tool call and converts the MCP content blocks into a
+// tool result. The first image block is attached as image data; other
+// non-text blocks are summarized in the text.
+func (c *mcpClient) callTool(ctx context.Context, name string, args map[string]any) (any, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.cfg.CallTimeout)
+	defer cancel()
+	var res struct {
+		Content []struct {
+			Type     string `json:"type"`
+			Text     string `json:"text"`
+			Data     string `json:"data"`
+			MimeType string `json:"mimeType"`
+			URI      string `json:"uri"`
+			Resource *struct {
+				URI      string `json:"uri"`
+				MimeType string `json:"mimeType"`
+				Text     string `json:"text"`
+				Blob     string `json:"blob"`
+			} `json:"resource"`
+		} `json:"content"`
+		StructuredContent any  `json:"structuredContent"`
+		IsError           bool `json:"isError"`
+	}
+	if err := c.call(ctx, "tools/call", map[string]any{"name": name, "arguments": args}, &res); err != nil {
+		return nil, err
+	}
+
+	var out ToolImageOutput
+	var parts []string
+	for _, block := range res.Content {
+		switch block.Type {
+		case "text":
+			parts = append(parts, block.Text)
+		case "image":
+			data, err := base64.StdEncoding.DecodeString(block.Data)
+			if err != nil || out.ImageData != nil {
+				parts = append(parts, fmt.Sprintf("[image omitted: %s]", block.MimeType))
+				continue
+			}
+			out.ImageData, out.ImageMediaType = data, block.MimeType
+			parts = append(parts, fmt.Sprintf("[image: %s, %d bytes]", block.MimeType, len(data)))
+		case "resource":
+			if r := block.Resource; r != nil {
+				if r.Text != "" {
+					parts = append(parts, fmt.Sprintf("[resource %s]\n%s", r.URI, r.Text))
+				} else {
+					parts = append(parts, fmt.Sprintf("[binary resource %s (%s)]", r.URI, r.MimeType))
+				}
+			}
+		case "resource_link":
+			parts = append(parts, fmt.Sprintf("[resource link: %s]", block.URI))
+		default:
+			parts = append(parts, fmt.Sprintf("[%s content omitted]", block.Type))
+		}
+	}
+	if len(parts) == 0 && res.StructuredContent != nil {
+		b, _ := json.Marshal(res.StructuredContent)
+		parts = append(parts, string(b))
+	}
+	out.Text = strings.Join(parts, "\n")
+
+	var v any = out.Text
+	if out.ImageData != nil {
+		v = out
+	}
+	if res.IsError {
+		return v, errors.New(firstNonEmptyString(out.Text, "tool reported an error"))
+	}
+	return v, nil
+}
+
+func (c *mcpClient) close() error { return c.t.close() }
+
+// registerMCPTools exposes every tool of every client in reg and returns
+// their definitions (profiles only advertise their built-in tools).
+func registerMCPTools(reg *ToolRegistry, clients []*mcpClient) ([]llm.ToolDefinition, error) {
+	var defs []llm.ToolDefinition
+	for _, c := range clients {
+		for _, tool := range c.tools {
+			c, tool := c, tool
+			name := mcpToolName(c.cfg.Name, tool.Name)
+			params := tool.InputSchema
+			if params == nil {
+				params = map[string]any{"type": "object", "properties": map[string]any{}}
+			}
+			rt := RegisteredTool{
+				Definition: llm.ToolDefinition{
+					Name:        name,
+					Description: strings.TrimSpace(fmt.Sprintf("[MCP server %s] %s", c.cfg.Name, tool.Description)),
+					Parameters:  params,
+				},
+				Exec: func(ctx context.Context, _ ExecutionEnvironment, args map[string]any) (any, error) {
+					return c.callTool(ctx, tool.Name, args)
+				},
+			}
+			if err := reg.Register(rt); err != nil {
+				// Server schemas are advisory; fall back to accepting any object
+				// rather than failing the whole session.
+				rt.Schema, _ = compileSchema(nil)
+				if err := reg.Register(rt); err != nil {
+					return nil, fmt.Errorf("mcp server %s tool %s: %w", c.cfg.Name, tool.Name, err)
+				}
+			}
+			defs = append(defs, rt.Definition)
+		}
+	}
+	return defs, nil
+}
+
+// mcpToolName namespaces a server tool into a valid, unique LLM tool name.
+func mcpToolName(server, tool string) string {
+	sanitize := func(s string) string {
+		var b strings.Builder
+		for _, r := range s {
+			if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '_' {
+				b.WriteRune(r)
+			} else {
+				b.WriteByte('_')
+			}
+		}
+		return b.String()
+	}
+	name := mcpToolPrefix + sanitize(server) + "__" + sanitize(tool)
+	if len(name) > 64 {
+		name = name[:55] + "_" + shortHash([]byte(server + "/" + tool))[:8]
+	}
+	return name
+}
+
+func firstNonEmptyString(vals ...string) string {
+	for _, v := range vals {
+		if strings.TrimSpace(v) != "" {
+			return strings.TrimSpace(v)
+		}
+	}
+	return ""
+}
+
+// --- stdio transport ---
+
+type mcpStdioTransport struct {
+	cmd     *exec.Cmd
+	stdin   io.WriteCloser
+	stderr  *tailBuffer
+	writeMu sync.Mutex
+
+	mu      sync.Mutex
+	pending map[string]chan *mcpMessage
+	done    chan struct{}
+	readErr error
+}
+
+func startMCPStdio(command []string, environ []string, dir string) (*mcpStdioTransport, error) {
+	cmd := exec.Command(command[0], command[1:]...)
+	cmd.Dir = dir
+	cmd.Env = environ
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	t := &mcpStdioTransport{
+		cmd:     cmd,
+		stdin:   stdin,
+		stderr:  &tailBuffer{max: 4096},
+		pending: map[string]chan *mcpMessage{},
+		done:    make(chan struct{}),
+	}
+	cmd.Stderr = t.stderr
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("start %s: %w", command[0], err)
+	}
+	go t.readLoop(stdout)
+	return t, nil
+}
+
+func (t *mcpStdioTransport) readLoop(r io.Reader) {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 0, 64*1024), 32*1024*1024)
+	for sc.Scan() {
+		var msg mcpMessage
+		if json.Unmarshal(sc.Bytes(), &msg) != nil {
+			continue
+		}
+		switch {
+		case msg.isResponse():
+			t.mu.Lock()
+			ch := t.pending[string(msg.ID)]
+			delete(t.pending, string(msg.ID))
+			t.mu.Unlock()
+			if ch != nil {
+				ch <- &msg
+			}
+		case len(msg.ID) > 0:
+			// Server-initiated request (ping, sampling, roots...): answer ping,
+			// decline the rest.
+			reply := mcpMessage{JSONRPC: "2.0", ID: msg.ID, Result: json.RawMessage(`{}`)}
+			if msg.Method != "ping" {
+				reply = mcpMessage{JSONRPC: "2.0", ID: msg.ID, Error: &mcpRPCError{Code: -32601, Message: "method not supported: " + msg.Method}}
+			}
+			_ = t.write(reply)
+		}
+	}
+	// Drain stdout before Wait so it also collects stderr and the exit status.
+	_, _ = io.Copy(io.Discard, r)
+	err := sc.Err()
+	if waitErr := t.cmd.Wait(); err == nil {
+		err = waitErr
+	}
+	if err == nil {
+		err = io.EOF
+	}
+	t.mu.Lock()
+	t.readErr = err
+	t.mu.Unlock()
+	close(t.done)
+}
+
+func (t *mcpStdioTransport) write(msg mcpMessage) error {
+	b, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	t.writeMu.Lock()
+	defer t.writeMu.Unlock()
+	_, err = t.stdin.Write(append(b, '\n'))
+	return err
+}
+
+func (t *mcpStdioTransport) roundTrip(ctx context.Context, msg mcpMessage) (*mcpMessage, error) {
+	ch := make(chan *mcpMessage, 1)
+	t.mu.Lock()
+	t.pending[string(msg.ID)] = ch
+	t.mu.Unlock()
+	defer func() {
+		t.mu.Lock()
+		delete(t.pending, string(msg.ID))
+		t.mu.Unlock()
+	}()
+	if err := t.write(msg); err != nil {
+		return nil, t.exitError(err)
+	}
+	select {
+	case resp := <-ch:
+		return resp, nil
+	case <-t.done:
+		return nil, t.exitError(nil)
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (t *mcpStdioTransport) notify(_ context.Context, msg mcpMessage) error {
+	return t.write(msg)
+}
+
+func (t *mcpStdioTransport) exitError(err error) error {
+	select {
+	case <-t.done:
+		t.mu.Lock()
+		err = t.readErr
+		t.mu.Unlock()
+	case <-time.After(time.Second):
+	}
+	if tail := strings.TrimSpace(t.stderr.String()); tail != "" {
+		return fmt.Errorf("server exited (%v); stderr: %s", err, tail)
+	}
+	return fmt.Errorf("server exited: %v", err)
+}
+
+func (t *mcpStdioTransport) close() error {
+	// Spec shutdown: close stdin, give the server a moment, then kill.
+	_ = t.stdin.Close()
+	select {
+	case <-t.done:
+	case <-time.After(2 * time.Second):
+		_ = t.cmd.Process.Kill()
+		<-t.done
+	}
+	return nil
+}
+
+// tailBuffer keeps the last max bytes written (server stderr for diagnostics).
+type tailBuffer struct {
+	mu  sync.Mutex
+	max int
+	buf []byte
+}
+
+func (b *tailBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.buf = append(b.buf, p...)
+	if len(b.buf) > b.max {
+		b.buf = b.buf[len(b.buf)-b.max:]
+	}
+	return len(p), nil
+}
+
+func (b *tailBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return string(b.buf)
+}
+
+// --- streamable HTTP transport ---
+
+type mcpHTTPTransport struct {
+	url     string
+	headers map[string]string
+	client  *http.Client
+
+	mu              sync.Mutex
+	sessionID       string
+	protocolVersion string
+}
+
+var errMCPResponseFound = errors.New("mcp response found")
+
+func newMCPHTTP(url string, headers map[string]string) *mcpHTTPTransport {
+	return &mcpHTTPTransport{url: strings.TrimSpace(url), headers: headers, client: &http.Client{}}
+}
+
+func (t *mcpHTTPTransport) setProtocolVersion(v string) {
+	t.mu.Lock()
+	t.protocolVersion = v
+	t.mu.Unlock()
+}
+
+func (t *mcpHTTPTransport) newRequest(ctx context.Context, method string, body []byte) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, t.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json, text/event-stream")
+	for k, v := range t.headers {
+		req.Header.Set(k, v)
+	}
+	t.mu.Lock()
+	if t.sessionID != "" {
+		req.Header.Set("Mcp-Session-Id", t.sessionID)
+	}
+	if t.protocolVersion != "" {
+		req.Header.Set("MCP-Protocol-Version", t.protocolVersion)
+	}
+	t.mu.Unlock()
+	return req, nil
+}
+
+func (t *mcpHTTPTransport) post(ctx context.Context, msg mcpMessage) (*http.Response, error) {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+	req, err := t.newRequest(ctx, http.MethodPost, body)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if sid := resp.Header.Get("Mcp-Session-Id"); sid != "" {
+		t.mu.Lock()
+		t.sessionID = sid
+		t.mu.Unlock()
+	}
+	if resp.StatusCode >= 300 {
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, 2048))
+		_ = resp.Body.Close()
+		return nil, fmt.Errorf("http %d: %s", resp.StatusCode, strings.TrimSpace(string(b)))
+	}
+	return resp, nil
+}
+
+func (t *mcpHTTPTransport) roundTrip(ctx context.Context, msg mcpMessage) (*mcpMessage, error) {
+	resp, err := t.post(ctx, msg)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if mediaType != "text/event-stream" {
+		var out mcpMessage
+		if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+			return nil, fmt.Errorf("decode response: %w", err)
+		}
+		return &out, nil
+	}
+	// The server may interleave notifications before the response.
+	var found *mcpMessage
+	err = llm.ParseSSE(ctx, resp.Body, func(ev llm.SSEEvent) error {
+		var m mcpMessage
+		if json.Unmarshal(ev.Data, &m) != nil {
+			return nil
+		}
+		if m.isResponse() && bytes.Equal(m.ID, msg.ID) {
+			found = &m
+			return errMCPResponseFound
+		}
+		return nil
+	})
+	if found != nil {
+		return found, nil
+	}
+	if err == nil {
+		err = io.ErrUnexpectedEOF
+	}
+	return nil, fmt.Errorf("event stream ended without a response: %w", err)
+}
+
+func (t *mcpHTTPTransport) notify(ctx context.Context, msg mcpMessage) error {
+	resp, err := t.post(ctx, msg)
+	if err != nil {
+		return err
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	return resp.Body.Close()
+}
+
+func (t *mcpHTTPTransport) close() error {
+	t.mu.Lock()
+	sid := t.sessionID
+	t.mu.Unlock()
+	if sid == "" {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req, err := t.newRequest(ctx, http.MethodDelete, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
@@ -0,0 +1,241 @@
+package agent
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/danshapiro/kilroy/internal/llm"
+)
+
+// fakeMCPResult answers one MCP request for both test transports.
+func fakeMCPResult(method string, params map[string]any) any {
+	switch method {
+	case "initialize":
+		return map[string]any{"protocolVersion": mcpProtocolVersion, "capabilities": map[string]any{"tools": map[string]any{}}}
+	case "tools/list":
+		if params["cursor"] == nil {
+			return map[string]any{
+				"tools":      []any{map[string]any{"name": "echo", "description": "Echo text", "inputSchema": map[string]any{"type": "object", "properties": map[string]any{"text": map[string]any{"type": "string"}}, "required": []any{"text"}}}},
+				"nextCursor": "p2",
+			}
+		}
+		return map[string]any{"tools": []any{map[string]any{"name": "screen-shot"}}}
+	case "tools/call":
+		args, _ := params["arguments"].(map[string]any)
+		switch params["name"] {
+		case "echo":
+			return map[string]any{"content": []any{map[string]any{"type": "text", "text": fmt.Sprintf("echo: %v", args["text"])}}}
+		case "screen-shot":
+			return map[string]any{"content": []any{
+				map[string]any{"type": "text", "text": "captured"},
+				map[string]any{"type": "image", "data": "AQID", "mimeType": "image/png"},
+			}}
+		}
+		return map[string]any{"content": []any{map[string]any{"type": "text", "text": "no such tool"}}, "isError": true}
+	}
+	return nil
+}
+
+// TestMCPHelperServer is not a real test: it is re-executed as a stdio MCP
+// server by the tests below.
+func TestMCPHelperServer(t *testing.T) {
+	if os.Getenv("KILROY_TEST_MCP_SERVER") != "1" {
+		t.Skip("helper process")
+	}
+	sc := bufio.NewScanner(os.Stdin)
+	for sc.Scan() {
+		var req struct {
+			ID     json.RawMessage `json:"id"`
+			Method string          `json:"method"`
+			Params map[string]any  `json:"params"`
+		}
+		if json.Unmarshal(sc.Bytes(), &req) != nil || len(req.ID) == 0 {
+			continue
+		}
+		// Exercise server-initiated requests before answering.
+		fmt.Println(`{"jsonrpc":"2.0","id":"srv-1","method":"ping"}`)
+		b, _ := json.Marshal(map[string]any{"jsonrpc": "2.0", "id": req.ID, "result": fakeMCPResult(req.Method, req.Params)})
+		fmt.Println(string(b))
+	}
+	os.Exit(0)
+}
+
+func helperMCPServer(name string) MCPServerConfig {
+	return MCPServerConfig{
+		Name:    name,
+		Command: []string{os.Args[0], "-test.run=^TestMCPHelperServer$"},
+		Env:     map[string]string{"KILROY_TEST_MCP_SERVER": "1"},
+	}
+}
+
+func TestSession_MCPStdioServer_ToolsRegisteredCalledAndTornDown(t *testing.T) {
+	dir := t.TempDir()
+	c := llm.NewClient()
+	call := llm.ToolCallData{ID: "c1", Name: "mcp__fake__echo", Arguments: json.RawMessage(`{"text":"hi"}`), Type: "function"}
+	var sawTools []string
+	f := &fakeAdapter{
+		name: "openai",
+		steps: []func(req llm.Request) llm.Response{
+			func(req llm.Request) llm.Response {
+				for _, td := range req.Tools {
+					sawTools = append(sawTools, td.Name)
+				}
+				return llm.Response{Message: llm.Message{Role: llm.RoleAssistant, Content: []llm.ContentPart{{Kind: llm.ContentToolCall, ToolCall: &call}}}}
+			},
+			func(req llm.Request) llm.Response {
+				last := req.Messages[len(req.Messages)-1]
+				if last.Role != llm.RoleTool || fmt.Sprint(last.Content[0].ToolResult.Content) != "echo: hi" {
+					return llm.Response{Message: llm.Assistant(fmt.Sprintf("bad tool result: %+v", last))}
+				}
+				return llm.Response{Message: llm.Assistant("ok")}
+			},
+		},
+	}
+	c.Register(f)
+
+	sess, err := NewSession(c, NewOpenAIProfile("gpt-5.4"), NewLocalExecutionEnvironment(dir), SessionConfig{
+		MCPServers: []MCPServerConfig{helperMCPServer("fake")},
+	})
+	if err != nil {
+		t.Fatalf("NewSession: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	out, err := sess.ProcessInput(ctx, "use the echo tool")
+	if err != nil || strings.TrimSpace(out) != "ok" {
+		t.Fatalf("ProcessInput: out=%q err=%v", out, err)
+	}
+	joined := strings.Join(sawTools, ",")
+	if !strings.Contains(joined, "mcp__fake__echo") || !strings.Contains(joined, "mcp__fake__screen_shot") {
+		t.Fatalf("mcp tools not offered to the model: %s", joined)
+	}
+
+	res := sess.reg.ExecuteCall(ctx, sess.env, llm.ToolCallData{ID: "c2", Name: "mcp__fake__screen_shot"})
+	if res.IsError || string(res.ImageData) != "\x01\x02\x03" || res.ImageMediaType != "image/png" || !strings.Contains(res.Output, "captured") {
+		t.Fatalf("image result: %+v", res)
+	}
+
+	proc := sess.mcpClients[0].t.(*mcpStdioTransport).cmd
+	sess.Close()
+	if proc.ProcessState == nil {
+		t.Fatalf("stdio server still running after Close")
+	}
+}
+
+func TestSession_MCPStdioServerEnvFollowsExecutionEnvironmentPolicy(t *testing.T) {
+	t.Setenv("KILROY_TEST_MCP_STRIPPED", "1")
+	t.Setenv("OPENAI_API_KEY", "sk-parent")
+	env := NewLocalExecutionEnvironmentWithPolicy(t.TempDir(), map[string]string{"KILROY_TEST_MCP_BASE": "base"}, []string{"KILROY_TEST_MCP_STRIPPED"})
+	cfg := helperMCPServer("fake")
+	cfg.Env["MCP_API_KEY"] = "declared"
+	sess, err := NewSession(llm.NewClient(), NewOpenAIProfile("gpt-5.4"), env, SessionConfig{MCPServers: []MCPServerConfig{cfg}})
+	if err != nil {
+		t.Fatalf("NewSession: %v", err)
+	}
+	defer sess.Close()
+	got := strings.Join(sess.mcpClients[0].t.(*mcpStdioTransport).cmd.Env, "\n")
+	for _, want := range []string{"KILROY_TEST_MCP_BASE=base", "KILROY_TEST_MCP_SERVER=1", "MCP_API_KEY=declared"} {
+		if !strings.Contains(got, want) {
+			t.Fatalf("server env missing %s", want)
+		}
+	}
+	for _, leaked := range []string{"KILROY_TEST_MCP_STRIPPED", "OPENAI_API_KEY"} {
+		if strings.Contains(got, leaked) {
+			t.Fatalf("%s reached the MCP server", leaked)
+		}
+	}
+}
+
+func TestNewSession_MCPServerStartupFailureIsReported(t *testing.T) {
+	_, err := NewSession(llm.NewClient(), NewOpenAIProfile("gpt-5.4"), NewLocalExecutionEnvironment(t.TempDir()), SessionConfig{
+		MCPServers: []MCPServerConfig{{Name: "broken", Command: []string{"sh", "-c", "echo boom >&2; exit 3"}}},
+	})
+	if err == nil || !strings.Contains(err.Error(), "mcp server broken") || !strings.Contains(err.Error(), "boom") {
+		t.Fatalf("expected startup error with stderr, got %v", err)
+	}
+}
+
+func TestMCPHTTPTransport_StreamableHTTPWithSSEAndSession(t *testing.T) {
+	var mu sync.Mutex
+	var deleted bool
+	var sessionHeaders []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer tok" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		mu.Lock()
+		sessionHeaders = append(sessionHeaders, r.Header.Get("Mcp-Session-Id"))
+		if r.Method == http.MethodDelete {
+			deleted = true
+		}
+		mu.Unlock()
+		if r.Method == http.MethodDelete {
+			return
+		}
+		var req struct {
+			ID     json.RawMessage `json:"id"`
+			Method string          `json:"method"`
+			Params map[string]any  `json:"params"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		if len(req.ID) == 0 {
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+		b, _ := json.Marshal(map[string]any{"jsonrpc": "2.0", "id": req.ID, "result": fakeMCPResult(req.Method, req.Params)})
+		if req.Method == "initialize" {
+			w.Header().Set("Mcp-Session-Id", "sess-1")
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write(b)
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprintf(w, "data: {\"jsonrpc\":\"2.0\",\"method\":\"notifications/progress\"}\n\n")
+		fmt.Fprintf(w, "event: message\ndata: %s\n\n", b)
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	c, err := startMCPClient(ctx, MCPServerConfig{Name: "remote", URL: srv.URL, Headers: map[string]string{"Authorization": "Bearer tok"}}, "", nil)
+	if err != nil {
+		t.Fatalf("startMCPClient: %v", err)
+	}
+	if len(c.tools) != 2 {
+		t.Fatalf("tools: %+v", c.tools)
+	}
+	v, err := c.callTool(ctx, "echo", map[string]any{"text": "over http"})
+	if err != nil || v != "echo: over http" {
+		t.Fatalf("callTool: %v %v", v, err)
+	}
+	if _, err := c.callTool(ctx, "nope", nil); err == nil || !strings.Contains(err.Error(), "no such tool") {
+		t.Fatalf("expected isError result to surface as error, got %v", err)
+	}
+	_ = c.close()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if !deleted || sessionHeaders[0] != "" || sessionHeaders[len(sessionHeaders)-1] != "sess-1" {
+		t.Fatalf("session lifecycle: deleted=%v headers=%v", deleted, sessionHeaders)
+	}
+}
+
+func TestMCPToolName_SanitizesAndBoundsLength(t *testing.T) {
+	if got := mcpToolName("issues", "search-issues.v2"); got != "mcp__issues__search_issues_v2" {
+		t.Fatalf("got %q", got)
+	}
+	long := mcpToolName("server", strings.Repeat("x", 80))
+	if len(long) != 64 || llm.ValidateToolName(long) != nil || long == mcpToolName("server", strings.Repeat("x", 81)) {
+		t.Fatalf("long name: %q", long)
+	}
+}
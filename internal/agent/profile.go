@@ -343,7 +343,7 @@ func defGlob() llm.ToolDefinition {
 func defApplyPatch() llm.ToolDefinition {
 	return llm.ToolDefinition{
 		Name:        "apply_patch",
-		Description: "Apply code changes using the v4a patch format.",
+		Description: "Apply code changes using the v4a patch format (*** Begin Patch). Unified diffs (diff -u or git diff output, including renames, deletes and --binary new files) are also accepted; hunks may be offset from their line numbers. If any hunk fails, no files are changed and the error shows the failing hunk next to the closest matching lines.",
 		Parameters: map[string]any{
 			"type":                 "object",
 			"additionalProperties": false,
@@ -358,12 +358,18 @@ func defApplyPatch() llm.ToolDefinition {
 func defSpawnAgent() llm.ToolDefinition {
 	return llm.ToolDefinition{
 		Name:        "spawn_agent",
-		Description: "Spawn a sub-agent to work on a scoped task.",
+		Description: "Spawn a sub-agent to work on a scoped task. With isolated=true (when the stage enables isolated subagents) the sub-agent works in its own git worktree that starts from the current working tree, uncommitted edits included; wait then returns its diff and merge_agent brings the changes back. Optionally pick a cheaper provider/model and reasoning_effort, restrict it to a tools allowlist (e.g. read_file, grep, glob for a read-only scout), and cap it with max_turns.",
 		Parameters: map[string]any{
 			"type":                 "object",
 			"additionalProperties": false,
 			"properties": map[string]any{
-				"task": map[string]any{"type": "string"},
+				"task":             map[string]any{"type": "string"},
+				"isolated":         map[string]any{"type": "boolean"},
+				"provider":         map[string]any{"type": "string"},
+				"model":            map[string]any{"type": "string"},
+				"reasoning_effort": map[string]any{"type": "string", "enum": []string{"low", "medium", "high"}},
+				"tools":            map[string]any{"type": "array", "items": map[string]any{"type": "string"}},
+				"max_turns":        map[string]any{"type": "integer", "minimum": 1},
 			},
 			"required": []string{"task"},
 		},
@@ -416,3 +422,112 @@ func defCloseAgent() llm.ToolDefinition {
 		},
 	}
 }
+
+func defMergeAgent() llm.ToolDefinition {
+	return llm.ToolDefinition{
+		Name:        "merge_agent",
+		Description: "Merge an isolated sub-agent's changes into the working tree: accept (all changes, then close), reject (discard, then close), or cherry_pick (only the listed commits; the sub-agent stays open). Optional paths (relative to the working directory) restrict the merge to those files. Changes are applied to the working tree only, merging with any edits made since the spawn.",
+		Parameters: map[string]any{
+			"type":                 "object",
+			"additionalProperties": false,
+			"properties": map[string]any{
+				"agent_id": map[string]any{"type": "string"},
+				"action":   map[string]any{"type": "string", "enum": []string{"accept", "reject", "cherry_pick"}},
+				"commits":  map[string]any{"type": "array", "items": map[string]any{"type": "string"}},
+				"paths":    map[string]any{"type": "array", "items": map[string]any{"type": "string"}},
+			},
+			"required": []string{"agent_id", "action"},
+		},
+	}
+}
+
+// lspPositionParams are the parameters shared by the position-based
+// code-intelligence tools.
+func lspPositionParams(extra map[string]any) map[string]any {
+	props := map[string]any{
+		"file_path": map[string]any{"type": "string"},
+		"line":      map[string]any{"type": "integer", "minimum": 1, "description": "1-based line number"},
+		"symbol":    map[string]any{"type": "string", "description": "identifier on that line to query (preferred over column)"},
+		"column":    map[string]any{"type": "integer", "minimum": 1, "description": "1-based character column"},
+	}
+	for k, v := range extra {
+		props[k] = v
+	}
+	return map[string]any{
+		"type":                 "object",
+		"additionalProperties": false,
+		"properties":           props,
+		"required":             []string{"file_path", "line"},
+	}
+}
+
+func defFindDefinition() llm.ToolDefinition {
+	return llm.ToolDefinition{
+		Name:        "find_definition",
+		Description: "Go to the definition of the symbol at a position, using the language server.",
+		Parameters:  lspPositionParams(nil),
+	}
+}
+
+func defFindReferences() llm.ToolDefinition {
+	return llm.ToolDefinition{
+		Name:        "find_references",
+		Description: "List every reference to the symbol at a position across the workspace, using the language server.",
+		Parameters: lspPositionParams(map[string]any{
+			"include_declaration": map[string]any{"type": "boolean"},
+			"max_results":         map[string]any{"type": "integer"},
+		}),
+	}
+}
+
+func defDocumentSymbols() llm.ToolDefinition {
+	return llm.ToolDefinition{
+		Name:        "document_symbols",
+		Description: "Outline the symbols (types, functions, methods, fields...) declared in a file, using the language server.",
+		Parameters: map[string]any{
+			"type":                 "object",
+			"additionalProperties": false,
+			"properties": map[string]any{
+				"file_path": map[string]any{"type": "string"},
+			},
+			"required": []string{"file_path"},
+		},
+	}
+}
+
+func defDiagnostics() llm.ToolDefinition {
+	return llm.ToolDefinition{
+		Name:        "diagnostics",
+		Description: "Report compiler/type-checker errors and warnings for files, using the language server.",
+		Parameters: map[string]any{
+			"type":                 "object",
+			"additionalProperties": false,
+			"properties": map[string]any{
+				"file_paths": map[string]any{"type": "array", "items": map[string]any{"type": "string"}, "minItems": 1},
+			},
+			"required": []string{"file_paths"},
+		},
+	}
+}
+
+// ReportStatusToolDefinition describes the report_status tool; its schema
+// mirrors the attractor stage outcome (status.json).
+func ReportStatusToolDefinition() llm.ToolDefinition {
+	return llm.ToolDefinition{
+		Name:        "report_status",
+		Description: "Report this stage's outcome. status is success, partial_success, retry, fail, skipped, or a custom routing value; failure_reason is required for fail and retry. Call it again to replace an earlier report; the last call wins.",
+		Parameters: map[string]any{
+			"type":                 "object",
+			"additionalProperties": false,
+			"properties": map[string]any{
+				"status":             map[string]any{"type": "string", "minLength": 1},
+				"preferred_label":    map[string]any{"type": "string"},
+				"suggested_next_ids": map[string]any{"type": "array", "items": map[string]any{"type": "string"}},
+				"context_updates":    map[string]any{"type": "object"},
+				"failure_reason":     map[string]any{"type": "string"},
+				"notes":              map[string]any{"type": "string"},
+			},
+			"required": []string{"status"},
+		},
+	}
+}
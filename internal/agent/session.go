@@ -13,6 +13,7 @@ import (
 	"github.com/oklog/ulid/v2"
 
 	"github.com/danshapiro/kilroy/internal/llm"
+	"github.com/danshapiro/kilroy/internal/telemetry"
 )
 
 type SessionConfig struct {
@@ -24,6 +25,11 @@ type SessionConfig struct {
 	RepeatedErrorToolCallLimit     int
 	MaxSubagentDepth               int
 
+	// SubagentWorktrees makes spawn_agent isolate each subagent in its own git
+	// worktree by default (spawn_agent's "isolated" argument overrides it) and
+	// registers merge_agent. Without it subagents always share the worktree.
+	SubagentWorktrees bool
+
 	// ToolOutputLimits overrides default per-tool truncation behavior.
 	ToolOutputLimits map[string]ToolOutputLimit
 
@@ -42,6 +48,40 @@ type SessionConfig struct {
 	// Use this for provider-specific parameters (e.g., Cerebras clear_thinking).
 	ProviderOptions map[string]any
 
+	// MCPServers are launched when the session starts; their tools are
+	// registered as "mcp__<server>__<tool>" and the servers are shut down by
+	// Close. Subagents share the parent's servers.
+	MCPServers []MCPServerConfig
+
+	// LSPServers, when non-empty, registers the code-intelligence tools
+	// (find_definition, find_references, document_symbols, diagnostics). Each
+	// server is started on first use in the working directory and shut down
+	// by Close.
+	LSPServers []LSPServerConfig
+
+	// StatusReporter, when non-nil, registers the report_status tool. It
+	// receives the call's arguments as JSON; a returned error is reported back
+	// to the model so it can correct the call.
+	StatusReporter func(outcomeJSON []byte) error
+
+	// ToolAllowlist, when non-empty, restricts the session to the named tools
+	// (core or MCP): the others are neither offered to the model nor executable.
+	ToolAllowlist []string
+
+	// ResolveSubagentProfile resolves a spawn_agent provider/model override
+	// (either may be empty, meaning "same as the parent"). Nil falls back to
+	// NewProfileForFamily without further validation.
+	ResolveSubagentProfile func(provider, model string) (ProviderProfile, error)
+
+	// JournalPath, when non-empty, is where the session journals its history
+	// (NDJSON, one line per turn, with usage on assistant turns) as it goes.
+	// See LoadJournal.
+	JournalPath string
+
+	// ResumeHistory seeds the session with a transcript loaded from an
+	// interrupted session's journal; the next ProcessInput continues it.
+	ResumeHistory []Turn
+
 	// ToolCallFilter, when non-nil, is invoked before each tool call is executed.
 	// It receives the tool name, call ID, and arguments JSON. If it returns a
 	// non-empty string, the tool call is skipped and the returned string is used
@@ -112,9 +152,32 @@ type Session struct {
 	// subagents
 	depth     int
 	subagents map[string]*subagent
+
+	// mcpClients are owned (and closed) by the session that launched them;
+	// sharedMCP are a parent's clients whose tools this subagent also exposes.
+	mcpClients []*mcpClient
+	sharedMCP  []*mcpClient
+
+	// extraToolDefs are offered alongside the profile's tools (MCP tools,
+	// code-intelligence tools, report_status).
+	extraToolDefs []llm.ToolDefinition
+
+	// lsp is owned (and closed) by the session that started it; sharedLSP is
+	// a parent's set used by a subagent working in the same worktree.
+	lsp       *lspSet
+	sharedLSP *lspSet
+
+	journal *sessionJournal
+	// interrupted is set when processing was aborted, so the journal is left
+	// open for a later resume.
+	interrupted bool
 }
 
 func NewSession(client *llm.Client, profile ProviderProfile, env ExecutionEnvironment, cfg SessionConfig) (*Session, error) {
+	return newSession(client, profile, env, cfg, nil, nil)
+}
+
+func newSession(client *llm.Client, profile ProviderProfile, env ExecutionEnvironment, cfg SessionConfig, sharedMCP []*mcpClient, sharedLSP *lspSet) (*Session, error) {
 	if client == nil {
 		return nil, fmt.Errorf("llm client is nil")
 	}
@@ -135,6 +198,8 @@ func NewSession(client *llm.Client, profile ProviderProfile, env ExecutionEnviro
 		events:    make(chan SessionEvent, 256),
 		history:   []Turn{},
 		subagents: map[string]*subagent{},
+		sharedMCP: sharedMCP,
+		sharedLSP: sharedLSP,
 	}
 
 	// Snapshot environment context once per session (spec).
@@ -176,9 +241,87 @@ func NewSession(client *llm.Client, profile ProviderProfile, env ExecutionEnviro
 	}
 	s.reg = reg
 
+	for _, sc := range cfg.MCPServers {
+		c, err := startMCPClient(context.Background(), sc, env.WorkingDirectory(), commandEnv(env, sc.Env))
+		if err != nil {
+			s.closeMCP()
+			return nil, fmt.Errorf("mcp server %s: %w", sc.Name, err)
+		}
+		s.mcpClients = append(s.mcpClients, c)
+	}
+	mcpDefs, err := registerMCPTools(reg, append(append([]*mcpClient{}, s.mcpClients...), sharedMCP...))
+	if err != nil {
+		s.closeMCP()
+		return nil, err
+	}
+	s.extraToolDefs = mcpDefs
+	lsp := sharedLSP
+	if lsp == nil && len(cfg.LSPServers) > 0 {
+		s.lsp = newLSPSet(cfg.LSPServers, env)
+		lsp = s.lsp
+	}
+	if lsp != nil {
+		lspDefs, err := registerLSPTools(reg, lsp)
+		if err != nil {
+			s.closeMCP()
+			return nil, err
+		}
+		s.extraToolDefs = append(s.extraToolDefs, lspDefs...)
+	}
+	if cfg.SubagentWorktrees {
+		def := defMergeAgent()
+		if err := reg.Register(RegisteredTool{
+			Definition: def,
+			Exec: func(ctx context.Context, env ExecutionEnvironment, args map[string]any) (any, error) {
+				_ = env
+				return s.mergeAgent(ctx, argStr(args, "agent_id"), argStr(args, "action"), argStrings(args, "commits"), argStrings(args, "paths"))
+			},
+		}); err != nil {
+			s.closeMCP()
+			return nil, err
+		}
+		s.extraToolDefs = append(s.extraToolDefs, def)
+	}
+	if cfg.StatusReporter != nil {
+		def := ReportStatusToolDefinition()
+		if err := reg.Register(RegisteredTool{
+			Definition: def,
+			Exec: func(ctx context.Context, env ExecutionEnvironment, args map[string]any) (any, error) {
+				_, _ = ctx, env
+				b, _ := json.Marshal(args)
+				if err := cfg.StatusReporter(b); err != nil {
+					return "", err
+				}
+				return fmt.Sprintf("status recorded: %s", argStr(args, "status")), nil
+			},
+		}); err != nil {
+			s.closeMCP()
+			return nil, err
+		}
+		s.extraToolDefs = append(s.extraToolDefs, def)
+	}
+	if len(cfg.ToolAllowlist) > 0 {
+		if err := s.applyToolAllowlist(cfg.ToolAllowlist); err != nil {
+			s.closeMCP()
+			return nil, err
+		}
+	}
+	if len(cfg.ResumeHistory) > 0 {
+		s.history = reconcileInterruptedTurns(cfg.ResumeHistory)
+	}
+	if strings.TrimSpace(cfg.JournalPath) != "" {
+		j, err := openSessionJournal(cfg.JournalPath, profile, s.history)
+		if err != nil {
+			s.closeMCP()
+			return nil, fmt.Errorf("session journal: %w", err)
+		}
+		s.journal = j
+	}
+
 	s.emit(EventSessionStart, map[string]any{
-		"profile": profile.ID(),
-		"model":   profile.Model(),
+		"profile":       profile.ID(),
+		"model":         profile.Model(),
+		"resumed_turns": len(s.history),
 	})
 	return s, nil
 }
@@ -229,12 +372,36 @@ func (s *Session) Close() {
 		return
 	}
 	s.closed = true
+	interrupted := s.interrupted
 	s.mu.Unlock()
 
+	s.closeMCP()
+	s.lsp.close()
+	s.closeSubagents()
+	s.journal.close(!interrupted)
 	s.emit(EventSessionEnd, map[string]any{})
 	close(s.events)
 }
 
+func (s *Session) closeSubagents() {
+	s.mu.Lock()
+	ids := make([]string, 0, len(s.subagents))
+	for id := range s.subagents {
+		ids = append(ids, id)
+	}
+	s.mu.Unlock()
+	for _, id := range ids {
+		_, _ = s.closeAgent(id)
+	}
+}
+
+func (s *Session) closeMCP() {
+	for _, c := range s.mcpClients {
+		_ = c.close()
+	}
+	s.mcpClients = nil
+}
+
 func (s *Session) ProcessInput(ctx context.Context, input string) (string, error) {
 	outputs := []string{}
 	next := input
@@ -246,6 +413,9 @@ func (s *Session) ProcessInput(ctx context.Context, input string) (string, error
 		if err != nil {
 			// Spec: abort signal closes the session and stops the loop.
 			if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) || ctx.Err() != nil {
+				s.mu.Lock()
+				s.interrupted = true
+				s.mu.Unlock()
 				s.Close()
 			}
 			return strings.Join(outputs, "\n"), err
@@ -288,7 +458,15 @@ func (s *Session) execTool(ctx context.Context, call llm.ToolCallData) ToolExecR
 	}
 
 	// Session-level tools (subagents) are registered in the registry with closures.
-	res := s.reg.ExecuteCall(ctx, s.env, call)
+	toolCtx, toolSpan := telemetry.Start(ctx, "tool.call "+call.Name, telemetry.SpanKindInternal, map[string]any{
+		"gen_ai.tool.name":    call.Name,
+		"gen_ai.tool.call.id": call.ID,
+	})
+	res := s.reg.ExecuteCall(toolCtx, s.env, call)
+	if res.IsError {
+		toolSpan.SetStatus(telemetry.StatusError, spanStatusMessage(res.Output))
+	}
+	toolSpan.End()
 
 	// Emit output deltas (best-effort). Even for non-streaming tools, this gives consumers a uniform
 	// incremental event pattern that mirrors provider LLM streaming.
@@ -315,10 +493,36 @@ func (s *Session) execTool(ctx context.Context, call llm.ToolCallData) ToolExecR
 	return res
 }
 
+// responseModel prefers the model id reported by the provider, falling back
+// to the requested one.
+func responseModel(resp llm.Response, req llm.Request) string {
+	if m := strings.TrimSpace(resp.Model); m != "" {
+		return m
+	}
+	return req.Model
+}
+
+// spanStatusMessage keeps span status descriptions short: the first line of
+// tool output, capped at 256 bytes.
+func spanStatusMessage(out string) string {
+	msg, _, _ := strings.Cut(strings.TrimSpace(out), "\n")
+	if len(msg) > 256 {
+		msg = msg[:256]
+	}
+	return msg
+}
+
 func (s *Session) appendTurn(kind TurnKind, m llm.Message) {
+	s.appendTurnWithUsage(kind, m, nil)
+}
+
+func (s *Session) appendTurnWithUsage(kind TurnKind, m llm.Message, usage *llm.Usage) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	s.history = append(s.history, Turn{Kind: kind, Message: m})
+	if err := s.journal.append(string(kind), &m, usage); err != nil {
+		s.emit(EventWarning, map[string]any{"message": "session journal: " + err.Error()})
+	}
 }
 
 func (s *Session) maybeWarnContextUsage(msgs []llm.Message) bool {
@@ -446,11 +650,17 @@ func (s *Session) processOneInput(ctx context.Context, input string) (string, er
 	loopWarned := false
 	ctxWarned := false
 
+	// Each round is traced as an agent turn; the span is ended at the top of the
+	// next round or on return, whichever comes first.
+	baseCtx := ctx
+	var turnSpan *telemetry.Span
+	defer func() { turnSpan.End() }()
+
 	for round := 0; round < s.cfg.MaxToolRoundsPerInput; round++ {
 		select {
-		case <-ctx.Done():
-			s.emit(EventError, map[string]any{"error": ctx.Err().Error()})
-			return "", ctx.Err()
+		case <-baseCtx.Done():
+			s.emit(EventError, map[string]any{"error": baseCtx.Err().Error()})
+			return "", baseCtx.Err()
 		default:
 		}
 		s.mu.Lock()
@@ -473,11 +683,18 @@ func (s *Session) processOneInput(ctx context.Context, input string) (string, er
 			return "", fmt.Errorf("%w (max_turns=%d)", ErrTurnLimit, s.cfg.MaxTurns)
 		}
 
+		turnSpan.End()
+		ctx, turnSpan = telemetry.Start(baseCtx, "agent.turn", telemetry.SpanKindInternal, map[string]any{
+			"kilroy.agent.session_id": s.id,
+			"kilroy.agent.turn":       turns,
+			"kilroy.agent.depth":      s.depth,
+		})
+
 		req := llm.Request{
 			Model:    s.profile.Model(),
 			Provider: s.profile.ID(),
 			Messages: append([]llm.Message{llm.System(sys)}, history...),
-			Tools:    s.profile.ToolDefinitions(),
+			Tools:    append(s.profile.ToolDefinitions(), s.extraToolDefs...),
 		}
 		if strings.TrimSpace(s.cfg.ReasoningEffort) != "" {
 			v := strings.TrimSpace(s.cfg.ReasoningEffort)
@@ -494,9 +711,13 @@ func (s *Session) processOneInput(ctx context.Context, input string) (string, er
 		if s.cfg.LLMRetryPolicy != nil {
 			policy = *s.cfg.LLMRetryPolicy
 		}
+		llmCtx, llmSpan := telemetry.StartLLMRequest(ctx, req)
+		attempts := 0
 		resp, err := llm.Retry(ctx, policy, s.cfg.LLMSleep, nil, func() (llm.Response, error) {
-			return s.client.Complete(ctx, req)
+			attempts++
+			return s.client.Complete(llmCtx, req)
 		})
+		telemetry.EndLLMRequest(llmSpan, resp, attempts, err)
 		if err != nil {
 			s.emit(EventError, map[string]any{"error": err.Error()})
 			// Spec: context overflow should emit a warning (no automatic compaction).
@@ -521,11 +742,18 @@ func (s *Session) processOneInput(ctx context.Context, input string) (string, er
 
 		txt := resp.Text()
 		s.emit(EventAssistantTextStart, map[string]any{})
-		s.appendTurn(TurnAssistant, resp.Message)
+		s.appendTurnWithUsage(TurnAssistant, resp.Message, &resp.Usage)
 		if strings.TrimSpace(txt) != "" {
 			s.emit(EventAssistantTextDelta, map[string]any{"delta": txt})
 		}
-		s.emit(EventAssistantTextEnd, map[string]any{"text": txt})
+		s.emit(EventAssistantTextEnd, map[string]any{
+			"text":          txt,
+			"provider":      s.profile.ID(),
+			"model":         responseModel(resp, req),
+			"input_tokens":  resp.Usage.InputTokens,
+			"output_tokens": resp.Usage.OutputTokens,
+			"total_tokens":  resp.Usage.TotalTokens,
+		})
 
 		calls := resp.ToolCalls()
 		if len(calls) == 0 {
@@ -616,7 +844,12 @@ func (s *Session) processOneInput(ctx context.Context, input string) (string, er
 		}
 
 		for _, r := range results {
-			s.appendTurn(TurnTool, llm.ToolResultNamed(r.CallID, r.ToolName, r.Output, r.IsError))
+			msg := llm.ToolResultNamed(r.CallID, r.ToolName, r.Output, r.IsError)
+			if len(r.ImageData) > 0 {
+				msg.Content[0].ToolResult.ImageData = r.ImageData
+				msg.Content[0].ToolResult.ImageMediaType = r.ImageMediaType
+			}
+			s.appendTurn(TurnTool, msg)
 		}
 
 		// Inject any queued steering messages before the next model call.
@@ -722,6 +955,18 @@ func argStr(args map[string]any, key string) string {
 	return fmt.Sprint(v)
 }
 
+// argStrings extracts a string-array argument, skipping blank entries.
+func argStrings(args map[string]any, key string) []string {
+	items, _ := args[key].([]any)
+	var out []string
+	for _, it := range items {
+		if s := strings.TrimSpace(fmt.Sprint(it)); it != nil && s != "" {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
 func registerCoreTools(reg *ToolRegistry, s *Session) error {
 	// read_file
 	if err := reg.Register(RegisteredTool{
@@ -931,8 +1176,20 @@ func registerCoreTools(reg *ToolRegistry, s *Session) error {
 		Definition: defSpawnAgent(),
 		Exec: func(ctx context.Context, env ExecutionEnvironment, args map[string]any) (any, error) {
 			_ = env
-			task := argStr(args, "task")
-			return s.spawnAgent(ctx, task)
+			opts := spawnOptions{
+				Isolated:        s.cfg.SubagentWorktrees,
+				Provider:        strings.TrimSpace(argStr(args, "provider")),
+				Model:           strings.TrimSpace(argStr(args, "model")),
+				ReasoningEffort: strings.TrimSpace(argStr(args, "reasoning_effort")),
+				Tools:           argStrings(args, "tools"),
+			}
+			if v, ok := args["isolated"].(bool); ok {
+				opts.Isolated = v
+			}
+			if v, ok := args["max_turns"].(float64); ok && int(v) > 0 {
+				opts.MaxTurns = int(v)
+			}
+			return s.spawnAgent(ctx, argStr(args, "task"), opts)
 		},
 	})
 	_ = reg.Register(RegisteredTool{
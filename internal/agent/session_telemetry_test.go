@@ -0,0 +1,95 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/danshapiro/kilroy/internal/llm"
+	"github.com/danshapiro/kilroy/internal/telemetry"
+)
+
+type recordingExporter struct {
+	mu    sync.Mutex
+	spans []*telemetry.SpanData
+}
+
+func (r *recordingExporter) ExportSpan(s *telemetry.SpanData) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.spans = append(r.spans, s)
+}
+
+func (r *recordingExporter) Shutdown(context.Context) error { return nil }
+
+func TestSession_EmitsTurnLLMAndToolSpans(t *testing.T) {
+	dir := t.TempDir()
+	c := llm.NewClient()
+	call := llm.ToolCallData{
+		ID:        "c1",
+		Name:      "write_file",
+		Arguments: json.RawMessage(`{"file_path":"x.txt","content":"x"}`),
+		Type:      "function",
+	}
+	c.Register(&fakeAdapter{
+		name: "openai",
+		steps: []func(req llm.Request) llm.Response{
+			func(req llm.Request) llm.Response {
+				return llm.Response{
+					Message: llm.Message{Role: llm.RoleAssistant, Content: []llm.ContentPart{{Kind: llm.ContentToolCall, ToolCall: &call}}},
+					Usage:   llm.Usage{InputTokens: 10, OutputTokens: 3, TotalTokens: 13},
+				}
+			},
+			func(req llm.Request) llm.Response {
+				return llm.Response{Message: llm.Assistant("ok")}
+			},
+		},
+	})
+	sess, err := NewSession(c, NewOpenAIProfile("gpt-5.4"), NewLocalExecutionEnvironment(dir), SessionConfig{})
+	if err != nil {
+		t.Fatalf("NewSession: %v", err)
+	}
+	defer sess.Close()
+
+	exp := &recordingExporter{}
+	tr := telemetry.NewTracer(exp)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	ctx, root := tr.Start(ctx, "attempt", telemetry.SpanKindInternal, nil)
+	if _, err := sess.ProcessInput(ctx, "go"); err != nil {
+		t.Fatalf("ProcessInput: %v", err)
+	}
+	root.End()
+
+	exp.mu.Lock()
+	defer exp.mu.Unlock()
+	counts := map[string]int{}
+	var firstLLM *telemetry.SpanData
+	turnIDs := map[[8]byte]bool{}
+	for _, s := range exp.spans {
+		counts[s.Name]++
+		if s.Name == "agent.turn" {
+			turnIDs[s.SpanContext.SpanID] = true
+			if s.Parent.SpanID != root.SpanContext().SpanID {
+				t.Fatalf("agent.turn not parented to caller span")
+			}
+		}
+		if s.Name == "llm.request gpt-5.4" && firstLLM == nil {
+			firstLLM = s
+		}
+	}
+	if counts["agent.turn"] != 2 || counts["llm.request gpt-5.4"] != 2 || counts["tool.call write_file"] != 1 {
+		t.Fatalf("unexpected span counts: %v", counts)
+	}
+	if firstLLM == nil || !turnIDs[firstLLM.Parent.SpanID] {
+		t.Fatalf("llm.request not parented to an agent.turn span")
+	}
+	if got := firstLLM.Attributes["gen_ai.usage.input_tokens"]; got != 10 {
+		t.Fatalf("input tokens attr = %v, want 10", got)
+	}
+	if got := firstLLM.Attributes["gen_ai.system"]; got != "openai" {
+		t.Fatalf("gen_ai.system = %v, want openai", got)
+	}
+}
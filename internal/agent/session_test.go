@@ -780,3 +780,49 @@ func anyToString(v any) string {
 		return string(b)
 	}
 }
+
+func TestSession_ReportStatusTool_RegisteredOnlyWithReporter(t *testing.T) {
+	c := llm.NewClient()
+	c.Register(&fakeAdapter{name: "openai"})
+	plain, err := NewSession(c, NewOpenAIProfile("gpt-5.4"), NewLocalExecutionEnvironment(t.TempDir()), SessionConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer plain.Close()
+	if res := plain.reg.ExecuteCall(context.Background(), plain.env, llm.ToolCallData{ID: "1", Name: "report_status", Arguments: json.RawMessage(`{"status":"success"}`)}); !res.IsError {
+		t.Fatalf("report_status should not exist without a reporter: %+v", res)
+	}
+
+	var got []string
+	sess, err := NewSession(c, NewOpenAIProfile("gpt-5.4"), NewLocalExecutionEnvironment(t.TempDir()), SessionConfig{
+		StatusReporter: func(b []byte) error {
+			got = append(got, string(b))
+			if strings.Contains(string(b), `"fail"`) {
+				return fmt.Errorf("failure_reason must be non-empty")
+			}
+			return nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sess.Close()
+	ctx := context.Background()
+	for _, tc := range []struct {
+		args    string
+		wantErr string
+	}{
+		{`{}`, "status"},
+		{`{"status":"done","extra":1}`, "extra"},
+		{`{"status":"fail"}`, "failure_reason"},
+		{`{"status":"success","context_updates":{"k":"v"}}`, ""},
+	} {
+		res := sess.reg.ExecuteCall(ctx, sess.env, llm.ToolCallData{ID: "1", Name: "report_status", Arguments: json.RawMessage(tc.args)})
+		if res.IsError != (tc.wantErr != "") || !strings.Contains(res.Output, tc.wantErr) {
+			t.Fatalf("%s: %+v", tc.args, res)
+		}
+	}
+	if len(got) != 2 || !strings.Contains(got[1], `"context_updates":{"k":"v"}`) {
+		t.Fatalf("reporter calls: %v", got)
+	}
+}
@@ -0,0 +1,321 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// subagentWorktree is the private git worktree of an isolated subagent. It is
+// created detached at a snapshot of the parent's tracked files, uncommitted
+// edits included (base), in the parent's repository, so the subagent's
+// commits share the parent's object store and can be merged back three-way.
+type subagentWorktree struct {
+	repoRoot string // parent's repository top level
+	dir      string // worktree top level
+	rel      string // parent's working directory relative to repoRoot
+	base     string // commit the worktree was branched from (HEAD or a stash snapshot)
+}
+
+func newSubagentWorktree(ctx context.Context, parentDir string) (*subagentWorktree, error) {
+	top, err := gitOut(ctx, parentDir, nil, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return nil, fmt.Errorf("isolated subagents require a git repository: %w", err)
+	}
+	top = strings.TrimSpace(top)
+	base, err := gitOut(ctx, top, nil, "rev-parse", "HEAD")
+	if err != nil {
+		return nil, fmt.Errorf("isolated subagents require a commit at HEAD: %w", err)
+	}
+	// The subagent starts from the parent's working tree, not its last
+	// commit. stash create records it without touching the parent's tree or
+	// stash list, and prints nothing when there is nothing to record.
+	if snap, err := gitOut(ctx, top, nil, "stash", "create", "kilroy subagent base"); err != nil {
+		return nil, err
+	} else if strings.TrimSpace(snap) != "" {
+		base = snap
+	}
+	rel, err := filepath.Rel(top, parentDir)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		rel = "."
+	}
+	if real, rerr := filepath.EvalSymlinks(parentDir); rerr == nil {
+		if r, err := filepath.Rel(top, real); err == nil && !strings.HasPrefix(r, "..") {
+			rel = r
+		}
+	}
+	dir, err := os.MkdirTemp("", "kilroy-subagent-*")
+	if err != nil {
+		return nil, err
+	}
+	wt := &subagentWorktree{repoRoot: top, dir: dir, rel: rel, base: strings.TrimSpace(base)}
+	if _, err := gitOut(ctx, top, nil, "worktree", "add", "--detach", dir, wt.base); err != nil {
+		_ = os.RemoveAll(dir)
+		return nil, err
+	}
+	return wt, nil
+}
+
+// workDir is where the subagent runs: the parent's working directory mapped
+// into the worktree.
+func (w *subagentWorktree) workDir() string {
+	return filepath.Join(w.dir, w.rel)
+}
+
+// commitPending commits anything the subagent left uncommitted so that its
+// work is fully described by base..HEAD.
+func (w *subagentWorktree) commitPending(ctx context.Context, message string) error {
+	if _, err := gitOut(ctx, w.dir, nil, "add", "-A"); err != nil {
+		return err
+	}
+	status, err := gitOut(ctx, w.dir, nil, "status", "--porcelain")
+	if err != nil || strings.TrimSpace(status) == "" {
+		return err
+	}
+	_, err = gitOut(ctx, w.dir, nil, "-c", "user.name=kilroy-subagent", "-c", "user.email=kilroy-subagent@localhost",
+		"commit", "--no-verify", "-q", "-m", message)
+	return err
+}
+
+type subagentCommit struct {
+	SHA     string `json:"sha"`
+	Subject string `json:"subject"`
+}
+
+// changes reports the subagent's commits since base together with the
+// combined diff.
+func (w *subagentWorktree) changes(ctx context.Context) ([]subagentCommit, string, string, error) {
+	log, err := gitOut(ctx, w.dir, nil, "log", "--reverse", "--format=%H%x09%s", w.base+"..HEAD")
+	if err != nil {
+		return nil, "", "", err
+	}
+	commits := []subagentCommit{}
+	for _, line := range strings.Split(strings.TrimSpace(log), "\n") {
+		sha, subject, ok := strings.Cut(line, "\t")
+		if ok {
+			commits = append(commits, subagentCommit{SHA: sha, Subject: subject})
+		}
+	}
+	stat, err := gitOut(ctx, w.dir, nil, "diff", "--stat", w.base, "HEAD")
+	if err != nil {
+		return nil, "", "", err
+	}
+	diff, err := gitOut(ctx, w.dir, nil, "diff", w.base, "HEAD")
+	if err != nil {
+		return nil, "", "", err
+	}
+	return commits, strings.TrimSpace(stat), diff, nil
+}
+
+// applyTo applies the given revision ranges (each "from..to") to the parent's
+// working tree, optionally restricted to paths relative to the parent's
+// working directory. The parent's index is left alone. When a range's patch
+// no longer applies because the parent has edited the same files since, each
+// file is merged with git merge-file and conflicts are left as markers.
+func (w *subagentWorktree) applyTo(ctx context.Context, ranges [][2]string, paths []string) error {
+	var pathspec []string
+	for _, p := range paths {
+		if !filepath.IsAbs(p) {
+			p = filepath.Join(w.rel, p)
+		} else if r, err := filepath.Rel(w.repoRoot, p); err == nil {
+			p = r
+		}
+		pathspec = append(pathspec, filepath.ToSlash(p))
+	}
+	for _, rg := range ranges {
+		args := []string{"diff", "--binary", rg[0], rg[1]}
+		if len(pathspec) > 0 {
+			args = append(append(args, "--"), pathspec...)
+		}
+		patch, err := gitOut(ctx, w.dir, nil, args...)
+		if err != nil {
+			return err
+		}
+		if strings.TrimSpace(patch) == "" {
+			continue
+		}
+		if _, err := gitOut(ctx, w.repoRoot, strings.NewReader(patch), "apply", "--whitespace=nowarn"); err == nil {
+			continue
+		}
+		conflicts, err := w.mergeFiles(ctx, rg, pathspec)
+		if err != nil {
+			return fmt.Errorf("merge of %s..%s: %w", shortSHA(rg[0]), shortSHA(rg[1]), err)
+		}
+		if len(conflicts) > 0 {
+			return fmt.Errorf("merge of %s..%s did not apply cleanly (resolve the conflicts in the working tree): %s",
+				shortSHA(rg[0]), shortSHA(rg[1]), strings.Join(conflicts, ", "))
+		}
+	}
+	return nil
+}
+
+// mergeFiles three-way merges each file changed in rg into the parent's
+// working tree, with rg[0] as the merge base. It returns the files it could
+// not merge cleanly.
+func (w *subagentWorktree) mergeFiles(ctx context.Context, rg [2]string, pathspec []string) ([]string, error) {
+	args := []string{"diff", "--name-only", "--no-renames", "-z", rg[0], rg[1]}
+	if len(pathspec) > 0 {
+		args = append(append(args, "--"), pathspec...)
+	}
+	names, err := gitOut(ctx, w.dir, nil, args...)
+	if err != nil {
+		return nil, err
+	}
+	var conflicts []string
+	for _, name := range strings.Split(strings.TrimRight(names, "\x00"), "\x00") {
+		if name == "" {
+			continue
+		}
+		base, hasBase := w.blob(ctx, rg[0], name)
+		theirs, hasTheirs := w.blob(ctx, rg[1], name)
+		target := filepath.Join(w.repoRoot, filepath.FromSlash(name))
+		ours, err := os.ReadFile(target)
+		hasOurs := err == nil
+		switch {
+		case hasOurs && hasTheirs && bytes.Equal(ours, theirs):
+			// Already there.
+		case !hasTheirs:
+			// Deleted by the subagent: only drop a file the parent left as it was.
+			if hasOurs && !bytes.Equal(ours, base) {
+				conflicts = append(conflicts, name+" (deleted by the subagent, edited here)")
+			} else if hasOurs {
+				if err := os.Remove(target); err != nil {
+					return nil, err
+				}
+			}
+		case !hasOurs && hasBase:
+			conflicts = append(conflicts, name+" (edited by the subagent, deleted here)")
+		case !hasOurs || bytes.Equal(ours, base):
+			if err := writeMergedFile(target, theirs); err != nil {
+				return nil, err
+			}
+		default:
+			ok, err := w.mergeFile(ctx, target, base, theirs)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", name, err)
+			}
+			if !ok {
+				conflicts = append(conflicts, name)
+			}
+		}
+	}
+	return conflicts, nil
+}
+
+// blob returns the content of path at rev in the worktree's repository.
+func (w *subagentWorktree) blob(ctx context.Context, rev, path string) ([]byte, bool) {
+	out, err := gitOut(ctx, w.dir, nil, "show", rev+":"+path)
+	if err != nil {
+		return nil, false
+	}
+	return []byte(out), true
+}
+
+// mergeFile runs git merge-file on target, which holds the parent's version,
+// and reports whether the merge was free of conflicts.
+func (w *subagentWorktree) mergeFile(ctx context.Context, target string, base, theirs []byte) (bool, error) {
+	tmp, err := os.MkdirTemp("", "kilroy-merge-*")
+	if err != nil {
+		return false, err
+	}
+	defer func() { _ = os.RemoveAll(tmp) }()
+	basePath, theirsPath := filepath.Join(tmp, "base"), filepath.Join(tmp, "theirs")
+	if err := os.WriteFile(basePath, base, 0o600); err != nil {
+		return false, err
+	}
+	if err := os.WriteFile(theirsPath, theirs, 0o600); err != nil {
+		return false, err
+	}
+	cmd := exec.CommandContext(ctx, "git", "merge-file", "-L", "working tree", "-L", "base", "-L", "subagent", target, basePath, theirsPath)
+	cmd.Dir = w.repoRoot
+	out, err := cmd.CombinedOutput()
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil:
+		return true, nil
+	case errors.As(err, &exitErr) && exitErr.ExitCode() > 0 && exitErr.ExitCode() < 128:
+		// The exit code is the number of conflicts.
+		return false, nil
+	default:
+		return false, fmt.Errorf("git merge-file: %w: %s", err, strings.TrimSpace(string(out)))
+	}
+}
+
+func writeMergedFile(path string, content []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	mode := os.FileMode(0o644)
+	if fi, err := os.Stat(path); err == nil {
+		mode = fi.Mode().Perm()
+	}
+	return os.WriteFile(path, content, mode)
+}
+
+func (w *subagentWorktree) remove() {
+	ctx := context.Background()
+	if _, err := gitOut(ctx, w.repoRoot, nil, "worktree", "remove", "--force", w.dir); err != nil {
+		_ = os.RemoveAll(w.dir)
+		_, _ = gitOut(ctx, w.repoRoot, nil, "worktree", "prune")
+	}
+}
+
+func gitOut(ctx context.Context, dir string, stdin *strings.Reader, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	if stdin != nil {
+		cmd.Stdin = stdin
+	}
+	var out, stderr bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return out.String() + stderr.String(), fmt.Errorf("git %s: %w: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return out.String(), nil
+}
+
+func shortSHA(sha string) string {
+	if len(sha) > 12 {
+		return sha[:12]
+	}
+	return sha
+}
+
+// isolatedWaitResult finalizes an isolated subagent's turn and describes its
+// changes for the parent.
+func (a *subagent) isolatedWaitResult(ctx context.Context) (string, error) {
+	if err := a.wt.commitPending(ctx, "subagent "+a.id+": "+firstLine(a.task)); err != nil {
+		return "", err
+	}
+	commits, stat, diff, err := a.wt.changes(ctx)
+	if err != nil {
+		return "", err
+	}
+	b, _ := json.Marshal(map[string]any{
+		"result":    a.result,
+		"worktree":  a.wt.workDir(),
+		"base":      a.wt.base,
+		"commits":   commits,
+		"diff_stat": stat,
+		"diff":      diff,
+	})
+	return string(b), nil
+}
+
+func firstLine(s string) string {
+	s = strings.TrimSpace(s)
+	if i := strings.IndexByte(s, '\n'); i >= 0 {
+		s = s[:i]
+	}
+	if len(s) > 72 {
+		s = s[:72]
+	}
+	return s
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"strings"
 	"sync"
 	"time"
 )
@@ -11,6 +12,8 @@ import (
 type subagent struct {
 	id   string
 	sess *Session
+	task string
+	wt   *subagentWorktree // non-nil for isolated subagents
 
 	mu      sync.Mutex
 	running bool
@@ -19,7 +22,18 @@ type subagent struct {
 	err     error
 }
 
-func (s *Session) spawnAgent(ctx context.Context, task string) (any, error) {
+// spawnOptions are spawn_agent's optional overrides. Zero values inherit
+// from the parent session.
+type spawnOptions struct {
+	Isolated        bool
+	Provider        string
+	Model           string
+	ReasoningEffort string
+	Tools           []string
+	MaxTurns        int
+}
+
+func (s *Session) spawnAgent(ctx context.Context, task string, opts spawnOptions) (any, error) {
 	s.mu.Lock()
 	depth := s.depth
 	maxDepth := s.cfg.MaxSubagentDepth
@@ -29,8 +43,75 @@ func (s *Session) spawnAgent(ctx context.Context, task string) (any, error) {
 	}
 
 	subProfile := s.profile
-	subSess, err := NewSession(s.client, subProfile, s.env, s.cfg)
+	if opts.Provider != "" || opts.Model != "" {
+		var err error
+		if s.cfg.ResolveSubagentProfile != nil {
+			subProfile, err = s.cfg.ResolveSubagentProfile(opts.Provider, opts.Model)
+		} else {
+			subProfile, err = NewProfileForFamily(firstNonEmptyString(opts.Provider, s.profile.ID()), firstNonEmptyString(opts.Model, s.profile.Model()))
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+	subCfg := s.cfg
+	subCfg.MCPServers = nil
+	subCfg.StatusReporter = nil
+	subCfg.JournalPath = ""
+	subCfg.ResumeHistory = nil
+	if opts.ReasoningEffort != "" {
+		subCfg.ReasoningEffort = opts.ReasoningEffort
+	}
+	if opts.MaxTurns > 0 {
+		subCfg.MaxTurns = opts.MaxTurns
+	}
+	if len(opts.Tools) > 0 {
+		if len(s.cfg.ToolAllowlist) > 0 {
+			parent := map[string]bool{}
+			for _, n := range s.cfg.ToolAllowlist {
+				parent[strings.TrimSpace(n)] = true
+			}
+			for _, n := range opts.Tools {
+				if !parent[n] {
+					return "", fmt.Errorf("tool %q is not available to this agent", n)
+				}
+			}
+		}
+		subCfg.ToolAllowlist = opts.Tools
+	}
+
+	subEnv := s.env
+	var wt *subagentWorktree
+	if opts.Isolated {
+		if !s.cfg.SubagentWorktrees {
+			return "", fmt.Errorf("isolated subagents are not enabled for this session (subagent_worktrees)")
+		}
+		rootable, ok := s.env.(RootableEnvironment)
+		if !ok {
+			return "", fmt.Errorf("isolated subagents are not supported by this execution environment")
+		}
+		var err error
+		if wt, err = newSubagentWorktree(ctx, s.env.WorkingDirectory()); err != nil {
+			return "", err
+		}
+		subEnv = rootable.WithRootDir(wt.workDir())
+	}
+
+	// A subagent in the parent's worktree shares its language servers; one
+	// in its own worktree starts servers rooted there.
+	var sharedLSP *lspSet
+	if wt == nil {
+		subCfg.LSPServers = nil
+		if sharedLSP = s.lsp; sharedLSP == nil {
+			sharedLSP = s.sharedLSP
+		}
+	}
+
+	subSess, err := newSession(s.client, subProfile, subEnv, subCfg, append(append([]*mcpClient{}, s.mcpClients...), s.sharedMCP...), sharedLSP)
 	if err != nil {
+		if wt != nil {
+			wt.remove()
+		}
 		return "", err
 	}
 	subSess.depth = depth + 1
@@ -38,6 +119,8 @@ func (s *Session) spawnAgent(ctx context.Context, task string) (any, error) {
 	sub := &subagent{
 		id:   subSess.id,
 		sess: subSess,
+		task: task,
+		wt:   wt,
 		done: make(chan struct{}),
 	}
 
@@ -45,12 +128,38 @@ func (s *Session) spawnAgent(ctx context.Context, task string) (any, error) {
 	s.subagents[sub.id] = sub
 	s.mu.Unlock()
 
+	go s.forwardSubagentUsage(sub.id, subSess)
 	go sub.run(ctx, task)
 
-	b, _ := json.Marshal(map[string]any{"agent_id": sub.id})
+	resp := map[string]any{"agent_id": sub.id, "provider": subProfile.ID(), "model": subProfile.Model()}
+	if wt != nil {
+		resp["worktree"] = wt.workDir()
+	}
+	b, _ := json.Marshal(resp)
 	return string(b), nil
 }
 
+// forwardSubagentUsage drains a subagent's events, re-emitting its LLM usage
+// (and that of its own subagents) on the parent as SUBAGENT_USAGE so token
+// accounting covers the whole agent tree.
+func (s *Session) forwardSubagentUsage(agentID string, sub *Session) {
+	for ev := range sub.Events() {
+		switch ev.Kind {
+		case EventAssistantTextEnd:
+			s.emit(EventSubagentUsage, map[string]any{
+				"agent_id":      agentID,
+				"provider":      ev.Data["provider"],
+				"model":         ev.Data["model"],
+				"input_tokens":  ev.Data["input_tokens"],
+				"output_tokens": ev.Data["output_tokens"],
+				"total_tokens":  ev.Data["total_tokens"],
+			})
+		case EventSubagentUsage:
+			s.emit(EventSubagentUsage, ev.Data)
+		}
+	}
+}
+
 func (s *Session) sendInput(ctx context.Context, agentID string, input string) (any, error) {
 	sub := s.getSub(agentID)
 	if sub == nil {
@@ -100,9 +209,72 @@ func (s *Session) waitAgent(ctx context.Context, agentID string, timeoutMS int)
 	if sub.err != nil {
 		return sub.result, sub.err
 	}
+	if sub.wt != nil {
+		return sub.isolatedWaitResult(ctx)
+	}
 	return sub.result, nil
 }
 
+// mergeAgent brings an isolated subagent's work into the parent's working
+// tree. "accept" applies everything since the worktree was created,
+// "cherry_pick" applies only the listed commits and keeps the subagent
+// alive, and "reject" discards the work. accept and reject close the
+// subagent and remove its worktree.
+func (s *Session) mergeAgent(ctx context.Context, agentID string, action string, commits []string, paths []string) (any, error) {
+	sub := s.getSub(agentID)
+	if sub == nil {
+		return "", fmt.Errorf("unknown agent_id: %s", agentID)
+	}
+	if sub.wt == nil {
+		return "", fmt.Errorf("agent %s is not isolated; its edits are already in the shared working tree", agentID)
+	}
+	sub.mu.Lock()
+	running := sub.running
+	sub.mu.Unlock()
+	if running {
+		return "", fmt.Errorf("agent is still running; wait for it first")
+	}
+	if action != "reject" {
+		if err := sub.wt.commitPending(ctx, "subagent "+sub.id+": "+firstLine(sub.task)); err != nil {
+			return "", err
+		}
+	}
+
+	switch action {
+	case "accept":
+		if err := sub.wt.applyTo(ctx, [][2]string{{sub.wt.base, "HEAD"}}, paths); err != nil {
+			return "", err
+		}
+	case "cherry_pick":
+		if len(commits) == 0 {
+			return "", fmt.Errorf("cherry_pick requires commits")
+		}
+		var ranges [][2]string
+		for _, c := range commits {
+			sha, err := gitOut(ctx, sub.wt.dir, nil, "rev-parse", "--verify", c+"^{commit}")
+			if err != nil {
+				return "", fmt.Errorf("unknown commit %q", c)
+			}
+			sha = strings.TrimSpace(sha)
+			ranges = append(ranges, [2]string{sha + "^", sha})
+		}
+		if err := sub.wt.applyTo(ctx, ranges, paths); err != nil {
+			return "", err
+		}
+		return "cherry-picked", nil
+	case "reject":
+	default:
+		return "", fmt.Errorf("unknown action %q (accept|reject|cherry_pick)", action)
+	}
+	if _, err := s.closeAgent(agentID); err != nil {
+		return "", err
+	}
+	if action == "accept" {
+		return "accepted", nil
+	}
+	return "rejected", nil
+}
+
 func (s *Session) closeAgent(agentID string) (any, error) {
 	s.mu.Lock()
 	sub := s.subagents[agentID]
@@ -112,6 +284,9 @@ func (s *Session) closeAgent(agentID string) (any, error) {
 		return "", fmt.Errorf("unknown agent_id: %s", agentID)
 	}
 	sub.sess.Close()
+	if sub.wt != nil {
+		sub.wt.remove()
+	}
 	return "closed", nil
 }
 
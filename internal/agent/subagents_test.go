@@ -0,0 +1,313 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/danshapiro/kilroy/internal/llm"
+)
+
+// writerStep answers "write <file>" tasks with a write_file call and finishes
+// once the tool result comes back, regardless of which subagent is asking.
+func writerStep(req llm.Request) llm.Response {
+	last := req.Messages[len(req.Messages)-1]
+	if last.Role == llm.RoleTool {
+		return llm.Response{Message: llm.Assistant("wrote it")}
+	}
+	name := strings.TrimPrefix(strings.TrimSpace(last.Text()), "write ")
+	args, _ := json.Marshal(map[string]any{"file_path": name, "content": "from " + name + "\n"})
+	call := llm.ToolCallData{ID: "w-" + name, Name: "write_file", Arguments: args, Type: "function"}
+	return llm.Response{Message: llm.Message{Role: llm.RoleAssistant, Content: []llm.ContentPart{{Kind: llm.ContentToolCall, ToolCall: &call}}}}
+}
+
+func TestSession_IsolatedSubagents_WorktreeDiffAndMergeBack(t *testing.T) {
+	dir := t.TempDir()
+	initGitRepo(t, dir)
+
+	c := llm.NewClient()
+	f := &fakeAdapter{name: "openai"}
+	for i := 0; i < 12; i++ {
+		f.steps = append(f.steps, writerStep)
+	}
+	c.Register(f)
+	sess, err := NewSession(c, NewOpenAIProfile("gpt-5.4"), NewLocalExecutionEnvironment(dir), SessionConfig{SubagentWorktrees: true})
+	if err != nil {
+		t.Fatalf("NewSession: %v", err)
+	}
+	defer sess.Close()
+	ctx := context.Background()
+	call := func(name string, args map[string]any) ToolExecResult {
+		t.Helper()
+		b, _ := json.Marshal(args)
+		return sess.reg.ExecuteCall(ctx, sess.env, llm.ToolCallData{ID: name, Name: name, Arguments: b})
+	}
+
+	spawned := map[string]struct{ id, worktree string }{}
+	for _, file := range []string{"a.txt", "b.txt", "c.txt"} {
+		res := call("spawn_agent", map[string]any{"task": "write " + file})
+		var out struct {
+			AgentID  string `json:"agent_id"`
+			Worktree string `json:"worktree"`
+		}
+		if res.IsError || json.Unmarshal([]byte(res.Output), &out) != nil || out.Worktree == "" {
+			t.Fatalf("spawn_agent: %+v", res)
+		}
+		spawned[file] = struct{ id, worktree string }{out.AgentID, out.Worktree}
+	}
+
+	commits := map[string]string{}
+	for file, sub := range spawned {
+		res := call("wait", map[string]any{"agent_id": sub.id, "timeout_ms": 5000})
+		var out struct {
+			Result  string           `json:"result"`
+			Commits []subagentCommit `json:"commits"`
+			Diff    string           `json:"diff"`
+		}
+		if res.IsError || json.Unmarshal([]byte(res.FullOutput), &out) != nil {
+			t.Fatalf("wait %s: %+v", file, res)
+		}
+		if out.Result != "wrote it" || len(out.Commits) != 1 || !strings.Contains(out.Diff, "+from "+file) {
+			t.Fatalf("wait %s: %+v", file, out)
+		}
+		commits[file] = out.Commits[0].SHA
+		if _, err := os.Stat(filepath.Join(dir, file)); err == nil {
+			t.Fatalf("%s leaked into the parent's working tree before merge", file)
+		}
+	}
+
+	if res := call("merge_agent", map[string]any{"agent_id": spawned["a.txt"].id, "action": "accept"}); res.IsError {
+		t.Fatalf("accept: %s", res.Output)
+	}
+	if res := call("merge_agent", map[string]any{"agent_id": spawned["b.txt"].id, "action": "cherry_pick", "commits": []string{commits["b.txt"]}}); res.IsError {
+		t.Fatalf("cherry_pick: %s", res.Output)
+	}
+	if res := call("merge_agent", map[string]any{"agent_id": spawned["c.txt"].id, "action": "reject"}); res.IsError {
+		t.Fatalf("reject: %s", res.Output)
+	}
+	for file, want := range map[string]bool{"a.txt": true, "b.txt": true, "c.txt": false} {
+		_, err := os.Stat(filepath.Join(dir, file))
+		if (err == nil) != want {
+			t.Fatalf("%s in parent after merges: exists=%v want %v", file, err == nil, want)
+		}
+	}
+	for file, closed := range map[string]bool{"a.txt": true, "b.txt": false, "c.txt": true} {
+		if _, err := os.Stat(spawned[file].worktree); (err != nil) != closed {
+			t.Fatalf("%s worktree removed=%v want %v", file, err != nil, closed)
+		}
+	}
+
+	sess.Close()
+	if _, err := os.Stat(spawned["b.txt"].worktree); err == nil {
+		t.Fatalf("Close should remove remaining subagent worktrees")
+	}
+}
+
+func TestSubagentWorktree_StartsFromUncommittedWorkAndMergesIntoUnstagedEdits(t *testing.T) {
+	repo := t.TempDir()
+	initGitRepo(t, repo)
+	git := func(args ...string) string {
+		t.Helper()
+		out, err := gitOut(context.Background(), repo, nil, args...)
+		if err != nil {
+			t.Fatalf("git %v: %v", args, err)
+		}
+		return out
+	}
+	pkg := filepath.Join(repo, "pkg")
+	if err := os.MkdirAll(pkg, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	lines := make([]string, 20)
+	for i := range lines {
+		lines[i] = fmt.Sprintf("line %d", i+1)
+	}
+	write := func(path string, lines []string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	edit := func(i int, s string) []string {
+		out := append([]string(nil), lines...)
+		out[i-1] = s
+		return out
+	}
+	write(filepath.Join(pkg, "f.txt"), lines)
+	git("add", "-A")
+	git("commit", "-q", "-m", "f")
+
+	// Uncommitted parent work is visible to the subagent.
+	lines = edit(1, "parent line 1")
+	write(filepath.Join(pkg, "f.txt"), lines)
+	ctx := context.Background()
+	wt, err := newSubagentWorktree(ctx, pkg)
+	if err != nil {
+		t.Fatalf("newSubagentWorktree: %v", err)
+	}
+	defer wt.remove()
+	if b, _ := os.ReadFile(filepath.Join(wt.workDir(), "f.txt")); !strings.HasPrefix(string(b), "parent line 1\n") {
+		t.Fatalf("worktree does not start from the parent's working tree:\n%s", b)
+	}
+
+	// The subagent changes line 20 and adds a file; meanwhile the parent,
+	// without staging, edits line 17, inside the patch's context.
+	write(filepath.Join(wt.workDir(), "f.txt"), edit(20, "subagent line 20"))
+	write(filepath.Join(wt.workDir(), "new.txt"), []string{"new"})
+	write(filepath.Join(wt.workDir(), "skipped.txt"), []string{"skipped"})
+	if err := wt.commitPending(ctx, "sub"); err != nil {
+		t.Fatal(err)
+	}
+	lines = edit(17, "parent line 17")
+	write(filepath.Join(pkg, "f.txt"), lines)
+
+	if err := wt.applyTo(ctx, [][2]string{{wt.base, "HEAD"}}, []string{"f.txt", "new.txt"}); err != nil {
+		t.Fatalf("applyTo: %v", err)
+	}
+	b, _ := os.ReadFile(filepath.Join(pkg, "f.txt"))
+	for _, want := range []string{"parent line 1\n", "parent line 17\n", "subagent line 20\n"} {
+		if !strings.Contains(string(b), want) {
+			t.Fatalf("merged f.txt lacks %q:\n%s", want, b)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(pkg, "new.txt")); err != nil {
+		t.Fatalf("new.txt not merged: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(pkg, "skipped.txt")); err == nil {
+		t.Fatalf("skipped.txt merged despite the paths filter")
+	}
+	if staged := git("diff", "--cached", "--name-only"); strings.TrimSpace(staged) != "" {
+		t.Fatalf("merge staged changes in the parent's index: %s", staged)
+	}
+
+	// Both sides editing the same line leaves conflict markers.
+	write(filepath.Join(pkg, "f.txt"), edit(20, "parent line 20"))
+	err = wt.applyTo(ctx, [][2]string{{wt.base, "HEAD"}}, []string{"f.txt"})
+	if err == nil || !strings.Contains(err.Error(), "pkg/f.txt") {
+		t.Fatalf("expected a conflict on pkg/f.txt, got %v", err)
+	}
+	if b, _ := os.ReadFile(filepath.Join(pkg, "f.txt")); !strings.Contains(string(b), "<<<<<<< working tree") {
+		t.Fatalf("no conflict markers:\n%s", b)
+	}
+}
+
+func TestSession_MergeAgent_RejectsSharedSubagent(t *testing.T) {
+	dir := t.TempDir()
+	c := llm.NewClient()
+	c.Register(&fakeAdapter{name: "openai"})
+	sess, err := NewSession(c, NewOpenAIProfile("gpt-5.4"), NewLocalExecutionEnvironment(dir), SessionConfig{})
+	if err != nil {
+		t.Fatalf("NewSession: %v", err)
+	}
+	defer sess.Close()
+	for _, d := range sess.reg.Definitions() {
+		if d.Name == "merge_agent" {
+			t.Fatalf("merge_agent registered without subagent_worktrees")
+		}
+	}
+	if _, err := sess.spawnAgent(context.Background(), "x", spawnOptions{Isolated: true}); err == nil || !strings.Contains(err.Error(), "not enabled") {
+		t.Fatalf("isolated spawn without subagent_worktrees: %v", err)
+	}
+	sess.cfg.SubagentWorktrees = true
+	if _, err := sess.spawnAgent(context.Background(), "x", spawnOptions{Isolated: true}); err == nil || !strings.Contains(err.Error(), "git repository") {
+		t.Fatalf("isolated spawn outside a repo: %v", err)
+	}
+	out, err := sess.spawnAgent(context.Background(), "x", spawnOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var spawned map[string]any
+	_ = json.Unmarshal([]byte(fmt.Sprint(out)), &spawned)
+	if _, err := sess.mergeAgent(context.Background(), fmt.Sprint(spawned["agent_id"]), "accept", nil, nil); err == nil || !strings.Contains(err.Error(), "not isolated") {
+		t.Fatalf("merge of shared subagent: %v", err)
+	}
+}
+
+func TestSession_SpawnAgent_ModelToolScopeAndUsageRollup(t *testing.T) {
+	c := llm.NewClient()
+	var subReq llm.Request
+	f := &fakeAdapter{name: "openai", steps: []func(req llm.Request) llm.Response{
+		func(req llm.Request) llm.Response {
+			subReq = req
+			return llm.Response{Message: llm.Assistant("found it"), Usage: llm.Usage{InputTokens: 7, OutputTokens: 3, TotalTokens: 10}}
+		},
+	}}
+	c.Register(f)
+	var resolved []string
+	sess, err := NewSession(c, NewOpenAIProfile("gpt-5.4"), NewLocalExecutionEnvironment(t.TempDir()), SessionConfig{
+		ResolveSubagentProfile: func(provider, model string) (ProviderProfile, error) {
+			resolved = append(resolved, provider+"/"+model)
+			if model != "gpt-5.4-mini" {
+				return nil, fmt.Errorf("model %q not in catalog", model)
+			}
+			return NewOpenAIProfile(model), nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewSession: %v", err)
+	}
+	defer sess.Close()
+	ctx := context.Background()
+
+	if _, err := sess.spawnAgent(ctx, "x", spawnOptions{Model: "nope"}); err == nil || !strings.Contains(err.Error(), "not in catalog") {
+		t.Fatalf("expected resolver rejection, got %v", err)
+	}
+	if _, err := sess.spawnAgent(ctx, "x", spawnOptions{Tools: []string{"read_file", "teleport"}}); err == nil || !strings.Contains(err.Error(), `unknown tool "teleport"`) {
+		t.Fatalf("expected unknown tool error, got %v", err)
+	}
+
+	out, err := sess.spawnAgent(ctx, "where is X defined?", spawnOptions{
+		Model: "gpt-5.4-mini", ReasoningEffort: "low", Tools: []string{"read_file", "grep", "glob"}, MaxTurns: 3,
+	})
+	if err != nil {
+		t.Fatalf("spawnAgent: %v", err)
+	}
+	var spawned map[string]any
+	_ = json.Unmarshal([]byte(fmt.Sprint(out)), &spawned)
+	id := fmt.Sprint(spawned["agent_id"])
+	if res, err := sess.waitAgent(ctx, id, 5000); err != nil || res != "found it" {
+		t.Fatalf("wait: %v %v", res, err)
+	}
+
+	var tools []string
+	for _, td := range subReq.Tools {
+		tools = append(tools, td.Name)
+	}
+	if subReq.Model != "gpt-5.4-mini" || subReq.ReasoningEffort == nil || *subReq.ReasoningEffort != "low" || strings.Join(tools, ",") != "read_file,grep,glob" {
+		t.Fatalf("subagent request: model=%q effort=%v tools=%v", subReq.Model, subReq.ReasoningEffort, tools)
+	}
+	if sys := subReq.Messages[0].Text(); strings.Contains(sys, "- shell:") || !strings.Contains(sys, "- grep:") {
+		t.Fatalf("system prompt should only list allowed tools:\n%s", sys)
+	}
+	sub := sess.getSub(id)
+	if res := sub.sess.reg.ExecuteCall(ctx, sub.sess.env, llm.ToolCallData{ID: "s", Name: "shell", Arguments: json.RawMessage(`{"command":"true"}`)}); !res.IsError {
+		t.Fatalf("shell must not be executable by a read-only scout: %+v", res)
+	}
+	if sub.sess.cfg.MaxTurns != 3 || len(resolved) != 2 || resolved[1] != "/gpt-5.4-mini" {
+		t.Fatalf("max_turns=%d resolved=%v", sub.sess.cfg.MaxTurns, resolved)
+	}
+	sub.sess.cfg.MaxSubagentDepth = 2
+	if _, err := sub.sess.spawnAgent(ctx, "y", spawnOptions{Tools: []string{"shell"}}); err == nil || !strings.Contains(err.Error(), "not available") {
+		t.Fatalf("a scoped agent must not grant its subagents more tools")
+	}
+
+	deadline := time.After(5 * time.Second)
+	for {
+		select {
+		case ev := <-sess.Events():
+			if ev.Kind == EventSubagentUsage {
+				if ev.Data["agent_id"] != id || ev.Data["model"] != "gpt-5.4-mini" || ev.Data["input_tokens"] != 7 || ev.Data["output_tokens"] != 3 {
+					t.Fatalf("usage event: %+v", ev.Data)
+				}
+				return
+			}
+		case <-deadline:
+			t.Fatalf("no SUBAGENT_USAGE event on the parent")
+		}
+	}
+}
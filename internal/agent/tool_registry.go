@@ -39,6 +39,19 @@ type ToolExecResult struct {
 	FullOutput string
 
 	IsError bool
+
+	// ImageData/ImageMediaType carry an image returned by the tool (MCP image
+	// content); adapters that support it send it alongside Output.
+	ImageData      []byte
+	ImageMediaType string
+}
+
+// ToolImageOutput is returned by tool executors whose result includes an
+// image. Text is the textual output seen by the model.
+type ToolImageOutput struct {
+	Text           string
+	ImageData      []byte
+	ImageMediaType string
 }
 
 type RegisteredTool struct {
@@ -142,11 +155,19 @@ func (r *ToolRegistry) ExecuteCall(ctx context.Context, env ExecutionEnvironment
 		if strings.TrimSpace(full) == "" {
 			full = fmt.Sprintf("%v", err)
 		}
-		return truncateResult(name, callID, full, true, t.Limit)
+		return withToolImage(truncateResult(name, callID, full, true, t.Limit), v)
 	}
 
 	full := toolValueToString(v)
-	return truncateResult(name, callID, full, false, t.Limit)
+	return withToolImage(truncateResult(name, callID, full, false, t.Limit), v)
+}
+
+func withToolImage(res ToolExecResult, v any) ToolExecResult {
+	if img, ok := v.(ToolImageOutput); ok {
+		res.ImageData = img.ImageData
+		res.ImageMediaType = img.ImageMediaType
+	}
+	return res
 }
 
 const circuitBreakerThreshold = 3
@@ -291,6 +312,8 @@ func toolValueToString(v any) string {
 		return x
 	case []byte:
 		return string(x)
+	case ToolImageOutput:
+		return x.Text
 	default:
 		b, err := json.MarshalIndent(v, "", "  ")
 		if err != nil {
@@ -0,0 +1,82 @@
+package agent
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/danshapiro/kilroy/internal/llm"
+)
+
+// applyToolAllowlist drops every registered tool that is not allowed and
+// scopes the profile so the model is only offered (and told about) the rest.
+func (s *Session) applyToolAllowlist(names []string) error {
+	allow := map[string]bool{}
+	s.reg.mu.Lock()
+	defer s.reg.mu.Unlock()
+	for _, n := range names {
+		n = strings.TrimSpace(n)
+		if n == "" {
+			continue
+		}
+		if _, ok := s.reg.tools[n]; !ok {
+			known := make([]string, 0, len(s.reg.tools))
+			for k := range s.reg.tools {
+				known = append(known, k)
+			}
+			sort.Strings(known)
+			return fmt.Errorf("tool allowlist: unknown tool %q (available: %s)", n, strings.Join(known, ", "))
+		}
+		allow[n] = true
+	}
+	for n := range s.reg.tools {
+		if !allow[n] {
+			delete(s.reg.tools, n)
+		}
+	}
+	s.extraToolDefs = filterToolDefs(s.extraToolDefs, allow)
+	s.profile = scopedProfile{ProviderProfile: s.profile, allow: allow}
+	return nil
+}
+
+func filterToolDefs(defs []llm.ToolDefinition, allow map[string]bool) []llm.ToolDefinition {
+	var out []llm.ToolDefinition
+	for _, d := range defs {
+		if allow[d.Name] {
+			out = append(out, d)
+		}
+	}
+	return out
+}
+
+// scopedProfile hides tools outside an allowlist from a profile's tool
+// definitions and from the "Tools:" section of its system prompt.
+type scopedProfile struct {
+	ProviderProfile
+	allow map[string]bool
+}
+
+func (p scopedProfile) ToolDefinitions() []llm.ToolDefinition {
+	return filterToolDefs(p.ProviderProfile.ToolDefinitions(), p.allow)
+}
+
+func (p scopedProfile) BuildSystemPrompt(env EnvironmentInfo, docs []ProjectDoc) string {
+	sys := p.ProviderProfile.BuildSystemPrompt(env, docs)
+	head, rest, ok := strings.Cut(sys, "Tools:\n")
+	if !ok {
+		return sys
+	}
+	var b strings.Builder
+	b.WriteString(head)
+	b.WriteString("Tools:\n")
+	lines := strings.SplitAfter(rest, "\n")
+	i := 0
+	for ; i < len(lines) && strings.HasPrefix(lines[i], "- "); i++ {
+		name, _, _ := strings.Cut(strings.TrimPrefix(lines[i], "- "), ":")
+		if p.allow[name] {
+			b.WriteString(lines[i])
+		}
+	}
+	b.WriteString(strings.Join(lines[i:], ""))
+	return b.String()
+}
@@ -0,0 +1,107 @@
+package dot
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/danshapiro/kilroy/internal/attractor/model"
+)
+
+// Format serializes a parsed graph back to DOT. Every node and edge is
+// written with its fully resolved attributes (scope defaults and subgraph
+// classes are flattened), so Parse(Format(g)) yields an equivalent graph.
+// Comments and original layout are not preserved.
+func Format(g *model.Graph) []byte {
+	var b strings.Builder
+	b.WriteString("digraph ")
+	b.WriteString(g.Name)
+	b.WriteString(" {\n")
+	if len(g.Attrs) > 0 {
+		b.WriteString("  graph ")
+		writeAttrs(&b, g.Attrs)
+		b.WriteString("\n")
+	}
+
+	nodes := make([]*model.Node, 0, len(g.Nodes))
+	for _, n := range g.Nodes {
+		nodes = append(nodes, n)
+	}
+	sort.SliceStable(nodes, func(i, j int) bool {
+		if nodes[i].Order != nodes[j].Order {
+			return nodes[i].Order < nodes[j].Order
+		}
+		return nodes[i].ID < nodes[j].ID
+	})
+	for _, n := range nodes {
+		attrs := n.Attrs
+		if classes := n.ClassList(); len(classes) > 0 {
+			attrs = make(map[string]string, len(n.Attrs)+1)
+			for k, v := range n.Attrs {
+				attrs[k] = v
+			}
+			attrs["class"] = strings.Join(classes, ",")
+		}
+		b.WriteString("  ")
+		b.WriteString(n.ID)
+		if len(attrs) > 0 {
+			b.WriteString(" ")
+			writeAttrs(&b, attrs)
+		}
+		b.WriteString("\n")
+	}
+
+	for _, e := range g.Edges {
+		b.WriteString("  ")
+		b.WriteString(e.From)
+		b.WriteString(" -> ")
+		b.WriteString(e.To)
+		if len(e.Attrs) > 0 {
+			b.WriteString(" ")
+			writeAttrs(&b, e.Attrs)
+		}
+		b.WriteString("\n")
+	}
+	b.WriteString("}\n")
+	return []byte(b.String())
+}
+
+func writeAttrs(b *strings.Builder, attrs map[string]string) {
+	keys := make([]string, 0, len(attrs))
+	for k := range attrs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	b.WriteByte('[')
+	for i, k := range keys {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString(k)
+		b.WriteString("=")
+		b.WriteString(quote(attrs[k]))
+	}
+	b.WriteByte(']')
+}
+
+// quote produces a string literal that lexString decodes back to s.
+func quote(s string) string {
+	var b strings.Builder
+	b.Grow(len(s) + 2)
+	b.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '"':
+			b.WriteString(`\"`)
+		case '\\':
+			b.WriteString(`\\`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\t':
+			b.WriteString(`\t`)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
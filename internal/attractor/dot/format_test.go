@@ -0,0 +1,67 @@
+package dot
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFormat_RoundTripsResolvedAttributes(t *testing.T) {
+	src := []byte(`
+digraph RoundTrip {
+    graph [goal="Ship \"it\"", model_stylesheet="* { llm_model: gpt-5.4; }"]
+    node [shape=box, timeout=900s]
+
+    start [shape=Mdiamond]
+    exit  [shape=Msquare]
+
+    subgraph cluster_review {
+        label="Review Loop"
+        node [fidelity=full]
+        review [prompt="Line one\nLine two with C:\\path and \t tab"]
+    }
+
+    start -> review [label="go"]
+    review -> exit [condition="outcome=success"]
+    review -> review [condition="outcome=fail", loop_restart=true]
+}
+`)
+	g, err := Parse(src)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	out := Format(g)
+	g2, err := Parse(out)
+	if err != nil {
+		t.Fatalf("Parse(Format): %v\n%s", err, out)
+	}
+
+	if g2.Name != g.Name || !reflect.DeepEqual(g2.Attrs, g.Attrs) {
+		t.Fatalf("graph mismatch: %q %v vs %q %v", g2.Name, g2.Attrs, g.Name, g.Attrs)
+	}
+	for id, n := range g.Nodes {
+		n2 := g2.Nodes[id]
+		if n2 == nil {
+			t.Fatalf("node %s lost", id)
+		}
+		if n2.Order != n.Order || !reflect.DeepEqual(n2.ClassList(), n.ClassList()) {
+			t.Fatalf("node %s order/classes: %d %v vs %d %v", id, n2.Order, n2.ClassList(), n.Order, n.ClassList())
+		}
+		for k, v := range n.Attrs {
+			if n2.Attrs[k] != v {
+				t.Fatalf("node %s attr %s: %q vs %q", id, k, n2.Attrs[k], v)
+			}
+		}
+	}
+	if len(g2.Edges) != len(g.Edges) {
+		t.Fatalf("edges: %d vs %d", len(g2.Edges), len(g.Edges))
+	}
+	for i, e := range g.Edges {
+		e2 := g2.Edges[i]
+		if e2.From != e.From || e2.To != e.To || !reflect.DeepEqual(e2.Attrs, e.Attrs) {
+			t.Fatalf("edge %d: %+v vs %+v", i, e2, e)
+		}
+	}
+	if got := g2.Nodes["review"].Attrs["prompt"]; got != "Line one\nLine two with C:\\path and \t tab" {
+		t.Fatalf("prompt escaping: %q", got)
+	}
+}
@@ -24,6 +24,7 @@ import (
 	"github.com/danshapiro/kilroy/internal/llm"
 	"github.com/danshapiro/kilroy/internal/llmclient"
 	"github.com/danshapiro/kilroy/internal/modelmeta"
+	"github.com/danshapiro/kilroy/internal/telemetry"
 )
 
 type CodergenRouter struct {
@@ -192,12 +193,17 @@ func (r *CodergenRouter) runAPI(ctx context.Context, execCtx *Execution, node *m
 				warnEngine(execCtx, fmt.Sprintf("write api_request.json: %v", err))
 			}
 			policy := attractorLLMRetryPolicy(execCtx, node.ID, prov, mid)
+			llmCtx, llmSpan := telemetry.StartLLMRequest(ctx, req)
+			attempts := 0
 			resp, err := llm.Retry(ctx, policy, nil, nil, func() (llm.Response, error) {
-				return client.Complete(ctx, req)
+				attempts++
+				return client.Complete(llmCtx, req)
 			})
+			telemetry.EndLLMRequest(llmSpan, resp, attempts, err)
 			if err != nil {
 				return "", err
 			}
+			emitLLMRequestProgress(execCtx, node.ID, prov, firstNonEmpty(resp.Model, mid), resp.Usage.InputTokens, resp.Usage.OutputTokens)
 			if err := writeJSON(filepath.Join(stageDir, "api_response.json"), resp.Raw); err != nil {
 				warnEngine(execCtx, fmt.Sprintf("write api_response.json: %v", err))
 			}
@@ -223,6 +229,10 @@ func (r *CodergenRouter) runAPI(ctx context.Context, execCtx *Execution, node *m
 		}
 		overrides := buildAgentLoopOverrides(artifactPolicyFromExecution(execCtx), stageEnv)
 		env := agent.NewLocalExecutionEnvironmentWithPolicy(execCtx.WorktreeDir, overrides, []string{"CLAUDECODE"})
+		statusTool := stageStatusToolMode(node) != statusToolFile && contract.PrimaryPath != ""
+		if statusTool {
+			prompt = withReportStatusPreamble(prompt, contract)
+		}
 		text, used, err := r.withFailoverText(ctx, execCtx, node, client, provider, modelID, func(prov string, mid string) (string, error) {
 			var profile agent.ProviderProfile
 			var profileErr error
@@ -252,6 +262,23 @@ func (r *CodergenRouter) runAPI(ctx context.Context, execCtx *Execution, node *m
 			if v := parseInt(node.Attr("max_agent_turns", ""), 0); v > 0 {
 				sessCfg.MaxTurns = v
 			}
+			sessCfg.SubagentWorktrees = parseBool(node.Attr("subagent_worktrees", ""), false)
+			if statusTool {
+				sessCfg.StatusReporter = func(outcomeJSON []byte) error {
+					o, err := reportStageStatus(contract.PrimaryPath, outcomeJSON)
+					if err == nil && execCtx != nil && execCtx.Engine != nil {
+						execCtx.Engine.appendProgress(map[string]any{
+							"event":   "status_reported",
+							"node_id": node.ID,
+							"status":  string(o.Status),
+						})
+					}
+					return err
+				}
+			}
+			sessCfg.ResolveSubagentProfile = func(subProv string, subModel string) (agent.ProviderProfile, error) {
+				return r.subagentProfile(firstNonEmpty(subProv, prov), firstNonEmpty(subModel, mid))
+			}
 			if maxTokensPtr != nil {
 				sessCfg.MaxTokens = maxTokensPtr
 			}
@@ -270,6 +297,28 @@ func (r *CodergenRouter) runAPI(ctx context.Context, execCtx *Execution, node *m
 			sessCfg.ToolCallFilter = func(toolName, callID, argsJSON string) string {
 				return runPreToolHook(ctx, execCtx, node, stageDir, toolName, callID, argsJSON)
 			}
+			var graph *model.Graph
+			if execCtx != nil && execCtx.Engine != nil {
+				graph = execCtx.Engine.Graph
+			}
+			mcpServers, err := resolveMCPServers(r.cfg, graph, node)
+			if err != nil {
+				return "", err
+			}
+			sessCfg.MCPServers = mcpServers
+			lspServers, err := resolveLSPServers(r.cfg, node)
+			if err != nil {
+				return "", err
+			}
+			sessCfg.LSPServers = lspServers
+			// Journal the transcript so an interrupted stage can pick up where
+			// it left off when the run is resumed.
+			sessCfg.JournalPath = filepath.Join(stageDir, sessionJournalFileName)
+			input := prompt
+			if j := claimInterruptedSession(execCtx, node.ID, stageDir, profile); j != nil {
+				sessCfg.ResumeHistory = j.Turns
+				input = interruptedSessionNote(execCtx, node.ID, len(j.Turns))
+			}
 			sess, err := agent.NewSession(client, profile, env, sessCfg)
 			if err != nil {
 				return "", err
@@ -283,6 +332,8 @@ func (r *CodergenRouter) runAPI(ctx context.Context, execCtx *Execution, node *m
 			}
 			defer func() { _ = eventsFile.Close() }()
 
+			steering := startSessionSteering(ctx, execCtx, node.ID, stageDir, sess.Steer)
+
 			var eventsMu sync.Mutex
 			var events []agent.SessionEvent
 			done := make(chan struct{})
@@ -307,6 +358,17 @@ func (r *CodergenRouter) runAPI(ctx context.Context, execCtx *Execution, node *m
 					if execCtx != nil && execCtx.Engine != nil {
 						executeToolHookForEvent(ctx, execCtx, node, ev, stageDir)
 					}
+					if ev.Kind == agent.EventSteeringInjected {
+						text, _ := ev.Data["text"].(string)
+						steering.injected(ctx, text)
+					}
+					if ev.Kind == agent.EventAssistantTextEnd || ev.Kind == agent.EventSubagentUsage {
+						evProvider, _ := ev.Data["provider"].(string)
+						evModel, _ := ev.Data["model"].(string)
+						inTok, _ := ev.Data["input_tokens"].(int)
+						outTok, _ := ev.Data["output_tokens"].(int)
+						emitLLMRequestProgress(execCtx, node.ID, firstNonEmpty(evProvider, prov), firstNonEmpty(evModel, mid), inTok, outTok)
+					}
 					eventsMu.Lock()
 					events = append(events, ev)
 					eventsMu.Unlock()
@@ -353,9 +415,10 @@ func (r *CodergenRouter) runAPI(ctx context.Context, execCtx *Execution, node *m
 				}
 			}()
 
-			text, runErr := sess.ProcessInput(ctx, prompt)
+			text, runErr := sess.ProcessInput(ctx, input)
 			sess.Close()
 			<-done
+			steering.finish()
 			close(heartbeatStop)
 			<-heartbeatDone
 			eventsMu.Lock()
@@ -519,6 +582,22 @@ func attractorLLMRetryPolicy(execCtx *Execution, nodeID string, provider string,
 	return p
 }
 
+// emitLLMRequestProgress records a completed LLM request (with token usage)
+// in the progress stream so metrics consumers can aggregate by provider/model.
+func emitLLMRequestProgress(execCtx *Execution, nodeID string, provider string, modelID string, inputTokens int, outputTokens int) {
+	if execCtx == nil || execCtx.Engine == nil {
+		return
+	}
+	execCtx.Engine.appendProgress(map[string]any{
+		"event":         "llm_request",
+		"node_id":       nodeID,
+		"provider":      provider,
+		"model":         modelID,
+		"input_tokens":  inputTokens,
+		"output_tokens": outputTokens,
+	})
+}
+
 func shouldFailoverLLMError(err error) bool {
 	if err == nil {
 		return false
@@ -898,6 +977,26 @@ func (p providerRoutedProfile) ID() string {
 	return p.providerID
 }
 
+// subagentProfile validates a spawn_agent provider/model choice against the
+// run's API providers and model catalog.
+func (r *CodergenRouter) subagentProfile(provider string, modelID string) (agent.ProviderProfile, error) {
+	provider = normalizeProviderKey(provider)
+	rt, ok := r.providerRuntimes[provider]
+	if !ok {
+		if len(r.providerRuntimes) > 0 {
+			return nil, fmt.Errorf("subagent provider %q is not configured for this run", provider)
+		}
+		return profileForProvider(provider, modelID)
+	}
+	if rt.Backend != BackendAPI {
+		return nil, fmt.Errorf("subagent provider %q uses the %s backend; subagents need an api provider", provider, rt.Backend)
+	}
+	if r.catalog != nil && modeldb.CatalogCoversProvider(r.catalog, provider) && !modeldb.CatalogHasProviderModel(r.catalog, provider, modelID) {
+		return nil, fmt.Errorf("subagent model %q is not in the model catalog for provider %q", modelID, provider)
+	}
+	return profileForRuntimeProvider(rt, modelID)
+}
+
 func profileForProvider(provider string, modelID string) (agent.ProviderProfile, error) {
 	switch normalizeProviderKey(provider) {
 	case "openai":
@@ -961,6 +1060,14 @@ func (r *CodergenRouter) runCLI(ctx context.Context, execCtx *Execution, node *m
 		return "", classifiedFailure(err, ""), nil
 	}
 	codexSemantics := usesCodexCLISemantics(providerKey, exe)
+	if stageStatusToolMode(node) == statusToolMCP && contract.PrimaryPath != "" {
+		if extra, err := statusMCPCLIArgs(providerKey, codexSemantics, stageDir, contract.PrimaryPath); err != nil {
+			warnEngine(execCtx, fmt.Sprintf("status_tool=mcp: %v (falling back to status.json)", err))
+		} else {
+			args = append(args, extra...)
+			prompt = withReportStatusPreamble(prompt, contract)
+		}
+	}
 
 	// Disable Codex sandbox for manual box fan-in convergence nodes.
 	// git merge writes to .git/ metadata outside the worktree, which
@@ -981,7 +1088,7 @@ func (r *CodergenRouter) runCLI(ctx context.Context, execCtx *Execution, node *m
 	}
 
 	// Build the base env once — used by codex initial + retries and non-codex paths.
-	baseEnv := buildBaseNodeEnv(artifactPolicyFromExecution(execCtx))
+	baseEnv := withTraceparentEnv(ctx, buildBaseNodeEnv(artifactPolicyFromExecution(execCtx)))
 
 	var isolatedEnv []string
 	var isolatedMeta map[string]any
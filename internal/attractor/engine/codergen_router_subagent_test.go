@@ -0,0 +1,34 @@
+package engine
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/danshapiro/kilroy/internal/attractor/modeldb"
+)
+
+func TestCodergenRouter_SubagentProfile_ValidatesProviderAndCatalog(t *testing.T) {
+	r := &CodergenRouter{
+		providerRuntimes: map[string]ProviderRuntime{
+			"openai":    {Key: "openai", Backend: BackendAPI},
+			"anthropic": {Key: "anthropic", Backend: BackendCLI},
+		},
+		catalog: &modeldb.Catalog{
+			Models:           map[string]modeldb.ModelEntry{"openai/gpt-5.4-mini": {Provider: "openai"}},
+			CoveredProviders: map[string]bool{"openai": true},
+		},
+	}
+	p, err := r.subagentProfile("openai", "gpt-5.4-mini")
+	if err != nil || p.ID() != "openai" || p.Model() != "gpt-5.4-mini" {
+		t.Fatalf("profile: %v %v", p, err)
+	}
+	for _, tc := range []struct{ provider, model, want string }{
+		{"openai", "gpt-9", "not in the model catalog"},
+		{"anthropic", "claude-x", "need an api provider"},
+		{"google", "gemini-x", "not configured"},
+	} {
+		if _, err := r.subagentProfile(tc.provider, tc.model); err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Fatalf("%s/%s: got %v want %q", tc.provider, tc.model, err, tc.want)
+		}
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"path/filepath"
 	"strings"
 
+	"github.com/danshapiro/kilroy/internal/attractor/forge"
 	"github.com/danshapiro/kilroy/internal/providerspec"
 
 	"gopkg.in/yaml.v3"
@@ -70,6 +71,105 @@ type InputMaterializationConfig struct {
 	LLMProvider      string                          `json:"llm_provider,omitempty" yaml:"llm_provider,omitempty"`
 }
 
+// TelemetryConfig enables OTLP trace export for run → node → attempt → agent
+// turn → LLM request/tool call spans.
+type TelemetryConfig struct {
+	Enabled bool `json:"enabled,omitempty" yaml:"enabled,omitempty"`
+	// Endpoint is the collector's base URL (default http://localhost:4318, or
+	// http://localhost:4317 for grpc).
+	Endpoint string `json:"endpoint,omitempty" yaml:"endpoint,omitempty"`
+	// Protocol selects the OTLP transport: http/json (default) or grpc. grpc
+	// uses cleartext HTTP/2 for http:// endpoints and TLS for https://.
+	Protocol           string            `json:"protocol,omitempty" yaml:"protocol,omitempty"`
+	ServiceName        string            `json:"service_name,omitempty" yaml:"service_name,omitempty"`
+	Headers            map[string]string `json:"headers,omitempty" yaml:"headers,omitempty"`
+	ResourceAttributes map[string]string `json:"resource_attributes,omitempty" yaml:"resource_attributes,omitempty"`
+}
+
+// NotificationsConfig pushes selected run lifecycle events to external
+// endpoints so operators do not have to watch progress.ndjson.
+type NotificationsConfig struct {
+	Webhooks []WebhookConfig `json:"webhooks,omitempty" yaml:"webhooks,omitempty"`
+}
+
+// MCPConfig declares Model Context Protocol servers whose tools are offered
+// to API-backend agent_loop stages.
+type MCPConfig struct {
+	Servers map[string]MCPServerConfig `json:"servers,omitempty" yaml:"servers,omitempty"`
+}
+
+// MCPServerConfig is one MCP server. Set Command for the stdio transport or
+// URL for streamable HTTP. Env and Headers values expand ${VAR} references.
+type MCPServerConfig struct {
+	Command          []string          `json:"command,omitempty" yaml:"command,omitempty"`
+	Env              map[string]string `json:"env,omitempty" yaml:"env,omitempty"`
+	URL              string            `json:"url,omitempty" yaml:"url,omitempty"`
+	Headers          map[string]string `json:"headers,omitempty" yaml:"headers,omitempty"`
+	StartupTimeoutMS int               `json:"startup_timeout_ms,omitempty" yaml:"startup_timeout_ms,omitempty"`
+	CallTimeoutMS    int               `json:"call_timeout_ms,omitempty" yaml:"call_timeout_ms,omitempty"`
+}
+
+// LSPConfig declares language servers for the code-intelligence tools of
+// API-backend agent_loop stages, in addition to (or overriding) the built-in
+// go, rust, python and typescript servers. Stages opt in with the `lsp`
+// node attribute.
+type LSPConfig struct {
+	Servers map[string]LSPServerConfig `json:"servers,omitempty" yaml:"servers,omitempty"`
+}
+
+// LSPServerConfig is one stdio language server. Env values expand ${VAR}
+// references.
+type LSPServerConfig struct {
+	Command          []string          `json:"command,omitempty" yaml:"command,omitempty"`
+	Env              map[string]string `json:"env,omitempty" yaml:"env,omitempty"`
+	Extensions       []string          `json:"extensions,omitempty" yaml:"extensions,omitempty"`
+	LanguageID       string            `json:"language_id,omitempty" yaml:"language_id,omitempty"`
+	StartupTimeoutMS int               `json:"startup_timeout_ms,omitempty" yaml:"startup_timeout_ms,omitempty"`
+	RequestTimeoutMS int               `json:"request_timeout_ms,omitempty" yaml:"request_timeout_ms,omitempty"`
+}
+
+// PullRequestConfig opens a pull request (a merge request on GitLab) for the
+// run branch after a successful run. It needs git.push_remote, since the
+// branch has to be on the forge first.
+type PullRequestConfig struct {
+	// Forge is github (default), gitlab or gitea.
+	Forge string `json:"forge,omitempty" yaml:"forge,omitempty"`
+	// APIBaseURL overrides the forge's public API root; required for gitea.
+	APIBaseURL string `json:"api_base_url,omitempty" yaml:"api_base_url,omitempty"`
+	// Repo is owner/name (group/project on GitLab). Defaults to the path of
+	// the push remote's URL.
+	Repo string `json:"repo,omitempty" yaml:"repo,omitempty"`
+	// Base is the branch the pull request targets.
+	Base string `json:"base" yaml:"base"`
+	// TitleTemplate and BodyTemplate are Go text/templates over the run
+	// summary; empty uses the built-in ones.
+	TitleTemplate string   `json:"title_template,omitempty" yaml:"title_template,omitempty"`
+	BodyTemplate  string   `json:"body_template,omitempty" yaml:"body_template,omitempty"`
+	Labels        []string `json:"labels,omitempty" yaml:"labels,omitempty"`
+	Draft         bool     `json:"draft,omitempty" yaml:"draft,omitempty"`
+	// TokenEnv names the environment variable holding the API token
+	// (default GITHUB_TOKEN, GITLAB_TOKEN or GITEA_TOKEN).
+	TokenEnv string `json:"token_env,omitempty" yaml:"token_env,omitempty"`
+}
+
+type WebhookConfig struct {
+	URL string `json:"url" yaml:"url"`
+	// Format is "json" (default, the full event) or "slack" (incoming-webhook text).
+	Format string `json:"format,omitempty" yaml:"format,omitempty"`
+	// Events filters progress event names; "*" matches all. Defaults to
+	// run_completed, run_failed, human_gate_waiting and loop_restart_circuit_breaker.
+	Events []string `json:"events,omitempty" yaml:"events,omitempty"`
+	// Secret (or the env var named by SecretEnv) signs each body with
+	// HMAC-SHA256 in the X-Kilroy-Signature header.
+	Secret      string            `json:"secret,omitempty" yaml:"secret,omitempty"`
+	SecretEnv   string            `json:"secret_env,omitempty" yaml:"secret_env,omitempty"`
+	Headers     map[string]string `json:"headers,omitempty" yaml:"headers,omitempty"`
+	MaxAttempts int               `json:"max_attempts,omitempty" yaml:"max_attempts,omitempty"`
+	TimeoutMS   int               `json:"timeout_ms,omitempty" yaml:"timeout_ms,omitempty"`
+	// RetryBaseDelayMS is the first retry backoff; it doubles per attempt.
+	RetryBaseDelayMS int `json:"retry_base_delay_ms,omitempty" yaml:"retry_base_delay_ms,omitempty"`
+}
+
 type InputConfig struct {
 	Materialize InputMaterializationConfig `json:"materialize,omitempty" yaml:"materialize,omitempty"`
 }
@@ -114,11 +214,12 @@ type RunConfigFile struct {
 	} `json:"modeldb" yaml:"modeldb"`
 
 	Git struct {
-		RequireClean           *bool    `json:"require_clean,omitempty" yaml:"require_clean,omitempty"`
-		RunBranchPrefix        string   `json:"run_branch_prefix" yaml:"run_branch_prefix"`
-		CommitPerNode          bool     `json:"commit_per_node" yaml:"commit_per_node"`
-		PushRemote             string   `json:"push_remote,omitempty" yaml:"push_remote,omitempty"`
-		CheckpointExcludeGlobs []string `json:"checkpoint_exclude_globs,omitempty" yaml:"checkpoint_exclude_globs,omitempty"`
+		RequireClean           *bool              `json:"require_clean,omitempty" yaml:"require_clean,omitempty"`
+		RunBranchPrefix        string             `json:"run_branch_prefix" yaml:"run_branch_prefix"`
+		CommitPerNode          bool               `json:"commit_per_node" yaml:"commit_per_node"`
+		PushRemote             string             `json:"push_remote,omitempty" yaml:"push_remote,omitempty"`
+		CheckpointExcludeGlobs []string           `json:"checkpoint_exclude_globs,omitempty" yaml:"checkpoint_exclude_globs,omitempty"`
+		PullRequest            *PullRequestConfig `json:"pull_request,omitempty" yaml:"pull_request,omitempty"`
 	} `json:"git" yaml:"git"`
 
 	ArtifactPolicy ArtifactPolicyConfig `json:"artifact_policy,omitempty" yaml:"artifact_policy,omitempty"`
@@ -131,6 +232,16 @@ type RunConfigFile struct {
 	RuntimePolicy RuntimePolicyConfig `json:"runtime_policy,omitempty" yaml:"runtime_policy,omitempty"`
 	Preflight     PreflightConfig     `json:"preflight,omitempty" yaml:"preflight,omitempty"`
 	Inputs        InputConfig         `json:"inputs,omitempty" yaml:"inputs,omitempty"`
+	Telemetry     TelemetryConfig     `json:"telemetry,omitempty" yaml:"telemetry,omitempty"`
+	Notifications NotificationsConfig `json:"notifications,omitempty" yaml:"notifications,omitempty"`
+	MCP           MCPConfig           `json:"mcp,omitempty" yaml:"mcp,omitempty"`
+	LSP           LSPConfig           `json:"lsp,omitempty" yaml:"lsp,omitempty"`
+
+	// Profiles are named overlays selected with attractor run --profile.
+	Profiles map[string]RunProfile `json:"profiles,omitempty" yaml:"profiles,omitempty"`
+
+	// appliedProfile is the profile ApplyProfile overlaid onto this config.
+	appliedProfile string
 }
 
 func LoadRunConfigFile(path string) (*RunConfigFile, error) {
@@ -228,6 +339,20 @@ func applyConfigDefaults(cfg *RunConfigFile) {
 		cfg.Git.RequireClean = &t
 	}
 	cfg.Git.CheckpointExcludeGlobs = trimNonEmpty(cfg.Git.CheckpointExcludeGlobs)
+	if pr := cfg.Git.PullRequest; pr != nil {
+		pr.Forge = strings.ToLower(strings.TrimSpace(pr.Forge))
+		if pr.Forge == "" {
+			pr.Forge = string(forge.GitHub)
+		}
+		pr.APIBaseURL = strings.TrimSpace(pr.APIBaseURL)
+		pr.Repo = strings.Trim(strings.TrimSpace(pr.Repo), "/")
+		pr.Base = strings.TrimSpace(pr.Base)
+		pr.Labels = trimNonEmpty(pr.Labels)
+		pr.TokenEnv = strings.TrimSpace(pr.TokenEnv)
+		if pr.TokenEnv == "" {
+			pr.TokenEnv = forge.DefaultTokenEnv(forge.Kind(pr.Forge))
+		}
+	}
 	applyArtifactPolicyDefaults(cfg)
 	if cfg.LLM.Providers == nil {
 		cfg.LLM.Providers = map[string]ProviderConfig{}
@@ -297,6 +422,47 @@ func applyConfigDefaults(cfg *RunConfigFile) {
 		v := false
 		cfg.Inputs.Materialize.InferWithLLM = &v
 	}
+
+	cfg.Telemetry.Endpoint = strings.TrimSpace(cfg.Telemetry.Endpoint)
+	cfg.Telemetry.Protocol = strings.ToLower(strings.TrimSpace(cfg.Telemetry.Protocol))
+	cfg.Telemetry.ServiceName = strings.TrimSpace(cfg.Telemetry.ServiceName)
+	if cfg.Telemetry.Enabled {
+		if cfg.Telemetry.Protocol == "" {
+			cfg.Telemetry.Protocol = "http/json"
+		}
+		if cfg.Telemetry.Endpoint == "" {
+			cfg.Telemetry.Endpoint = "http://localhost:4318"
+			if cfg.Telemetry.Protocol == "grpc" {
+				cfg.Telemetry.Endpoint = "http://localhost:4317"
+			}
+		}
+		if cfg.Telemetry.ServiceName == "" {
+			cfg.Telemetry.ServiceName = "kilroy"
+		}
+	}
+
+	for i := range cfg.Notifications.Webhooks {
+		wh := &cfg.Notifications.Webhooks[i]
+		wh.URL = strings.TrimSpace(wh.URL)
+		wh.Format = strings.ToLower(strings.TrimSpace(wh.Format))
+		wh.SecretEnv = strings.TrimSpace(wh.SecretEnv)
+		wh.Events = trimNonEmpty(wh.Events)
+		if wh.Format == "" {
+			wh.Format = "json"
+		}
+		if len(wh.Events) == 0 {
+			wh.Events = append([]string{}, defaultNotificationEvents...)
+		}
+		if wh.MaxAttempts <= 0 {
+			wh.MaxAttempts = 4
+		}
+		if wh.TimeoutMS <= 0 {
+			wh.TimeoutMS = 10_000
+		}
+		if wh.RetryBaseDelayMS <= 0 {
+			wh.RetryBaseDelayMS = 1_000
+		}
+	}
 }
 
 func validateConfig(cfg *RunConfigFile) error {
@@ -415,7 +581,47 @@ func validateConfig(cfg *RunConfigFile) error {
 			return fmt.Errorf("inputs.materialize.llm_model is required when inputs.materialize.infer_with_llm=true")
 		}
 	}
-	return nil
+	if cfg.Telemetry.Enabled {
+		switch cfg.Telemetry.Protocol {
+		case "http/json", "grpc":
+			// ok
+		default:
+			return fmt.Errorf("invalid telemetry.protocol: %q (want http/json or grpc)", cfg.Telemetry.Protocol)
+		}
+		if !strings.HasPrefix(cfg.Telemetry.Endpoint, "http://") && !strings.HasPrefix(cfg.Telemetry.Endpoint, "https://") {
+			return fmt.Errorf("telemetry.endpoint must be an http(s) URL: %q", cfg.Telemetry.Endpoint)
+		}
+	}
+	if pr := cfg.Git.PullRequest; pr != nil {
+		if err := validatePullRequestConfig(cfg, pr); err != nil {
+			return fmt.Errorf("git.pull_request: %w", err)
+		}
+	}
+	for i, wh := range cfg.Notifications.Webhooks {
+		if !strings.HasPrefix(wh.URL, "http://") && !strings.HasPrefix(wh.URL, "https://") {
+			return fmt.Errorf("notifications.webhooks[%d].url must be an http(s) URL: %q", i, wh.URL)
+		}
+		switch wh.Format {
+		case "json", "slack":
+			// ok
+		default:
+			return fmt.Errorf("invalid notifications.webhooks[%d].format: %q (want json|slack)", i, wh.Format)
+		}
+		if wh.Secret != "" && wh.SecretEnv != "" {
+			return fmt.Errorf("notifications.webhooks[%d]: set secret or secret_env, not both", i)
+		}
+	}
+	for name, srv := range cfg.MCP.Servers {
+		if err := validateMCPServer(name, srv.Command, srv.URL); err != nil {
+			return fmt.Errorf("mcp.servers.%s: %w", name, err)
+		}
+	}
+	for name, srv := range cfg.LSP.Servers {
+		if err := validateLSPServer(name, srv); err != nil {
+			return fmt.Errorf("lsp.servers.%s: %w", name, err)
+		}
+	}
+	return validateProfiles(cfg)
 }
 
 func normalizeProviderKey(k string) string {
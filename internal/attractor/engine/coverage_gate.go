@@ -0,0 +1,476 @@
+package engine
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/danshapiro/kilroy/internal/attractor/gitutil"
+	"github.com/danshapiro/kilroy/internal/attractor/model"
+	"github.com/danshapiro/kilroy/internal/attractor/runtime"
+)
+
+// CoverageGateHandler implements the verify.coverage node type: it runs
+// coverage_command, reads the coverage profile it produces, and fails when
+// coverage of the lines changed since the run's base SHA is below
+// coverage_threshold (coverage_scope=files scores the changed files whole).
+// The uncovered line ranges go into context so the next codergen stage knows
+// exactly which new code lacks tests.
+type CoverageGateHandler struct{}
+
+const (
+	coverageReportFileName   = "coverage_report.json"
+	coverageCommandLogName   = "coverage_command.log"
+	defaultCoverageThreshold = 80.0
+	// coverageContextFiles caps the per-file uncovered ranges copied into context.
+	coverageContextFiles = 20
+
+	coverageFormatGo        = "go"
+	coverageFormatLCOV      = "lcov"
+	coverageFormatCobertura = "cobertura"
+
+	coverageScopeLines = "lines"
+	coverageScopeFiles = "files"
+)
+
+// lineCoverage maps a profile's file path to line number -> covered.
+type lineCoverage map[string]map[int]bool
+
+func (c lineCoverage) mark(file string, line int, covered bool) {
+	file = filepath.ToSlash(strings.TrimSpace(file))
+	if file == "" || line <= 0 {
+		return
+	}
+	lines := c[file]
+	if lines == nil {
+		lines = map[int]bool{}
+		c[file] = lines
+	}
+	lines[line] = lines[line] || covered
+}
+
+type coverageReport struct {
+	Format     string             `json:"format"`
+	Profile    string             `json:"profile"`
+	BaseSHA    string             `json:"base_sha"`
+	Scope      string             `json:"scope"`
+	Threshold  float64            `json:"threshold"`
+	Percent    float64            `json:"percent"`
+	Covered    int                `json:"covered_lines"`
+	Total      int                `json:"total_lines"`
+	Passed     bool               `json:"passed"`
+	Files      []coverageFileStat `json:"files"`
+	Unmeasured []string           `json:"unmeasured_changed_files,omitempty"`
+}
+
+type coverageFileStat struct {
+	Path      string  `json:"path"`
+	Percent   float64 `json:"percent"`
+	Covered   int     `json:"covered_lines"`
+	Total     int     `json:"total_lines"`
+	Uncovered string  `json:"uncovered,omitempty"`
+}
+
+func (h *CoverageGateHandler) Execute(ctx context.Context, execCtx *Execution, node *model.Node) (runtime.Outcome, error) {
+	stageDir := filepath.Join(execCtx.LogsRoot, node.ID)
+	if err := os.MkdirAll(stageDir, 0o755); err != nil {
+		return runtime.Outcome{Status: runtime.StatusFail, FailureReason: err.Error()}, nil
+	}
+	cmdStr := strings.TrimSpace(node.Attr("coverage_command", node.Attr("tool_command", "")))
+	if cmdStr == "" {
+		return runtime.Outcome{Status: runtime.StatusFail, FailureReason: "verify.coverage: no coverage_command specified"}, nil
+	}
+	profileRel := strings.TrimSpace(node.Attr("coverage_profile", ""))
+	if profileRel == "" {
+		return runtime.Outcome{Status: runtime.StatusFail, FailureReason: "verify.coverage: no coverage_profile specified"}, nil
+	}
+	threshold := parseFloat(node.Attr("coverage_threshold", ""), defaultCoverageThreshold)
+	scope := strings.ToLower(strings.TrimSpace(node.Attr("coverage_scope", coverageScopeLines)))
+	if scope != coverageScopeLines && scope != coverageScopeFiles {
+		return runtime.Outcome{Status: runtime.StatusFail, FailureReason: fmt.Sprintf("verify.coverage: unknown coverage_scope %q (want lines or files)", scope)}, nil
+	}
+	baseSHA := ""
+	if execCtx.Context != nil {
+		baseSHA = strings.TrimSpace(execCtx.Context.GetString("base_sha", ""))
+	}
+	if baseSHA == "" && execCtx.Engine != nil {
+		baseSHA = execCtx.Engine.baseSHA
+	}
+	if baseSHA == "" {
+		return runtime.Outcome{Status: runtime.StatusFail, FailureReason: "verify.coverage: run base SHA is unknown"}, nil
+	}
+	timeout := parseDuration(node.Attr("timeout", ""), 0)
+	if timeout <= 0 {
+		timeout = 600 * time.Second
+	}
+
+	profilePath := profileRel
+	if !filepath.IsAbs(profilePath) {
+		profilePath = filepath.Join(execCtx.WorktreeDir, filepath.FromSlash(profileRel))
+	}
+	_ = os.Remove(profilePath)
+	stdout, stderr, exitCode := runLoggedShellCommand(ctx, execCtx, cmdStr, timeout, filepath.Join(stageDir, coverageCommandLogName))
+	combined := string(stdout) + string(stderr)
+	if exitCode != 0 {
+		reason := fmt.Sprintf("verify.coverage: coverage_command exited with code %d", exitCode)
+		if exitCode == -1 {
+			reason = fmt.Sprintf("verify.coverage: coverage_command timed out after %s or could not start", timeout)
+		}
+		if line := firstActionableToolOutputLine([]byte(combined)); line != "" {
+			reason += ": " + line
+		}
+		return runtime.Outcome{
+			Status:         runtime.StatusFail,
+			FailureReason:  reason,
+			ContextUpdates: map[string]any{"tool.output": truncate(combined, 8_000)},
+		}, nil
+	}
+
+	data, err := os.ReadFile(profilePath)
+	if err != nil {
+		return runtime.Outcome{Status: runtime.StatusFail, FailureReason: fmt.Sprintf("verify.coverage: read coverage_profile: %v", err)}, nil
+	}
+	format := strings.ToLower(strings.TrimSpace(node.Attr("coverage_format", "")))
+	if format == "" {
+		format = detectCoverageFormat(data)
+	}
+	cov, err := parseCoverageProfile(format, data)
+	if err != nil {
+		return runtime.Outcome{Status: runtime.StatusFail, FailureReason: fmt.Sprintf("verify.coverage: parse %s coverage profile %s: %v", format, profileRel, err)}, nil
+	}
+	changed, err := gitutil.DiffNameOnly(execCtx.WorktreeDir, baseSHA)
+	if err != nil {
+		return runtime.Outcome{Status: runtime.StatusFail, FailureReason: fmt.Sprintf("verify.coverage: list files changed since %s: %v", baseSHA, err)}, nil
+	}
+
+	var changedLines map[string][]int
+	if scope == coverageScopeLines {
+		if changedLines, err = gitutil.DiffAddedLines(execCtx.WorktreeDir, baseSHA); err != nil {
+			return runtime.Outcome{Status: runtime.StatusFail, FailureReason: fmt.Sprintf("verify.coverage: list lines changed since %s: %v", baseSHA, err)}, nil
+		}
+	}
+
+	report := buildCoverageReport(cov, changed, changedLines, execCtx.WorktreeDir, threshold)
+	report.Format, report.Profile, report.BaseSHA = format, profileRel, baseSHA
+	if err := writeJSON(filepath.Join(stageDir, coverageReportFileName), report); err != nil {
+		warnEngine(execCtx, fmt.Sprintf("write %s: %v", coverageReportFileName, err))
+	}
+
+	updates := report.contextUpdates()
+	if report.Passed {
+		notes := fmt.Sprintf("%s %.1f%% >= %.1f%%", report.label(), report.Percent, threshold)
+		if report.Total == 0 {
+			notes = "no changed lines with coverage data"
+		}
+		return runtime.Outcome{Status: runtime.StatusSuccess, ContextUpdates: updates, Notes: notes}, nil
+	}
+	var below []string
+	for _, f := range report.Files {
+		if f.Uncovered != "" {
+			below = append(below, f.Path)
+		}
+	}
+	return runtime.Outcome{
+		Status:         runtime.StatusFail,
+		FailureReason:  fmt.Sprintf("%s %.1f%% is below %.1f%%; uncovered lines in %s", report.label(), report.Percent, threshold, strings.Join(below, ", ")),
+		ContextUpdates: updates,
+	}, nil
+}
+
+// buildCoverageReport scores the changed files that appear in the profile.
+// With changedLines set, only each file's added or modified lines count;
+// with it nil, whole files do (coverage_scope=files).
+func buildCoverageReport(cov lineCoverage, changed []string, changedLines map[string][]int, worktreeDir string, threshold float64) *coverageReport {
+	report := &coverageReport{Scope: coverageScopeFiles, Threshold: threshold, Files: []coverageFileStat{}}
+	if changedLines != nil {
+		report.Scope = coverageScopeLines
+	}
+	profileFiles := make([]string, 0, len(cov))
+	for f := range cov {
+		profileFiles = append(profileFiles, f)
+	}
+	sort.Strings(profileFiles)
+	root := filepath.ToSlash(worktreeDir)
+	for _, rel := range changed {
+		rel = filepath.ToSlash(rel)
+		lines := map[int]bool{}
+		matched := false
+		for _, pf := range profileFiles {
+			if coveragePathMatches(pf, rel, root) {
+				matched = true
+				for n, covered := range cov[pf] {
+					lines[n] = lines[n] || covered
+				}
+			}
+		}
+		if !matched {
+			if isCoverageSourceCandidate(rel) {
+				report.Unmeasured = append(report.Unmeasured, rel)
+			}
+			continue
+		}
+		if changedLines != nil {
+			keep := map[int]bool{}
+			for _, n := range changedLines[rel] {
+				keep[n] = true
+			}
+			for n := range lines {
+				if !keep[n] {
+					delete(lines, n)
+				}
+			}
+			if len(lines) == 0 {
+				// Only comments, blank lines or deletions changed.
+				continue
+			}
+		}
+		stat := coverageFileStat{Path: rel, Total: len(lines)}
+		var uncovered []int
+		for n, covered := range lines {
+			if covered {
+				stat.Covered++
+			} else {
+				uncovered = append(uncovered, n)
+			}
+		}
+		stat.Percent = coveragePercent(stat.Covered, stat.Total)
+		stat.Uncovered = formatLineRanges(uncovered)
+		report.Covered += stat.Covered
+		report.Total += stat.Total
+		report.Files = append(report.Files, stat)
+	}
+	report.Percent = coveragePercent(report.Covered, report.Total)
+	report.Passed = report.Total == 0 || report.Percent >= threshold
+	return report
+}
+
+// label names what the report scored, for notes and failure reasons.
+func (r *coverageReport) label() string {
+	if r.Scope == coverageScopeFiles {
+		return "changed-file line coverage"
+	}
+	return "changed-line coverage"
+}
+
+func (r *coverageReport) contextUpdates() map[string]any {
+	uncovered := []string{}
+	for _, f := range r.Files {
+		if f.Uncovered == "" {
+			continue
+		}
+		if len(uncovered) == coverageContextFiles {
+			uncovered = append(uncovered, fmt.Sprintf("... (more in %s)", coverageReportFileName))
+			break
+		}
+		uncovered = append(uncovered, fmt.Sprintf("%s (%.1f%%): lines %s", f.Path, f.Percent, f.Uncovered))
+	}
+	return map[string]any{
+		"coverage.percent":   fmt.Sprintf("%.1f", r.Percent),
+		"coverage.threshold": fmt.Sprintf("%.1f", r.Threshold),
+		"coverage.passed":    r.Passed,
+		"coverage.uncovered": uncovered,
+	}
+}
+
+func coveragePercent(covered, total int) float64 {
+	if total == 0 {
+		return 100
+	}
+	return float64(covered) * 100 / float64(total)
+}
+
+// coveragePathMatches reports whether a profile path (an import path, an
+// absolute path, or a path relative to some source root) names the
+// repo-relative file rel.
+func coveragePathMatches(profilePath, rel, root string) bool {
+	p := strings.TrimPrefix(profilePath, root+"/")
+	p = strings.TrimPrefix(p, "./")
+	return p == rel || strings.HasSuffix(p, "/"+rel)
+}
+
+// isCoverageSourceCandidate filters out changed files no coverage tool would
+// measure (docs, config, tests), so they are not reported as unmeasured.
+func isCoverageSourceCandidate(rel string) bool {
+	base := path.Base(rel)
+	switch strings.ToLower(path.Ext(rel)) {
+	case ".go":
+		return !strings.HasSuffix(base, "_test.go")
+	case ".py":
+		return !strings.HasPrefix(base, "test_") && !strings.HasSuffix(base, "_test.py")
+	case ".js", ".jsx", ".ts", ".tsx", ".mjs", ".cjs":
+		return !strings.Contains(base, ".test.") && !strings.Contains(base, ".spec.")
+	case ".rs", ".java", ".kt", ".c", ".cc", ".cpp", ".h", ".hpp", ".rb", ".cs", ".swift":
+		return true
+	default:
+		return false
+	}
+}
+
+// formatLineRanges renders line numbers as "3-5, 9, 12-13".
+func formatLineRanges(lines []int) string {
+	if len(lines) == 0 {
+		return ""
+	}
+	sort.Ints(lines)
+	var parts []string
+	start, prev := lines[0], lines[0]
+	flush := func() {
+		if start == prev {
+			parts = append(parts, strconv.Itoa(start))
+		} else {
+			parts = append(parts, fmt.Sprintf("%d-%d", start, prev))
+		}
+	}
+	for _, n := range lines[1:] {
+		if n == prev+1 {
+			prev = n
+			continue
+		}
+		flush()
+		start, prev = n, n
+	}
+	flush()
+	return strings.Join(parts, ", ")
+}
+
+func detectCoverageFormat(data []byte) string {
+	t := bytes.TrimSpace(data)
+	switch {
+	case bytes.HasPrefix(t, []byte("mode:")):
+		return coverageFormatGo
+	case bytes.HasPrefix(t, []byte("<")):
+		return coverageFormatCobertura
+	default:
+		return coverageFormatLCOV
+	}
+}
+
+func parseCoverageProfile(format string, data []byte) (lineCoverage, error) {
+	switch format {
+	case coverageFormatGo:
+		return parseGoCoverProfile(data)
+	case coverageFormatLCOV:
+		return parseLCOV(data)
+	case coverageFormatCobertura:
+		return parseCobertura(data)
+	default:
+		return nil, fmt.Errorf("unknown coverage_format %q (want go, lcov or cobertura)", format)
+	}
+}
+
+// parseGoCoverProfile reads `go test -coverprofile` output, whose lines are
+// "file:startLine.startCol,endLine.endCol numStmts count".
+func parseGoCoverProfile(data []byte) (lineCoverage, error) {
+	cov := lineCoverage{}
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "mode:") {
+			continue
+		}
+		colon := strings.LastIndex(line, ":")
+		if colon < 0 {
+			return nil, fmt.Errorf("bad coverprofile line %q", line)
+		}
+		fields := strings.Fields(line[colon+1:])
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("bad coverprofile line %q", line)
+		}
+		startStr, endStr, ok := strings.Cut(fields[0], ",")
+		if !ok {
+			return nil, fmt.Errorf("bad coverprofile block %q", fields[0])
+		}
+		start, err1 := strconv.Atoi(strings.SplitN(startStr, ".", 2)[0])
+		end, err2 := strconv.Atoi(strings.SplitN(endStr, ".", 2)[0])
+		count, err3 := strconv.Atoi(fields[2])
+		if err1 != nil || err2 != nil || err3 != nil {
+			return nil, fmt.Errorf("bad coverprofile line %q", line)
+		}
+		for n := start; n <= end; n++ {
+			cov.mark(line[:colon], n, count > 0)
+		}
+	}
+	return cov, sc.Err()
+}
+
+// parseLCOV reads SF:/DA: records from an LCOV tracefile.
+func parseLCOV(data []byte) (lineCoverage, error) {
+	cov := lineCoverage{}
+	file := ""
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		switch {
+		case strings.HasPrefix(line, "SF:"):
+			file = strings.TrimPrefix(line, "SF:")
+		case strings.HasPrefix(line, "DA:") && file != "":
+			parts := strings.Split(strings.TrimPrefix(line, "DA:"), ",")
+			if len(parts) < 2 {
+				return nil, fmt.Errorf("bad LCOV line %q", line)
+			}
+			n, err1 := strconv.Atoi(parts[0])
+			hits, err2 := strconv.ParseFloat(parts[1], 64)
+			if err1 != nil || err2 != nil {
+				return nil, fmt.Errorf("bad LCOV line %q", line)
+			}
+			cov.mark(file, n, hits > 0)
+		case line == "end_of_record":
+			file = ""
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	if len(cov) == 0 {
+		return nil, fmt.Errorf("no SF:/DA: records found")
+	}
+	return cov, nil
+}
+
+type coberturaReport struct {
+	Sources  []string `xml:"sources>source"`
+	Packages []struct {
+		Classes []struct {
+			Filename string `xml:"filename,attr"`
+			Lines    []struct {
+				Number int     `xml:"number,attr"`
+				Hits   float64 `xml:"hits,attr"`
+			} `xml:"lines>line"`
+		} `xml:"classes>class"`
+	} `xml:"packages>package"`
+}
+
+// parseCobertura reads class line hits from a Cobertura XML report. File
+// names are relative to the report's <source> root when it has exactly one.
+func parseCobertura(data []byte) (lineCoverage, error) {
+	var rep coberturaReport
+	if err := xml.Unmarshal(data, &rep); err != nil {
+		return nil, err
+	}
+	root := ""
+	if len(rep.Sources) == 1 {
+		root = filepath.ToSlash(strings.TrimSpace(rep.Sources[0]))
+	}
+	cov := lineCoverage{}
+	for _, p := range rep.Packages {
+		for _, c := range p.Classes {
+			file := filepath.ToSlash(c.Filename)
+			if root != "" && root != "." && !path.IsAbs(file) {
+				file = path.Join(root, file)
+			}
+			for _, l := range c.Lines {
+				cov.mark(file, l.Number, l.Hits > 0)
+			}
+		}
+	}
+	return cov, nil
+}
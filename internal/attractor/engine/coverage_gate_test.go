@@ -0,0 +1,144 @@
+package engine
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/danshapiro/kilroy/internal/attractor/model"
+	"github.com/danshapiro/kilroy/internal/attractor/runtime"
+)
+
+func TestCoverageGateHandler_FailsBelowThresholdOnChangedLines(t *testing.T) {
+	repo := parityInitRepo(t)
+	_ = os.MkdirAll(filepath.Join(repo, "pkg"), 0o755)
+	calc := []string{"package pkg", "", "a", "b", "c", "d", "", "", "e", "f", "", "g"}
+	_ = os.WriteFile(filepath.Join(repo, "pkg", "calc.go"), []byte(strings.Join(calc, "\n")+"\n"), 0o644)
+	runCmd(t, repo, "git", "add", "-A")
+	runCmd(t, repo, "git", "commit", "-m", "add calc")
+	base := strings.TrimSpace(runCmdOut(t, repo, "git", "rev-parse", "HEAD"))
+	// The run rewrites lines 3-6 and 9-10; lines 1 and 12 are untouched.
+	for _, n := range []int{3, 4, 5, 6, 9, 10} {
+		calc[n-1] += "2"
+	}
+	_ = os.WriteFile(filepath.Join(repo, "pkg", "calc.go"), []byte(strings.Join(calc, "\n")+"\n"), 0o644)
+	_ = os.WriteFile(filepath.Join(repo, "pkg", "old.go"), []byte("package pkg\n"), 0o644)
+	_ = os.WriteFile(filepath.Join(repo, "pkg", "calc_test.go"), []byte("package pkg\n"), 0o644)
+	runCmd(t, repo, "git", "add", "-A")
+	runCmd(t, repo, "git", "commit", "-m", "edit calc")
+	// Simulate a file untouched by the run: it is in the profile but not the diff.
+	lcov := "SF:" + repo + "/pkg/calc.go\\nDA:1,0\\nDA:3,1\\nDA:4,1\\nDA:5,0\\nDA:6,0\\nDA:9,0\\nDA:10,2\\nDA:12,0\\nend_of_record\\n" +
+		"SF:pkg/untouched.go\\nDA:1,0\\nend_of_record\\n"
+
+	node := &model.Node{ID: "coverage", Attrs: map[string]string{
+		"shape":              "parallelogram",
+		"type":               "verify.coverage",
+		"coverage_command":   "mkdir -p out && printf '" + lcov + "' > out/lcov.info",
+		"coverage_profile":   "out/lcov.info",
+		"coverage_threshold": "75",
+	}}
+	logsRoot := t.TempDir()
+	rctx := runtime.NewContext()
+	rctx.Set("base_sha", base)
+	execCtx := &Execution{Context: rctx, LogsRoot: logsRoot, WorktreeDir: repo, Engine: &Engine{LogsRoot: logsRoot}}
+
+	out, err := (&CoverageGateHandler{}).Execute(context.Background(), execCtx, node)
+	if err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	if out.Status != runtime.StatusFail {
+		t.Fatalf("status: got %q want fail (%s)", out.Status, out.FailureReason)
+	}
+	if want := "changed-line coverage 50.0% is below 75.0%; uncovered lines in pkg/calc.go"; out.FailureReason != want {
+		t.Fatalf("failure reason: got %q want %q", out.FailureReason, want)
+	}
+	uncovered, _ := out.ContextUpdates["coverage.uncovered"].([]string)
+	if len(uncovered) != 1 || uncovered[0] != "pkg/calc.go (50.0%): lines 5-6, 9" {
+		t.Fatalf("coverage.uncovered: %#v", uncovered)
+	}
+	assertExists(t, filepath.Join(logsRoot, "coverage", coverageReportFileName))
+	if b, _ := os.ReadFile(filepath.Join(logsRoot, "coverage", coverageReportFileName)); !strings.Contains(string(b), `"unmeasured_changed_files": [`+"\n"+`    "pkg/old.go"`) {
+		t.Fatalf("report should list pkg/old.go as unmeasured:\n%s", b)
+	}
+
+	rctx.ApplyUpdates(out.ContextUpdates)
+	p := buildFidelityPreamble(rctx, "run", "goal", "truncate", "coverage", nil)
+	if !strings.Contains(p, "CoverageBelowThreshold (coverage 50.0% < 75.0%):\n- pkg/calc.go (50.0%): lines 5-6, 9") {
+		t.Fatalf("preamble missing uncovered lines:\n%s", p)
+	}
+
+	node.Attrs["coverage_threshold"] = "50"
+	out, _ = (&CoverageGateHandler{}).Execute(context.Background(), execCtx, node)
+	if out.Status != runtime.StatusSuccess {
+		t.Fatalf("status at threshold 50: got %q (%s)", out.Status, out.FailureReason)
+	}
+
+	// Whole-file scoring also counts the untouched uncovered lines 1 and 12.
+	node.Attrs["coverage_scope"] = "files"
+	out, _ = (&CoverageGateHandler{}).Execute(context.Background(), execCtx, node)
+	if want := "changed-file line coverage 37.5% is below 50.0%; uncovered lines in pkg/calc.go"; out.FailureReason != want {
+		t.Fatalf("failure reason with coverage_scope=files: got %q want %q", out.FailureReason, want)
+	}
+	if uncovered, _ := out.ContextUpdates["coverage.uncovered"].([]string); len(uncovered) != 1 || uncovered[0] != "pkg/calc.go (37.5%): lines 1, 5-6, 9, 12" {
+		t.Fatalf("coverage.uncovered with coverage_scope=files: %#v", uncovered)
+	}
+}
+
+func TestCoverageGateHandler_FailsWhenCoverageCommandFails(t *testing.T) {
+	node := &model.Node{ID: "coverage", Attrs: map[string]string{
+		"type":             "verify.coverage",
+		"coverage_command": "echo 'FAIL: TestAdd' >&2; exit 1",
+		"coverage_profile": "cover.out",
+	}}
+	logsRoot := t.TempDir()
+	execCtx := &Execution{Context: runtime.NewContext(), LogsRoot: logsRoot, WorktreeDir: t.TempDir(), Engine: &Engine{LogsRoot: logsRoot, baseSHA: "abc123"}}
+	out, _ := (&CoverageGateHandler{}).Execute(context.Background(), execCtx, node)
+	if out.Status != runtime.StatusFail || out.FailureReason != "verify.coverage: coverage_command exited with code 1: FAIL: TestAdd" {
+		t.Fatalf("outcome: %+v", out)
+	}
+}
+
+func TestParseGoCoverProfile(t *testing.T) {
+	profile := `mode: set
+example.com/m/pkg/calc.go:3.20,5.2 2 1
+example.com/m/pkg/calc.go:5.2,8.3 3 0
+example.com/m/pkg/calc.go:10.1,10.9 1 0
+`
+	cov, err := parseGoCoverProfile([]byte(profile))
+	if err != nil {
+		t.Fatalf("parseGoCoverProfile: %v", err)
+	}
+	r := buildCoverageReport(cov, []string{"pkg/calc.go", "README.md"}, nil, "/wt", 80)
+	if r.Total != 7 || r.Covered != 3 || r.Files[0].Uncovered != "6-8, 10" || len(r.Unmeasured) != 0 {
+		t.Fatalf("report: %+v", r)
+	}
+}
+
+func TestParseCobertura_JoinsSourceRoot(t *testing.T) {
+	xml := `<?xml version="1.0" ?>
+<coverage line-rate="0.5">
+  <sources><source>/wt/src</source></sources>
+  <packages><package name="app"><classes>
+    <class name="calc.py" filename="app/calc.py">
+      <lines><line number="1" hits="1"/><line number="2" hits="0"/></lines>
+    </class>
+  </classes></package></packages>
+</coverage>`
+	cov, err := parseCobertura([]byte(xml))
+	if err != nil {
+		t.Fatalf("parseCobertura: %v", err)
+	}
+	r := buildCoverageReport(cov, []string{"src/app/calc.py"}, map[string][]int{"src/app/calc.py": {2, 3}}, "/wt", 80)
+	if r.Total != 1 || r.Covered != 0 || r.Files[0].Uncovered != "2" {
+		t.Fatalf("report: %+v", r)
+	}
+}
+
+func TestNewDefaultRegistry_RegistersCoverageGate(t *testing.T) {
+	h := NewDefaultRegistry().Resolve(&model.Node{ID: "c", Attrs: map[string]string{"type": "verify.coverage"}})
+	if _, ok := h.(*CoverageGateHandler); !ok {
+		t.Fatalf("verify.coverage resolved to %T", h)
+	}
+}
@@ -331,3 +331,18 @@ func (e *Engine) cxdbRunFailed(ctx context.Context, nodeID string, sha string, r
 	})
 	return turnID, err
 }
+
+// cxdbSteeringDelivered records an operator steering message delivered to a stage.
+func (e *Engine) cxdbSteeringDelivered(ctx context.Context, nodeID string, message string, source string, delivery string) {
+	if e == nil || e.CXDB == nil {
+		return
+	}
+	_, _, _ = e.CXDB.Append(ctx, "com.kilroy.attractor.SteeringDelivered", 1, map[string]any{
+		"run_id":       e.Options.RunID,
+		"node_id":      nodeID,
+		"timestamp_ms": nowMS(),
+		"message":      message,
+		"source":       source,
+		"delivery":     delivery,
+	})
+}
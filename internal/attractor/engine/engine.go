@@ -88,6 +88,10 @@ type RunOptions struct {
 	// Arbitrary key/value metadata written to manifest.json under "labels".
 	// Use to fingerprint runs for later querying or pruning (e.g. source=test).
 	Labels map[string]string
+
+	// Profile is the run.yaml profile applied to the run config (see
+	// RunConfigFile.ApplyProfile); it is recorded in manifest.json.
+	Profile string
 }
 
 func (o *RunOptions) applyDefaults() error {
@@ -170,6 +174,10 @@ type Engine struct {
 	ModelCatalogSource string
 	ModelCatalogPath   string
 
+	// ModelRoutes are the models chosen for llm_model=auto nodes, by node ID.
+	// They are pinned in the checkpoint so resume reuses them.
+	ModelRoutes map[string]modelRoute
+
 	// Input materialization policy + inference runtime.
 	InputMaterializationPolicy InputMaterializationPolicy
 	InputReferenceInferer      InputReferenceInferer
@@ -184,6 +192,15 @@ type Engine struct {
 	warningsMu sync.Mutex
 	Warnings   []string
 
+	// simulated runs the loop without git: there is no run branch or
+	// worktree, checkpoints are not committed, retries do not back off and
+	// parallel branches run one at a time. Set by Simulate.
+	simulated bool
+
+	// rootsMu guards writes to LogsRoot and baseLogsRoot, which loop_restart
+	// and resume change while API callers read OperatorLogsRoot.
+	rootsMu sync.Mutex
+
 	// loop_restart state (attractor-spec §3.2 Step 7).
 	restartCount             int
 	baseLogsRoot             string         // original LogsRoot before any restarts
@@ -215,6 +232,14 @@ type Engine struct {
 	forceNextFidelityUsed bool        // true once the override has been consumed
 	lastResolvedFidelity  string      // last resolved LLM fidelity for checkpoint/resume
 	lastResolvedThreadKey string      // thread key when fidelity=full (best-effort)
+
+	// Interrupted agent session resume: set by Resume, bound to the first
+	// stage the resumed run executes and dropped once that stage finishes,
+	// whether or not it found an open session journal to continue.
+	sessionResumeMu        sync.Mutex
+	sessionResumePending   bool
+	sessionResumeNode      string
+	interruptedWorktreeSHA string // stash commit of the worktree when the run stopped
 }
 
 // nextParallelPassCount increments and returns the dispatch count for nodeID.
@@ -277,6 +302,9 @@ type PrepareOptions struct {
 	// checks (stylesheet_unknown_model, stylesheet_noncanonical_model_id) are
 	// enabled. When nil, those checks are silently skipped.
 	Catalog *modeldb.Catalog
+	// StylesheetOverlay is a run profile's model_stylesheet. Its rules outrank
+	// the graph's own model_stylesheet rules.
+	StylesheetOverlay string
 }
 
 // Prepare parses/transforms/validates a graph.
@@ -305,8 +333,9 @@ func PrepareWithOptions(dotSource []byte, opts PrepareOptions) (*model.Graph, []
 			return g, nil, fmt.Errorf("prompt_file expansion: %w", err)
 		}
 	}
+	var rules []style.Rule
 	if raw := strings.TrimSpace(g.Attrs["model_stylesheet"]); raw != "" {
-		rules, err := style.ParseStylesheet(raw)
+		parsed, err := style.ParseStylesheet(raw)
 		if err != nil {
 			diags := []validate.Diagnostic{{
 				Rule:     "stylesheet_syntax",
@@ -315,6 +344,16 @@ func PrepareWithOptions(dotSource []byte, opts PrepareOptions) (*model.Graph, []
 			}}
 			return g, diags, fmt.Errorf("stylesheet parse: %w", err)
 		}
+		rules = parsed
+	}
+	if raw := strings.TrimSpace(opts.StylesheetOverlay); raw != "" {
+		overlay, err := style.ParseStylesheet(raw)
+		if err != nil {
+			return g, nil, fmt.Errorf("profile stylesheet parse: %w", err)
+		}
+		rules = style.WithOverlay(rules, overlay)
+	}
+	if len(rules) > 0 {
 		_ = style.ApplyStylesheet(g, rules)
 	}
 	_ = (goalExpansionTransform{}).Apply(g)
@@ -365,6 +404,9 @@ func Run(ctx context.Context, dotSource []byte, opts RunOptions) (*Result, error
 	eng := newBaseEngine(g, dotSource, opts)
 	eng.Registry = reg
 	eng.CodergenBackend = &SimulatedCodergenBackend{}
+	if opts.OnEngineReady != nil {
+		opts.OnEngineReady(eng)
+	}
 
 	return eng.run(ctx)
 }
@@ -379,25 +421,26 @@ func (e *Engine) run(ctx context.Context) (res *Result, err error) {
 		}
 	}()
 
-	if e.Options.RepoPath == "" {
-		return nil, fmt.Errorf("repo.path is required")
-	}
-	if !gitutil.IsRepo(e.Options.RepoPath) {
-		return nil, fmt.Errorf("not a git repo: %s", e.Options.RepoPath)
-	}
-	if e.Options.RequireClean {
-		clean, err := gitutil.IsClean(e.Options.RepoPath)
-		if err != nil {
-			return nil, err
+	baseSHA := ""
+	if !e.simulated {
+		if e.Options.RepoPath == "" {
+			return nil, fmt.Errorf("repo.path is required")
 		}
-		if !clean {
-			return nil, fmt.Errorf("repo has uncommitted changes (require_clean=true)")
+		if !gitutil.IsRepo(e.Options.RepoPath) {
+			return nil, fmt.Errorf("not a git repo: %s", e.Options.RepoPath)
+		}
+		if e.Options.RequireClean {
+			clean, err := gitutil.IsClean(e.Options.RepoPath)
+			if err != nil {
+				return nil, err
+			}
+			if !clean {
+				return nil, fmt.Errorf("repo has uncommitted changes (require_clean=true)")
+			}
+		}
+		if baseSHA, err = gitutil.HeadSHA(e.Options.RepoPath); err != nil {
+			return nil, err
 		}
-	}
-
-	baseSHA, err := gitutil.HeadSHA(e.Options.RepoPath)
-	if err != nil {
-		return nil, err
 	}
 	e.baseSHA = baseSHA
 	if err := os.MkdirAll(e.LogsRoot, 0o755); err != nil {
@@ -410,22 +453,24 @@ func (e *Engine) run(ctx context.Context) (res *Result, err error) {
 		_ = writeJSON(filepath.Join(e.LogsRoot, "run_config.json"), e.RunConfig)
 	}
 
-	// Create run branch at BASE_SHA and materialize a worktree for execution.
-	if err := gitutil.CreateBranchAt(e.Options.RepoPath, e.RunBranch, baseSHA); err != nil {
-		return nil, err
-	}
-	// If worktree exists (e.g., re-run), remove and recreate.
-	_ = gitutil.RemoveWorktree(e.Options.RepoPath, e.WorktreeDir)
-	if err := gitutil.AddWorktree(e.Options.RepoPath, e.WorktreeDir, e.RunBranch); err != nil {
-		return nil, err
-	}
-	// Copy gitignored files (e.g. .env, secrets, local configs) from the
-	// source repo into the run worktree. These are not committed to git so
-	// they don't survive worktree creation; agents that rely on them (e.g. for
-	// API keys or environment config) need them present without us committing
-	// sensitive material.
-	if err := gitutil.CopyIgnoredFiles(e.Options.RepoPath, e.WorktreeDir); err != nil {
-		e.Warn(fmt.Sprintf("copy ignored files to run worktree: %v", err))
+	if !e.simulated {
+		// Create run branch at BASE_SHA and materialize a worktree for execution.
+		if err := gitutil.CreateBranchAt(e.Options.RepoPath, e.RunBranch, baseSHA); err != nil {
+			return nil, err
+		}
+		// If worktree exists (e.g., re-run), remove and recreate.
+		_ = gitutil.RemoveWorktree(e.Options.RepoPath, e.WorktreeDir)
+		if err := gitutil.AddWorktree(e.Options.RepoPath, e.WorktreeDir, e.RunBranch); err != nil {
+			return nil, err
+		}
+		// Copy gitignored files (e.g. .env, secrets, local configs) from the
+		// source repo into the run worktree. These are not committed to git so
+		// they don't survive worktree creation; agents that rely on them (e.g. for
+		// API keys or environment config) need them present without us committing
+		// sensitive material.
+		if err := gitutil.CopyIgnoredFiles(e.Options.RepoPath, e.WorktreeDir); err != nil {
+			e.Warn(fmt.Sprintf("copy ignored files to run worktree: %v", err))
+		}
 	}
 	if err := e.materializeRunStartupInputs(ctx); err != nil {
 		return nil, err
@@ -444,6 +489,12 @@ func (e *Engine) run(ctx context.Context) (res *Result, err error) {
 	if err := e.cxdbRunStarted(runCtx, baseSHA); err != nil {
 		return nil, err
 	}
+	e.appendProgress(map[string]any{
+		"event":      "run_started",
+		"base_sha":   baseSHA,
+		"run_branch": e.RunBranch,
+	})
+	e.reportModelRoutes()
 
 	// Mirror graph attributes into context.
 	for k, v := range e.Graph.Attrs {
@@ -462,7 +513,9 @@ func (e *Engine) run(ctx context.Context) (res *Result, err error) {
 	}
 
 	// Capture the original logs root for loop_restart (attractor-spec §3.2 Step 7).
+	e.rootsMu.Lock()
 	e.baseLogsRoot = e.LogsRoot
+	e.rootsMu.Unlock()
 	e.setLastProgressTime(time.Now().UTC())
 	if e.Options.StallTimeout > 0 {
 		checkEvery := e.Options.StallCheckInterval
@@ -497,6 +550,9 @@ func (e *Engine) runLoop(ctx context.Context, current string, completed []string
 		if node == nil {
 			return nil, fmt.Errorf("missing node: %s", current)
 		}
+		if err := e.awaitRunControl(ctx, current); err != nil {
+			return nil, err
+		}
 
 		// Stuck-cycle detection: count how many times each node has been
 		// visited in this iteration. When max_node_visits is set (>0) and a
@@ -554,6 +610,11 @@ func (e *Engine) runLoop(ctx context.Context, current string, completed []string
 			ok, failedGate := checkGoalGates(e.Graph, nodeOutcomes)
 			if !ok && failedGate != "" {
 				retryTarget := resolveRetryTarget(e.Graph, failedGate)
+				e.appendProgress(map[string]any{
+					"event":        "goal_gate_unsatisfied",
+					"node_id":      failedGate,
+					"retry_target": retryTarget,
+				})
 				if retryTarget == "" {
 					return nil, fmt.Errorf("goal gate unsatisfied (%s) and no retry target", failedGate)
 				}
@@ -563,7 +624,9 @@ func (e *Engine) runLoop(ctx context.Context, current string, completed []string
 			}
 			e.cxdbStageStarted(ctx, node)
 			// Execute exit handler as the final checkpointed node.
-			out, err := e.executeNode(ctx, node)
+			nodeCtx, nodeSpan := startNodeSpan(ctx, node)
+			out, err := e.executeNode(nodeCtx, node)
+			finishOutcomeSpan(nodeSpan, out, 0)
 			if err != nil {
 				return nil, err
 			}
@@ -604,7 +667,11 @@ func (e *Engine) runLoop(ctx context.Context, current string, completed []string
 		}
 
 		e.cxdbStageStarted(ctx, node)
-		out, err := e.executeWithRetry(ctx, node, nodeRetries)
+		nodeCtx, nodeSpan := startNodeSpan(ctx, node)
+		e.bindSessionResume(node.ID)
+		out, err := e.executeWithRetry(nodeCtx, node, nodeRetries)
+		e.dropSessionResume()
+		finishOutcomeSpan(nodeSpan, out, nodeRetries[node.ID])
 		if err != nil {
 			return nil, err
 		}
@@ -901,6 +968,7 @@ func (e *Engine) loopRestart(ctx context.Context, targetNodeID string, fromNodeI
 	persistKeyNames := loopRestartPersistKeyNames(e.Graph)
 	e.appendProgress(map[string]any{
 		"event":              "loop_restart",
+		"node_id":            fromNodeID,
 		"restart_count":      e.restartCount,
 		"target_node":        targetNodeID,
 		"new_logs_root":      newLogsRoot,
@@ -909,7 +977,9 @@ func (e *Engine) loopRestart(ctx context.Context, targetNodeID string, fromNodeI
 	})
 
 	// Switch to fresh logs; worktree stays the same.
+	e.rootsMu.Lock()
 	e.LogsRoot = newLogsRoot
+	e.rootsMu.Unlock()
 
 	// Write run metadata into the restart directory so consumers find manifest.json.
 	if err := e.writeManifest(e.baseSHA); err != nil {
@@ -1146,34 +1216,31 @@ func (e *Engine) executeWithRetry(ctx context.Context, node *model.Node, retries
 	// FAIL/RETRY just burns retry budget and can create misleading "max retries
 	// exceeded" failures. Execute exactly once.
 	if se, ok := e.Registry.Resolve(node).(SingleExecutionHandler); ok && se.SkipRetry() {
+		archivePriorVisitDir(filepath.Join(e.LogsRoot, node.ID))
 		e.appendProgress(map[string]any{
 			"event":   "stage_attempt_start",
 			"node_id": node.ID,
 			"attempt": 1,
 			"max":     1,
 		})
-		out, _ := e.executeNode(ctx, node)
+		attemptCtx, attemptSpan := startAttemptSpan(ctx, node, 1, 1)
+		attemptStart := time.Now()
+		out, _ := e.executeNode(attemptCtx, node)
+		finishOutcomeSpan(attemptSpan, out, 0)
 		e.appendProgress(map[string]any{
 			"event":          "stage_attempt_end",
 			"node_id":        node.ID,
+			"handler_type":   resolvedHandlerType(node),
 			"attempt":        1,
 			"max":            1,
 			"status":         string(out.Status),
 			"failure_reason": out.FailureReason,
+			"duration_ms":    time.Since(attemptStart).Milliseconds(),
 		})
 		return out, nil
 	}
 
-	// Spec §3.5: retry precedence is (1) node max_retries, (2) graph default_max_retry,
-	// (3) built-in default of 3. Use -1 sentinel to distinguish "not set" from "explicitly 0"
-	// so that max_retries=0 on a node genuinely means "no retries".
-	maxRetries := parseInt(node.Attr("max_retries", ""), -1)
-	if maxRetries < 0 {
-		maxRetries = parseInt(e.Graph.Attrs["default_max_retry"], -1)
-	}
-	if maxRetries < 0 {
-		maxRetries = 3 // built-in default per spec §2.5
-	}
+	maxRetries := nodeMaxRetries(e.Graph, node)
 	maxAttempts := maxRetries + 1
 
 	// --- Escalation setup ---
@@ -1208,14 +1275,19 @@ func (e *Engine) executeWithRetry(ctx context.Context, node *model.Node, retries
 			"attempt": attempt,
 			"max":     maxAttempts,
 		})
-		out, _ := e.executeNode(ctx, node)
+		attemptCtx, attemptSpan := startAttemptSpan(ctx, node, attempt, maxAttempts)
+		attemptStart := time.Now()
+		out, _ := e.executeNode(attemptCtx, node)
+		finishOutcomeSpan(attemptSpan, out, attempt-1)
 		e.appendProgress(map[string]any{
 			"event":          "stage_attempt_end",
 			"node_id":        node.ID,
+			"handler_type":   resolvedHandlerType(node),
 			"attempt":        attempt,
 			"max":            maxAttempts,
 			"status":         string(out.Status),
 			"failure_reason": out.FailureReason,
+			"duration_ms":    time.Since(attemptStart).Milliseconds(),
 		})
 		if ctx.Err() != nil {
 			co := canceledOutcomeForRetry(ctx, out)
@@ -1288,6 +1360,9 @@ func (e *Engine) executeWithRetry(ctx context.Context, node *model.Node, retries
 			// Spec §5.1: update built-in context key internal.retry_count.<node_id> on each retry.
 			e.Context.Set(fmt.Sprintf("internal.retry_count.%s", node.ID), retries[node.ID])
 			delay := backoffDelayForNode(e.Options.RunID, e.Graph, node, attempt)
+			if e.simulated {
+				delay = 0
+			}
 			// Spec §9.6: emit StageRetrying CXDB event.
 			e.cxdbStageRetrying(ctx, node, attempt+1, delay.Milliseconds())
 			e.appendProgress(map[string]any{
@@ -1340,6 +1415,21 @@ func (e *Engine) executeWithRetry(ctx context.Context, node *model.Node, retries
 	return runtime.Outcome{Status: runtime.StatusFail, FailureReason: "max retries exceeded"}, nil
 }
 
+// nodeMaxRetries resolves a node's retry budget. Spec §3.5: retry precedence is
+// (1) node max_retries, (2) graph default_max_retry, (3) built-in default of 3.
+// Use -1 sentinel to distinguish "not set" from "explicitly 0" so that
+// max_retries=0 on a node genuinely means "no retries".
+func nodeMaxRetries(g *model.Graph, node *model.Node) int {
+	maxRetries := parseInt(node.Attr("max_retries", ""), -1)
+	if maxRetries < 0 {
+		maxRetries = parseInt(g.Attrs["default_max_retry"], -1)
+	}
+	if maxRetries < 0 {
+		maxRetries = 3 // built-in default per spec §2.5
+	}
+	return maxRetries
+}
+
 // archivePriorVisitDir preserves the contents of stageDir from a previous node
 // visit by moving all entries (files and subdirs, including any attempt_N/ dirs)
 // into a visit_N/ subdirectory. Called at the start of executeWithRetry so that
@@ -1513,7 +1603,9 @@ func (e *Engine) checkpoint(nodeID string, out runtime.Outcome, completed []stri
 			sha = strings.TrimSpace(fmt.Sprint(v))
 		}
 	}
-	if sha == "" {
+	if e.simulated {
+		sha = ""
+	} else if sha == "" {
 		var err error
 		sha, err = gitutil.CommitAllowEmptyWithExcludes(e.WorktreeDir, msg, e.checkpointExcludeGlobs())
 		if err != nil {
@@ -1553,13 +1645,26 @@ func (e *Engine) checkpoint(nodeID string, out runtime.Outcome, completed []stri
 			cp.Extra["last_thread_key"] = e.lastResolvedThreadKey
 		}
 	}
+	if len(e.ModelRoutes) > 0 {
+		cp.Extra[modelRoutesExtraKey] = modelRouteList(e.ModelRoutes)
+	}
 	cp.Extra[artifactPolicyResolvedExtraKey] = artifactPolicyResolvedEnvelope{
 		Version: artifactPolicyResolvedVersion,
 		Policy:  normalizeResolvedArtifactPolicy(e.ArtifactPolicy),
 	}
+	if e.CXDB != nil && strings.TrimSpace(e.CXDB.HeadTurnID) != "" {
+		// Lets `attractor fork` branch the CXDB context as of this node.
+		cp.Extra["cxdb_context_id"] = e.CXDB.ContextID
+		cp.Extra["cxdb_head_turn_id"] = e.CXDB.HeadTurnID
+	}
 	if err := cp.Save(filepath.Join(e.LogsRoot, "checkpoint.json")); err != nil {
 		return "", err
 	}
+	// Per-node copy so a run can be forked from any node, not just the latest
+	// checkpoint. Earlier visits' copies are archived under visit_N/.
+	if stageDir := filepath.Join(e.LogsRoot, nodeID); os.MkdirAll(stageDir, 0o755) == nil {
+		_ = cp.Save(filepath.Join(stageDir, "checkpoint.json"))
+	}
 	return sha, nil
 }
 
@@ -1615,6 +1720,12 @@ func (e *Engine) writeManifest(baseSHA string) error {
 	if len(e.Options.Labels) > 0 {
 		manifest["labels"] = copyStringStringMap(e.Options.Labels)
 	}
+	if e.Options.Profile != "" {
+		manifest["profile"] = e.Options.Profile
+	}
+	if len(e.ModelRoutes) > 0 {
+		manifest[modelRoutesExtraKey] = modelRouteList(e.ModelRoutes)
+	}
 	return writeJSON(filepath.Join(e.LogsRoot, "manifest.json"), manifest)
 }
 
@@ -1673,6 +1784,11 @@ func (e *Engine) persistTerminalOutcome(ctx context.Context, final runtime.Final
 		final.CXDBHeadTurnID = strings.TrimSpace(e.CXDB.HeadTurnID)
 	}
 
+	// The pull request pushes the branch itself so that its URL can be
+	// recorded in final.json; the final push below is then skipped.
+	var pushed bool
+	final.PullRequestURL, pushed = e.openPullRequestIfConfigured(ctx, final)
+
 	primaryPath := ""
 	for _, p := range e.finalOutcomePaths() {
 		if err := final.Save(p); err != nil {
@@ -1696,6 +1812,21 @@ func (e *Engine) persistTerminalOutcome(ctx context.Context, final runtime.Final
 		_, _ = e.CXDB.PutArtifactFile(ctx, "", "final.json", primaryPath)
 	}
 
+	// Terminal progress event (before archiving so run.tgz includes it).
+	ev := map[string]any{
+		"event":            "run_completed",
+		"status":           string(final.Status),
+		"final_commit_sha": final.FinalGitCommitSHA,
+	}
+	if final.PullRequestURL != "" {
+		ev["pull_request_url"] = final.PullRequestURL
+	}
+	if final.Status != runtime.FinalSuccess {
+		ev["event"] = "run_failed"
+		ev["failure_reason"] = final.FailureReason
+	}
+	e.appendProgress(ev)
+
 	archiveRoot := strings.TrimSpace(e.LogsRoot)
 	if archiveRoot != "" {
 		runTar := filepath.Join(archiveRoot, "run.tgz")
@@ -1710,26 +1841,29 @@ func (e *Engine) persistTerminalOutcome(ctx context.Context, final runtime.Final
 	e.terminalOutcomePersisted = true
 
 	// Best-effort push after terminal outcome so remote has final state.
-	e.gitPushIfConfigured()
+	if !pushed {
+		e.gitPushIfConfigured()
+	}
 }
 
-// gitPushIfConfigured pushes the run branch to the configured remote.
-// It is best-effort: failures are logged as warnings but never abort the run.
-func (e *Engine) gitPushIfConfigured() {
+// gitPushIfConfigured pushes the run branch to the configured remote and
+// reports whether it did. It is best-effort: failures are logged as warnings
+// but never abort the run.
+func (e *Engine) gitPushIfConfigured() bool {
 	if e == nil || e.RunConfig == nil {
-		return
+		return false
 	}
 	remote := strings.TrimSpace(e.RunConfig.Git.PushRemote)
 	if remote == "" {
-		return
+		return false
 	}
 	branch := strings.TrimSpace(e.RunBranch)
 	if branch == "" {
-		return
+		return false
 	}
 	repoDir := strings.TrimSpace(e.Options.RepoPath)
 	if repoDir == "" {
-		return
+		return false
 	}
 	e.appendProgress(map[string]any{
 		"event":  "git_push_start",
@@ -1744,13 +1878,14 @@ func (e *Engine) gitPushIfConfigured() {
 			"branch": branch,
 			"error":  err.Error(),
 		})
-		return
+		return false
 	}
 	e.appendProgress(map[string]any{
 		"event":  "git_push_ok",
 		"remote": remote,
 		"branch": branch,
 	})
+	return true
 }
 
 func (e *Engine) finalOutcomePaths() []string {
@@ -50,6 +50,8 @@ type failureDossier struct {
 	StageDir           string                   `json:"stage_dir"`
 	MissingPaths       []failureDossierPathFact `json:"missing_paths,omitempty"`
 	MissingExecutables []string                 `json:"missing_executables,omitempty"`
+	FailingTests       []string                 `json:"failing_tests,omitempty"`
+	FlakyTests         []string                 `json:"flaky_tests,omitempty"`
 	Tool               *failureDossierTool      `json:"tool,omitempty"`
 	Summary            string                   `json:"summary"`
 }
@@ -179,10 +181,28 @@ func (e *Engine) buildFailureDossier(node *model.Node, out runtime.Outcome, fail
 	searchText := collectFailureDossierSearchText(dossier, out)
 	dossier.MissingPaths = e.extractMissingPaths(searchText, dossier.Tool)
 	dossier.MissingExecutables = extractMissingExecutables(searchText)
+	dossier.FailingTests = outcomeStringList(out, "tool.tests.failures")
+	dossier.FlakyTests = outcomeStringList(out, "tool.tests.flaky")
 	dossier.Summary = buildFailureDossierSummary(dossier)
 	return dossier
 }
 
+// outcomeStringList reads a string list the handler put in ContextUpdates.
+func outcomeStringList(out runtime.Outcome, key string) []string {
+	switch v := out.ContextUpdates[key].(type) {
+	case []string:
+		return append([]string(nil), v...)
+	case []any:
+		list := make([]string, 0, len(v))
+		for _, it := range v {
+			list = append(list, fmt.Sprint(it))
+		}
+		return list
+	default:
+		return nil
+	}
+}
+
 func maxAttemptsForNode(node *model.Node, g *model.Graph) int {
 	if node == nil {
 		return 1
@@ -422,6 +442,12 @@ func buildFailureDossierSummary(d failureDossier) string {
 	if len(d.MissingExecutables) > 0 {
 		parts = append(parts, fmt.Sprintf("missing_tools=%d", len(d.MissingExecutables)))
 	}
+	if len(d.FailingTests) > 0 {
+		parts = append(parts, fmt.Sprintf("failing_tests=%d", len(d.FailingTests)))
+	}
+	if len(d.FlakyTests) > 0 {
+		parts = append(parts, fmt.Sprintf("flaky_tests=%d", len(d.FlakyTests)))
+	}
 	if strings.TrimSpace(d.FailureReason) != "" {
 		parts = append(parts, fmt.Sprintf("reason=%s", trimToRunes(strings.TrimSpace(d.FailureReason), 120)))
 	}
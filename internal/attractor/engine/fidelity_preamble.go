@@ -22,6 +22,35 @@ func buildFidelityPreamble(ctx *runtime.Context, runID string, goal string, fide
 		lines = append(lines, fmt.Sprintf("CompletedNodes: %s", strings.Join(completed, ", ")))
 	}
 
+	// Failing tests from the latest tool test_report are the most actionable
+	// input to a fix loop, so they are listed at every fidelity.
+	failing := decodeContextStringList(ctx, "tool.tests.failures")
+	if len(failing) > 0 {
+		failed, _ := ctx.Get("tool.tests.failed")
+		total, _ := ctx.Get("tool.tests.total")
+		lines = append(lines, fmt.Sprintf("FailingTests (%v of %v failed):", failed, total))
+		for _, f := range failing {
+			lines = append(lines, "- "+f)
+		}
+	}
+
+	// Likewise the uncovered lines in changed files from a failed
+	// verify.coverage gate. Coverage is measured over whole files, not just
+	// the changed lines.
+	uncovered := decodeContextStringList(ctx, "coverage.uncovered")
+	if len(uncovered) > 0 {
+		if passed, _ := ctx.Get("coverage.passed"); passed == false {
+			pct, _ := ctx.Get("coverage.percent")
+			threshold, _ := ctx.Get("coverage.threshold")
+			lines = append(lines, fmt.Sprintf("CoverageBelowThreshold (coverage %v%% < %v%%):", pct, threshold))
+			for _, u := range uncovered {
+				lines = append(lines, "- "+u)
+			}
+		} else {
+			uncovered = nil
+		}
+	}
+
 	// For truncate fidelity, intentionally keep the preamble minimal.
 	if fidelity == "truncate" {
 		return strings.Join(lines, "\n")
@@ -32,6 +61,9 @@ func buildFidelityPreamble(ctx *runtime.Context, runID string, goal string, fide
 		vals := ctx.SnapshotValues()
 		keys := make([]string, 0, len(vals))
 		for k := range vals {
+			if (k == "tool.tests.failures" && len(failing) > 0) || (k == "coverage.uncovered" && len(uncovered) > 0) {
+				continue
+			}
 			keys = append(keys, k)
 		}
 		sort.Strings(keys)
@@ -53,10 +85,16 @@ func buildFidelityPreamble(ctx *runtime.Context, runID string, goal string, fide
 }
 
 func decodeCompletedNodes(ctx *runtime.Context) []string {
+	return decodeContextStringList(ctx, "completed_nodes")
+}
+
+// decodeContextStringList reads a string list from context, which holds
+// []string when set in-process and []any after a checkpoint round trip.
+func decodeContextStringList(ctx *runtime.Context, key string) []string {
 	if ctx == nil {
 		return nil
 	}
-	v, ok := ctx.Get("completed_nodes")
+	v, ok := ctx.Get(key)
 	if !ok || v == nil {
 		return nil
 	}
@@ -0,0 +1,269 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/danshapiro/kilroy/internal/attractor/model"
+	"github.com/danshapiro/kilroy/internal/attractor/validate"
+)
+
+// A failing tool node with flaky_rerun=N reruns only its failed tests, up to
+// N times. Tests that pass on every rerun are classified as flaky; when no
+// other test failed, the outcome gets failure_class=flaky so edges can route
+// flake-only failures away from the fix loop. Reruns use flaky_rerun_command
+// (with {tests} / {tests_regex} placeholders), or are derived from a plain
+// `go test` or `pytest` tool_command.
+
+const flakyRerunMaxTests = 50
+
+var (
+	goTestFailLineRE   = regexp.MustCompile(`(?m)^\s*--- FAIL: (\S+)`)
+	goTestSetupFailRE  = regexp.MustCompile(`(?m)^FAIL\s+\S+\s+\[(?:build|setup) failed\]`)
+	pytestFailedLineRE = regexp.MustCompile(`(?m)^(?:FAILED|ERROR) (\S+::\S+)`)
+)
+
+type flakyRerunResult struct {
+	Reruns  int      `json:"reruns"`
+	Flaky   []string `json:"flaky"`
+	Failing []string `json:"failing"`
+}
+
+// flakyCandidate is a failed test: id matches it across runs, name is what the
+// rerun command selects it by.
+type flakyCandidate struct {
+	id   string
+	name string
+}
+
+// rerunFailedTests reruns the failed tests of a failing tool command when the
+// node sets flaky_rerun. It returns nil when reruns are disabled or the failed
+// tests cannot be identified or rerun.
+func rerunFailedTests(ctx context.Context, execCtx *Execution, node *model.Node, stageDir string, report *testReport, stdout, stderr []byte) *flakyRerunResult {
+	reruns := parseInt(node.Attr("flaky_rerun", ""), 0)
+	if reruns <= 0 {
+		return nil
+	}
+	combined := string(stdout) + string(stderr)
+	cands, ok := flakyCandidatesFrom(report, combined)
+	if !ok || len(cands) == 0 {
+		warnEngine(execCtx, fmt.Sprintf("node %q: flaky_rerun: could not identify the failed tests; not rerunning", node.ID))
+		return nil
+	}
+	if _, err := flakyRerunCommand(node, cands); err != nil {
+		warnEngine(execCtx, fmt.Sprintf("node %q: flaky_rerun: %v", node.ID, err))
+		return nil
+	}
+	timeout := parseDuration(node.Attr("timeout", ""), 0)
+	if timeout <= 0 {
+		timeout = 600 * time.Second
+	}
+
+	res := &flakyRerunResult{}
+	remaining := cands
+	for i := 1; i <= reruns && len(remaining) > 0 && ctx.Err() == nil; i++ {
+		cmdStr, _ := flakyRerunCommand(node, remaining)
+		out, errOut, exitCode := runLoggedShellCommand(ctx, execCtx, cmdStr, timeout, filepath.Join(stageDir, fmt.Sprintf("flaky_rerun_%d.log", i)))
+		res.Reruns = i
+		failing, known := rerunFailingIDs(execCtx, node, exitCode, out, string(out)+string(errOut))
+		var passed []flakyCandidate
+		for _, c := range remaining {
+			if !known || failing[c.id] {
+				res.Failing = append(res.Failing, c.id)
+			} else {
+				passed = append(passed, c)
+			}
+		}
+		if execCtx != nil && execCtx.Engine != nil {
+			execCtx.Engine.appendProgress(map[string]any{
+				"event":     "tool_flaky_rerun",
+				"node_id":   node.ID,
+				"rerun":     i,
+				"command":   cmdStr,
+				"exit_code": exitCode,
+				"tests":     len(remaining),
+				"passed":    len(passed),
+			})
+		}
+		remaining = passed
+	}
+	if ctx.Err() != nil {
+		// Unconfirmed tests are not flaky; a canceled rerun proves nothing.
+		for _, c := range remaining {
+			res.Failing = append(res.Failing, c.id)
+		}
+		remaining = nil
+	}
+	for _, c := range remaining {
+		res.Flaky = append(res.Flaky, c.id)
+	}
+	sort.Strings(res.Flaky)
+	sort.Strings(res.Failing)
+	if res.Flaky == nil {
+		res.Flaky = []string{}
+	}
+	return res
+}
+
+// flakyCandidatesFrom lists the failed tests from the parsed report, or from
+// go test / pytest output when the node has none. ok is false when a failure
+// cannot be pinned to a test (e.g. a build failure), so rerunning is pointless.
+func flakyCandidatesFrom(report *testReport, output string) ([]flakyCandidate, bool) {
+	seen := map[string]bool{}
+	var cands []flakyCandidate
+	add := func(c flakyCandidate) {
+		if !seen[c.id] {
+			seen[c.id] = true
+			cands = append(cands, c)
+		}
+	}
+	if report != nil && report.Failed > 0 {
+		if len(report.Failures) < report.Failed {
+			return nil, false
+		}
+		for _, f := range report.Failures {
+			c, ok := flakyCandidateFromReport(report.Format, f)
+			if !ok {
+				return nil, false
+			}
+			add(c)
+		}
+	} else {
+		if goTestSetupFailRE.MatchString(output) {
+			return nil, false
+		}
+		for _, m := range goTestFailLineRE.FindAllStringSubmatch(output, -1) {
+			name, _, _ := strings.Cut(m[1], "/")
+			add(flakyCandidate{id: name, name: name})
+		}
+		for _, m := range pytestFailedLineRE.FindAllStringSubmatch(output, -1) {
+			add(flakyCandidate{id: m[1], name: m[1]})
+		}
+	}
+	if len(cands) > flakyRerunMaxTests {
+		return nil, false
+	}
+	return cands, true
+}
+
+func flakyCandidateFromReport(format string, f testReportFailure) (flakyCandidate, bool) {
+	switch {
+	case f.Name == "" || f.Name == "Bail out!":
+		return flakyCandidate{}, false
+	case format == testReportFormatGoTestJSON:
+		if f.Name == "[package]" {
+			return flakyCandidate{}, false
+		}
+		// go test -run selects top-level tests; subtests rerun with their parent.
+		top, _, _ := strings.Cut(f.Name, "/")
+		return flakyCandidate{id: testReportFailure{Name: top, Suite: f.Suite}.FullName(), name: top}, true
+	default:
+		return flakyCandidate{id: f.FullName(), name: f.Name}, true
+	}
+}
+
+// flakyRerunCommand builds the command that reruns only cands.
+func flakyRerunCommand(node *model.Node, cands []flakyCandidate) (string, error) {
+	names := make([]string, 0, len(cands))
+	quoted := make([]string, 0, len(cands))
+	patterns := make([]string, 0, len(cands))
+	for _, c := range cands {
+		names = append(names, c.name)
+		quoted = append(quoted, shellSingleQuote(c.name))
+		patterns = append(patterns, regexp.QuoteMeta(c.name))
+	}
+	testsRegex := "^(" + strings.Join(patterns, "|") + ")$"
+	if tmpl := strings.TrimSpace(node.Attr("flaky_rerun_command", "")); tmpl != "" {
+		return strings.NewReplacer("{tests}", strings.Join(quoted, " "), "{tests_regex}", testsRegex).Replace(tmpl), nil
+	}
+	base := strings.TrimSpace(node.Attr("tool_command", ""))
+	if strings.ContainsAny(base, validate.FlakyRerunShellMetachars) {
+		return "", fmt.Errorf("tool_command is not a plain test invocation; set flaky_rerun_command")
+	}
+	switch {
+	case validate.FlakyRerunGoTestRE.MatchString(base):
+		return base + " -count=1 -run " + shellSingleQuote(testsRegex), nil
+	case validate.FlakyRerunPytestRE.MatchString(base):
+		return base + " " + strings.Join(quoted, " "), nil
+	default:
+		return "", fmt.Errorf("cannot derive a rerun command for %d tests (%s) from tool_command; set flaky_rerun_command", len(names), strings.Join(names, ", "))
+	}
+}
+
+// rerunFailingIDs returns the ids of tests that failed in a rerun. known is
+// false when the rerun failed but its failures could not be identified.
+func rerunFailingIDs(execCtx *Execution, node *model.Node, exitCode int, stdout []byte, combined string) (map[string]bool, bool) {
+	failing := map[string]bool{}
+	if exitCode == 0 {
+		return failing, true
+	}
+	report := collectToolTestReport(execCtx, node, stdout)
+	if report != nil && report.Total == 0 {
+		report = nil
+	}
+	cands, ok := flakyCandidatesFrom(report, combined)
+	if !ok || len(cands) == 0 {
+		return nil, false
+	}
+	for _, c := range cands {
+		failing[c.id] = true
+	}
+	return failing, true
+}
+
+func shellSingleQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// failureReason describes the failure with flaky tests separated out, or
+// returns "" when no test turned out to be flaky.
+func (r *flakyRerunResult) failureReason() string {
+	if r == nil || len(r.Flaky) == 0 {
+		return ""
+	}
+	if len(r.Failing) == 0 {
+		return fmt.Sprintf("only flaky tests failed (passed on %d rerun(s)): %s", r.Reruns, strings.Join(r.Flaky, ", "))
+	}
+	return fmt.Sprintf("%d tests failed again on rerun: %s (flaky, passed on rerun: %s)", len(r.Failing), strings.Join(r.Failing, ", "), strings.Join(r.Flaky, ", "))
+}
+
+// outcomeMeta classifies flake-only failures and keys the failure signature on
+// the tests that failed consistently, so which flake fired does not make a
+// repeated real failure look new to the deterministic cycle breaker.
+func (r *flakyRerunResult) outcomeMeta() map[string]any {
+	if r == nil || len(r.Flaky) == 0 {
+		return nil
+	}
+	if len(r.Failing) == 0 {
+		return map[string]any{
+			"failure_class":     failureClassFlaky,
+			"failure_signature": "flaky_tests|" + strings.Join(r.Flaky, ","),
+		}
+	}
+	return map[string]any{
+		"failure_signature": "tests_failed|" + strings.Join(r.Failing, ","),
+	}
+}
+
+// markFlaky records the rerun classification in the report.
+func (r *testReport) markFlaky(res *flakyRerunResult) {
+	if r == nil || res == nil {
+		return
+	}
+	r.Flaky = res.Flaky
+}
+
+func (r *testReport) isFlaky(f testReportFailure) bool {
+	full := f.FullName()
+	for _, id := range r.Flaky {
+		if full == id || strings.HasPrefix(full, id+"/") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,121 @@
+package engine
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/danshapiro/kilroy/internal/attractor/model"
+	"github.com/danshapiro/kilroy/internal/attractor/runtime"
+)
+
+const flakyGoOutput = "echo '--- FAIL: TestFlaky (0.01s)'; echo '    --- FAIL: TestReal/case_1 (0.00s)'; echo '--- FAIL: TestReal (0.00s)'; exit 1"
+
+func TestToolHandler_FlakyRerun_SeparatesFlakyFromRealFailures(t *testing.T) {
+	// The rerun passes TestFlaky and fails TestReal again.
+	rerun := `for t in {tests}; do if [ "$t" = TestReal ]; then echo "--- FAIL: $t (0.00s)"; fail=1; fi; done; exit ${fail:-0}`
+	out, logsRoot, _, nodeID := runToolHandler(t, "verify_go", "Verify Go", flakyGoOutput, map[string]string{
+		"flaky_rerun":         "2",
+		"flaky_rerun_command": rerun,
+	})
+	if out.Status != runtime.StatusFail {
+		t.Fatalf("status: got %q want %q", out.Status, runtime.StatusFail)
+	}
+	if got := fmt.Sprint(out.ContextUpdates["tool.tests.flaky"]); got != "[TestFlaky]" {
+		t.Fatalf("tool.tests.flaky: %s", got)
+	}
+	if want := "1 tests failed again on rerun: TestReal (flaky, passed on rerun: TestFlaky)"; out.FailureReason != want {
+		t.Fatalf("failure reason: got %q want %q", out.FailureReason, want)
+	}
+	if cls := classifyFailureClass(out); cls != failureClassDeterministic {
+		t.Fatalf("failure class: got %q want %q", cls, failureClassDeterministic)
+	}
+	if sig := restartFailureSignature(nodeID, out, failureClassDeterministic); sig != "verify_go|deterministic|tests_failed|testreal" {
+		t.Fatalf("signature: %q", sig)
+	}
+	// TestReal failed on the first rerun, so only TestFlaky is rerun again.
+	assertExists(t, filepath.Join(logsRoot, nodeID, "flaky_rerun_2.log"))
+	if b, _ := os.ReadFile(filepath.Join(logsRoot, nodeID, "flaky_rerun_2.log")); !strings.HasPrefix(string(b), "$ for t in 'TestFlaky';") {
+		t.Fatalf("second rerun should only select TestFlaky:\n%s", b)
+	}
+
+	e := &Engine{LogsRoot: logsRoot}
+	d := e.buildFailureDossier(&model.Node{ID: nodeID, Attrs: map[string]string{"shape": "parallelogram"}}, out, failureClassDeterministic, nil)
+	if strings.Join(d.FlakyTests, ",") != "TestFlaky" || !strings.Contains(d.Summary, "flaky_tests=1") {
+		t.Fatalf("dossier flaky tests: %+v", d)
+	}
+}
+
+func TestToolHandler_FlakyRerun_FlakyOnlyFailureHasFlakyClass(t *testing.T) {
+	out, logsRoot, _, nodeID := runToolHandler(t, "verify_go", "Verify Go", flakyGoOutput, map[string]string{
+		"flaky_rerun":         "2",
+		"flaky_rerun_command": "echo rerunning {tests}",
+	})
+	if cls := classifyFailureClass(out); cls != failureClassFlaky {
+		t.Fatalf("failure class: got %q want %q", cls, failureClassFlaky)
+	}
+	if want := "only flaky tests failed (passed on 2 rerun(s)): TestFlaky, TestReal"; out.FailureReason != want {
+		t.Fatalf("failure reason: got %q want %q", out.FailureReason, want)
+	}
+	if isSignatureTrackedFailureClass(failureClassFlaky) || shouldRetryOutcome(out, failureClassFlaky) {
+		t.Fatalf("flaky failures should neither feed the cycle breaker nor auto-retry")
+	}
+	assertExists(t, filepath.Join(logsRoot, nodeID, "flaky_rerun_1.log"))
+	assertExists(t, filepath.Join(logsRoot, nodeID, "flaky_rerun_2.log"))
+}
+
+func TestToolHandler_FlakyRerun_UsesTestReportAndMarksFailures(t *testing.T) {
+	events := strings.Join([]string{
+		`{"Action":"fail","Package":"example.com/m/p","Test":"TestA"}`,
+		`{"Action":"pass","Package":"example.com/m/p","Test":"TestB"}`,
+		`{"Action":"fail","Package":"example.com/m/p"}`,
+	}, "\n")
+	out, _, _, _ := runToolHandler(t, "verify_go", "Verify Go", "cat <<'EOF'\n"+events+"\nEOF\nexit 1", map[string]string{
+		"test_report":         "go-test-json",
+		"flaky_rerun":         "1",
+		"flaky_rerun_command": "echo '{tests_regex}'",
+	})
+	if cls := classifyFailureClass(out); cls != failureClassFlaky {
+		t.Fatalf("failure class: got %q want %q (reason %q)", cls, failureClassFlaky, out.FailureReason)
+	}
+	failures, _ := out.ContextUpdates["tool.tests.failures"].([]string)
+	if len(failures) != 1 || failures[0] != "example.com/m/p.TestA [flaky: passed on rerun]" {
+		t.Fatalf("tool.tests.failures: %#v", failures)
+	}
+}
+
+func TestToolHandler_FlakyRerun_SkipsBuildFailures(t *testing.T) {
+	out, _, _, _ := runToolHandler(t, "verify_go", "Verify Go", "echo 'FAIL\texample.com/m/q [build failed]'; echo '--- FAIL: TestX (0.00s)'; exit 1", map[string]string{
+		"flaky_rerun":         "1",
+		"flaky_rerun_command": "true",
+	})
+	if _, ok := out.ContextUpdates["tool.tests.flaky"]; ok {
+		t.Fatalf("build failures must not be rerun: %#v", out.ContextUpdates)
+	}
+	if cls := classifyFailureClass(out); cls == failureClassFlaky {
+		t.Fatalf("build failure classified as flaky")
+	}
+}
+
+func TestFlakyRerunCommand_DerivedFromToolCommand(t *testing.T) {
+	cands := []flakyCandidate{{id: "TestA", name: "TestA"}, {id: "TestB.x", name: "TestB.x"}}
+	cases := []struct {
+		toolCommand string
+		want        string
+		wantErr     bool
+	}{
+		{"go test ./...", `go test ./... -count=1 -run '^(TestA|TestB\.x)$'`, false},
+		{"python -m pytest -q", "python -m pytest -q 'TestA' 'TestB.x'", false},
+		{"go test ./... | tee out.log", "", true},
+		{"npm test", "", true},
+	}
+	for _, tc := range cases {
+		node := &model.Node{ID: "t", Attrs: map[string]string{"tool_command": tc.toolCommand}}
+		got, err := flakyRerunCommand(node, cands)
+		if (err != nil) != tc.wantErr || got != tc.want {
+			t.Fatalf("%q: got %q, %v; want %q (err=%v)", tc.toolCommand, got, err, tc.want, tc.wantErr)
+		}
+	}
+}
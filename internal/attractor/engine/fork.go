@@ -0,0 +1,375 @@
+package engine
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/danshapiro/kilroy/internal/attractor/dot"
+	"github.com/danshapiro/kilroy/internal/attractor/runstate"
+	"github.com/danshapiro/kilroy/internal/attractor/runtime"
+	"github.com/danshapiro/kilroy/internal/cxdb"
+)
+
+// ForkOptions describes a new run branched from an existing run's history.
+type ForkOptions struct {
+	// SourceLogsRoot is the logs root of the run being forked.
+	SourceLogsRoot string
+	// FromNode is re-executed (and everything after it) in the new run. The
+	// fork starts from the checkpoint the node that last routed into FromNode
+	// saved on that visit, so code, context and retry state are exactly as
+	// FromNode saw them when it was entered.
+	FromNode string
+	// GraphDOT replaces the source run's graph.dot when non-empty.
+	GraphDOT []byte
+	// SetAttrs are "node.attr=value" (or "graph.attr=value") overrides applied
+	// to the graph before execution.
+	SetAttrs []string
+	RunID    string
+	LogsRoot string
+}
+
+// Fork creates a new run (new run ID, logs root, branch and CXDB context)
+// starting at the checkpoint just before opts.FromNode in the source run,
+// then continues execution from FromNode.
+func Fork(ctx context.Context, opts ForkOptions) (*Result, error) {
+	srcRoot := strings.TrimSpace(opts.SourceLogsRoot)
+	fromNode := strings.TrimSpace(opts.FromNode)
+	if srcRoot == "" || fromNode == "" {
+		return nil, fmt.Errorf("fork: logs_root and from_node are required")
+	}
+	srcRoot, err := filepath.Abs(srcRoot)
+	if err != nil {
+		return nil, err
+	}
+	m, err := loadManifest(filepath.Join(srcRoot, "manifest.json"))
+	if err != nil {
+		return nil, fmt.Errorf("fork: %w", err)
+	}
+
+	hop, err := findForkPredecessor(srcRoot, fromNode)
+	if err != nil {
+		return nil, err
+	}
+	segRoot, prevNode := hop.segRoot, hop.from
+	cp, err := loadForkCheckpoint(hop, fromNode)
+	if err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(cp.GitCommitSHA) == "" {
+		return nil, fmt.Errorf("fork: checkpoint for %q missing git_commit_sha", prevNode)
+	}
+
+	graphSrc := opts.GraphDOT
+	if len(graphSrc) == 0 {
+		if graphSrc, err = os.ReadFile(filepath.Join(segRoot, "graph.dot")); err != nil {
+			return nil, fmt.Errorf("fork: read source graph: %w", err)
+		}
+	}
+	graphSrc, err = applyGraphAttrOverrides(graphSrc, opts.SetAttrs)
+	if err != nil {
+		return nil, err
+	}
+	g, _, err := Prepare(graphSrc)
+	if err != nil {
+		return nil, fmt.Errorf("fork: graph invalid: %w", err)
+	}
+	if g.Nodes[fromNode] == nil {
+		return nil, fmt.Errorf("fork: node %q not in graph", fromNode)
+	}
+
+	runID := strings.TrimSpace(opts.RunID)
+	if runID == "" {
+		if runID, err = NewRunID(); err != nil {
+			return nil, err
+		}
+	}
+	logsRoot := strings.TrimSpace(opts.LogsRoot)
+	if logsRoot == "" {
+		logsRoot = defaultLogsRoot(runID)
+	}
+	if logsRoot, err = filepath.Abs(logsRoot); err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(filepath.Join(logsRoot, "manifest.json")); err == nil {
+		return nil, fmt.Errorf("fork: logs_root already contains a run: %s", logsRoot)
+	}
+	if err := os.MkdirAll(logsRoot, 0o755); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(filepath.Join(logsRoot, "graph.dot"), graphSrc, 0o644); err != nil {
+		return nil, err
+	}
+
+	// Stage outcomes drive routing for the first hop and goal gates later on.
+	for _, id := range append([]string{prevNode}, cp.CompletedNodes...) {
+		src := filepath.Join(segRoot, id, "status.json")
+		if id == prevNode {
+			src = filepath.Join(hop.visitDir(), "status.json")
+		}
+		if _, err := os.Stat(src); err != nil {
+			continue
+		}
+		if err := os.MkdirAll(filepath.Join(logsRoot, id), 0o755); err != nil {
+			return nil, err
+		}
+		if err := copyFileContents(src, filepath.Join(logsRoot, id, "status.json")); err != nil {
+			return nil, err
+		}
+	}
+	for _, name := range []string{inputManifestFileName, inputSnapshotDirName} {
+		if st, err := os.Stat(filepath.Join(segRoot, name)); err == nil {
+			if st.IsDir() {
+				err = copyTree(filepath.Join(segRoot, name), filepath.Join(logsRoot, name))
+			} else {
+				err = copyFileContents(filepath.Join(segRoot, name), filepath.Join(logsRoot, name))
+			}
+			if err != nil {
+				return nil, fmt.Errorf("fork: copy %s: %w", name, err)
+			}
+		}
+	}
+
+	cfgPath := firstExistingPath(m.RunConfigPath, filepath.Join(segRoot, "run_config.json"))
+	var cfg *RunConfigFile
+	if cfgPath != "" {
+		if cfg, err = LoadRunConfigFile(cfgPath); err != nil {
+			return nil, fmt.Errorf("fork: load run config %s: %w", cfgPath, err)
+		}
+		if err := copyFileContents(cfgPath, filepath.Join(logsRoot, "run_config.json")); err != nil {
+			return nil, err
+		}
+	}
+	modelDBPath := ""
+	if snap := firstExistingPath(m.ModelDB.OpenRouterModelInfoPath, filepath.Join(segRoot, "modeldb", "openrouter_models.json")); snap != "" {
+		modelDBPath = filepath.Join(logsRoot, "modeldb", "openrouter_models.json")
+		if err := os.MkdirAll(filepath.Dir(modelDBPath), 0o755); err != nil {
+			return nil, err
+		}
+		if err := copyFileContents(snap, modelDBPath); err != nil {
+			return nil, err
+		}
+	}
+
+	cxdbManifest := map[string]any{}
+	if cfg != nil && strings.TrimSpace(m.CXDB.ContextID) != "" {
+		srcContextID := firstNonEmpty(anyToStringValue(cp.Extra["cxdb_context_id"]), m.CXDB.ContextID)
+		headTurnID := anyToStringValue(cp.Extra["cxdb_head_turn_id"])
+		cxdbManifest, err = forkCXDBContext(ctx, cfg, m, logsRoot, runID, srcContextID, headTurnID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// The fork is a fresh run as far as loop restarts are concerned.
+	if cp.Extra == nil {
+		cp.Extra = map[string]any{}
+	}
+	cp.Extra["base_logs_root"] = logsRoot
+	cp.Extra["restart_count"] = 0
+	delete(cp.Extra, "cxdb_context_id")
+	delete(cp.Extra, "cxdb_head_turn_id")
+	if err := cp.Save(filepath.Join(logsRoot, "checkpoint.json")); err != nil {
+		return nil, err
+	}
+
+	prefix := deriveRunBranchPrefix(m, cfg)
+	newManifest := map[string]any{
+		"run_id":          runID,
+		"graph_name":      g.Name,
+		"goal":            g.Attrs["goal"],
+		"base_sha":        cp.GitCommitSHA,
+		"run_branch":      buildRunBranch(prefix, runID),
+		"logs_root":       logsRoot,
+		"worktree":        filepath.Join(logsRoot, "worktree"),
+		"graph_dot":       filepath.Join(logsRoot, "graph.dot"),
+		"started_at":      time.Now().UTC().Format(time.RFC3339Nano),
+		"repo_path":       m.RepoPath,
+		"kilroy_v1":       true,
+		"run_config_path": "",
+		"modeldb": map[string]any{
+			"openrouter_model_info_path":   modelDBPath,
+			"openrouter_model_info_sha256": m.ModelDB.OpenRouterModelInfoSHA256,
+			"openrouter_model_info_source": m.ModelDB.OpenRouterModelInfoSource,
+		},
+		"cxdb": cxdbManifest,
+		"forked_from": map[string]any{
+			"run_id":     m.RunID,
+			"logs_root":  srcRoot,
+			"from_node":  fromNode,
+			"checkpoint": prevNode,
+			"git_sha":    cp.GitCommitSHA,
+		},
+	}
+	if cfg != nil {
+		newManifest["run_config_path"] = filepath.Join(logsRoot, "run_config.json")
+	}
+	if len(m.ForceModels) > 0 {
+		newManifest["force_models"] = copyStringStringMap(m.ForceModels)
+	}
+	if m.Profile != "" {
+		newManifest["profile"] = m.Profile
+	}
+	if err := writeJSON(filepath.Join(logsRoot, "manifest.json"), newManifest); err != nil {
+		return nil, err
+	}
+
+	return resumeFromLogsRoot(ctx, logsRoot, ResumeOverrides{StartNodeID: fromNode})
+}
+
+// forkHop is the transition a fork branches at: the latest edge into the
+// forked node.
+type forkHop struct {
+	segRoot string    // logs root or restart segment holding the hop
+	from    string    // node the hop came from
+	visit   int       // which visit of from (1-based, within segRoot) took the hop
+	at      time.Time // when the hop was taken; zero if not recorded
+}
+
+// findForkPredecessor locates the latest hop into fromNode across the run's
+// logs root and its loop-restart segments, and which visit of the
+// predecessor took it.
+func findForkPredecessor(srcRoot, fromNode string) (forkHop, error) {
+	segs := runstate.RestartSegments(srcRoot)
+
+	var hop forkHop
+	for _, seg := range segs {
+		f, err := os.Open(filepath.Join(seg, "progress.ndjson"))
+		if err != nil {
+			continue
+		}
+		// Stage directories, and so visit numbers, are per segment.
+		visits := map[string]int{}
+		sc := bufio.NewScanner(f)
+		sc.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+		for sc.Scan() {
+			var ev map[string]any
+			if json.Unmarshal(sc.Bytes(), &ev) != nil {
+				continue
+			}
+			switch eventFieldString(ev, "event") {
+			case "stage_attempt_start":
+				if attempt, _ := ev["attempt"].(float64); attempt == 1 {
+					visits[eventFieldString(ev, "node_id")]++
+				}
+			case "edge_selected":
+				if eventFieldString(ev, "to_node") != fromNode {
+					continue
+				}
+				from := eventFieldString(ev, "from_node")
+				at, _ := time.Parse(time.RFC3339Nano, eventFieldString(ev, "ts"))
+				hop = forkHop{segRoot: seg, from: from, visit: visits[from], at: at}
+			}
+		}
+		_ = f.Close()
+	}
+	if hop.from == "" {
+		return forkHop{}, fmt.Errorf("fork: no recorded transition into %q (it is the start node or was never reached)", fromNode)
+	}
+	return hop, nil
+}
+
+// visitDir is the predecessor's stage directory for the visit that took the
+// hop. A stage directory holds the node's latest visit, with earlier visits
+// archived under visit_N/.
+func (h forkHop) visitDir() string {
+	stageDir := filepath.Join(h.segRoot, h.from)
+	archived := 0
+	if entries, err := os.ReadDir(stageDir); err == nil {
+		for _, e := range entries {
+			if e.IsDir() && strings.HasPrefix(e.Name(), "visit_") {
+				archived++
+			}
+		}
+	}
+	if h.visit > 0 && h.visit <= archived {
+		return filepath.Join(stageDir, fmt.Sprintf("visit_%d", h.visit))
+	}
+	return stageDir
+}
+
+// loadForkCheckpoint loads the checkpoint the predecessor saved on the visit
+// that took hop.
+func loadForkCheckpoint(hop forkHop, fromNode string) (*runtime.Checkpoint, error) {
+	cp, err := runtime.LoadCheckpoint(filepath.Join(hop.visitDir(), "checkpoint.json"))
+	if err != nil {
+		// Runs recorded before per-node checkpoints only have the latest one.
+		if root, rerr := runtime.LoadCheckpoint(filepath.Join(hop.segRoot, "checkpoint.json")); rerr == nil && strings.TrimSpace(root.CurrentNode) == hop.from {
+			cp, err = root, nil
+		}
+	}
+	if err != nil || cp == nil {
+		return nil, fmt.Errorf("fork: no checkpoint recorded for %q in %s", hop.from, hop.segRoot)
+	}
+	// A checkpoint saved after the hop belongs to a later visit.
+	if !hop.at.IsZero() && cp.Timestamp.After(hop.at) {
+		return nil, fmt.Errorf("fork: %q ran again after routing into %q and the checkpoint of that visit was not kept", hop.from, fromNode)
+	}
+	return cp, nil
+}
+
+// applyGraphAttrOverrides applies "node.attr=value" / "graph.attr=value"
+// overrides and re-serializes the graph.
+func applyGraphAttrOverrides(src []byte, sets []string) ([]byte, error) {
+	if len(sets) == 0 {
+		return src, nil
+	}
+	g, err := dot.Parse(src)
+	if err != nil {
+		return nil, fmt.Errorf("fork: parse graph: %w", err)
+	}
+	for _, s := range sets {
+		target, value, ok := strings.Cut(s, "=")
+		id, attr, ok2 := strings.Cut(strings.TrimSpace(target), ".")
+		id, attr = strings.TrimSpace(id), strings.TrimSpace(attr)
+		if !ok || !ok2 || id == "" || attr == "" {
+			return nil, fmt.Errorf("fork: invalid --set-attr %q (want node.attr=value)", s)
+		}
+		if id == "graph" {
+			g.Attrs[attr] = value
+			continue
+		}
+		n := g.Nodes[id]
+		if n == nil {
+			return nil, fmt.Errorf("fork: --set-attr %q: node %q not in graph", s, id)
+		}
+		n.Attrs[attr] = value
+	}
+	return dot.Format(g), nil
+}
+
+func forkCXDBContext(ctx context.Context, cfg *RunConfigFile, m *manifest, logsRoot, runID, contextID, headTurnID string) (map[string]any, error) {
+	cfgForCXDB := *cfg
+	cfgForCXDB.CXDB.HTTPBaseURL = firstNonEmpty(cfg.CXDB.HTTPBaseURL, m.CXDB.HTTPBaseURL)
+	client, bin, startup, err := ensureCXDBReady(ctx, &cfgForCXDB, logsRoot, runID)
+	if err != nil {
+		return nil, fmt.Errorf("fork: %w", err)
+	}
+	defer func() { _ = bin.Close() }()
+	if startup != nil {
+		defer func() { _ = startup.shutdownManagedProcesses() }()
+	}
+	bundleID, bundle, _, err := cxdb.KilroyAttractorRegistryBundle()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := client.PublishRegistryBundle(ctx, bundleID, bundle); err != nil {
+		return nil, err
+	}
+	src := NewCXDBSink(client, bin, runID, contextID, headTurnID, bundleID)
+	forked, err := src.ForkFromHead(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("fork: cxdb context %s: %w", contextID, err)
+	}
+	return map[string]any{
+		"http_base_url":      client.BaseURL,
+		"context_id":         forked.ContextID,
+		"head_turn_id":       forked.HeadTurnID,
+		"registry_bundle_id": bundleID,
+	}, nil
+}
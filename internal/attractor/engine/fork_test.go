@@ -0,0 +1,234 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/danshapiro/kilroy/internal/attractor/runtime"
+)
+
+func TestFork_RerunsNodeFromPredecessorCheckpointWithOverrides(t *testing.T) {
+	repo := initTestRepo(t)
+	pinned := writePinnedCatalog(t)
+	cxdbSrv := newCXDBTestServer(t)
+
+	cfg := &RunConfigFile{Version: 1}
+	cfg.Repo.Path = repo
+	cfg.CXDB.BinaryAddr = cxdbSrv.BinaryAddr()
+	cfg.CXDB.HTTPBaseURL = cxdbSrv.URL()
+	cfg.ModelDB.OpenRouterModelInfoPath = pinned
+	cfg.ModelDB.OpenRouterModelInfoUpdatePolicy = "pinned"
+	cfg.Git.RunBranchPrefix = "attractor/run"
+
+	dot := []byte(`
+digraph G {
+  graph [goal="fork"]
+  start [shape=Mdiamond]
+  exit  [shape=Msquare]
+  build [shape=parallelogram, tool_command="echo built > build.txt"]
+  final [shape=parallelogram, tool_command="echo original > final.txt"]
+  start -> build -> final -> exit
+}
+`)
+	ctx, cancel := context.WithTimeout(context.Background(), 90*time.Second)
+	defer cancel()
+	src, err := RunWithConfig(ctx, dot, cfg, RunOptions{RunID: "fork-src", LogsRoot: t.TempDir()})
+	if err != nil {
+		t.Fatalf("RunWithConfig: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(src.LogsRoot, "build", "checkpoint.json")); err != nil {
+		t.Fatalf("per-node checkpoint missing: %v", err)
+	}
+
+	forkRoot := filepath.Join(t.TempDir(), "fork")
+	res, err := Fork(ctx, ForkOptions{
+		SourceLogsRoot: src.LogsRoot,
+		FromNode:       "final",
+		SetAttrs:       []string{`final.tool_command=echo forked > final.txt && cat build.txt`},
+		RunID:          "fork-dst",
+		LogsRoot:       forkRoot,
+	})
+	if err != nil {
+		t.Fatalf("Fork: %v", err)
+	}
+	if res.FinalStatus != "success" || res.RunID != "fork-dst" || res.RunBranch != "attractor/run/fork-dst" {
+		t.Fatalf("fork result: %+v", res)
+	}
+	got, err := os.ReadFile(filepath.Join(res.WorktreeDir, "final.txt"))
+	if err != nil || strings.TrimSpace(string(got)) != "forked" {
+		t.Fatalf("final.txt in fork worktree: %q err=%v", got, err)
+	}
+	if _, err := os.Stat(filepath.Join(res.WorktreeDir, "build.txt")); err != nil {
+		t.Fatalf("fork should start from build's checkpoint commit: %v", err)
+	}
+	if out := runCmdOut(t, repo, "git", "show", src.RunBranch+":final.txt"); strings.TrimSpace(out) != "original" {
+		t.Fatalf("source branch must be untouched, final.txt=%q", out)
+	}
+
+	// Only the forked node (and exit) ran in the new run.
+	progress, err := os.ReadFile(filepath.Join(forkRoot, "progress.ndjson"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(progress), `"node_id":"build"`) {
+		t.Fatalf("fork re-ran build:\n%s", progress)
+	}
+
+	var srcManifest, manifest struct {
+		CXDB struct {
+			ContextID string `json:"context_id"`
+		} `json:"cxdb"`
+		ForkedFrom map[string]any `json:"forked_from"`
+	}
+	for path, dst := range map[string]any{
+		filepath.Join(src.LogsRoot, "manifest.json"): &srcManifest,
+		filepath.Join(forkRoot, "manifest.json"):     &manifest,
+	} {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := json.Unmarshal(b, dst); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if manifest.CXDB.ContextID == "" || manifest.CXDB.ContextID == srcManifest.CXDB.ContextID {
+		t.Fatalf("fork should get its own cxdb context: src=%q fork=%q", srcManifest.CXDB.ContextID, manifest.CXDB.ContextID)
+	}
+	if manifest.ForkedFrom["run_id"] != "fork-src" || manifest.ForkedFrom["checkpoint"] != "build" {
+		t.Fatalf("forked_from: %v", manifest.ForkedFrom)
+	}
+}
+
+func TestFork_LoopedPredecessorUsesCheckpointOfTheVisitThatRouted(t *testing.T) {
+	repo := initTestRepo(t)
+	pinned := writePinnedCatalog(t)
+	cxdbSrv := newCXDBTestServer(t)
+
+	cfg := &RunConfigFile{Version: 1}
+	cfg.Repo.Path = repo
+	cfg.CXDB.BinaryAddr = cxdbSrv.BinaryAddr()
+	cfg.CXDB.HTTPBaseURL = cxdbSrv.URL()
+	cfg.ModelDB.OpenRouterModelInfoPath = pinned
+	cfg.ModelDB.OpenRouterModelInfoUpdatePolicy = "pinned"
+	cfg.Git.RunBranchPrefix = "attractor/run"
+
+	// count runs twice: start -> count -> review -> count -> done -> exit.
+	// The hop into review was taken by count's first visit.
+	dot := []byte(`
+digraph G {
+  graph [goal="fork a loop"]
+  start  [shape=Mdiamond]
+  exit   [shape=Msquare]
+  count  [shape=parallelogram, tool_command="n=$(cat n.txt 2>/dev/null || echo 0); n=$((n+1)); echo $n > n.txt; printf $n"]
+  review [shape=parallelogram, tool_command="echo reviewed >> review.txt"]
+  done   [shape=parallelogram, tool_command="echo done > done.txt"]
+  start -> count
+  count -> review [condition="context.tool.output=1"]
+  count -> done
+  review -> count
+  done -> exit
+}
+`)
+	ctx, cancel := context.WithTimeout(context.Background(), 90*time.Second)
+	defer cancel()
+	src, err := RunWithConfig(ctx, dot, cfg, RunOptions{RunID: "fork-loop-src", LogsRoot: t.TempDir()})
+	if err != nil || src.FinalStatus != "success" {
+		t.Fatalf("RunWithConfig: %+v %v", src, err)
+	}
+
+	forkRoot := filepath.Join(t.TempDir(), "fork")
+	res, err := Fork(ctx, ForkOptions{SourceLogsRoot: src.LogsRoot, FromNode: "review", RunID: "fork-loop-dst", LogsRoot: forkRoot})
+	if err != nil {
+		t.Fatalf("Fork: %v", err)
+	}
+	if res.FinalStatus != "success" {
+		t.Fatalf("fork result: %+v", res)
+	}
+	// Started from count's first visit (n=1): review runs once more, then
+	// count's second visit takes the run to done. From count's later
+	// checkpoint it would have counted to 3.
+	if got, err := os.ReadFile(filepath.Join(res.WorktreeDir, "n.txt")); err != nil || strings.TrimSpace(string(got)) != "2" {
+		t.Fatalf("n.txt in fork worktree: %q err=%v", got, err)
+	}
+	if got, _ := os.ReadFile(filepath.Join(res.WorktreeDir, "review.txt")); strings.Count(string(got), "reviewed") != 1 {
+		t.Fatalf("review.txt in fork worktree: %q", got)
+	}
+	first, err := runtime.LoadCheckpoint(filepath.Join(src.LogsRoot, "count", "visit_1", "checkpoint.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var manifest struct {
+		ForkedFrom map[string]any `json:"forked_from"`
+	}
+	b, _ := os.ReadFile(filepath.Join(forkRoot, "manifest.json"))
+	if err := json.Unmarshal(b, &manifest); err != nil {
+		t.Fatal(err)
+	}
+	if manifest.ForkedFrom["git_sha"] != first.GitCommitSHA {
+		t.Fatalf("forked_from.git_sha=%v want count's first checkpoint %s", manifest.ForkedFrom["git_sha"], first.GitCommitSHA)
+	}
+}
+
+func TestFork_RejectsPredecessorCheckpointSavedAfterTheHop(t *testing.T) {
+	// A run whose stage directories were not archived per visit: the only
+	// checkpoint for p is from the visit after it routed into a.
+	root := t.TempDir()
+	hopAt := time.Now().UTC()
+	progress := strings.Join([]string{
+		`{"event":"stage_attempt_start","node_id":"p","attempt":1}`,
+		`{"event":"edge_selected","from_node":"p","to_node":"a","ts":"` + hopAt.Format(time.RFC3339Nano) + `"}`,
+		`{"event":"stage_attempt_start","node_id":"p","attempt":1}`,
+	}, "\n") + "\n"
+	if err := os.WriteFile(filepath.Join(root, "progress.ndjson"), []byte(progress), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cp := runtime.NewCheckpoint()
+	cp.CurrentNode = "p"
+	cp.Timestamp = hopAt.Add(time.Second)
+	if err := os.MkdirAll(filepath.Join(root, "p"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := cp.Save(filepath.Join(root, "p", "checkpoint.json")); err != nil {
+		t.Fatal(err)
+	}
+	hop, err := findForkPredecessor(root, "a")
+	if err != nil || hop.visit != 1 {
+		t.Fatalf("predecessor: %+v %v", hop, err)
+	}
+	if _, err := loadForkCheckpoint(hop, "a"); err == nil || !strings.Contains(err.Error(), "ran again") {
+		t.Fatalf("expected a stale-checkpoint error, got %v", err)
+	}
+}
+
+func TestFork_RejectsStartNodeAndBadOverrides(t *testing.T) {
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "progress.ndjson"), []byte(`{"event":"edge_selected","from_node":"start","to_node":"a"}`+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := findForkPredecessor(root, "start"); err == nil {
+		t.Fatalf("expected error forking from the start node")
+	}
+	if hop, err := findForkPredecessor(root, "a"); err != nil || hop.segRoot != root || hop.from != "start" {
+		t.Fatalf("predecessor: %+v %v", hop, err)
+	}
+
+	src := []byte(`digraph G { start [shape=Mdiamond]; a [shape=box]; start -> a }`)
+	for _, bad := range []string{"a", "a.=x", "missing.prompt=x"} {
+		if _, err := applyGraphAttrOverrides(src, []string{bad}); err == nil {
+			t.Fatalf("expected error for --set-attr %q", bad)
+		}
+	}
+	out, err := applyGraphAttrOverrides(src, []string{"a.prompt=hi there", "graph.goal=g"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(out), `prompt="hi there"`) || !strings.Contains(string(out), `goal="g"`) {
+		t.Fatalf("overrides not applied:\n%s", out)
+	}
+}
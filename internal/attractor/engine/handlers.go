@@ -77,6 +77,7 @@ func NewDefaultRegistry() *HandlerRegistry {
 	reg.Register("parallel.fan_in", &FanInHandler{})
 	reg.Register("tool", &ToolHandler{})
 	reg.Register("stack.manager_loop", &ManagerLoopHandler{})
+	reg.Register("verify.coverage", &CoverageGateHandler{})
 	reg.defaultHandler = &CodergenHandler{}
 	reg.Register("codergen", reg.defaultHandler)
 	return reg
@@ -119,28 +120,7 @@ func (r *HandlerRegistry) Resolve(n *model.Node) Handler {
 }
 
 func shapeToType(shape string) string {
-	switch shape {
-	case "Mdiamond", "circle":
-		return "start"
-	case "Msquare", "doublecircle":
-		return "exit"
-	case "box":
-		return "codergen"
-	case "hexagon":
-		return "wait.human"
-	case "diamond":
-		return "conditional"
-	case "component":
-		return "parallel"
-	case "tripleoctagon":
-		return "parallel.fan_in"
-	case "parallelogram":
-		return "tool"
-	case "house":
-		return "stack.manager_loop"
-	default:
-		return "codergen"
-	}
+	return model.ShapeHandlerType(shape)
 }
 
 type StartHandler struct{}
@@ -433,6 +413,10 @@ func (h *CodergenHandler) Execute(ctx context.Context, exec *Execution, node *mo
 		})
 	}
 
+	if msgs := claimPromptSteering(ctx, exec, node.ID, stageDir); len(msgs) > 0 {
+		promptText = withSteeringPrompt(promptText, msgs)
+	}
+
 	if err := os.WriteFile(filepath.Join(stageDir, "prompt.md"), []byte(promptText), 0o644); err != nil {
 		return runtime.Outcome{Status: runtime.StatusFail, FailureReason: err.Error()}, err
 	}
@@ -578,9 +562,22 @@ func (h *WaitHumanHandler) Execute(ctx context.Context, exec *Execution, node *m
 	// Spec §9.6: emit InterviewStarted CXDB event.
 	interviewStart := time.Now()
 	exec.Engine.cxdbInterviewStarted(ctx, node.ID, q.Text, string(q.Type))
+	exec.Engine.appendProgress(map[string]any{
+		"event":         "human_gate_waiting",
+		"node_id":       node.ID,
+		"question":      q.Text,
+		"question_type": string(q.Type),
+	})
 
 	ans := interviewer.Ask(q)
 	interviewDurationMS := time.Since(interviewStart).Milliseconds()
+	exec.Engine.appendProgress(map[string]any{
+		"event":     "human_gate_answered",
+		"node_id":   node.ID,
+		"wait_ms":   interviewDurationMS,
+		"timed_out": ans.TimedOut,
+		"skipped":   ans.Skipped,
+	})
 
 	if ans.TimedOut {
 		// Spec §9.6: emit InterviewTimeout CXDB event.
@@ -722,11 +719,12 @@ func (h *ToolHandler) Execute(ctx context.Context, execCtx *Execution, node *mod
 	defer cancel()
 	cmd := exec.CommandContext(cctx, "bash", "-c", cmdStr)
 	cmd.Dir = execCtx.WorktreeDir
-	cmd.Env = buildBaseNodeEnv(artifactPolicyFromExecution(execCtx))
+	cmd.Env = withTraceparentEnv(ctx, buildBaseNodeEnv(artifactPolicyFromExecution(execCtx)))
 	// Avoid hanging on interactive reads; tool_command doesn't provide a way to supply stdin.
 	cmd.Stdin = strings.NewReader("")
 	stdoutPath := filepath.Join(stageDir, "stdout.log")
 	stderrPath := filepath.Join(stageDir, toolStderrFileName)
+	_ = os.Remove(filepath.Join(stageDir, testReportFileName))
 	stdoutFile, err := os.Create(stdoutPath)
 	if err != nil {
 		return runtime.Outcome{Status: runtime.StatusFail, FailureReason: err.Error()}, nil
@@ -784,12 +782,24 @@ func (h *ToolHandler) Execute(ctx context.Context, execCtx *Execution, node *mod
 	}
 	emitBrowserArtifactCollection(execCtx, node, stageDir, isBrowserVerifyNode, baseline, startedAt)
 
+	report := collectToolTestReport(execCtx, node, stdoutBytes)
+	var flaky *flakyRerunResult
+	if runErr != nil {
+		flaky = rerunFailedTests(ctx, execCtx, node, stageDir, report, stdoutBytes, stderrBytes)
+		report.markFlaky(flaky)
+	}
+	writeTestReport(execCtx, stageDir, report)
+
 	combined := append(append([]byte{}, stdoutBytes...), stderrBytes...)
 	combinedStr := string(combined)
 	if runErr != nil {
 		rawExitStatus := strings.TrimSpace(runErr.Error())
 		failureReason := rawExitStatus
-		if isBrowserVerifyNode {
+		if reason := flaky.failureReason(); reason != "" {
+			failureReason = reason
+		} else if reason := report.failureReason(); reason != "" {
+			failureReason = reason
+		} else if isBrowserVerifyNode {
 			if line := firstActionableToolOutputLine(stderrBytes); line != "" {
 				failureReason = line
 			} else if line := firstActionableToolOutputLine(stdoutBytes); line != "" {
@@ -811,13 +821,25 @@ func (h *ToolHandler) Execute(ctx context.Context, execCtx *Execution, node *mod
 				execCtx.Engine.Warn(fmt.Sprintf("cxdb append ToolResult failed (node=%s call_id=%s): %v", node.ID, callID, err))
 			}
 		}
+		updates := map[string]any{
+			"tool.output":      truncate(combinedStr, 8_000),
+			"tool.exit_status": rawExitStatus,
+		}
+		if report != nil {
+			for k, v := range report.contextUpdates(stageDir) {
+				updates[k] = v
+			}
+		}
+		var meta map[string]any
+		if flaky != nil {
+			updates["tool.tests.flaky"] = flaky.Flaky
+			meta = flaky.outcomeMeta()
+		}
 		return runtime.Outcome{
-			Status:        runtime.StatusFail,
-			FailureReason: failureReason,
-			ContextUpdates: map[string]any{
-				"tool.output":      truncate(combinedStr, 8_000),
-				"tool.exit_status": rawExitStatus,
-			},
+			Status:         runtime.StatusFail,
+			FailureReason:  failureReason,
+			ContextUpdates: updates,
+			Meta:           meta,
 		}, nil
 	}
 	if execCtx != nil && execCtx.Engine != nil && execCtx.Engine.CXDB != nil {
@@ -832,12 +854,18 @@ func (h *ToolHandler) Execute(ctx context.Context, execCtx *Execution, node *mod
 			execCtx.Engine.Warn(fmt.Sprintf("cxdb append ToolResult failed (node=%s call_id=%s): %v", node.ID, callID, err))
 		}
 	}
+	updates := map[string]any{
+		"tool.output": truncate(combinedStr, 8_000),
+	}
+	if report != nil {
+		for k, v := range report.contextUpdates(stageDir) {
+			updates[k] = v
+		}
+	}
 	return runtime.Outcome{
-		Status: runtime.StatusSuccess,
-		ContextUpdates: map[string]any{
-			"tool.output": truncate(combinedStr, 8_000),
-		},
-		Notes: "tool completed",
+		Status:         runtime.StatusSuccess,
+		ContextUpdates: updates,
+		Notes:          "tool completed",
 	}, nil
 }
 
@@ -866,6 +894,31 @@ func emitBrowserArtifactCollection(execCtx *Execution, node *model.Node, stageDi
 	execCtx.Engine.appendProgress(event)
 }
 
+// runLoggedShellCommand runs cmdStr in the worktree with the tool_command
+// environment and writes the command and its output to logPath. The exit code
+// is -1 when the command timed out or could not start.
+func runLoggedShellCommand(ctx context.Context, execCtx *Execution, cmdStr string, timeout time.Duration, logPath string) ([]byte, []byte, int) {
+	cctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	cmd := exec.CommandContext(cctx, "bash", "-c", cmdStr)
+	cmd.Dir = execCtx.WorktreeDir
+	cmd.Env = withTraceparentEnv(ctx, buildBaseNodeEnv(artifactPolicyFromExecution(execCtx)))
+	cmd.Stdin = strings.NewReader("")
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	_ = cmd.Run()
+	exitCode := -1
+	if cmd.ProcessState != nil && cctx.Err() == nil {
+		exitCode = cmd.ProcessState.ExitCode()
+	}
+	logBody := "$ " + cmdStr + "\n" + stdout.String() + stderr.String()
+	if err := os.WriteFile(logPath, []byte(logBody), 0o644); err != nil {
+		warnEngine(execCtx, fmt.Sprintf("write %s: %v", filepath.Base(logPath), err))
+	}
+	return stdout.Bytes(), stderr.Bytes(), exitCode
+}
+
 func firstActionableToolOutputLine(data []byte) string {
 	if len(data) == 0 {
 		return ""
@@ -16,6 +16,7 @@ const (
 	failureClassBudgetExhausted      = "budget_exhausted"
 	failureClassCompilationLoop      = "compilation_loop"
 	failureClassStructural           = "structural"
+	failureClassFlaky                = "flaky"
 	defaultLoopRestartSignatureLimit = 3
 	// 0 disables visit-count cycle breaking unless max_node_visits is explicitly set.
 	defaultMaxNodeVisits = 0
@@ -174,6 +175,8 @@ func normalizedFailureClass(raw string) string {
 		return failureClassCompilationLoop
 	case "structural", "structure", "scope_violation", "write_scope_violation":
 		return failureClassStructural
+	case "flaky", "flake", "flaky_test", "flaky_tests":
+		return failureClassFlaky
 	default:
 		return failureClassDeterministic
 	}
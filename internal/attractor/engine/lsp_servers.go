@@ -0,0 +1,103 @@
+package engine
+
+import (
+	"fmt"
+	"os/exec"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/danshapiro/kilroy/internal/agent"
+	"github.com/danshapiro/kilroy/internal/attractor/model"
+)
+
+// builtinLSPServers are the language servers the `lsp` attribute can name
+// without any run.yaml configuration.
+var builtinLSPServers = map[string]LSPServerConfig{
+	"go":         {Command: []string{"gopls"}, Extensions: []string{".go"}},
+	"rust":       {Command: []string{"rust-analyzer"}, Extensions: []string{".rs"}},
+	"python":     {Command: []string{"pyright-langserver", "--stdio"}, Extensions: []string{".py", ".pyi"}},
+	"typescript": {Command: []string{"typescript-language-server", "--stdio"}, Extensions: []string{".ts", ".tsx", ".mts", ".cts", ".js", ".jsx", ".mjs", ".cjs"}},
+}
+
+func validateLSPServer(name string, srv LSPServerConfig) error {
+	if !mcpServerNameRE.MatchString(name) {
+		return fmt.Errorf("invalid server name %q (letters, digits and underscores)", name)
+	}
+	if len(srv.Command) == 0 {
+		return fmt.Errorf("command is required")
+	}
+	if len(srv.Extensions) == 0 {
+		return fmt.Errorf("extensions is required")
+	}
+	for _, ext := range srv.Extensions {
+		if !strings.HasPrefix(ext, ".") {
+			return fmt.Errorf("extension %q must start with a dot", ext)
+		}
+	}
+	return nil
+}
+
+// resolveLSPServers returns the language servers for an agent_loop stage from
+// its `lsp` attribute: a comma-separated list of server names (built-in or
+// run.yaml lsp.servers), or "auto" for every known server whose command is
+// on PATH. Empty or "none" disables the code-intelligence tools.
+func resolveLSPServers(cfg *RunConfigFile, node *model.Node) ([]agent.LSPServerConfig, error) {
+	sel := strings.TrimSpace(node.Attr("lsp", ""))
+	if sel == "" || strings.EqualFold(sel, "none") {
+		return nil, nil
+	}
+	servers := map[string]LSPServerConfig{}
+	for name, srv := range builtinLSPServers {
+		servers[name] = srv
+	}
+	if cfg != nil {
+		for name, srv := range cfg.LSP.Servers {
+			servers[name] = srv
+		}
+	}
+	var names []string
+	auto := strings.EqualFold(sel, "auto")
+	if auto {
+		for name, srv := range servers {
+			if _, err := exec.LookPath(srv.Command[0]); err == nil {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+	} else {
+		for _, name := range strings.Split(sel, ",") {
+			name = strings.TrimSpace(name)
+			if name == "" {
+				continue
+			}
+			srv, ok := servers[name]
+			if !ok {
+				known := make([]string, 0, len(servers))
+				for k := range servers {
+					known = append(known, k)
+				}
+				sort.Strings(known)
+				return nil, fmt.Errorf("lsp: unknown server %q (known: %s)", name, strings.Join(known, ", "))
+			}
+			if _, err := exec.LookPath(srv.Command[0]); err != nil {
+				return nil, fmt.Errorf("lsp: server %s: %s not found on PATH", name, srv.Command[0])
+			}
+			names = append(names, name)
+		}
+	}
+	out := make([]agent.LSPServerConfig, 0, len(names))
+	for _, name := range names {
+		srv := servers[name]
+		out = append(out, agent.LSPServerConfig{
+			Name:           name,
+			Command:        append([]string{}, srv.Command...),
+			Env:            expandEnvValues(srv.Env),
+			Extensions:     append([]string{}, srv.Extensions...),
+			LanguageID:     strings.TrimSpace(srv.LanguageID),
+			StartupTimeout: time.Duration(srv.StartupTimeoutMS) * time.Millisecond,
+			RequestTimeout: time.Duration(srv.RequestTimeoutMS) * time.Millisecond,
+		})
+	}
+	return out, nil
+}
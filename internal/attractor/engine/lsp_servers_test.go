@@ -0,0 +1,59 @@
+package engine
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/danshapiro/kilroy/internal/attractor/dot"
+)
+
+func TestResolveLSPServers_SelectionAutoAndConfigOverrides(t *testing.T) {
+	bin := t.TempDir()
+	if err := os.WriteFile(filepath.Join(bin, "gopls"), []byte("#!/bin/sh\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin)
+	t.Setenv("ZIG_LOG", "debug")
+	cfg := &RunConfigFile{}
+	cfg.LSP.Servers = map[string]LSPServerConfig{
+		"zig": {Command: []string{filepath.Join(bin, "gopls"), "--zig"}, Extensions: []string{".zig"}, Env: map[string]string{"LOG": "${ZIG_LOG}"}, RequestTimeoutMS: 2500},
+	}
+	g, err := dot.Parse([]byte(`
+digraph G {
+  start [shape=Mdiamond]
+  none [shape=box]
+  auto [shape=box, lsp=auto]
+  pick [shape=box, lsp="zig, go"]
+  missing [shape=box, lsp=rust]
+  unknown [shape=box, lsp=cobol]
+}
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := resolveLSPServers(cfg, g.Nodes["none"]); err != nil || got != nil {
+		t.Fatalf("no lsp attr: %+v %v", got, err)
+	}
+	got, err := resolveLSPServers(cfg, g.Nodes["auto"])
+	if err != nil || len(got) != 2 || got[0].Name != "go" || got[1].Name != "zig" {
+		t.Fatalf("auto should pick servers found on PATH: %+v %v", got, err)
+	}
+	got, err = resolveLSPServers(cfg, g.Nodes["pick"])
+	if err != nil || len(got) != 2 || got[0].Name != "zig" || got[0].Env["LOG"] != "debug" || got[0].RequestTimeout.Milliseconds() != 2500 || got[1].Extensions[0] != ".go" {
+		t.Fatalf("explicit selection: %+v %v", got, err)
+	}
+	if _, err := resolveLSPServers(cfg, g.Nodes["missing"]); err == nil || !strings.Contains(err.Error(), "rust-analyzer not found") {
+		t.Fatalf("missing binary: %v", err)
+	}
+	if _, err := resolveLSPServers(cfg, g.Nodes["unknown"]); err == nil || !strings.Contains(err.Error(), `unknown server "cobol"`) {
+		t.Fatalf("unknown server: %v", err)
+	}
+
+	bad := validMinimalRunConfigForTest()
+	bad.LSP.Servers = map[string]LSPServerConfig{"zig": {Command: []string{"zls"}, Extensions: []string{"zig"}}}
+	if err := validateConfig(bad); err == nil || !strings.Contains(err.Error(), "lsp.servers.zig") {
+		t.Fatalf("expected extension validation error, got %v", err)
+	}
+}
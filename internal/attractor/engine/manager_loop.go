@@ -208,7 +208,8 @@ func runChildPipeline(ctx context.Context, exec *Execution, childDotfile string,
 		repoPath = exec.Engine.Options.RepoPath
 	}
 	childGraph, _, err := PrepareWithOptions(dotSource, PrepareOptions{
-		RepoPath: repoPath,
+		RepoPath:          repoPath,
+		StylesheetOverlay: profileStylesheet(exec.Engine.RunConfig, exec.Engine.Options.Profile),
 	})
 	if err != nil {
 		return childResult{
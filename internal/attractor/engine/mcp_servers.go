@@ -0,0 +1,117 @@
+package engine
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/danshapiro/kilroy/internal/agent"
+	"github.com/danshapiro/kilroy/internal/attractor/model"
+)
+
+const mcpAttrPrefix = "mcp."
+
+var mcpServerNameRE = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_]*$`)
+
+func validateMCPServer(name string, command []string, url string) error {
+	if !mcpServerNameRE.MatchString(name) {
+		return fmt.Errorf("invalid server name %q (letters, digits and underscores)", name)
+	}
+	url = strings.TrimSpace(url)
+	switch {
+	case len(command) > 0 && url != "":
+		return fmt.Errorf("set command or url, not both")
+	case len(command) == 0 && url == "":
+		return fmt.Errorf("command or url is required")
+	case url != "" && !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://"):
+		return fmt.Errorf("url must be http(s): %q", url)
+	}
+	return nil
+}
+
+// resolveMCPServers returns the MCP servers for an agent_loop stage:
+// run.yaml mcp.servers, plus `mcp.<name>="<command line | http(s) URL>"`
+// attributes on the graph or node (node wins). The node's `mcp_servers`
+// attribute narrows the set to a comma-separated list of names, or "none".
+func resolveMCPServers(cfg *RunConfigFile, g *model.Graph, node *model.Node) ([]agent.MCPServerConfig, error) {
+	servers := map[string]agent.MCPServerConfig{}
+	if cfg != nil {
+		for name, sc := range cfg.MCP.Servers {
+			servers[name] = agent.MCPServerConfig{
+				Name:           name,
+				Command:        append([]string{}, sc.Command...),
+				Env:            expandEnvValues(sc.Env),
+				URL:            strings.TrimSpace(sc.URL),
+				Headers:        expandEnvValues(sc.Headers),
+				StartupTimeout: time.Duration(sc.StartupTimeoutMS) * time.Millisecond,
+				CallTimeout:    time.Duration(sc.CallTimeoutMS) * time.Millisecond,
+			}
+		}
+	}
+	var attrSets []map[string]string
+	if g != nil {
+		attrSets = append(attrSets, g.Attrs)
+	}
+	if node != nil {
+		attrSets = append(attrSets, node.Attrs)
+	}
+	for _, attrs := range attrSets {
+		for k, v := range attrs {
+			name, ok := strings.CutPrefix(k, mcpAttrPrefix)
+			if !ok || strings.TrimSpace(v) == "" {
+				continue
+			}
+			sc := agent.MCPServerConfig{Name: name}
+			if v = strings.TrimSpace(v); strings.HasPrefix(v, "http://") || strings.HasPrefix(v, "https://") {
+				sc.URL = v
+			} else {
+				sc.Command = strings.Fields(v)
+			}
+			if err := validateMCPServer(name, sc.Command, sc.URL); err != nil {
+				return nil, fmt.Errorf("%s: %w", k, err)
+			}
+			servers[name] = sc
+		}
+	}
+
+	names := make([]string, 0, len(servers))
+	if sel := strings.TrimSpace(node.Attr("mcp_servers", "")); sel != "" {
+		if strings.EqualFold(sel, "none") {
+			return nil, nil
+		}
+		for _, name := range strings.Split(sel, ",") {
+			name = strings.TrimSpace(name)
+			if name == "" {
+				continue
+			}
+			if _, ok := servers[name]; !ok {
+				return nil, fmt.Errorf("mcp_servers: unknown server %q", name)
+			}
+			names = append(names, name)
+		}
+	} else {
+		for name := range servers {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+	}
+	out := make([]agent.MCPServerConfig, 0, len(names))
+	for _, name := range names {
+		out = append(out, servers[name])
+	}
+	return out, nil
+}
+
+func expandEnvValues(in map[string]string) map[string]string {
+	if len(in) == 0 {
+		return nil
+	}
+	out := make(map[string]string, len(in))
+	for k, v := range in {
+		out[k] = os.ExpandEnv(v)
+	}
+	return out
+}
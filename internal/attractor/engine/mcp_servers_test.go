@@ -0,0 +1,82 @@
+package engine
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/danshapiro/kilroy/internal/attractor/dot"
+)
+
+func TestResolveMCPServers_MergesConfigGraphAndNodeAttrs(t *testing.T) {
+	t.Setenv("TRACKER_TOKEN", "t0k")
+	cfg := &RunConfigFile{}
+	cfg.MCP.Servers = map[string]MCPServerConfig{
+		"issues": {URL: "https://mcp.example.com/issues", Headers: map[string]string{"Authorization": "Bearer ${TRACKER_TOKEN}"}, CallTimeoutMS: 1500},
+		"schema": {Command: []string{"schema-mcp", "--db", "main"}},
+	}
+	g, err := dot.Parse([]byte(`
+digraph G {
+  graph [mcp.docs="docs-mcp --stdio"]
+  start [shape=Mdiamond]
+  a [shape=box, mcp.schema="https://schema.internal/mcp"]
+  b [shape=box, mcp_servers="issues, docs"]
+  c [shape=box, mcp_servers=none]
+  d [shape=box, mcp_servers="nope"]
+}
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := resolveMCPServers(cfg, g, g.Nodes["a"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 3 || got[0].Name != "docs" || got[1].Name != "issues" || got[2].Name != "schema" {
+		t.Fatalf("servers for a: %+v", got)
+	}
+	if got[0].Command[0] != "docs-mcp" || got[2].URL != "https://schema.internal/mcp" || len(got[2].Command) != 0 {
+		t.Fatalf("attr declarations: %+v", got)
+	}
+	if got[1].Headers["Authorization"] != "Bearer t0k" || got[1].CallTimeout.Milliseconds() != 1500 {
+		t.Fatalf("config server: %+v", got[1])
+	}
+
+	if got, err := resolveMCPServers(cfg, g, g.Nodes["b"]); err != nil || len(got) != 2 || got[0].Name != "issues" || got[1].Name != "docs" {
+		t.Fatalf("selection for b: %+v %v", got, err)
+	}
+	if got, err := resolveMCPServers(cfg, g, g.Nodes["c"]); err != nil || len(got) != 0 {
+		t.Fatalf("none for c: %+v %v", got, err)
+	}
+	if _, err := resolveMCPServers(cfg, g, g.Nodes["d"]); err == nil || !strings.Contains(err.Error(), `unknown server "nope"`) {
+		t.Fatalf("expected unknown server error, got %v", err)
+	}
+}
+
+func TestLoadRunConfigFile_ValidatesMCPServers(t *testing.T) {
+	for _, tc := range []struct {
+		servers string
+		wantErr string
+	}{
+		{"    ok:\n      command: [\"srv\"]\n", ""},
+		{"    both:\n      command: [\"srv\"]\n      url: https://x\n", "not both"},
+		{"    neither: {}\n", "command or url is required"},
+		{"    ftp:\n      url: ftp://x\n", "http(s)"},
+		{"    bad-name:\n      url: https://x\n", "invalid server name"},
+	} {
+		path := filepath.Join(t.TempDir(), "run.yaml")
+		yml := "version: 1\nrepo:\n  path: /tmp/repo\ncxdb:\n  binary_addr: 127.0.0.1:9009\n  http_base_url: http://127.0.0.1:9010\nmodeldb:\n  openrouter_model_info_path: /tmp/m.json\nmcp:\n  servers:\n" + tc.servers
+		if err := os.WriteFile(path, []byte(yml), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		_, err := LoadRunConfigFile(path)
+		if tc.wantErr == "" && err != nil {
+			t.Fatalf("%q: unexpected error %v", tc.servers, err)
+		}
+		if tc.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tc.wantErr)) {
+			t.Fatalf("%q: got %v want %q", tc.servers, err, tc.wantErr)
+		}
+	}
+}
@@ -0,0 +1,182 @@
+package engine
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/danshapiro/kilroy/internal/attractor/model"
+	"github.com/danshapiro/kilroy/internal/attractor/modeldb"
+	"github.com/danshapiro/kilroy/internal/attractor/runtime"
+)
+
+// A codergen node with llm_model="auto" declares what it needs
+// (model.requires, model.min_context, model.max_cost_per_mtok) and the engine
+// picks the cheapest catalog model from a provider configured in run.yaml.
+// An llm_provider on the node restricts the choice to that provider. The
+// choice is made once per run, before preflight, and pinned in the checkpoint
+// so resume keeps the same models even if the catalog changes.
+
+const autoModelID = "auto"
+
+const modelRoutesExtraKey = "model_routes"
+
+type modelRoute struct {
+	NodeID            string  `json:"node_id"`
+	Provider          string  `json:"provider"`
+	Model             string  `json:"model"`
+	CatalogID         string  `json:"catalog_id,omitempty"`
+	Requirements      string  `json:"requirements,omitempty"`
+	ContextWindow     int     `json:"context_window,omitempty"`
+	InputCostPerMTok  float64 `json:"input_cost_per_mtok"`
+	OutputCostPerMTok float64 `json:"output_cost_per_mtok"`
+}
+
+func isAutoModelNode(n *model.Node) bool {
+	return n != nil && strings.EqualFold(modelIDForNode(n), autoModelID)
+}
+
+func nodeModelRequirements(n *model.Node) (modeldb.Requirements, error) {
+	return modeldb.ParseRequirements(
+		n.Attr("model.requires", ""),
+		n.Attr("model.min_context", ""),
+		n.Attr("model.max_cost_per_mtok", ""),
+	)
+}
+
+// routeAutoModels picks a model for every auto node in g and writes the choice
+// into the node's llm_provider/llm_model.
+func routeAutoModels(g *model.Graph, catalog *modeldb.Catalog, runtimes map[string]ProviderRuntime) (map[string]modelRoute, error) {
+	if g == nil {
+		return nil, nil
+	}
+	var configured []string
+	for key, rt := range runtimes {
+		if rt.Backend == BackendAPI || rt.Backend == BackendCLI {
+			configured = append(configured, key)
+		}
+	}
+	sort.Strings(configured)
+
+	routes := map[string]modelRoute{}
+	for _, id := range sortedKeys(g.Nodes) {
+		n := g.Nodes[id]
+		if !isAutoModelNode(n) {
+			continue
+		}
+		req, err := nodeModelRequirements(n)
+		if err != nil {
+			return nil, fmt.Errorf("node %s: %w", id, err)
+		}
+		providers := configured
+		if p := normalizeProviderKey(n.Attr("llm_provider", "")); p != "" {
+			if _, ok := runtimes[p]; !ok {
+				return nil, fmt.Errorf("node %s: llm_provider %s is not configured in llm.providers", id, p)
+			}
+			providers = []string{p}
+		}
+		choice, err := modeldb.Route(catalog, providers, req, func(provider, modelID string) bool {
+			// CLI-only models fail preflight on an API backend.
+			return runtimes[provider].Backend == BackendCLI || !isCLIOnlyModel(modelID)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("node %s: llm_model=auto: %w", id, err)
+		}
+		route := modelRoute{
+			NodeID:            id,
+			Provider:          choice.Provider,
+			Model:             choice.Model,
+			CatalogID:         choice.CatalogID,
+			Requirements:      req.String(),
+			ContextWindow:     choice.ContextWindow,
+			InputCostPerMTok:  choice.InputCostPerMTok,
+			OutputCostPerMTok: choice.OutputCostPerMTok,
+		}
+		applyModelRoute(n, route)
+		routes[id] = route
+	}
+	if len(routes) == 0 {
+		return nil, nil
+	}
+	return routes, nil
+}
+
+// applyModelRoutes writes pinned routes back into a freshly prepared graph.
+// Routes for nodes that are no longer auto (an edited graph on fork) are
+// dropped.
+func applyModelRoutes(g *model.Graph, routes map[string]modelRoute) map[string]modelRoute {
+	if g == nil || len(routes) == 0 {
+		return nil
+	}
+	kept := map[string]modelRoute{}
+	for id, route := range routes {
+		n := g.Nodes[id]
+		if !isAutoModelNode(n) {
+			continue
+		}
+		applyModelRoute(n, route)
+		kept[id] = route
+	}
+	if len(kept) == 0 {
+		return nil
+	}
+	return kept
+}
+
+func applyModelRoute(n *model.Node, route modelRoute) {
+	n.Attrs["llm_provider"] = route.Provider
+	n.Attrs["llm_model"] = route.Model
+	delete(n.Attrs, "model")
+}
+
+func restoreModelRoutes(cp *runtime.Checkpoint) (map[string]modelRoute, error) {
+	if cp == nil || cp.Extra == nil {
+		return nil, nil
+	}
+	raw, ok := cp.Extra[modelRoutesExtraKey]
+	if !ok || raw == nil {
+		return nil, nil
+	}
+	b, err := json.Marshal(raw)
+	if err != nil {
+		return nil, err
+	}
+	var list []modelRoute
+	if err := json.Unmarshal(b, &list); err != nil {
+		return nil, fmt.Errorf("invalid %s snapshot: %w", modelRoutesExtraKey, err)
+	}
+	routes := map[string]modelRoute{}
+	for _, r := range list {
+		if strings.TrimSpace(r.NodeID) == "" || strings.TrimSpace(r.Provider) == "" || strings.TrimSpace(r.Model) == "" {
+			continue
+		}
+		routes[r.NodeID] = r
+	}
+	return routes, nil
+}
+
+// modelRouteList returns routes ordered by node ID for checkpoints and the
+// manifest.
+func modelRouteList(routes map[string]modelRoute) []modelRoute {
+	list := make([]modelRoute, 0, len(routes))
+	for _, r := range routes {
+		list = append(list, r)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].NodeID < list[j].NodeID })
+	return list
+}
+
+func (e *Engine) reportModelRoutes() {
+	for _, r := range modelRouteList(e.ModelRoutes) {
+		e.appendProgress(map[string]any{
+			"event":                "model_routed",
+			"node_id":              r.NodeID,
+			"provider":             r.Provider,
+			"model":                r.Model,
+			"requirements":         r.Requirements,
+			"input_cost_per_mtok":  r.InputCostPerMTok,
+			"output_cost_per_mtok": r.OutputCostPerMTok,
+		})
+	}
+}
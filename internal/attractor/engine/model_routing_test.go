@@ -0,0 +1,138 @@
+package engine
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/danshapiro/kilroy/internal/attractor/modeldb"
+	"github.com/danshapiro/kilroy/internal/attractor/runtime"
+)
+
+func modelRoutingTestCatalog() *modeldb.Catalog {
+	price := func(v float64) *float64 { return &v }
+	return &modeldb.Catalog{Models: map[string]modeldb.ModelEntry{
+		"openai/gpt-5.4": {Provider: "openai", Mode: "chat", ContextWindow: 400000, SupportsTools: true, SupportsReasoning: true,
+			InputCostPerToken: price(1.25e-6), OutputCostPerToken: price(10e-6)},
+		"openai/gpt-5.4-spark": {Provider: "openai", Mode: "chat", ContextWindow: 400000, SupportsTools: true, SupportsReasoning: true,
+			InputCostPerToken: price(0.1e-6), OutputCostPerToken: price(0.1e-6)},
+		"anthropic/claude-sonnet-4.5": {Provider: "anthropic", Mode: "chat", ContextWindow: 1000000, SupportsTools: true, SupportsReasoning: true,
+			InputCostPerToken: price(3e-6), OutputCostPerToken: price(15e-6)},
+		"google/gemini-3-flash": {Provider: "google", Mode: "chat", ContextWindow: 1000000, SupportsTools: true,
+			InputCostPerToken: price(0.1e-6), OutputCostPerToken: price(0.4e-6)},
+	}}
+}
+
+const modelRoutingTestDOT = `digraph G {
+  graph [goal="g"]
+  start [shape=Mdiamond]
+  exit [shape=Msquare]
+  plan [shape=box, prompt="plan", llm_model="auto", model.requires="tools,reasoning", model.min_context=500000]
+  impl [shape=box, prompt="impl", llm_model="auto", model.requires="tools,reasoning"]
+  fixed [shape=box, prompt="fixed", llm_provider=google, llm_model="gemini-3-flash"]
+  start -> plan -> impl -> fixed -> exit
+}`
+
+func TestRouteAutoModels_PicksCheapestConfiguredModel(t *testing.T) {
+	g, _, err := Prepare([]byte(modelRoutingTestDOT))
+	if err != nil {
+		t.Fatalf("Prepare: %v", err)
+	}
+	// google is not configured, and gpt-5.4-spark is CLI-only so the API
+	// backend cannot serve it.
+	runtimes := map[string]ProviderRuntime{
+		"openai":    {Key: "openai", Backend: BackendAPI},
+		"anthropic": {Key: "anthropic", Backend: BackendAPI},
+	}
+	routes, err := routeAutoModels(g, modelRoutingTestCatalog(), runtimes)
+	if err != nil {
+		t.Fatalf("routeAutoModels: %v", err)
+	}
+	if len(routes) != 2 {
+		t.Fatalf("routes: %+v", routes)
+	}
+	if r := routes["plan"]; r.Provider != "anthropic" || r.Model != "claude-sonnet-4.5" {
+		t.Fatalf("plan route: %+v", r)
+	}
+	if r := routes["impl"]; r.Provider != "openai" || r.Model != "gpt-5.4" {
+		t.Fatalf("impl route: %+v", r)
+	}
+	impl := g.Nodes["impl"]
+	if impl.Attr("llm_provider", "") != "openai" || impl.Attr("llm_model", "") != "gpt-5.4" {
+		t.Fatalf("impl attrs: %v", impl.Attrs)
+	}
+	if g.Nodes["fixed"].Attr("llm_model", "") != "gemini-3-flash" {
+		t.Fatalf("fixed node should be untouched: %v", g.Nodes["fixed"].Attrs)
+	}
+
+	// On a CLI backend the CLI-only model is the cheapest choice.
+	g, _, _ = Prepare([]byte(modelRoutingTestDOT))
+	routes, err = routeAutoModels(g, modelRoutingTestCatalog(), map[string]ProviderRuntime{
+		"openai":    {Key: "openai", Backend: BackendCLI},
+		"anthropic": {Key: "anthropic", Backend: BackendAPI},
+	})
+	if err != nil {
+		t.Fatalf("routeAutoModels: %v", err)
+	}
+	if r := routes["impl"]; r.Model != "gpt-5.4-spark" {
+		t.Fatalf("impl route on cli backend: %+v", r)
+	}
+}
+
+func TestRouteAutoModels_ErrorsWhenNothingQualifies(t *testing.T) {
+	g, _, err := Prepare([]byte(modelRoutingTestDOT))
+	if err != nil {
+		t.Fatalf("Prepare: %v", err)
+	}
+	_, err = routeAutoModels(g, modelRoutingTestCatalog(), map[string]ProviderRuntime{
+		"openai": {Key: "openai", Backend: BackendAPI},
+	})
+	if err == nil || !strings.Contains(err.Error(), "node plan") || !strings.Contains(err.Error(), "min_context=500000") {
+		t.Fatalf("expected routing error for plan, got %v", err)
+	}
+}
+
+func TestModelRoutes_PinnedThroughCheckpoint(t *testing.T) {
+	g, _, err := Prepare([]byte(modelRoutingTestDOT))
+	if err != nil {
+		t.Fatalf("Prepare: %v", err)
+	}
+	routes, err := routeAutoModels(g, modelRoutingTestCatalog(), map[string]ProviderRuntime{
+		"openai":    {Key: "openai", Backend: BackendAPI},
+		"anthropic": {Key: "anthropic", Backend: BackendAPI},
+	})
+	if err != nil {
+		t.Fatalf("routeAutoModels: %v", err)
+	}
+
+	cp := runtime.NewCheckpoint()
+	cp.Extra[modelRoutesExtraKey] = modelRouteList(routes)
+	p := t.TempDir() + "/checkpoint.json"
+	if err := cp.Save(p); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	loaded, err := runtime.LoadCheckpoint(p)
+	if err != nil {
+		t.Fatalf("LoadCheckpoint: %v", err)
+	}
+	restored, err := restoreModelRoutes(loaded)
+	if err != nil {
+		t.Fatalf("restoreModelRoutes: %v", err)
+	}
+
+	// Resume prepares the original graph again and reapplies the pinned
+	// routes without consulting the catalog.
+	g2, _, err := Prepare([]byte(modelRoutingTestDOT))
+	if err != nil {
+		t.Fatalf("Prepare: %v", err)
+	}
+	kept := applyModelRoutes(g2, restored)
+	if len(kept) != 2 {
+		t.Fatalf("kept routes: %+v", kept)
+	}
+	for id, want := range routes {
+		n := g2.Nodes[id]
+		if n.Attr("llm_provider", "") != want.Provider || n.Attr("llm_model", "") != want.Model {
+			t.Fatalf("%s attrs after resume: %v (want %+v)", id, n.Attrs, want)
+		}
+	}
+}
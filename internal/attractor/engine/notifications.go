@@ -0,0 +1,298 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultNotificationEvents are the lifecycle events worth interrupting a
+// human for when a webhook does not list its own.
+var defaultNotificationEvents = []string{
+	"run_completed",
+	"run_failed",
+	"human_gate_waiting",
+	"loop_restart_circuit_breaker",
+}
+
+const (
+	webhookQueueSize       = 256
+	webhookShutdownTimeout = 30 * time.Second
+)
+
+type webhookTarget struct {
+	cfg        WebhookConfig
+	secret     string
+	events     map[string]bool
+	client     *http.Client
+	retryDelay time.Duration
+}
+
+type webhookDelivery struct {
+	target *webhookTarget
+	event  string
+	body   []byte
+}
+
+// webhookNotifier delivers matching progress events to webhooks from a single
+// background worker, so the progress path never blocks on the network and
+// deliveries arrive in event order.
+type webhookNotifier struct {
+	runID   string
+	targets []*webhookTarget
+	warn    func(string)
+
+	mu      sync.Mutex
+	closed  bool
+	dropped int
+	queue   chan webhookDelivery
+	done    chan struct{}
+}
+
+// newWebhookNotifier returns nil when no webhooks are configured. cfg must
+// already have applyConfigDefaults applied.
+func newWebhookNotifier(cfg *RunConfigFile, runID string, warn func(string)) *webhookNotifier {
+	if cfg == nil || len(cfg.Notifications.Webhooks) == 0 {
+		return nil
+	}
+	n := &webhookNotifier{
+		runID: runID,
+		warn:  warn,
+		queue: make(chan webhookDelivery, webhookQueueSize),
+		done:  make(chan struct{}),
+	}
+	for _, wh := range cfg.Notifications.Webhooks {
+		t := &webhookTarget{cfg: wh, events: map[string]bool{}}
+		t.secret = wh.Secret
+		if wh.SecretEnv != "" {
+			t.secret = os.Getenv(wh.SecretEnv)
+		}
+		for _, ev := range wh.Events {
+			t.events[strings.TrimSpace(ev)] = true
+		}
+		t.client = &http.Client{Timeout: time.Duration(wh.TimeoutMS) * time.Millisecond}
+		t.retryDelay = time.Duration(wh.RetryBaseDelayMS) * time.Millisecond
+		n.targets = append(n.targets, t)
+	}
+	go n.loop()
+	return n
+}
+
+// startNotifications wraps the engine's progress sink with webhook delivery
+// and returns a finisher that drains pending deliveries.
+func (e *Engine) startNotifications() func() {
+	n := newWebhookNotifier(e.RunConfig, e.Options.RunID, e.Warn)
+	if n == nil {
+		return func() {}
+	}
+	prev := e.progressSink
+	e.progressSink = func(ev map[string]any) {
+		if prev != nil {
+			prev(ev)
+		}
+		n.notify(ev)
+	}
+	return func() { n.close(webhookShutdownTimeout) }
+}
+
+// notify is called with progressMu held: it must only enqueue.
+func (n *webhookNotifier) notify(ev map[string]any) {
+	if n == nil || ev == nil {
+		return
+	}
+	name, ev := notificationEvent(ev)
+	if name == "" {
+		return
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.closed {
+		return
+	}
+	for _, t := range n.targets {
+		if !t.events[name] && !t.events["*"] {
+			continue
+		}
+		body, err := webhookBody(t.cfg.Format, name, n.runID, ev)
+		if err != nil {
+			continue
+		}
+		select {
+		case n.queue <- webhookDelivery{target: t, event: name, body: body}:
+		default:
+			n.dropped++
+		}
+	}
+}
+
+// notificationEvent unwraps branch_progress so gates and breakers inside
+// parallel branches notify under their own event name.
+func notificationEvent(ev map[string]any) (string, map[string]any) {
+	name := eventFieldString(ev, "event")
+	if name != "branch_progress" {
+		return name, ev
+	}
+	inner := eventFieldString(ev, "branch_event")
+	if inner == "" {
+		return name, ev
+	}
+	out := copyMap(ev)
+	out["event"] = inner
+	if nodeID := eventFieldString(ev, "branch_node_id"); nodeID != "" {
+		out["node_id"] = nodeID
+	}
+	return inner, out
+}
+
+func (n *webhookNotifier) loop() {
+	defer close(n.done)
+	for d := range n.queue {
+		if err := n.deliver(d); err != nil && n.warn != nil {
+			n.warn(fmt.Sprintf("webhook notification %s to %s failed: %v", d.event, redactURL(d.target.cfg.URL), err))
+		}
+	}
+}
+
+func (n *webhookNotifier) deliver(d webhookDelivery) error {
+	attempts := d.target.cfg.MaxAttempts
+	if attempts <= 0 {
+		attempts = 1
+	}
+	delay := d.target.retryDelay
+	var lastErr error
+	for i := 1; i <= attempts; i++ {
+		retry, err := d.target.post(d.event, d.body)
+		if err == nil {
+			return nil
+		}
+		lastErr = err
+		if !retry || i == attempts {
+			break
+		}
+		time.Sleep(delay)
+		delay *= 2
+	}
+	return lastErr
+}
+
+// post sends one attempt and reports whether a failure is worth retrying
+// (transport errors, 408, 429 and 5xx).
+func (t *webhookTarget) post(event string, body []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, t.cfg.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "kilroy-webhook")
+	req.Header.Set("X-Kilroy-Event", event)
+	for k, v := range t.cfg.Headers {
+		req.Header.Set(k, v)
+	}
+	if t.secret != "" {
+		req.Header.Set("X-Kilroy-Signature", "sha256="+signWebhookBody(t.secret, body))
+	}
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	retry := resp.StatusCode == http.StatusRequestTimeout || resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+	return retry, fmt.Errorf("http %d", resp.StatusCode)
+}
+
+// close stops accepting events and waits (bounded) for queued deliveries.
+func (n *webhookNotifier) close(timeout time.Duration) {
+	if n == nil {
+		return
+	}
+	n.mu.Lock()
+	if n.closed {
+		n.mu.Unlock()
+		return
+	}
+	n.closed = true
+	dropped := n.dropped
+	close(n.queue)
+	n.mu.Unlock()
+
+	select {
+	case <-n.done:
+	case <-time.After(timeout):
+		if n.warn != nil {
+			n.warn(fmt.Sprintf("webhook notifications still pending after %s; abandoning", timeout))
+		}
+	}
+	if dropped > 0 && n.warn != nil {
+		n.warn(fmt.Sprintf("webhook notification queue full; dropped %d deliveries", dropped))
+	}
+}
+
+func signWebhookBody(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	_, _ = mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func webhookBody(format, event, runID string, ev map[string]any) ([]byte, error) {
+	if format == "slack" {
+		return json.Marshal(map[string]any{"text": notificationSummary(event, runID, ev)})
+	}
+	return json.Marshal(map[string]any{
+		"event":   event,
+		"run_id":  firstNonEmpty(eventFieldString(ev, "run_id"), runID),
+		"ts":      eventFieldString(ev, "ts"),
+		"summary": notificationSummary(event, runID, ev),
+		"data":    ev,
+	})
+}
+
+// notificationSummary renders a one-line, human-readable description.
+func notificationSummary(event, runID string, ev map[string]any) string {
+	runID = firstNonEmpty(eventFieldString(ev, "run_id"), runID)
+	nodeID := eventFieldString(ev, "node_id")
+	switch event {
+	case "run_completed":
+		return fmt.Sprintf("Kilroy run %s completed (%s)", runID, firstNonEmpty(eventFieldString(ev, "status"), "success"))
+	case "run_failed":
+		msg := fmt.Sprintf("Kilroy run %s failed", runID)
+		if reason := eventFieldString(ev, "failure_reason"); reason != "" {
+			msg += ": " + truncate(reason, 300)
+		}
+		return msg
+	case "human_gate_waiting":
+		msg := fmt.Sprintf("Kilroy run %s is waiting for a human at %s", runID, nodeID)
+		if q := eventFieldString(ev, "question"); q != "" {
+			msg += ": " + truncate(q, 300)
+		}
+		return msg
+	case "loop_restart_circuit_breaker":
+		return fmt.Sprintf("Kilroy run %s tripped the loop_restart circuit breaker at %s (signature %s)", runID, nodeID, eventFieldString(ev, "signature"))
+	default:
+		if nodeID != "" {
+			return fmt.Sprintf("Kilroy run %s: %s at %s", runID, event, nodeID)
+		}
+		return fmt.Sprintf("Kilroy run %s: %s", runID, event)
+	}
+}
+
+// redactURL drops the path and query, which often embed webhook tokens.
+func redactURL(raw string) string {
+	if i := strings.Index(raw, "://"); i >= 0 {
+		if j := strings.Index(raw[i+3:], "/"); j >= 0 {
+			return raw[:i+3+j] + "/…"
+		}
+	}
+	return raw
+}
@@ -0,0 +1,205 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type webhookRequest struct {
+	Event     string
+	Signature string
+	Body      map[string]any
+}
+
+func newWebhookReceiverForTest(t *testing.T, failFirst int) (*httptest.Server, func() []webhookRequest) {
+	t.Helper()
+	var mu sync.Mutex
+	var reqs []webhookRequest
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		calls++
+		if calls <= failFirst {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		b, _ := io.ReadAll(r.Body)
+		var body map[string]any
+		_ = json.Unmarshal(b, &body)
+		reqs = append(reqs, webhookRequest{
+			Event:     r.Header.Get("X-Kilroy-Event"),
+			Signature: r.Header.Get("X-Kilroy-Signature"),
+			Body:      body,
+		})
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, func() []webhookRequest {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]webhookRequest{}, reqs...)
+	}
+}
+
+func TestWebhookNotifier_FiltersSignsAndRetries(t *testing.T) {
+	srv, got := newWebhookReceiverForTest(t, 2)
+	cfg := &RunConfigFile{}
+	cfg.Notifications.Webhooks = []WebhookConfig{{URL: srv.URL, Secret: "s3cret", RetryBaseDelayMS: 1}}
+	applyConfigDefaults(cfg)
+
+	n := newWebhookNotifier(cfg, "r1", func(msg string) { t.Errorf("unexpected warning: %s", msg) })
+	n.notify(map[string]any{"event": "stage_attempt_start", "node_id": "a"})
+	n.notify(map[string]any{"event": "human_gate_waiting", "node_id": "gate", "question": "Ship it?"})
+	n.close(5 * time.Second)
+
+	reqs := got()
+	if len(reqs) != 1 {
+		t.Fatalf("deliveries: got %d want 1 (%+v)", len(reqs), reqs)
+	}
+	r := reqs[0]
+	if r.Event != "human_gate_waiting" || r.Body["event"] != "human_gate_waiting" || r.Body["run_id"] != "r1" {
+		t.Fatalf("unexpected delivery: %+v", r)
+	}
+	if !strings.Contains(r.Body["summary"].(string), "waiting for a human at gate: Ship it?") {
+		t.Fatalf("summary: %v", r.Body["summary"])
+	}
+	body, _ := webhookBody("json", "human_gate_waiting", "r1", map[string]any{"event": "human_gate_waiting", "node_id": "gate", "question": "Ship it?"})
+	if want := "sha256=" + signWebhookBody("s3cret", body); r.Signature != want {
+		t.Fatalf("signature: got %q want %q", r.Signature, want)
+	}
+}
+
+func TestWebhookNotifier_SlackFormatAndBranchEvents(t *testing.T) {
+	srv, got := newWebhookReceiverForTest(t, 0)
+	cfg := &RunConfigFile{}
+	cfg.Notifications.Webhooks = []WebhookConfig{{URL: srv.URL, Format: "slack", Events: []string{"human_gate_waiting"}}}
+	applyConfigDefaults(cfg)
+
+	n := newWebhookNotifier(cfg, "r2", nil)
+	n.notify(map[string]any{"event": "branch_progress", "branch_event": "human_gate_waiting", "branch_node_id": "review"})
+	n.notify(map[string]any{"event": "run_completed", "status": "success"})
+	n.close(5 * time.Second)
+
+	reqs := got()
+	if len(reqs) != 1 {
+		t.Fatalf("deliveries: got %d want 1 (%+v)", len(reqs), reqs)
+	}
+	if text, _ := reqs[0].Body["text"].(string); text != "Kilroy run r2 is waiting for a human at review" {
+		t.Fatalf("slack text: %q", text)
+	}
+}
+
+func TestWebhookNotifier_GivesUpOnClientErrors(t *testing.T) {
+	var mu sync.Mutex
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		calls++
+		mu.Unlock()
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer srv.Close()
+	cfg := &RunConfigFile{}
+	cfg.Notifications.Webhooks = []WebhookConfig{{URL: srv.URL + "/hooks/T000/secret"}}
+	applyConfigDefaults(cfg)
+
+	var warnings []string
+	n := newWebhookNotifier(cfg, "r3", func(msg string) { warnings = append(warnings, msg) })
+	n.notify(map[string]any{"event": "run_failed", "failure_reason": "boom"})
+	n.close(5 * time.Second)
+
+	if calls != 1 {
+		t.Fatalf("calls: got %d want 1 (4xx must not be retried)", calls)
+	}
+	if len(warnings) != 1 || strings.Contains(warnings[0], "secret") {
+		t.Fatalf("warnings: %v", warnings)
+	}
+}
+
+func TestRunWithConfig_WebhookReceivesRunCompleted(t *testing.T) {
+	repo := initTestRepo(t)
+	logsRoot := t.TempDir()
+	pinned := writePinnedCatalog(t)
+	cxdbSrv := newCXDBTestServer(t)
+	hook, got := newWebhookReceiverForTest(t, 0)
+
+	cfg := &RunConfigFile{Version: 1}
+	cfg.Repo.Path = repo
+	cfg.CXDB.BinaryAddr = cxdbSrv.BinaryAddr()
+	cfg.CXDB.HTTPBaseURL = cxdbSrv.URL()
+	cfg.ModelDB.OpenRouterModelInfoPath = pinned
+	cfg.ModelDB.OpenRouterModelInfoUpdatePolicy = "pinned"
+	cfg.Notifications.Webhooks = []WebhookConfig{{URL: hook.URL}}
+
+	dot := []byte(`
+digraph G {
+  graph [goal="notify"]
+  start [shape=Mdiamond]
+  exit  [shape=Msquare]
+  tool [shape=parallelogram, tool_command="true"]
+  start -> tool -> exit
+}
+`)
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+	res, err := RunWithConfig(ctx, dot, cfg, RunOptions{RunID: "notify-run", LogsRoot: logsRoot})
+	if err != nil {
+		t.Fatalf("RunWithConfig: %v", err)
+	}
+	if res.FinalStatus != "success" {
+		t.Fatalf("final status: got %s want success", res.FinalStatus)
+	}
+	reqs := got()
+	if len(reqs) != 1 || reqs[0].Event != "run_completed" || reqs[0].Body["run_id"] != "notify-run" {
+		t.Fatalf("webhook deliveries: %+v", reqs)
+	}
+}
+
+func TestLoadRunConfigFile_NotificationsDefaultsAndValidation(t *testing.T) {
+	dir := t.TempDir()
+	write := func(body string) string {
+		p := filepath.Join(dir, "run.yaml")
+		if err := os.WriteFile(p, []byte(body), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+	base := `
+version: 1
+repo: {path: /tmp/repo}
+cxdb: {binary_addr: "127.0.0.1:9009", http_base_url: "http://127.0.0.1:9010"}
+modeldb: {openrouter_model_info_path: /tmp/catalog.json, openrouter_model_info_update_policy: pinned}
+`
+	cfg, err := LoadRunConfigFile(write(base + "notifications: {webhooks: [{url: \" https://hooks.example.com/x \"}]}\n"))
+	if err != nil {
+		t.Fatalf("LoadRunConfigFile: %v", err)
+	}
+	wh := cfg.Notifications.Webhooks[0]
+	if wh.URL != "https://hooks.example.com/x" || wh.Format != "json" || wh.MaxAttempts != 4 || len(wh.Events) != len(defaultNotificationEvents) {
+		t.Fatalf("unexpected webhook defaults: %+v", wh)
+	}
+
+	for _, tc := range []struct {
+		webhook string
+		want    string
+	}{
+		{`{url: hooks.example.com}`, "url must be an http(s) URL"},
+		{`{url: "https://x", format: teams}`, "format"},
+		{`{url: "https://x", secret: a, secret_env: B}`, "not both"},
+	} {
+		_, err := LoadRunConfigFile(write(base + "notifications: {webhooks: [" + tc.webhook + "]}\n"))
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Fatalf("%s: expected error containing %q, got %v", tc.webhook, tc.want, err)
+		}
+	}
+}
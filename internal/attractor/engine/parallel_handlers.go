@@ -203,9 +203,13 @@ func dispatchParallelBranches(
 
 	// Kilroy git model: create the checkpoint commit FIRST so branch work is a descendant.
 	msg := fmt.Sprintf("attractor(%s): %s (%s)", exec.Engine.Options.RunID, sourceNodeID, runtime.StatusSuccess)
-	baseSHA, err := gitutil.CommitAllowEmpty(exec.WorktreeDir, msg)
-	if err != nil {
-		return nil, "", err
+	baseSHA := ""
+	if !exec.Engine.simulated {
+		sha, err := gitutil.CommitAllowEmpty(exec.WorktreeDir, msg)
+		if err != nil {
+			return nil, "", err
+		}
+		baseSHA = sha
 	}
 
 	// Increment the per-node dispatch count so each pass through this fan-out
@@ -217,6 +221,10 @@ func dispatchParallelBranches(
 	if maxParallel <= 0 {
 		maxParallel = 4
 	}
+	if exec.Engine.simulated {
+		// One at a time, so a simulation's trace is deterministic.
+		maxParallel = 1
+	}
 
 	// git ref/worktree mutations are not concurrency-safe. Serialize setup operations,
 	// then run branch execution concurrently.
@@ -298,6 +306,9 @@ func (h *ParallelHandler) runBranch(ctx context.Context, exec *Execution, parall
 	branchName := buildParallelBranch(prefix, exec.Engine.Options.RunID, parallelNode.ID, passNum, key)
 	branchRoot := filepath.Join(exec.LogsRoot, "parallel", parallelNode.ID, fmt.Sprintf("pass%d", passNum), fmt.Sprintf("%02d-%s", idx+1, key))
 	worktreeDir := filepath.Join(branchRoot, "worktree")
+	if exec.Engine.simulated {
+		worktreeDir = ""
+	}
 	var activityMu sync.Mutex
 	lastProgressEvent := "branch_initialized"
 	lastProgressAt := time.Now().UTC()
@@ -372,44 +383,46 @@ func (h *ParallelHandler) runBranch(ctx context.Context, exec *Execution, parall
 	// Prepare branch git worktree rooted at the parallel node checkpoint commit.
 	emitBranchProgress("branch_setup_start", nil)
 	_ = os.MkdirAll(branchRoot, 0o755)
-	if gitMu != nil {
-		gitMu.Lock()
-	}
-	emitBranchProgress("branch_setup_locked", nil)
-	_ = gitutil.RemoveWorktree(exec.Engine.Options.RepoPath, worktreeDir)
-	if err := gitutil.CreateBranchAt(exec.Engine.Options.RepoPath, branchName, baseSHA); err != nil {
+	if !exec.Engine.simulated {
 		if gitMu != nil {
-			gitMu.Unlock()
+			gitMu.Lock()
 		}
-		return parallelBranchResult{
-			BranchKey:   key,
-			BranchName:  branchName,
-			StartNodeID: edge.To,
-			StopNodeID:  joinID,
-			LogsRoot:    branchRoot,
-			WorktreeDir: worktreeDir,
-			Error:       err.Error(),
-			Outcome:     runtime.Outcome{Status: runtime.StatusFail, FailureReason: err.Error()},
+		emitBranchProgress("branch_setup_locked", nil)
+		_ = gitutil.RemoveWorktree(exec.Engine.Options.RepoPath, worktreeDir)
+		if err := gitutil.CreateBranchAt(exec.Engine.Options.RepoPath, branchName, baseSHA); err != nil {
+			if gitMu != nil {
+				gitMu.Unlock()
+			}
+			return parallelBranchResult{
+				BranchKey:   key,
+				BranchName:  branchName,
+				StartNodeID: edge.To,
+				StopNodeID:  joinID,
+				LogsRoot:    branchRoot,
+				WorktreeDir: worktreeDir,
+				Error:       err.Error(),
+				Outcome:     runtime.Outcome{Status: runtime.StatusFail, FailureReason: err.Error()},
+			}
 		}
-	}
-	if err := gitutil.AddWorktree(exec.Engine.Options.RepoPath, worktreeDir, branchName); err != nil {
+		if err := gitutil.AddWorktree(exec.Engine.Options.RepoPath, worktreeDir, branchName); err != nil {
+			if gitMu != nil {
+				gitMu.Unlock()
+			}
+			return parallelBranchResult{
+				BranchKey:   key,
+				BranchName:  branchName,
+				StartNodeID: edge.To,
+				StopNodeID:  joinID,
+				LogsRoot:    branchRoot,
+				WorktreeDir: worktreeDir,
+				Error:       err.Error(),
+				Outcome:     runtime.Outcome{Status: runtime.StatusFail, FailureReason: err.Error()},
+			}
+		}
+		_ = gitutil.ResetHard(worktreeDir, baseSHA)
 		if gitMu != nil {
 			gitMu.Unlock()
 		}
-		return parallelBranchResult{
-			BranchKey:   key,
-			BranchName:  branchName,
-			StartNodeID: edge.To,
-			StopNodeID:  joinID,
-			LogsRoot:    branchRoot,
-			WorktreeDir: worktreeDir,
-			Error:       err.Error(),
-			Outcome:     runtime.Outcome{Status: runtime.StatusFail, FailureReason: err.Error()},
-		}
-	}
-	_ = gitutil.ResetHard(worktreeDir, baseSHA)
-	if gitMu != nil {
-		gitMu.Unlock()
 	}
 	emitBranchProgress("branch_setup_ready", nil)
 
@@ -431,6 +444,7 @@ func (h *ParallelHandler) runBranch(ctx context.Context, exec *Execution, parall
 		InputReferenceInferer:      exec.Engine.InputReferenceInferer,
 		InputInferenceCache:        copyInferredReferenceCache(exec.Engine.InputInferenceCache),
 		InputSourceTargetMap:       copyStringStringMap(exec.Engine.InputSourceTargetMap),
+		simulated:                  exec.Engine.simulated,
 	}
 	if exec.Engine.CXDB != nil {
 		if fork, err := exec.Engine.CXDB.ForkFromHead(ctx); err == nil {
@@ -481,13 +495,15 @@ func (h *ParallelHandler) runBranch(ctx context.Context, exec *Execution, parall
 	// Input materialization copies files from the parent worktree into the branch
 	// worktree, which may overwrite the .git file with the parent's slot reference.
 	// Repair the .git file so git operations in this branch use the correct slot.
-	_ = gitutil.RepairWorktree(exec.Engine.Options.RepoPath, worktreeDir)
-	// Copy gitignored files (e.g. .env, secrets, local configs) from the parent
-	// worktree into the branch worktree. These are not committed to git and
-	// therefore not present after worktree creation; agents need them without us
-	// ever committing sensitive material.
-	if err := gitutil.CopyIgnoredFiles(exec.WorktreeDir, worktreeDir); err != nil {
-		emitBranchProgress("branch_ignored_files_warning", map[string]any{"warning": err.Error()})
+	if !exec.Engine.simulated {
+		_ = gitutil.RepairWorktree(exec.Engine.Options.RepoPath, worktreeDir)
+		// Copy gitignored files (e.g. .env, secrets, local configs) from the parent
+		// worktree into the branch worktree. These are not committed to git and
+		// therefore not present after worktree creation; agents need them without us
+		// ever committing sensitive material.
+		if err := gitutil.CopyIgnoredFiles(exec.WorktreeDir, worktreeDir); err != nil {
+			emitBranchProgress("branch_ignored_files_warning", map[string]any{"warning": err.Error()})
+		}
 	}
 	if branchEng.CXDB != nil {
 		if _, err := os.Stat(inputRunManifestPath(branchRoot)); err == nil {
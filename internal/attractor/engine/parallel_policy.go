@@ -271,9 +271,13 @@ func dispatchParallelBranchesStreaming(
 	}
 
 	msg := fmt.Sprintf("attractor(%s): %s (%s)", exec.Engine.Options.RunID, sourceNodeID, runtime.StatusSuccess)
-	baseSHA, err := gitutil.CommitAllowEmpty(exec.WorktreeDir, msg)
-	if err != nil {
-		return nil, "", err
+	baseSHA := ""
+	if !exec.Engine.simulated {
+		sha, err := gitutil.CommitAllowEmpty(exec.WorktreeDir, msg)
+		if err != nil {
+			return nil, "", err
+		}
+		baseSHA = sha
 	}
 
 	passNum := exec.Engine.nextParallelPassCount(sourceNodeID)
@@ -282,6 +286,10 @@ func dispatchParallelBranchesStreaming(
 	if maxParallel <= 0 {
 		maxParallel = 4
 	}
+	if exec.Engine.simulated {
+		// One at a time, so a simulation's trace is deterministic.
+		maxParallel = 1
+	}
 
 	var gitMu sync.Mutex
 
@@ -17,6 +17,8 @@ var (
 	preflightPromptProbeAgentLoopSystemRaw string
 	//go:embed prompts/stage_status_contract_preamble.tmpl
 	stageStatusContractPromptPreambleTemplateRaw string
+	//go:embed prompts/report_status_preamble.tmpl
+	reportStatusPromptPreambleTemplateRaw string
 	//go:embed prompts/input_materialization_preamble.tmpl
 	inputMaterializationPromptPreambleTemplateRaw string
 	//go:embed prompts/failure_dossier_preamble.tmpl
@@ -30,6 +32,9 @@ var (
 	stageStatusContractPromptPreambleTmpl = template.Must(
 		template.New("stage_status_contract_preamble").Parse(stageStatusContractPromptPreambleTemplateRaw),
 	)
+	reportStatusPromptPreambleTmpl = template.Must(
+		template.New("report_status_preamble").Parse(reportStatusPromptPreambleTemplateRaw),
+	)
 	inputMaterializationPromptPreambleTmpl = template.Must(
 		template.New("input_materialization_preamble").Parse(inputMaterializationPromptPreambleTemplateRaw),
 	)
@@ -56,6 +61,18 @@ func mustRenderStageStatusContractPromptPreamble(primaryPath, fallbackPath strin
 	return text + "\n"
 }
 
+func mustRenderReportStatusPromptPreamble(primaryPath string) string {
+	var buf bytes.Buffer
+	err := reportStatusPromptPreambleTmpl.Execute(&buf, map[string]string{
+		"StageStatusPathEnvKey": stageStatusPathEnvKey,
+		"PrimaryPath":           primaryPath,
+	})
+	if err != nil {
+		panic(fmt.Sprintf("render report_status prompt preamble: %v", err))
+	}
+	return strings.TrimRight(buf.String(), "\r\n")
+}
+
 func mustEmbeddedPromptText(name, raw string) string {
 	text := strings.TrimRight(raw, "\r\n")
 	if strings.TrimSpace(text) == "" {
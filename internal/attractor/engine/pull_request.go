@@ -0,0 +1,248 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/danshapiro/kilroy/internal/attractor/forge"
+	"github.com/danshapiro/kilroy/internal/attractor/gitutil"
+	"github.com/danshapiro/kilroy/internal/attractor/runtime"
+	"github.com/danshapiro/kilroy/internal/attractor/textutil"
+)
+
+const pullRequestTimeout = 60 * time.Second
+
+const defaultPullRequestTitleTemplate = `{{if .Goal}}{{firstLine .Goal}}{{else}}Kilroy run {{.RunID}}{{end}}`
+
+const defaultPullRequestBodyTemplate = `{{if .Goal}}## Goal
+
+{{.Goal}}
+{{end}}{{if .Stages}}
+## Stages
+
+{{range .Stages}}- **{{.NodeID}}** ({{.Status}}){{if .Notes}}: {{oneLine .Notes}}{{end}}
+{{end}}{{end}}{{if .Tests}}
+## Tests
+
+{{range .Tests}}- **{{.NodeID}}**: {{.Passed}} passed, {{.Failed}} failed, {{.Skipped}} skipped of {{.Total}}{{if .Format}} ({{.Format}}){{end}}
+{{end}}{{end}}
+## Run
+
+- Run ID: ` + "`{{.RunID}}`" + `
+- Branch: ` + "`{{.RunBranch}}`" + `
+- Final commit: ` + "`{{.FinalCommitSHA}}`" + `
+- Logs: ` + "`{{.LogsRoot}}`" + `
+`
+
+var pullRequestTemplateFuncs = template.FuncMap{
+	"firstLine": textutil.FirstLine,
+	"oneLine":   func(s string) string { return strings.Join(strings.Fields(s), " ") },
+}
+
+// pullRequestData is what title_template and body_template render.
+type pullRequestData struct {
+	RunID          string
+	Goal           string
+	GraphName      string
+	RunBranch      string
+	Base           string
+	FinalCommitSHA string
+	LogsRoot       string
+	Stages         []pullRequestStage
+	Tests          []pullRequestTests
+}
+
+// pullRequestStage is a node's last status.json in the final logs segment.
+type pullRequestStage struct {
+	NodeID string
+	Status string
+	Notes  string
+}
+
+// pullRequestTests is a node's test_report.json summary.
+type pullRequestTests struct {
+	NodeID  string
+	Format  string
+	Total   int
+	Passed  int
+	Failed  int
+	Skipped int
+}
+
+func validatePullRequestConfig(cfg *RunConfigFile, pr *PullRequestConfig) error {
+	kind, err := forge.ParseKind(pr.Forge)
+	if err != nil {
+		return err
+	}
+	if strings.TrimSpace(cfg.Git.PushRemote) == "" {
+		return fmt.Errorf("requires git.push_remote")
+	}
+	if pr.Base == "" {
+		return fmt.Errorf("base is required")
+	}
+	if kind == forge.Gitea && pr.APIBaseURL == "" {
+		return fmt.Errorf("api_base_url is required for gitea")
+	}
+	if pr.APIBaseURL != "" && !strings.HasPrefix(pr.APIBaseURL, "http://") && !strings.HasPrefix(pr.APIBaseURL, "https://") {
+		return fmt.Errorf("api_base_url must be an http(s) URL: %q", pr.APIBaseURL)
+	}
+	for name, raw := range map[string]string{"title_template": pr.TitleTemplate, "body_template": pr.BodyTemplate} {
+		if _, err := template.New(name).Funcs(pullRequestTemplateFuncs).Parse(raw); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// openPullRequestIfConfigured pushes the run branch and opens the configured
+// pull request, returning its URL and whether it attempted the push (so the
+// caller does not push again). Like the push, it is best-effort: failures are
+// warnings and progress events, never a failed run.
+func (e *Engine) openPullRequestIfConfigured(ctx context.Context, final runtime.FinalOutcome) (url string, pushAttempted bool) {
+	if e == nil || e.RunConfig == nil || e.RunConfig.Git.PullRequest == nil || final.Status != runtime.FinalSuccess {
+		return "", false
+	}
+	cfg := e.RunConfig.Git.PullRequest
+	fail := func(err error) (string, bool) {
+		e.Warn(fmt.Sprintf("pull request: %v", err))
+		e.appendProgress(map[string]any{
+			"event": "pull_request_failed",
+			"forge": cfg.Forge,
+			"error": err.Error(),
+		})
+		return "", true
+	}
+	if !e.gitPushIfConfigured() {
+		return fail(fmt.Errorf("run branch was not pushed to %s", e.RunConfig.Git.PushRemote))
+	}
+	repo := cfg.Repo
+	if repo == "" {
+		remoteURL, err := gitutil.RemoteURL(e.Options.RepoPath, e.RunConfig.Git.PushRemote)
+		if err != nil {
+			return fail(err)
+		}
+		if repo, err = forge.RepoFromRemoteURL(remoteURL); err != nil {
+			return fail(fmt.Errorf("%w; set git.pull_request.repo", err))
+		}
+	}
+	token := strings.TrimSpace(os.Getenv(cfg.TokenEnv))
+	if token == "" {
+		return fail(fmt.Errorf("%s is not set", cfg.TokenEnv))
+	}
+
+	data := e.pullRequestData(final)
+	title, err := renderPullRequestTemplate("title_template", cfg.TitleTemplate, defaultPullRequestTitleTemplate, data)
+	if err != nil {
+		return fail(err)
+	}
+	body, err := renderPullRequestTemplate("body_template", cfg.BodyTemplate, defaultPullRequestBodyTemplate, data)
+	if err != nil {
+		return fail(err)
+	}
+	if ctx == nil || ctx.Err() != nil {
+		// The run context may already be done; opening the PR should not be.
+		ctx = context.Background()
+	}
+	ctx, cancel := context.WithTimeout(ctx, pullRequestTimeout)
+	defer cancel()
+	client := &forge.Client{Kind: forge.Kind(cfg.Forge), BaseURL: cfg.APIBaseURL, Token: token}
+	url, err = client.Create(ctx, forge.PullRequest{
+		Repo:   repo,
+		Head:   e.RunBranch,
+		Base:   cfg.Base,
+		Title:  strings.TrimSpace(title),
+		Body:   body,
+		Draft:  cfg.Draft,
+		Labels: cfg.Labels,
+	})
+	if err != nil && url == "" {
+		return fail(err)
+	}
+	if err != nil {
+		// Opened, but a follow-up call (labels) failed.
+		e.Warn(fmt.Sprintf("pull request: %v", err))
+	}
+	e.appendProgress(map[string]any{
+		"event": "pull_request_opened",
+		"forge": cfg.Forge,
+		"url":   url,
+	})
+	return url, true
+}
+
+func renderPullRequestTemplate(name, raw, fallback string, data pullRequestData) (string, error) {
+	if strings.TrimSpace(raw) == "" {
+		raw = fallback
+	}
+	t, err := template.New(name).Funcs(pullRequestTemplateFuncs).Parse(raw)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", name, err)
+	}
+	var b bytes.Buffer
+	if err := t.Execute(&b, data); err != nil {
+		return "", fmt.Errorf("%s: %w", name, err)
+	}
+	return b.String(), nil
+}
+
+// pullRequestData summarizes the run from the final logs segment: the nodes
+// of the last checkpoint in the order they completed, their status.json
+// notes and any test_report.json.
+func (e *Engine) pullRequestData(final runtime.FinalOutcome) pullRequestData {
+	data := pullRequestData{
+		RunID:          e.Options.RunID,
+		RunBranch:      e.RunBranch,
+		FinalCommitSHA: final.FinalGitCommitSHA,
+		LogsRoot:       e.baseLogsRoot,
+	}
+	if data.LogsRoot == "" {
+		data.LogsRoot = e.LogsRoot
+	}
+	if e.RunConfig != nil && e.RunConfig.Git.PullRequest != nil {
+		data.Base = e.RunConfig.Git.PullRequest.Base
+	}
+	if e.Graph != nil {
+		data.Goal = strings.TrimSpace(e.Graph.Attrs["goal"])
+		data.GraphName = e.Graph.Name
+	}
+	cp, err := runtime.LoadCheckpoint(filepath.Join(e.LogsRoot, "checkpoint.json"))
+	if err != nil {
+		return data
+	}
+	seen := map[string]bool{}
+	for _, id := range cp.CompletedNodes {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		if e.Graph != nil {
+			if n := e.Graph.Nodes[id]; n != nil {
+				if t := n.HandlerType(); t == "start" || t == "exit" {
+					continue
+				}
+			}
+		}
+		stageDir := filepath.Join(e.LogsRoot, id)
+		if b, err := os.ReadFile(filepath.Join(stageDir, "status.json")); err == nil {
+			if out, err := runtime.DecodeOutcomeJSON(b); err == nil {
+				data.Stages = append(data.Stages, pullRequestStage{NodeID: id, Status: string(out.Status), Notes: strings.TrimSpace(out.Notes)})
+			}
+		}
+		if b, err := os.ReadFile(filepath.Join(stageDir, testReportFileName)); err == nil {
+			var r testReport
+			if json.Unmarshal(b, &r) == nil {
+				data.Tests = append(data.Tests, pullRequestTests{
+					NodeID: id, Format: r.Format, Total: r.Total, Passed: r.Passed, Failed: r.Failed, Skipped: r.Skipped,
+				})
+			}
+		}
+	}
+	return data
+}
@@ -0,0 +1,187 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/danshapiro/kilroy/internal/attractor/model"
+	"github.com/danshapiro/kilroy/internal/attractor/runtime"
+)
+
+func TestRun_OpensPullRequestAfterSuccess(t *testing.T) {
+	repo := t.TempDir()
+	runCmd(t, repo, "git", "init")
+	runCmd(t, repo, "git", "config", "user.name", "tester")
+	runCmd(t, repo, "git", "config", "user.email", "tester@example.com")
+	_ = os.WriteFile(filepath.Join(repo, "README.md"), []byte("hello\n"), 0o644)
+	runCmd(t, repo, "git", "add", "-A")
+	runCmd(t, repo, "git", "commit", "-m", "init")
+	bare := t.TempDir()
+	runCmd(t, bare, "git", "init", "--bare")
+	runCmd(t, repo, "git", "remote", "add", "origin", bare)
+
+	var got map[string]any
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/repos/acme/widgets/pulls" || r.Header.Get("Authorization") != "Bearer test-token" {
+			http.NotFound(w, r)
+			return
+		}
+		_ = json.NewDecoder(r.Body).Decode(&got)
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(`{"number": 12, "html_url": "https://github.example/acme/widgets/pull/12"}`))
+	}))
+	defer srv.Close()
+	t.Setenv("KILROY_TEST_FORGE_TOKEN", "test-token")
+
+	dot := []byte(`
+digraph G {
+  graph [goal="Add the widget package"]
+  start [shape=Mdiamond]
+  exit  [shape=Msquare]
+  impl  [shape=box, llm_provider=openai, llm_model=gpt-5.4, prompt="implement"]
+  start -> impl -> exit
+}
+`)
+	g, _, err := Prepare(dot)
+	if err != nil {
+		t.Fatalf("Prepare: %v", err)
+	}
+	cfg := &RunConfigFile{}
+	cfg.Version = 1
+	cfg.Git.PushRemote = "origin"
+	cfg.Git.PullRequest = &PullRequestConfig{
+		Forge:      "github",
+		APIBaseURL: srv.URL,
+		Repo:       "acme/widgets",
+		Base:       "main",
+		Draft:      true,
+		TokenEnv:   "KILROY_TEST_FORGE_TOKEN",
+	}
+
+	logsRoot := t.TempDir()
+	eng := &Engine{
+		Graph:       g,
+		Options:     RunOptions{RepoPath: repo, RunID: "pr-run", LogsRoot: logsRoot, WorktreeDir: filepath.Join(logsRoot, "worktree"), RunBranchPrefix: "attractor/run", RequireClean: true},
+		DotSource:   dot,
+		LogsRoot:    logsRoot,
+		WorktreeDir: filepath.Join(logsRoot, "worktree"),
+		Context:     runtime.NewContext(),
+		Registry:    NewDefaultRegistry(),
+		Interviewer: &AutoApproveInterviewer{},
+		CodergenBackend: &countingBackend{
+			fn: func(ctx context.Context, exec *Execution, node *model.Node, prompt string) (string, *runtime.Outcome, error) {
+				return "ok", &runtime.Outcome{Status: runtime.StatusSuccess, Notes: "Implemented the widget package"}, nil
+			},
+		},
+		RunConfig: cfg,
+	}
+	eng.RunBranch = "attractor/run/pr-run"
+
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+	res, err := eng.run(ctx)
+	if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if res.FinalStatus != runtime.FinalSuccess {
+		t.Fatalf("final status: %s", res.FinalStatus)
+	}
+
+	if got["head"] != "attractor/run/pr-run" || got["base"] != "main" || got["draft"] != true || got["title"] != "Add the widget package" {
+		t.Fatalf("pull request payload: %v", got)
+	}
+	body, _ := got["body"].(string)
+	for _, want := range []string{"## Goal", "**impl** (success): Implemented the widget package", "`pr-run`", logsRoot} {
+		if !strings.Contains(body, want) {
+			t.Fatalf("body missing %q:\n%s", want, body)
+		}
+	}
+
+	b, err := os.ReadFile(filepath.Join(logsRoot, "final.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var final runtime.FinalOutcome
+	if err := json.Unmarshal(b, &final); err != nil {
+		t.Fatal(err)
+	}
+	if final.PullRequestURL != "https://github.example/acme/widgets/pull/12" {
+		t.Fatalf("final.json pull_request_url: %q", final.PullRequestURL)
+	}
+	if out := runCmdOut(t, bare, "git", "branch", "--list", "attractor/run/pr-run"); !strings.Contains(out, "attractor/run/pr-run") {
+		t.Fatalf("run branch not pushed: %q", out)
+	}
+	// The pull request already pushed the branch; the final push is skipped.
+	progress, _ := os.ReadFile(filepath.Join(logsRoot, "progress.ndjson"))
+	if n := strings.Count(string(progress), `"event":"git_push_start"`); n != 1 {
+		t.Fatalf("git_push_start events: got %d want 1", n)
+	}
+}
+
+func TestRenderPullRequestTemplate_IncludesTestResults(t *testing.T) {
+	data := pullRequestData{
+		RunID: "r1",
+		Goal:  "Fix the parser\nand its tests",
+		Tests: []pullRequestTests{{NodeID: "verify", Format: "go-test-json", Total: 10, Passed: 9, Skipped: 1}},
+	}
+	title, err := renderPullRequestTemplate("title_template", "", defaultPullRequestTitleTemplate, data)
+	if err != nil || title != "Fix the parser" {
+		t.Fatalf("title: %q, %v", title, err)
+	}
+	body, err := renderPullRequestTemplate("body_template", "", defaultPullRequestBodyTemplate, data)
+	if err != nil || !strings.Contains(body, "**verify**: 9 passed, 0 failed, 1 skipped of 10 (go-test-json)") {
+		t.Fatalf("body: %q, %v", body, err)
+	}
+	custom, err := renderPullRequestTemplate("title_template", "[kilroy] {{.RunID}}", defaultPullRequestTitleTemplate, data)
+	if err != nil || custom != "[kilroy] r1" {
+		t.Fatalf("custom title: %q, %v", custom, err)
+	}
+}
+
+func TestLoadRunConfigFile_PullRequestValidation(t *testing.T) {
+	base := `
+version: 1
+repo:
+  path: /tmp/repo
+cxdb:
+  binary_addr: 127.0.0.1:9009
+  http_base_url: http://127.0.0.1:9010
+modeldb:
+  openrouter_model_info_path: /tmp/catalog.json
+`
+	cfg, err := loadRunConfigFromBytesForTest(t, []byte(base+`
+git:
+  push_remote: origin
+  pull_request:
+    forge: GitLab
+    base: main
+`))
+	if err != nil {
+		t.Fatalf("LoadRunConfigFile: %v", err)
+	}
+	if pr := cfg.Git.PullRequest; pr.Forge != "gitlab" || pr.TokenEnv != "GITLAB_TOKEN" {
+		t.Fatalf("pull_request defaults: %+v", pr)
+	}
+
+	cases := map[string]string{
+		"push_remote": "git:\n  pull_request:\n    base: main\n",
+		"base":        "git:\n  push_remote: origin\n  pull_request:\n    forge: github\n",
+		"gitea":       "git:\n  push_remote: origin\n  pull_request:\n    forge: gitea\n    base: main\n",
+		"template":    "git:\n  push_remote: origin\n  pull_request:\n    base: main\n    title_template: \"{{.Goal\"\n",
+		"forge":       "git:\n  push_remote: origin\n  pull_request:\n    forge: bitbucket\n    base: main\n",
+	}
+	for name, yml := range cases {
+		t.Run(name, func(t *testing.T) {
+			if _, err := loadRunConfigFromBytesForTest(t, []byte(base+yml)); err == nil || !strings.Contains(err.Error(), "git.pull_request") {
+				t.Fatalf("expected git.pull_request error, got %v", err)
+			}
+		})
+	}
+}
@@ -25,6 +25,7 @@ type manifest struct {
 	RunBranch     string            `json:"run_branch"`
 	RunConfigPath string            `json:"run_config_path"`
 	ForceModels   map[string]string `json:"force_models"`
+	Profile       string            `json:"profile"`
 
 	ModelDB struct {
 		OpenRouterModelInfoPath   string `json:"openrouter_model_info_path"`
@@ -43,6 +44,9 @@ type manifest struct {
 type ResumeOverrides struct {
 	CXDBHTTPBaseURL string
 	CXDBContextID   string
+	// StartNodeID, when set, executes that node next instead of re-evaluating
+	// routing from the checkpoint's current_node (used by Fork).
+	StartNodeID string
 }
 
 // Resume continues an existing run from {logs_root}/checkpoint.json.
@@ -112,11 +116,6 @@ func resumeFromLogsRoot(ctx context.Context, logsRoot string, ov ResumeOverrides
 	if err != nil {
 		return nil, err
 	}
-	g, _, err := Prepare(dotSource)
-	if err != nil {
-		return nil, err
-	}
-
 	// Best-effort: load the snapshotted run config if present.
 	cfgPath := strings.TrimSpace(m.RunConfigPath)
 	if cfgPath == "" {
@@ -132,6 +131,20 @@ func resumeFromLogsRoot(ctx context.Context, logsRoot string, ov ResumeOverrides
 	} else if err != nil && !os.IsNotExist(err) {
 		return nil, fmt.Errorf("resume: stat run config %s: %w", cfgPath, err)
 	}
+	// run_config.json already has the profile's config overlay applied; only
+	// its stylesheet has to be layered onto the graph again.
+	g, _, err := PrepareWithOptions(dotSource, PrepareOptions{
+		StylesheetOverlay: profileStylesheet(cfg, m.Profile),
+	})
+	if err != nil {
+		return nil, err
+	}
+	// Auto-routed nodes keep the models chosen when the run started.
+	modelRoutes, err := restoreModelRoutes(cp)
+	if err != nil {
+		return nil, fmt.Errorf("resume: %w", err)
+	}
+	modelRoutes = applyModelRoutes(g, modelRoutes)
 
 	// If we have a run config, resume with the real codergen router and CXDB sink.
 	var backend CodergenBackend = &SimulatedCodergenBackend{}
@@ -220,6 +233,7 @@ func resumeFromLogsRoot(ctx context.Context, logsRoot string, ov ResumeOverrides
 		RunBranchPrefix: prefix,
 		RequireClean:    resolveRequireClean(cfg),
 		ForceModels:     normalizeForceModels(copyStringStringMap(m.ForceModels)),
+		Profile:         strings.TrimSpace(m.Profile),
 	}
 	if err := opts.applyDefaults(); err != nil {
 		return nil, err
@@ -235,6 +249,7 @@ func resumeFromLogsRoot(ctx context.Context, logsRoot string, ov ResumeOverrides
 	}
 	eng = newBaseEngine(g, dotSource, opts)
 	eng.RunConfig = cfg
+	eng.ModelRoutes = modelRoutes
 	eng.ArtifactPolicy = resolvedArtifactPolicy
 	eng.CodergenBackend = backend
 	eng.CXDB = sink
@@ -266,7 +281,13 @@ func resumeFromLogsRoot(ctx context.Context, logsRoot string, ov ResumeOverrides
 		eng.Warn(inputInfererInitWarning)
 	}
 	eng.Context.ReplaceSnapshot(cp.ContextValues, cp.Logs)
+	stopNotifications := eng.startNotifications()
+	defer stopNotifications()
+	ctx, endTrace := eng.startRunTrace(ctx, "resume")
+	defer func() { endTrace(res, err) }()
+	eng.rootsMu.Lock()
 	eng.baseLogsRoot, eng.restartCount = restoreRestartState(logsRoot, cp)
+	eng.rootsMu.Unlock()
 	eng.restartFailureSignatures = restoreRestartFailureSignatures(cp)
 	eng.loopFailureSignatures = restoreLoopFailureSignatures(cp)
 	eng.baseSHA = cp.GitCommitSHA
@@ -291,6 +312,17 @@ func resumeFromLogsRoot(ctx context.Context, logsRoot string, ov ResumeOverrides
 		return nil, fmt.Errorf("repo has uncommitted changes (resume requires clean repo)")
 	}
 
+	// Keep whatever an interrupted stage left uncommitted: the worktree is
+	// reset below, and a resumed agent session restores it (see session_resume.go).
+	eng.sessionResumePending = true
+	if gitutil.IsRepo(eng.WorktreeDir) {
+		sha, err := gitutil.SnapshotWorktree(eng.WorktreeDir, interruptedWorktreeRef(m.RunID))
+		if err != nil {
+			eng.Warn(fmt.Sprintf("resume: snapshot interrupted worktree: %v", err))
+		}
+		eng.interruptedWorktreeSHA = sha
+	}
+
 	// Recreate branch pointer and worktree at the last checkpoint commit.
 	// The run branch may currently be checked out by the existing worktree at logs_root/worktree.
 	// Remove it first so we can safely force-move the branch pointer.
@@ -346,6 +378,27 @@ func resumeFromLogsRoot(ctx context.Context, logsRoot string, ov ResumeOverrides
 		nodeOutcomes[id] = o
 	}
 
+	if startNodeID := strings.TrimSpace(ov.StartNodeID); startNodeID != "" {
+		if eng.Graph.Nodes[startNodeID] == nil {
+			return nil, fmt.Errorf("resume: start node %q not in graph", startNodeID)
+		}
+		eng.incomingEdge = nil
+		for _, edge := range eng.Graph.Outgoing(lastNodeID) {
+			if edge != nil && edge.To == startNodeID {
+				eng.incomingEdge = edge
+				break
+			}
+		}
+		res, err = eng.runLoop(ctx, startNodeID, append([]string{}, cp.CompletedNodes...), copyStringIntMap(cp.NodeRetries), nodeOutcomes)
+		if err != nil {
+			return nil, err
+		}
+		if startup != nil {
+			res.CXDBUIURL = strings.TrimSpace(startup.UIURL)
+		}
+		return res, nil
+	}
+
 	// Kilroy v1: parallel nodes control the next hop via context.
 	if lastNode := eng.Graph.Nodes[lastNodeID]; lastNode != nil {
 		t := strings.TrimSpace(lastNode.TypeOverride())
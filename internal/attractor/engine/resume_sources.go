@@ -75,16 +75,26 @@ func ResumeFromCXDB(ctx context.Context, cxdbHTTPBaseURL string, contextID strin
 // of the logs_root in the default state directory.
 func ResumeFromBranch(ctx context.Context, repoPath string, runBranch string) (*Result, error) {
 	_ = repoPath // manifest is authoritative; repoPath is kept for future override support
+	logsRoot, err := LogsRootForRunBranch(runBranch)
+	if err != nil {
+		return nil, err
+	}
+	return resumeFromLogsRoot(ctx, logsRoot, ResumeOverrides{})
+}
+
+// LogsRootForRunBranch locates the logs_root of a run in the default state
+// directory from its git run branch name.
+func LogsRootForRunBranch(runBranch string) (string, error) {
 	runBranch = strings.TrimSpace(runBranch)
 	if runBranch == "" {
-		return nil, fmt.Errorf("run_branch is required")
+		return "", fmt.Errorf("run_branch is required")
 	}
 
 	// Common case: branch name ends with the run_id.
 	runID := filepath.Base(runBranch)
 	guess := defaultLogsRoot(runID)
 	if _, err := os.Stat(filepath.Join(guess, "manifest.json")); err == nil {
-		return resumeFromLogsRoot(ctx, guess, ResumeOverrides{})
+		return guess, nil
 	}
 
 	// Best-effort scan of the default runs directory for a manifest that matches run_branch.
@@ -101,9 +111,9 @@ func ResumeFromBranch(ctx context.Context, repoPath string, runBranch string) (*
 				continue
 			}
 			if strings.TrimSpace(m.RunBranch) == runBranch {
-				return resumeFromLogsRoot(ctx, logsRoot, ResumeOverrides{})
+				return logsRoot, nil
 			}
 		}
 	}
-	return nil, fmt.Errorf("could not locate logs_root for run_branch %q (tried %s and scanned %s)", runBranch, guess, runsDir)
+	return "", fmt.Errorf("could not locate logs_root for run_branch %q (tried %s and scanned %s)", runBranch, guess, runsDir)
 }
@@ -0,0 +1,97 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/danshapiro/kilroy/internal/attractor/runstate"
+)
+
+var runControlPollInterval = 250 * time.Millisecond
+
+// OperatorLogsRoot returns the directory that holds the run's operator
+// requests (run_control.json and the steering queue). Unlike LogsRoot it does
+// not move on loop_restart, and it is safe to call while the run is going.
+func (e *Engine) OperatorLogsRoot() string {
+	return e.operatorRoot()
+}
+
+// operatorRoot is where operator requests for the run live (run_control.json
+// and the steering queue): the base logs root, which loop_restart does not
+// move. Engines that never started a run fall back to LogsRoot.
+func (e *Engine) operatorRoot() string {
+	e.rootsMu.Lock()
+	defer e.rootsMu.Unlock()
+	if root := strings.TrimSpace(e.baseLogsRoot); root != "" {
+		return root
+	}
+	return strings.TrimSpace(e.LogsRoot)
+}
+
+// awaitRunControl is called at every node boundary of the top-level run. It
+// holds the run while the operator has it paused (see runstate.ControlFileName)
+// and consumes a step request by letting nodeID start and re-arming the pause.
+// While paused the stall watchdog is kept quiet; cancellation (attractor stop)
+// still ends the wait.
+func (e *Engine) awaitRunControl(ctx context.Context, nodeID string) error {
+	if e == nil {
+		return nil
+	}
+	root := e.operatorRoot()
+	if root == "" {
+		return nil
+	}
+	paused := false
+	warned := false
+	for {
+		c, err := runstate.LoadControl(root)
+		if err != nil {
+			// An unreadable control file is left as is: a half-edited file must
+			// not silently unpause the run, so keep waiting if already paused.
+			if !warned {
+				e.Warn(fmt.Sprintf("run control: %v", err))
+				warned = true
+			}
+			if !paused {
+				return nil
+			}
+			c.Mode = runstate.ControlPause
+		}
+		switch c.Mode {
+		case runstate.ControlStep:
+			if err := runstate.WriteControl(root, runstate.ControlPause, "engine"); err != nil {
+				return fmt.Errorf("run control: re-arm pause after step: %w", err)
+			}
+			e.appendProgress(map[string]any{
+				"event":   "run_step",
+				"node_id": nodeID,
+			})
+			return nil
+		case runstate.ControlPause:
+			if !paused {
+				paused = true
+				e.appendProgress(map[string]any{
+					"event":   "run_paused",
+					"node_id": nodeID,
+				})
+			}
+		default:
+			if paused {
+				e.appendProgress(map[string]any{
+					"event":   "run_unpaused",
+					"node_id": nodeID,
+				})
+			}
+			return nil
+		}
+
+		e.setLastProgressTime(time.Now().UTC())
+		select {
+		case <-ctx.Done():
+			return runContextError(ctx)
+		case <-time.After(runControlPollInterval):
+		}
+	}
+}
@@ -0,0 +1,215 @@
+package engine
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/danshapiro/kilroy/internal/attractor/model"
+	"github.com/danshapiro/kilroy/internal/attractor/runstate"
+	"github.com/danshapiro/kilroy/internal/attractor/runtime"
+)
+
+func TestRun_PauseStepAndUnpauseAtNodeBoundaries(t *testing.T) {
+	old := runControlPollInterval
+	runControlPollInterval = 10 * time.Millisecond
+	t.Cleanup(func() { runControlPollInterval = old })
+
+	dot := []byte(`digraph G {
+  start [shape=Mdiamond]
+  a [shape=parallelogram, tool_command="echo a > a.txt"]
+  b [shape=parallelogram, tool_command="echo b > b.txt"]
+  exit [shape=Msquare]
+  start -> a -> b -> exit
+}`)
+	repo := initTestRepo(t)
+	logsRoot := filepath.Join(t.TempDir(), "logs")
+	if err := os.MkdirAll(logsRoot, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	// A pause requested before the run starts holds it before the first node.
+	if err := runstate.WriteControl(logsRoot, runstate.ControlPause, "test"); err != nil {
+		t.Fatal(err)
+	}
+
+	type runResult struct {
+		res *Result
+		err error
+	}
+	done := make(chan runResult, 1)
+	go func() {
+		res, err := Run(context.Background(), dot, RunOptions{
+			RepoPath: repo,
+			LogsRoot: logsRoot,
+			// Pausing must not look like a stall.
+			StallTimeout:       200 * time.Millisecond,
+			StallCheckInterval: 20 * time.Millisecond,
+		})
+		done <- runResult{res, err}
+	}()
+
+	waitPausedBefore := func(nodeID string) {
+		t.Helper()
+		deadline := time.Now().Add(10 * time.Second)
+		for time.Now().Before(deadline) {
+			s, err := runstate.LoadSnapshot(logsRoot)
+			if err == nil && s.Paused && s.CurrentNodeID == nodeID {
+				if s.Control != runstate.ControlPause {
+					t.Fatalf("control while paused: %q", s.Control)
+				}
+				return
+			}
+			select {
+			case r := <-done:
+				t.Fatalf("run ended while waiting for pause before %s: %v", nodeID, r.err)
+			case <-time.After(20 * time.Millisecond):
+			}
+		}
+		t.Fatalf("run did not pause before %s", nodeID)
+	}
+
+	waitPausedBefore("start")
+	time.Sleep(300 * time.Millisecond) // longer than the stall timeout
+	if err := runstate.WriteControl(logsRoot, runstate.ControlStep, "test"); err != nil {
+		t.Fatal(err)
+	}
+	waitPausedBefore("a")
+	if err := runstate.WriteControl(logsRoot, runstate.ControlStep, "test"); err != nil {
+		t.Fatal(err)
+	}
+	waitPausedBefore("b")
+	wt := filepath.Join(logsRoot, "worktree")
+	assertExists(t, filepath.Join(wt, "a.txt"))
+	if _, err := os.Stat(filepath.Join(wt, "b.txt")); err == nil {
+		t.Fatal("b ran while the run was paused")
+	}
+
+	if err := runstate.WriteControl(logsRoot, runstate.ControlRun, "test"); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case r := <-done:
+		if r.err != nil {
+			t.Fatalf("Run: %v", r.err)
+		}
+		if r.res.FinalStatus != runtime.FinalSuccess {
+			t.Fatalf("final status: %q", r.res.FinalStatus)
+		}
+	case <-time.After(30 * time.Second):
+		t.Fatal("run did not finish after unpause")
+	}
+	assertExists(t, filepath.Join(wt, "b.txt"))
+}
+
+func TestAwaitRunControl_CancelEndsPause(t *testing.T) {
+	old := runControlPollInterval
+	runControlPollInterval = 10 * time.Millisecond
+	t.Cleanup(func() { runControlPollInterval = old })
+
+	logsRoot := t.TempDir()
+	if err := runstate.WriteControl(logsRoot, runstate.ControlPause, "test"); err != nil {
+		t.Fatal(err)
+	}
+	e := &Engine{LogsRoot: logsRoot}
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	if err := e.awaitRunControl(ctx, "impl"); err == nil {
+		t.Fatal("expected cancellation error while paused")
+	}
+}
+
+func TestRun_PauseAfterLoopRestartIsReadFromBaseLogsRoot(t *testing.T) {
+	old := runControlPollInterval
+	runControlPollInterval = 10 * time.Millisecond
+	t.Cleanup(func() { runControlPollInterval = old })
+
+	dot := []byte(`
+digraph G {
+  graph [goal="pause after restart", default_max_retry=0]
+  start [shape=Mdiamond]
+  exit  [shape=Msquare]
+  work  [shape=box, llm_provider=openai, llm_model=gpt-5.4, prompt="do work"]
+  check [shape=diamond]
+  start -> work
+  work -> check
+  check -> exit [condition="outcome=success"]
+  check -> work [condition="outcome=fail", loop_restart=true]
+  check -> exit
+}
+`)
+	repo := initTestRepo(t)
+	logsRoot := t.TempDir()
+	var calls atomic.Int32
+	backend := &countingBackend{
+		fn: func(ctx context.Context, exec *Execution, node *model.Node, prompt string) (string, *runtime.Outcome, error) {
+			if calls.Add(1) == 1 {
+				return "fail", &runtime.Outcome{Status: runtime.StatusFail, FailureReason: "temporary network error: connection reset by peer"}, nil
+			}
+			// The operator pauses the restarted iteration; the CLI and server
+			// write to the base logs root.
+			if err := runstate.WriteControl(logsRoot, runstate.ControlPause, "test"); err != nil {
+				return "", nil, err
+			}
+			return "ok", &runtime.Outcome{Status: runtime.StatusSuccess}, nil
+		},
+	}
+	g, _, err := Prepare(dot)
+	if err != nil {
+		t.Fatalf("Prepare: %v", err)
+	}
+	eng := &Engine{
+		Graph:           g,
+		Options:         RunOptions{RepoPath: repo, RunID: "pause-restart", LogsRoot: logsRoot, WorktreeDir: filepath.Join(logsRoot, "worktree"), RunBranchPrefix: "attractor/run", RequireClean: true},
+		DotSource:       dot,
+		LogsRoot:        logsRoot,
+		WorktreeDir:     filepath.Join(logsRoot, "worktree"),
+		Context:         runtime.NewContext(),
+		Registry:        NewDefaultRegistry(),
+		Interviewer:     &AutoApproveInterviewer{},
+		CodergenBackend: backend,
+	}
+	eng.RunBranch = "attractor/run/pause-restart"
+
+	type runResult struct {
+		res *Result
+		err error
+	}
+	done := make(chan runResult, 1)
+	go func() {
+		res, err := eng.run(context.Background())
+		done <- runResult{res, err}
+	}()
+
+	progress := filepath.Join(logsRoot, "restart-1", "progress.ndjson")
+	deadline := time.Now().Add(30 * time.Second)
+	for {
+		b, _ := os.ReadFile(progress)
+		if strings.Contains(string(b), `"event":"run_paused","node_id":"check"`) {
+			break
+		}
+		select {
+		case r := <-done:
+			t.Fatalf("run ended without pausing after the restart (err=%v):\n%s", r.err, b)
+		case <-time.After(20 * time.Millisecond):
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("run did not pause before check:\n%s", b)
+		}
+	}
+
+	if err := runstate.WriteControl(logsRoot, runstate.ControlRun, "test"); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case r := <-done:
+		if r.err != nil || r.res.FinalStatus != runtime.FinalSuccess {
+			t.Fatalf("run after unpause: %+v, %v", r.res, r.err)
+		}
+	case <-time.After(30 * time.Second):
+		t.Fatal("run did not finish after unpause")
+	}
+}
@@ -0,0 +1,185 @@
+package engine
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/danshapiro/kilroy/internal/attractor/style"
+)
+
+// RunProfile is a named overlay in run.yaml's profiles section, selected with
+// attractor run --profile <name>. Unset fields leave the base config alone.
+type RunProfile struct {
+	// ModelStylesheet rules are layered over the graph's model_stylesheet and
+	// outrank its rules; attributes written on a node still win.
+	ModelStylesheet string `json:"model_stylesheet,omitempty" yaml:"model_stylesheet,omitempty"`
+
+	LLM struct {
+		CLIProfile string `json:"cli_profile,omitempty" yaml:"cli_profile,omitempty"`
+		// Providers are merged field by field into llm.providers.
+		Providers map[string]ProviderConfig `json:"providers,omitempty" yaml:"providers,omitempty"`
+	} `json:"llm,omitempty" yaml:"llm,omitempty"`
+
+	RuntimePolicy RuntimePolicyConfig `json:"runtime_policy,omitempty" yaml:"runtime_policy,omitempty"`
+
+	Setup struct {
+		// Commands replace setup.commands when set.
+		Commands  []string `json:"commands,omitempty" yaml:"commands,omitempty"`
+		TimeoutMS int      `json:"timeout_ms,omitempty" yaml:"timeout_ms,omitempty"`
+	} `json:"setup,omitempty" yaml:"setup,omitempty"`
+}
+
+// ApplyProfile overlays the named profile onto cfg. Applying the profile that
+// is already applied is a no-op, so callers that need the effective config
+// early (the CLI's headless-provider warning) and RunWithConfig can both call
+// it.
+func (cfg *RunConfigFile) ApplyProfile(name string) error {
+	name = strings.TrimSpace(name)
+	if cfg == nil || name == "" {
+		return nil
+	}
+	if cfg.appliedProfile == name {
+		return nil
+	}
+	if cfg.appliedProfile != "" {
+		return fmt.Errorf("profile %q is already applied; cannot also apply %q", cfg.appliedProfile, name)
+	}
+	p, ok := cfg.Profiles[name]
+	if !ok {
+		return fmt.Errorf("unknown profile %q (defined: %s)", name, strings.Join(profileNames(cfg), ", "))
+	}
+	cfg.overlayProfile(p)
+	cfg.appliedProfile = name
+	return validateConfig(cfg)
+}
+
+func (cfg *RunConfigFile) overlayProfile(p RunProfile) {
+	if s := strings.TrimSpace(p.LLM.CLIProfile); s != "" {
+		cfg.LLM.CLIProfile = strings.ToLower(s)
+	}
+	if len(p.LLM.Providers) > 0 {
+		// Build a new map so a config copy never shares the overlaid entries.
+		providers := make(map[string]ProviderConfig, len(cfg.LLM.Providers)+len(p.LLM.Providers))
+		for k, v := range cfg.LLM.Providers {
+			providers[k] = v
+		}
+		for k, over := range p.LLM.Providers {
+			key := k
+			for existing := range providers {
+				if normalizeProviderKey(existing) == normalizeProviderKey(k) {
+					key = existing
+					break
+				}
+			}
+			providers[key] = mergeProviderConfig(providers[key], over)
+		}
+		cfg.LLM.Providers = providers
+	}
+
+	rp := p.RuntimePolicy
+	if rp.StageTimeoutMS != nil {
+		cfg.RuntimePolicy.StageTimeoutMS = copyOptionalInt(rp.StageTimeoutMS)
+	}
+	if rp.StallTimeoutMS != nil {
+		cfg.RuntimePolicy.StallTimeoutMS = copyOptionalInt(rp.StallTimeoutMS)
+	}
+	if rp.StallCheckIntervalMS != nil {
+		cfg.RuntimePolicy.StallCheckIntervalMS = copyOptionalInt(rp.StallCheckIntervalMS)
+	}
+	if rp.MaxLLMRetries != nil {
+		cfg.RuntimePolicy.MaxLLMRetries = copyOptionalInt(rp.MaxLLMRetries)
+	}
+
+	if cmds := trimNonEmpty(p.Setup.Commands); len(cmds) > 0 {
+		cfg.Setup.Commands = cmds
+	}
+	if p.Setup.TimeoutMS > 0 {
+		cfg.Setup.TimeoutMS = p.Setup.TimeoutMS
+	}
+}
+
+func mergeProviderConfig(base, over ProviderConfig) ProviderConfig {
+	if over.Backend != "" {
+		base.Backend = over.Backend
+	}
+	if s := strings.TrimSpace(over.Executable); s != "" {
+		base.Executable = s
+	}
+	if over.Failover != nil {
+		base.Failover = over.Failover
+	}
+	a := over.API
+	if a.Protocol != "" {
+		base.API.Protocol = a.Protocol
+	}
+	if a.BaseURL != "" {
+		base.API.BaseURL = a.BaseURL
+	}
+	if a.Path != "" {
+		base.API.Path = a.Path
+	}
+	if a.APIKeyEnv != "" {
+		base.API.APIKeyEnv = a.APIKeyEnv
+	}
+	if a.ProviderOptionsKey != "" {
+		base.API.ProviderOptionsKey = a.ProviderOptionsKey
+	}
+	if a.ProfileFamily != "" {
+		base.API.ProfileFamily = a.ProfileFamily
+	}
+	if len(a.Headers) > 0 {
+		headers := make(map[string]string, len(base.API.Headers)+len(a.Headers))
+		for k, v := range base.API.Headers {
+			headers[k] = v
+		}
+		for k, v := range a.Headers {
+			headers[k] = v
+		}
+		base.API.Headers = headers
+	}
+	return base
+}
+
+// validateProfiles checks that every profile's stylesheet parses and that the
+// config is still valid with the profile applied.
+func validateProfiles(cfg *RunConfigFile) error {
+	for _, name := range profileNames(cfg) {
+		if strings.TrimSpace(name) == "" {
+			return fmt.Errorf("profiles: profile name must not be empty")
+		}
+		p := cfg.Profiles[name]
+		if raw := strings.TrimSpace(p.ModelStylesheet); raw != "" {
+			if _, err := style.ParseStylesheet(raw); err != nil {
+				return fmt.Errorf("profiles.%s.model_stylesheet: %w", name, err)
+			}
+		}
+		probe := *cfg
+		probe.Profiles = nil
+		probe.appliedProfile = ""
+		probe.overlayProfile(p)
+		if err := validateConfig(&probe); err != nil {
+			return fmt.Errorf("profiles.%s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+func profileNames(cfg *RunConfigFile) []string {
+	names := make([]string, 0, len(cfg.Profiles))
+	for name := range cfg.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// profileStylesheet returns the stylesheet overlay of the named profile, or ""
+// when there is no such profile.
+func profileStylesheet(cfg *RunConfigFile, name string) string {
+	name = strings.TrimSpace(name)
+	if cfg == nil || name == "" {
+		return ""
+	}
+	return strings.TrimSpace(cfg.Profiles[name].ModelStylesheet)
+}
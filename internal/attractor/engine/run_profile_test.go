@@ -0,0 +1,197 @@
+package engine
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const profileTestConfig = `
+version: 1
+repo:
+  path: /tmp/repo
+cxdb:
+  binary_addr: 127.0.0.1:9009
+  http_base_url: http://127.0.0.1:9010
+llm:
+  providers:
+    openai:
+      backend: cli
+    anthropic:
+      backend: api
+modeldb:
+  openrouter_model_info_path: /tmp/catalog.json
+setup:
+  commands: ["make deps"]
+runtime_policy:
+  stage_timeout_ms: 600000
+profiles:
+  cheap:
+    model_stylesheet: "* { llm_provider: openai; llm_model: gpt-5.4-mini; }"
+    llm:
+      providers:
+        openai:
+          backend: api
+          api:
+            base_url: http://127.0.0.1:8080/v1
+    runtime_policy:
+      stage_timeout_ms: 60000
+      max_llm_retries: 0
+    setup:
+      commands: ["true"]
+  prod: {}
+`
+
+func TestRunConfigFile_ApplyProfileOverlaysConfig(t *testing.T) {
+	cfg, err := loadRunConfigFromBytesForTest(t, []byte(profileTestConfig))
+	if err != nil {
+		t.Fatalf("LoadRunConfigFile: %v", err)
+	}
+	if err := cfg.ApplyProfile("cheap"); err != nil {
+		t.Fatalf("ApplyProfile: %v", err)
+	}
+	openai := cfg.LLM.Providers["openai"]
+	if openai.Backend != BackendAPI || openai.API.BaseURL != "http://127.0.0.1:8080/v1" {
+		t.Fatalf("openai provider: %+v", openai)
+	}
+	if cfg.LLM.Providers["anthropic"].Backend != BackendAPI {
+		t.Fatalf("anthropic provider should be untouched: %+v", cfg.LLM.Providers["anthropic"])
+	}
+	if got := *cfg.RuntimePolicy.StageTimeoutMS; got != 60000 {
+		t.Fatalf("stage_timeout_ms: %d", got)
+	}
+	if cfg.RuntimePolicy.MaxLLMRetries == nil || *cfg.RuntimePolicy.MaxLLMRetries != 0 {
+		t.Fatalf("max_llm_retries: %v", cfg.RuntimePolicy.MaxLLMRetries)
+	}
+	if strings.Join(cfg.Setup.Commands, ",") != "true" {
+		t.Fatalf("setup.commands: %v", cfg.Setup.Commands)
+	}
+	if got := profileStylesheet(cfg, "cheap"); !strings.Contains(got, "gpt-5.4-mini") {
+		t.Fatalf("profile stylesheet: %q", got)
+	}
+
+	// Re-applying the same profile is a no-op; switching profiles is not allowed.
+	if err := cfg.ApplyProfile("cheap"); err != nil {
+		t.Fatalf("re-apply: %v", err)
+	}
+	if err := cfg.ApplyProfile("prod"); err == nil {
+		t.Fatal("expected error applying a second profile")
+	}
+}
+
+func TestRunConfigFile_ApplyProfileUnknownName(t *testing.T) {
+	cfg, err := loadRunConfigFromBytesForTest(t, []byte(profileTestConfig))
+	if err != nil {
+		t.Fatalf("LoadRunConfigFile: %v", err)
+	}
+	err = cfg.ApplyProfile("offline")
+	if err == nil || !strings.Contains(err.Error(), "cheap, prod") {
+		t.Fatalf("expected unknown profile error listing profiles, got %v", err)
+	}
+	if err := cfg.ApplyProfile(""); err != nil {
+		t.Fatalf("empty profile should be a no-op: %v", err)
+	}
+}
+
+func TestLoadRunConfigFile_RejectsInvalidProfile(t *testing.T) {
+	cases := map[string]string{
+		"stylesheet": `
+profiles:
+  bad:
+    model_stylesheet: "* { llm_model gpt-5.4 }"
+`,
+		"backend": `
+profiles:
+  bad:
+    llm:
+      providers:
+        openai:
+          backend: grpc
+`,
+		"runtime_policy": `
+profiles:
+  bad:
+    runtime_policy:
+      stage_timeout_ms: -1
+`,
+	}
+	base := `
+version: 1
+repo:
+  path: /tmp/repo
+cxdb:
+  binary_addr: 127.0.0.1:9009
+  http_base_url: http://127.0.0.1:9010
+modeldb:
+  openrouter_model_info_path: /tmp/catalog.json
+`
+	for name, profiles := range cases {
+		t.Run(name, func(t *testing.T) {
+			_, err := loadRunConfigFromBytesForTest(t, []byte(base+profiles))
+			if err == nil || !strings.Contains(err.Error(), "profiles.bad") {
+				t.Fatalf("expected profiles.bad error, got %v", err)
+			}
+		})
+	}
+}
+
+func TestPrepareWithOptions_ProfileStylesheetOverlay(t *testing.T) {
+	dot := []byte(`digraph G {
+  graph [goal="g", model_stylesheet="* { llm_provider: anthropic; llm_model: claude-opus-4.6; } #plan { llm_model: claude-sonnet-4.5; }"]
+  start [shape=Mdiamond]
+  exit [shape=Msquare]
+  plan [shape=box, prompt="plan"]
+  impl [shape=box, prompt="impl", llm_provider=openai, llm_model=gpt-5.4]
+  start -> plan -> impl -> exit
+}`)
+	g, _, err := PrepareWithOptions(dot, PrepareOptions{
+		StylesheetOverlay: "* { llm_provider: openai; llm_model: gpt-5.4-mini; timeout: 120s; }",
+	})
+	if err != nil {
+		t.Fatalf("PrepareWithOptions: %v", err)
+	}
+	plan := g.Nodes["plan"]
+	if plan.Attr("llm_model", "") != "gpt-5.4-mini" || plan.Attr("llm_provider", "") != "openai" || plan.Attr("timeout", "") != "120s" {
+		t.Fatalf("plan attrs: %v", plan.Attrs)
+	}
+	// Attributes written on the node win over the profile.
+	if got := g.Nodes["impl"].Attr("llm_model", ""); got != "gpt-5.4" {
+		t.Fatalf("impl llm_model: %q", got)
+	}
+
+	if _, _, err := PrepareWithOptions(dot, PrepareOptions{StylesheetOverlay: "* {"}); err == nil {
+		t.Fatal("expected error for malformed profile stylesheet")
+	}
+}
+
+func TestRunConfigFile_ProfilesRoundTripThroughRunConfigJSON(t *testing.T) {
+	cfg, err := loadRunConfigFromBytesForTest(t, []byte(profileTestConfig))
+	if err != nil {
+		t.Fatalf("LoadRunConfigFile: %v", err)
+	}
+	if err := cfg.ApplyProfile("cheap"); err != nil {
+		t.Fatalf("ApplyProfile: %v", err)
+	}
+	// run_config.json snapshots the overlaid config; resume reloads it and
+	// still finds the profile's stylesheet.
+	b, err := json.Marshal(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := filepath.Join(t.TempDir(), "run_config.json")
+	if err := os.WriteFile(p, b, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	reloaded, err := LoadRunConfigFile(p)
+	if err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	if reloaded.LLM.Providers["openai"].Backend != BackendAPI {
+		t.Fatalf("reloaded openai provider: %+v", reloaded.LLM.Providers["openai"])
+	}
+	if got := profileStylesheet(reloaded, "cheap"); !strings.Contains(got, "gpt-5.4-mini") {
+		t.Fatalf("reloaded profile stylesheet: %q", got)
+	}
+}
@@ -24,6 +24,7 @@ type runBootstrap struct {
 	Catalog                 *modeldb.Catalog
 	ModelCatalogSource      string
 	ModelCatalogPath        string
+	ModelRoutes             map[string]modelRoute
 	Runtimes                map[string]ProviderRuntime
 	InputInferer            InputReferenceInferer
 	ResolvedWarning         string
@@ -69,6 +70,7 @@ func RunWithConfig(ctx context.Context, dotSource []byte, cfg *RunConfigFile, ov
 	eng.ModelCatalogSHA = boot.Catalog.SHA256
 	eng.ModelCatalogSource = boot.ModelCatalogSource
 	eng.ModelCatalogPath = boot.ModelCatalogPath
+	eng.ModelRoutes = boot.ModelRoutes
 	eng.InputMaterializationPolicy = inputMaterializationPolicyFromConfig(boot.Config)
 	eng.InputReferenceInferer = boot.InputInferer
 	eng.InputInferenceCache = map[string][]InferredReference{}
@@ -89,7 +91,11 @@ func RunWithConfig(ctx context.Context, dotSource []byte, cfg *RunConfigFile, ov
 		boot.Options.OnEngineReady(eng)
 	}
 
-	res, err := eng.run(ctx)
+	stopNotifications := eng.startNotifications()
+	runCtx, endTrace := eng.startRunTrace(ctx, "run")
+	res, err := eng.run(runCtx)
+	endTrace(res, err)
+	stopNotifications()
 	if err != nil {
 		return nil, err
 	}
@@ -116,6 +122,9 @@ func bootstrapRunWithConfig(ctx context.Context, dotSource []byte, cfg *RunConfi
 		return nil, fmt.Errorf("config is nil")
 	}
 	applyConfigDefaults(cfg)
+	if err := cfg.ApplyProfile(overrides.Profile); err != nil {
+		return nil, err
+	}
 
 	// Create handler registry early so we can wire KnownTypes into validation
 	// and use it for provider requirement checks below.
@@ -141,9 +150,10 @@ func bootstrapRunWithConfig(ctx context.Context, dotSource []byte, cfg *RunConfi
 
 	// Prepare graph (parse + transforms + validate).
 	g, _, err := PrepareWithOptions(dotSource, PrepareOptions{
-		RepoPath:   cfg.Repo.Path,
-		KnownTypes: reg.KnownTypes(),
-		Catalog:    earlyCatalog,
+		RepoPath:          cfg.Repo.Path,
+		KnownTypes:        reg.KnownTypes(),
+		Catalog:           earlyCatalog,
+		StylesheetOverlay: profileStylesheet(cfg, overrides.Profile),
 	})
 	if err != nil {
 		return nil, err
@@ -224,6 +234,7 @@ func bootstrapRunWithConfig(ctx context.Context, dotSource []byte, cfg *RunConfi
 	opts.ProgressSink = overrides.ProgressSink
 	opts.Interviewer = overrides.Interviewer
 	opts.OnEngineReady = overrides.OnEngineReady
+	opts.Profile = strings.TrimSpace(overrides.Profile)
 
 	if err := opts.applyDefaults(); err != nil {
 		return nil, err
@@ -305,6 +316,22 @@ func bootstrapRunWithConfig(ctx context.Context, dotSource []byte, cfg *RunConfi
 	if err != nil {
 		return nil, err
 	}
+	modelRoutes, err := routeAutoModels(g, catalog, runtimes)
+	if err != nil {
+		return nil, err
+	}
+	if !runUsesCLIProviders {
+		for _, r := range modelRoutes {
+			if runtimes[r.Provider].Backend == BackendCLI {
+				// The routed model runs on a CLI backend; apply the CLI
+				// executable policy that was skipped above.
+				if err := validateRunCLIProfilePolicy(cfg, opts, true); err != nil {
+					return nil, err
+				}
+				break
+			}
+		}
+	}
 	catalogChecks, catalogErr := validateProviderModelPairs(g, runtimes, catalog, opts)
 	if catalogErr != nil {
 		report := &providerPreflightReport{
@@ -374,6 +401,7 @@ func bootstrapRunWithConfig(ctx context.Context, dotSource []byte, cfg *RunConfi
 		Catalog:                 catalog,
 		ModelCatalogSource:      resolved.Source,
 		ModelCatalogPath:        resolved.SnapshotPath,
+		ModelRoutes:             modelRoutes,
 		Runtimes:                runtimes,
 		InputInferer:            inputInferer,
 		ResolvedWarning:         resolvedWarning,
@@ -0,0 +1,128 @@
+package engine
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/danshapiro/kilroy/internal/agent"
+	"github.com/danshapiro/kilroy/internal/attractor/gitutil"
+)
+
+// sessionJournalFileName is the per-stage agent_loop transcript. A journal
+// without an end marker belongs to a session that was interrupted mid-stage.
+const sessionJournalFileName = "session_journal.ndjson"
+
+func interruptedWorktreeRef(runID string) string {
+	return "refs/kilroy/" + runID + "/interrupted"
+}
+
+// bindSessionResume ties a resume's pending session to nodeID, the first
+// stage the resumed run executes: the stage the run was interrupted in.
+func (e *Engine) bindSessionResume(nodeID string) {
+	e.sessionResumeMu.Lock()
+	defer e.sessionResumeMu.Unlock()
+	if e.sessionResumePending && e.sessionResumeNode == "" {
+		e.sessionResumeNode = nodeID
+	}
+}
+
+// dropSessionResume ends the resume window once the bound stage has run, so
+// no later stage continues a stale journal (such as one left in an earlier
+// visit_N/).
+func (e *Engine) dropSessionResume() {
+	e.sessionResumeMu.Lock()
+	defer e.sessionResumeMu.Unlock()
+	e.sessionResumePending = false
+	e.sessionResumeNode = ""
+	e.interruptedWorktreeSHA = ""
+}
+
+// claimInterruptedSession returns the transcript to continue when nodeID is
+// the stage a resumed run was interrupted in and its journal was left open by
+// the interrupted run. Re-entering the stage archives the interrupted visit
+// into visit_N/, so the latest visit's journal is considered too. Journals
+// recorded for a different provider/model are not resumed (the stage
+// restarts from scratch).
+func claimInterruptedSession(execCtx *Execution, nodeID string, stageDir string, profile agent.ProviderProfile) *agent.Journal {
+	if execCtx == nil || execCtx.Engine == nil {
+		return nil
+	}
+	e := execCtx.Engine
+	e.sessionResumeMu.Lock()
+	defer e.sessionResumeMu.Unlock()
+	if !e.sessionResumePending || e.sessionResumeNode != nodeID {
+		return nil
+	}
+	j, err := agent.LoadJournal(filepath.Join(stageDir, sessionJournalFileName))
+	if os.IsNotExist(err) {
+		j, err = agent.LoadJournal(filepath.Join(latestVisitDir(stageDir), sessionJournalFileName))
+	}
+	if err != nil || j.Ended || len(j.Turns) == 0 {
+		return nil
+	}
+	if j.Provider != profile.ID() || j.Model != profile.Model() {
+		e.Warn(fmt.Sprintf("%s: not resuming interrupted session recorded for %s/%s (stage now runs %s/%s)",
+			nodeID, j.Provider, j.Model, profile.ID(), profile.Model()))
+		return nil
+	}
+	e.sessionResumePending = false
+	return j
+}
+
+func latestVisitDir(stageDir string) string {
+	entries, _ := os.ReadDir(stageDir)
+	best, bestN := "", 0
+	for _, entry := range entries {
+		n, err := strconv.Atoi(strings.TrimPrefix(entry.Name(), "visit_"))
+		if entry.IsDir() && err == nil && n > bestN {
+			best, bestN = entry.Name(), n
+		}
+	}
+	return filepath.Join(stageDir, best)
+}
+
+// interruptedSessionNote reconciles the worktree with the resumed transcript
+// and returns the message that continues the conversation. Resume recreated
+// the worktree at the last checkpoint, so the stage's uncommitted work is
+// re-applied from the snapshot taken before the reset.
+func interruptedSessionNote(execCtx *Execution, nodeID string, turns int) string {
+	e := execCtx.Engine
+	sha := strings.TrimSpace(e.interruptedWorktreeSHA)
+	e.interruptedWorktreeSHA = ""
+	var worktree string
+	restored := false
+	switch {
+	case sha == "":
+		worktree = "The worktree had no uncommitted changes when the run stopped; it is at the last checkpoint."
+	case filepath.Clean(execCtx.WorktreeDir) != filepath.Clean(e.WorktreeDir):
+		worktree = fmt.Sprintf("The worktree was reset to the last checkpoint. Your uncommitted changes from before the interruption are saved in stash commit %s (inspect with `git stash show -p %s`).", sha, sha)
+	default:
+		if err := gitutil.ApplySnapshot(execCtx.WorktreeDir, sha); err != nil {
+			worktree = fmt.Sprintf("The worktree was reset to the last checkpoint and your uncommitted changes could not be re-applied cleanly (%v). They are saved in stash commit %s (inspect with `git stash show -p %s`).", err, sha, sha)
+		} else {
+			restored = true
+			worktree = "Your uncommitted changes from before the interruption were restored into the worktree."
+		}
+	}
+	status, _ := gitutil.StatusPorcelain(execCtx.WorktreeDir)
+	status = strings.TrimRight(status, "\n")
+	if status == "" {
+		status = "(clean)"
+	}
+	e.appendProgress(map[string]any{
+		"event":             "session_resumed",
+		"node_id":           nodeID,
+		"turns":             turns,
+		"worktree_snapshot": sha,
+		"worktree_restored": restored,
+	})
+	return fmt.Sprintf(`[kilroy] You were interrupted: the run stopped in the middle of this stage and has been resumed from your transcript.
+%s
+Any tool call that was in flight did not complete. Current `+"`git status --short`"+`:
+%s
+
+Re-check the files you were working on before relying on earlier tool results, then continue the original task from where you left off.`, worktree, status)
+}
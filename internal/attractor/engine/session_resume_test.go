@@ -0,0 +1,153 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/danshapiro/kilroy/internal/agent"
+)
+
+func TestResume_APIAgentLoop_ContinuesInterruptedSessionTranscript(t *testing.T) {
+	repo := initTestRepo(t)
+	pinned := writePinnedCatalog(t)
+	cxdbSrv := newCXDBTestServer(t)
+
+	runCtx, stopRun := context.WithCancel(context.Background())
+	defer stopRun()
+	var mu sync.Mutex
+	var resumedReq string
+	openaiSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		body := string(b)
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case strings.Contains(body, "You were interrupted"):
+			mu.Lock()
+			resumedReq = body
+			mu.Unlock()
+			_, _ = w.Write([]byte(`{"id":"r3","model":"gpt-5.4","output":[{"type":"message","content":[{"type":"output_text","text":"finished"}]}],"usage":{"input_tokens":1,"output_tokens":1,"total_tokens":2}}`))
+		case strings.Contains(body, "build the widget") && strings.Contains(body, `"function_call_output"`):
+			// The laptop goes to sleep while the second model call is in flight.
+			stopRun()
+			time.Sleep(200 * time.Millisecond)
+			_, _ = w.Write([]byte(`{"id":"r2","model":"gpt-5.4","output":[{"type":"message","content":[{"type":"output_text","text":"too late"}]}]}`))
+		case strings.Contains(body, "build the widget"):
+			args, _ := json.Marshal(`{"file_path":"widget.txt","content":"half a widget\n"}`)
+			_, _ = w.Write([]byte(fmt.Sprintf(`{"id":"r1","model":"gpt-5.4","output":[{"type":"function_call","call_id":"c1","name":"write_file","arguments":%s}],"usage":{"input_tokens":5,"output_tokens":1,"total_tokens":6}}`, args)))
+		default:
+			_, _ = w.Write([]byte(`{"id":"p","model":"gpt-5.4","output":[{"type":"message","content":[{"type":"output_text","text":"ok"}]}]}`))
+		}
+	}))
+	t.Cleanup(openaiSrv.Close)
+	t.Setenv("OPENAI_API_KEY", "k")
+	t.Setenv("OPENAI_BASE_URL", openaiSrv.URL)
+
+	cfg := &RunConfigFile{Version: 1}
+	cfg.Repo.Path = repo
+	cfg.CXDB.BinaryAddr = cxdbSrv.BinaryAddr()
+	cfg.CXDB.HTTPBaseURL = cxdbSrv.URL()
+	cfg.LLM.Providers = map[string]ProviderConfig{"openai": {Backend: BackendAPI, Failover: []string{}}}
+	cfg.ModelDB.OpenRouterModelInfoPath = pinned
+	cfg.ModelDB.OpenRouterModelInfoUpdatePolicy = "pinned"
+	cfg.Git.RunBranchPrefix = "attractor/run"
+
+	dot := []byte(`
+digraph G {
+  graph [goal="test"]
+  start [shape=Mdiamond]
+  exit  [shape=Msquare]
+  a [shape=box, llm_provider=openai, llm_model=gpt-5.4, status_tool=file, prompt="build the widget"]
+  start -> a -> exit
+}
+`)
+	logsRoot := t.TempDir()
+	if _, err := RunWithConfig(runCtx, dot, cfg, RunOptions{RunID: "test-session-resume", LogsRoot: logsRoot}); err == nil {
+		t.Fatalf("expected the interrupted run to fail")
+	}
+	j, err := agent.LoadJournal(filepath.Join(logsRoot, "a", sessionJournalFileName))
+	if err != nil || j.Ended || len(j.Turns) < 3 {
+		t.Fatalf("interrupted journal: %+v %v", j, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+	res, err := Resume(ctx, logsRoot)
+	if err != nil {
+		t.Fatalf("Resume: %v", err)
+	}
+	mu.Lock()
+	req := resumedReq
+	mu.Unlock()
+	for _, want := range []string{"build the widget", `"call_id":"c1"`, "were restored", "widget.txt"} {
+		if !strings.Contains(req, want) {
+			t.Fatalf("resumed request missing %q:\n%s", want, req)
+		}
+	}
+	if b, err := os.ReadFile(filepath.Join(res.WorktreeDir, "widget.txt")); err != nil || string(b) != "half a widget\n" {
+		t.Fatalf("widget.txt after resume: %q %v", b, err)
+	}
+	if j, err := agent.LoadJournal(filepath.Join(logsRoot, "a", sessionJournalFileName)); err != nil || !j.Ended {
+		t.Fatalf("resumed journal should be closed: %+v %v", j, err)
+	}
+	for _, ev := range readFixtureProgressEvents(t, filepath.Join(logsRoot, "progress.ndjson")) {
+		if ev["event"] == "session_resumed" {
+			if ev["node_id"] != "a" || ev["worktree_restored"] != true {
+				t.Fatalf("session_resumed: %v", ev)
+			}
+			return
+		}
+	}
+	t.Fatalf("no session_resumed progress event")
+}
+
+func TestClaimInterruptedSession_OnlyTheFirstResumedStageClaims(t *testing.T) {
+	logsRoot := t.TempDir()
+	// b's first visit was interrupted long ago; its journal is archived but
+	// still open.
+	journal := strings.Join([]string{
+		`{"kind":"SESSION_START","provider":"openai","model":"gpt-5.4"}`,
+		`{"kind":"USER_INPUT","message":{"role":"user","content":[{"kind":"text","text":"old task"}]}}`,
+	}, "\n") + "\n"
+	for _, dir := range []string{filepath.Join(logsRoot, "a"), filepath.Join(logsRoot, "b", "visit_1")} {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, sessionJournalFileName), []byte(journal), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	profile := agent.NewOpenAIProfile("gpt-5.4")
+	e := &Engine{LogsRoot: logsRoot, sessionResumePending: true}
+	exec := &Execution{Engine: e}
+
+	e.bindSessionResume("a")
+	if j := claimInterruptedSession(exec, "b", filepath.Join(logsRoot, "b"), profile); j != nil {
+		t.Fatalf("b claimed the resume bound to a")
+	}
+	if j := claimInterruptedSession(exec, "a", filepath.Join(logsRoot, "a"), profile); j == nil || len(j.Turns) != 1 {
+		t.Fatalf("a did not claim its journal: %+v", j)
+	}
+	e.dropSessionResume()
+
+	// A resumed stage that finds nothing to continue still ends the window.
+	e.sessionResumePending = true
+	e.bindSessionResume("c")
+	if j := claimInterruptedSession(exec, "c", filepath.Join(logsRoot, "c"), profile); j != nil {
+		t.Fatalf("c has no journal: %+v", j)
+	}
+	e.dropSessionResume()
+	e.bindSessionResume("b")
+	if j := claimInterruptedSession(exec, "b", filepath.Join(logsRoot, "b"), profile); j != nil {
+		t.Fatalf("b resumed a stale journal after the resumed stage finished")
+	}
+}
@@ -0,0 +1,528 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/danshapiro/kilroy/internal/attractor/model"
+	"github.com/danshapiro/kilroy/internal/attractor/runtime"
+)
+
+// defaultSimMaxSteps bounds stage executions in a simulation. Unlike a real
+// run, a scripted cycle costs nothing, so something has to stop it.
+const defaultSimMaxSteps = 1000
+
+// SimScript scripts node outcomes for Simulate.
+//
+//	context:
+//	  feature: login
+//	nodes:
+//	  verify:                 # one entry per execution; the last repeats
+//	    - {status: fail, failure_reason: tests failed}
+//	    - success
+//	  review: {status: success, preferred_label: approve}
+type SimScript struct {
+	// Context seeds the run context before the start node.
+	Context map[string]any         `json:"context,omitempty" yaml:"context,omitempty"`
+	Nodes   map[string]SimOutcomes `json:"nodes,omitempty" yaml:"nodes,omitempty"`
+}
+
+// SimOutcomes is a node's script: a single outcome or a list consumed one
+// per execution, so retries and revisits each take the next entry.
+type SimOutcomes []SimOutcome
+
+func (s *SimOutcomes) UnmarshalYAML(n *yaml.Node) error {
+	if n.Kind == yaml.SequenceNode {
+		var list []SimOutcome
+		if err := n.Decode(&list); err != nil {
+			return err
+		}
+		*s = list
+		return nil
+	}
+	var one SimOutcome
+	if err := n.Decode(&one); err != nil {
+		return err
+	}
+	*s = SimOutcomes{one}
+	return nil
+}
+
+// SimOutcome is a scripted status.json. A bare string is shorthand for
+// {status: <string>}.
+type SimOutcome struct {
+	Status           string         `json:"status" yaml:"status"`
+	PreferredLabel   string         `json:"preferred_label,omitempty" yaml:"preferred_label,omitempty"`
+	SuggestedNextIDs []string       `json:"suggested_next_ids,omitempty" yaml:"suggested_next_ids,omitempty"`
+	ContextUpdates   map[string]any `json:"context_updates,omitempty" yaml:"context_updates,omitempty"`
+	Notes            string         `json:"notes,omitempty" yaml:"notes,omitempty"`
+	FailureReason    string         `json:"failure_reason,omitempty" yaml:"failure_reason,omitempty"`
+	FailureClass     string         `json:"failure_class,omitempty" yaml:"failure_class,omitempty"`
+	FailureSignature string         `json:"failure_signature,omitempty" yaml:"failure_signature,omitempty"`
+}
+
+func (o *SimOutcome) UnmarshalYAML(n *yaml.Node) error {
+	if n.Kind == yaml.ScalarNode {
+		*o = SimOutcome{Status: n.Value}
+		return nil
+	}
+	type plain SimOutcome
+	var p plain
+	if err := decodeStrict(n, &p); err != nil {
+		return err
+	}
+	*o = SimOutcome(p)
+	return nil
+}
+
+// decodeStrict decodes n rejecting unknown fields, so a misspelled key in a
+// script is an error instead of a silently ignored outcome.
+func decodeStrict(n *yaml.Node, v any) error {
+	b, err := yaml.Marshal(n)
+	if err != nil {
+		return err
+	}
+	dec := yaml.NewDecoder(bytes.NewReader(b))
+	dec.KnownFields(true)
+	return dec.Decode(v)
+}
+
+func (o SimOutcome) outcome() (runtime.Outcome, error) {
+	st, err := runtime.ParseStageStatus(o.Status)
+	if err != nil {
+		return runtime.Outcome{}, err
+	}
+	out := runtime.Outcome{
+		Status:           st,
+		PreferredLabel:   o.PreferredLabel,
+		SuggestedNextIDs: o.SuggestedNextIDs,
+		ContextUpdates:   o.ContextUpdates,
+		Notes:            o.Notes,
+		FailureReason:    o.FailureReason,
+	}
+	if (st == runtime.StatusFail || st == runtime.StatusRetry) && out.FailureReason == "" {
+		out.FailureReason = "scripted " + string(st)
+	}
+	if o.FailureClass != "" || o.FailureSignature != "" {
+		out.Meta = map[string]any{}
+		if o.FailureClass != "" {
+			out.Meta["failure_class"] = o.FailureClass
+		}
+		if o.FailureSignature != "" {
+			out.Meta["failure_signature"] = o.FailureSignature
+		}
+	}
+	return out, nil
+}
+
+// ParseSimScript decodes a simulation script.
+func ParseSimScript(b []byte) (*SimScript, error) {
+	var s SimScript
+	dec := yaml.NewDecoder(bytes.NewReader(b))
+	dec.KnownFields(true)
+	if err := dec.Decode(&s); err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	if err := s.Validate(); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// Validate checks that every scripted entry has a status.
+func (s *SimScript) Validate() error {
+	for _, id := range sortedKeys(s.Nodes) {
+		for i, o := range s.Nodes[id] {
+			if _, err := o.outcome(); err != nil {
+				return fmt.Errorf("nodes.%s[%d]: %w", id, i, err)
+			}
+		}
+	}
+	return nil
+}
+
+// LoadSimScript reads and decodes a simulation script file.
+func LoadSimScript(path string) (*SimScript, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	s, err := ParseSimScript(b)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return s, nil
+}
+
+type SimOptions struct {
+	// MaxSteps bounds stage executions (attempts); 0 means 1000.
+	MaxSteps int
+}
+
+// SimStep is one entry in a simulation trace, taken from the engine's
+// progress events.
+type SimStep struct {
+	// Event is one of stage, retry, retry_blocked, edge, fail_fallback,
+	// goal_gate, fan_out, branch, loop_restart, loop_restart_blocked or
+	// breaker.
+	Event   string `json:"event"`
+	NodeID  string `json:"node_id,omitempty"`
+	Visit   int    `json:"visit,omitempty"`
+	Attempt int    `json:"attempt,omitempty"`
+	Status  string `json:"status,omitempty"`
+	To      string `json:"to,omitempty"`
+	Detail  string `json:"detail,omitempty"`
+}
+
+func (s SimStep) String() string {
+	switch s.Event {
+	case "stage":
+		line := fmt.Sprintf("%s (visit %d, attempt %d): %s", s.NodeID, s.Visit, s.Attempt, s.Status)
+		if s.Detail != "" {
+			line += " — " + s.Detail
+		}
+		return line
+	case "edge":
+		return fmt.Sprintf("  %s -> %s %s", s.NodeID, s.To, s.Detail)
+	case "retry":
+		return fmt.Sprintf("  retry %s (%s)", s.NodeID, s.Detail)
+	case "retry_blocked":
+		return fmt.Sprintf("  no retry for %s (%s)", s.NodeID, s.Detail)
+	case "fail_fallback":
+		return fmt.Sprintf("  %s failed with no matching edge -> retry_target %s", s.NodeID, s.To)
+	case "goal_gate":
+		if s.To == "" {
+			return fmt.Sprintf("goal gate %s unsatisfied; no retry target", s.NodeID)
+		}
+		return fmt.Sprintf("goal gate %s unsatisfied -> retry_target %s", s.NodeID, s.To)
+	case "fan_out":
+		return fmt.Sprintf("  fan-out from %s joined %s at %s", s.NodeID, s.Detail, s.To)
+	case "branch":
+		return fmt.Sprintf("  branch %s: %s", s.NodeID, s.Status)
+	case "loop_restart":
+		return fmt.Sprintf("loop_restart %s from %s -> %s", s.Detail, s.NodeID, s.To)
+	default:
+		return fmt.Sprintf("%s %s: %s", s.Event, s.NodeID, s.Detail)
+	}
+}
+
+// SimResult is the outcome of Simulate.
+type SimResult struct {
+	FinalStatus   runtime.FinalStatus `json:"final_status"`
+	FailureReason string              `json:"failure_reason,omitempty"`
+	// Path lists node visits in execution order, including parallel
+	// branch nodes and visits after loop restarts.
+	Path     []string       `json:"path"`
+	Visits   map[string]int `json:"visits"`
+	Retries  map[string]int `json:"retries,omitempty"`
+	Restarts int            `json:"restarts,omitempty"`
+	// GoalGatesFired lists goal gates found unsatisfied at an exit, in order.
+	GoalGatesFired []string       `json:"goal_gates_fired,omitempty"`
+	Context        map[string]any `json:"context"`
+	Steps          []SimStep      `json:"steps"`
+}
+
+// Simulate runs g through the engine's own loop with a registry whose
+// handlers return scripted outcomes: edge selection, retries, fail
+// fallbacks, goal gates, loop restarts, parallel fan-out, run control and
+// the cycle breakers are all the engine's. The run has no repository or
+// worktree and calls no provider; its logs go to a temporary directory that
+// is removed afterwards.
+//
+// Unscripted nodes succeed, except that start, exit, conditional, human gate
+// (first option), parallel and fan-in nodes run their real handlers. A
+// scripted parallel node still runs its branches. An error means the graph
+// or script could not be simulated; a run the engine fails is a FinalFail
+// result carrying the engine's failure reason.
+func Simulate(g *model.Graph, script *SimScript, opts SimOptions) (*SimResult, error) {
+	if g == nil {
+		return nil, fmt.Errorf("graph is nil")
+	}
+	if script == nil {
+		script = &SimScript{}
+	}
+	if err := script.Validate(); err != nil {
+		return nil, err
+	}
+	for _, id := range sortedKeys(script.Nodes) {
+		if g.Nodes[id] == nil {
+			return nil, fmt.Errorf("script names unknown node %q", id)
+		}
+	}
+	if findStartNodeID(g) == "" {
+		return nil, fmt.Errorf("no start node found")
+	}
+	logsRoot, err := os.MkdirTemp("", "kilroy-simulate-")
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = os.RemoveAll(logsRoot) }()
+
+	ctx, cancel := context.WithCancelCause(context.Background())
+	defer cancel(nil)
+	rec := &simRecorder{
+		script:      script,
+		maxSteps:    opts.MaxSteps,
+		stop:        cancel,
+		executions:  map[string]int{},
+		maxAttempts: map[string]int{},
+		res: &SimResult{
+			Visits:  map[string]int{},
+			Retries: map[string]int{},
+		},
+	}
+	if rec.maxSteps <= 0 {
+		rec.maxSteps = defaultSimMaxSteps
+	}
+	eng := newBaseEngine(g, nil, RunOptions{
+		RunID:           "simulate",
+		LogsRoot:        logsRoot,
+		RunBranchPrefix: "attractor/run",
+		ProgressSink:    rec.event,
+	})
+	eng.simulated = true
+	eng.Registry = rec.registry()
+	eng.Context.ApplyUpdates(script.Context)
+
+	_, runErr := eng.run(ctx)
+
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	res := rec.res
+	if runErr != nil && res.FinalStatus == "" {
+		res.FinalStatus = runtime.FinalFail
+		res.FailureReason = runErr.Error()
+	}
+	res.Context = eng.Context.SnapshotValues()
+	return res, nil
+}
+
+// errSimStepLimit ends a simulation that exceeded its step budget.
+type errSimStepLimit struct{ limit int }
+
+func (e errSimStepLimit) Error() string {
+	return fmt.Sprintf("simulation stopped after %d stage executions", e.limit)
+}
+
+// simRealHandlers are the handler types that run for unscripted nodes. They
+// only route, so they behave in a simulation as they do in a run.
+var simRealHandlers = map[string]bool{
+	"start":           true,
+	"exit":            true,
+	"conditional":     true,
+	"wait.human":      true,
+	"parallel":        true,
+	"parallel.fan_in": true,
+}
+
+// simRecorder hands out scripted outcomes and builds the SimResult from the
+// engine's progress events.
+type simRecorder struct {
+	script   *SimScript
+	maxSteps int
+	stop     context.CancelCauseFunc
+
+	mu          sync.Mutex
+	executions  map[string]int
+	steps       int
+	maxAttempts map[string]int
+	res         *SimResult
+}
+
+// registry wraps every default handler in a scriptedHandler.
+func (r *simRecorder) registry() *HandlerRegistry {
+	reg := NewDefaultRegistry()
+	for t, h := range reg.handlers {
+		reg.handlers[t] = &scriptedHandler{inner: h, real: simRealHandlers[t], rec: r}
+	}
+	reg.defaultHandler = reg.handlers["codergen"]
+	return reg
+}
+
+// next counts an execution of nodeID against the step budget and returns
+// its next scripted outcome, if it has one. Past the budget it stops the run.
+func (r *simRecorder) next(nodeID string) (runtime.Outcome, bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.steps++
+	if r.steps > r.maxSteps {
+		lim := errSimStepLimit{limit: r.maxSteps}
+		r.step(SimStep{Event: "breaker", NodeID: nodeID, Detail: lim.Error()})
+		r.stop(lim)
+		return runtime.Outcome{}, false, lim
+	}
+	outs := r.script.Nodes[nodeID]
+	if len(outs) == 0 {
+		return runtime.Outcome{}, false, nil
+	}
+	i := r.executions[nodeID]
+	r.executions[nodeID]++
+	if i >= len(outs) {
+		i = len(outs) - 1
+	}
+	out, _ := outs[i].outcome() // validated by Simulate
+	return out, true, nil
+}
+
+// exit records the exit node, which the engine runs without attempt events.
+func (r *simRecorder) exit(nodeID string, out runtime.Outcome) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.visit(nodeID)
+	r.step(SimStep{Event: "stage", NodeID: nodeID, Visit: r.res.Visits[nodeID], Attempt: 1, Status: string(out.Status), Detail: out.FailureReason})
+}
+
+func (r *simRecorder) visit(nodeID string) {
+	r.res.Path = append(r.res.Path, nodeID)
+	r.res.Visits[nodeID]++
+}
+
+func (r *simRecorder) step(st SimStep) {
+	r.res.Steps = append(r.res.Steps, st)
+}
+
+// event is the engine's progress sink.
+func (r *simRecorder) event(ev map[string]any) {
+	if eventFieldString(ev, "event") == "branch_progress" {
+		ev = unwrapBranchProgress(ev)
+	}
+	field := func(key string) string { return eventFieldString(ev, key) }
+	num := func(key string) int {
+		n, _ := strconv.Atoi(field(key))
+		return n
+	}
+	nodeID := field("node_id")
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	switch name := field("event"); name {
+	case "stage_attempt_start":
+		if num("attempt") == 1 {
+			r.visit(nodeID)
+		}
+		r.maxAttempts[nodeID] = num("max")
+	case "stage_attempt_end":
+		r.step(SimStep{Event: "stage", NodeID: nodeID, Visit: r.res.Visits[nodeID], Attempt: num("attempt"), Status: field("status"), Detail: field("failure_reason")})
+	case "stage_retry_sleep":
+		r.res.Retries[nodeID]++
+		next := num("attempt") + 1
+		r.step(SimStep{Event: "retry", NodeID: nodeID, Attempt: next, Detail: fmt.Sprintf("attempt %d of %d", next, r.maxAttempts[nodeID])})
+	case "stage_retry_blocked":
+		r.step(SimStep{Event: "retry_blocked", NodeID: nodeID, Attempt: num("attempt"),
+			Detail: fmt.Sprintf("failure_class=%s is not retryable", normalizedFailureClassOrDefault(field("failure_class")))})
+	case "edge_selected":
+		r.step(SimStep{Event: "edge", NodeID: field("from_node"), To: field("to_node"), Detail: simEdgeDetail(field("label"), field("condition"), field("hop_source"))})
+	case "no_matching_fail_edge_fallback":
+		r.step(SimStep{Event: "fail_fallback", NodeID: nodeID, To: field("retry_target")})
+	case "goal_gate_unsatisfied":
+		r.res.GoalGatesFired = append(r.res.GoalGatesFired, nodeID)
+		r.step(SimStep{Event: "goal_gate", NodeID: nodeID, To: field("retry_target")})
+	case "implicit_fan_out":
+		r.step(SimStep{Event: "fan_out", NodeID: field("source_node"), To: field("join_node"), Detail: fmt.Sprintf("%d branches", num("branches"))})
+	case "branch_subgraph_done":
+		r.step(SimStep{Event: "branch", NodeID: field("branch_key"), Status: field("status")})
+	case "loop_restart":
+		r.res.Restarts = num("restart_count")
+		r.step(SimStep{Event: "loop_restart", NodeID: nodeID, To: field("target_node"), Detail: fmt.Sprintf("#%d", r.res.Restarts)})
+	case "loop_restart_blocked":
+		r.step(SimStep{Event: "loop_restart_blocked", NodeID: nodeID, To: field("target_node"), Detail: "failure_class=" + field("failure_class")})
+	case "stuck_cycle_breaker", "deterministic_failure_cycle_breaker", "subgraph_deterministic_failure_cycle_breaker", "loop_restart_circuit_breaker":
+		r.step(SimStep{Event: "breaker", NodeID: nodeID, Detail: name})
+	case "run_completed", "run_failed":
+		r.res.FinalStatus = runtime.FinalStatus(field("status"))
+		r.res.FailureReason = field("failure_reason")
+	}
+}
+
+// unwrapBranchProgress turns a branch_progress event back into the branch
+// engine's event, keeping the branch key.
+func unwrapBranchProgress(ev map[string]any) map[string]any {
+	out := map[string]any{
+		"event":      ev["branch_event"],
+		"branch_key": ev["branch_key"],
+	}
+	for _, k := range []string{"node_id", "status", "failure_reason", "attempt", "max", "from_node", "to_node"} {
+		if v, ok := ev["branch_"+k]; ok {
+			out[k] = v
+		}
+	}
+	return out
+}
+
+func simEdgeDetail(label, condition, source string) string {
+	var parts []string
+	if label != "" {
+		parts = append(parts, fmt.Sprintf("label=%q", label))
+	}
+	if condition != "" {
+		parts = append(parts, fmt.Sprintf("condition=%q", condition))
+	}
+	parts = append(parts, "via "+source)
+	return "[" + strings.Join(parts, ", ") + "]"
+}
+
+// scriptedHandler stands in for a registered handler in a simulation.
+type scriptedHandler struct {
+	inner Handler
+	// real runs inner for unscripted nodes instead of succeeding.
+	real bool
+	rec  *simRecorder
+}
+
+func (h *scriptedHandler) SkipRetry() bool {
+	se, ok := h.inner.(SingleExecutionHandler)
+	return ok && se.SkipRetry()
+}
+
+func (h *scriptedHandler) UsesFidelity() bool {
+	fa, ok := h.inner.(FidelityAwareHandler)
+	return ok && fa.UsesFidelity()
+}
+
+func (h *scriptedHandler) Execute(ctx context.Context, exec *Execution, node *model.Node) (runtime.Outcome, error) {
+	out, err := h.execute(ctx, exec, node)
+	if isTerminal(node) {
+		h.rec.exit(node.ID, out)
+	}
+	return out, err
+}
+
+func (h *scriptedHandler) execute(ctx context.Context, exec *Execution, node *model.Node) (runtime.Outcome, error) {
+	scripted, hasScript, err := h.rec.next(node.ID)
+	if err != nil {
+		return runtime.Outcome{Status: runtime.StatusFail, FailureReason: err.Error()}, err
+	}
+	if !h.real {
+		if hasScript {
+			return scripted, nil
+		}
+		return runtime.Outcome{Status: runtime.StatusSuccess, Notes: "simulated"}, nil
+	}
+	if hasScript && resolvedHandlerType(node) != "parallel" {
+		return scripted, nil
+	}
+	out, err := h.inner.Execute(ctx, exec, node)
+	if !hasScript || err != nil {
+		return out, err
+	}
+	// A scripted outcome replaces the join policy's verdict; the branches
+	// still ran so the join node has results.
+	updates := map[string]any{}
+	for k, v := range out.ContextUpdates {
+		updates[k] = v
+	}
+	for k, v := range scripted.ContextUpdates {
+		updates[k] = v
+	}
+	scripted.ContextUpdates = updates
+	return scripted, nil
+}
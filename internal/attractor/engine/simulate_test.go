@@ -0,0 +1,278 @@
+package engine
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/danshapiro/kilroy/internal/attractor/runtime"
+)
+
+func simulateForTest(t *testing.T, dot, script string) *SimResult {
+	t.Helper()
+	g, _, err := Prepare([]byte(dot))
+	if err != nil {
+		t.Fatalf("Prepare: %v", err)
+	}
+	s, err := ParseSimScript([]byte(script))
+	if err != nil {
+		t.Fatalf("ParseSimScript: %v", err)
+	}
+	res, err := Simulate(g, s, SimOptions{})
+	if err != nil {
+		t.Fatalf("Simulate: %v", err)
+	}
+	return res
+}
+
+const simReviewLoopDOT = `
+digraph G {
+  graph [goal="ship"]
+  node [llm_provider=openai, llm_model=gpt-5.4]
+  start  [shape=Mdiamond]
+  exit   [shape=Msquare]
+  impl   [shape=box, prompt="implement"]
+  verify [shape=parallelogram, tool_command="go test ./...", max_retries=1]
+  check  [shape=diamond]
+  review [shape=box, goal_gate=true, retry_target=impl, prompt="review"]
+  start -> impl -> verify -> check
+  check -> review [condition="outcome=success"]
+  check -> impl
+  review -> exit  [label="approve"]
+  review -> impl  [label="rework"]
+}
+`
+
+func TestSimulate_RoutesRetriesAndRevisitsPerScript(t *testing.T) {
+	res := simulateForTest(t, simReviewLoopDOT, `
+nodes:
+  verify:
+    - fail
+    - fail
+    - success
+  review:
+    - {status: success, preferred_label: rework}
+    - {status: success, preferred_label: approve, context_updates: {review.round: 2}}
+`)
+	if res.FinalStatus != runtime.FinalSuccess {
+		t.Fatalf("final: %s (%s)", res.FinalStatus, res.FailureReason)
+	}
+	// verify fails twice on its first visit (one retry, then routed back via
+	// check), passes on the second; review asks for rework once.
+	want := "start impl verify check impl verify check review impl verify check review exit"
+	if got := strings.Join(res.Path, " "); got != want {
+		t.Fatalf("path:\n got %s\nwant %s", got, want)
+	}
+	if res.Visits["impl"] != 3 || res.Retries["verify"] != 1 {
+		t.Fatalf("visits=%v retries=%v", res.Visits, res.Retries)
+	}
+	if res.Context["review.round"] != 2 {
+		t.Fatalf("context: %v", res.Context)
+	}
+	var edges []string
+	for _, s := range res.Steps {
+		if s.Event == "edge" && s.NodeID == "review" {
+			edges = append(edges, s.To)
+		}
+	}
+	if strings.Join(edges, ",") != "impl,exit" {
+		t.Fatalf("review edges: %v", edges)
+	}
+}
+
+func TestSimulate_GoalGateRoutesToRetryTarget(t *testing.T) {
+	res := simulateForTest(t, `
+digraph G {
+  node [llm_provider=openai, llm_model=gpt-5.4]
+  start  [shape=Mdiamond]
+  exit   [shape=Msquare]
+  impl   [shape=box, prompt="implement"]
+  verify [shape=box, goal_gate=true, retry_target=impl, max_retries=0, prompt="verify"]
+  start -> impl -> verify -> exit
+}
+`, `
+nodes:
+  verify: [fail, success]
+`)
+	if res.FinalStatus != runtime.FinalSuccess || strings.Join(res.GoalGatesFired, ",") != "verify" {
+		t.Fatalf("result: %+v", res)
+	}
+	if got := strings.Join(res.Path, " "); got != "start impl verify impl verify exit" {
+		t.Fatalf("path: %s", got)
+	}
+}
+
+func TestSimulate_UnsatisfiedGoalGateWithoutRetryTargetFailsLikeEngine(t *testing.T) {
+	res := simulateForTest(t, `
+digraph G {
+  node [llm_provider=openai, llm_model=gpt-5.4]
+  start  [shape=Mdiamond]
+  exit   [shape=Msquare]
+  verify [shape=box, goal_gate=true, max_retries=0, prompt="verify"]
+  start -> verify -> exit
+}
+`, `
+nodes:
+  verify: fail
+`)
+	if res.FinalStatus != runtime.FinalFail || res.FailureReason != "goal gate unsatisfied (verify) and no retry target" {
+		t.Fatalf("result: %+v", res)
+	}
+	if got := strings.Join(res.Path, " "); got != "start verify" {
+		t.Fatalf("path: %s", got)
+	}
+}
+
+func TestSimulate_ExitNodeRunsOnceWithoutRetries(t *testing.T) {
+	res := simulateForTest(t, `
+digraph G {
+  graph [default_max_retry=3]
+  start [shape=Mdiamond]
+  exit  [shape=Msquare]
+  start -> exit
+}
+`, `
+nodes:
+  exit: {status: fail, failure_reason: "scripted", failure_class: transient_infra}
+`)
+	// The engine executes the exit node once, outside the retry loop, and
+	// finishes the run whatever it returns.
+	if res.FinalStatus != runtime.FinalSuccess || res.Visits["exit"] != 1 || res.Retries["exit"] != 0 {
+		t.Fatalf("result: %+v", res)
+	}
+}
+
+func TestSimulate_RetriesOnlyRetryableFailureClasses(t *testing.T) {
+	dot := `
+digraph G {
+  node [llm_provider=openai, llm_model=gpt-5.4]
+  start [shape=Mdiamond]
+  exit  [shape=Msquare]
+  impl  [shape=box, max_retries=2, prompt="implement"]
+  fix   [shape=box, prompt="fix"]
+  start -> impl
+  impl -> fix [condition="outcome=fail"]
+  impl -> exit
+  fix -> exit
+}
+`
+	res := simulateForTest(t, dot, `
+nodes:
+  impl: {status: fail, failure_reason: "request timeout", failure_class: transient_infra}
+`)
+	// transient_infra is retryable: three attempts, two retries, then the fail edge.
+	if res.Retries["impl"] != 2 || strings.Join(res.Path, " ") != "start impl fix exit" {
+		t.Fatalf("retries=%v path=%v", res.Retries, res.Path)
+	}
+
+	res = simulateForTest(t, dot, `
+nodes:
+  impl: {status: fail, failure_reason: "assertion failed"}
+`)
+	if res.Retries["impl"] != 0 || res.Steps[3].Event != "retry_blocked" {
+		t.Fatalf("retries=%v steps=%v", res.Retries, res.Steps)
+	}
+}
+
+func TestSimulate_LoopRestartResetsContextAndKeepsPersistKeys(t *testing.T) {
+	res := simulateForTest(t, `
+digraph G {
+  graph [loop_restart_persist_keys="done"]
+  node [llm_provider=openai, llm_model=gpt-5.4]
+  start [shape=Mdiamond]
+  exit  [shape=Msquare]
+  work  [shape=box, prompt="work"]
+  more  [shape=diamond]
+  start -> work -> more
+  more -> work [condition="context.done!=3", loop_restart=true]
+  more -> exit
+}
+`, `
+context: {scratch: keep-me-not}
+nodes:
+  work:
+    - {status: success, context_updates: {done: 1}}
+    - {status: success, context_updates: {done: 2}}
+    - {status: success, context_updates: {done: 3}}
+`)
+	if res.FinalStatus != runtime.FinalSuccess || res.Restarts != 2 {
+		t.Fatalf("result: %+v", res)
+	}
+	if _, ok := res.Context["scratch"]; ok {
+		t.Fatalf("context survived loop_restart: %v", res.Context)
+	}
+	if res.Context["loop_restart.iteration_count"] != 2 {
+		t.Fatalf("context: %v", res.Context)
+	}
+}
+
+func TestSimulate_StepLimitStopsUnboundedCycle(t *testing.T) {
+	g, _, err := Prepare([]byte(`
+digraph G {
+  node [llm_provider=openai, llm_model=gpt-5.4]
+  start [shape=Mdiamond]
+  exit  [shape=Msquare]
+  a     [shape=box, prompt="a"]
+  b     [shape=box, prompt="b"]
+  start -> a -> b
+  b -> a [condition="outcome=success"]
+  b -> exit
+}
+`))
+	if err != nil {
+		t.Fatalf("Prepare: %v", err)
+	}
+	res, err := Simulate(g, nil, SimOptions{MaxSteps: 20})
+	if err != nil {
+		t.Fatalf("Simulate: %v", err)
+	}
+	if res.FinalStatus != runtime.FinalFail || !strings.Contains(res.FailureReason, "20 stage executions") {
+		t.Fatalf("result: %+v", res)
+	}
+}
+
+func TestSimulate_ParallelBranchesReachFanIn(t *testing.T) {
+	res := simulateForTest(t, `
+digraph G {
+  node [llm_provider=openai, llm_model=gpt-5.4]
+  start [shape=Mdiamond]
+  exit  [shape=Msquare]
+  fan   [shape=component]
+  a     [shape=box, prompt="a"]
+  b     [shape=box, prompt="b"]
+  join  [shape=tripleoctagon]
+  start -> fan
+  fan -> a -> join
+  fan -> b -> join
+  join -> exit
+}
+`, `
+nodes:
+  a: fail
+`)
+	if res.FinalStatus != runtime.FinalSuccess {
+		t.Fatalf("final: %s (%s)", res.FinalStatus, res.FailureReason)
+	}
+	if got := strings.Join(res.Path, " "); got != "start fan a b join exit" {
+		t.Fatalf("path: %s", got)
+	}
+	if res.Context["parallel.fan_in.best_id"] != "b" {
+		t.Fatalf("context: %v", res.Context)
+	}
+}
+
+func TestParseSimScript_RejectsUnknownFieldsAndNodes(t *testing.T) {
+	if _, err := ParseSimScript([]byte("nodes:\n  impl: {status: success, prefered_label: x}\n")); err == nil {
+		t.Fatal("expected unknown field error")
+	}
+	g, _, err := Prepare([]byte(`digraph G { start [shape=Mdiamond]; exit [shape=Msquare]; start -> exit }`))
+	if err != nil {
+		t.Fatalf("Prepare: %v", err)
+	}
+	s, err := ParseSimScript([]byte("nodes:\n  nope: success\n"))
+	if err != nil {
+		t.Fatalf("ParseSimScript: %v", err)
+	}
+	if _, err := Simulate(g, s, SimOptions{}); err == nil || !strings.Contains(err.Error(), `"nope"`) {
+		t.Fatalf("expected unknown node error, got %v", err)
+	}
+}
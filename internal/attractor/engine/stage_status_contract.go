@@ -1,9 +1,14 @@
 package engine
 
 import (
+	"bytes"
+	"encoding/json"
+	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
+
+	"github.com/danshapiro/kilroy/internal/attractor/runtime"
 )
 
 const (
@@ -53,6 +58,46 @@ func buildStageStatusContract(worktreeDir string) stageStatusContract {
 	}
 }
 
+// reportStageStatus validates a report_status call and writes it to the
+// stage's status path, where the normal status.json ingestion picks it up.
+// Later calls overwrite earlier ones.
+func reportStageStatus(statusPath string, outcomeJSON []byte) (runtime.Outcome, error) {
+	if strings.TrimSpace(statusPath) == "" {
+		return runtime.Outcome{}, fmt.Errorf("no stage status path for this session")
+	}
+	dec := json.NewDecoder(bytes.NewReader(outcomeJSON))
+	dec.DisallowUnknownFields()
+	var o runtime.Outcome
+	if err := dec.Decode(&o); err != nil {
+		return runtime.Outcome{}, fmt.Errorf("invalid status: %w", err)
+	}
+	if err := o.Validate(); err != nil {
+		return runtime.Outcome{}, err
+	}
+	o, err := o.Canonicalize()
+	if err != nil {
+		return runtime.Outcome{}, err
+	}
+	b, err := json.MarshalIndent(o, "", "  ")
+	if err != nil {
+		return runtime.Outcome{}, err
+	}
+	if err := runtime.WriteFileAtomic(statusPath, b); err != nil {
+		return runtime.Outcome{}, err
+	}
+	return o, nil
+}
+
+// withReportStatusPreamble swaps the file-based status contract preamble in
+// a stage prompt for the shorter report_status instructions.
+func withReportStatusPreamble(prompt string, contract stageStatusContract) string {
+	old := strings.TrimSpace(contract.PromptPreamble)
+	if old == "" || !strings.Contains(prompt, old) {
+		return prompt
+	}
+	return strings.Replace(prompt, old, mustRenderReportStatusPromptPreamble(contract.PrimaryPath), 1)
+}
+
 func inferRunIDForStatusFallback(worktreeDir string) string {
 	if runID := strings.TrimSpace(os.Getenv(runIDEnvKey)); runID != "" {
 		return runID
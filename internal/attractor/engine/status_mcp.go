@@ -0,0 +1,139 @@
+package engine
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/danshapiro/kilroy/internal/agent"
+	"github.com/danshapiro/kilroy/internal/attractor/model"
+)
+
+// status_tool node attribute values.
+const (
+	statusToolAuto = "auto" // report_status for API agent_loop, status.json for CLI agents
+	statusToolMCP  = "mcp"  // also expose report_status to CLI agents via the MCP shim
+	statusToolFile = "file" // status.json contract only
+)
+
+const statusMCPServerName = "kilroy_status"
+
+func stageStatusToolMode(node *model.Node) string {
+	switch v := strings.ToLower(strings.TrimSpace(node.Attr("status_tool", ""))); v {
+	case statusToolMCP, statusToolFile:
+		return v
+	default:
+		return statusToolAuto
+	}
+}
+
+// statusMCPCLIArgs returns the extra CLI arguments that register the
+// report_status MCP shim (`kilroy attractor status-mcp`) with a CLI agent.
+// Only Claude Code and Codex are supported.
+func statusMCPCLIArgs(providerKey string, codexSemantics bool, stageDir string, statusPath string) ([]string, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+	shimArgs := []string{"attractor", "status-mcp"}
+	switch {
+	case codexSemantics:
+		quoted := make([]string, len(shimArgs))
+		for i, a := range shimArgs {
+			quoted[i] = strconv.Quote(a)
+		}
+		prefix := "mcp_servers." + statusMCPServerName
+		return []string{
+			"-c", prefix + ".command=" + strconv.Quote(exe),
+			"-c", prefix + ".args=[" + strings.Join(quoted, ",") + "]",
+			"-c", prefix + ".env={" + stageStatusPathEnvKey + "=" + strconv.Quote(statusPath) + "}",
+		}, nil
+	case providerKey == "anthropic":
+		cfgPath := filepath.Join(stageDir, "status_mcp.json")
+		if err := writeJSON(cfgPath, map[string]any{
+			"mcpServers": map[string]any{
+				statusMCPServerName: map[string]any{
+					"type":    "stdio",
+					"command": exe,
+					"args":    shimArgs,
+					"env":     map[string]string{stageStatusPathEnvKey: statusPath},
+				},
+			},
+		}); err != nil {
+			return nil, err
+		}
+		return []string{"--mcp-config", cfgPath}, nil
+	default:
+		return nil, fmt.Errorf("status_tool=mcp is not supported for provider %s", providerKey)
+	}
+}
+
+// ServeStatusMCP runs a minimal stdio MCP server exposing report_status,
+// which validates the outcome and writes it to statusPath. It returns when
+// in reaches EOF.
+func ServeStatusMCP(in io.Reader, out io.Writer, statusPath string) error {
+	def := agent.ReportStatusToolDefinition()
+	enc := json.NewEncoder(out)
+	sc := bufio.NewScanner(in)
+	sc.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for sc.Scan() {
+		var req struct {
+			ID     json.RawMessage `json:"id"`
+			Method string          `json:"method"`
+			Params json.RawMessage `json:"params"`
+		}
+		if err := json.Unmarshal(sc.Bytes(), &req); err != nil || len(req.ID) == 0 {
+			continue // notifications and responses need no reply
+		}
+		resp := map[string]any{"jsonrpc": "2.0", "id": req.ID}
+		switch req.Method {
+		case "initialize":
+			var p struct {
+				ProtocolVersion string `json:"protocolVersion"`
+			}
+			_ = json.Unmarshal(req.Params, &p)
+			resp["result"] = map[string]any{
+				"protocolVersion": firstNonEmpty(p.ProtocolVersion, "2025-06-18"),
+				"capabilities":    map[string]any{"tools": map[string]any{}},
+				"serverInfo":      map[string]any{"name": "kilroy-status", "version": "1"},
+			}
+		case "ping":
+			resp["result"] = map[string]any{}
+		case "tools/list":
+			resp["result"] = map[string]any{"tools": []any{map[string]any{
+				"name":        def.Name,
+				"description": def.Description,
+				"inputSchema": def.Parameters,
+			}}}
+		case "tools/call":
+			var p struct {
+				Name      string          `json:"name"`
+				Arguments json.RawMessage `json:"arguments"`
+			}
+			_ = json.Unmarshal(req.Params, &p)
+			text, isErr := "", false
+			if p.Name != def.Name {
+				text, isErr = fmt.Sprintf("unknown tool %q", p.Name), true
+			} else if o, err := reportStageStatus(statusPath, p.Arguments); err != nil {
+				text, isErr = err.Error(), true
+			} else {
+				text = "status recorded: " + string(o.Status)
+			}
+			resp["result"] = map[string]any{
+				"content": []any{map[string]any{"type": "text", "text": text}},
+				"isError": isErr,
+			}
+		default:
+			resp["error"] = map[string]any{"code": -32601, "message": "method not found: " + req.Method}
+		}
+		if err := enc.Encode(resp); err != nil {
+			return err
+		}
+	}
+	return sc.Err()
+}
@@ -0,0 +1,193 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/danshapiro/kilroy/internal/attractor/runtime"
+)
+
+func TestReportStageStatus_ValidatesAndWritesLastCall(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "status.json")
+	for _, tc := range []struct{ in, want string }{
+		{`{"status":"fail"}`, "failure_reason must be non-empty"},
+		{`{"status":""}`, "empty"},
+		{`{"status":"success","colour":"red"}`, "unknown field"},
+		{`{"status":"success","suggested_next_ids":"a"}`, "invalid status"},
+	} {
+		if _, err := reportStageStatus(path, []byte(tc.in)); err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Fatalf("%s: got %v want %q", tc.in, err, tc.want)
+		}
+	}
+	if _, err := os.Stat(path); err == nil {
+		t.Fatalf("invalid reports must not write status.json")
+	}
+	if _, err := reportStageStatus(path, []byte(`{"status":"retry","failure_reason":"flaky"}`)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := reportStageStatus(path, []byte(`{"status":"OK","preferred_label":"ship","context_updates":{"k":"v"}}`)); err != nil {
+		t.Fatal(err)
+	}
+	b, _ := os.ReadFile(path)
+	o, err := runtime.DecodeOutcomeJSON(b)
+	if err != nil || o.Status != runtime.StatusSuccess || o.PreferredLabel != "ship" || o.ContextUpdates["k"] != "v" {
+		t.Fatalf("status.json: %s (%v)", b, err)
+	}
+}
+
+func TestServeStatusMCP_ListsAndCallsReportStatus(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "status.json")
+	in := strings.Join([]string{
+		`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2025-03-26"}}`,
+		`{"jsonrpc":"2.0","method":"notifications/initialized"}`,
+		`{"jsonrpc":"2.0","id":2,"method":"tools/list"}`,
+		`{"jsonrpc":"2.0","id":3,"method":"tools/call","params":{"name":"report_status","arguments":{"status":"fail"}}}`,
+		`{"jsonrpc":"2.0","id":4,"method":"tools/call","params":{"name":"report_status","arguments":{"status":"partial_success","notes":"half"}}}`,
+		`{"jsonrpc":"2.0","id":5,"method":"resources/list"}`,
+	}, "\n") + "\n"
+	var out strings.Builder
+	if err := ServeStatusMCP(strings.NewReader(in), &out, path); err != nil {
+		t.Fatal(err)
+	}
+	var resps []map[string]any
+	dec := json.NewDecoder(strings.NewReader(out.String()))
+	for dec.More() {
+		var m map[string]any
+		if err := dec.Decode(&m); err != nil {
+			t.Fatal(err)
+		}
+		resps = append(resps, m)
+	}
+	if len(resps) != 5 {
+		t.Fatalf("responses: %s", out.String())
+	}
+	if v := resps[0]["result"].(map[string]any)["protocolVersion"]; v != "2025-03-26" {
+		t.Fatalf("initialize: %v", resps[0])
+	}
+	if !strings.Contains(fmt.Sprint(resps[1]), "report_status") {
+		t.Fatalf("tools/list: %v", resps[1])
+	}
+	if r := resps[2]["result"].(map[string]any); r["isError"] != true || !strings.Contains(fmt.Sprint(r["content"]), "failure_reason") {
+		t.Fatalf("invalid call should be an isError result: %v", r)
+	}
+	if r := resps[3]["result"].(map[string]any); r["isError"] != false {
+		t.Fatalf("valid call: %v", r)
+	}
+	if resps[4]["error"] == nil {
+		t.Fatalf("unknown method should be a JSON-RPC error: %v", resps[4])
+	}
+	if b, _ := os.ReadFile(path); !strings.Contains(string(b), `"partial_success"`) {
+		t.Fatalf("status.json: %s", b)
+	}
+}
+
+func TestStatusMCPCLIArgs_ClaudeAndCodex(t *testing.T) {
+	stageDir := t.TempDir()
+	args, err := statusMCPCLIArgs("anthropic", false, stageDir, "/wt/status.json")
+	if err != nil || len(args) != 2 || args[0] != "--mcp-config" {
+		t.Fatalf("claude args: %v %v", args, err)
+	}
+	b, _ := os.ReadFile(args[1])
+	if !strings.Contains(string(b), `"kilroy_status"`) || !strings.Contains(string(b), `"/wt/status.json"`) || !strings.Contains(string(b), `"status-mcp"`) {
+		t.Fatalf("mcp config: %s", b)
+	}
+	args, err = statusMCPCLIArgs("openai", true, stageDir, "/wt/status.json")
+	if err != nil || len(args) != 6 || args[5] != `mcp_servers.kilroy_status.env={KILROY_STAGE_STATUS_PATH="/wt/status.json"}` {
+		t.Fatalf("codex args: %v %v", args, err)
+	}
+	if _, err := statusMCPCLIArgs("google", false, stageDir, "/wt/status.json"); err == nil {
+		t.Fatalf("expected unsupported provider error")
+	}
+}
+
+func TestRunWithConfig_APIBackend_ReportStatusToolBecomesStageOutcome(t *testing.T) {
+	repo := initTestRepo(t)
+	pinned := writePinnedCatalog(t)
+	cxdbSrv := newCXDBTestServer(t)
+
+	var mu sync.Mutex
+	var sawToolError, sawPreamble bool
+	openaiSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		// Preflight probes share this server; key the script off the number
+		// of tool results already in the conversation.
+		n := strings.Count(string(b), `"function_call_output"`) + 1
+		mu.Lock()
+		if strings.Contains(string(b), "call the report_status tool") {
+			sawPreamble = true
+		}
+		if strings.Contains(string(b), "failure_reason must be non-empty") {
+			sawToolError = true
+		}
+		mu.Unlock()
+		call := func(id, args string) string {
+			a, _ := json.Marshal(args)
+			return fmt.Sprintf(`{"id":"r%d","model":"gpt-5.4","output":[{"type":"function_call","call_id":%q,"name":"report_status","arguments":%s}],"usage":{"input_tokens":1,"output_tokens":1,"total_tokens":2}}`, n, id, a)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		switch n {
+		case 1:
+			_, _ = w.Write([]byte(call("c1", `{"status":"fail"}`)))
+		case 2:
+			_, _ = w.Write([]byte(call("c2", `{"status":"partial_success","preferred_label":"polish","context_updates":{"reported":"yes"}}`)))
+		default:
+			_, _ = w.Write([]byte(`{"id":"r3","model":"gpt-5.4","output":[{"type":"message","content":[{"type":"output_text","text":"done"}]}],"usage":{"input_tokens":1,"output_tokens":1,"total_tokens":2}}`))
+		}
+	}))
+	t.Cleanup(openaiSrv.Close)
+	t.Setenv("OPENAI_API_KEY", "k")
+	t.Setenv("OPENAI_BASE_URL", openaiSrv.URL)
+
+	cfg := &RunConfigFile{Version: 1}
+	cfg.Repo.Path = repo
+	cfg.CXDB.BinaryAddr = cxdbSrv.BinaryAddr()
+	cfg.CXDB.HTTPBaseURL = cxdbSrv.URL()
+	cfg.LLM.Providers = map[string]ProviderConfig{"openai": {Backend: BackendAPI, Failover: []string{}}}
+	cfg.ModelDB.OpenRouterModelInfoPath = pinned
+	cfg.ModelDB.OpenRouterModelInfoUpdatePolicy = "pinned"
+	cfg.Git.RunBranchPrefix = "attractor/run"
+
+	dot := []byte(`
+digraph G {
+  graph [goal="test"]
+  start [shape=Mdiamond]
+  exit  [shape=Msquare]
+  a [shape=box, llm_provider=openai, llm_model=gpt-5.4, prompt="do it"]
+  polish [shape=parallelogram, tool_command="echo polished > polished.txt"]
+  start -> a
+  a -> polish [label="polish"]
+  a -> exit [condition="outcome=success"]
+  polish -> exit
+}
+`)
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+	res, err := RunWithConfig(ctx, dot, cfg, RunOptions{RunID: "test-report-status", LogsRoot: t.TempDir()})
+	if err != nil {
+		t.Fatalf("RunWithConfig: %v", err)
+	}
+	b, err := os.ReadFile(filepath.Join(res.LogsRoot, "a", "status.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := runtime.DecodeOutcomeJSON(b)
+	if err != nil || out.Status != runtime.StatusPartialSuccess || out.PreferredLabel != "polish" {
+		t.Fatalf("stage outcome: %s (%v)", b, err)
+	}
+	assertExists(t, filepath.Join(res.WorktreeDir, "polished.txt"))
+	mu.Lock()
+	defer mu.Unlock()
+	if !sawPreamble || !sawToolError {
+		t.Fatalf("preamble=%v tool error fed back=%v", sawPreamble, sawToolError)
+	}
+}
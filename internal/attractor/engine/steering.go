@@ -0,0 +1,207 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/danshapiro/kilroy/internal/attractor/runstate"
+)
+
+// Operator steering (attractor steer, POST /pipelines/{id}/steer) queues
+// messages under runstate.SteeringDirName. A codergen stage takes the queued
+// messages into its prompt when it starts; an API agent_loop stage also polls
+// the queue while it runs and injects new messages with Session.Steer. CLI
+// stages cannot be reached mid-run, so messages sent during one wait for the
+// next attempt's prompt.
+
+const steeringLogFileName = "steering.ndjson"
+
+var steeringPollInterval = 500 * time.Millisecond
+
+const (
+	steeringDeliveryPrompt  = "prompt"
+	steeringDeliverySession = "session"
+)
+
+// claimPromptSteering takes every queued steering message for a stage that is
+// about to build its prompt and records the delivery.
+func claimPromptSteering(ctx context.Context, execCtx *Execution, nodeID string, stageDir string) []runstate.SteerMessage {
+	e := steeringEngine(execCtx)
+	if e == nil {
+		return nil
+	}
+	msgs, err := runstate.ClaimSteers(e.operatorRoot())
+	if err != nil {
+		e.Warn(fmt.Sprintf("steering: %v", err))
+		return nil
+	}
+	for _, m := range msgs {
+		e.recordSteering(ctx, nodeID, stageDir, m, steeringDeliveryPrompt)
+	}
+	return msgs
+}
+
+// withSteeringPrompt appends queued operator messages to a stage prompt.
+func withSteeringPrompt(prompt string, msgs []runstate.SteerMessage) string {
+	if len(msgs) == 0 {
+		return prompt
+	}
+	var b strings.Builder
+	b.WriteString(strings.TrimRight(prompt, "\n"))
+	b.WriteString("\n\n## Operator steering\n\n")
+	b.WriteString("The operator watching this run sent the following guidance. It takes precedence over conflicting instructions above.\n")
+	for _, m := range msgs {
+		b.WriteString("\n- ")
+		b.WriteString(strings.ReplaceAll(strings.TrimSpace(m.Message), "\n", "\n  "))
+	}
+	b.WriteString("\n")
+	return b.String()
+}
+
+// sessionSteering feeds queued steering messages into a live agent session.
+// Messages are recorded as delivered when the session reports injecting them;
+// any still undelivered when the session ends go back on the queue.
+type sessionSteering struct {
+	e        *Engine
+	nodeID   string
+	stageDir string
+	steer    func(string)
+
+	mu      sync.Mutex
+	pending []runstate.SteerMessage
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+func startSessionSteering(ctx context.Context, execCtx *Execution, nodeID string, stageDir string, steer func(string)) *sessionSteering {
+	s := &sessionSteering{
+		e:        steeringEngine(execCtx),
+		nodeID:   nodeID,
+		stageDir: stageDir,
+		steer:    steer,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	if s.e == nil {
+		close(s.done)
+		return s
+	}
+	go func() {
+		defer close(s.done)
+		ticker := time.NewTicker(steeringPollInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-s.stop:
+				return
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				s.poll()
+			}
+		}
+	}()
+	return s
+}
+
+func (s *sessionSteering) poll() {
+	msgs, err := runstate.ClaimSteers(s.e.operatorRoot())
+	if err != nil {
+		s.e.Warn(fmt.Sprintf("steering: %v", err))
+		return
+	}
+	for _, m := range msgs {
+		s.mu.Lock()
+		s.pending = append(s.pending, m)
+		s.mu.Unlock()
+		s.steer(m.Message)
+	}
+}
+
+// injected is called for each steering message the session put in front of
+// the model.
+func (s *sessionSteering) injected(ctx context.Context, text string) {
+	if s == nil || s.e == nil {
+		return
+	}
+	s.mu.Lock()
+	var delivered runstate.SteerMessage
+	found := false
+	for i, m := range s.pending {
+		if m.Message == text {
+			delivered, found = m, true
+			s.pending = append(s.pending[:i], s.pending[i+1:]...)
+			break
+		}
+	}
+	s.mu.Unlock()
+	if found {
+		s.e.recordSteering(ctx, s.nodeID, s.stageDir, delivered, steeringDeliverySession)
+	}
+}
+
+// finish stops polling once the session has returned and its events have been
+// drained, and requeues messages the session never injected.
+func (s *sessionSteering) finish() {
+	if s == nil {
+		return
+	}
+	close(s.stop)
+	<-s.done
+	if s.e == nil {
+		return
+	}
+	s.mu.Lock()
+	undelivered := s.pending
+	s.pending = nil
+	s.mu.Unlock()
+	for _, m := range undelivered {
+		if err := runstate.RequeueSteer(s.e.operatorRoot(), m); err != nil {
+			s.e.Warn(fmt.Sprintf("steering: requeue %s: %v", m.ID, err))
+		}
+	}
+}
+
+func steeringEngine(execCtx *Execution) *Engine {
+	if execCtx == nil || execCtx.Engine == nil || execCtx.Engine.operatorRoot() == "" {
+		return nil
+	}
+	return execCtx.Engine
+}
+
+// recordSteering logs a delivered steering message to the stage's
+// steering.ndjson, the progress stream and CXDB.
+func (e *Engine) recordSteering(ctx context.Context, nodeID string, stageDir string, m runstate.SteerMessage, delivery string) {
+	rec := map[string]any{
+		"id":           m.ID,
+		"node_id":      nodeID,
+		"message":      m.Message,
+		"source":       m.Source,
+		"delivery":     delivery,
+		"requested_at": m.RequestedAt.Format(time.RFC3339Nano),
+		"delivered_at": time.Now().UTC().Format(time.RFC3339Nano),
+	}
+	if b, err := json.Marshal(rec); err == nil {
+		if err := os.MkdirAll(stageDir, 0o755); err == nil {
+			if f, err := os.OpenFile(filepath.Join(stageDir, steeringLogFileName), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644); err == nil {
+				_, _ = f.Write(append(b, '\n'))
+				_ = f.Close()
+			}
+		}
+	}
+	e.appendProgress(map[string]any{
+		"event":    "stage_steered",
+		"node_id":  nodeID,
+		"message":  truncate(m.Message, 500),
+		"source":   m.Source,
+		"delivery": delivery,
+	})
+	e.cxdbSteeringDelivered(ctx, nodeID, m.Message, m.Source, delivery)
+}
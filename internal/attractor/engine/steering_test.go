@@ -0,0 +1,155 @@
+package engine
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/danshapiro/kilroy/internal/attractor/model"
+	"github.com/danshapiro/kilroy/internal/attractor/runstate"
+	"github.com/danshapiro/kilroy/internal/attractor/runtime"
+)
+
+func TestRun_QueuedSteeringIsAddedToNextCodergenPrompt(t *testing.T) {
+	dot := []byte(`digraph G {
+  start [shape=Mdiamond]
+  impl [shape=box, llm_provider=openai, llm_model=gpt-5.4, prompt="Implement the parser."]
+  exit [shape=Msquare]
+  start -> impl -> exit
+}`)
+	repo := initTestRepo(t)
+	logsRoot := filepath.Join(t.TempDir(), "logs")
+	if _, err := runstate.EnqueueSteer(logsRoot, "Reuse the existing tokenizer.", "cli", ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Run(context.Background(), dot, RunOptions{RepoPath: repo, LogsRoot: logsRoot}); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	prompt, err := os.ReadFile(filepath.Join(logsRoot, "impl", "prompt.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(prompt), "Implement the parser.") || !strings.HasSuffix(string(prompt), "## Operator steering\n\nThe operator watching this run sent the following guidance. It takes precedence over conflicting instructions above.\n\n- Reuse the existing tokenizer.\n") {
+		t.Fatalf("prompt.md:\n%s", prompt)
+	}
+	assertExists(t, filepath.Join(logsRoot, "impl", steeringLogFileName))
+	if pending, _ := runstate.PendingSteers(logsRoot); len(pending) != 0 {
+		t.Fatalf("steering still queued after delivery: %+v", pending)
+	}
+	progress, _ := os.ReadFile(filepath.Join(logsRoot, "progress.ndjson"))
+	if !strings.Contains(string(progress), `"delivery":"prompt","event":"stage_steered"`) {
+		t.Fatalf("progress missing stage_steered event:\n%s", progress)
+	}
+}
+
+func TestSessionSteering_InjectsLiveAndRequeuesUndelivered(t *testing.T) {
+	old := steeringPollInterval
+	steeringPollInterval = 10 * time.Millisecond
+	t.Cleanup(func() { steeringPollInterval = old })
+
+	logsRoot := t.TempDir()
+	stageDir := filepath.Join(logsRoot, "impl")
+	execCtx := &Execution{LogsRoot: logsRoot, Engine: &Engine{LogsRoot: logsRoot}}
+
+	var mu sync.Mutex
+	var steered []string
+	s := startSessionSteering(context.Background(), execCtx, "impl", stageDir, func(msg string) {
+		mu.Lock()
+		steered = append(steered, msg)
+		mu.Unlock()
+	})
+	_, _ = runstate.EnqueueSteer(logsRoot, "check the nil map", "api", "impl")
+	_, _ = runstate.EnqueueSteer(logsRoot, "then run go vet", "api", "impl")
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		mu.Lock()
+		n := len(steered)
+		mu.Unlock()
+		if n == 2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("session was steered with %d messages, want 2", n)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	// The session injects the first message and ends before the second.
+	s.injected(context.Background(), "check the nil map")
+	s.finish()
+
+	log, _ := os.ReadFile(filepath.Join(stageDir, steeringLogFileName))
+	if !strings.Contains(string(log), `"delivery":"session"`) || strings.Contains(string(log), "go vet") {
+		t.Fatalf("steering.ndjson:\n%s", log)
+	}
+	pending, _ := runstate.PendingSteers(logsRoot)
+	if len(pending) != 1 || pending[0].Message != "then run go vet" {
+		t.Fatalf("undelivered message should be requeued: %+v", pending)
+	}
+}
+
+func TestRun_SteeringQueuedBeforeLoopRestartReachesRestartedStage(t *testing.T) {
+	dot := []byte(`
+digraph G {
+  graph [goal="steer after restart", default_max_retry=0]
+  start [shape=Mdiamond]
+  exit  [shape=Msquare]
+  work  [shape=box, llm_provider=openai, llm_model=gpt-5.4, prompt="do work"]
+  check [shape=diamond]
+  start -> work
+  work -> check
+  check -> exit [condition="outcome=success"]
+  check -> work [condition="outcome=fail", loop_restart=true]
+  check -> exit
+}
+`)
+	repo := initTestRepo(t)
+	logsRoot := t.TempDir()
+	var prompts []string
+	backend := &countingBackend{
+		fn: func(ctx context.Context, exec *Execution, node *model.Node, prompt string) (string, *runtime.Outcome, error) {
+			prompts = append(prompts, prompt)
+			if len(prompts) == 1 {
+				// The CLI and server enqueue under the base logs root.
+				if _, err := runstate.EnqueueSteer(logsRoot, "Retry with the smaller fixture.", "cli", ""); err != nil {
+					return "", nil, err
+				}
+				return "fail", &runtime.Outcome{Status: runtime.StatusFail, FailureReason: "temporary network error: connection reset by peer"}, nil
+			}
+			return "ok", &runtime.Outcome{Status: runtime.StatusSuccess}, nil
+		},
+	}
+	g, _, err := Prepare(dot)
+	if err != nil {
+		t.Fatalf("Prepare: %v", err)
+	}
+	eng := &Engine{
+		Graph:           g,
+		Options:         RunOptions{RepoPath: repo, RunID: "steer-restart", LogsRoot: logsRoot, WorktreeDir: filepath.Join(logsRoot, "worktree"), RunBranchPrefix: "attractor/run", RequireClean: true},
+		DotSource:       dot,
+		LogsRoot:        logsRoot,
+		WorktreeDir:     filepath.Join(logsRoot, "worktree"),
+		Context:         runtime.NewContext(),
+		Registry:        NewDefaultRegistry(),
+		Interviewer:     &AutoApproveInterviewer{},
+		CodergenBackend: backend,
+	}
+	eng.RunBranch = "attractor/run/steer-restart"
+	res, err := eng.run(context.Background())
+	if err != nil || res.FinalStatus != runtime.FinalSuccess {
+		t.Fatalf("run: %+v, %v", res, err)
+	}
+
+	if len(prompts) != 2 || !strings.Contains(prompts[1], "- Retry with the smaller fixture.") {
+		t.Fatalf("restarted stage was not steered: %q", prompts)
+	}
+	assertExists(t, filepath.Join(logsRoot, "restart-1", "work", steeringLogFileName))
+	if pending, _ := runstate.PendingSteers(logsRoot); len(pending) != 0 {
+		t.Fatalf("steering still queued after delivery: %+v", pending)
+	}
+}
@@ -19,7 +19,10 @@ func runSubgraphUntil(ctx context.Context, eng *Engine, startNodeID, stopNodeID
 		return parallelBranchResult{}, fmt.Errorf("start node is required")
 	}
 
-	headSHA, _ := gitutil.HeadSHA(eng.WorktreeDir)
+	headSHA := ""
+	if !eng.simulated {
+		headSHA, _ = gitutil.HeadSHA(eng.WorktreeDir)
+	}
 
 	current := startNodeID
 	completed := []string{}
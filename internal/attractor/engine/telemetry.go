@@ -0,0 +1,158 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/danshapiro/kilroy/internal/attractor/model"
+	"github.com/danshapiro/kilroy/internal/attractor/runtime"
+	"github.com/danshapiro/kilroy/internal/telemetry"
+)
+
+const traceparentEnvKey = "TRACEPARENT"
+
+// Span attribute keys. LLM attributes follow the OpenTelemetry GenAI semantic
+// conventions so traces line up with other instrumented services.
+const (
+	attrRunID        = "kilroy.run_id"
+	attrNodeID       = "kilroy.node_id"
+	attrAttempt      = "kilroy.attempt"
+	attrMaxAttempts  = "kilroy.max_attempts"
+	attrStatus       = "kilroy.status"
+	attrFailureClass = "kilroy.failure_class"
+	attrRetryCount   = "kilroy.retry_count"
+	attrProvider     = "gen_ai.system"
+	attrModel        = "gen_ai.request.model"
+)
+
+// newRunTracer builds an OTLP tracer from run config. It returns nil when
+// telemetry is disabled so all span helpers degrade to no-ops.
+func newRunTracer(cfg *RunConfigFile, runID string, warn func(string)) *telemetry.Tracer {
+	if cfg == nil || !cfg.Telemetry.Enabled {
+		return nil
+	}
+	var once sync.Once
+	exp := telemetry.NewOTLPExporter(telemetry.OTLPConfig{
+		Endpoint:           cfg.Telemetry.Endpoint,
+		Protocol:           cfg.Telemetry.Protocol,
+		Headers:            cfg.Telemetry.Headers,
+		ServiceName:        cfg.Telemetry.ServiceName,
+		ResourceAttributes: mergeResourceAttributes(cfg.Telemetry.ResourceAttributes, runID),
+		OnError: func(err error) {
+			// One warning per run is enough; a down collector must not flood progress.
+			once.Do(func() {
+				if warn != nil {
+					warn(fmt.Sprintf("telemetry export failed (further errors suppressed): %v", err))
+				}
+			})
+		},
+	})
+	return telemetry.NewTracer(exp)
+}
+
+func mergeResourceAttributes(in map[string]string, runID string) map[string]string {
+	out := copyStringStringMap(in)
+	if out == nil {
+		out = map[string]string{}
+	}
+	if strings.TrimSpace(runID) != "" {
+		out[attrRunID] = runID
+	}
+	return out
+}
+
+// startRunTrace opens the root span for a run (or resume) and returns a
+// finisher that records the result and flushes the exporter. An inherited
+// TRACEPARENT (e.g. from CI) becomes the root span's parent.
+func (e *Engine) startRunTrace(ctx context.Context, mode string) (context.Context, func(*Result, error)) {
+	tracer := newRunTracer(e.RunConfig, e.Options.RunID, e.Warn)
+	if tracer == nil {
+		return ctx, func(*Result, error) {}
+	}
+	if sc, ok := telemetry.ParseTraceparent(os.Getenv(traceparentEnvKey)); ok {
+		ctx = telemetry.ContextWithRemoteParent(ctx, sc)
+	}
+	graphName := ""
+	if e.Graph != nil {
+		graphName = e.Graph.Name
+	}
+	ctx, span := tracer.Start(ctx, "kilroy.run", telemetry.SpanKindInternal, map[string]any{
+		attrRunID:          e.Options.RunID,
+		"kilroy.run_mode":  mode,
+		"kilroy.graph":     graphName,
+		"kilroy.logs_root": e.LogsRoot,
+	})
+	return ctx, func(res *Result, err error) {
+		if err != nil {
+			span.RecordError(err)
+		} else if res != nil {
+			span.SetAttribute(attrStatus, string(res.FinalStatus))
+			if res.FinalStatus == runtime.FinalFail {
+				span.SetStatus(telemetry.StatusError, "run failed")
+			}
+		}
+		span.End()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = tracer.Shutdown(shutdownCtx)
+	}
+}
+
+// startNodeSpan opens a span covering every attempt of a node visit.
+func startNodeSpan(ctx context.Context, node *model.Node) (context.Context, *telemetry.Span) {
+	attrs := map[string]any{attrNodeID: node.ID}
+	if p := strings.TrimSpace(node.Attr("llm_provider", "")); p != "" {
+		attrs[attrProvider] = p
+	}
+	if m := strings.TrimSpace(node.Attr("llm_model", "")); m != "" {
+		attrs[attrModel] = m
+	}
+	return telemetry.Start(ctx, "kilroy.node "+node.ID, telemetry.SpanKindInternal, attrs)
+}
+
+// finishOutcomeSpan records a stage outcome on span and ends it.
+func finishOutcomeSpan(span *telemetry.Span, out runtime.Outcome, retries int) {
+	if span == nil {
+		return
+	}
+	span.SetAttributes(map[string]any{
+		attrStatus:     string(out.Status),
+		attrRetryCount: retries,
+	})
+	if out.Status == runtime.StatusFail || out.Status == runtime.StatusRetry {
+		span.SetAttribute(attrFailureClass, classifyFailureClass(out))
+		span.SetStatus(telemetry.StatusError, out.FailureReason)
+	}
+	span.End()
+}
+
+// startAttemptSpan opens a span for a single handler attempt, recording the
+// provider/model in effect (escalation can change them between attempts).
+func startAttemptSpan(ctx context.Context, node *model.Node, attempt, maxAttempts int) (context.Context, *telemetry.Span) {
+	attrs := map[string]any{
+		attrNodeID:      node.ID,
+		attrAttempt:     attempt,
+		attrMaxAttempts: maxAttempts,
+	}
+	if p := strings.TrimSpace(node.Attr("llm_provider", "")); p != "" {
+		attrs[attrProvider] = p
+	}
+	if m := strings.TrimSpace(node.Attr("llm_model", "")); m != "" {
+		attrs[attrModel] = m
+	}
+	return telemetry.Start(ctx, "kilroy.attempt", telemetry.SpanKindInternal, attrs)
+}
+
+// withTraceparentEnv propagates the active span into a subprocess environment
+// via the W3C TRACEPARENT variable, replacing any inherited value.
+func withTraceparentEnv(ctx context.Context, env []string) []string {
+	tp := telemetry.TraceparentFromContext(ctx)
+	if tp == "" {
+		return env
+	}
+	return append(stripEnvKey(env, traceparentEnvKey), traceparentEnvKey+"="+tp)
+}
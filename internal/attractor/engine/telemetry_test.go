@@ -0,0 +1,180 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/danshapiro/kilroy/internal/telemetry"
+)
+
+type collectedSpan struct {
+	TraceID      string `json:"traceId"`
+	SpanID       string `json:"spanId"`
+	ParentSpanID string `json:"parentSpanId"`
+	Name         string `json:"name"`
+}
+
+func newOTLPCollectorForTest(t *testing.T) (*httptest.Server, func() []collectedSpan) {
+	t.Helper()
+	var mu sync.Mutex
+	var spans []collectedSpan
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/traces" {
+			http.NotFound(w, r)
+			return
+		}
+		var req struct {
+			ResourceSpans []struct {
+				ScopeSpans []struct {
+					Spans []collectedSpan `json:"spans"`
+				} `json:"scopeSpans"`
+			} `json:"resourceSpans"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		mu.Lock()
+		for _, rs := range req.ResourceSpans {
+			for _, ss := range rs.ScopeSpans {
+				spans = append(spans, ss.Spans...)
+			}
+		}
+		mu.Unlock()
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, func() []collectedSpan {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]collectedSpan{}, spans...)
+	}
+}
+
+func TestRunWithConfig_TelemetryExportsSpansAndPropagatesTraceparent(t *testing.T) {
+	t.Setenv(traceparentEnvKey, "")
+	repo := initTestRepo(t)
+	logsRoot := t.TempDir()
+	pinned := writePinnedCatalog(t)
+	cxdbSrv := newCXDBTestServer(t)
+	collector, spans := newOTLPCollectorForTest(t)
+
+	cfg := &RunConfigFile{Version: 1}
+	cfg.Repo.Path = repo
+	cfg.CXDB.BinaryAddr = cxdbSrv.BinaryAddr()
+	cfg.CXDB.HTTPBaseURL = cxdbSrv.URL()
+	cfg.ModelDB.OpenRouterModelInfoPath = pinned
+	cfg.ModelDB.OpenRouterModelInfoUpdatePolicy = "pinned"
+	cfg.Telemetry.Enabled = true
+	cfg.Telemetry.Endpoint = collector.URL
+
+	tpFile := filepath.Join(t.TempDir(), "traceparent.txt")
+	dot := []byte(`
+digraph G {
+  graph [goal="telemetry"]
+  start [shape=Mdiamond]
+  exit  [shape=Msquare]
+  tool [shape=parallelogram, tool_command="printf '%s' \"$TRACEPARENT\" > ` + tpFile + `"]
+  start -> tool -> exit
+}
+`)
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+	res, err := RunWithConfig(ctx, dot, cfg, RunOptions{RunID: "telemetry-run", LogsRoot: logsRoot})
+	if err != nil {
+		t.Fatalf("RunWithConfig: %v", err)
+	}
+	if res.FinalStatus != "success" {
+		t.Fatalf("final status: got %s want success", res.FinalStatus)
+	}
+
+	byName := map[string]collectedSpan{}
+	for _, s := range spans() {
+		byName[s.Name] = s
+	}
+	run, ok := byName["kilroy.run"]
+	if !ok {
+		t.Fatalf("missing kilroy.run span; got %v", byName)
+	}
+	node, ok := byName["kilroy.node tool"]
+	if !ok {
+		t.Fatalf("missing kilroy.node tool span; got %v", byName)
+	}
+	attempt, ok := byName["kilroy.attempt"]
+	if !ok {
+		t.Fatalf("missing kilroy.attempt span; got %v", byName)
+	}
+	if node.ParentSpanID != run.SpanID || node.TraceID != run.TraceID {
+		t.Fatalf("node span not parented to run span: node=%+v run=%+v", node, run)
+	}
+
+	b, err := os.ReadFile(tpFile)
+	if err != nil {
+		t.Fatalf("read traceparent: %v", err)
+	}
+	sc, ok := telemetry.ParseTraceparent(strings.TrimSpace(string(b)))
+	if !ok {
+		t.Fatalf("tool saw invalid TRACEPARENT %q", string(b))
+	}
+	if got := sc.Traceparent(); !strings.Contains(got, run.TraceID) {
+		t.Fatalf("tool TRACEPARENT %q not in run trace %s", got, run.TraceID)
+	}
+	// The tool subprocess runs inside the attempt span of its node.
+	sawAttempt := false
+	for _, s := range spans() {
+		if s.Name == "kilroy.attempt" && strings.Contains(sc.Traceparent(), s.SpanID) {
+			sawAttempt = true
+		}
+	}
+	if !sawAttempt {
+		t.Fatalf("tool TRACEPARENT %q does not reference an attempt span (last attempt %+v)", sc.Traceparent(), attempt)
+	}
+}
+
+func TestLoadRunConfigFile_TelemetryDefaultsAndValidation(t *testing.T) {
+	dir := t.TempDir()
+	write := func(body string) string {
+		p := filepath.Join(dir, "run.yaml")
+		if err := os.WriteFile(p, []byte(body), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+	base := `
+version: 1
+repo: {path: /tmp/repo}
+cxdb: {binary_addr: "127.0.0.1:9009", http_base_url: "http://127.0.0.1:9010"}
+modeldb: {openrouter_model_info_path: /tmp/catalog.json, openrouter_model_info_update_policy: pinned}
+`
+	cfg, err := LoadRunConfigFile(write(base + "telemetry: {enabled: true}\n"))
+	if err != nil {
+		t.Fatalf("LoadRunConfigFile: %v", err)
+	}
+	if cfg.Telemetry.Endpoint != "http://localhost:4318" || cfg.Telemetry.Protocol != "http/json" || cfg.Telemetry.ServiceName != "kilroy" {
+		t.Fatalf("unexpected telemetry defaults: %+v", cfg.Telemetry)
+	}
+
+	cfg, err = LoadRunConfigFile(write(base + "telemetry: {enabled: true, protocol: grpc}\n"))
+	if err != nil {
+		t.Fatalf("LoadRunConfigFile(grpc): %v", err)
+	}
+	if cfg.Telemetry.Endpoint != "http://localhost:4317" || cfg.Telemetry.Protocol != "grpc" {
+		t.Fatalf("unexpected grpc telemetry defaults: %+v", cfg.Telemetry)
+	}
+	_, err = LoadRunConfigFile(write(base + "telemetry: {enabled: true, protocol: http/protobuf}\n"))
+	if err == nil || !strings.Contains(err.Error(), "telemetry.protocol") {
+		t.Fatalf("expected protocol rejection, got %v", err)
+	}
+	_, err = LoadRunConfigFile(write(base + "telemetry: {enabled: true, endpoint: \"localhost:4318\"}\n"))
+	if err == nil || !strings.Contains(err.Error(), "telemetry.endpoint") {
+		t.Fatalf("expected endpoint rejection, got %v", err)
+	}
+}
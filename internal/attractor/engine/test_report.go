@@ -0,0 +1,529 @@
+package engine
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/bmatcuk/doublestar/v4"
+	"github.com/danshapiro/kilroy/internal/attractor/model"
+	"github.com/danshapiro/kilroy/internal/attractor/textutil"
+	"github.com/danshapiro/kilroy/internal/attractor/validate"
+)
+
+// Tool nodes can declare test_report="<format>[:<glob>]" so the handler parses
+// the runner's results instead of reducing them to an exit code. Without a
+// glob the tool's stdout is parsed (go test -json, TAP); with one, the matching
+// files under the worktree are (JUnit XML, pytest-json-report). Globs support
+// ** for nested directories. The accepted format names are
+// validate.TestReportFormats; the constants below key the parsers.
+
+const (
+	testReportFileName = "test_report.json"
+
+	testReportFormatJUnit      = "junit"
+	testReportFormatGoTestJSON = "go-test-json"
+	testReportFormatTAP        = "tap"
+	testReportFormatPytestJSON = "pytest-json"
+
+	// testReportMaxFailures caps failures kept in test_report.json.
+	testReportMaxFailures = 200
+	// testReportContextFailures caps the failing tests copied into context.
+	testReportContextFailures = 20
+	testReportMessageRunes    = 1000
+)
+
+type testReport struct {
+	Format   string              `json:"format"`
+	Sources  []string            `json:"sources"`
+	Total    int                 `json:"total"`
+	Passed   int                 `json:"passed"`
+	Failed   int                 `json:"failed"`
+	Skipped  int                 `json:"skipped"`
+	Failures []testReportFailure `json:"failures,omitempty"`
+	// Flaky lists failed tests that passed on every flaky_rerun.
+	Flaky []string `json:"flaky,omitempty"`
+}
+
+type testReportFailure struct {
+	Name    string `json:"name"`
+	Suite   string `json:"suite,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+// FullName is the suite-qualified test name used in context and prompts.
+func (f testReportFailure) FullName() string {
+	if f.Suite == "" || strings.HasPrefix(f.Name, f.Suite) {
+		return f.Name
+	}
+	return f.Suite + "." + f.Name
+}
+
+func (r *testReport) addFailure(f testReportFailure) {
+	r.Failed++
+	if len(r.Failures) < testReportMaxFailures {
+		f.Message = trimToRunes(strings.TrimSpace(f.Message), testReportMessageRunes)
+		r.Failures = append(r.Failures, f)
+	}
+}
+
+// parseTestReportSpec splits a test_report attribute into format and glob.
+func parseTestReportSpec(raw string) (format string, glob string, err error) {
+	raw = strings.TrimSpace(raw)
+	format, glob, _ = strings.Cut(raw, ":")
+	format = strings.ToLower(strings.TrimSpace(format))
+	glob = strings.TrimSpace(glob)
+	if slices.Contains(validate.TestReportFormats, format) {
+		return format, glob, nil
+	}
+	return "", "", fmt.Errorf("unknown test_report format %q (want one of %s)", format, strings.Join(validate.TestReportFormats, ", "))
+}
+
+// collectToolTestReport parses the node's test_report, if it declares one.
+// Problems are reported as engine warnings; the tool's own outcome is
+// unaffected.
+func collectToolTestReport(execCtx *Execution, node *model.Node, stdout []byte) *testReport {
+	raw := strings.TrimSpace(node.Attr("test_report", ""))
+	if raw == "" {
+		return nil
+	}
+	format, glob, err := parseTestReportSpec(raw)
+	if err != nil {
+		warnEngine(execCtx, fmt.Sprintf("node %q: %v", node.ID, err))
+		return nil
+	}
+	report := &testReport{Format: format}
+	var inputs [][]byte
+	if glob == "" {
+		report.Sources = []string{"stdout.log"}
+		inputs = append(inputs, stdout)
+	} else {
+		pattern := glob
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(execCtx.WorktreeDir, filepath.FromSlash(glob))
+		}
+		matches, err := doublestar.FilepathGlob(pattern)
+		if err != nil {
+			warnEngine(execCtx, fmt.Sprintf("node %q: test_report glob %q: %v", node.ID, glob, err))
+			return nil
+		}
+		if len(matches) == 0 {
+			warnEngine(execCtx, fmt.Sprintf("node %q: test_report glob %q matched no files", node.ID, glob))
+			return nil
+		}
+		sort.Strings(matches)
+		for _, m := range matches {
+			b, err := os.ReadFile(m)
+			if err != nil {
+				warnEngine(execCtx, fmt.Sprintf("node %q: read test report %s: %v", node.ID, m, err))
+				continue
+			}
+			if rel, err := filepath.Rel(execCtx.WorktreeDir, m); err == nil && !strings.HasPrefix(rel, "..") {
+				m = filepath.ToSlash(rel)
+			}
+			report.Sources = append(report.Sources, m)
+			inputs = append(inputs, b)
+		}
+	}
+	for i, in := range inputs {
+		if err := parseTestReportInto(report, format, in); err != nil {
+			warnEngine(execCtx, fmt.Sprintf("node %q: parse %s test report %s: %v", node.ID, format, report.Sources[i], err))
+		}
+	}
+	return report
+}
+
+// writeTestReport writes the normalized test_report.json to stageDir.
+func writeTestReport(execCtx *Execution, stageDir string, report *testReport) {
+	if report == nil {
+		return
+	}
+	if err := writeJSON(filepath.Join(stageDir, testReportFileName), report); err != nil {
+		warnEngine(execCtx, fmt.Sprintf("write %s: %v", testReportFileName, err))
+	}
+}
+
+func parseTestReportInto(r *testReport, format string, data []byte) error {
+	switch format {
+	case testReportFormatJUnit:
+		return parseJUnitReport(r, data)
+	case testReportFormatGoTestJSON:
+		return parseGoTestJSONReport(r, data)
+	case testReportFormatTAP:
+		return parseTAPReport(r, data)
+	case testReportFormatPytestJSON:
+		return parsePytestJSONReport(r, data)
+	default:
+		return fmt.Errorf("unsupported format %q", format)
+	}
+}
+
+// contextUpdates returns the tool.tests.* keys for a parsed report.
+func (r *testReport) contextUpdates(stageDir string) map[string]any {
+	failures := make([]string, 0, len(r.Failures))
+	for i, f := range r.Failures {
+		if i >= testReportContextFailures {
+			failures = append(failures, fmt.Sprintf("... (%d more in %s)", r.Failed-i, testReportFileName))
+			break
+		}
+		line := f.FullName()
+		if msg := textutil.FirstLine(f.Message); msg != "" {
+			line += ": " + trimToRunes(msg, 200)
+		}
+		if r.isFlaky(f) {
+			line += " [flaky: passed on rerun]"
+		}
+		failures = append(failures, line)
+	}
+	return map[string]any{
+		"tool.tests.total":    r.Total,
+		"tool.tests.passed":   r.Passed,
+		"tool.tests.failed":   r.Failed,
+		"tool.tests.skipped":  r.Skipped,
+		"tool.tests.failures": failures,
+		"tool.tests.report":   filepath.Join(stageDir, testReportFileName),
+	}
+}
+
+// failureReason summarizes failing tests for the outcome, or returns "".
+func (r *testReport) failureReason() string {
+	if r == nil || r.Failed == 0 {
+		return ""
+	}
+	names := make([]string, 0, 5)
+	for i, f := range r.Failures {
+		if i == 5 {
+			names = append(names, fmt.Sprintf("+%d more", r.Failed-i))
+			break
+		}
+		names = append(names, f.FullName())
+	}
+	return fmt.Sprintf("%d of %d tests failed: %s", r.Failed, r.Total, strings.Join(names, ", "))
+}
+
+// --- JUnit XML ---
+
+// junitSuite decodes both <testsuites> and <testsuite> roots, which may nest.
+type junitSuite struct {
+	Name   string       `xml:"name,attr"`
+	Suites []junitSuite `xml:"testsuite"`
+	Cases  []junitCase  `xml:"testcase"`
+}
+
+type junitCase struct {
+	Name      string        `xml:"name,attr"`
+	Classname string        `xml:"classname,attr"`
+	Failures  []junitResult `xml:"failure"`
+	Errors    []junitResult `xml:"error"`
+	Skipped   *junitResult  `xml:"skipped"`
+}
+
+type junitResult struct {
+	Message string `xml:"message,attr"`
+	Body    string `xml:",chardata"`
+}
+
+func parseJUnitReport(r *testReport, data []byte) error {
+	var root junitSuite
+	if err := xml.Unmarshal(data, &root); err != nil {
+		return err
+	}
+	var walk func(s junitSuite)
+	walk = func(s junitSuite) {
+		for _, c := range s.Cases {
+			r.Total++
+			problems := append(append([]junitResult{}, c.Failures...), c.Errors...)
+			switch {
+			case len(problems) > 0:
+				// The message attribute is the short reason; the body is the trace.
+				msg := strings.TrimSpace(problems[0].Message + "\n" + strings.TrimSpace(problems[0].Body))
+				suite := c.Classname
+				if suite == "" {
+					suite = s.Name
+				}
+				r.addFailure(testReportFailure{Name: c.Name, Suite: suite, Message: msg})
+			case c.Skipped != nil:
+				r.Skipped++
+			default:
+				r.Passed++
+			}
+		}
+		for _, child := range s.Suites {
+			walk(child)
+		}
+	}
+	walk(root)
+	return nil
+}
+
+// --- go test -json ---
+
+type goTestEvent struct {
+	Action     string
+	Package    string
+	Test       string
+	Output     string
+	ImportPath string
+}
+
+func parseGoTestJSONReport(r *testReport, data []byte) error {
+	type key struct{ pkg, test string }
+	output := map[key]*strings.Builder{}
+	buildOutput := map[string]*strings.Builder{}
+	final := map[key]string{}
+	var order []key
+	pkgHasFailedTest := map[string]bool{}
+
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	sc.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	sawEvent := false
+	for sc.Scan() {
+		line := bytes.TrimSpace(sc.Bytes())
+		if len(line) == 0 || line[0] != '{' {
+			continue
+		}
+		var ev goTestEvent
+		if err := json.Unmarshal(line, &ev); err != nil {
+			continue
+		}
+		sawEvent = true
+		if ev.Action == "build-output" {
+			pkg, _, _ := strings.Cut(ev.ImportPath, " ")
+			if buildOutput[pkg] == nil {
+				buildOutput[pkg] = &strings.Builder{}
+			}
+			buildOutput[pkg].WriteString(ev.Output)
+			continue
+		}
+		k := key{ev.Package, ev.Test}
+		switch ev.Action {
+		case "output":
+			if output[k] == nil {
+				output[k] = &strings.Builder{}
+			}
+			output[k].WriteString(ev.Output)
+		case "pass", "fail", "skip":
+			if _, seen := final[k]; !seen {
+				order = append(order, k)
+			}
+			final[k] = ev.Action
+			if ev.Test != "" && ev.Action == "fail" {
+				pkgHasFailedTest[ev.Package] = true
+			}
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return err
+	}
+	if !sawEvent {
+		return fmt.Errorf("no go test -json events found (did the command use `go test -json`?)")
+	}
+	for _, k := range order {
+		action := final[k]
+		if k.test == "" {
+			// A package that fails without a failing test did not build or
+			// crashed outside a test; report it so the failure is not lost.
+			if action == "fail" && !pkgHasFailedTest[k.pkg] {
+				r.Total++
+				var msg string
+				if b := buildOutput[k.pkg]; b != nil {
+					msg = b.String()
+				}
+				if b := output[k]; b != nil {
+					msg += goTestFailureMessage(b.String())
+				}
+				r.addFailure(testReportFailure{Name: "[package]", Suite: k.pkg, Message: msg})
+			}
+			continue
+		}
+		r.Total++
+		switch action {
+		case "pass":
+			r.Passed++
+		case "skip":
+			r.Skipped++
+		case "fail":
+			var msg string
+			if b := output[k]; b != nil {
+				msg = goTestFailureMessage(b.String())
+			}
+			r.addFailure(testReportFailure{Name: k.test, Suite: k.pkg, Message: msg})
+		}
+	}
+	return nil
+}
+
+// goTestFailureMessage drops the test runner's framing lines from a test's output.
+func goTestFailureMessage(out string) string {
+	var keep []string
+	for _, l := range strings.Split(out, "\n") {
+		t := strings.TrimSpace(l)
+		switch {
+		case t == "", t == "FAIL", t == "PASS",
+			strings.HasPrefix(t, "=== "),
+			strings.HasPrefix(t, "--- FAIL"), strings.HasPrefix(t, "--- PASS"), strings.HasPrefix(t, "--- SKIP"),
+			strings.HasPrefix(t, "FAIL\t"), strings.HasPrefix(t, "ok  \t"):
+			continue
+		}
+		keep = append(keep, t)
+	}
+	return strings.Join(keep, "\n")
+}
+
+// --- TAP ---
+
+var (
+	tapResultRE = regexp.MustCompile(`^(not )?ok\b\s*(\d+)?\s*(?:-\s*)?([^#]*?)\s*(?:#\s*(.*))?$`)
+	tapBailRE   = regexp.MustCompile(`^Bail out!\s*(.*)$`)
+)
+
+func parseTAPReport(r *testReport, data []byte) error {
+	lines := strings.Split(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n")
+	sawResult := false
+	for i := 0; i < len(lines); i++ {
+		l := lines[i]
+		// Indented results are TAP 14 subtests; their parent line summarizes them.
+		if l == "" || l[0] == ' ' || l[0] == '\t' {
+			continue
+		}
+		if m := tapBailRE.FindStringSubmatch(l); m != nil {
+			r.Total++
+			r.addFailure(testReportFailure{Name: "Bail out!", Message: m[1]})
+			sawResult = true
+			continue
+		}
+		m := tapResultRE.FindStringSubmatch(l)
+		if m == nil {
+			continue
+		}
+		sawResult = true
+		r.Total++
+		name := strings.TrimSpace(m[3])
+		if name == "" {
+			name = "test " + m[2]
+		}
+		directive := strings.ToUpper(strings.TrimSpace(m[4]))
+		switch {
+		case strings.HasPrefix(directive, "SKIP"), strings.HasPrefix(directive, "TODO"):
+			r.Skipped++
+		case m[1] == "":
+			r.Passed++
+		default:
+			msg, next := tapDiagnostics(lines, i+1)
+			i = next - 1
+			r.addFailure(testReportFailure{Name: name, Message: msg})
+		}
+	}
+	if !sawResult {
+		return fmt.Errorf("no TAP result lines found")
+	}
+	return nil
+}
+
+// tapDiagnostics reads the YAML block or # comments following a failed test
+// and returns the message plus the index of the first unconsumed line.
+func tapDiagnostics(lines []string, i int) (string, int) {
+	var yaml, comments []string
+	inYAML := false
+scan:
+	for ; i < len(lines); i++ {
+		t := strings.TrimSpace(lines[i])
+		switch {
+		case !inYAML && t == "---" && strings.HasPrefix(lines[i], " "):
+			inYAML = true
+		case inYAML && t == "...":
+			inYAML = false
+		case inYAML:
+			yaml = append(yaml, t)
+		case strings.HasPrefix(t, "#"):
+			comments = append(comments, strings.TrimSpace(strings.TrimPrefix(t, "#")))
+		default:
+			break scan
+		}
+	}
+	for _, y := range yaml {
+		if v, ok := strings.CutPrefix(y, "message:"); ok {
+			return strings.Trim(strings.TrimSpace(v), `"'`), i
+		}
+	}
+	if len(yaml) > 0 {
+		return strings.Join(yaml, "\n"), i
+	}
+	return strings.Join(comments, "\n"), i
+}
+
+// --- pytest-json-report ---
+
+type pytestJSONReport struct {
+	Tests []struct {
+		NodeID   string           `json:"nodeid"`
+		Outcome  string           `json:"outcome"`
+		Setup    *pytestJSONPhase `json:"setup"`
+		Call     *pytestJSONPhase `json:"call"`
+		Teardown *pytestJSONPhase `json:"teardown"`
+	} `json:"tests"`
+	Collectors []struct {
+		NodeID   string `json:"nodeid"`
+		Outcome  string `json:"outcome"`
+		Longrepr string `json:"longrepr"`
+	} `json:"collectors"`
+}
+
+type pytestJSONPhase struct {
+	Outcome string `json:"outcome"`
+	Crash   *struct {
+		Message string `json:"message"`
+	} `json:"crash"`
+	Longrepr string `json:"longrepr"`
+}
+
+func (p *pytestJSONPhase) message() string {
+	if p == nil {
+		return ""
+	}
+	if p.Crash != nil && strings.TrimSpace(p.Crash.Message) != "" {
+		return p.Crash.Message
+	}
+	return p.Longrepr
+}
+
+func parsePytestJSONReport(r *testReport, data []byte) error {
+	var rep pytestJSONReport
+	if err := json.Unmarshal(data, &rep); err != nil {
+		return err
+	}
+	for _, c := range rep.Collectors {
+		if c.Outcome == "failed" {
+			r.Total++
+			r.addFailure(testReportFailure{Name: c.NodeID, Message: "collection error: " + c.Longrepr})
+		}
+	}
+	for _, t := range rep.Tests {
+		r.Total++
+		switch t.Outcome {
+		case "passed", "xpassed":
+			r.Passed++
+		case "skipped", "xfailed":
+			r.Skipped++
+		default: // failed, error
+			msg := ""
+			for _, p := range []*pytestJSONPhase{t.Call, t.Setup, t.Teardown} {
+				if p != nil && p.Outcome != "passed" && p.Outcome != "skipped" {
+					if msg = p.message(); msg != "" {
+						break
+					}
+				}
+			}
+			r.addFailure(testReportFailure{Name: t.NodeID, Message: msg})
+		}
+	}
+	return nil
+}
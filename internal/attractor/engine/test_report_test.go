@@ -0,0 +1,218 @@
+package engine
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/danshapiro/kilroy/internal/attractor/runtime"
+	"github.com/danshapiro/kilroy/internal/attractor/validate"
+)
+
+func TestToolHandler_TestReport_JUnitGlob(t *testing.T) {
+	xml := `<?xml version="1.0"?>
+<testsuites>
+  <testsuite name="calc">
+    <testcase classname="calc.AddTest" name="test_add"/>
+    <testcase classname="calc.AddTest" name="test_overflow"><failure message="expected 0, got -1">AssertionError: expected 0, got -1
+  at calc_test.py:12</failure></testcase>
+    <testcase classname="calc.AddTest" name="test_slow"><skipped/></testcase>
+  </testsuite>
+</testsuites>`
+	cmd := "mkdir -p reports && cat > reports/unit.xml <<'EOF'\n" + xml + "\nEOF\nexit 1"
+	out, logsRoot, _, nodeID := runToolHandler(t, "verify_unit", "Verify Unit", cmd, map[string]string{"test_report": "junit:reports/*.xml"})
+	if out.Status != runtime.StatusFail {
+		t.Fatalf("status: got %q want %q", out.Status, runtime.StatusFail)
+	}
+	if want := "1 of 3 tests failed: calc.AddTest.test_overflow"; out.FailureReason != want {
+		t.Fatalf("failure reason: got %q want %q", out.FailureReason, want)
+	}
+	for k, want := range map[string]any{"tool.tests.total": 3, "tool.tests.passed": 1, "tool.tests.failed": 1, "tool.tests.skipped": 1} {
+		if got := out.ContextUpdates[k]; got != want {
+			t.Fatalf("%s: got %v want %v", k, got, want)
+		}
+	}
+	failures, _ := out.ContextUpdates["tool.tests.failures"].([]string)
+	if len(failures) != 1 || failures[0] != "calc.AddTest.test_overflow: expected 0, got -1" {
+		t.Fatalf("tool.tests.failures: %#v", failures)
+	}
+
+	b, err := os.ReadFile(filepath.Join(logsRoot, nodeID, testReportFileName))
+	if err != nil {
+		t.Fatalf("read %s: %v", testReportFileName, err)
+	}
+	var rep testReport
+	if err := json.Unmarshal(b, &rep); err != nil {
+		t.Fatalf("decode %s: %v", testReportFileName, err)
+	}
+	if rep.Format != "junit" || len(rep.Sources) != 1 || rep.Sources[0] != "reports/unit.xml" {
+		t.Fatalf("report header: %+v", rep)
+	}
+	if len(rep.Failures) != 1 || !strings.Contains(rep.Failures[0].Message, "at calc_test.py:12") {
+		t.Fatalf("report failures: %+v", rep.Failures)
+	}
+}
+
+func TestToolHandler_TestReport_DoubleStarGlobMatchesNestedReports(t *testing.T) {
+	cmd := `mkdir -p reports/api reports/web/unit
+echo '<testsuite name="api"><testcase name="a"/></testsuite>' > reports/api/junit.xml
+echo '<testsuite name="web"><testcase name="b"><failure message="boom"/></testcase></testsuite>' > reports/web/unit/junit.xml
+exit 1`
+	out, logsRoot, _, nodeID := runToolHandler(t, "verify_all", "Verify All", cmd, map[string]string{"test_report": "junit:reports/**/*.xml"})
+	if got := out.ContextUpdates["tool.tests.total"]; got != 2 {
+		t.Fatalf("tool.tests.total: got %v want 2 (%+v)", got, out)
+	}
+	b, err := os.ReadFile(filepath.Join(logsRoot, nodeID, testReportFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rep testReport
+	if err := json.Unmarshal(b, &rep); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(rep.Sources, ",") != "reports/api/junit.xml,reports/web/unit/junit.xml" {
+		t.Fatalf("sources: %v", rep.Sources)
+	}
+}
+
+func TestParseTestReportInto_HandlesEveryValidatedFormat(t *testing.T) {
+	for _, f := range validate.TestReportFormats {
+		if _, _, err := parseTestReportSpec(f); err != nil {
+			t.Fatalf("%s: %v", f, err)
+		}
+		if err := parseTestReportInto(&testReport{}, f, nil); err != nil && strings.Contains(err.Error(), "unsupported format") {
+			t.Fatalf("%s has no parser", f)
+		}
+	}
+}
+
+func TestToolHandler_TestReport_GoTestJSONFromStdout(t *testing.T) {
+	events := []string{
+		`{"Action":"run","Package":"example.com/m/p","Test":"TestOK"}`,
+		`{"Action":"pass","Package":"example.com/m/p","Test":"TestOK"}`,
+		`{"Action":"run","Package":"example.com/m/p","Test":"TestBad"}`,
+		`{"Action":"output","Package":"example.com/m/p","Test":"TestBad","Output":"=== RUN   TestBad\n"}`,
+		`{"Action":"output","Package":"example.com/m/p","Test":"TestBad","Output":"    p_test.go:9: got 2, want 3\n"}`,
+		`{"Action":"output","Package":"example.com/m/p","Test":"TestBad","Output":"--- FAIL: TestBad (0.00s)\n"}`,
+		`{"Action":"fail","Package":"example.com/m/p","Test":"TestBad"}`,
+		`{"Action":"fail","Package":"example.com/m/p"}`,
+		`{"ImportPath":"example.com/m/q [example.com/m/q.test]","Action":"build-output","Output":"q/q.go:3:2: undefined: foo\n"}`,
+		`{"Action":"output","Package":"example.com/m/q","Output":"FAIL\texample.com/m/q [build failed]\n"}`,
+		`{"Action":"fail","Package":"example.com/m/q"}`,
+	}
+	cmd := "cat <<'EOF'\n" + strings.Join(events, "\n") + "\nEOF\nexit 1"
+	out, _, _, _ := runToolHandler(t, "verify_go", "Verify Go", cmd, map[string]string{"test_report": "go-test-json"})
+	if out.Status != runtime.StatusFail {
+		t.Fatalf("status: got %q want %q", out.Status, runtime.StatusFail)
+	}
+	failures, _ := out.ContextUpdates["tool.tests.failures"].([]string)
+	want := []string{
+		"example.com/m/p.TestBad: p_test.go:9: got 2, want 3",
+		"example.com/m/q.[package]: q/q.go:3:2: undefined: foo",
+	}
+	if strings.Join(failures, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("tool.tests.failures:\n%s\nwant:\n%s", strings.Join(failures, "\n"), strings.Join(want, "\n"))
+	}
+	if out.ContextUpdates["tool.tests.total"] != 3 || out.ContextUpdates["tool.tests.passed"] != 1 {
+		t.Fatalf("counts: %#v", out.ContextUpdates)
+	}
+}
+
+func TestToolHandler_TestReport_SuccessStillRecordsCounts(t *testing.T) {
+	out, _, _, _ := runToolHandler(t, "verify_tap", "Verify TAP", "printf 'TAP version 13\\n1..2\\nok 1 - parses\\nok 2 - renders # SKIP no display\\n'", map[string]string{"test_report": "tap"})
+	if out.Status != runtime.StatusSuccess {
+		t.Fatalf("status: got %q want %q", out.Status, runtime.StatusSuccess)
+	}
+	if out.ContextUpdates["tool.tests.total"] != 2 || out.ContextUpdates["tool.tests.skipped"] != 1 || out.ContextUpdates["tool.tests.failed"] != 0 {
+		t.Fatalf("counts: %#v", out.ContextUpdates)
+	}
+}
+
+func TestParseTAPReport_FailureDiagnostics(t *testing.T) {
+	tap := `TAP version 14
+1..4
+ok 1 - login
+not ok 2 - logout
+  ---
+  message: "session cookie still set"
+  severity: fail
+  ...
+not ok 3 - refresh # TODO not implemented
+    ok 1 - nested subtest is not counted
+not ok 4
+# timed out after 5s
+`
+	var r testReport
+	if err := parseTAPReport(&r, []byte(tap)); err != nil {
+		t.Fatalf("parseTAPReport: %v", err)
+	}
+	if r.Total != 4 || r.Passed != 1 || r.Skipped != 1 || r.Failed != 2 {
+		t.Fatalf("counts: %+v", r)
+	}
+	if r.Failures[0].Name != "logout" || r.Failures[0].Message != "session cookie still set" {
+		t.Fatalf("failure 1: %+v", r.Failures[0])
+	}
+	if r.Failures[1].Name != "test 4" || r.Failures[1].Message != "timed out after 5s" {
+		t.Fatalf("failure 2: %+v", r.Failures[1])
+	}
+}
+
+func TestParsePytestJSONReport(t *testing.T) {
+	data := `{
+  "summary": {"passed": 1, "failed": 1, "error": 1, "total": 3},
+  "collectors": [{"nodeid": "tests/test_broken.py", "outcome": "failed", "longrepr": "ImportError: no module named foo"}],
+  "tests": [
+    {"nodeid": "tests/test_a.py::test_ok", "outcome": "passed"},
+    {"nodeid": "tests/test_a.py::test_math", "outcome": "failed",
+     "setup": {"outcome": "passed"},
+     "call": {"outcome": "failed", "crash": {"path": "tests/test_a.py", "lineno": 7, "message": "assert 2 == 3"}, "longrepr": "def test_math():\n>  assert 2 == 3"}},
+    {"nodeid": "tests/test_a.py::test_db", "outcome": "error",
+     "setup": {"outcome": "failed", "longrepr": "fixture 'db' not found"}},
+    {"nodeid": "tests/test_a.py::test_later", "outcome": "xfailed"}
+  ]
+}`
+	var r testReport
+	if err := parsePytestJSONReport(&r, []byte(data)); err != nil {
+		t.Fatalf("parsePytestJSONReport: %v", err)
+	}
+	if r.Total != 5 || r.Passed != 1 || r.Skipped != 1 || r.Failed != 3 {
+		t.Fatalf("counts: %+v", r)
+	}
+	got := []string{}
+	for _, f := range r.Failures {
+		got = append(got, f.Name+" | "+f.Message)
+	}
+	want := []string{
+		"tests/test_broken.py | collection error: ImportError: no module named foo",
+		"tests/test_a.py::test_math | assert 2 == 3",
+		"tests/test_a.py::test_db | fixture 'db' not found",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("failures:\n%s", strings.Join(got, "\n"))
+	}
+}
+
+func TestBuildFidelityPreamble_ListsFailingTests(t *testing.T) {
+	ctx := runtime.NewContext()
+	ctx.Set("tool.tests.total", 12)
+	ctx.Set("tool.tests.failed", 2)
+	// After a checkpoint round trip the list decodes as []any.
+	ctx.Set("tool.tests.failures", []any{"pkg.TestA: boom", "pkg.TestB: nil map"})
+
+	for _, fidelity := range []string{"truncate", "compact"} {
+		p := buildFidelityPreamble(ctx, "run", "goal", fidelity, "verify", nil)
+		if !strings.Contains(p, "FailingTests (2 of 12 failed):\n- pkg.TestA: boom\n- pkg.TestB: nil map") {
+			t.Fatalf("%s preamble missing failing tests:\n%s", fidelity, p)
+		}
+		if strings.Contains(p, "- tool.tests.failures=") {
+			t.Fatalf("%s preamble repeats the failures in the context dump:\n%s", fidelity, p)
+		}
+	}
+
+	ctx.Set("tool.tests.failures", []string{})
+	if p := buildFidelityPreamble(ctx, "run", "goal", "compact", "verify", nil); strings.Contains(p, "FailingTests") {
+		t.Fatalf("preamble lists failing tests after a passing run:\n%s", p)
+	}
+}
@@ -0,0 +1,255 @@
+// Package forge opens pull requests (merge requests on GitLab) through the
+// REST API of GitHub, GitLab or Gitea.
+package forge
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+type Kind string
+
+const (
+	GitHub Kind = "github"
+	GitLab Kind = "gitlab"
+	Gitea  Kind = "gitea"
+)
+
+// ParseKind normalizes a forge name; empty means GitHub.
+func ParseKind(s string) (Kind, error) {
+	switch k := Kind(strings.ToLower(strings.TrimSpace(s))); k {
+	case "":
+		return GitHub, nil
+	case GitHub, GitLab, Gitea:
+		return k, nil
+	default:
+		return "", fmt.Errorf("unknown forge %q (want github|gitlab|gitea)", s)
+	}
+}
+
+// DefaultTokenEnv is the environment variable holding the API token when the
+// configuration does not name one.
+func DefaultTokenEnv(k Kind) string {
+	switch k {
+	case GitLab:
+		return "GITLAB_TOKEN"
+	case Gitea:
+		return "GITEA_TOKEN"
+	default:
+		return "GITHUB_TOKEN"
+	}
+}
+
+// PullRequest is the request to open.
+type PullRequest struct {
+	// Repo is "owner/name".
+	Repo   string
+	Head   string
+	Base   string
+	Title  string
+	Body   string
+	Draft  bool
+	Labels []string
+}
+
+type Client struct {
+	Kind Kind
+	// BaseURL is the API root: https://api.github.com and
+	// https://gitlab.com/api/v4 by default; required for Gitea
+	// (https://<host>/api/v1).
+	BaseURL    string
+	Token      string
+	HTTPClient *http.Client
+}
+
+// Create opens pr and returns its web URL.
+func (c *Client) Create(ctx context.Context, pr PullRequest) (string, error) {
+	if strings.TrimSpace(pr.Repo) == "" || strings.TrimSpace(pr.Head) == "" || strings.TrimSpace(pr.Base) == "" {
+		return "", fmt.Errorf("pull request needs repo, head and base")
+	}
+	switch c.Kind {
+	case GitHub, "":
+		return c.createGitHub(ctx, pr)
+	case GitLab:
+		return c.createGitLab(ctx, pr)
+	case Gitea:
+		return c.createGitea(ctx, pr)
+	default:
+		return "", fmt.Errorf("unsupported forge %q", c.Kind)
+	}
+}
+
+func (c *Client) createGitHub(ctx context.Context, pr PullRequest) (string, error) {
+	base := strings.TrimRight(strings.TrimSpace(c.BaseURL), "/")
+	if base == "" {
+		base = "https://api.github.com"
+	}
+	var created struct {
+		Number  int    `json:"number"`
+		HTMLURL string `json:"html_url"`
+	}
+	err := c.do(ctx, http.MethodPost, base+"/repos/"+pr.Repo+"/pulls", map[string]any{
+		"title": pr.Title,
+		"head":  pr.Head,
+		"base":  pr.Base,
+		"body":  pr.Body,
+		"draft": pr.Draft,
+	}, &created)
+	if err != nil {
+		return "", err
+	}
+	if len(pr.Labels) > 0 {
+		// Labels go through the issues API; a failure here leaves the PR open.
+		if err := c.do(ctx, http.MethodPost, fmt.Sprintf("%s/repos/%s/issues/%d/labels", base, pr.Repo, created.Number), map[string]any{"labels": pr.Labels}, nil); err != nil {
+			return created.HTMLURL, fmt.Errorf("pull request %s opened but labels failed: %w", created.HTMLURL, err)
+		}
+	}
+	return created.HTMLURL, nil
+}
+
+func (c *Client) createGitLab(ctx context.Context, pr PullRequest) (string, error) {
+	base := strings.TrimRight(strings.TrimSpace(c.BaseURL), "/")
+	if base == "" {
+		base = "https://gitlab.com/api/v4"
+	}
+	title := pr.Title
+	if pr.Draft {
+		title = "Draft: " + title
+	}
+	var created struct {
+		WebURL string `json:"web_url"`
+	}
+	err := c.do(ctx, http.MethodPost, base+"/projects/"+url.PathEscape(pr.Repo)+"/merge_requests", map[string]any{
+		"source_branch": pr.Head,
+		"target_branch": pr.Base,
+		"title":         title,
+		"description":   pr.Body,
+		"labels":        strings.Join(pr.Labels, ","),
+	}, &created)
+	if err != nil {
+		return "", err
+	}
+	return created.WebURL, nil
+}
+
+func (c *Client) createGitea(ctx context.Context, pr PullRequest) (string, error) {
+	base := strings.TrimRight(strings.TrimSpace(c.BaseURL), "/")
+	if base == "" {
+		return "", fmt.Errorf("gitea needs an API base URL (https://<host>/api/v1)")
+	}
+	title := pr.Title
+	if pr.Draft {
+		title = "WIP: " + title
+	}
+	payload := map[string]any{
+		"head":  pr.Head,
+		"base":  pr.Base,
+		"title": title,
+		"body":  pr.Body,
+	}
+	if len(pr.Labels) > 0 {
+		// Gitea takes label IDs, so resolve the names first.
+		var labels []struct {
+			ID   int64  `json:"id"`
+			Name string `json:"name"`
+		}
+		if err := c.do(ctx, http.MethodGet, base+"/repos/"+pr.Repo+"/labels?limit=200", nil, &labels); err != nil {
+			return "", err
+		}
+		var ids []int64
+		for _, want := range pr.Labels {
+			found := false
+			for _, l := range labels {
+				if strings.EqualFold(l.Name, want) {
+					ids = append(ids, l.ID)
+					found = true
+					break
+				}
+			}
+			if !found {
+				return "", fmt.Errorf("gitea repo %s has no label %q", pr.Repo, want)
+			}
+		}
+		payload["labels"] = ids
+	}
+	var created struct {
+		HTMLURL string `json:"html_url"`
+	}
+	if err := c.do(ctx, http.MethodPost, base+"/repos/"+pr.Repo+"/pulls", payload, &created); err != nil {
+		return "", err
+	}
+	return created.HTMLURL, nil
+}
+
+func (c *Client) do(ctx context.Context, method, endpoint string, body any, out any) error {
+	var reqBody io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reqBody = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, reqBody)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Accept", "application/json")
+	if c.Token != "" {
+		switch c.Kind {
+		case GitLab:
+			req.Header.Set("PRIVATE-TOKEN", c.Token)
+		case Gitea:
+			req.Header.Set("Authorization", "token "+c.Token)
+		default:
+			req.Header.Set("Accept", "application/vnd.github+json")
+			req.Header.Set("Authorization", "Bearer "+c.Token)
+		}
+	}
+	hc := c.HTTPClient
+	if hc == nil {
+		hc = &http.Client{Timeout: 30 * time.Second}
+	}
+	resp, err := hc.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("%s %s: %s: %s", method, endpoint, resp.Status, strings.TrimSpace(string(respBody)))
+	}
+	if out != nil {
+		if err := json.Unmarshal(respBody, out); err != nil {
+			return fmt.Errorf("%s %s: decode response: %w", method, endpoint, err)
+		}
+	}
+	return nil
+}
+
+// RepoFromRemoteURL extracts "owner/name" from an scp-style or URL git remote,
+// e.g. git@github.com:owner/name.git or https://github.com/owner/name.
+func RepoFromRemoteURL(remote string) (string, error) {
+	remote = strings.TrimSpace(remote)
+	path := ""
+	if u, err := url.Parse(remote); err == nil && u.Scheme != "" && u.Host != "" {
+		path = u.Path
+	} else if _, after, ok := strings.Cut(remote, ":"); ok && !strings.Contains(remote, "://") {
+		path = after
+	}
+	path = strings.TrimSuffix(strings.Trim(path, "/"), ".git")
+	if strings.Count(path, "/") < 1 || strings.HasPrefix(path, "/") {
+		return "", fmt.Errorf("cannot derive owner/name from remote %q", remote)
+	}
+	return path, nil
+}
@@ -0,0 +1,146 @@
+package forge
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClient_CreateGitHubPullRequest(t *testing.T) {
+	var gotPR map[string]any
+	var gotLabels map[string]any
+	var gotAuth string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/repos/acme/widgets/pulls":
+			gotAuth = r.Header.Get("Authorization")
+			_ = json.NewDecoder(r.Body).Decode(&gotPR)
+			w.WriteHeader(http.StatusCreated)
+			_, _ = w.Write([]byte(`{"number": 7, "html_url": "https://github.example/acme/widgets/pull/7"}`))
+		case "/repos/acme/widgets/issues/7/labels":
+			_ = json.NewDecoder(r.Body).Decode(&gotLabels)
+			_, _ = w.Write([]byte(`[]`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	c := &Client{Kind: GitHub, BaseURL: srv.URL, Token: "tok"}
+	u, err := c.Create(context.Background(), PullRequest{
+		Repo: "acme/widgets", Head: "attractor/land/r1", Base: "main",
+		Title: "Add widgets", Body: "body", Draft: true, Labels: []string{"kilroy"},
+	})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if u != "https://github.example/acme/widgets/pull/7" {
+		t.Fatalf("url: %q", u)
+	}
+	if gotAuth != "Bearer tok" {
+		t.Fatalf("auth header: %q", gotAuth)
+	}
+	if gotPR["head"] != "attractor/land/r1" || gotPR["base"] != "main" || gotPR["draft"] != true {
+		t.Fatalf("pull request payload: %v", gotPR)
+	}
+	if labels, _ := gotLabels["labels"].([]any); len(labels) != 1 || labels[0] != "kilroy" {
+		t.Fatalf("labels payload: %v", gotLabels)
+	}
+}
+
+func TestClient_CreateReportsAPIError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"message":"Validation Failed"}`, http.StatusUnprocessableEntity)
+	}))
+	defer srv.Close()
+	c := &Client{BaseURL: srv.URL}
+	if _, err := c.Create(context.Background(), PullRequest{Repo: "a/b", Head: "h", Base: "main"}); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestRepoFromRemoteURL(t *testing.T) {
+	cases := map[string]string{
+		"git@github.com:acme/widgets.git":        "acme/widgets",
+		"https://github.com/acme/widgets":        "acme/widgets",
+		"https://github.com/acme/widgets.git/":   "acme/widgets",
+		"ssh://git@gitlab.com/group/sub/app.git": "group/sub/app",
+	}
+	for in, want := range cases {
+		got, err := RepoFromRemoteURL(in)
+		if err != nil || got != want {
+			t.Fatalf("RepoFromRemoteURL(%q) = %q, %v; want %q", in, got, err, want)
+		}
+	}
+	if _, err := RepoFromRemoteURL("/srv/git/widgets.git"); err == nil {
+		t.Fatal("expected error for a local path remote")
+	}
+}
+
+func TestClient_CreateGitLabMergeRequest(t *testing.T) {
+	var got map[string]any
+	var gotPath, gotToken string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath, gotToken = r.URL.EscapedPath(), r.Header.Get("PRIVATE-TOKEN")
+		_ = json.NewDecoder(r.Body).Decode(&got)
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(`{"iid": 3, "web_url": "https://gitlab.example/group/app/-/merge_requests/3"}`))
+	}))
+	defer srv.Close()
+
+	c := &Client{Kind: GitLab, BaseURL: srv.URL, Token: "glpat"}
+	u, err := c.Create(context.Background(), PullRequest{
+		Repo: "group/app", Head: "attractor/run/r1", Base: "main", Title: "Add widgets", Draft: true, Labels: []string{"kilroy", "bot"},
+	})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if u != "https://gitlab.example/group/app/-/merge_requests/3" || gotToken != "glpat" {
+		t.Fatalf("url=%q token=%q", u, gotToken)
+	}
+	if gotPath != "/projects/group%2Fapp/merge_requests" {
+		t.Fatalf("path: %s", gotPath)
+	}
+	if got["title"] != "Draft: Add widgets" || got["source_branch"] != "attractor/run/r1" || got["labels"] != "kilroy,bot" {
+		t.Fatalf("payload: %v", got)
+	}
+}
+
+func TestClient_CreateGiteaPullRequestResolvesLabels(t *testing.T) {
+	var got map[string]any
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "token tea" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/api/v1/repos/acme/widgets/labels":
+			_, _ = w.Write([]byte(`[{"id": 4, "name": "bug"}, {"id": 9, "name": "Kilroy"}]`))
+		case r.Method == http.MethodPost && r.URL.Path == "/api/v1/repos/acme/widgets/pulls":
+			_ = json.NewDecoder(r.Body).Decode(&got)
+			w.WriteHeader(http.StatusCreated)
+			_, _ = w.Write([]byte(`{"html_url": "https://gitea.example/acme/widgets/pulls/2"}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	c := &Client{Kind: Gitea, BaseURL: srv.URL + "/api/v1", Token: "tea"}
+	u, err := c.Create(context.Background(), PullRequest{Repo: "acme/widgets", Head: "h", Base: "main", Title: "t", Labels: []string{"kilroy"}})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if u != "https://gitea.example/acme/widgets/pulls/2" {
+		t.Fatalf("url: %q", u)
+	}
+	if ids, _ := got["labels"].([]any); len(ids) != 1 || ids[0] != float64(9) {
+		t.Fatalf("labels: %v", got["labels"])
+	}
+
+	if _, err := c.Create(context.Background(), PullRequest{Repo: "acme/widgets", Head: "h", Base: "main", Labels: []string{"nope"}}); err == nil {
+		t.Fatal("expected unknown label error")
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"fmt"
 	"os/exec"
+	"strconv"
 	"strings"
 )
 
@@ -146,7 +147,16 @@ func CommitAllowEmptyWithExcludes(worktreeDir, message string, excludes []string
 }
 
 func commitAllowEmpty(worktreeDir, message string) (string, error) {
-	_, _, err := runGit(worktreeDir, "commit", "--allow-empty", "-m", message)
+	return commit(worktreeDir, "--allow-empty", "-m", message)
+}
+
+// CommitStaged commits the index as is. It fails when nothing is staged.
+func CommitStaged(worktreeDir, message string) (string, error) {
+	return commit(worktreeDir, "-m", message)
+}
+
+func commit(worktreeDir string, args ...string) (string, error) {
+	_, _, err := runGit(worktreeDir, append([]string{"commit"}, args...)...)
 	if err != nil {
 		// If identity is missing, retry once with an explicit fallback committer identity
 		// (without mutating repo config).
@@ -155,9 +165,11 @@ func commitAllowEmpty(worktreeDir, message string) (string, error) {
 			strings.Contains(err.Error(), "unable to auto-detect email address") {
 			_, _, err = runGit(
 				worktreeDir,
-				"-c", "user.name=kilroy-attractor",
-				"-c", "user.email=kilroy-attractor@local",
-				"commit", "--allow-empty", "-m", message,
+				append([]string{
+					"-c", "user.name=kilroy-attractor",
+					"-c", "user.email=kilroy-attractor@local",
+					"commit",
+				}, args...)...,
 			)
 		}
 		if err != nil {
@@ -200,6 +212,71 @@ func DiffNameOnly(dir, baseRef string) ([]string, error) {
 	return files, nil
 }
 
+// DiffAddedLines returns, per file path, the line numbers that were added or
+// modified between baseRef and the working tree of dir (HEAD plus any
+// uncommitted edits), read from the hunk headers of a zero-context diff.
+// Deleted files are omitted.
+func DiffAddedLines(dir, baseRef string) (map[string][]int, error) {
+	out, _, err := runGit(dir, "-c", "core.quotePath=false", "diff", "-U0", "--no-color", "--no-ext-diff", "--src-prefix=a/", "--dst-prefix=b/", baseRef)
+	if err != nil {
+		return nil, err
+	}
+	files := map[string][]int{}
+	file := ""
+	for _, line := range strings.Split(out, "\n") {
+		switch {
+		case strings.HasPrefix(line, "+++ "):
+			// Git ends the path with a tab when it contains spaces.
+			file = strings.TrimPrefix(strings.TrimSuffix(strings.TrimPrefix(line, "+++ "), "\t"), "b/")
+			if file == "/dev/null" {
+				file = ""
+			}
+		case strings.HasPrefix(line, "@@ ") && file != "":
+			start, count, ok := parseHunkNewRange(line)
+			if !ok {
+				return nil, fmt.Errorf("git diff: bad hunk header %q", line)
+			}
+			for n := start; n < start+count; n++ {
+				files[file] = append(files[file], n)
+			}
+		}
+	}
+	return files, nil
+}
+
+// parseHunkNewRange reads the "+start[,count]" range of a hunk header like
+// "@@ -3,2 +3,4 @@ func f()". A missing count means one line.
+func parseHunkNewRange(header string) (start, count int, ok bool) {
+	fields := strings.Fields(header)
+	if len(fields) < 3 || !strings.HasPrefix(fields[2], "+") {
+		return 0, 0, false
+	}
+	startStr, countStr, hasCount := strings.Cut(strings.TrimPrefix(fields[2], "+"), ",")
+	start, err := strconv.Atoi(startStr)
+	if err != nil {
+		return 0, 0, false
+	}
+	count = 1
+	if hasCount {
+		if count, err = strconv.Atoi(countStr); err != nil {
+			return 0, 0, false
+		}
+	}
+	return start, count, true
+}
+
+// DiffStat returns `git diff --stat` output between two refs.
+func DiffStat(dir, fromRef, toRef string) (string, error) {
+	out, _, err := runGit(dir, "diff", "--stat", fromRef, toRef)
+	return out, err
+}
+
+// DiffPatch returns the full unified diff between two refs.
+func DiffPatch(dir, fromRef, toRef string) (string, error) {
+	out, _, err := runGit(dir, "diff", fromRef, toRef)
+	return out, err
+}
+
 func ensureUserIdentity(worktreeDir string) error {
 	name, _, err := runGit(worktreeDir, "config", "--get", "user.name")
 	if err != nil {
@@ -220,3 +297,108 @@ func ensureUserIdentity(worktreeDir string) error {
 	}
 	return nil
 }
+
+// SnapshotWorktree records the uncommitted changes in worktreeDir (including
+// untracked, non-ignored files) as a stash commit without touching the working
+// tree, and pins it under ref so it survives gc. It returns "" when the
+// worktree is clean.
+func SnapshotWorktree(worktreeDir, ref string) (string, error) {
+	clean, err := IsClean(worktreeDir)
+	if err != nil || clean {
+		return "", err
+	}
+	_ = ensureUserIdentity(worktreeDir)
+	if err := AddAll(worktreeDir); err != nil {
+		return "", err
+	}
+	out, _, err := runGit(worktreeDir, "stash", "create", "kilroy: interrupted worktree snapshot")
+	if err != nil {
+		return "", err
+	}
+	sha := strings.TrimSpace(out)
+	if sha == "" {
+		return "", nil
+	}
+	if _, _, err := runGit(worktreeDir, "update-ref", ref, sha); err != nil {
+		return "", err
+	}
+	return sha, nil
+}
+
+// ApplySnapshot re-applies a SnapshotWorktree commit onto worktreeDir.
+func ApplySnapshot(worktreeDir, sha string) error {
+	_, _, err := runGit(worktreeDir, "stash", "apply", sha)
+	return err
+}
+
+// ResolveCommit returns the commit SHA ref points to.
+func ResolveCommit(dir, ref string) (string, error) {
+	out, _, err := runGit(dir, "rev-parse", "--verify", "--quiet", ref+"^{commit}")
+	if err != nil {
+		return "", fmt.Errorf("unknown revision %q: %w", ref, err)
+	}
+	return strings.TrimSpace(out), nil
+}
+
+// BranchExists reports whether refs/heads/<branch> exists.
+func BranchExists(dir, branch string) bool {
+	_, _, err := runGit(dir, "show-ref", "--verify", "--quiet", "refs/heads/"+branch)
+	return err == nil
+}
+
+// AddDetachedWorktree checks out ref in a new worktree without creating a branch.
+func AddDetachedWorktree(repoDir, worktreeDir, ref string) error {
+	_, _, err := runGit(repoDir, "worktree", "add", "--detach", worktreeDir, ref)
+	return err
+}
+
+// Commit is one entry of a commit log.
+type Commit struct {
+	SHA     string
+	Subject string
+}
+
+// FirstParentLog lists the commits reachable from toRef but not fromRef,
+// following first parents only, oldest first.
+func FirstParentLog(dir, fromRef, toRef string) ([]Commit, error) {
+	out, _, err := runGit(dir, "log", "--first-parent", "--reverse", "--format=%H%x00%s", fromRef+".."+toRef)
+	if err != nil {
+		return nil, err
+	}
+	var commits []Commit
+	for _, line := range strings.Split(out, "\n") {
+		sha, subject, ok := strings.Cut(line, "\x00")
+		if !ok || strings.TrimSpace(sha) == "" {
+			continue
+		}
+		commits = append(commits, Commit{SHA: strings.TrimSpace(sha), Subject: subject})
+	}
+	return commits, nil
+}
+
+// DiffBinaryPaths returns a binary-safe patch between two refs limited to the
+// given pathspecs (all paths when none are given).
+func DiffBinaryPaths(dir, fromRef, toRef string, pathspecs ...string) (string, error) {
+	args := []string{"diff", "--binary", "--no-renames", fromRef, toRef}
+	if len(pathspecs) > 0 {
+		args = append(append(args, "--"), pathspecs...)
+	}
+	out, _, err := runGit(dir, args...)
+	return out, err
+}
+
+// ApplyPatchFile applies a patch to the index and working tree, falling back
+// to a three-way merge when the context does not match.
+func ApplyPatchFile(worktreeDir, patchPath string) error {
+	_, _, err := runGit(worktreeDir, "apply", "--index", "--3way", patchPath)
+	return err
+}
+
+// RemoteURL returns the fetch URL configured for remote.
+func RemoteURL(dir, remote string) (string, error) {
+	out, _, err := runGit(dir, "remote", "get-url", remote)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(out), nil
+}
@@ -1,6 +1,7 @@
 package gitutil
 
 import (
+	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -89,3 +90,65 @@ func TestDiffNameOnly_NoChanges(t *testing.T) {
 		t.Errorf("DiffNameOnly with no changes = %v, want []", files)
 	}
 }
+
+func TestDiffAddedLines(t *testing.T) {
+	dir := initTestRepo(t)
+	if err := os.WriteFile(filepath.Join(dir, "calc.go"), []byte("a\nb\nc\nd\ne\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := CommitAllowEmpty(dir, "add calc"); err != nil {
+		t.Fatal(err)
+	}
+	baseSHA, err := HeadSHA(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Modify line 2, insert two lines after line 4, add a file, delete one.
+	if err := os.WriteFile(filepath.Join(dir, "calc.go"), []byte("a\nB\nc\nd\nx\ny\ne\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "new file.txt"), []byte("1\n2\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(dir, "initial.txt")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := CommitAllowEmpty(dir, "edit"); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := DiffAddedLines(dir, baseSHA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || fmt.Sprint(got["calc.go"]) != "[2 5 6]" || fmt.Sprint(got["new file.txt"]) != "[1 2]" {
+		t.Errorf("DiffAddedLines = %v", got)
+	}
+}
+
+func TestSnapshotWorktree_ApplyAfterReset(t *testing.T) {
+	dir := initTestRepo(t)
+	if sha, err := SnapshotWorktree(dir, "refs/kilroy/test"); err != nil || sha != "" {
+		t.Fatalf("clean worktree: sha=%q err=%v", sha, err)
+	}
+	head, _ := HeadSHA(dir)
+	_ = os.WriteFile(filepath.Join(dir, "initial.txt"), []byte("edited"), 0o644)
+	_ = os.WriteFile(filepath.Join(dir, "new.txt"), []byte("new"), 0o644)
+	sha, err := SnapshotWorktree(dir, "refs/kilroy/test")
+	if err != nil || sha == "" {
+		t.Fatalf("SnapshotWorktree: sha=%q err=%v", sha, err)
+	}
+	if err := ResetHard(dir, head); err != nil {
+		t.Fatal(err)
+	}
+	_ = os.Remove(filepath.Join(dir, "new.txt"))
+	if err := ApplySnapshot(dir, "refs/kilroy/test"); err != nil {
+		t.Fatalf("ApplySnapshot: %v", err)
+	}
+	for file, want := range map[string]string{"initial.txt": "edited", "new.txt": "new"} {
+		if b, _ := os.ReadFile(filepath.Join(dir, file)); string(b) != want {
+			t.Fatalf("%s = %q want %q", file, b, want)
+		}
+	}
+}
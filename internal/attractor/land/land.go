@@ -0,0 +1,363 @@
+// Package land rewrites an Attractor run branch, which carries one checkpoint
+// commit per node, into a branch of reviewable commits on top of a target
+// branch: either one squashed commit or one commit per codergen stage.
+package land
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/danshapiro/kilroy/internal/attractor/dot"
+	"github.com/danshapiro/kilroy/internal/attractor/gitutil"
+	"github.com/danshapiro/kilroy/internal/attractor/model"
+	"github.com/danshapiro/kilroy/internal/attractor/rundiff"
+	"github.com/danshapiro/kilroy/internal/attractor/runtime"
+	"github.com/danshapiro/kilroy/internal/attractor/textutil"
+)
+
+type Strategy string
+
+const (
+	StrategySquash   Strategy = "squash"
+	StrategyPerStage Strategy = "per-stage"
+)
+
+func ParseStrategy(s string) (Strategy, error) {
+	switch Strategy(strings.ToLower(strings.TrimSpace(s))) {
+	case "", StrategySquash:
+		return StrategySquash, nil
+	case StrategyPerStage:
+		return StrategyPerStage, nil
+	default:
+		return "", fmt.Errorf("unknown strategy %q (want squash|per-stage)", s)
+	}
+}
+
+// excludedPaths are run-scoped files that never belong on a landed branch.
+var excludedPaths = []string{".", ":(exclude).ai/runs"}
+
+type Options struct {
+	LogsRoot string
+	// RepoPath overrides the repository recorded in the run manifest.
+	RepoPath string
+	// Onto is the branch or commit the landed commits are based on.
+	Onto string
+	// OntoBranchRemote, when set, requires Onto to name a branch, local or
+	// of this remote (e.g. origin/main), and reports its name in
+	// Result.OntoBranch. A pull request needs a branch to target.
+	OntoBranchRemote string
+	// Branch is the branch to create (default attractor/land/<run_id>).
+	Branch   string
+	Strategy Strategy
+	// Force replaces Branch if it already exists.
+	Force bool
+	// AllowFailed lands runs that did not finish with status success.
+	AllowFailed bool
+	// Drafter writes the commit messages; nil uses NotesDrafter.
+	Drafter Drafter
+}
+
+// Stage is a set of consecutive checkpoint commits that land as one commit.
+type Stage struct {
+	// NodeIDs lists the nodes whose checkpoints are folded in, in run order;
+	// for per-stage landing the first is the codergen node that owns the
+	// commit.
+	NodeIDs []string
+	FromSHA string
+	ToSHA   string
+}
+
+type LandedCommit struct {
+	SHA     string   `json:"sha"`
+	Subject string   `json:"subject"`
+	NodeIDs []string `json:"node_ids"`
+}
+
+type Result struct {
+	RunID    string `json:"run_id"`
+	Goal     string `json:"goal,omitempty"`
+	RepoPath string `json:"repo_path"`
+	Branch   string `json:"branch"`
+	Onto     string `json:"onto"`
+	OntoSHA  string `json:"onto_sha"`
+	// OntoBranch is Onto as a branch name; see Options.OntoBranchRemote.
+	OntoBranch string         `json:"onto_branch,omitempty"`
+	Strategy   Strategy       `json:"strategy"`
+	Commits    []LandedCommit `json:"commits"`
+	Warnings   []string       `json:"warnings,omitempty"`
+}
+
+// Land builds the landed branch in a temporary worktree; the repository's
+// checked out branch and the run branch are left untouched.
+func Land(ctx context.Context, opts Options) (*Result, error) {
+	if strings.TrimSpace(opts.Onto) == "" {
+		return nil, fmt.Errorf("--onto is required")
+	}
+	strategy, err := ParseStrategy(string(opts.Strategy))
+	if err != nil {
+		return nil, err
+	}
+	run, err := rundiff.LoadRun(opts.LogsRoot)
+	if err != nil {
+		return nil, err
+	}
+	if run.FinalStatus != string(runtime.FinalSuccess) && !opts.AllowFailed {
+		status := run.FinalStatus
+		if status == "" {
+			status = "unfinished"
+		}
+		return nil, fmt.Errorf("run %s did not succeed (status=%s); pass --allow-failed to land it anyway", run.RunID, status)
+	}
+	repo := strings.TrimSpace(opts.RepoPath)
+	if repo == "" {
+		repo = run.RepoPath
+	}
+	if repo == "" || !gitutil.IsRepo(repo) {
+		return nil, fmt.Errorf("repository %q not found; pass --repo", repo)
+	}
+	if run.BaseSHA == "" {
+		return nil, fmt.Errorf("%s: manifest has no base_sha", opts.LogsRoot)
+	}
+	tip := run.FinalCommitSHA
+	if tip == "" {
+		tip = run.RunBranch
+	}
+	tipSHA, err := gitutil.ResolveCommit(repo, tip)
+	if err != nil {
+		return nil, err
+	}
+	ontoSHA, err := gitutil.ResolveCommit(repo, opts.Onto)
+	if err != nil {
+		return nil, err
+	}
+	ontoBranch := ""
+	if remote := strings.TrimSpace(opts.OntoBranchRemote); remote != "" {
+		if ontoBranch, err = branchName(repo, remote, opts.Onto); err != nil {
+			return nil, err
+		}
+	}
+	branch := strings.TrimSpace(opts.Branch)
+	if branch == "" {
+		branch = "attractor/land/" + run.RunID
+	}
+	if branch == strings.TrimSpace(opts.Onto) || branch == run.RunBranch {
+		return nil, fmt.Errorf("--branch %s must differ from the --onto and run branches", branch)
+	}
+	if gitutil.BranchExists(repo, branch) && !opts.Force {
+		return nil, fmt.Errorf("branch %s already exists; pass --force to replace it", branch)
+	}
+
+	g := loadGraph(opts.LogsRoot)
+	var stages []Stage
+	if strategy == StrategyPerStage {
+		stages, err = perStageStages(repo, run.BaseSHA, tipSHA, codergenNodes(g))
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		stages = []Stage{{NodeIDs: run.NodeOrder, FromSHA: run.BaseSHA, ToSHA: tipSHA}}
+	}
+
+	tmp, err := os.MkdirTemp("", "kilroy-land-")
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = os.RemoveAll(tmp) }()
+	wt := filepath.Join(tmp, "worktree")
+	if err := gitutil.AddDetachedWorktree(repo, wt, ontoSHA); err != nil {
+		return nil, err
+	}
+	defer func() { _ = gitutil.RemoveWorktree(repo, wt) }()
+
+	drafter := opts.Drafter
+	if drafter == nil {
+		drafter = NotesDrafter{}
+	}
+	res := &Result{RunID: run.RunID, RepoPath: repo, Branch: branch, Onto: opts.Onto, OntoSHA: ontoSHA, OntoBranch: ontoBranch, Strategy: strategy}
+	if g != nil {
+		res.Goal = strings.TrimSpace(g.Attrs["goal"])
+	}
+	for i, st := range stages {
+		patch, err := gitutil.DiffBinaryPaths(repo, st.FromSHA, st.ToSHA, excludedPaths...)
+		if err != nil {
+			return nil, err
+		}
+		if strings.TrimSpace(patch) == "" {
+			continue
+		}
+		patchPath := filepath.Join(tmp, fmt.Sprintf("stage-%03d.patch", i))
+		if err := os.WriteFile(patchPath, []byte(patch), 0o644); err != nil {
+			return nil, err
+		}
+		if err := gitutil.ApplyPatchFile(wt, patchPath); err != nil {
+			return nil, fmt.Errorf("changes from %s do not apply onto %s: %w", strings.Join(st.NodeIDs, ", "), opts.Onto, err)
+		}
+		stat, _ := gitutil.DiffStat(repo, st.FromSHA, st.ToSHA)
+		change := Change{
+			RunID:    run.RunID,
+			Goal:     res.Goal,
+			Strategy: strategy,
+			Stages:   stageNotes(opts.LogsRoot, st.NodeIDs),
+			DiffStat: stat,
+		}
+		msg, err := drafter.Draft(ctx, change)
+		if err != nil || strings.TrimSpace(msg) == "" {
+			if err != nil {
+				res.Warnings = append(res.Warnings, fmt.Sprintf("drafting commit message for %s: %v; using stage notes", strings.Join(st.NodeIDs, ", "), err))
+			}
+			msg, _ = NotesDrafter{}.Draft(ctx, change)
+		}
+		msg = withRunTrailer(msg, run.RunID)
+		sha, err := gitutil.CommitStaged(wt, msg)
+		if err != nil {
+			return nil, err
+		}
+		res.Commits = append(res.Commits, LandedCommit{SHA: sha, Subject: textutil.FirstLine(msg), NodeIDs: st.NodeIDs})
+	}
+	if len(res.Commits) == 0 {
+		return nil, fmt.Errorf("run %s made no changes outside .ai/runs", run.RunID)
+	}
+	if err := gitutil.CreateBranchAt(repo, branch, res.Commits[len(res.Commits)-1].SHA); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+var checkpointSubjectRE = regexp.MustCompile(`^attractor\([^)]*\): (\S+) \(([^)]*)\)$`)
+
+// perStageStages groups the run's checkpoint commits into one stage per
+// codergen node; back-to-back visits of the same node (a fix loop) share one.
+// Changes made by other nodes (tool nodes, fan-in merges) are folded into the
+// preceding stage, or the first one when they come before any codergen node.
+// Checkpoints without changes outside .ai/runs are dropped.
+func perStageStages(repo, baseSHA, tipSHA string, codergen map[string]bool) ([]Stage, error) {
+	commits, err := gitutil.FirstParentLog(repo, baseSHA, tipSHA)
+	if err != nil {
+		return nil, err
+	}
+	var stages []Stage
+	var leading *Stage
+	from := baseSHA
+	for i, c := range commits {
+		nodeID := ""
+		if m := checkpointSubjectRE.FindStringSubmatch(c.Subject); m != nil {
+			nodeID = m[1]
+		} else if i < len(commits)-1 {
+			// A commit a handler made before its checkpoint; it lands with
+			// that checkpoint.
+			continue
+		}
+		seg := Stage{FromSHA: from, ToSHA: c.SHA}
+		from = c.SHA
+		if nodeID != "" {
+			seg.NodeIDs = []string{nodeID}
+		}
+		patch, err := gitutil.DiffBinaryPaths(repo, seg.FromSHA, seg.ToSHA, excludedPaths...)
+		if err != nil {
+			return nil, err
+		}
+		if strings.TrimSpace(patch) == "" {
+			continue
+		}
+		switch {
+		case nodeID != "" && (codergen == nil || codergen[nodeID]):
+			if n := len(stages); n > 0 && stages[n-1].NodeIDs[0] == nodeID {
+				// Another visit of the same stage, e.g. a fix loop.
+				stages[n-1].ToSHA = seg.ToSHA
+				continue
+			}
+			if leading != nil {
+				seg.FromSHA = leading.FromSHA
+				seg.NodeIDs = append(seg.NodeIDs, leading.NodeIDs...)
+				leading = nil
+			}
+			stages = append(stages, seg)
+		case len(stages) > 0:
+			last := &stages[len(stages)-1]
+			last.ToSHA = seg.ToSHA
+			last.NodeIDs = appendUnique(last.NodeIDs, seg.NodeIDs...)
+		case leading == nil:
+			leading = &seg
+		default:
+			leading.ToSHA = seg.ToSHA
+			leading.NodeIDs = appendUnique(leading.NodeIDs, seg.NodeIDs...)
+		}
+	}
+	if leading != nil {
+		// Only non-codergen nodes changed files.
+		stages = append(stages, *leading)
+	}
+	return stages, nil
+}
+
+func loadGraph(logsRoot string) *model.Graph {
+	b, err := os.ReadFile(filepath.Join(logsRoot, "graph.dot"))
+	if err != nil {
+		return nil
+	}
+	g, err := dot.Parse(b)
+	if err != nil {
+		return nil
+	}
+	return g
+}
+
+// codergenNodes returns the IDs of codergen nodes in g, or nil when the graph
+// is unavailable, in which case every node with changes gets its own commit.
+func codergenNodes(g *model.Graph) map[string]bool {
+	if g == nil {
+		return nil
+	}
+	out := map[string]bool{}
+	for id, n := range g.Nodes {
+		if n != nil && n.HandlerType() == "codergen" {
+			out[id] = true
+		}
+	}
+	return out
+}
+
+func withRunTrailer(msg, runID string) string {
+	msg = strings.TrimRight(msg, "\n")
+	if runID == "" || strings.Contains(msg, "Kilroy-Run:") {
+		return msg + "\n"
+	}
+	return msg + "\n\nKilroy-Run: " + runID + "\n"
+}
+
+func appendUnique(list []string, vals ...string) []string {
+	for _, v := range vals {
+		found := false
+		for _, have := range list {
+			if have == v {
+				found = true
+				break
+			}
+		}
+		if !found {
+			list = append(list, v)
+		}
+	}
+	return list
+}
+
+// branchName returns the name of the branch ref refers to: a local branch, or
+// a branch of remote given as <remote>/<branch>. Commits, tags and other remotes' branches
+// have no branch on remote to target.
+func branchName(repo, remote, ref string) (string, error) {
+	ref = strings.TrimSpace(ref)
+	if name := strings.TrimPrefix(ref, "refs/heads/"); gitutil.BranchExists(repo, name) {
+		return name, nil
+	}
+	tracking := strings.TrimPrefix(ref, "refs/remotes/")
+	if name, ok := strings.CutPrefix(tracking, remote+"/"); ok && name != "" {
+		if _, err := gitutil.ResolveCommit(repo, "refs/remotes/"+tracking); err == nil {
+			return name, nil
+		}
+	}
+	return "", fmt.Errorf("--onto %s is not a branch; a pull request needs a local branch or %s/<branch>", ref, remote)
+}
@@ -0,0 +1,213 @@
+package land
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func git(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+	cmd.Env = append(os.Environ(),
+		"GIT_AUTHOR_NAME=test",
+		"GIT_AUTHOR_EMAIL=test@test",
+		"GIT_COMMITTER_NAME=test",
+		"GIT_COMMITTER_EMAIL=test@test",
+	)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %v: %v\n%s", args, err, out)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func writeJSON(t *testing.T, path string, v any) {
+	t.Helper()
+	b, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, path, string(b))
+}
+
+// landTestRun builds a repo whose run branch has checkpoint commits for
+// plan (notes only under .ai/runs), impl (codergen), fmt (tool), fix
+// (codergen), a second fix visit and exit, and a logs root describing it.
+// main gains an unrelated commit after the run started.
+func landTestRun(t *testing.T) (repo, logsRoot string) {
+	t.Helper()
+	repo = t.TempDir()
+	git(t, repo, "init", "-b", "main")
+	writeFile(t, filepath.Join(repo, "README.md"), "hello\n")
+	git(t, repo, "add", "-A")
+	git(t, repo, "commit", "-m", "initial")
+	base := git(t, repo, "rev-parse", "HEAD")
+
+	git(t, repo, "switch", "-c", "attractor/run/r1")
+	checkpoint := func(node, status string, files map[string]string) {
+		for p, c := range files {
+			writeFile(t, filepath.Join(repo, p), c)
+		}
+		git(t, repo, "add", "-A")
+		git(t, repo, "commit", "--allow-empty", "-m", "attractor(r1): "+node+" ("+status+")")
+	}
+	checkpoint("start", "success", nil)
+	checkpoint("plan", "success", map[string]string{".ai/runs/r1/plan.md": "plan"})
+	checkpoint("impl", "success", map[string]string{"widget.go": "package widget\n"})
+	checkpoint("fmt", "success", map[string]string{"widget.go": "package widget\n\n// Widget.\n"})
+	checkpoint("fix", "success", map[string]string{"widget_test.go": "package widget\n"})
+	checkpoint("fix", "success", map[string]string{"widget_test.go": "package widget\n\n// test\n"})
+	checkpoint("exit", "success", map[string]string{".ai/runs/r1/final.md": "done"})
+	tip := git(t, repo, "rev-parse", "HEAD")
+
+	git(t, repo, "switch", "main")
+	writeFile(t, filepath.Join(repo, "CHANGELOG.md"), "unrelated\n")
+	git(t, repo, "add", "-A")
+	git(t, repo, "commit", "-m", "unrelated change on main")
+
+	logsRoot = t.TempDir()
+	writeJSON(t, filepath.Join(logsRoot, "manifest.json"), map[string]any{
+		"run_id": "r1", "repo_path": repo, "base_sha": base, "run_branch": "attractor/run/r1",
+	})
+	writeJSON(t, filepath.Join(logsRoot, "final.json"), map[string]any{
+		"status": "success", "run_id": "r1", "final_git_commit_sha": tip,
+	})
+	var progress strings.Builder
+	for _, n := range []string{"start", "plan", "impl", "fmt", "fix", "exit"} {
+		b, _ := json.Marshal(map[string]any{"event": "stage_attempt_start", "node_id": n, "attempt": 1})
+		progress.Write(b)
+		progress.WriteString("\n")
+	}
+	writeFile(t, filepath.Join(logsRoot, "progress.ndjson"), progress.String())
+	writeFile(t, filepath.Join(logsRoot, "graph.dot"), `digraph G {
+  graph [goal="Add a widget package"]
+  start [shape=Mdiamond]
+  exit [shape=Msquare]
+  plan [shape=box]
+  impl [shape=box]
+  fmt [shape=parallelogram, tool_command="gofmt -w ."]
+  fix [shape=box]
+  start -> plan -> impl -> fmt -> fix -> exit
+}`)
+	writeJSON(t, filepath.Join(logsRoot, "impl", "status.json"), map[string]any{"status": "success", "notes": "Added the widget package"})
+	writeJSON(t, filepath.Join(logsRoot, "fix", "status.json"), map[string]any{"status": "success", "notes": "Added widget tests"})
+	return repo, logsRoot
+}
+
+func TestLand_SquashExcludesRunFilesAndRebasesOntoTarget(t *testing.T) {
+	repo, logsRoot := landTestRun(t)
+	res, err := Land(context.Background(), Options{LogsRoot: logsRoot, Onto: "main"})
+	if err != nil {
+		t.Fatalf("Land: %v", err)
+	}
+	if res.Branch != "attractor/land/r1" || len(res.Commits) != 1 {
+		t.Fatalf("result: %+v", res)
+	}
+	if got := git(t, repo, "rev-list", "--count", "main..attractor/land/r1"); got != "1" {
+		t.Fatalf("landed commits: %s", got)
+	}
+	if got := git(t, repo, "rev-parse", "attractor/land/r1~1"); got != git(t, repo, "rev-parse", "main") {
+		t.Fatalf("landed branch is not based on main")
+	}
+	files := git(t, repo, "ls-tree", "-r", "--name-only", "attractor/land/r1")
+	if strings.Contains(files, ".ai/runs") || !strings.Contains(files, "widget_test.go") || !strings.Contains(files, "CHANGELOG.md") {
+		t.Fatalf("landed tree:\n%s", files)
+	}
+	msg := git(t, repo, "log", "-1", "--format=%B", "attractor/land/r1")
+	if !strings.HasPrefix(msg, "Add a widget package") || !strings.Contains(msg, "impl: Added the widget package") || !strings.Contains(msg, "Kilroy-Run: r1") {
+		t.Fatalf("message:\n%s", msg)
+	}
+	// The checked out branch is untouched.
+	if got := git(t, repo, "rev-parse", "--abbrev-ref", "HEAD"); got != "main" {
+		t.Fatalf("HEAD moved to %s", got)
+	}
+
+	if _, err := Land(context.Background(), Options{LogsRoot: logsRoot, Onto: "main"}); err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Fatalf("expected existing-branch error, got %v", err)
+	}
+}
+
+func TestLand_OntoBranchRemoteRequiresABranch(t *testing.T) {
+	repo, logsRoot := landTestRun(t)
+	git(t, repo, "update-ref", "refs/remotes/origin/main", "main")
+	git(t, repo, "update-ref", "refs/remotes/upstream/main", "main")
+	for onto, want := range map[string]string{"main": "main", "refs/heads/main": "main", "origin/main": "main"} {
+		res, err := Land(context.Background(), Options{LogsRoot: logsRoot, Onto: onto, OntoBranchRemote: "origin", Force: true})
+		if err != nil {
+			t.Fatalf("--onto %s: %v", onto, err)
+		}
+		if res.OntoBranch != want {
+			t.Fatalf("--onto %s: OntoBranch=%q want %q", onto, res.OntoBranch, want)
+		}
+	}
+	sha := git(t, repo, "rev-parse", "main")
+	for _, onto := range []string{sha, "main~1", "upstream/main"} {
+		if _, err := Land(context.Background(), Options{LogsRoot: logsRoot, Onto: onto, OntoBranchRemote: "origin", Force: true}); err == nil || !strings.Contains(err.Error(), "is not a branch") {
+			t.Fatalf("--onto %s: want a not-a-branch error, got %v", onto, err)
+		}
+	}
+}
+
+func TestLand_PerStageCommitsPerCodergenStage(t *testing.T) {
+	repo, logsRoot := landTestRun(t)
+	res, err := Land(context.Background(), Options{LogsRoot: logsRoot, Onto: "main", Branch: "feature/widget", Strategy: StrategyPerStage})
+	if err != nil {
+		t.Fatalf("Land: %v", err)
+	}
+	// plan only touched .ai/runs; fmt folds into impl; both fix visits share a commit.
+	if len(res.Commits) != 2 {
+		t.Fatalf("commits: %+v", res.Commits)
+	}
+	if got := strings.Join(res.Commits[0].NodeIDs, ","); got != "impl,fmt" {
+		t.Fatalf("first commit nodes: %s", got)
+	}
+	if res.Commits[0].Subject != "impl: Added the widget package" || res.Commits[1].Subject != "fix: Added widget tests" {
+		t.Fatalf("subjects: %q, %q", res.Commits[0].Subject, res.Commits[1].Subject)
+	}
+	if got := git(t, repo, "show", "feature/widget~1:widget.go"); !strings.Contains(got, "// Widget.") {
+		t.Fatalf("first commit widget.go:\n%s", got)
+	}
+	if got := git(t, repo, "show", "feature/widget:widget_test.go"); !strings.Contains(got, "// test") {
+		t.Fatalf("second commit widget_test.go:\n%s", got)
+	}
+}
+
+type failingDrafter struct{}
+
+func (failingDrafter) Draft(context.Context, Change) (string, error) {
+	return "", os.ErrDeadlineExceeded
+}
+
+func TestLand_FallsBackToNotesWhenDrafterFails(t *testing.T) {
+	_, logsRoot := landTestRun(t)
+	res, err := Land(context.Background(), Options{LogsRoot: logsRoot, Onto: "main", Drafter: failingDrafter{}})
+	if err != nil {
+		t.Fatalf("Land: %v", err)
+	}
+	if len(res.Warnings) != 1 || res.Commits[0].Subject != "Add a widget package" {
+		t.Fatalf("result: %+v", res)
+	}
+}
+
+func TestLand_RefusesFailedRun(t *testing.T) {
+	_, logsRoot := landTestRun(t)
+	writeJSON(t, filepath.Join(logsRoot, "final.json"), map[string]any{"status": "fail", "run_id": "r1"})
+	if _, err := Land(context.Background(), Options{LogsRoot: logsRoot, Onto: "main"}); err == nil || !strings.Contains(err.Error(), "--allow-failed") {
+		t.Fatalf("expected failed-run error, got %v", err)
+	}
+}
@@ -0,0 +1,156 @@
+package land
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/danshapiro/kilroy/internal/attractor/runstate"
+	"github.com/danshapiro/kilroy/internal/attractor/runtime"
+	"github.com/danshapiro/kilroy/internal/attractor/textutil"
+	"github.com/danshapiro/kilroy/internal/llm"
+)
+
+// StageNote is what a node reported about its last visit in status.json.
+type StageNote struct {
+	NodeID string `json:"node_id"`
+	Status string `json:"status,omitempty"`
+	Notes  string `json:"notes,omitempty"`
+}
+
+// Change describes one commit to be written.
+type Change struct {
+	RunID    string
+	Goal     string
+	Strategy Strategy
+	Stages   []StageNote
+	DiffStat string
+}
+
+// Drafter writes a commit message for a change.
+type Drafter interface {
+	Draft(ctx context.Context, c Change) (string, error)
+}
+
+// NotesDrafter builds the message from stage notes without calling a model.
+type NotesDrafter struct{}
+
+func (NotesDrafter) Draft(_ context.Context, c Change) (string, error) {
+	subject := ""
+	if c.Strategy == StrategyPerStage && len(c.Stages) > 0 {
+		subject = c.Stages[0].NodeID
+		if n := textutil.FirstLine(c.Stages[0].Notes); n != "" {
+			subject += ": " + n
+		}
+	} else {
+		subject = textutil.FirstLine(c.Goal)
+	}
+	if subject == "" {
+		subject = "Land attractor run " + c.RunID
+	}
+	var b strings.Builder
+	b.WriteString(textutil.Truncate(subject, 72))
+	b.WriteString("\n")
+	wrote := false
+	for _, st := range c.Stages {
+		notes := strings.TrimSpace(st.Notes)
+		if notes == "" {
+			continue
+		}
+		if !wrote {
+			b.WriteString("\n")
+			wrote = true
+		}
+		fmt.Fprintf(&b, "- %s: %s\n", st.NodeID, strings.Join(strings.Fields(notes), " "))
+	}
+	return b.String(), nil
+}
+
+// LLMDrafter asks a model to write the message from the goal, stage notes and
+// diffstat.
+type LLMDrafter struct {
+	Client   *llm.Client
+	Provider string
+	Model    string
+}
+
+func (d LLMDrafter) Draft(ctx context.Context, c Change) (string, error) {
+	if d.Client == nil {
+		return "", fmt.Errorf("no LLM client")
+	}
+	resp, err := d.Client.Complete(ctx, llm.Request{
+		Provider: d.Provider,
+		Model:    d.Model,
+		Messages: []llm.Message{
+			llm.System("You write git commit messages. Reply with the message only: an imperative subject line of at most 72 characters, a blank line, then a short body wrapped at 72 columns explaining what changed and why. No markdown headings, no code fences."),
+			llm.User(draftPrompt(c)),
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(stripFences(resp.Text())), nil
+}
+
+func draftPrompt(c Change) string {
+	var b strings.Builder
+	if c.Goal != "" {
+		fmt.Fprintf(&b, "Pipeline goal:\n%s\n\n", c.Goal)
+	}
+	if c.Strategy == StrategyPerStage {
+		b.WriteString("This commit holds the changes of one pipeline stage.\n\n")
+	} else {
+		b.WriteString("This commit holds all changes of the pipeline run.\n\n")
+	}
+	b.WriteString("Stage notes:\n")
+	for _, st := range c.Stages {
+		notes := strings.TrimSpace(st.Notes)
+		if notes == "" {
+			notes = "(none)"
+		}
+		fmt.Fprintf(&b, "- %s [%s]: %s\n", st.NodeID, st.Status, notes)
+	}
+	if s := strings.TrimSpace(c.DiffStat); s != "" {
+		fmt.Fprintf(&b, "\nDiffstat:\n%s\n", s)
+	}
+	return b.String()
+}
+
+// stageNotes reads status.json for each node, preferring the newest
+// loop_restart segment that has one.
+func stageNotes(logsRoot string, nodeIDs []string) []StageNote {
+	segments := runstate.RestartSegments(logsRoot)
+	out := make([]StageNote, 0, len(nodeIDs))
+	for _, id := range nodeIDs {
+		note := StageNote{NodeID: id}
+		for i := len(segments) - 1; i >= 0; i-- {
+			b, err := os.ReadFile(filepath.Join(segments[i], id, "status.json"))
+			if err != nil {
+				continue
+			}
+			o, err := runtime.DecodeOutcomeJSON(b)
+			if err != nil {
+				continue
+			}
+			note.Status = string(o.Status)
+			note.Notes = strings.TrimSpace(o.Notes)
+			break
+		}
+		out = append(out, note)
+	}
+	return out
+}
+
+func stripFences(s string) string {
+	s = strings.TrimSpace(s)
+	if !strings.HasPrefix(s, "```") {
+		return s
+	}
+	s = strings.TrimPrefix(s, "```")
+	if i := strings.Index(s, "\n"); i >= 0 {
+		s = s[i+1:]
+	}
+	return strings.TrimSuffix(strings.TrimSpace(s), "```")
+}
@@ -119,6 +119,41 @@ func (n *Node) TypeOverride() string {
 	return n.Attr("type", "")
 }
 
+// HandlerType is the node's explicit type attribute, or the handler type its
+// shape maps to.
+func (n *Node) HandlerType() string {
+	if t := strings.TrimSpace(n.TypeOverride()); t != "" {
+		return t
+	}
+	return ShapeHandlerType(n.Shape())
+}
+
+// ShapeHandlerType maps a node shape to its default handler type.
+func ShapeHandlerType(shape string) string {
+	switch shape {
+	case "Mdiamond", "circle":
+		return "start"
+	case "Msquare", "doublecircle":
+		return "exit"
+	case "box":
+		return "codergen"
+	case "hexagon":
+		return "wait.human"
+	case "diamond":
+		return "conditional"
+	case "component":
+		return "parallel"
+	case "tripleoctagon":
+		return "parallel.fan_in"
+	case "parallelogram":
+		return "tool"
+	case "house":
+		return "stack.manager_loop"
+	default:
+		return "codergen"
+	}
+}
+
 func (n *Node) Label() string {
 	lbl := n.Attr("label", "")
 	if lbl == "" {
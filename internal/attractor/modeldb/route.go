@@ -0,0 +1,173 @@
+package modeldb
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/danshapiro/kilroy/internal/modelmeta"
+)
+
+// Requirements describe what a node needs from a model when it leaves the
+// choice to the engine (llm_model="auto").
+type Requirements struct {
+	Tools     bool
+	Reasoning bool
+	Vision    bool
+	// MinContext is the smallest acceptable context window in tokens.
+	MinContext int
+	// MaxCostPerMTok caps the higher of a model's input and output price, in
+	// USD per million tokens. Zero means no cap.
+	MaxCostPerMTok float64
+}
+
+// ParseRequirements parses the model.requires, model.min_context and
+// model.max_cost_per_mtok node attributes. Empty values impose nothing.
+func ParseRequirements(requires, minContext, maxCostPerMTok string) (Requirements, error) {
+	var req Requirements
+	for _, raw := range strings.Split(requires, ",") {
+		switch strings.ToLower(strings.TrimSpace(raw)) {
+		case "":
+		case "tools":
+			req.Tools = true
+		case "reasoning":
+			req.Reasoning = true
+		case "vision":
+			req.Vision = true
+		default:
+			return Requirements{}, fmt.Errorf("model.requires: unknown capability %q (want tools|reasoning|vision)", strings.TrimSpace(raw))
+		}
+	}
+	if s := strings.TrimSpace(minContext); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			return Requirements{}, fmt.Errorf("model.min_context: %q is not a non-negative integer", s)
+		}
+		req.MinContext = n
+	}
+	if s := strings.TrimSpace(maxCostPerMTok); s != "" {
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil || f < 0 {
+			return Requirements{}, fmt.Errorf("model.max_cost_per_mtok: %q is not a non-negative number", s)
+		}
+		req.MaxCostPerMTok = f
+	}
+	return req, nil
+}
+
+func (r Requirements) String() string {
+	var parts []string
+	var caps []string
+	if r.Tools {
+		caps = append(caps, "tools")
+	}
+	if r.Reasoning {
+		caps = append(caps, "reasoning")
+	}
+	if r.Vision {
+		caps = append(caps, "vision")
+	}
+	if len(caps) > 0 {
+		parts = append(parts, "requires="+strings.Join(caps, ","))
+	}
+	if r.MinContext > 0 {
+		parts = append(parts, fmt.Sprintf("min_context=%d", r.MinContext))
+	}
+	if r.MaxCostPerMTok > 0 {
+		parts = append(parts, "max_cost_per_mtok="+strconv.FormatFloat(r.MaxCostPerMTok, 'f', -1, 64))
+	}
+	if len(parts) == 0 {
+		return "none"
+	}
+	return strings.Join(parts, " ")
+}
+
+// RouteChoice is the model Route picked.
+type RouteChoice struct {
+	Provider string
+	// Model is the provider-relative model ID to put in llm_model.
+	Model             string
+	CatalogID         string
+	ContextWindow     int
+	InputCostPerMTok  float64
+	OutputCostPerMTok float64
+}
+
+// Route returns the cheapest catalog model from one of providers that meets
+// req. Cost is the sum of the input and output price per million tokens; ties
+// go to the larger context window, then to the catalog ID. Models without
+// pricing and provider variants (IDs with a ':' suffix such as ':free') are
+// never chosen. The accept func, when non-nil, can veto a candidate.
+func Route(c *Catalog, providers []string, req Requirements, accept func(provider, model string) bool) (RouteChoice, error) {
+	if c == nil || len(c.Models) == 0 {
+		return RouteChoice{}, fmt.Errorf("no model catalog available")
+	}
+	allowed := map[string]bool{}
+	for _, p := range providers {
+		if p = modelmeta.NormalizeProvider(p); p != "" {
+			allowed[p] = true
+		}
+	}
+	if len(allowed) == 0 {
+		return RouteChoice{}, fmt.Errorf("no providers to route to")
+	}
+
+	var candidates []RouteChoice
+	for id, entry := range c.Models {
+		if strings.Contains(id, ":") || (entry.Mode != "" && entry.Mode != "chat") {
+			continue
+		}
+		provider := modelmeta.NormalizeProvider(entry.Provider)
+		if provider == "" {
+			provider = inferProviderFromModelID(id)
+		}
+		if !allowed[provider] {
+			continue
+		}
+		if entry.InputCostPerToken == nil || entry.OutputCostPerToken == nil || *entry.InputCostPerToken < 0 || *entry.OutputCostPerToken < 0 {
+			continue
+		}
+		if (req.Tools && !entry.SupportsTools) || (req.Reasoning && !entry.SupportsReasoning) || (req.Vision && !entry.SupportsVision) {
+			continue
+		}
+		if req.MinContext > 0 && entry.ContextWindow < req.MinContext {
+			continue
+		}
+		choice := RouteChoice{
+			Provider:          provider,
+			Model:             providerRelativeModelID(provider, id),
+			CatalogID:         id,
+			ContextWindow:     entry.ContextWindow,
+			InputCostPerMTok:  *entry.InputCostPerToken * 1e6,
+			OutputCostPerMTok: *entry.OutputCostPerToken * 1e6,
+		}
+		if req.MaxCostPerMTok > 0 && (choice.InputCostPerMTok > req.MaxCostPerMTok || choice.OutputCostPerMTok > req.MaxCostPerMTok) {
+			continue
+		}
+		if accept != nil && !accept(choice.Provider, choice.Model) {
+			continue
+		}
+		candidates = append(candidates, choice)
+	}
+	if len(candidates) == 0 {
+		names := make([]string, 0, len(allowed))
+		for p := range allowed {
+			names = append(names, p)
+		}
+		sort.Strings(names)
+		return RouteChoice{}, fmt.Errorf("no catalog model from providers [%s] satisfies %s", strings.Join(names, ", "), req)
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		ca, cb := a.InputCostPerMTok+a.OutputCostPerMTok, b.InputCostPerMTok+b.OutputCostPerMTok
+		if ca != cb {
+			return ca < cb
+		}
+		if a.ContextWindow != b.ContextWindow {
+			return a.ContextWindow > b.ContextWindow
+		}
+		return a.CatalogID < b.CatalogID
+	})
+	return candidates[0], nil
+}
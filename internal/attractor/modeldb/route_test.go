@@ -0,0 +1,92 @@
+package modeldb
+
+import (
+	"strings"
+	"testing"
+)
+
+func routeTestCatalog() *Catalog {
+	price := func(v float64) *float64 { return &v }
+	return &Catalog{Models: map[string]ModelEntry{
+		"openai/gpt-5.4": {Provider: "openai", Mode: "chat", ContextWindow: 400000, SupportsTools: true, SupportsReasoning: true,
+			InputCostPerToken: price(1.25e-6), OutputCostPerToken: price(10e-6)},
+		"openai/gpt-5.4-mini": {Provider: "openai", Mode: "chat", ContextWindow: 400000, SupportsTools: true, SupportsReasoning: true,
+			InputCostPerToken: price(0.25e-6), OutputCostPerToken: price(2e-6)},
+		"openai/gpt-5.4-mini:free": {Provider: "openai", Mode: "chat", ContextWindow: 400000, SupportsTools: true, SupportsReasoning: true,
+			InputCostPerToken: price(0), OutputCostPerToken: price(0)},
+		"anthropic/claude-opus-4.6": {Provider: "anthropic", Mode: "chat", ContextWindow: 1000000, SupportsTools: true, SupportsReasoning: true,
+			InputCostPerToken: price(5e-6), OutputCostPerToken: price(25e-6)},
+		"google/gemini-3-flash": {Provider: "google", Mode: "chat", ContextWindow: 1000000, SupportsTools: true,
+			InputCostPerToken: price(0.1e-6), OutputCostPerToken: price(0.4e-6)},
+		"google/unpriced": {Provider: "google", Mode: "chat", ContextWindow: 1000000, SupportsTools: true, SupportsReasoning: true},
+	}}
+}
+
+func TestRoute_PicksCheapestModelMeetingRequirements(t *testing.T) {
+	c := routeTestCatalog()
+	all := []string{"openai", "anthropic", "google"}
+
+	got, err := Route(c, all, Requirements{Tools: true}, nil)
+	if err != nil {
+		t.Fatalf("Route: %v", err)
+	}
+	if got.Provider != "google" || got.Model != "gemini-3-flash" {
+		t.Fatalf("tools: got %+v", got)
+	}
+
+	got, err = Route(c, all, Requirements{Tools: true, Reasoning: true}, nil)
+	if err != nil {
+		t.Fatalf("Route: %v", err)
+	}
+	if got.Provider != "openai" || got.Model != "gpt-5.4-mini" || got.CatalogID != "openai/gpt-5.4-mini" {
+		t.Fatalf("tools+reasoning: got %+v", got)
+	}
+
+	got, err = Route(c, all, Requirements{Reasoning: true, MinContext: 500000}, nil)
+	if err != nil {
+		t.Fatalf("Route: %v", err)
+	}
+	if got.Model != "claude-opus-4.6" {
+		t.Fatalf("min_context: got %+v", got)
+	}
+
+	if _, err := Route(c, all, Requirements{Reasoning: true, MinContext: 500000, MaxCostPerMTok: 20}, nil); err == nil {
+		t.Fatal("expected no model under the cost cap")
+	}
+
+	// Unconfigured providers and vetoed candidates are skipped.
+	got, err = Route(c, []string{"openai"}, Requirements{Tools: true}, func(provider, model string) bool {
+		return model != "gpt-5.4-mini"
+	})
+	if err != nil {
+		t.Fatalf("Route: %v", err)
+	}
+	if got.Model != "gpt-5.4" {
+		t.Fatalf("veto: got %+v", got)
+	}
+}
+
+func TestRoute_NoCandidateErrorNamesRequirements(t *testing.T) {
+	_, err := Route(routeTestCatalog(), []string{"google"}, Requirements{Vision: true}, nil)
+	if err == nil || !strings.Contains(err.Error(), "requires=vision") || !strings.Contains(err.Error(), "[google]") {
+		t.Fatalf("error: %v", err)
+	}
+}
+
+func TestParseRequirements(t *testing.T) {
+	req, err := ParseRequirements(" tools, Reasoning ", "200000", "5")
+	if err != nil {
+		t.Fatalf("ParseRequirements: %v", err)
+	}
+	if !req.Tools || !req.Reasoning || req.Vision || req.MinContext != 200000 || req.MaxCostPerMTok != 5 {
+		t.Fatalf("req: %+v", req)
+	}
+	if got := req.String(); got != "requires=tools,reasoning min_context=200000 max_cost_per_mtok=5" {
+		t.Fatalf("String: %q", got)
+	}
+	for _, bad := range [][3]string{{"telepathy", "", ""}, {"", "lots", ""}, {"", "", "-1"}} {
+		if _, err := ParseRequirements(bad[0], bad[1], bad[2]); err == nil {
+			t.Fatalf("expected error for %q", bad)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package pipelinetest
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/danshapiro/kilroy/internal/attractor/textutil"
+)
+
+type junitSuites struct {
+	XMLName  xml.Name     `xml:"testsuites"`
+	Tests    int          `xml:"tests,attr"`
+	Failures int          `xml:"failures,attr"`
+	Errors   int          `xml:"errors,attr"`
+	Suites   []junitSuite `xml:"testsuite"`
+}
+
+type junitSuite struct {
+	Name     string      `xml:"name,attr"`
+	Tests    int         `xml:"tests,attr"`
+	Failures int         `xml:"failures,attr"`
+	Errors   int         `xml:"errors,attr"`
+	Time     string      `xml:"time,attr"`
+	Cases    []junitCase `xml:"testcase"`
+}
+
+type junitCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitMessage `xml:"failure,omitempty"`
+	Error     *junitMessage `xml:"error,omitempty"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr"`
+	Body    string `xml:",chardata"`
+}
+
+// WriteJUnit writes results as JUnit XML, one testsuite per test file.
+func WriteJUnit(w io.Writer, results []Result) error {
+	out := junitSuites{}
+	index := map[string]int{}
+	secs := map[string]float64{}
+	for _, r := range results {
+		i, ok := index[r.File]
+		if !ok {
+			i = len(out.Suites)
+			index[r.File] = i
+			out.Suites = append(out.Suites, junitSuite{Name: r.File})
+		}
+		s := &out.Suites[i]
+		c := junitCase{Name: r.Scenario, ClassName: r.File, Time: fmt.Sprintf("%.3f", r.Duration.Seconds())}
+		switch {
+		case r.Error != "":
+			c.Error = &junitMessage{Message: textutil.FirstLine(r.Error), Body: r.Error}
+			s.Errors++
+			out.Errors++
+		case !r.Passed:
+			c.Failure = &junitMessage{Message: textutil.FirstLine(r.Failures[0]), Body: strings.Join(r.Failures, "\n")}
+			s.Failures++
+			out.Failures++
+		}
+		s.Tests++
+		out.Tests++
+		secs[r.File] += r.Duration.Seconds()
+		s.Cases = append(s.Cases, c)
+	}
+	for i := range out.Suites {
+		out.Suites[i].Time = fmt.Sprintf("%.3f", secs[out.Suites[i].Name])
+	}
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(out); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
@@ -0,0 +1,307 @@
+// Package pipelinetest runs *.kilroytest.yaml scenarios: each one runs a
+// graph through the engine's loop with scripted node outcomes
+// (engine.Simulate) and checks the path, visit counts, final status, context
+// and goal gates against expectations.
+package pipelinetest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/danshapiro/kilroy/internal/attractor/engine"
+	"github.com/danshapiro/kilroy/internal/attractor/model"
+)
+
+// Suffixes mark pipeline test files.
+var Suffixes = []string{".kilroytest.yaml", ".kilroytest.yml"}
+
+// File is one *.kilroytest.yaml.
+//
+//	graph: review.dot            # default: review.dot beside review.kilroytest.yaml
+//	scenarios:
+//	  - name: approve after one rework
+//	    nodes:
+//	      review:
+//	        - {status: success, preferred_label: rework}
+//	        - {status: success, preferred_label: approve}
+//	    expect:
+//	      final_status: success
+//	      visited: [start, impl, review, impl, review, exit]
+//	      max_visits: {impl: 2}
+type File struct {
+	Graph     string     `yaml:"graph,omitempty"`
+	Scenarios []Scenario `yaml:"scenarios"`
+}
+
+type Scenario struct {
+	Name string `yaml:"name"`
+	// Context and Nodes are the engine.SimScript for this scenario.
+	Context  map[string]any                `yaml:"context,omitempty"`
+	Nodes    map[string]engine.SimOutcomes `yaml:"nodes,omitempty"`
+	MaxSteps int                           `yaml:"max_steps,omitempty"`
+	Expect   Expect                        `yaml:"expect"`
+}
+
+// Expect holds a scenario's assertions; unset fields are not checked.
+type Expect struct {
+	FinalStatus string `yaml:"final_status,omitempty"`
+	// FailureReasonContains is a substring of the final failure reason.
+	FailureReasonContains string `yaml:"failure_reason_contains,omitempty"`
+	// Visited is the exact node visit sequence.
+	Visited []string `yaml:"visited,omitempty"`
+	// VisitedInOrder must appear in the visit sequence in this order, not
+	// necessarily adjacent.
+	VisitedInOrder []string `yaml:"visited_in_order,omitempty"`
+	// NotVisited must not appear in the visit sequence.
+	NotVisited []string       `yaml:"not_visited,omitempty"`
+	Visits     map[string]int `yaml:"visits,omitempty"`
+	MaxVisits  map[string]int `yaml:"max_visits,omitempty"`
+	Context    map[string]any `yaml:"context,omitempty"`
+	// GoalGatesFired is the exact list of goal gates found unsatisfied at
+	// exit; [] asserts that none fired.
+	GoalGatesFired *[]string `yaml:"goal_gates_fired,omitempty"`
+	Restarts       *int      `yaml:"restarts,omitempty"`
+}
+
+// Result is one scenario's outcome.
+type Result struct {
+	File     string        `json:"file"`
+	Graph    string        `json:"graph"`
+	Scenario string        `json:"scenario"`
+	Passed   bool          `json:"passed"`
+	Failures []string      `json:"failures,omitempty"`
+	Error    string        `json:"error,omitempty"`
+	Duration time.Duration `json:"duration_ns"`
+	// Sim is the simulation, absent when the scenario could not run.
+	Sim *engine.SimResult `json:"simulation,omitempty"`
+}
+
+// Discover expands paths into test files. Directories are walked for files
+// with a test suffix; files are taken as given. No paths means ".".
+func Discover(paths []string) ([]string, error) {
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+	var files []string
+	seen := map[string]bool{}
+	add := func(p string) {
+		if !seen[p] {
+			seen[p] = true
+			files = append(files, p)
+		}
+	}
+	for _, p := range paths {
+		info, err := os.Stat(p)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			add(p)
+			continue
+		}
+		err = filepath.WalkDir(p, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() {
+				if name := d.Name(); path != p && (strings.HasPrefix(name, ".") || name == "node_modules") {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if hasTestSuffix(path) {
+				add(path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+func hasTestSuffix(path string) bool {
+	for _, s := range Suffixes {
+		if strings.HasSuffix(path, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// Load decodes a test file, rejecting unknown keys.
+func Load(path string) (*File, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var f File
+	dec := yaml.NewDecoder(bytes.NewReader(b))
+	dec.KnownFields(true)
+	if err := dec.Decode(&f); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if len(f.Scenarios) == 0 {
+		return nil, fmt.Errorf("%s: no scenarios", path)
+	}
+	for i, sc := range f.Scenarios {
+		if strings.TrimSpace(sc.Name) == "" {
+			return nil, fmt.Errorf("%s: scenarios[%d] has no name", path, i)
+		}
+	}
+	return &f, nil
+}
+
+// GraphPath resolves the graph a test file exercises: graph: relative to the
+// test file, or the .dot file sharing its base name.
+func GraphPath(testPath string, f *File) string {
+	if f != nil && f.Graph != "" {
+		if filepath.IsAbs(f.Graph) {
+			return f.Graph
+		}
+		return filepath.Join(filepath.Dir(testPath), f.Graph)
+	}
+	for _, s := range Suffixes {
+		if strings.HasSuffix(testPath, s) {
+			return strings.TrimSuffix(testPath, s) + ".dot"
+		}
+	}
+	return strings.TrimSuffix(testPath, filepath.Ext(testPath)) + ".dot"
+}
+
+// RunFile runs every scenario in a test file. Problems loading the file or
+// preparing its graph are reported as errored results, not returned, so a
+// suite keeps going.
+func RunFile(path string) []Result {
+	f, err := Load(path)
+	if err != nil {
+		return []Result{{File: path, Scenario: "(load)", Error: err.Error()}}
+	}
+	graphPath := GraphPath(path, f)
+	g, prepErr := prepareGraph(graphPath)
+	var results []Result
+	for _, sc := range f.Scenarios {
+		start := time.Now()
+		r := Result{File: path, Graph: graphPath, Scenario: sc.Name}
+		if prepErr != nil {
+			r.Error = prepErr.Error()
+		} else if sim, err := engine.Simulate(g, &engine.SimScript{Context: sc.Context, Nodes: sc.Nodes}, engine.SimOptions{MaxSteps: sc.MaxSteps}); err != nil {
+			r.Error = err.Error()
+		} else {
+			r.Sim = sim
+			r.Failures = Check(sc.Expect, sim)
+			r.Passed = len(r.Failures) == 0
+		}
+		r.Duration = time.Since(start)
+		results = append(results, r)
+	}
+	return results
+}
+
+func prepareGraph(path string) (*model.Graph, error) {
+	dot, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	g, _, err := engine.Prepare(dot)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return g, nil
+}
+
+// Check returns one message per failed expectation.
+func Check(want Expect, got *engine.SimResult) []string {
+	var fails []string
+	failf := func(format string, args ...any) { fails = append(fails, fmt.Sprintf(format, args...)) }
+
+	if want.FinalStatus != "" && !strings.EqualFold(want.FinalStatus, string(got.FinalStatus)) {
+		failf("final_status: got %s, want %s (failure_reason: %s)", got.FinalStatus, want.FinalStatus, got.FailureReason)
+	}
+	if want.FailureReasonContains != "" && !strings.Contains(got.FailureReason, want.FailureReasonContains) {
+		failf("failure_reason: %q does not contain %q", got.FailureReason, want.FailureReasonContains)
+	}
+	if want.Visited != nil && !reflect.DeepEqual(want.Visited, got.Path) {
+		failf("visited:\n  got  %s\n  want %s", strings.Join(got.Path, " "), strings.Join(want.Visited, " "))
+	}
+	if len(want.VisitedInOrder) > 0 {
+		i := 0
+		for _, id := range got.Path {
+			if i < len(want.VisitedInOrder) && id == want.VisitedInOrder[i] {
+				i++
+			}
+		}
+		if i < len(want.VisitedInOrder) {
+			failf("visited_in_order: %s not reached in order (path: %s)", want.VisitedInOrder[i], strings.Join(got.Path, " "))
+		}
+	}
+	for _, id := range want.NotVisited {
+		if got.Visits[id] > 0 {
+			failf("not_visited: %s was visited %d time(s)", id, got.Visits[id])
+		}
+	}
+	for _, id := range sortedKeys(want.Visits) {
+		if got.Visits[id] != want.Visits[id] {
+			failf("visits.%s: got %d, want %d", id, got.Visits[id], want.Visits[id])
+		}
+	}
+	for _, id := range sortedKeys(want.MaxVisits) {
+		if got.Visits[id] > want.MaxVisits[id] {
+			failf("max_visits.%s: visited %d times, limit %d", id, got.Visits[id], want.MaxVisits[id])
+		}
+	}
+	for _, k := range sortedKeys(want.Context) {
+		v, ok := got.Context[k]
+		if !ok {
+			failf("context.%s: not set, want %s", k, jsonString(want.Context[k]))
+			continue
+		}
+		if jsonString(v) != jsonString(want.Context[k]) {
+			failf("context.%s: got %s, want %s", k, jsonString(v), jsonString(want.Context[k]))
+		}
+	}
+	if want.GoalGatesFired != nil {
+		gates := got.GoalGatesFired
+		if gates == nil {
+			gates = []string{}
+		}
+		if !reflect.DeepEqual(*want.GoalGatesFired, gates) {
+			failf("goal_gates_fired: got %v, want %v", gates, *want.GoalGatesFired)
+		}
+	}
+	if want.Restarts != nil && got.Restarts != *want.Restarts {
+		failf("restarts: got %d, want %d", got.Restarts, *want.Restarts)
+	}
+	return fails
+}
+
+// jsonString renders a context value for comparison, so 2 from YAML and 2
+// from a context update compare equal whatever their Go types.
+func jsonString(v any) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(b)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
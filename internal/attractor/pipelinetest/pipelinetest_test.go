@@ -0,0 +1,148 @@
+package pipelinetest
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const reviewDOT = `
+digraph G {
+  node [llm_provider=openai, llm_model=gpt-5.4]
+  start  [shape=Mdiamond]
+  exit   [shape=Msquare]
+  impl   [shape=box, prompt="implement"]
+  review [shape=box, goal_gate=true, retry_target=impl, prompt="review"]
+  start -> impl -> review
+  review -> exit [label="approve"]
+  review -> impl [label="rework"]
+}
+`
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRunFile_ChecksExpectations(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "review.dot"), reviewDOT)
+	test := filepath.Join(dir, "review.kilroytest.yaml")
+	writeFile(t, test, `
+scenarios:
+  - name: approve after one rework
+    nodes:
+      review:
+        - {status: success, preferred_label: rework}
+        - {status: success, preferred_label: approve, context_updates: {rounds: 2}}
+    expect:
+      final_status: success
+      visited: [start, impl, review, impl, review, exit]
+      max_visits: {impl: 2}
+      context: {rounds: 2, outcome: success}
+      goal_gates_fired: []
+  - name: wrong expectations
+    nodes:
+      review: {status: success, preferred_label: approve}
+    expect:
+      final_status: fail
+      visited_in_order: [review, impl]
+      max_visits: {review: 0}
+      context: {rounds: 1}
+`)
+	results := RunFile(test)
+	if len(results) != 2 {
+		t.Fatalf("results: %+v", results)
+	}
+	if !results[0].Passed {
+		t.Fatalf("first scenario failed: %v %s", results[0].Failures, results[0].Error)
+	}
+	if results[1].Passed || len(results[1].Failures) != 4 {
+		t.Fatalf("second scenario failures: %v", results[1].Failures)
+	}
+	for i, prefix := range []string{"final_status:", "visited_in_order:", "max_visits.review:", "context.rounds: not set"} {
+		if !strings.HasPrefix(results[1].Failures[i], prefix) {
+			t.Fatalf("failure %d = %q, want prefix %q", i, results[1].Failures[i], prefix)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := WriteJUnit(&buf, results); err != nil {
+		t.Fatal(err)
+	}
+	xml := buf.String()
+	if !strings.Contains(xml, `<testsuites tests="2" failures="1" errors="0">`) || !strings.Contains(xml, `<testcase name="wrong expectations"`) || !strings.Contains(xml, `<failure message="final_status: got success, want fail`) {
+		t.Fatalf("junit:\n%s", xml)
+	}
+}
+
+func TestRunFile_AssertsEngineFailures(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "gate.dot"), `
+digraph G {
+  node [llm_provider=openai, llm_model=gpt-5.4]
+  start  [shape=Mdiamond]
+  exit   [shape=Msquare]
+  review [shape=box, goal_gate=true, max_retries=0, prompt="review"]
+  start -> review -> exit
+}
+`)
+	test := filepath.Join(dir, "gate.kilroytest.yaml")
+	writeFile(t, test, `
+scenarios:
+  - name: unsatisfied gate without retry target
+    nodes:
+      review: fail
+    expect:
+      final_status: fail
+      failure_reason_contains: "goal gate unsatisfied (review) and no retry target"
+      visited: [start, review]
+      goal_gates_fired: [review]
+`)
+	results := RunFile(test)
+	if len(results) != 1 || !results[0].Passed {
+		t.Fatalf("results: %+v", results)
+	}
+}
+
+func TestRunFile_ReportsBadGraphAsErrors(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "broken.dot"), `digraph G { a -> b }`)
+	test := filepath.Join(dir, "broken.kilroytest.yml")
+	writeFile(t, test, "scenarios:\n  - name: one\n  - name: two\n")
+	results := RunFile(test)
+	if len(results) != 2 || results[0].Error == "" || results[1].Error == "" {
+		t.Fatalf("results: %+v", results)
+	}
+
+	writeFile(t, test, "scenarios:\n  - name: one\n    expect: {final_stauts: success}\n")
+	if results := RunFile(test); len(results) != 1 || !strings.Contains(results[0].Error, "final_stauts") {
+		t.Fatalf("results: %+v", results)
+	}
+}
+
+func TestDiscover_WalksDirectoriesForTestFiles(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "a.kilroytest.yaml"), "")
+	writeFile(t, filepath.Join(dir, "nested", "b.kilroytest.yml"), "")
+	writeFile(t, filepath.Join(dir, "nested", "b.dot"), "")
+	writeFile(t, filepath.Join(dir, ".git", "c.kilroytest.yaml"), "")
+	files, err := Discover([]string{dir, filepath.Join(dir, "a.kilroytest.yaml")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{filepath.Join(dir, "a.kilroytest.yaml"), filepath.Join(dir, "nested", "b.kilroytest.yml")}
+	if strings.Join(files, ",") != strings.Join(want, ",") {
+		t.Fatalf("files: %v", files)
+	}
+	if got := GraphPath(want[1], &File{}); got != filepath.Join(dir, "nested", "b.dot") {
+		t.Fatalf("graph path: %s", got)
+	}
+}
@@ -0,0 +1,93 @@
+package render
+
+import (
+	"html/template"
+	"io"
+	"strings"
+)
+
+var htmlTemplate = template.Must(template.New("render").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>{{.Caption}}</title>
+<style>
+body { font-family: Helvetica, Arial, sans-serif; color: #111827; margin: 24px; }
+.graph { overflow: auto; border: 1px solid #e5e7eb; border-radius: 6px; }
+.legend span { display: inline-block; margin: 0 12px 6px 0; font-size: 13px; }
+.legend i { display: inline-block; width: 12px; height: 12px; margin-right: 4px; vertical-align: -1px; border: 2px solid; border-radius: 2px; }
+table { border-collapse: collapse; margin-top: 16px; font-size: 13px; }
+th, td { text-align: left; padding: 4px 12px 4px 0; border-bottom: 1px solid #e5e7eb; }
+td.num { text-align: right; }
+.failure { color: #dc2626; }
+</style>
+</head>
+<body>
+<h1>{{.Caption}}</h1>
+{{with .Goal}}<p><strong>Goal:</strong> {{.}}</p>{{end}}
+{{with .FailureReason}}<p class="failure"><strong>Failure:</strong> {{.}}</p>{{end}}
+<div class="legend">
+{{range .Types}}<span><i style="background:{{.Fill}};border-color:{{.Stroke}}"></i>{{.Name}}</span>{{end}}
+</div>
+{{if .Overlay}}<div class="legend">
+{{range .Statuses}}<span><i style="background:#fff;border-color:{{.Stroke}}"></i>{{.Name}}</span>{{end}}
+</div>{{end}}
+<div class="graph">{{.SVG}}</div>
+<table>
+<tr><th>Node</th><th>Type</th>{{if .Overlay}}<th>Status</th><th>Visits</th><th>Retries</th><th>Duration</th>{{else}}<th>Label</th>{{end}}</tr>
+{{range .Rows}}<tr><td>{{.ID}}</td><td>{{.Type}}</td>{{if $.Overlay}}<td>{{.Status}}</td><td class="num">{{.Visits}}</td><td class="num">{{.Retries}}</td><td class="num">{{.Duration}}</td>{{else}}<td>{{.Label}}</td>{{end}}</tr>
+{{end}}</table>
+</body>
+</html>
+`))
+
+type htmlSwatch struct{ Name, Fill, Stroke string }
+
+type htmlRow struct {
+	ID, Type, Label, Status, Duration string
+	Visits, Retries                   int
+}
+
+// WriteHTML writes l as a standalone page: the SVG with a legend and a table
+// of nodes (with run stats when overlaid).
+func WriteHTML(w io.Writer, l *Layout) error {
+	data := struct {
+		Caption, Goal, FailureReason string
+		Overlay                      bool
+		Types, Statuses              []htmlSwatch
+		SVG                          template.HTML
+		Rows                         []htmlRow
+	}{
+		Caption: l.Caption,
+		Goal:    strings.TrimSpace(l.Graph.Attrs["goal"]),
+		Overlay: l.Overlay != nil,
+		SVG:     template.HTML(svgElement(l)),
+	}
+	types := map[string]bool{}
+	statuses := map[string]bool{}
+	for _, n := range l.Nodes {
+		types[n.Type] = true
+		row := htmlRow{ID: n.ID, Type: n.Type, Label: strings.Join(n.Lines[:len(n.Lines)-1], " ")}
+		if n.Stats != nil {
+			statuses[n.Stats.Status] = true
+			row.Status, row.Visits, row.Retries = n.Stats.Status, n.Stats.Visits, n.Stats.Retries
+			if n.Stats.Duration > 0 {
+				row.Duration = formatDuration(n.Stats.Duration)
+			}
+		} else if l.Overlay != nil {
+			row.Status = "not reached"
+		}
+		data.Rows = append(data.Rows, row)
+	}
+	for _, t := range sortedKeys(types) {
+		st := styleFor(t)
+		data.Types = append(data.Types, htmlSwatch{t, st.Fill, st.Stroke})
+	}
+	for _, s := range sortedKeys(statuses) {
+		data.Statuses = append(data.Statuses, htmlSwatch{Name: s, Stroke: statusColor(s)})
+	}
+	if l.Overlay != nil {
+		data.FailureReason = l.Overlay.FailureReason
+	}
+	return htmlTemplate.Execute(w, data)
+}
@@ -0,0 +1,609 @@
+package render
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/danshapiro/kilroy/internal/attractor/model"
+	"github.com/danshapiro/kilroy/internal/attractor/textutil"
+)
+
+// Layout geometry, in SVG user units (PNG output doubles them).
+const (
+	charW    = 7.0
+	lineH    = 16.0
+	padX     = 14.0
+	padY     = 10.0
+	minNodeW = 100.0
+	rankSep  = 64.0
+	nodeSep  = 36.0
+	dummyW   = 14.0
+	margin   = 24.0
+	captionH = 28.0
+	selfLoop = 28.0
+)
+
+type Point struct{ X, Y float64 }
+
+// Layout is a top-to-bottom layered drawing of a graph: nodes are ranked by
+// longest path from the start node with back edges reversed, ordered within a
+// rank by barycenter sweeps to cut crossings, then pulled toward their
+// neighbors. Edges that span ranks are routed through the gaps between nodes.
+type Layout struct {
+	Graph         *model.Graph
+	Overlay       *Overlay
+	Caption       string
+	Width, Height float64
+	Nodes         []*NodeBox // declaration order
+	Edges         []*EdgePath
+}
+
+type NodeBox struct {
+	ID    string
+	Node  *model.Node
+	Type  string
+	Style typeStyle
+	Rank  int
+	// X and Y are the center.
+	X, Y, W, H float64
+	// Lines are the label lines followed by the handler type.
+	Lines []string
+	// Stats is the overlay for this node; nil without an overlay or when the
+	// run never reached it.
+	Stats *NodeStats
+}
+
+type EdgePath struct {
+	Edge    *model.Edge
+	Points  []Point // source border to target border
+	Label   string
+	LabelAt Point
+	// Back edges point up the ranks (loops back to earlier stages).
+	Back bool
+	// Taken counts how often the overlaid run took this edge.
+	Taken int
+}
+
+// vert is a node or a dummy point on an edge spanning several ranks.
+type vert struct {
+	box      *NodeBox
+	rank     int
+	w, x     float64
+	pos      int
+	up, down []*vert
+}
+
+// ComputeLayout lays out g; ov may be nil.
+func ComputeLayout(g *model.Graph, ov *Overlay) *Layout {
+	l := &Layout{Graph: g, Overlay: ov, Caption: caption(g, ov)}
+	ids := nodeOrder(g)
+	for _, id := range ids {
+		l.Nodes = append(l.Nodes, newNodeBox(g.Nodes[id], ov))
+	}
+	boxes := map[string]*NodeBox{}
+	for _, b := range l.Nodes {
+		boxes[b.ID] = b
+	}
+	valid := func(e *model.Edge) bool { return boxes[e.From] != nil && boxes[e.To] != nil }
+
+	back, preorder := findBackEdges(g, ids, valid)
+	forward := func(e *model.Edge) bool { return valid(e) && e.From != e.To && !back[e] }
+
+	// Longest-path ranking over the forward edges.
+	indeg := map[string]int{}
+	for _, e := range g.Edges {
+		if forward(e) {
+			indeg[e.To]++
+		}
+	}
+	var queue []string
+	for _, id := range ids {
+		if indeg[id] == 0 {
+			queue = append(queue, id)
+		}
+	}
+	maxRank := 0
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		for _, e := range g.Outgoing(id) {
+			if !forward(e) {
+				continue
+			}
+			if r := boxes[id].Rank + 1; r > boxes[e.To].Rank {
+				boxes[e.To].Rank = r
+				maxRank = max(maxRank, r)
+			}
+			if indeg[e.To]--; indeg[e.To] == 0 {
+				queue = append(queue, e.To)
+			}
+		}
+	}
+
+	// Vertices per rank, with dummies along edges that span ranks.
+	layers := make([][]*vert, maxRank+1)
+	verts := map[string]*vert{}
+	for _, id := range preorder {
+		b := boxes[id]
+		v := &vert{box: b, rank: b.Rank, w: b.W}
+		verts[id] = v
+		layers[v.rank] = append(layers[v.rank], v)
+	}
+	chains := map[*model.Edge][]*vert{}
+	for _, e := range g.Edges {
+		if !valid(e) || e.From == e.To {
+			continue
+		}
+		top, bottom := verts[e.From], verts[e.To]
+		if back[e] {
+			top, bottom = bottom, top
+		}
+		chain := []*vert{top}
+		for r := top.rank + 1; r < bottom.rank; r++ {
+			d := &vert{rank: r, w: dummyW}
+			layers[r] = append(layers[r], d)
+			chain = append(chain, d)
+		}
+		chain = append(chain, bottom)
+		for i := 1; i < len(chain); i++ {
+			chain[i-1].down = append(chain[i-1].down, chain[i])
+			chain[i].up = append(chain[i].up, chain[i-1])
+		}
+		chains[e] = chain
+	}
+
+	orderLayers(layers)
+	placeLayers(layers)
+
+	// Shift into the canvas and assign rank rows.
+	minX, maxX := math.Inf(1), math.Inf(-1)
+	selfLoops := map[string]bool{}
+	for _, e := range g.Edges {
+		if valid(e) && e.From == e.To {
+			selfLoops[e.From] = true
+		}
+	}
+	for _, layer := range layers {
+		for _, v := range layer {
+			right := v.x + v.w/2
+			if v.box != nil && selfLoops[v.box.ID] {
+				right += selfLoop + 4
+			}
+			minX, maxX = math.Min(minX, v.x-v.w/2), math.Max(maxX, right)
+		}
+	}
+	if len(l.Nodes) == 0 {
+		minX, maxX = 0, minNodeW
+	}
+	l.Width = math.Max(maxX-minX+2*margin, textWidth(l.Caption)+2*margin)
+	y := margin + captionH
+	rowY := make([]float64, len(layers))
+	for r, layer := range layers {
+		h := 0.0
+		for _, v := range layer {
+			if v.box != nil {
+				h = math.Max(h, v.box.H)
+			}
+		}
+		rowY[r] = y + h/2
+		y += h + rankSep
+		for _, v := range layer {
+			v.x += margin - minX
+			if v.box != nil {
+				v.box.X, v.box.Y = v.x, rowY[r]
+			}
+		}
+	}
+	l.Height = y - rankSep + margin
+	if len(layers) == 0 {
+		l.Height = margin*2 + captionH
+	}
+
+	taken := ov.EdgeCounts(g)
+	for _, e := range g.Edges {
+		if !valid(e) {
+			continue
+		}
+		p := &EdgePath{Edge: e, Back: back[e] && e.From != e.To, Taken: taken[e], Label: edgeText(e)}
+		if p.Taken > 1 {
+			p.Label = strings.TrimSpace(p.Label + " ×" + strconv.Itoa(p.Taken))
+		}
+		src, dst := boxes[e.From], boxes[e.To]
+		switch {
+		case e.From == e.To:
+			right := src.X + src.W
+			p.Points = []Point{
+				clip(src, Point{right, src.Y - 8}),
+				{src.X + src.W/2 + selfLoop, src.Y - 16},
+				{src.X + src.W/2 + selfLoop, src.Y + 16},
+				clip(src, Point{right, src.Y + 8}),
+			}
+		default:
+			chain := chains[e]
+			pts := make([]Point, len(chain))
+			for i, v := range chain {
+				pts[i] = Point{v.x, rowY[v.rank]}
+			}
+			if p.Back {
+				// Reverse to run source to target, and leave from the top
+				// right of the source so the loop does not overlap the
+				// forward edge between the same two nodes.
+				for i, j := 0, len(pts)-1; i < j; i, j = i+1, j-1 {
+					pts[i], pts[j] = pts[j], pts[i]
+				}
+				pts[0] = borderPoint(src, src.W/4, true)
+				pts[len(pts)-1] = borderPoint(dst, dst.W/4, false)
+			} else {
+				pts[0] = clip(src, pts[1])
+				pts[len(pts)-1] = clip(dst, pts[len(pts)-2])
+			}
+			p.Points = pts
+		}
+		p.LabelAt = midpoint(p.Points)
+		if e.From == e.To {
+			p.LabelAt.X += textWidth(p.Label)/2 + 4
+		}
+		l.Edges = append(l.Edges, p)
+	}
+	l.fitLabels()
+	return l
+}
+
+// fitLabels widens the canvas so no edge label is cut off at either side.
+func (l *Layout) fitLabels() {
+	lo, hi := margin, l.Width-margin
+	for _, p := range l.Edges {
+		if p.Label != "" {
+			half := textWidth(p.Label) / 2
+			lo, hi = math.Min(lo, p.LabelAt.X-half), math.Max(hi, p.LabelAt.X+half)
+		}
+	}
+	if dx := margin - lo; dx > 0 {
+		for _, b := range l.Nodes {
+			b.X += dx
+		}
+		for _, p := range l.Edges {
+			for i := range p.Points {
+				p.Points[i].X += dx
+			}
+			p.LabelAt.X += dx
+		}
+		hi += dx
+	}
+	l.Width = math.Max(l.Width, hi+margin)
+}
+
+func newNodeBox(n *model.Node, ov *Overlay) *NodeBox {
+	b := &NodeBox{ID: n.ID, Node: n, Type: n.HandlerType()}
+	b.Style = styleFor(b.Type)
+	label := strings.ReplaceAll(n.Label(), `\n`, "\n")
+	for _, line := range strings.Split(label, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			b.Lines = append(b.Lines, textutil.Truncate(line, 48))
+		}
+	}
+	if len(b.Lines) == 0 {
+		b.Lines = []string{n.ID}
+	}
+	b.Lines = append(b.Lines, b.Type)
+	if ov != nil {
+		b.Stats = ov.Nodes[n.ID]
+	}
+	text := b.TextLines()
+	tw, th := 0.0, float64(len(text))*lineH
+	for _, line := range text {
+		tw = math.Max(tw, textWidth(line))
+	}
+	b.W, b.H = math.Max(tw+2*padX, minNodeW), th+2*padY
+	switch b.Style.Shape {
+	case "ellipse", "doubleellipse":
+		b.W, b.H = b.W*1.2, b.H*1.25
+	case "diamond":
+		b.W, b.H = b.W*1.5, b.H*1.6
+	case "hexagon", "octagon", "parallelogram":
+		b.W += 24
+	case "house":
+		b.W, b.H = b.W+12, b.H+12
+	}
+	return b
+}
+
+// TextLines are the lines drawn inside the node.
+func (b *NodeBox) TextLines() []string {
+	if b.Stats == nil {
+		return b.Lines
+	}
+	return append(append([]string{}, b.Lines...), statsLine(b.Stats))
+}
+
+func textWidth(s string) float64 {
+	return float64(len([]rune(s))) * charW
+}
+
+// nodeOrder is start nodes first, then declaration order.
+func nodeOrder(g *model.Graph) []string {
+	ids := g.AllNodeIDs()
+	rank := func(id string) int {
+		if g.Nodes[id].HandlerType() == "start" {
+			return 0
+		}
+		return 1
+	}
+	sort.SliceStable(ids, func(i, j int) bool {
+		a, b := g.Nodes[ids[i]], g.Nodes[ids[j]]
+		if ra, rb := rank(a.ID), rank(b.ID); ra != rb {
+			return ra < rb
+		}
+		return a.Order < b.Order
+	})
+	return ids
+}
+
+// findBackEdges runs a DFS in node order and returns the edges that close a
+// cycle (including self loops) and the DFS preorder.
+func findBackEdges(g *model.Graph, ids []string, valid func(*model.Edge) bool) (map[*model.Edge]bool, []string) {
+	back := map[*model.Edge]bool{}
+	state := map[string]int{} // 1 on the stack, 2 done
+	var preorder []string
+	var visit func(id string)
+	visit = func(id string) {
+		state[id] = 1
+		preorder = append(preorder, id)
+		for _, e := range g.Outgoing(id) {
+			if !valid(e) {
+				continue
+			}
+			switch state[e.To] {
+			case 0:
+				visit(e.To)
+			case 1:
+				back[e] = true
+			}
+		}
+		state[id] = 2
+	}
+	for _, id := range ids {
+		if state[id] == 0 {
+			visit(id)
+		}
+	}
+	return back, preorder
+}
+
+// orderLayers reorders each rank by the barycenter of its neighbors, sweeping
+// down and up, and keeps the ordering with the fewest crossings.
+func orderLayers(layers [][]*vert) {
+	setPos := func(layer []*vert) {
+		for i, v := range layer {
+			v.pos = i
+		}
+	}
+	snapshot := func() [][]*vert {
+		out := make([][]*vert, len(layers))
+		for r, layer := range layers {
+			out[r] = append([]*vert{}, layer...)
+		}
+		return out
+	}
+	for _, layer := range layers {
+		setPos(layer)
+	}
+	best, bestCrossings := snapshot(), crossings(layers)
+	sortLayer := func(layer []*vert, neighbors func(*vert) []*vert) {
+		bary := map[*vert]float64{}
+		for _, v := range layer {
+			ns := neighbors(v)
+			if len(ns) == 0 {
+				bary[v] = float64(v.pos)
+				continue
+			}
+			sum := 0.0
+			for _, n := range ns {
+				sum += float64(n.pos)
+			}
+			bary[v] = sum / float64(len(ns))
+		}
+		sort.SliceStable(layer, func(i, j int) bool { return bary[layer[i]] < bary[layer[j]] })
+		setPos(layer)
+	}
+	for it := 0; it < 12 && bestCrossings > 0; it++ {
+		if it%2 == 0 {
+			for r := 1; r < len(layers); r++ {
+				sortLayer(layers[r], func(v *vert) []*vert { return v.up })
+			}
+		} else {
+			for r := len(layers) - 2; r >= 0; r-- {
+				sortLayer(layers[r], func(v *vert) []*vert { return v.down })
+			}
+		}
+		if c := crossings(layers); c < bestCrossings {
+			best, bestCrossings = snapshot(), c
+		}
+	}
+	copy(layers, best)
+	for _, layer := range layers {
+		setPos(layer)
+	}
+}
+
+func crossings(layers [][]*vert) int {
+	n := 0
+	for r := 0; r+1 < len(layers); r++ {
+		var segs [][2]int
+		for _, u := range layers[r] {
+			for _, w := range u.down {
+				segs = append(segs, [2]int{u.pos, w.pos})
+			}
+		}
+		for i := range segs {
+			for j := i + 1; j < len(segs); j++ {
+				if (segs[i][0]-segs[j][0])*(segs[i][1]-segs[j][1]) < 0 {
+					n++
+				}
+			}
+		}
+	}
+	return n
+}
+
+// placeLayers assigns x coordinates: each rank is packed in order, then
+// repeatedly pulled toward the mean x of its neighbors while keeping order
+// and spacing.
+func placeLayers(layers [][]*vert) {
+	for _, layer := range layers {
+		x := 0.0
+		for i, v := range layer {
+			if i > 0 {
+				x += gap(layer[i-1], v)
+			}
+			v.x = x
+		}
+		for _, v := range layer {
+			v.x -= x / 2
+		}
+	}
+	for it := 0; it < 16; it++ {
+		for k := range layers {
+			r := k
+			if it%2 == 1 {
+				r = len(layers) - 1 - k
+			}
+			layer := layers[r]
+			want := make([]float64, len(layer))
+			for i, v := range layer {
+				ns := v.up
+				if it%2 == 1 {
+					ns = v.down
+				}
+				if len(ns) == 0 {
+					ns = append(append([]*vert{}, v.up...), v.down...)
+				}
+				want[i] = v.x
+				if len(ns) > 0 {
+					sum := 0.0
+					for _, n := range ns {
+						sum += n.x
+					}
+					want[i] = sum / float64(len(ns))
+				}
+			}
+			place(layer, want)
+		}
+	}
+}
+
+// place sets x as close to want as the spacing allows: the mean of the
+// placement packed from the left and the one packed from the right.
+func place(layer []*vert, want []float64) {
+	n := len(layer)
+	if n == 0 {
+		return
+	}
+	a, b := make([]float64, n), make([]float64, n)
+	a[0] = want[0]
+	for i := 1; i < n; i++ {
+		a[i] = math.Max(want[i], a[i-1]+gap(layer[i-1], layer[i]))
+	}
+	b[n-1] = want[n-1]
+	for i := n - 2; i >= 0; i-- {
+		b[i] = math.Min(want[i], b[i+1]-gap(layer[i], layer[i+1]))
+	}
+	for i, v := range layer {
+		v.x = (a[i] + b[i]) / 2
+	}
+}
+
+func gap(l, r *vert) float64 {
+	sep := nodeSep
+	if l.box == nil || r.box == nil {
+		sep = nodeSep / 2
+	}
+	return l.w/2 + sep + r.w/2
+}
+
+// clip returns where the ray from b's center toward p crosses b's outline.
+func clip(b *NodeBox, p Point) Point {
+	dx, dy := p.X-b.X, p.Y-b.Y
+	if dx == 0 && dy == 0 {
+		return Point{b.X, b.Y}
+	}
+	hw, hh := b.W/2, b.H/2
+	var t float64
+	switch b.Style.Shape {
+	case "ellipse", "doubleellipse":
+		t = 1 / math.Sqrt(dx*dx/(hw*hw)+dy*dy/(hh*hh))
+	case "diamond":
+		t = 1 / (math.Abs(dx)/hw + math.Abs(dy)/hh)
+	default:
+		t = 1 / math.Max(math.Abs(dx)/hw, math.Abs(dy)/hh)
+	}
+	return Point{b.X + dx*t, b.Y + dy*t}
+}
+
+// borderPoint is the point on b's top (or bottom) outline dx right of center.
+func borderPoint(b *NodeBox, dx float64, top bool) Point {
+	hw, hh := b.W/2, b.H/2
+	off := hh
+	switch b.Style.Shape {
+	case "ellipse", "doubleellipse":
+		off = hh * math.Sqrt(1-(dx/hw)*(dx/hw))
+	case "diamond":
+		off = hh * (1 - math.Abs(dx)/hw)
+	}
+	if top {
+		return Point{b.X + dx, b.Y - off}
+	}
+	return Point{b.X + dx, b.Y + off}
+}
+
+// midpoint is the point halfway along a polyline.
+func midpoint(pts []Point) Point {
+	total := 0.0
+	for i := 1; i < len(pts); i++ {
+		total += math.Hypot(pts[i].X-pts[i-1].X, pts[i].Y-pts[i-1].Y)
+	}
+	half := total / 2
+	for i := 1; i < len(pts); i++ {
+		seg := math.Hypot(pts[i].X-pts[i-1].X, pts[i].Y-pts[i-1].Y)
+		if seg >= half && seg > 0 {
+			t := half / seg
+			return Point{pts[i-1].X + (pts[i].X-pts[i-1].X)*t, pts[i-1].Y + (pts[i].Y-pts[i-1].Y)*t}
+		}
+		half -= seg
+	}
+	return pts[0]
+}
+
+// outline is b's shape as a polygon; ellipses are approximated.
+func outline(b *NodeBox) []Point {
+	x0, y0, x1, y1 := b.X-b.W/2, b.Y-b.H/2, b.X+b.W/2, b.Y+b.H/2
+	const in = 12.0
+	switch b.Style.Shape {
+	case "ellipse", "doubleellipse":
+		return ellipse(b.X, b.Y, b.W/2, b.H/2)
+	case "diamond":
+		return []Point{{b.X, y0}, {x1, b.Y}, {b.X, y1}, {x0, b.Y}}
+	case "hexagon":
+		return []Point{{x0 + in, y0}, {x1 - in, y0}, {x1, b.Y}, {x1 - in, y1}, {x0 + in, y1}, {x0, b.Y}}
+	case "octagon":
+		return []Point{{x0 + in, y0}, {x1 - in, y0}, {x1, y0 + in}, {x1, y1 - in}, {x1 - in, y1}, {x0 + in, y1}, {x0, y1 - in}, {x0, y0 + in}}
+	case "parallelogram":
+		return []Point{{x0 + in*2, y0}, {x1, y0}, {x1 - in*2, y1}, {x0, y1}}
+	case "house":
+		return []Point{{b.X, y0}, {x1, y0 + in}, {x1, y1}, {x0, y1}, {x0, y0 + in}}
+	default:
+		return []Point{{x0, y0}, {x1, y0}, {x1, y1}, {x0, y1}}
+	}
+}
+
+func ellipse(cx, cy, rx, ry float64) []Point {
+	const n = 48
+	pts := make([]Point, n)
+	for i := range pts {
+		a := 2 * math.Pi * float64(i) / n
+		pts[i] = Point{cx + rx*math.Cos(a), cy + ry*math.Sin(a)}
+	}
+	return pts
+}
@@ -0,0 +1,159 @@
+package render
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/danshapiro/kilroy/internal/attractor/model"
+)
+
+// mermaidShapes are the node delimiters per handler type, mirroring the SVG
+// shapes as closely as Mermaid allows.
+var mermaidShapes = map[string][2]string{
+	"start":              {"([", "])"},
+	"exit":               {"(((", ")))"},
+	"conditional":        {"{", "}"},
+	"wait.human":         {"{{", "}}"},
+	"parallel":           {"[[", "]]"},
+	"parallel.fan_in":    {"[/", `\]`},
+	"tool":               {"[/", "/]"},
+	"stack.manager_loop": {">", "]"},
+}
+
+// mermaidReserved are words Mermaid's flowchart grammar will not take as node
+// IDs.
+var mermaidReserved = map[string]bool{
+	"end": true, "graph": true, "flowchart": true, "subgraph": true, "style": true,
+	"class": true, "classdef": true, "click": true, "linkstyle": true, "default": true,
+}
+
+var mermaidUnsafe = regexp.MustCompile(`[^A-Za-z0-9_]`)
+
+// WriteMermaid writes g as a Mermaid flowchart for pasting into Markdown. Node
+// classes carry the handler-type colors; with an overlay, nodes also get a
+// status class and the taken edges are restyled with linkStyle.
+func WriteMermaid(w io.Writer, g *model.Graph, ov *Overlay) error {
+	var b strings.Builder
+	pf := func(format string, args ...any) { fmt.Fprintf(&b, format, args...) }
+
+	ids := nodeOrder(g)
+	mid := mermaidIDs(ids)
+	pf("flowchart TD\n")
+	byType := map[string][]string{}
+	byStatus := map[string][]string{}
+	for _, id := range ids {
+		n := g.Nodes[id]
+		box := newNodeBox(n, ov)
+		var lines []string
+		for _, line := range box.Lines[:len(box.Lines)-1] {
+			lines = append(lines, mermaidText(line))
+		}
+		lines = append(lines, "<i>"+mermaidText(box.Type)+"</i>")
+		if box.Stats != nil {
+			lines = append(lines, mermaidText(statsLine(box.Stats)))
+		}
+		delim, ok := mermaidShapes[box.Type]
+		if !ok {
+			delim = [2]string{"[", "]"}
+		}
+		pf("    %s%s\"%s\"%s\n", mid[id], delim[0], strings.Join(lines, "<br/>"), delim[1])
+
+		byType[box.Type] = append(byType[box.Type], mid[id])
+		if ov != nil {
+			status := ""
+			if box.Stats != nil {
+				status = box.Stats.Status
+			}
+			byStatus[status] = append(byStatus[status], mid[id])
+		}
+	}
+
+	taken := ov.EdgeCounts(g)
+	var takenLinks []string
+	link := 0
+	for _, e := range g.Edges {
+		if g.Nodes[e.From] == nil || g.Nodes[e.To] == nil {
+			continue
+		}
+		arrow := "-->"
+		if isLoopRestart(e) {
+			arrow = "-.->"
+		}
+		text := edgeText(e)
+		if taken[e] > 1 {
+			text = strings.TrimSpace(text + " ×" + strconv.Itoa(taken[e]))
+		}
+		if text != "" {
+			pf("    %s %s|\"%s\"| %s\n", mid[e.From], arrow, mermaidText(text), mid[e.To])
+		} else {
+			pf("    %s %s %s\n", mid[e.From], arrow, mid[e.To])
+		}
+		if taken[e] > 0 {
+			takenLinks = append(takenLinks, strconv.Itoa(link))
+		}
+		link++
+	}
+
+	for _, t := range sortedKeys(byType) {
+		st := styleFor(t)
+		pf("    classDef %s fill:%s,stroke:%s,color:#111827\n", mermaidClass("type", t), st.Fill, st.Stroke)
+		pf("    class %s %s\n", strings.Join(byType[t], ","), mermaidClass("type", t))
+	}
+	for _, status := range sortedKeys(byStatus) {
+		cls := mermaidClass("status", status)
+		if status == "" {
+			cls = "unvisited"
+			pf("    classDef %s opacity:0.45\n", cls)
+		} else {
+			pf("    classDef %s stroke:%s,stroke-width:3px\n", cls, statusColor(status))
+		}
+		pf("    class %s %s\n", strings.Join(byStatus[status], ","), cls)
+	}
+	if len(takenLinks) > 0 {
+		pf("    linkStyle %s stroke:%s,stroke-width:3px\n", strings.Join(takenLinks, ","), edgeTakenColor)
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// mermaidIDs maps node IDs to identifiers Mermaid accepts, keeping them
+// readable and unique.
+func mermaidIDs(ids []string) map[string]string {
+	out := map[string]string{}
+	used := map[string]bool{}
+	for _, id := range ids {
+		m := mermaidUnsafe.ReplaceAllString(id, "_")
+		if m == "" || mermaidReserved[strings.ToLower(m)] {
+			m += "_"
+		}
+		base := m
+		for i := 2; used[m]; i++ {
+			m = base + "_" + strconv.Itoa(i)
+		}
+		used[m] = true
+		out[id] = m
+	}
+	return out
+}
+
+// mermaidText escapes s for a quoted Mermaid label.
+func mermaidText(s string) string {
+	return strings.NewReplacer(`"`, "#quot;", "<", "#lt;", ">", "#gt;").Replace(s)
+}
+
+func mermaidClass(prefix, name string) string {
+	return prefix + "_" + mermaidUnsafe.ReplaceAllString(name, "_")
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,206 @@
+package render
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/danshapiro/kilroy/internal/attractor/model"
+	"github.com/danshapiro/kilroy/internal/attractor/runstate"
+)
+
+// Overlay is what a run did, read from its logs root: per-node stats from
+// progress.ndjson (across loop_restart segments) and the run state from
+// runstate.LoadSnapshot.
+type Overlay struct {
+	LogsRoot      string                `json:"logs_root"`
+	RunID         string                `json:"run_id,omitempty"`
+	State         runstate.State        `json:"state"`
+	FailureReason string                `json:"failure_reason,omitempty"`
+	Restarts      int                   `json:"restarts,omitempty"`
+	Nodes         map[string]*NodeStats `json:"nodes"`
+	// Transitions are the edges taken, in order.
+	Transitions []Transition `json:"transitions,omitempty"`
+}
+
+type NodeStats struct {
+	// Status is the last attempt's status, "running" for the node in flight,
+	// or "interrupted" when an attempt never finished and the run is gone.
+	Status   string        `json:"status"`
+	Visits   int           `json:"visits"`
+	Retries  int           `json:"retries"`
+	Duration time.Duration `json:"duration_ns"`
+}
+
+type Transition struct {
+	From      string `json:"from"`
+	To        string `json:"to"`
+	Label     string `json:"label,omitempty"`
+	Condition string `json:"condition,omitempty"`
+}
+
+// LoadOverlay reads the run under logsRoot.
+func LoadOverlay(logsRoot string) (*Overlay, error) {
+	if _, err := os.Stat(logsRoot); err != nil {
+		return nil, err
+	}
+	segs := runstate.RestartSegments(logsRoot)
+	snap, err := runstate.LoadSnapshot(logsRoot)
+	if err != nil {
+		return nil, err
+	}
+	// After a loop_restart the terminal outcome is written to the last segment.
+	if last := segs[len(segs)-1]; last != logsRoot {
+		if ls, err := runstate.LoadSnapshot(last); err == nil && (ls.State == runstate.StateSuccess || ls.State == runstate.StateFail) {
+			snap.State, snap.FailureReason = ls.State, ls.FailureReason
+			if snap.RunID == "" {
+				snap.RunID = ls.RunID
+			}
+		}
+	}
+	ov := &Overlay{
+		LogsRoot:      logsRoot,
+		RunID:         snap.RunID,
+		State:         snap.State,
+		FailureReason: snap.FailureReason,
+		Nodes:         map[string]*NodeStats{},
+	}
+	found := false
+	inFlight := map[string]bool{}
+	for _, seg := range segs {
+		ok, err := ov.readProgress(filepath.Join(seg, "progress.ndjson"), inFlight)
+		if err != nil {
+			return nil, err
+		}
+		found = found || ok
+	}
+	if !found {
+		return nil, fmt.Errorf("no progress.ndjson under %s", logsRoot)
+	}
+	for id := range inFlight {
+		if ov.State == runstate.StateRunning {
+			ov.Nodes[id].Status = "running"
+		} else {
+			ov.Nodes[id].Status = "interrupted"
+		}
+	}
+	return ov, nil
+}
+
+func (ov *Overlay) readProgress(path string, inFlight map[string]bool) (bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return false, nil
+		}
+		return false, err
+	}
+	defer func() { _ = f.Close() }()
+
+	stats := func(id string) *NodeStats {
+		st := ov.Nodes[id]
+		if st == nil {
+			st = &NodeStats{}
+			ov.Nodes[id] = st
+		}
+		return st
+	}
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 0, 64*1024), 2*1024*1024)
+	for sc.Scan() {
+		var ev map[string]any
+		if err := json.Unmarshal(sc.Bytes(), &ev); err != nil {
+			continue
+		}
+		id := eventString(ev["node_id"])
+		switch eventString(ev["event"]) {
+		case "stage_attempt_start":
+			if id == "" {
+				continue
+			}
+			st := stats(id)
+			if eventInt(ev["attempt"]) > 1 {
+				st.Retries++
+			} else {
+				st.Visits++
+			}
+			inFlight[id] = true
+		case "stage_attempt_end":
+			if id == "" {
+				continue
+			}
+			st := stats(id)
+			st.Status = eventString(ev["status"])
+			st.Duration += time.Duration(eventInt(ev["duration_ms"])) * time.Millisecond
+			delete(inFlight, id)
+		case "edge_selected":
+			ov.Transitions = append(ov.Transitions, Transition{
+				From:      eventString(ev["from_node"]),
+				To:        eventString(ev["to_node"]),
+				Label:     eventString(ev["label"]),
+				Condition: eventString(ev["condition"]),
+			})
+		case "loop_restart":
+			ov.Restarts++
+		}
+	}
+	return true, sc.Err()
+}
+
+// EdgeCounts maps each graph edge to how many times the run took it. A
+// transition matches the edge with the same endpoints, label and condition,
+// falling back to the first edge between the endpoints.
+func (ov *Overlay) EdgeCounts(g *model.Graph) map[*model.Edge]int {
+	counts := map[*model.Edge]int{}
+	if ov == nil {
+		return counts
+	}
+	for _, t := range ov.Transitions {
+		var match *model.Edge
+		for _, e := range g.Outgoing(t.From) {
+			if e.To != t.To {
+				continue
+			}
+			if match == nil {
+				match = e
+			}
+			if e.Label() == t.Label && e.Condition() == t.Condition {
+				match = e
+				break
+			}
+		}
+		if match != nil {
+			counts[match]++
+		}
+	}
+	return counts
+}
+
+func eventInt(v any) int {
+	switch t := v.(type) {
+	case float64:
+		return int(t)
+	case string:
+		n, _ := strconv.Atoi(t)
+		return n
+	default:
+		return 0
+	}
+}
+
+func eventString(v any) string {
+	switch t := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return strings.TrimSpace(t)
+	default:
+		return strings.TrimSpace(fmt.Sprint(t))
+	}
+}
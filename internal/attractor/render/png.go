@@ -0,0 +1,202 @@
+package render
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+)
+
+// pngScale is image pixels per layout unit.
+const pngScale = 2.0
+
+// WritePNG rasterizes l with the same geometry as the SVG, using the built-in
+// bitmap font for text.
+func WritePNG(w io.Writer, l *Layout) error {
+	c := &canvas{img: image.NewRGBA(image.Rect(0, 0, int(math.Ceil(l.Width*pngScale)), int(math.Ceil(l.Height*pngScale))))}
+	draw.Draw(c.img, c.img.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	c.text(margin, margin+14, l.Caption, hexColor("#111827"), 3, false)
+
+	for _, p := range l.Edges {
+		hex, width, _ := edgeStyle(l, p)
+		col := hexColor(hex)
+		if isLoopRestart(p.Edge) {
+			c.dashed(p.Points, width, col)
+		} else {
+			c.polyline(p.Points, width, col)
+		}
+		c.arrowhead(p.Points[len(p.Points)-2], p.Points[len(p.Points)-1], col)
+		if p.Label != "" {
+			tw := float64(len([]rune(p.Label))) * 6 // 6 font pixels per char at 2 image pixels each
+			c.fillPolygon(rect(p.LabelAt.X-tw/2-2, p.LabelAt.Y-6, p.LabelAt.X+tw/2+2, p.LabelAt.Y+6), color.RGBA{255, 255, 255, 255})
+			c.text(p.LabelAt.X, p.LabelAt.Y+3.5, p.Label, col, 2, true)
+		}
+	}
+
+	for _, n := range l.Nodes {
+		strokeHex, width, opacity := nodeStyle(l, n)
+		fade := func(hex string) color.RGBA { return mix(hexColor(hex), opacity) }
+		shape := outline(n)
+		c.fillPolygon(shape, fade(n.Style.Fill))
+		c.polyline(append(shape, shape[0]), width, fade(strokeHex))
+		if n.Style.Shape == "doubleellipse" {
+			inner := ellipse(n.X, n.Y, n.W/2-4, n.H/2-4)
+			c.polyline(append(inner, inner[0]), 1, fade(strokeHex))
+		}
+		lines := n.TextLines()
+		y := n.Y - float64(len(lines))*lineH/2 + lineH*0.75
+		for i, line := range lines {
+			col := fade("#111827")
+			switch {
+			case i == len(n.Lines)-1:
+				col = fade("#6b7280")
+			case i == len(n.Lines):
+				col = fade(statusColor(n.Stats.Status))
+			}
+			c.text(n.X, y, line, col, 2, true)
+			y += lineH
+		}
+	}
+	return png.Encode(w, c.img)
+}
+
+type canvas struct {
+	img *image.RGBA
+}
+
+// fillPolygon fills pts (layout units) with the even-odd rule.
+func (c *canvas) fillPolygon(pts []Point, col color.RGBA) {
+	if len(pts) < 3 {
+		return
+	}
+	minY, maxY := math.Inf(1), math.Inf(-1)
+	for _, p := range pts {
+		minY, maxY = math.Min(minY, p.Y*pngScale), math.Max(maxY, p.Y*pngScale)
+	}
+	b := c.img.Bounds()
+	var xs []float64
+	for py := max(int(math.Floor(minY)), b.Min.Y); py <= min(int(math.Ceil(maxY)), b.Max.Y-1); py++ {
+		yc := float64(py) + 0.5
+		xs = xs[:0]
+		for i := range pts {
+			a, q := pts[i], pts[(i+1)%len(pts)]
+			ay, qy := a.Y*pngScale, q.Y*pngScale
+			if (ay <= yc) == (qy <= yc) {
+				continue
+			}
+			xs = append(xs, a.X*pngScale+(yc-ay)/(qy-ay)*(q.X-a.X)*pngScale)
+		}
+		sort.Float64s(xs)
+		for i := 0; i+1 < len(xs); i += 2 {
+			for px := max(int(math.Ceil(xs[i]-0.5)), b.Min.X); px <= min(int(math.Floor(xs[i+1]-0.5)), b.Max.X-1); px++ {
+				c.img.SetRGBA(px, py, col)
+			}
+		}
+	}
+}
+
+// polyline strokes pts with round joins; width is in layout units.
+func (c *canvas) polyline(pts []Point, width float64, col color.RGBA) {
+	hw := math.Max(width/2, 0.5/pngScale)
+	for i := 1; i < len(pts); i++ {
+		a, b := pts[i-1], pts[i]
+		dx, dy := b.X-a.X, b.Y-a.Y
+		d := math.Hypot(dx, dy)
+		if d == 0 {
+			continue
+		}
+		nx, ny := -dy/d*hw, dx/d*hw
+		c.fillPolygon([]Point{{a.X + nx, a.Y + ny}, {b.X + nx, b.Y + ny}, {b.X - nx, b.Y - ny}, {a.X - nx, a.Y - ny}}, col)
+		if i > 1 {
+			c.fillPolygon(ellipse(a.X, a.Y, hw, hw), col)
+		}
+	}
+}
+
+// dashed strokes pts as 6-on, 4-off dashes, like the SVG dasharray.
+func (c *canvas) dashed(pts []Point, width float64, col color.RGBA) {
+	const on, off = 6.0, 4.0
+	pos := 0.0
+	for i := 1; i < len(pts); i++ {
+		a, b := pts[i-1], pts[i]
+		d := math.Hypot(b.X-a.X, b.Y-a.Y)
+		for t := 0.0; t < d; {
+			phase := math.Mod(pos, on+off)
+			step := math.Min(d-t, on+off-phase)
+			if phase < on {
+				step = math.Min(d-t, on-phase)
+				p0 := Point{a.X + (b.X-a.X)*t/d, a.Y + (b.Y-a.Y)*t/d}
+				p1 := Point{a.X + (b.X-a.X)*(t+step)/d, a.Y + (b.Y-a.Y)*(t+step)/d}
+				c.polyline([]Point{p0, p1}, width, col)
+			}
+			t += step
+			pos += step
+		}
+	}
+}
+
+func (c *canvas) arrowhead(from, tip Point, col color.RGBA) {
+	dx, dy := tip.X-from.X, tip.Y-from.Y
+	d := math.Hypot(dx, dy)
+	if d == 0 {
+		return
+	}
+	const size = 8.0
+	ux, uy := dx/d, dy/d
+	bx, by := tip.X-ux*size, tip.Y-uy*size
+	c.fillPolygon([]Point{tip, {bx - uy*size*0.45, by + ux*size*0.45}, {bx + uy*size*0.45, by - ux*size*0.45}}, col)
+}
+
+// text draws s with its baseline at y; px is image pixels per font pixel.
+func (c *canvas) text(x, y float64, s string, col color.RGBA, px int, center bool) {
+	runes := []rune(s)
+	x0 := int(math.Round(x * pngScale))
+	if center {
+		x0 -= len(runes) * 6 * px / 2
+	}
+	y0 := int(math.Round(y*pngScale)) - 7*px
+	b := c.img.Bounds()
+	for i, r := range runes {
+		g := glyph(r)
+		for row := 0; row < 7; row++ {
+			for col5 := 0; col5 < 5; col5++ {
+				if g[row]&(1<<(4-col5)) == 0 {
+					continue
+				}
+				for dy := 0; dy < px; dy++ {
+					for dx := 0; dx < px; dx++ {
+						p := image.Point{x0 + (i*6+col5)*px + dx, y0 + row*px + dy}
+						if p.In(b) {
+							c.img.SetRGBA(p.X, p.Y, col)
+						}
+					}
+				}
+			}
+		}
+	}
+}
+
+func rect(x0, y0, x1, y1 float64) []Point {
+	return []Point{{x0, y0}, {x1, y0}, {x1, y1}, {x0, y1}}
+}
+
+func hexColor(s string) color.RGBA {
+	if len(s) != 7 || s[0] != '#' {
+		return color.RGBA{0, 0, 0, 255}
+	}
+	v, err := strconv.ParseUint(s[1:], 16, 32)
+	if err != nil {
+		return color.RGBA{0, 0, 0, 255}
+	}
+	return color.RGBA{uint8(v >> 16), uint8(v >> 8), uint8(v), 255}
+}
+
+// mix fades col toward white; opacity 1 leaves it unchanged.
+func mix(col color.RGBA, opacity float64) color.RGBA {
+	f := func(v uint8) uint8 { return uint8(math.Round(float64(v)*opacity + 255*(1-opacity))) }
+	return color.RGBA{f(col.R), f(col.G), f(col.B), 255}
+}
@@ -0,0 +1,172 @@
+// Package render draws a pipeline graph as SVG, PNG, HTML or Mermaid without
+// the graphviz binary. Nodes are styled by handler type (the shape→type
+// mapping the engine dispatches on), and an optional run Overlay colors them
+// by status and highlights the edges the run took.
+package render
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/danshapiro/kilroy/internal/attractor/model"
+	"github.com/danshapiro/kilroy/internal/attractor/textutil"
+)
+
+type Format string
+
+const (
+	FormatSVG     Format = "svg"
+	FormatPNG     Format = "png"
+	FormatHTML    Format = "html"
+	FormatMermaid Format = "mermaid"
+)
+
+// ParseFormat accepts a format name or a file extension (".mmd" is Mermaid).
+func ParseFormat(s string) (Format, error) {
+	switch strings.ToLower(strings.TrimPrefix(strings.TrimSpace(s), ".")) {
+	case "svg":
+		return FormatSVG, nil
+	case "png":
+		return FormatPNG, nil
+	case "html", "htm":
+		return FormatHTML, nil
+	case "mermaid", "mmd":
+		return FormatMermaid, nil
+	}
+	return "", fmt.Errorf("unknown format %q (want svg, png, html or mermaid)", s)
+}
+
+// Render writes g in the given format. ov may be nil.
+func Render(w io.Writer, g *model.Graph, ov *Overlay, f Format) error {
+	switch f {
+	case FormatSVG:
+		return WriteSVG(w, ComputeLayout(g, ov))
+	case FormatPNG:
+		return WritePNG(w, ComputeLayout(g, ov))
+	case FormatHTML:
+		return WriteHTML(w, ComputeLayout(g, ov))
+	case FormatMermaid:
+		return WriteMermaid(w, g, ov)
+	}
+	return fmt.Errorf("unknown format %q", f)
+}
+
+// typeStyle is how a handler type is drawn.
+type typeStyle struct {
+	Fill, Stroke string
+	Shape        string // rect, ellipse, doubleellipse, diamond, hexagon, parallelogram, octagon, house
+}
+
+var typeStyles = map[string]typeStyle{
+	"start":              {"#d1fae5", "#059669", "ellipse"},
+	"exit":               {"#e5e7eb", "#374151", "doubleellipse"},
+	"codergen":           {"#dbeafe", "#2563eb", "rect"},
+	"conditional":        {"#fef3c7", "#d97706", "diamond"},
+	"wait.human":         {"#fce7f3", "#db2777", "hexagon"},
+	"parallel":           {"#ede9fe", "#7c3aed", "rect"},
+	"parallel.fan_in":    {"#ede9fe", "#7c3aed", "octagon"},
+	"tool":               {"#cffafe", "#0891b2", "parallelogram"},
+	"stack.manager_loop": {"#ffedd5", "#ea580c", "house"},
+}
+
+var customTypeStyle = typeStyle{"#f3f4f6", "#6b7280", "rect"}
+
+func styleFor(handlerType string) typeStyle {
+	if s, ok := typeStyles[handlerType]; ok {
+		return s
+	}
+	return customTypeStyle
+}
+
+// statusColors outline nodes by their last stage status.
+var statusColors = map[string]string{
+	"success":         "#16a34a",
+	"partial_success": "#65a30d",
+	"fail":            "#dc2626",
+	"retry":           "#ea580c",
+	"skipped":         "#6b7280",
+	"running":         "#2563eb",
+	"interrupted":     "#a16207",
+}
+
+func statusColor(status string) string {
+	if c, ok := statusColors[status]; ok {
+		return c
+	}
+	return "#111827"
+}
+
+const (
+	edgeColor      = "#4b5563"
+	edgeIdleColor  = "#c0c4cc"
+	edgeTakenColor = "#111827"
+)
+
+// statsLine summarizes a node's run stats, e.g.
+// "success · 2 visits · 1 retry · 1m3s".
+func statsLine(st *NodeStats) string {
+	parts := []string{st.Status}
+	if st.Visits != 1 {
+		parts = append(parts, fmt.Sprintf("%d visits", st.Visits))
+	}
+	switch st.Retries {
+	case 0:
+	case 1:
+		parts = append(parts, "1 retry")
+	default:
+		parts = append(parts, fmt.Sprintf("%d retries", st.Retries))
+	}
+	if st.Duration > 0 {
+		parts = append(parts, formatDuration(st.Duration))
+	}
+	return strings.Join(parts, " · ")
+}
+
+func formatDuration(d time.Duration) string {
+	switch {
+	case d < time.Second:
+		return d.Round(time.Millisecond).String()
+	case d < 10*time.Second:
+		return d.Round(100 * time.Millisecond).String()
+	default:
+		return d.Round(time.Second).String()
+	}
+}
+
+// edgeText is what an edge is labeled with: its label, else its condition.
+func edgeText(e *model.Edge) string {
+	t := strings.TrimSpace(e.Label())
+	if t == "" {
+		t = strings.TrimSpace(e.Condition())
+	}
+	return textutil.Truncate(t, 40)
+}
+
+func isLoopRestart(e *model.Edge) bool {
+	return strings.EqualFold(e.Attr("loop_restart", "false"), "true")
+}
+
+// caption is the title line drawn above the graph.
+func caption(g *model.Graph, ov *Overlay) string {
+	name := g.Name
+	if name == "" {
+		name = "pipeline"
+	}
+	if ov == nil {
+		return name
+	}
+	s := name + " · " + string(ov.State)
+	if ov.RunID != "" {
+		s = name + " · run " + ov.RunID + " · " + string(ov.State)
+	}
+	switch ov.Restarts {
+	case 0:
+	case 1:
+		s += " · 1 restart"
+	default:
+		s += fmt.Sprintf(" · %d restarts", ov.Restarts)
+	}
+	return s
+}
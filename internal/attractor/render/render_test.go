@@ -0,0 +1,245 @@
+package render
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/danshapiro/kilroy/internal/attractor/dot"
+	"github.com/danshapiro/kilroy/internal/attractor/model"
+	"github.com/danshapiro/kilroy/internal/attractor/runstate"
+)
+
+const reviewDOT = `
+digraph review {
+  start  [shape=Mdiamond]
+  end    [shape=Msquare, label="Done"]
+  impl   [shape=box, label="Implement"]
+  fan    [shape=component]
+  a      [shape=box]
+  b      [shape=parallelogram]
+  join   [shape=tripleoctagon]
+  review [shape=diamond]
+  start -> impl -> review
+  review -> end  [label="approve", condition="outcome=success"]
+  review -> impl [label="rework"]
+  review -> fan  [label="split"]
+  fan -> a -> join
+  fan -> b -> join
+  join -> end
+  start -> end   [label="skip \"all\""]
+}
+`
+
+func parseGraph(t *testing.T, src string) *model.Graph {
+	t.Helper()
+	g, err := dot.Parse([]byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return g
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// writeRun lays out a run that went start → impl → ... → review, looped back
+// to impl after a loop_restart, retried impl once, and finished.
+func writeRun(t *testing.T) string {
+	t.Helper()
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "progress.ndjson"), strings.Join([]string{
+		`{"event":"run_started","run_id":"r1"}`,
+		`{"event":"stage_attempt_start","node_id":"start","attempt":1,"max":1}`,
+		`{"event":"stage_attempt_end","node_id":"start","attempt":1,"status":"success","duration_ms":5}`,
+		`{"event":"edge_selected","from_node":"start","to_node":"impl"}`,
+		`{"event":"stage_attempt_start","node_id":"impl","attempt":1,"max":3}`,
+		`{"event":"stage_attempt_end","node_id":"impl","attempt":1,"status":"fail","duration_ms":1000}`,
+		`{"event":"stage_attempt_start","node_id":"impl","attempt":2,"max":3}`,
+		`{"event":"stage_attempt_end","node_id":"impl","attempt":2,"status":"success","duration_ms":2500}`,
+		`{"event":"edge_selected","from_node":"impl","to_node":"review"}`,
+		`not json`,
+		`{"event":"stage_attempt_start","node_id":"review","attempt":1,"max":1}`,
+		`{"event":"stage_attempt_end","node_id":"review","attempt":1,"status":"success","duration_ms":10}`,
+		`{"event":"edge_selected","from_node":"review","to_node":"impl","label":"rework"}`,
+		`{"event":"loop_restart","restart_count":1,"target_node":"impl"}`,
+	}, "\n")+"\n")
+	writeFile(t, filepath.Join(root, "restart-1", "progress.ndjson"), strings.Join([]string{
+		`{"event":"stage_attempt_start","node_id":"impl","attempt":1,"max":3}`,
+		`{"event":"stage_attempt_end","node_id":"impl","attempt":1,"status":"success","duration_ms":500}`,
+		`{"event":"edge_selected","from_node":"impl","to_node":"review"}`,
+		`{"event":"stage_attempt_start","node_id":"review","attempt":1,"max":1}`,
+		`{"event":"stage_attempt_end","node_id":"review","attempt":1,"status":"success","duration_ms":10}`,
+		`{"event":"edge_selected","from_node":"review","to_node":"end","label":"approve","condition":"outcome=success"}`,
+		`{"event":"stage_attempt_start","node_id":"end","attempt":1,"max":1}`,
+	}, "\n")+"\n")
+	writeFile(t, filepath.Join(root, "restart-1", "final.json"), `{"status":"success","run_id":"r1"}`)
+	return root
+}
+
+func TestComputeLayout_RanksNodesAndRoutesBackEdges(t *testing.T) {
+	g := parseGraph(t, reviewDOT)
+	l := ComputeLayout(g, nil)
+	boxes := map[string]*NodeBox{}
+	for _, b := range l.Nodes {
+		boxes[b.ID] = b
+	}
+	if l.Nodes[0].ID != "start" || boxes["start"].Type != "start" || boxes["join"].Type != "parallel.fan_in" || boxes["b"].Style.Shape != "parallelogram" {
+		t.Fatalf("nodes: %+v", l.Nodes[0])
+	}
+	for _, pair := range [][2]string{{"start", "impl"}, {"impl", "review"}, {"review", "fan"}, {"fan", "a"}, {"a", "join"}, {"join", "end"}} {
+		if boxes[pair[0]].Rank >= boxes[pair[1]].Rank || boxes[pair[0]].Y >= boxes[pair[1]].Y {
+			t.Fatalf("%s should rank above %s: %+v %+v", pair[0], pair[1], boxes[pair[0]], boxes[pair[1]])
+		}
+	}
+	if a, b := boxes["a"], boxes["b"]; a.Rank != b.Rank || a.X+a.W/2+nodeSep > b.X-b.W/2+0.001 && b.X+b.W/2+nodeSep > a.X-a.W/2+0.001 {
+		t.Fatalf("parallel branches overlap: %+v %+v", a, b)
+	}
+	for _, b := range l.Nodes {
+		if b.X-b.W/2 < margin-0.001 || b.X+b.W/2 > l.Width-margin+0.001 || b.Y+b.H/2 > l.Height {
+			t.Fatalf("%s outside the canvas (%.0fx%.0f): %+v", b.ID, l.Width, l.Height, b)
+		}
+	}
+	var rework, skip *EdgePath
+	for _, p := range l.Edges {
+		switch p.Label {
+		case "rework":
+			rework = p
+		case `skip "all"`:
+			skip = p
+		}
+	}
+	if rework == nil || !rework.Back || rework.Points[0].Y <= rework.Points[len(rework.Points)-1].Y {
+		t.Fatalf("rework edge should loop upward: %+v", rework)
+	}
+	// start → end spans every rank, so it is routed through dummies.
+	if skip == nil || skip.Back || len(skip.Points) != boxes["end"].Rank+1 {
+		t.Fatalf("skip edge: %+v", skip)
+	}
+}
+
+func TestLoadOverlay_MergesRestartSegments(t *testing.T) {
+	ov, err := LoadOverlay(writeRun(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ov.State != runstate.StateSuccess || ov.RunID != "r1" || ov.Restarts != 1 || len(ov.Transitions) != 5 {
+		t.Fatalf("overlay: %+v", ov)
+	}
+	impl := ov.Nodes["impl"]
+	if impl.Status != "success" || impl.Visits != 2 || impl.Retries != 1 || impl.Duration != 4*time.Second {
+		t.Fatalf("impl: %+v", impl)
+	}
+	// end started but never reported, and the run is over.
+	if ov.Nodes["end"].Status != "interrupted" || ov.Nodes["fan"] != nil {
+		t.Fatalf("nodes: end=%+v fan=%+v", ov.Nodes["end"], ov.Nodes["fan"])
+	}
+
+	g := parseGraph(t, reviewDOT)
+	counts := ov.EdgeCounts(g)
+	got := map[string]int{}
+	for e, n := range counts {
+		got[e.From+"->"+e.To] = n
+	}
+	if len(got) != 4 || got["impl->review"] != 2 || got["review->end"] != 1 || got["review->impl"] != 1 || got["start->impl"] != 1 {
+		t.Fatalf("edge counts: %v", got)
+	}
+
+	if _, err := LoadOverlay(t.TempDir()); err == nil || !strings.Contains(err.Error(), "no progress.ndjson") {
+		t.Fatalf("empty logs root: %v", err)
+	}
+}
+
+func TestRender_AllFormatsWithOverlay(t *testing.T) {
+	g := parseGraph(t, reviewDOT)
+	ov, err := LoadOverlay(writeRun(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := map[Format]string{}
+	for _, f := range []Format{FormatSVG, FormatPNG, FormatHTML, FormatMermaid} {
+		var buf bytes.Buffer
+		if err := Render(&buf, g, ov, f); err != nil {
+			t.Fatalf("%s: %v", f, err)
+		}
+		out[f] = buf.String()
+	}
+
+	dec := xml.NewDecoder(strings.NewReader(out[FormatSVG]))
+	for {
+		if _, err := dec.Token(); err != nil {
+			if !errors.Is(err, io.EOF) {
+				t.Fatalf("svg is not well-formed: %v", err)
+			}
+			break
+		}
+	}
+	for _, want := range []string{
+		`review · run r1 · success · 1 restart`,
+		`data-from="impl" data-to="review" data-taken="2"`,
+		`data-from="start" data-to="end" data-taken="0"`,
+		`success · 2 visits · 1 retry · 4s`,
+		`skip &quot;all&quot;`,
+		`stroke="` + statusColors["success"] + `" stroke-width="3.0"`,
+	} {
+		if !strings.Contains(out[FormatSVG], want) {
+			t.Fatalf("svg missing %q:\n%s", want, out[FormatSVG])
+		}
+	}
+
+	img, err := png.Decode(strings.NewReader(out[FormatPNG]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := ComputeLayout(g, ov)
+	if b := img.Bounds(); b.Dx() != int(l.Width*pngScale+0.999) || b.Dy() != int(l.Height*pngScale+0.999) {
+		t.Fatalf("png bounds %v for layout %.1fx%.1f", b, l.Width, l.Height)
+	}
+
+	if !strings.Contains(out[FormatHTML], "<svg") || !strings.Contains(out[FormatHTML], "<td>impl</td><td>codergen</td><td>success</td><td class=\"num\">2</td><td class=\"num\">1</td><td class=\"num\">4s</td>") || !strings.Contains(out[FormatHTML], "<td>fan</td><td>parallel</td><td>not reached</td>") {
+		t.Fatalf("html:\n%s", out[FormatHTML])
+	}
+
+	for _, want := range []string{
+		"flowchart TD\n",
+		`    start(["start<br/><i>start</i><br/>success · 5ms"])`,
+		`    end_((("Done<br/><i>exit</i><br/>interrupted")))`,
+		`    review{"review<br/><i>conditional</i><br/>success · 2 visits · 20ms"}`,
+		`    join[/"join<br/><i>parallel.fan_in</i>"\]`,
+		`    review -->|"approve"| end_`,
+		`    start -->|"skip #quot;all#quot;"| end_`,
+		`    impl -->|"×2"| review`,
+		"    classDef type_parallel_fan_in fill:#ede9fe,stroke:#7c3aed,color:#111827\n",
+		"    class fan,a,b,join unvisited\n",
+		"    linkStyle 0,1,2,3 stroke:#111827,stroke-width:3px\n",
+	} {
+		if !strings.Contains(out[FormatMermaid], want) {
+			t.Fatalf("mermaid missing %q:\n%s", want, out[FormatMermaid])
+		}
+	}
+}
+
+func TestParseFormat(t *testing.T) {
+	for in, want := range map[string]Format{"svg": FormatSVG, ".PNG": FormatPNG, "htm": FormatHTML, ".mmd": FormatMermaid, "mermaid": FormatMermaid} {
+		if got, err := ParseFormat(in); err != nil || got != want {
+			t.Fatalf("ParseFormat(%q) = %q, %v", in, got, err)
+		}
+	}
+	if _, err := ParseFormat("gif"); err == nil {
+		t.Fatal("gif should be rejected")
+	}
+}
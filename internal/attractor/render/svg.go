@@ -0,0 +1,148 @@
+package render
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/danshapiro/kilroy/internal/attractor/textutil"
+)
+
+// WriteSVG writes l as a standalone SVG document.
+func WriteSVG(w io.Writer, l *Layout) error {
+	_, err := io.WriteString(w, `<?xml version="1.0" encoding="UTF-8"?>`+"\n"+svgElement(l))
+	return err
+}
+
+var xmlEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", `"`, "&quot;")
+
+func esc(s string) string { return xmlEscaper.Replace(s) }
+
+// svgElement is l as an <svg> element, for embedding in HTML.
+func svgElement(l *Layout) string {
+	var b strings.Builder
+	pf := func(format string, args ...any) { fmt.Fprintf(&b, format, args...) }
+
+	pf(`<svg xmlns="http://www.w3.org/2000/svg" width="%.0f" height="%.0f" viewBox="0 0 %.0f %.0f" font-family="Helvetica, Arial, sans-serif" font-size="12">`+"\n", l.Width, l.Height, l.Width, l.Height)
+	pf("<defs>\n")
+	for _, m := range []struct{ id, color string }{{"arrow", edgeColor}, {"arrow-idle", edgeIdleColor}, {"arrow-taken", edgeTakenColor}} {
+		pf(`<marker id="%s" viewBox="0 0 10 10" refX="9" refY="5" markerWidth="7" markerHeight="7" orient="auto"><path d="M0,0 L10,5 L0,10 z" fill="%s"/></marker>`+"\n", m.id, m.color)
+	}
+	pf("</defs>\n")
+	pf(`<rect width="100%%" height="100%%" fill="#ffffff"/>` + "\n")
+	pf(`<text x="%.0f" y="%.0f" font-size="14" font-weight="bold" fill="#111827">%s</text>`+"\n", margin, margin+14, esc(l.Caption))
+
+	for _, p := range l.Edges {
+		color, width, marker := edgeStyle(l, p)
+		dash := ""
+		if isLoopRestart(p.Edge) {
+			dash = ` stroke-dasharray="6 4"`
+		}
+		pf(`<g class="edge" data-from="%s" data-to="%s" data-taken="%d"><title>%s</title>`, esc(p.Edge.From), esc(p.Edge.To), p.Taken, esc(edgeTitle(p)))
+		pf(`<path d="%s" fill="none" stroke="%s" stroke-width="%.1f"%s marker-end="url(#%s)"/>`, svgPath(p.Points), color, width, dash, marker)
+		if p.Label != "" {
+			pf(`<text x="%.1f" y="%.1f" text-anchor="middle" font-size="11" fill="%s" stroke="#ffffff" stroke-width="3" paint-order="stroke">%s</text>`, p.LabelAt.X, p.LabelAt.Y+4, color, esc(p.Label))
+		}
+		pf("</g>\n")
+	}
+
+	for _, n := range l.Nodes {
+		stroke, width, opacity := nodeStyle(l, n)
+		pf(`<g class="node" id="node-%s"`, esc(n.ID))
+		if opacity < 1 {
+			pf(` opacity="%.2f"`, opacity)
+		}
+		pf(`><title>%s</title>`, esc(nodeTitle(n)))
+		switch n.Style.Shape {
+		case "rect":
+			pf(`<rect x="%.1f" y="%.1f" width="%.1f" height="%.1f" rx="6" fill="%s" stroke="%s" stroke-width="%.1f"/>`, n.X-n.W/2, n.Y-n.H/2, n.W, n.H, n.Style.Fill, stroke, width)
+		case "ellipse", "doubleellipse":
+			pf(`<ellipse cx="%.1f" cy="%.1f" rx="%.1f" ry="%.1f" fill="%s" stroke="%s" stroke-width="%.1f"/>`, n.X, n.Y, n.W/2, n.H/2, n.Style.Fill, stroke, width)
+			if n.Style.Shape == "doubleellipse" {
+				pf(`<ellipse cx="%.1f" cy="%.1f" rx="%.1f" ry="%.1f" fill="none" stroke="%s" stroke-width="1"/>`, n.X, n.Y, n.W/2-4, n.H/2-4, stroke)
+			}
+		default:
+			var pts []string
+			for _, p := range outline(n) {
+				pts = append(pts, fmt.Sprintf("%.1f,%.1f", p.X, p.Y))
+			}
+			pf(`<polygon points="%s" fill="%s" stroke="%s" stroke-width="%.1f"/>`, strings.Join(pts, " "), n.Style.Fill, stroke, width)
+		}
+		lines := n.TextLines()
+		y := n.Y - float64(len(lines))*lineH/2 + lineH*0.75
+		for i, line := range lines {
+			attrs := `font-weight="600" fill="#111827"`
+			switch {
+			case i == len(n.Lines)-1:
+				attrs = `font-size="10" font-style="italic" fill="#6b7280"`
+			case i == len(n.Lines):
+				attrs = fmt.Sprintf(`font-size="11" font-weight="600" fill="%s"`, statusColor(n.Stats.Status))
+			}
+			pf(`<text x="%.1f" y="%.1f" text-anchor="middle" %s>%s</text>`, n.X, y, attrs, esc(line))
+			y += lineH
+		}
+		pf("</g>\n")
+	}
+	pf("</svg>\n")
+	return b.String()
+}
+
+func svgPath(pts []Point) string {
+	var b strings.Builder
+	for i, p := range pts {
+		if i == 0 {
+			fmt.Fprintf(&b, "M%.1f,%.1f", p.X, p.Y)
+		} else {
+			fmt.Fprintf(&b, " L%.1f,%.1f", p.X, p.Y)
+		}
+	}
+	return b.String()
+}
+
+// edgeStyle is an edge's color, stroke width and arrow marker: taken edges
+// stand out and the rest fade when a run is overlaid.
+func edgeStyle(l *Layout, p *EdgePath) (string, float64, string) {
+	switch {
+	case l.Overlay == nil:
+		return edgeColor, 1.5, "arrow"
+	case p.Taken > 0:
+		return edgeTakenColor, 2.5, "arrow-taken"
+	default:
+		return edgeIdleColor, 1.2, "arrow-idle"
+	}
+}
+
+// nodeStyle is a node's outline color, width and opacity: outlined by status
+// when a run is overlaid, faded when the run never reached it.
+func nodeStyle(l *Layout, n *NodeBox) (string, float64, float64) {
+	switch {
+	case l.Overlay == nil:
+		return n.Style.Stroke, 1.5, 1
+	case n.Stats != nil:
+		return statusColor(n.Stats.Status), 3, 1
+	default:
+		return n.Style.Stroke, 1, 0.45
+	}
+}
+
+func nodeTitle(n *NodeBox) string {
+	s := n.ID + " (" + n.Type + ")"
+	if n.Stats != nil {
+		s += "\n" + statsLine(n.Stats)
+	}
+	if p := textutil.FirstLine(n.Node.Prompt()); p != "" {
+		s += "\n" + textutil.Truncate(p, 120)
+	}
+	return s
+}
+
+func edgeTitle(p *EdgePath) string {
+	s := p.Edge.From + " → " + p.Edge.To
+	if c := p.Edge.Condition(); c != "" {
+		s += " [" + c + "]"
+	}
+	if p.Taken > 0 {
+		s += fmt.Sprintf(" (taken %d×)", p.Taken)
+	}
+	return s
+}
@@ -0,0 +1,309 @@
+package rundiff
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/danshapiro/kilroy/internal/attractor/gitutil"
+	"github.com/danshapiro/kilroy/internal/attractor/textutil"
+)
+
+// RunRef identifies one side of a comparison.
+type RunRef struct {
+	LogsRoot       string `json:"logs_root"`
+	RunID          string `json:"run_id,omitempty"`
+	RunBranch      string `json:"run_branch,omitempty"`
+	FinalStatus    string `json:"final_status,omitempty"`
+	FinalCommitSHA string `json:"final_commit_sha,omitempty"`
+	FailureReason  string `json:"failure_reason,omitempty"`
+	DurationMS     int64  `json:"duration_ms"`
+	InputTokens    int64  `json:"input_tokens"`
+	OutputTokens   int64  `json:"output_tokens"`
+	Retries        int    `json:"retries"`
+}
+
+// Divergence is the first routing decision that differs. A or B is nil when
+// one run stopped routing before the other.
+type Divergence struct {
+	Step int    `json:"step"` // 1-based index into the edge sequence
+	From string `json:"from"`
+	A    *Edge  `json:"a,omitempty"`
+	B    *Edge  `json:"b,omitempty"`
+}
+
+// NodeDiff pairs a node's summaries; A or B is nil if only one run visited it.
+// Changes lists the behavioral fields that differ (duration and token deltas
+// are reported but not counted as changes).
+type NodeDiff struct {
+	NodeID  string       `json:"node_id"`
+	A       *NodeSummary `json:"a,omitempty"`
+	B       *NodeSummary `json:"b,omitempty"`
+	Changes []string     `json:"changes,omitempty"`
+}
+
+type CodeDiff struct {
+	RepoPath string `json:"repo_path"`
+	FromSHA  string `json:"from_sha"`
+	ToSHA    string `json:"to_sha"`
+	Stat     string `json:"stat"`
+	Patch    string `json:"patch,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+type Report struct {
+	A          RunRef      `json:"a"`
+	B          RunRef      `json:"b"`
+	EdgesA     int         `json:"edges_a"`
+	EdgesB     int         `json:"edges_b"`
+	Divergence *Divergence `json:"divergence,omitempty"`
+	Nodes      []NodeDiff  `json:"nodes"`
+	Code       *CodeDiff   `json:"code,omitempty"`
+}
+
+type Options struct {
+	// RepoPath overrides the repository used for the code diff (default: run A's manifest repo_path).
+	RepoPath string
+	// IncludePatch adds the full unified diff, not just --stat.
+	IncludePatch bool
+}
+
+// Compare builds a report describing how run b differs from run a.
+func Compare(a, b *Run, opts Options) *Report {
+	rep := &Report{
+		A:      runRef(a),
+		B:      runRef(b),
+		EdgesA: len(a.Edges),
+		EdgesB: len(b.Edges),
+	}
+	rep.Divergence = firstDivergence(a.Edges, b.Edges)
+
+	seen := map[string]bool{}
+	for _, id := range append(append([]string{}, a.NodeOrder...), b.NodeOrder...) {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		nd := NodeDiff{NodeID: id, A: a.Nodes[id], B: b.Nodes[id]}
+		nd.Changes = nodeChanges(nd.A, nd.B)
+		rep.Nodes = append(rep.Nodes, nd)
+	}
+
+	if a.FinalCommitSHA != "" && b.FinalCommitSHA != "" && a.FinalCommitSHA != b.FinalCommitSHA {
+		repo := firstNonEmpty(opts.RepoPath, a.RepoPath, b.RepoPath)
+		cd := &CodeDiff{RepoPath: repo, FromSHA: a.FinalCommitSHA, ToSHA: b.FinalCommitSHA}
+		if repo == "" {
+			cd.Error = "repo path unknown; pass --repo"
+		} else if stat, err := gitutil.DiffStat(repo, cd.FromSHA, cd.ToSHA); err != nil {
+			cd.Error = err.Error()
+		} else {
+			cd.Stat = stat
+			if opts.IncludePatch {
+				if patch, err := gitutil.DiffPatch(repo, cd.FromSHA, cd.ToSHA); err != nil {
+					cd.Error = err.Error()
+				} else {
+					cd.Patch = patch
+				}
+			}
+		}
+		rep.Code = cd
+	}
+	return rep
+}
+
+func runRef(r *Run) RunRef {
+	ref := RunRef{
+		LogsRoot:       r.LogsRoot,
+		RunID:          r.RunID,
+		RunBranch:      r.RunBranch,
+		FinalStatus:    r.FinalStatus,
+		FinalCommitSHA: r.FinalCommitSHA,
+		FailureReason:  r.FailureReason,
+		DurationMS:     r.DurationMS,
+	}
+	for _, n := range r.Nodes {
+		ref.InputTokens += n.InputTokens
+		ref.OutputTokens += n.OutputTokens
+		ref.Retries += n.Retries
+	}
+	return ref
+}
+
+func firstDivergence(a, b []Edge) *Divergence {
+	n := len(a)
+	if len(b) < n {
+		n = len(b)
+	}
+	for i := 0; i < n; i++ {
+		if a[i].From != b[i].From || a[i].To != b[i].To {
+			ea, eb := a[i], b[i]
+			return &Divergence{Step: i + 1, From: firstNonEmpty(ea.From, eb.From), A: &ea, B: &eb}
+		}
+	}
+	if len(a) == len(b) {
+		return nil
+	}
+	d := &Divergence{Step: n + 1}
+	if len(a) > n {
+		e := a[n]
+		d.From, d.A = e.From, &e
+	} else {
+		e := b[n]
+		d.From, d.B = e.From, &e
+	}
+	return d
+}
+
+func nodeChanges(a, b *NodeSummary) []string {
+	switch {
+	case a == nil:
+		return []string{"only_in_b"}
+	case b == nil:
+		return []string{"only_in_a"}
+	}
+	var out []string
+	if a.Status != b.Status {
+		out = append(out, "status")
+	}
+	if a.Visits != b.Visits {
+		out = append(out, "visits")
+	}
+	if a.Retries != b.Retries {
+		out = append(out, "retries")
+	}
+	if a.Provider != b.Provider || a.Model != b.Model {
+		out = append(out, "model")
+	}
+	return out
+}
+
+// WriteText renders the report for terminals.
+func (rep *Report) WriteText(w io.Writer) {
+	fmt.Fprintf(w, "A: %s\n", describeRun(rep.A))
+	fmt.Fprintf(w, "B: %s\n\n", describeRun(rep.B))
+
+	if d := rep.Divergence; d == nil {
+		fmt.Fprintf(w, "Routing: identical (%d edges)\n", rep.EdgesA)
+	} else {
+		fmt.Fprintf(w, "Routing diverged at step %d after %q:\n", d.Step, d.From)
+		fmt.Fprintf(w, "  A: %s\n", describeEdge(d.A))
+		fmt.Fprintf(w, "  B: %s\n", describeEdge(d.B))
+	}
+
+	var changed []NodeDiff
+	for _, nd := range rep.Nodes {
+		if len(nd.Changes) > 0 {
+			changed = append(changed, nd)
+		}
+	}
+	fmt.Fprintf(w, "\nNodes: %d compared, %d changed\n", len(rep.Nodes), len(changed))
+	if len(rep.Nodes) > 0 {
+		fmt.Fprintf(w, "  %-24s  %-21s  %-9s  %-40s  %-14s  %s\n", "NODE", "STATUS A->B", "RETRIES", "MODEL A->B", "DURATION DELTA", "TOKEN DELTA")
+		for _, nd := range rep.Nodes {
+			mark := " "
+			if len(nd.Changes) > 0 {
+				mark = "*"
+			}
+			a, b := nd.A, nd.B
+			if a == nil {
+				a = &NodeSummary{Status: "-"}
+			}
+			if b == nil {
+				b = &NodeSummary{Status: "-"}
+			}
+			fmt.Fprintf(w, "%s %-24s  %-21s  %-9s  %-40s  %-14s  %s\n",
+				mark,
+				nd.NodeID,
+				arrow(a.Status, b.Status),
+				fmt.Sprintf("%d->%d", a.Retries, b.Retries),
+				arrow(modelLabel(a), modelLabel(b)),
+				signedDuration(b.DurationMS-a.DurationMS),
+				signedInt((b.InputTokens+b.OutputTokens)-(a.InputTokens+a.OutputTokens)),
+			)
+		}
+	}
+
+	fmt.Fprintf(w, "\nTotals:\n")
+	fmt.Fprintf(w, "  duration       %s -> %s (%s)\n", fmtDuration(rep.A.DurationMS), fmtDuration(rep.B.DurationMS), signedDuration(rep.B.DurationMS-rep.A.DurationMS))
+	fmt.Fprintf(w, "  input tokens   %d -> %d (%s)\n", rep.A.InputTokens, rep.B.InputTokens, signedInt(rep.B.InputTokens-rep.A.InputTokens))
+	fmt.Fprintf(w, "  output tokens  %d -> %d (%s)\n", rep.A.OutputTokens, rep.B.OutputTokens, signedInt(rep.B.OutputTokens-rep.A.OutputTokens))
+	fmt.Fprintf(w, "  retries        %d -> %d (%s)\n", rep.A.Retries, rep.B.Retries, signedInt(int64(rep.B.Retries-rep.A.Retries)))
+
+	switch {
+	case rep.Code == nil && rep.A.FinalCommitSHA != "" && rep.A.FinalCommitSHA == rep.B.FinalCommitSHA:
+		fmt.Fprintf(w, "\nCode: identical final commit %s\n", shortSHA(rep.A.FinalCommitSHA))
+	case rep.Code == nil:
+		fmt.Fprintf(w, "\nCode: unavailable (missing final commit)\n")
+	case rep.Code.Error != "":
+		fmt.Fprintf(w, "\nCode (%s..%s): %s\n", shortSHA(rep.Code.FromSHA), shortSHA(rep.Code.ToSHA), rep.Code.Error)
+	default:
+		fmt.Fprintf(w, "\nCode (%s..%s):\n%s", shortSHA(rep.Code.FromSHA), shortSHA(rep.Code.ToSHA), rep.Code.Stat)
+		if rep.Code.Patch != "" {
+			fmt.Fprintf(w, "\n%s", rep.Code.Patch)
+		}
+	}
+}
+
+func describeRun(r RunRef) string {
+	s := fmt.Sprintf("%s [%s] %s", firstNonEmpty(r.RunID, "?"), firstNonEmpty(r.FinalStatus, "unknown"), r.LogsRoot)
+	if r.FailureReason != "" {
+		s += " — " + textutil.Truncate(strings.TrimSpace(r.FailureReason), 120)
+	}
+	return s
+}
+
+func describeEdge(e *Edge) string {
+	if e == nil {
+		return "(no further routing)"
+	}
+	s := e.From + " -> " + e.To
+	if e.Condition != "" {
+		s += " [" + e.Condition + "]"
+	} else if e.Label != "" {
+		s += " [" + e.Label + "]"
+	}
+	return s
+}
+
+func modelLabel(n *NodeSummary) string {
+	if n.Model == "" {
+		return "-"
+	}
+	if n.Provider == "" {
+		return n.Model
+	}
+	return n.Provider + "/" + n.Model
+}
+
+func arrow(a, b string) string {
+	if a == b {
+		return a
+	}
+	return a + "->" + b
+}
+
+func fmtDuration(ms int64) string {
+	return (time.Duration(ms) * time.Millisecond).Round(time.Second).String()
+}
+
+func signedDuration(ms int64) string {
+	if ms >= 0 {
+		return "+" + fmtDuration(ms)
+	}
+	return "-" + fmtDuration(-ms)
+}
+
+func signedInt(n int64) string {
+	if n >= 0 {
+		return fmt.Sprintf("+%d", n)
+	}
+	return fmt.Sprintf("%d", n)
+}
+
+func shortSHA(sha string) string {
+	if len(sha) > 12 {
+		return sha[:12]
+	}
+	return sha
+}
@@ -0,0 +1,165 @@
+package rundiff
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeEvents(t *testing.T, dir string, events ...map[string]any) {
+	t.Helper()
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	var b strings.Builder
+	for _, ev := range events {
+		line, _ := json.Marshal(ev)
+		b.Write(line)
+		b.WriteByte('\n')
+	}
+	if err := os.WriteFile(filepath.Join(dir, "progress.ndjson"), []byte(b.String()), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func writeDoc(t *testing.T, path string, doc map[string]any) {
+	t.Helper()
+	b, _ := json.Marshal(doc)
+	if err := os.WriteFile(path, b, 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func git(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %v: %v\n%s", args, err, out)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+func commitFile(t *testing.T, repo, name, content string) string {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(repo, name), []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	git(t, repo, "add", "-A")
+	git(t, repo, "-c", "user.name=t", "-c", "user.email=t@example.com", "commit", "-qm", name)
+	return git(t, repo, "rev-parse", "HEAD")
+}
+
+func ts(sec int) string {
+	return fmt.Sprintf("2026-01-01T00:00:%02dZ", sec)
+}
+
+func TestCompare_ReportsDivergenceNodeChangesAndCodeDiff(t *testing.T) {
+	repo := t.TempDir()
+	git(t, repo, "init", "-q")
+	shaA := commitFile(t, repo, "a.txt", "one\n")
+	shaB := commitFile(t, repo, "b.txt", "two\n")
+
+	rootA := filepath.Join(t.TempDir(), "a")
+	writeEvents(t, rootA,
+		map[string]any{"event": "stage_attempt_start", "node_id": "impl", "attempt": 1, "ts": ts(0)},
+		map[string]any{"event": "llm_request", "node_id": "impl", "provider": "openai", "model": "gpt-5.4", "input_tokens": 100, "output_tokens": 10, "ts": ts(1)},
+		map[string]any{"event": "stage_attempt_end", "node_id": "impl", "status": "fail", "attempt": 1, "ts": ts(5)},
+		map[string]any{"event": "stage_attempt_start", "node_id": "impl", "attempt": 2, "ts": ts(6)},
+		map[string]any{"event": "stage_attempt_end", "node_id": "impl", "status": "success", "attempt": 2, "duration_ms": 4000, "ts": ts(10)},
+		map[string]any{"event": "edge_selected", "from_node": "impl", "to_node": "review", "ts": ts(10)},
+		map[string]any{"event": "edge_selected", "from_node": "review", "to_node": "fix", "condition": "outcome=fail", "ts": ts(20)},
+	)
+	writeDoc(t, filepath.Join(rootA, "manifest.json"), map[string]any{"run_id": "ra", "repo_path": repo})
+	writeDoc(t, filepath.Join(rootA, "final.json"), map[string]any{"status": "fail", "final_git_commit_sha": shaA, "failure_reason": "review rejected"})
+
+	rootB := filepath.Join(t.TempDir(), "b")
+	writeEvents(t, rootB,
+		map[string]any{"event": "stage_attempt_start", "node_id": "impl", "attempt": 1, "ts": ts(0)},
+		map[string]any{"event": "llm_request", "node_id": "impl", "provider": "anthropic", "model": "claude-opus-4-6", "input_tokens": 80, "output_tokens": 8, "ts": ts(1)},
+		map[string]any{"event": "stage_attempt_end", "node_id": "impl", "status": "success", "attempt": 1, "duration_ms": 3000, "ts": ts(3)},
+		map[string]any{"event": "edge_selected", "from_node": "impl", "to_node": "review", "ts": ts(3)},
+		map[string]any{"event": "edge_selected", "from_node": "review", "to_node": "exit", "condition": "outcome=success", "ts": ts(4)},
+	)
+	writeDoc(t, filepath.Join(rootB, "manifest.json"), map[string]any{"run_id": "rb"})
+	writeDoc(t, filepath.Join(rootB, "final.json"), map[string]any{"status": "success", "final_git_commit_sha": shaB})
+
+	a, err := LoadRun(rootA)
+	if err != nil {
+		t.Fatalf("LoadRun a: %v", err)
+	}
+	b, err := LoadRun(rootB)
+	if err != nil {
+		t.Fatalf("LoadRun b: %v", err)
+	}
+	impl := a.Nodes["impl"]
+	if impl.Attempts != 2 || impl.Retries != 1 || impl.Visits != 1 || impl.DurationMS != 9000 {
+		t.Fatalf("run a impl summary: %+v", impl)
+	}
+
+	rep := Compare(a, b, Options{})
+	if d := rep.Divergence; d == nil || d.Step != 2 || d.From != "review" || d.A.To != "fix" || d.B.To != "exit" {
+		t.Fatalf("divergence: %+v", rep.Divergence)
+	}
+	if len(rep.Nodes) != 1 || strings.Join(rep.Nodes[0].Changes, ",") != "retries,model" {
+		t.Fatalf("node diffs: %+v", rep.Nodes)
+	}
+	if rep.A.InputTokens != 100 || rep.B.InputTokens != 80 || rep.A.DurationMS != 20000 {
+		t.Fatalf("totals: a=%+v b=%+v", rep.A, rep.B)
+	}
+	if rep.Code == nil || rep.Code.Error != "" || !strings.Contains(rep.Code.Stat, "b.txt") || rep.Code.Patch != "" {
+		t.Fatalf("code diff: %+v", rep.Code)
+	}
+
+	var out strings.Builder
+	rep.WriteText(&out)
+	for _, want := range []string{
+		`Routing diverged at step 2 after "review":`,
+		"A: review -> fix [outcome=fail]",
+		"B: review -> exit [outcome=success]",
+		"* impl",
+		"1->0",
+		"openai/gpt-5.4->anthropic/claude-opus-4-6",
+		"input tokens   100 -> 80 (-20)",
+		"b.txt",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Fatalf("text output missing %q:\n%s", want, out.String())
+		}
+	}
+}
+
+func TestLoadRun_FollowsLoopRestartSegments(t *testing.T) {
+	root := t.TempDir()
+	writeEvents(t, root,
+		map[string]any{"event": "stage_attempt_start", "node_id": "impl", "attempt": 1, "ts": ts(0)},
+		map[string]any{"event": "stage_attempt_end", "node_id": "impl", "status": "fail", "attempt": 1, "duration_ms": 1000, "ts": ts(1)},
+		map[string]any{"event": "edge_selected", "from_node": "impl", "to_node": "impl", "ts": ts(1)},
+	)
+	writeEvents(t, filepath.Join(root, "restart-1"),
+		map[string]any{"event": "stage_attempt_start", "node_id": "impl", "attempt": 1, "ts": ts(2)},
+		map[string]any{"event": "stage_attempt_end", "node_id": "impl", "status": "success", "attempt": 1, "duration_ms": 2000, "ts": ts(4)},
+		map[string]any{"event": "edge_selected", "from_node": "impl", "to_node": "exit", "ts": ts(4)},
+	)
+	writeDoc(t, filepath.Join(root, "restart-1", "final.json"), map[string]any{"status": "success", "final_git_commit_sha": "abc"})
+
+	r, err := LoadRun(root)
+	if err != nil {
+		t.Fatalf("LoadRun: %v", err)
+	}
+	if len(r.Edges) != 2 || r.FinalStatus != "success" || r.FinalCommitSHA != "abc" || r.DurationMS != 4000 {
+		t.Fatalf("run: %+v", r)
+	}
+	if n := r.Nodes["impl"]; n.Visits != 2 || n.Status != "success" || n.DurationMS != 3000 {
+		t.Fatalf("impl: %+v", n)
+	}
+
+	same := Compare(r, r, Options{})
+	if same.Divergence != nil || same.Code != nil || len(same.Nodes[0].Changes) != 0 {
+		t.Fatalf("self-compare should be clean: %+v", same)
+	}
+}
@@ -0,0 +1,278 @@
+// Package rundiff compares two Attractor runs from their logs roots: where
+// routing diverged, how per-node outcomes, retries, models, durations and
+// token usage differ, and what changed in the code between final commits.
+package rundiff
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/danshapiro/kilroy/internal/attractor/runstate"
+)
+
+// Edge is one edge_selected transition.
+type Edge struct {
+	From      string `json:"from"`
+	To        string `json:"to"`
+	Label     string `json:"label,omitempty"`
+	Condition string `json:"condition,omitempty"`
+}
+
+// NodeSummary aggregates every visit of a node within one run.
+type NodeSummary struct {
+	NodeID       string `json:"node_id"`
+	Visits       int    `json:"visits"`
+	Attempts     int    `json:"attempts"`
+	Retries      int    `json:"retries"`
+	Status       string `json:"status"` // status of the last attempt
+	Provider     string `json:"provider,omitempty"`
+	Model        string `json:"model,omitempty"`
+	DurationMS   int64  `json:"duration_ms"`
+	InputTokens  int64  `json:"input_tokens"`
+	OutputTokens int64  `json:"output_tokens"`
+}
+
+// Run is the comparable view of one run, merged across loop_restart segments.
+type Run struct {
+	LogsRoot       string                  `json:"logs_root"`
+	RunID          string                  `json:"run_id,omitempty"`
+	RunBranch      string                  `json:"run_branch,omitempty"`
+	RepoPath       string                  `json:"repo_path,omitempty"`
+	BaseSHA        string                  `json:"base_sha,omitempty"`
+	FinalStatus    string                  `json:"final_status,omitempty"`
+	FinalCommitSHA string                  `json:"final_commit_sha,omitempty"`
+	FailureReason  string                  `json:"failure_reason,omitempty"`
+	DurationMS     int64                   `json:"duration_ms"`
+	Edges          []Edge                  `json:"edges"`
+	NodeOrder      []string                `json:"node_order"` // first-visit order
+	Nodes          map[string]*NodeSummary `json:"nodes"`
+}
+
+// LoadRun reads manifest.json, final.json and progress.ndjson under logsRoot,
+// following restart-N sub-directories created by loop_restart.
+func LoadRun(logsRoot string) (*Run, error) {
+	root := strings.TrimSpace(logsRoot)
+	if root == "" {
+		return nil, fmt.Errorf("logs root is required")
+	}
+	if _, err := os.Stat(filepath.Join(root, "progress.ndjson")); err != nil {
+		return nil, fmt.Errorf("%s does not look like a logs root: %w", root, err)
+	}
+	r := &Run{LogsRoot: root, Nodes: map[string]*NodeSummary{}}
+	readManifest(r, filepath.Join(root, "manifest.json"))
+
+	segments := runstate.RestartSegments(root)
+	var first, last time.Time
+	for _, seg := range segments {
+		f, l, err := r.readProgress(filepath.Join(seg, "progress.ndjson"))
+		if err != nil {
+			return nil, err
+		}
+		if first.IsZero() || (!f.IsZero() && f.Before(first)) {
+			first = f
+		}
+		if l.After(last) {
+			last = l
+		}
+		// The terminal outcome lives in the last segment that wrote one.
+		readFinal(r, filepath.Join(seg, "final.json"))
+	}
+	if !first.IsZero() && last.After(first) {
+		r.DurationMS = last.Sub(first).Milliseconds()
+	}
+	for _, id := range r.NodeOrder {
+		fillModelFromStageDir(r.Nodes[id], segments)
+	}
+	return r, nil
+}
+
+func readManifest(r *Run, path string) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return
+	}
+	var m struct {
+		RunID     string `json:"run_id"`
+		RunBranch string `json:"run_branch"`
+		RepoPath  string `json:"repo_path"`
+		BaseSHA   string `json:"base_sha"`
+	}
+	if json.Unmarshal(b, &m) != nil {
+		return
+	}
+	r.RunID, r.RunBranch, r.RepoPath, r.BaseSHA = m.RunID, m.RunBranch, m.RepoPath, m.BaseSHA
+}
+
+func readFinal(r *Run, path string) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return
+	}
+	var f struct {
+		Status         string `json:"status"`
+		RunID          string `json:"run_id"`
+		FinalCommitSHA string `json:"final_git_commit_sha"`
+		FailureReason  string `json:"failure_reason"`
+	}
+	if json.Unmarshal(b, &f) != nil {
+		return
+	}
+	r.FinalStatus = f.Status
+	r.FinalCommitSHA = f.FinalCommitSHA
+	r.FailureReason = f.FailureReason
+	if r.RunID == "" {
+		r.RunID = f.RunID
+	}
+}
+
+func (r *Run) node(id string) *NodeSummary {
+	n := r.Nodes[id]
+	if n == nil {
+		n = &NodeSummary{NodeID: id}
+		r.Nodes[id] = n
+		r.NodeOrder = append(r.NodeOrder, id)
+	}
+	return n
+}
+
+// readProgress folds one progress.ndjson into r and returns the first and
+// last event timestamps.
+func (r *Run) readProgress(path string) (time.Time, time.Time, error) {
+	var first, last time.Time
+	f, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return first, last, nil
+		}
+		return first, last, err
+	}
+	defer func() { _ = f.Close() }()
+
+	starts := map[string]time.Time{}
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 0, 64*1024), 2*1024*1024)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" {
+			continue
+		}
+		var ev map[string]any
+		if err := json.Unmarshal([]byte(line), &ev); err != nil {
+			continue
+		}
+		ts, _ := time.Parse(time.RFC3339Nano, eventString(ev["ts"]))
+		if !ts.IsZero() {
+			if first.IsZero() {
+				first = ts
+			}
+			last = ts
+		}
+		nodeID := eventString(ev["node_id"])
+		switch eventString(ev["event"]) {
+		case "edge_selected":
+			r.Edges = append(r.Edges, Edge{
+				From:      eventString(ev["from_node"]),
+				To:        eventString(ev["to_node"]),
+				Label:     eventString(ev["label"]),
+				Condition: eventString(ev["condition"]),
+			})
+		case "stage_attempt_start":
+			if nodeID == "" {
+				continue
+			}
+			n := r.node(nodeID)
+			if eventInt(ev["attempt"]) <= 1 {
+				n.Visits++
+			} else {
+				n.Retries++
+			}
+			starts[nodeID] = ts
+		case "stage_attempt_end":
+			if nodeID == "" {
+				continue
+			}
+			n := r.node(nodeID)
+			n.Attempts++
+			n.Status = eventString(ev["status"])
+			if ms, ok := ev["duration_ms"].(float64); ok {
+				n.DurationMS += int64(ms)
+			} else if st := starts[nodeID]; !st.IsZero() && !ts.IsZero() {
+				// Runs recorded before duration_ms existed.
+				n.DurationMS += ts.Sub(st).Milliseconds()
+			}
+		case "llm_request":
+			if nodeID == "" {
+				continue
+			}
+			n := r.node(nodeID)
+			n.Provider = firstNonEmpty(eventString(ev["provider"]), n.Provider)
+			n.Model = firstNonEmpty(eventString(ev["model"]), n.Model)
+			n.InputTokens += int64(eventInt(ev["input_tokens"]))
+			n.OutputTokens += int64(eventInt(ev["output_tokens"]))
+		}
+	}
+	return first, last, sc.Err()
+}
+
+// fillModelFromStageDir falls back to per-stage artifacts for CLI-backed
+// nodes, which do not emit llm_request events.
+func fillModelFromStageDir(n *NodeSummary, segments []string) {
+	if n == nil || n.Model != "" {
+		return
+	}
+	for i := len(segments) - 1; i >= 0; i-- {
+		for _, name := range []string{"provider_used.json", "cli_invocation.json"} {
+			b, err := os.ReadFile(filepath.Join(segments[i], n.NodeID, name))
+			if err != nil {
+				continue
+			}
+			var doc struct {
+				Provider string `json:"provider"`
+				Model    string `json:"model"`
+			}
+			if json.Unmarshal(b, &doc) == nil && doc.Model != "" {
+				n.Provider, n.Model = doc.Provider, doc.Model
+				return
+			}
+		}
+	}
+}
+
+func eventInt(v any) int {
+	switch t := v.(type) {
+	case float64:
+		return int(t)
+	case string:
+		n, _ := strconv.Atoi(t)
+		return n
+	default:
+		return 0
+	}
+}
+
+func eventString(v any) string {
+	switch t := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return strings.TrimSpace(t)
+	default:
+		return strings.TrimSpace(fmt.Sprint(t))
+	}
+}
+
+func firstNonEmpty(vals ...string) string {
+	for _, v := range vals {
+		if strings.TrimSpace(v) != "" {
+			return v
+		}
+	}
+	return ""
+}
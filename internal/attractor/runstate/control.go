@@ -0,0 +1,84 @@
+package runstate
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/danshapiro/kilroy/internal/attractor/runtime"
+)
+
+// ControlFileName is the operator control file in a run's logs root. The
+// engine polls it at node boundaries: "pause" holds the run before the next
+// node starts, "step" lets exactly one more node start and then pauses again,
+// and "run" (or no file) lets the run continue.
+const ControlFileName = "run_control.json"
+
+type ControlMode string
+
+const (
+	ControlRun   ControlMode = "run"
+	ControlPause ControlMode = "pause"
+	ControlStep  ControlMode = "step"
+)
+
+type Control struct {
+	Mode        ControlMode `json:"mode"`
+	RequestedAt time.Time   `json:"requested_at"`
+	Source      string      `json:"source,omitempty"`
+}
+
+// ParseControlMode maps an operator command (pause, unpause, step) or a mode
+// name to a ControlMode.
+func ParseControlMode(s string) (ControlMode, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "run", "unpause", "continue":
+		return ControlRun, nil
+	case "pause":
+		return ControlPause, nil
+	case "step":
+		return ControlStep, nil
+	default:
+		return "", fmt.Errorf("unknown run control %q (want pause, unpause, or step)", s)
+	}
+}
+
+// LoadControl reads the control file in logsRoot. A missing file means the
+// run is not paused.
+func LoadControl(logsRoot string) (Control, error) {
+	path := filepath.Join(logsRoot, ControlFileName)
+	b, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return Control{Mode: ControlRun}, nil
+		}
+		return Control{}, err
+	}
+	var c Control
+	if err := json.Unmarshal(b, &c); err != nil {
+		return Control{}, fmt.Errorf("decode %s: %w", path, err)
+	}
+	mode, err := ParseControlMode(string(c.Mode))
+	if err != nil {
+		return Control{}, fmt.Errorf("decode %s: %w", path, err)
+	}
+	c.Mode = mode
+	return c, nil
+}
+
+// WriteControl atomically replaces the control file in logsRoot.
+func WriteControl(logsRoot string, mode ControlMode, source string) error {
+	if strings.TrimSpace(logsRoot) == "" {
+		return fmt.Errorf("logs root is required")
+	}
+	c := Control{
+		Mode:        mode,
+		RequestedAt: time.Now().UTC(),
+		Source:      strings.TrimSpace(source),
+	}
+	return runtime.WriteJSONAtomicFile(filepath.Join(logsRoot, ControlFileName), c)
+}
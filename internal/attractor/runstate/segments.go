@@ -0,0 +1,42 @@
+package runstate
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+)
+
+var restartDirRE = regexp.MustCompile(`^restart-(\d+)$`)
+
+// RestartSegments returns logsRoot followed by its loop-restart segment
+// directories (restart-1, restart-2, ...) in numeric order.
+func RestartSegments(logsRoot string) []string {
+	segs := []string{logsRoot}
+	entries, err := os.ReadDir(logsRoot)
+	if err != nil {
+		return segs
+	}
+	type restart struct {
+		n    int
+		path string
+	}
+	var restarts []restart
+	for _, e := range entries {
+		m := restartDirRE.FindStringSubmatch(e.Name())
+		if !e.IsDir() || len(m) != 2 {
+			continue
+		}
+		n, err := strconv.Atoi(m[1])
+		if err != nil {
+			continue
+		}
+		restarts = append(restarts, restart{n: n, path: filepath.Join(logsRoot, e.Name())})
+	}
+	sort.Slice(restarts, func(i, j int) bool { return restarts[i].n < restarts[j].n })
+	for _, r := range restarts {
+		segs = append(segs, r.path)
+	}
+	return segs
+}
@@ -51,6 +51,11 @@ func LoadSnapshot(logsRoot string) (*Snapshot, error) {
 	if s.State == StateUnknown && s.PIDAlive {
 		s.State = StateRunning
 	}
+	if !terminal {
+		if err := applyOperatorState(s); err != nil {
+			return nil, err
+		}
+	}
 
 	return s, nil
 }
@@ -120,6 +125,23 @@ func applyLiveOrProgress(s *Snapshot) error {
 	return nil
 }
 
+func applyOperatorState(s *Snapshot) error {
+	c, err := LoadControl(s.LogsRoot)
+	if err != nil {
+		return err
+	}
+	if c.Mode != ControlRun {
+		s.Control = c.Mode
+	}
+	s.Paused = s.LastEvent == "run_paused"
+	pending, err := PendingSteers(s.LogsRoot)
+	if err != nil {
+		return err
+	}
+	s.PendingSteering = len(pending)
+	return nil
+}
+
 func applyPIDFile(s *Snapshot, terminalState bool) error {
 	path := filepath.Join(s.LogsRoot, "run.pid")
 	b, err := os.ReadFile(path)
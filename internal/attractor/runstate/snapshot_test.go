@@ -235,3 +235,98 @@ func TestLoadSnapshot_TerminalStateIgnoresMalformedPIDFile(t *testing.T) {
 		t.Fatal("pid_alive=true want false for malformed pid file")
 	}
 }
+
+func TestLoadSnapshot_ReportsPauseControl(t *testing.T) {
+	root := t.TempDir()
+	_ = os.WriteFile(filepath.Join(root, "live.json"), []byte(`{"event":"stage_attempt_end","node_id":"impl"}`), 0o644)
+	if err := WriteControl(root, ControlPause, "test"); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := LoadSnapshot(root)
+	if err != nil {
+		t.Fatalf("LoadSnapshot: %v", err)
+	}
+	if s.Control != ControlPause || s.Paused {
+		t.Fatalf("pause requested but not yet reached: control=%q paused=%t", s.Control, s.Paused)
+	}
+
+	_ = os.WriteFile(filepath.Join(root, "live.json"), []byte(`{"event":"run_paused","node_id":"verify"}`), 0o644)
+	s, err = LoadSnapshot(root)
+	if err != nil {
+		t.Fatalf("LoadSnapshot: %v", err)
+	}
+	if !s.Paused || s.CurrentNodeID != "verify" {
+		t.Fatalf("paused=%t node=%q want paused before verify", s.Paused, s.CurrentNodeID)
+	}
+
+	_ = os.WriteFile(filepath.Join(root, "final.json"), []byte(`{"status":"fail","failure_reason":"stopped_by_operator"}`), 0o644)
+	s, err = LoadSnapshot(root)
+	if err != nil {
+		t.Fatalf("LoadSnapshot: %v", err)
+	}
+	if s.Paused || s.Control != "" {
+		t.Fatalf("terminal run reported pause state: control=%q paused=%t", s.Control, s.Paused)
+	}
+}
+
+func TestLoadControl_MissingFileMeansRun(t *testing.T) {
+	c, err := LoadControl(t.TempDir())
+	if err != nil || c.Mode != ControlRun {
+		t.Fatalf("LoadControl: %+v, %v", c, err)
+	}
+}
+
+func TestSteeringQueue_ClaimInSendOrderAndCountInSnapshot(t *testing.T) {
+	root := t.TempDir()
+	first, err := EnqueueSteer(root, "use the existing parser", "cli", "impl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := EnqueueSteer(root, "  ", "cli", "impl"); err == nil {
+		t.Fatal("expected empty message to be rejected")
+	}
+	if _, err := EnqueueSteer(root, "skip the docs", "api", ""); err != nil {
+		t.Fatal(err)
+	}
+	s, err := LoadSnapshot(root)
+	if err != nil {
+		t.Fatalf("LoadSnapshot: %v", err)
+	}
+	if s.PendingSteering != 2 {
+		t.Fatalf("pending_steering=%d want 2", s.PendingSteering)
+	}
+
+	msgs, err := ClaimSteers(root)
+	if err != nil || len(msgs) != 2 || msgs[0].Message != "use the existing parser" || msgs[1].Source != "api" {
+		t.Fatalf("ClaimSteers: %+v, %v", msgs, err)
+	}
+	if rest, _ := PendingSteers(root); len(rest) != 0 {
+		t.Fatalf("claimed messages still pending: %+v", rest)
+	}
+	if err := RequeueSteer(root, first); err != nil {
+		t.Fatal(err)
+	}
+	if rest, _ := PendingSteers(root); len(rest) != 1 || rest[0].ID != first.ID {
+		t.Fatalf("requeued: %+v", rest)
+	}
+}
+
+func TestRestartSegments_OrdersNumericallyAndSkipsNonSegments(t *testing.T) {
+	root := t.TempDir()
+	for _, d := range []string{"restart-10", "restart-2", "restart-1", "restart-x", "impl"} {
+		_ = os.MkdirAll(filepath.Join(root, d), 0o755)
+	}
+	_ = os.WriteFile(filepath.Join(root, "restart-3"), nil, 0o644)
+
+	got := RestartSegments(root)
+	want := []string{root, filepath.Join(root, "restart-1"), filepath.Join(root, "restart-2"), filepath.Join(root, "restart-10")}
+	if len(got) != len(want) {
+		t.Fatalf("segments=%v want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("segments=%v want %v", got, want)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package runstate
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/danshapiro/kilroy/internal/attractor/runtime"
+)
+
+// SteeringDirName is the queue of operator steering messages in a run's logs
+// root, one JSON file per message. The engine claims (removes) messages as it
+// delivers them to a codergen stage.
+const SteeringDirName = "steering"
+
+type SteerMessage struct {
+	ID          string    `json:"id"`
+	Message     string    `json:"message"`
+	RequestedAt time.Time `json:"requested_at"`
+	Source      string    `json:"source,omitempty"`
+	// NodeID is the node that was running when the message was sent.
+	NodeID string `json:"node_id,omitempty"`
+}
+
+// EnqueueSteer adds a steering message to the queue in logsRoot.
+func EnqueueSteer(logsRoot, message, source, nodeID string) (SteerMessage, error) {
+	message = strings.TrimSpace(message)
+	if message == "" {
+		return SteerMessage{}, fmt.Errorf("steering message is empty")
+	}
+	if strings.TrimSpace(logsRoot) == "" {
+		return SteerMessage{}, fmt.Errorf("logs root is required")
+	}
+	now := time.Now().UTC()
+	m := SteerMessage{
+		// Zero-padded nanoseconds keep the queue in send order by file name.
+		ID:          fmt.Sprintf("%020d", now.UnixNano()),
+		Message:     message,
+		RequestedAt: now,
+		Source:      strings.TrimSpace(source),
+		NodeID:      strings.TrimSpace(nodeID),
+	}
+	return m, writeSteer(logsRoot, m)
+}
+
+// RequeueSteer puts a claimed message that could not be delivered back on the
+// queue under its original ID.
+func RequeueSteer(logsRoot string, m SteerMessage) error {
+	return writeSteer(logsRoot, m)
+}
+
+func writeSteer(logsRoot string, m SteerMessage) error {
+	return runtime.WriteJSONAtomicFile(filepath.Join(logsRoot, SteeringDirName, m.ID+".json"), m)
+}
+
+// PendingSteers lists queued steering messages in send order without claiming
+// them.
+func PendingSteers(logsRoot string) ([]SteerMessage, error) {
+	msgs, _, err := readSteers(logsRoot)
+	return msgs, err
+}
+
+// ClaimSteers removes and returns the queued steering messages in send order.
+func ClaimSteers(logsRoot string) ([]SteerMessage, error) {
+	msgs, paths, err := readSteers(logsRoot)
+	if err != nil {
+		return nil, err
+	}
+	claimed := msgs[:0]
+	for i, m := range msgs {
+		if err := os.Remove(paths[i]); err != nil {
+			continue
+		}
+		claimed = append(claimed, m)
+	}
+	return claimed, nil
+}
+
+func readSteers(logsRoot string) ([]SteerMessage, []string, error) {
+	dir := filepath.Join(logsRoot, SteeringDirName)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil, nil
+		}
+		return nil, nil, err
+	}
+	names := make([]string, 0, len(entries))
+	for _, ent := range entries {
+		name := ent.Name()
+		// Skip in-flight atomic writes (.tmp-*).
+		if ent.IsDir() || strings.HasPrefix(name, ".") || !strings.HasSuffix(name, ".json") {
+			continue
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var msgs []SteerMessage
+	var paths []string
+	for _, name := range names {
+		path := filepath.Join(dir, name)
+		b, err := os.ReadFile(path)
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			return nil, nil, err
+		}
+		var m SteerMessage
+		if err := json.Unmarshal(b, &m); err != nil {
+			return nil, nil, fmt.Errorf("decode %s: %w", path, err)
+		}
+		msgs = append(msgs, m)
+		paths = append(paths, path)
+	}
+	return msgs, paths, nil
+}
@@ -37,6 +37,13 @@ type Snapshot struct {
 	PIDAlive       bool      `json:"pid_alive"`
 	CurrentAttempt int       `json:"current_attempt,omitempty"`
 	MaxAttempts    int       `json:"max_attempts,omitempty"`
+	// Control is the pending operator request (pause or step); empty when
+	// the run is free to continue. Paused is set once the engine has stopped
+	// at a node boundary, with CurrentNodeID naming the node it will run next.
+	Control ControlMode `json:"control,omitempty"`
+	Paused  bool        `json:"paused,omitempty"`
+	// PendingSteering counts operator steering messages not yet delivered.
+	PendingSteering int `json:"pending_steering,omitempty"`
 
 	// Verbose fields (populated only when requested via ApplyVerbose)
 	FinalCommitSHA string           `json:"final_commit_sha,omitempty"`
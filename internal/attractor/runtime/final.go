@@ -23,6 +23,9 @@ type FinalOutcome struct {
 
 	CXDBContextID  string `json:"cxdb_context_id"`
 	CXDBHeadTurnID string `json:"cxdb_head_turn_id"`
+
+	// PullRequestURL is set when git.pull_request opened one for the run.
+	PullRequestURL string `json:"pull_request_url,omitempty"`
 }
 
 func (fo *FinalOutcome) Save(path string) error {
@@ -14,21 +14,65 @@ const (
 	SelectorShape
 	SelectorClass
 	SelectorID
+	SelectorAttr
+	// SelectorCompound combines several simple selectors, e.g. box.review or
+	// .review[goal_gate=true].
+	SelectorCompound
 )
 
+// Selector matches a node when every part it sets matches.
+type Selector struct {
+	Shape   string // "" matches any shape
+	Classes []string
+	ID      string
+	Attrs   []AttrSelector
+}
+
+// AttrSelector is [key] (attribute present) or [key=value] / [key!=value].
+type AttrSelector struct {
+	Key      string
+	Value    string
+	HasValue bool
+	Negate   bool
+}
+
 type Rule struct {
-	Kind        SelectorKind
-	Value       string // id/class/shape; empty for universal
-	Specificity int    // universal(0) < shape(1) < class(2) < id(3)
-	Order       int    // source order (0..n-1)
+	Kind     SelectorKind
+	Value    string // id/class/shape for simple selectors; empty for universal, attribute and compound
+	Selector Selector
+	// Specificity follows CSS: ids outrank classes and attribute selectors,
+	// which outrank shapes: universal(0) < shape(1) < class/attr(10) < id(100),
+	// summed over the parts of a compound selector.
+	Specificity int
+	Order       int // source order (0..n-1)
 	Decls       map[string]string
+	// Overlay marks rules layered on top of the graph's own stylesheet (run
+	// profiles). They outrank every non-overlay rule regardless of specificity.
+	Overlay bool
 }
 
+// graphDefaultProps fall back to same-named graph attributes when no rule sets
+// them.
+var graphDefaultProps = []string{"llm_model", "llm_provider", "reasoning_effort", "max_tokens"}
+
 func ParseStylesheet(src string) ([]Rule, error) {
 	p := &ssParser{s: src}
 	return p.parse()
 }
 
+// WithOverlay returns base followed by overlay, with the overlay rules marked
+// as Overlay and ordered after every base rule.
+func WithOverlay(base, overlay []Rule) []Rule {
+	out := make([]Rule, 0, len(base)+len(overlay))
+	out = append(out, base...)
+	for _, r := range overlay {
+		r.Overlay = true
+		r.Order += len(base)
+		out = append(out, r)
+	}
+	return out
+}
+
 func ApplyStylesheet(g *model.Graph, rules []Rule) error {
 	if g == nil {
 		return fmt.Errorf("graph is nil")
@@ -47,60 +91,103 @@ func ApplyStylesheet(g *model.Graph, rules []Rule) error {
 }
 
 func applyToNode(g *model.Graph, n *model.Node, rules []Rule) {
-	// Only set properties that are missing.
-	props := []string{"llm_model", "llm_provider", "reasoning_effort", "max_tokens"}
-	for _, prop := range props {
-		if _, ok := n.Attrs[prop]; ok {
+	// Selectors match the node as authored, so a property set by one rule
+	// cannot change which other rules match.
+	authored := &model.Node{ID: n.ID, Attrs: make(map[string]string, len(n.Attrs)), Classes: n.Classes}
+	for k, v := range n.Attrs {
+		authored.Attrs[k] = v
+	}
+
+	type winner struct {
+		overlay     bool
+		spec, order int
+		val         string
+	}
+	best := map[string]winner{}
+	for _, r := range rules {
+		if !ruleMatchesNode(r, authored) {
 			continue
 		}
-		bestSpec := -1
-		bestOrder := -1
-		bestVal := ""
-		for _, r := range rules {
-			if !ruleMatchesNode(r, n) {
-				continue
-			}
-			v, ok := r.Decls[prop]
-			if !ok {
+		for prop, v := range r.Decls {
+			if w, ok := best[prop]; ok && ruleRanksBelow(r, w.overlay, w.spec, w.order) {
 				continue
 			}
-			if r.Specificity > bestSpec || (r.Specificity == bestSpec && r.Order > bestOrder) {
-				bestSpec = r.Specificity
-				bestOrder = r.Order
-				bestVal = v
-			}
+			best[prop] = winner{overlay: r.Overlay, spec: r.Specificity, order: r.Order, val: v}
 		}
-		if bestSpec >= 0 {
-			n.Attrs[prop] = bestVal
+	}
+	// Only set properties that are missing.
+	for prop, w := range best {
+		if _, ok := authored.Attrs[prop]; ok {
 			continue
 		}
-		// Graph-level defaults (optional / best-effort).
-		if g != nil {
-			if v, ok := g.Attrs[prop]; ok && strings.TrimSpace(v) != "" {
-				n.Attrs[prop] = v
-			}
+		n.Attrs[prop] = w.val
+	}
+	// Graph-level defaults (optional / best-effort).
+	for _, prop := range graphDefaultProps {
+		if _, ok := n.Attrs[prop]; ok {
+			continue
 		}
+		if v, ok := g.Attrs[prop]; ok && strings.TrimSpace(v) != "" {
+			n.Attrs[prop] = v
+		}
+	}
+}
+
+func ruleRanksBelow(r Rule, overlay bool, spec, order int) bool {
+	if r.Overlay != overlay {
+		return overlay
+	}
+	if r.Specificity != spec {
+		return r.Specificity < spec
 	}
+	return r.Order < order
 }
 
 func ruleMatchesNode(r Rule, n *model.Node) bool {
-	switch r.Kind {
-	case SelectorUniversal:
-		return true
-	case SelectorID:
-		return n.ID == r.Value
-	case SelectorClass:
+	sel := r.Selector
+	if sel.ID != "" && n.ID != sel.ID {
+		return false
+	}
+	if sel.Shape != "" && n.Shape() != sel.Shape {
+		return false
+	}
+	for _, want := range sel.Classes {
+		found := false
 		for _, c := range n.ClassList() {
-			if c == r.Value {
-				return true
+			if c == want {
+				found = true
+				break
 			}
 		}
-		return false
-	case SelectorShape:
-		return n.Shape() == r.Value
-	default:
-		return false
+		if !found {
+			return false
+		}
+	}
+	for _, a := range sel.Attrs {
+		if !attrMatches(a, n) {
+			return false
+		}
+	}
+	return true
+}
+
+func attrMatches(a AttrSelector, n *model.Node) bool {
+	v, ok := n.Attrs[a.Key]
+	switch a.Key {
+	case "type":
+		// Nodes usually get their type from their shape; match that too.
+		v, ok = n.HandlerType(), true
+	case "shape":
+		v, ok = n.Shape(), true
+	}
+	if !a.HasValue {
+		return ok
+	}
+	eq := ok && v == a.Value
+	if a.Negate {
+		return !eq
 	}
+	return eq
 }
 
 type ssParser struct {
@@ -127,7 +214,7 @@ func (p *ssParser) parse() ([]Rule, error) {
 }
 
 func (p *ssParser) parseRule() (Rule, error) {
-	kind, val, spec, err := p.parseSelector()
+	r, err := p.parseSelector()
 	if err != nil {
 		return Rule{}, err
 	}
@@ -141,13 +228,10 @@ func (p *ssParser) parseRule() (Rule, error) {
 		if p.consume("}") {
 			break
 		}
-		prop, err := p.parseIdent()
+		prop, err := p.parsePropertyName()
 		if err != nil {
 			return Rule{}, err
 		}
-		if prop != "llm_model" && prop != "llm_provider" && prop != "reasoning_effort" && prop != "max_tokens" {
-			return Rule{}, p.errf("unknown property %q", prop)
-		}
 		p.skipSpace()
 		if !p.consume(":") {
 			return Rule{}, p.errf("expected ':' after property")
@@ -161,32 +245,129 @@ func (p *ssParser) parseRule() (Rule, error) {
 		p.skipSpace()
 		_ = p.consume(";") // optional (including trailing before '}')
 	}
-	return Rule{Kind: kind, Value: val, Specificity: spec, Decls: decls}, nil
+	r.Decls = decls
+	return r, nil
 }
 
-func (p *ssParser) parseSelector() (SelectorKind, string, int, error) {
-	if p.consume("*") {
-		return SelectorUniversal, "", 0, nil
+// parseSelector reads a compound selector: an optional '*' or shape followed
+// by any number of .class, #id and [attr] parts, with no spaces between parts.
+func (p *ssParser) parseSelector() (Rule, error) {
+	universal := p.consume("*")
+	var r Rule
+	parts := 0
+	kind := SelectorUniversal
+	add := func(k SelectorKind, v string, spec int) {
+		parts++
+		kind = k
+		r.Value = v
+		r.Specificity += spec
 	}
-	if p.consume("#") {
-		id, err := p.parseIdent()
+	if !universal && !p.eof() && p.s[p.i] != '.' && p.s[p.i] != '#' && p.s[p.i] != '[' {
+		shape, err := p.parseShapeName()
 		if err != nil {
-			return 0, "", 0, err
+			return Rule{}, err
 		}
-		return SelectorID, id, 3, nil
+		r.Selector.Shape = shape
+		add(SelectorShape, shape, 1)
 	}
-	if p.consume(".") {
-		class, err := p.parseClassName()
-		if err != nil {
-			return 0, "", 0, err
+	for !p.eof() {
+		switch {
+		case p.consume("#"):
+			if r.Selector.ID != "" {
+				return Rule{}, p.errf("selector has more than one #id")
+			}
+			id, err := p.parseIdent()
+			if err != nil {
+				return Rule{}, err
+			}
+			r.Selector.ID = id
+			add(SelectorID, id, 100)
+		case p.consume("."):
+			class, err := p.parseClassName()
+			if err != nil {
+				return Rule{}, err
+			}
+			r.Selector.Classes = append(r.Selector.Classes, class)
+			add(SelectorClass, class, 10)
+		case p.consume("["):
+			a, err := p.parseAttrSelector()
+			if err != nil {
+				return Rule{}, err
+			}
+			r.Selector.Attrs = append(r.Selector.Attrs, a)
+			add(SelectorAttr, "", 10)
+		default:
+			if parts == 0 {
+				if universal {
+					return Rule{Kind: SelectorUniversal}, nil
+				}
+				return Rule{}, p.errf("expected selector")
+			}
+			if parts > 1 {
+				kind = SelectorCompound
+				r.Value = ""
+			}
+			r.Kind = kind
+			return r, nil
 		}
-		return SelectorClass, class, 2, nil
 	}
-	shape, err := p.parseIdentLike()
+	return Rule{}, p.errf("expected '{' after selector")
+}
+
+// parseAttrSelector reads key], key=value] or key!=value] after '['. Values
+// may be bare or double-quoted.
+func (p *ssParser) parseAttrSelector() (AttrSelector, error) {
+	p.skipSpace()
+	key, err := p.parsePropertyName()
 	if err != nil {
-		return 0, "", 0, err
+		return AttrSelector{}, err
+	}
+	a := AttrSelector{Key: key}
+	p.skipSpace()
+	switch {
+	case p.consume("]"):
+		return a, nil
+	case p.consume("!="):
+		a.Negate = true
+	case p.consume("="):
+	default:
+		return AttrSelector{}, p.errf("expected '=', '!=' or ']' in attribute selector")
+	}
+	a.HasValue = true
+	p.skipSpace()
+	if !p.eof() && p.s[p.i] == '"' {
+		v, err := p.parseString()
+		if err != nil {
+			return AttrSelector{}, err
+		}
+		a.Value = v
+	} else {
+		start := p.i
+		for !p.eof() && p.s[p.i] != ']' && p.s[p.i] != ' ' {
+			p.i++
+		}
+		a.Value = p.s[start:p.i]
+	}
+	p.skipSpace()
+	if !p.consume("]") {
+		return AttrSelector{}, p.errf("expected ']' to close attribute selector")
 	}
-	return SelectorShape, shape, 1, nil
+	return a, nil
+}
+
+// parsePropertyName reads a node attribute name; dots are allowed for
+// namespaced attributes such as tool_hooks.pre.
+func (p *ssParser) parsePropertyName() (string, error) {
+	p.skipSpace()
+	start := p.i
+	if p.eof() || !isIdentStart(rune(p.s[p.i])) {
+		return "", p.errf("expected property name")
+	}
+	p.i++
+	for !p.eof() && (isIdentContinue(rune(p.s[p.i])) || p.s[p.i] == '.') {
+		p.i++
+	}
+	return p.s[start:p.i], nil
 }
 
 func (p *ssParser) parseIdent() (string, error) {
@@ -222,25 +403,22 @@ func (p *ssParser) parseClassName() (string, error) {
 	return p.s[start:p.i], nil
 }
 
-func (p *ssParser) parseIdentLike() (string, error) {
-	// For shape selectors and bare values, accept [A-Za-z0-9_-.]+
-	p.skipSpace()
+func (p *ssParser) parseShapeName() (string, error) {
+	// Shape names accept [A-Za-z0-9_-]+; '.', '#' and '[' start the next
+	// part of a compound selector.
 	start := p.i
-	if p.eof() {
-		return "", p.errf("expected identifier")
-	}
 	for !p.eof() {
 		r := rune(p.s[p.i])
-		if (r >= 'A' && r <= 'Z') || (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') || r == '_' || r == '-' || r == '.' {
+		if (r >= 'A' && r <= 'Z') || (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') || r == '_' || r == '-' {
 			p.i++
 			continue
 		}
 		break
 	}
 	if start == p.i {
-		return "", p.errf("expected identifier")
+		return "", p.errf("expected selector")
 	}
-	return strings.TrimSpace(p.s[start:p.i]), nil
+	return p.s[start:p.i], nil
 }
 
 func (p *ssParser) parseValue() (string, error) {
@@ -183,3 +183,144 @@ func TestParseStylesheet_UppercaseClassNameFailsAtBoundary(t *testing.T) {
 		t.Fatalf("error should mention 'class name': %v", err)
 	}
 }
+
+func TestStylesheet_AppliesAnyNodeAttribute(t *testing.T) {
+	ss := `
+* { timeout: 300s; max_retries: 1; }
+.review { fidelity: full; thread_id: review; escalation_models: "openai:gpt-5.4, anthropic:claude-opus-4.6"; }
+box { tool_hooks.pre: "./scripts/guard.sh"; }
+`
+	rules, err := ParseStylesheet(ss)
+	if err != nil {
+		t.Fatalf("ParseStylesheet error: %v", err)
+	}
+	g := model.NewGraph("G")
+	n := model.NewNode("n")
+	n.Attrs["shape"] = "box"
+	n.Attrs["class"] = "review"
+	n.Attrs["max_retries"] = "4"
+	if err := g.AddNode(n); err != nil {
+		t.Fatalf("AddNode: %v", err)
+	}
+	if err := ApplyStylesheet(g, rules); err != nil {
+		t.Fatalf("ApplyStylesheet error: %v", err)
+	}
+	want := map[string]string{
+		"timeout":           "300s",
+		"max_retries":       "4", // explicit attribute wins
+		"fidelity":          "full",
+		"thread_id":         "review",
+		"escalation_models": "openai:gpt-5.4, anthropic:claude-opus-4.6",
+		"tool_hooks.pre":    "./scripts/guard.sh",
+	}
+	for k, v := range want {
+		if got := n.Attrs[k]; got != v {
+			t.Fatalf("%s: got %q want %q", k, got, v)
+		}
+	}
+}
+
+func TestStylesheet_CompoundAndAttributeSelectors(t *testing.T) {
+	ss := `
+box { max_retries: 1; }
+.review { max_retries: 2; }
+box.review { max_retries: 3; }
+[type=tool] { timeout: 60s; }
+[goal_gate=true] { fidelity: full; }
+.review[goal_gate=true] { thread_id: gate; }
+[goal_gate!=true] { thread_id: plain; }
+`
+	rules, err := ParseStylesheet(ss)
+	if err != nil {
+		t.Fatalf("ParseStylesheet error: %v", err)
+	}
+	if rules[2].Kind != SelectorCompound || rules[2].Specificity <= rules[1].Specificity {
+		t.Fatalf("box.review: kind=%d specificity=%d", rules[2].Kind, rules[2].Specificity)
+	}
+	if rules[3].Kind != SelectorAttr || len(rules[3].Selector.Attrs) != 1 || rules[3].Selector.Attrs[0].Value != "tool" {
+		t.Fatalf("[type=tool]: %+v", rules[3])
+	}
+
+	g := model.NewGraph("G")
+	review := model.NewNode("review")
+	review.Attrs["shape"] = "box"
+	review.Attrs["class"] = "review"
+	review.Attrs["goal_gate"] = "true"
+	other := model.NewNode("other")
+	other.Attrs["shape"] = "ellipse"
+	other.Attrs["class"] = "review"
+	tool := model.NewNode("tool")
+	tool.Attrs["shape"] = "parallelogram"
+	for _, n := range []*model.Node{review, other, tool} {
+		if err := g.AddNode(n); err != nil {
+			t.Fatalf("AddNode: %v", err)
+		}
+	}
+	if err := ApplyStylesheet(g, rules); err != nil {
+		t.Fatalf("ApplyStylesheet error: %v", err)
+	}
+
+	check := func(n *model.Node, key, want string) {
+		t.Helper()
+		if got := n.Attrs[key]; got != want {
+			t.Fatalf("%s %s: got %q want %q", n.ID, key, got, want)
+		}
+	}
+	check(review, "max_retries", "3")
+	check(review, "fidelity", "full")
+	check(review, "thread_id", "gate")
+	check(other, "max_retries", "2")
+	check(other, "fidelity", "")
+	check(other, "thread_id", "plain")
+	// parallelogram nodes are tool nodes without an explicit type.
+	check(tool, "timeout", "60s")
+	check(review, "timeout", "")
+}
+
+func TestParseStylesheet_RejectsMalformedSelectors(t *testing.T) {
+	cases := []string{
+		`box .review { timeout: 1s; }`,
+		`[type=tool { timeout: 1s; }`,
+		`#a#b { timeout: 1s; }`,
+		`[] { timeout: 1s; }`,
+	}
+	for _, in := range cases {
+		if _, err := ParseStylesheet(in); err == nil {
+			t.Fatalf("expected parse error for %q", in)
+		}
+	}
+}
+
+func TestStylesheet_OverlayOutranksGraphRules(t *testing.T) {
+	base, err := ParseStylesheet(`* { llm_model: gpt-5.4; } #impl { llm_model: claude-opus-4.6; timeout: 900s; }`)
+	if err != nil {
+		t.Fatalf("ParseStylesheet base: %v", err)
+	}
+	overlay, err := ParseStylesheet(`* { llm_model: gpt-5.4-mini; }`)
+	if err != nil {
+		t.Fatalf("ParseStylesheet overlay: %v", err)
+	}
+	g := model.NewGraph("G")
+	impl := model.NewNode("impl")
+	impl.Attrs["shape"] = "box"
+	pinned := model.NewNode("pinned")
+	pinned.Attrs["shape"] = "box"
+	pinned.Attrs["llm_model"] = "explicit-model"
+	for _, n := range []*model.Node{impl, pinned} {
+		if err := g.AddNode(n); err != nil {
+			t.Fatalf("AddNode: %v", err)
+		}
+	}
+	if err := ApplyStylesheet(g, WithOverlay(base, overlay)); err != nil {
+		t.Fatalf("ApplyStylesheet error: %v", err)
+	}
+	if got := impl.Attrs["llm_model"]; got != "gpt-5.4-mini" {
+		t.Fatalf("impl llm_model: got %q", got)
+	}
+	if got := impl.Attrs["timeout"]; got != "900s" {
+		t.Fatalf("impl timeout: got %q", got)
+	}
+	if got := pinned.Attrs["llm_model"]; got != "explicit-model" {
+		t.Fatalf("explicit attribute should win over overlay: got %q", got)
+	}
+}
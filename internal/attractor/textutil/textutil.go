@@ -0,0 +1,22 @@
+// Package textutil holds the small string helpers shared by the attractor
+// reporting commands (render, land, diff, test).
+package textutil
+
+import "strings"
+
+// FirstLine returns the first line of s, ignoring leading and trailing
+// whitespace.
+func FirstLine(s string) string {
+	line, _, _ := strings.Cut(strings.TrimSpace(s), "\n")
+	return strings.TrimSpace(line)
+}
+
+// Truncate shortens s to at most n runes, replacing the tail with an
+// ellipsis when it is cut.
+func Truncate(s string, n int) string {
+	r := []rune(s)
+	if n <= 0 || len(r) <= n {
+		return s
+	}
+	return strings.TrimSpace(string(r[:n-1])) + "…"
+}
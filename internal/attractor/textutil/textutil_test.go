@@ -0,0 +1,24 @@
+package textutil
+
+import "testing"
+
+func TestFirstLine(t *testing.T) {
+	if got := FirstLine("\n  summary line  \nbody\n"); got != "summary line" {
+		t.Fatalf("FirstLine=%q", got)
+	}
+	if got := FirstLine(""); got != "" {
+		t.Fatalf("FirstLine(empty)=%q", got)
+	}
+}
+
+func TestTruncate_CountsRunesAndKeepsWithinLimit(t *testing.T) {
+	if got := Truncate("short", 10); got != "short" {
+		t.Fatalf("Truncate=%q", got)
+	}
+	if got := Truncate("héllo wörld", 7); got != "héllo…" {
+		t.Fatalf("Truncate=%q", got)
+	}
+	if got := []rune(Truncate("abcdefghij", 5)); len(got) != 5 {
+		t.Fatalf("Truncate length=%d want 5", len(got))
+	}
+}
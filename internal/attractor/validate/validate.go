@@ -3,6 +3,9 @@ package validate
 import (
 	"fmt"
 	"regexp"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
 
 	"github.com/danshapiro/kilroy/internal/attractor/cond"
@@ -92,6 +95,11 @@ func ValidateWithOptions(g *model.Graph, opts ValidateOptions, extraRules ...Lin
 	diags = append(diags, lintCustomOutcomeCoverage(g)...)
 	diags = append(diags, lintReservedKeywordNodeID(g)...)
 	diags = append(diags, lintToolCommandAbsPath(g)...)
+	diags = append(diags, lintStatusTool(g)...)
+	diags = append(diags, lintTestReportSyntax(g)...)
+	diags = append(diags, lintFlakyRerun(g)...)
+	diags = append(diags, lintCoverageGateConfig(g)...)
+	diags = append(diags, lintAutoModelRequirements(g)...)
 
 	// Run custom lint rules (spec §7.3: extra_rules appended after built-in rules).
 	for _, rule := range extraRules {
@@ -447,14 +455,57 @@ func lintStylesheetSyntax(g *model.Graph) []Diagnostic {
 	if raw == "" {
 		return nil
 	}
-	if _, err := style.ParseStylesheet(raw); err != nil {
+	rules, err := style.ParseStylesheet(raw)
+	if err != nil {
 		return []Diagnostic{{
 			Rule:     "stylesheet_syntax",
 			Severity: SeverityError,
 			Message:  err.Error(),
 		}}
 	}
-	return nil
+	var diags []Diagnostic
+	seen := map[string]bool{}
+	for _, r := range rules {
+		props := make([]string, 0, len(r.Decls))
+		for prop := range r.Decls {
+			props = append(props, prop)
+		}
+		sort.Strings(props)
+		for _, prop := range props {
+			if stylesheetNodeAttrs[prop] || seen[prop] {
+				continue
+			}
+			seen[prop] = true
+			diags = append(diags, Diagnostic{
+				Rule:     "stylesheet_unknown_property",
+				Severity: SeverityWarning,
+				Message:  fmt.Sprintf("model_stylesheet: property %q is not a node attribute the engine reads", prop),
+				Fix:      "check the spelling; the stylesheet sets node attributes such as llm_model, timeout, max_retries or tool_hooks.pre",
+			})
+		}
+	}
+	return diags
+}
+
+// stylesheetNodeAttrs lists the node attributes the engine reads, i.e. the
+// properties a model_stylesheet rule can usefully set.
+var stylesheetNodeAttrs = map[string]bool{
+	"label": true, "shape": true, "type": true, "class": true,
+	"prompt": true, "prompt_file": true, "llm_prompt": true,
+	"llm_model": true, "llm_provider": true, "model": true, "reasoning_effort": true, "max_tokens": true,
+	"model.requires": true, "model.min_context": true, "model.max_cost_per_mtok": true,
+	"max_agent_turns": true, "codergen_mode": true, "escalation_models": true,
+	"timeout": true, "max_retries": true, "retry_target": true, "fallback_retry_target": true,
+	"goal_gate": true, "fidelity": true, "thread_id": true, "auto_status": true, "allow_partial": true,
+	"tool_command": true, "command": true, "tool_hooks.pre": true, "tool_hooks.post": true,
+	"test_report": true, "flaky_rerun": true, "flaky_rerun_command": true,
+	"coverage_command": true, "coverage_profile": true, "coverage_threshold": true, "coverage_format": true,
+	"coverage_scope": true, "status_tool": true, "subagent_worktrees": true, "mcp_servers": true, "lsp": true,
+	"default_command_timeout_ms": true, "max_command_timeout_ms": true,
+	"join_policy": true, "error_policy": true, "max_parallel": true, "quorum_fraction": true, "k": true,
+	"question": true, "human.default_choice": true,
+	"manager.actions": true, "manager.max_cycles": true, "manager.poll_interval": true, "manager.stop_condition": true,
+	"stack.child_dotfile": true, "stack.child_autostart": true,
 }
 
 // lintStylesheetModelIDs checks llm_model values in the model_stylesheet against
@@ -489,6 +540,9 @@ func lintStylesheetModelIDs(g *model.Graph, catalog *modeldb.Catalog) []Diagnost
 			continue
 		}
 		modelID = strings.TrimSpace(modelID)
+		if isAutoModel(modelID) {
+			continue
+		}
 		provider := strings.TrimSpace(r.Decls["llm_provider"])
 
 		key := provider + "|" + modelID
@@ -850,6 +904,10 @@ func lintLLMProviderPresent(g *model.Graph) []Diagnostic {
 		if n.Shape() != "box" {
 			continue
 		}
+		// llm_model=auto nodes get their provider from the engine's router.
+		if isAutoModel(n.Attr("llm_model", n.Attr("model", ""))) {
+			continue
+		}
 		if strings.TrimSpace(n.Attr("llm_provider", "")) == "" {
 			diags = append(diags, Diagnostic{
 				Rule:     "llm_provider_required",
@@ -1718,3 +1776,224 @@ func lintReservedKeywordNodeID(g *model.Graph) []Diagnostic {
 	}
 	return diags
 }
+
+func lintStatusTool(g *model.Graph) []Diagnostic {
+	var diags []Diagnostic
+	for id, n := range g.Nodes {
+		if n == nil {
+			continue
+		}
+		raw := strings.TrimSpace(n.Attr("status_tool", ""))
+		switch strings.ToLower(raw) {
+		case "", "auto", "mcp", "file":
+		default:
+			diags = append(diags, Diagnostic{
+				Rule:     "status_tool",
+				Severity: SeverityError,
+				Message:  fmt.Sprintf("unknown status_tool %q (want auto, mcp or file)", raw),
+				NodeID:   id,
+			})
+		}
+	}
+	return diags
+}
+
+// TestReportFormats are the test_report formats tool nodes can parse. The
+// engine accepts exactly these names.
+var TestReportFormats = []string{"junit", "go-test-json", "tap", "pytest-json"}
+
+func lintTestReportSyntax(g *model.Graph) []Diagnostic {
+	var diags []Diagnostic
+	for id, n := range g.Nodes {
+		if n == nil {
+			continue
+		}
+		raw := strings.TrimSpace(n.Attr("test_report", ""))
+		if raw == "" {
+			continue
+		}
+		if !nodeResolvesToTool(n) {
+			diags = append(diags, Diagnostic{
+				Rule:     "test_report_syntax",
+				Severity: SeverityWarning,
+				Message:  "test_report is only read by tool nodes",
+				NodeID:   id,
+			})
+			continue
+		}
+		format, glob, _ := strings.Cut(raw, ":")
+		format = strings.ToLower(strings.TrimSpace(format))
+		if !slices.Contains(TestReportFormats, format) {
+			diags = append(diags, Diagnostic{
+				Rule:     "test_report_syntax",
+				Severity: SeverityWarning,
+				Message:  fmt.Sprintf("unknown test_report format %q", format),
+				NodeID:   id,
+				Fix:      fmt.Sprintf("use one of %s, optionally followed by :<glob>, e.g. test_report=\"junit:reports/*.xml\"", strings.Join(TestReportFormats, ", ")),
+			})
+			continue
+		}
+		if format == "junit" || format == "pytest-json" {
+			if strings.TrimSpace(glob) == "" {
+				diags = append(diags, Diagnostic{
+					Rule:     "test_report_syntax",
+					Severity: SeverityWarning,
+					Message:  fmt.Sprintf("test_report %q has no file glob; %s reports are read from files, not stdout", raw, format),
+					NodeID:   id,
+					Fix:      fmt.Sprintf("set test_report=\"%s:<path glob>\"", format),
+				})
+			}
+		}
+	}
+	return diags
+}
+
+func lintFlakyRerun(g *model.Graph) []Diagnostic {
+	var diags []Diagnostic
+	for id, n := range g.Nodes {
+		if n == nil {
+			continue
+		}
+		raw := strings.TrimSpace(n.Attr("flaky_rerun", ""))
+		if raw == "" {
+			continue
+		}
+		if !nodeResolvesToTool(n) {
+			diags = append(diags, Diagnostic{
+				Rule:     "flaky_rerun",
+				Severity: SeverityWarning,
+				Message:  "flaky_rerun is only read by tool nodes",
+				NodeID:   id,
+			})
+			continue
+		}
+		if v, err := strconv.Atoi(raw); err != nil || v < 0 {
+			diags = append(diags, Diagnostic{
+				Rule:     "flaky_rerun",
+				Severity: SeverityWarning,
+				Message:  fmt.Sprintf("flaky_rerun %q is not a non-negative integer", raw),
+				NodeID:   id,
+				Fix:      "set flaky_rerun to the number of reruns, e.g. flaky_rerun=2",
+			})
+			continue
+		}
+		cmd := strings.TrimSpace(n.Attr("tool_command", ""))
+		plain := !strings.ContainsAny(cmd, FlakyRerunShellMetachars) && (FlakyRerunGoTestRE.MatchString(cmd) || FlakyRerunPytestRE.MatchString(cmd))
+		if strings.TrimSpace(n.Attr("flaky_rerun_command", "")) == "" && !plain {
+			diags = append(diags, Diagnostic{
+				Rule:     "flaky_rerun",
+				Severity: SeverityWarning,
+				Message:  "flaky_rerun cannot derive a rerun command from this tool_command",
+				NodeID:   id,
+				Fix:      `set flaky_rerun_command, e.g. "go test ./... -run '{tests_regex}'" or "pytest {tests}"`,
+			})
+		}
+	}
+	return diags
+}
+
+// FlakyRerunGoTestRE and FlakyRerunPytestRE match the tool_command forms the
+// engine can derive a flaky_rerun command from. A tool_command containing any
+// of FlakyRerunShellMetachars is not a plain invocation and needs an explicit
+// flaky_rerun_command.
+var (
+	FlakyRerunGoTestRE = regexp.MustCompile(`^go\s+test\b`)
+	FlakyRerunPytestRE = regexp.MustCompile(`^(?:python3?\s+-m\s+)?pytest\b`)
+)
+
+const FlakyRerunShellMetachars = ";&|`$<>()\n"
+
+func lintCoverageGateConfig(g *model.Graph) []Diagnostic {
+	var diags []Diagnostic
+	for id, n := range g.Nodes {
+		if n == nil || strings.TrimSpace(n.Attr("type", "")) != "verify.coverage" {
+			continue
+		}
+		if strings.TrimSpace(n.Attr("coverage_command", n.Attr("tool_command", ""))) == "" {
+			diags = append(diags, Diagnostic{
+				Rule:     "coverage_gate_config",
+				Severity: SeverityError,
+				Message:  "verify.coverage node missing coverage_command",
+				NodeID:   id,
+				Fix:      `set coverage_command, e.g. "go test -coverprofile=cover.out ./..."`,
+			})
+		}
+		if strings.TrimSpace(n.Attr("coverage_profile", "")) == "" {
+			diags = append(diags, Diagnostic{
+				Rule:     "coverage_gate_config",
+				Severity: SeverityError,
+				Message:  "verify.coverage node missing coverage_profile",
+				NodeID:   id,
+				Fix:      "set coverage_profile to the report path the command writes, relative to the worktree",
+			})
+		}
+		if raw := strings.TrimSpace(n.Attr("coverage_threshold", "")); raw != "" {
+			if v, err := strconv.ParseFloat(raw, 64); err != nil || v < 0 || v > 100 {
+				diags = append(diags, Diagnostic{
+					Rule:     "coverage_gate_config",
+					Severity: SeverityWarning,
+					Message:  fmt.Sprintf("coverage_threshold %q is not a percentage between 0 and 100", raw),
+					NodeID:   id,
+				})
+			}
+		}
+		switch f := strings.TrimSpace(n.Attr("coverage_format", "")); f {
+		case "", "go", "lcov", "cobertura":
+		default:
+			diags = append(diags, Diagnostic{
+				Rule:     "coverage_gate_config",
+				Severity: SeverityWarning,
+				Message:  fmt.Sprintf("unknown coverage_format %q (want go, lcov or cobertura)", f),
+				NodeID:   id,
+			})
+		}
+		switch sc := strings.TrimSpace(n.Attr("coverage_scope", "")); sc {
+		case "", "lines", "files":
+		default:
+			diags = append(diags, Diagnostic{
+				Rule:     "coverage_gate_config",
+				Severity: SeverityError,
+				Message:  fmt.Sprintf("unknown coverage_scope %q (want lines or files)", sc),
+				NodeID:   id,
+			})
+		}
+	}
+	return diags
+}
+
+func isAutoModel(modelID string) bool {
+	return strings.EqualFold(strings.TrimSpace(modelID), "auto")
+}
+
+// lintAutoModelRequirements checks the model.* requirement attributes of
+// llm_model=auto nodes, and flags requirements set on nodes that are not auto.
+func lintAutoModelRequirements(g *model.Graph) []Diagnostic {
+	var diags []Diagnostic
+	for id, n := range g.Nodes {
+		if n == nil {
+			continue
+		}
+		requires, minContext, maxCost := n.Attr("model.requires", ""), n.Attr("model.min_context", ""), n.Attr("model.max_cost_per_mtok", "")
+		if !isAutoModel(n.Attr("llm_model", n.Attr("model", ""))) {
+			if strings.TrimSpace(requires+minContext+maxCost) != "" {
+				diags = append(diags, Diagnostic{
+					Rule:     "model_requirements",
+					Severity: SeverityWarning,
+					Message:  "model.* requirements are ignored unless llm_model=auto",
+					NodeID:   id,
+					Fix:      `set llm_model="auto" to let the engine pick the model`,
+				})
+			}
+			continue
+		}
+		if _, err := modeldb.ParseRequirements(requires, minContext, maxCost); err != nil {
+			diags = append(diags, Diagnostic{
+				Rule:     "model_requirements",
+				Severity: SeverityError,
+				Message:  err.Error(),
+				NodeID:   id,
+			})
+		}
+	}
+	return diags
+}
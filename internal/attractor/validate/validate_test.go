@@ -1395,6 +1395,30 @@ func TestValidate_G12_UnknownProvider_NoWarning(t *testing.T) {
 	assertNoRule(t, diags, "stylesheet_noncanonical_model_id")
 }
 
+func TestValidate_StylesheetUnknownProperty_EmitsWarning(t *testing.T) {
+	g, err := dot.Parse(minimalGraphWithStylesheet(`box.review { timeout: 900s; max_retry: 2; }`))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	diags := Validate(g)
+	assertHasRule(t, diags, "stylesheet_unknown_property", SeverityWarning)
+	for _, d := range diags {
+		if d.Rule == "stylesheet_unknown_property" && !strings.Contains(d.Message, `"max_retry"`) {
+			t.Fatalf("unexpected unknown property diagnostic: %+v", d)
+		}
+	}
+}
+
+func TestValidate_StylesheetNodeAttributes_NoUnknownPropertyWarning(t *testing.T) {
+	g, err := dot.Parse(minimalGraphWithStylesheet(`[type=tool] { timeout: 60s; tool_hooks.pre: ./check.sh; } [goal_gate=true] { max_retries: 3; fidelity: full; }`))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	diags := Validate(g)
+	assertNoRule(t, diags, "stylesheet_unknown_property")
+	assertNoRule(t, diags, "stylesheet_syntax")
+}
+
 // TestPromptFile_ConflictLintRule_FiresWhenBothSet verifies that when a node
 // has both prompt_file and prompt/llm_prompt set and expandPromptFiles has NOT
 // run (RepoPath is empty, so prompt_file remains unresolved), the
@@ -1831,3 +1855,147 @@ digraph G {
 	diags := Validate(g)
 	assertNoRule(t, diags, "custom_outcome_coverage")
 }
+
+// --- Tests for test_report_syntax lint rule ---
+
+func TestValidate_StatusTool(t *testing.T) {
+	g, err := dot.Parse([]byte(`
+digraph G {
+  start [shape=Mdiamond]
+  exit  [shape=Msquare]
+  a [shape=box, prompt="x", status_tool=mcp]
+  b [shape=box, prompt="x", status_tool=FILE]
+  c [shape=box, prompt="x", status_tool=tool]
+  start -> a -> b -> c -> exit
+}
+`))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	diags := Validate(g)
+	for _, d := range diags {
+		if d.Rule == "status_tool" && d.NodeID != "c" {
+			t.Fatalf("unexpected diagnostic on %s: %+v", d.NodeID, d)
+		}
+	}
+	assertHasRule(t, diags, "status_tool", SeverityError)
+}
+
+func TestValidate_TestReportSyntax(t *testing.T) {
+	cases := []struct {
+		attr string
+		warn bool
+	}{
+		{`test_report="junit:reports/*.xml"`, false},
+		{`test_report="go-test-json"`, false},
+		{`test_report="tap"`, false},
+		{`test_report="xunit:out.xml"`, true},
+		{`test_report="pytest-json"`, true},
+	}
+	for _, tc := range cases {
+		g, err := dot.Parse([]byte(`
+digraph G {
+  start [shape=Mdiamond]
+  exit  [shape=Msquare]
+  t [shape=parallelogram, tool_command="make test", ` + tc.attr + `]
+  start -> t -> exit
+}
+`))
+		if err != nil {
+			t.Fatalf("parse: %v", err)
+		}
+		diags := Validate(g)
+		if tc.warn {
+			assertHasRule(t, diags, "test_report_syntax", SeverityWarning)
+		} else {
+			assertNoRule(t, diags, "test_report_syntax")
+		}
+	}
+}
+
+func TestValidate_FlakyRerun(t *testing.T) {
+	cases := []struct {
+		attrs string
+		warn  bool
+	}{
+		{`tool_command="go test ./...", flaky_rerun=2`, false},
+		{`tool_command="make test", flaky_rerun=2, flaky_rerun_command="make test TESTS={tests}"`, false},
+		{`tool_command="make test", flaky_rerun=2`, true},
+		{`tool_command="go test ./...", flaky_rerun=twice`, true},
+	}
+	for _, tc := range cases {
+		g, err := dot.Parse([]byte(`
+digraph G {
+  start [shape=Mdiamond]
+  exit  [shape=Msquare]
+  t [shape=parallelogram, ` + tc.attrs + `]
+  start -> t -> exit
+}
+`))
+		if err != nil {
+			t.Fatalf("parse: %v", err)
+		}
+		diags := Validate(g)
+		if tc.warn {
+			assertHasRule(t, diags, "flaky_rerun", SeverityWarning)
+		} else {
+			assertNoRule(t, diags, "flaky_rerun")
+		}
+	}
+}
+
+func TestValidate_CoverageGateConfig(t *testing.T) {
+	g, err := dot.Parse([]byte(`
+digraph G {
+  start [shape=Mdiamond]
+  exit  [shape=Msquare]
+  ok  [shape=parallelogram, type="verify.coverage", coverage_command="go test -coverprofile=cover.out ./...", coverage_profile="cover.out", coverage_threshold=85, coverage_scope="files"]
+  bad [shape=parallelogram, type="verify.coverage", coverage_command="make cover", coverage_scope="diff"]
+  start -> ok -> bad -> exit
+}
+`))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	diags := Validate(g)
+	for _, d := range diags {
+		if d.Rule == "coverage_gate_config" && d.NodeID != "bad" {
+			t.Fatalf("unexpected diagnostic on %s: %+v", d.NodeID, d)
+		}
+	}
+	assertHasRule(t, diags, "coverage_gate_config", SeverityError)
+	found := false
+	for _, d := range diags {
+		found = found || d.Message == `unknown coverage_scope "diff" (want lines or files)`
+	}
+	if !found {
+		t.Fatalf("missing coverage_scope diagnostic: %+v", diags)
+	}
+}
+
+func TestValidate_AutoModelRequirements(t *testing.T) {
+	g, err := dot.Parse([]byte(`
+digraph G {
+  start [shape=Mdiamond]
+  exit  [shape=Msquare]
+  ok    [shape=box, prompt="p", llm_model="auto", model.requires="tools,reasoning", model.min_context=200000]
+  bad   [shape=box, prompt="p", llm_model="auto", model.requires="telepathy"]
+  fixed [shape=box, prompt="p", llm_provider=openai, llm_model="gpt-5.4", model.max_cost_per_mtok=5]
+  start -> ok -> bad -> fixed -> exit
+}
+`))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	diags := Validate(g)
+	for _, d := range diags {
+		if d.Rule == "llm_provider_required" {
+			t.Fatalf("auto nodes must not require llm_provider: %+v", d)
+		}
+		if d.Rule == "model_requirements" && d.NodeID == "ok" {
+			t.Fatalf("unexpected diagnostic on ok: %+v", d)
+		}
+	}
+	assertHasRule(t, diags, "model_requirements", SeverityError)
+	assertHasRule(t, diags, "model_requirements", SeverityWarning)
+}
@@ -204,6 +204,14 @@ func KilroyAttractorRegistryBundle() (bundleID string, bundle RegistryBundle, sh
 				"4": field("question_text", "string", opt()),
 				"5": fieldSemantic("duration_ms", "u64", "duration_ms", opt()),
 			}),
+			"com.kilroy.attractor.SteeringDelivered": typeDef(map[string]any{
+				"1": field("run_id", "string"),
+				"2": field("node_id", "string"),
+				"3": fieldSemantic("timestamp_ms", "u64", "unix_ms"),
+				"4": field("message", "string"),
+				"5": field("source", "string", opt()),
+				"6": field("delivery", "string", opt()),
+			}),
 		},
 		Enums: map[string]any{},
 	}
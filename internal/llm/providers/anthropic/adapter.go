@@ -972,10 +972,25 @@ func toAnthropicMessages(msgs []llm.Message) (system string, messages []map[stri
 				if p.Kind != llm.ContentToolResult || p.ToolResult == nil {
 					continue
 				}
+				var content any = fmt.Sprint(p.ToolResult.Content)
+				if len(p.ToolResult.ImageData) > 0 {
+					mt := strings.TrimSpace(p.ToolResult.ImageMediaType)
+					if mt == "" {
+						mt = "image/png"
+					}
+					content = []map[string]any{
+						{"type": "text", "text": content},
+						{"type": "image", "source": map[string]any{
+							"type":       "base64",
+							"media_type": mt,
+							"data":       base64.StdEncoding.EncodeToString(p.ToolResult.ImageData),
+						}},
+					}
+				}
 				blocks = append(blocks, map[string]any{
 					"type":        "tool_result",
 					"tool_use_id": p.ToolResult.ToolCallID,
-					"content":     fmt.Sprint(p.ToolResult.Content),
+					"content":     content,
 					"is_error":    p.ToolResult.IsError,
 				})
 			}
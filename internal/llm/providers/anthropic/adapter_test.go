@@ -2026,3 +2026,23 @@ func writeAnthropicStreamOK(w http.ResponseWriter, text string) {
 	write("message_delta", `{"stop_reason":"end_turn","usage":{"input_tokens":1,"output_tokens":1}}`)
 	write("message_stop", `{}`)
 }
+
+func TestToAnthropicMessages_ToolResultImage(t *testing.T) {
+	msg := llm.ToolResultNamed("call_1", "mcp__shots__capture", "[image: image/png, 3 bytes]", false)
+	msg.Content[0].ToolResult.ImageData = []byte{1, 2, 3}
+	msg.Content[0].ToolResult.ImageMediaType = "image/png"
+
+	_, messages, err := toAnthropicMessages([]llm.Message{msg})
+	if err != nil {
+		t.Fatalf("toAnthropicMessages: %v", err)
+	}
+	blocks := messages[0]["content"].([]map[string]any)
+	content, ok := blocks[0]["content"].([]map[string]any)
+	if !ok || len(content) != 2 {
+		t.Fatalf("tool_result content: %#v", blocks[0]["content"])
+	}
+	src := content[1]["source"].(map[string]any)
+	if content[1]["type"] != "image" || src["media_type"] != "image/png" || src["data"] != "AQID" {
+		t.Fatalf("image block: %#v", content[1])
+	}
+}
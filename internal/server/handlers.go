@@ -11,6 +11,7 @@ import (
 	"time"
 
 	"github.com/danshapiro/kilroy/internal/attractor/engine"
+	"github.com/danshapiro/kilroy/internal/attractor/runstate"
 )
 
 // validRunID matches ULIDs, UUIDs, and other safe identifiers.
@@ -63,6 +64,10 @@ func (s *Server) handleSubmitPipeline(w http.ResponseWriter, r *http.Request) {
 		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid config: %v", err))
 		return
 	}
+	if err := cfg.ApplyProfile(req.Profile); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid profile: %v", err))
+		return
+	}
 
 	// Generate run ID if not provided.
 	runID := strings.TrimSpace(req.RunID)
@@ -106,8 +111,12 @@ func (s *Server) handleSubmitPipeline(w http.ResponseWriter, r *http.Request) {
 			RunID:         runID,
 			AllowTestShim: req.AllowTestShim,
 			ForceModels:   req.ForceModels,
-			ProgressSink:  broadcaster.Send,
-			Interviewer:   interviewer,
+			Profile:       req.Profile,
+			ProgressSink: func(ev map[string]any) {
+				broadcaster.Send(ev)
+				s.metrics.Observe(ev)
+			},
+			Interviewer: interviewer,
 			OnEngineReady: func(e *engine.Engine) {
 				ps.SetEngine(e)
 			},
@@ -154,6 +163,8 @@ func (s *Server) handlePipelineEvents(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	s.metrics.SSEClientConnected()
+	defer s.metrics.SSEClientDisconnected()
 	WriteSSE(w, r, ps.Broadcaster)
 }
 
@@ -175,6 +186,82 @@ func (s *Server) handleCancelPipeline(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, map[string]string{"status": "canceling"})
 }
 
+func (s *Server) handlePausePipeline(w http.ResponseWriter, r *http.Request) {
+	s.writeRunControl(w, r, runstate.ControlPause)
+}
+
+func (s *Server) handleUnpausePipeline(w http.ResponseWriter, r *http.Request) {
+	s.writeRunControl(w, r, runstate.ControlRun)
+}
+
+func (s *Server) handleStepPipeline(w http.ResponseWriter, r *http.Request) {
+	s.writeRunControl(w, r, runstate.ControlStep)
+}
+
+// writeRunControl records a pause/unpause/step request in the run's control
+// file; the engine applies it at the next node boundary.
+func (s *Server) writeRunControl(w http.ResponseWriter, r *http.Request, mode runstate.ControlMode) {
+	ps, ok := s.activePipeline(w, r)
+	if !ok {
+		return
+	}
+	if err := runstate.WriteControl(ps.RunLogsRoot(), mode, "api"); err != nil {
+		writeError(w, http.StatusInternalServerError, fmt.Sprintf("write run control: %v", err))
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok", "control": string(mode)})
+}
+
+// handleSteerPipeline queues an operator message in the run's steering queue,
+// which lives next to run control in the base logs root.
+func (s *Server) handleSteerPipeline(w http.ResponseWriter, r *http.Request) {
+	var req SteerRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid body: %v", err))
+		return
+	}
+	if strings.TrimSpace(req.Message) == "" {
+		writeError(w, http.StatusBadRequest, "message is required")
+		return
+	}
+	ps, ok := s.activePipeline(w, r)
+	if !ok {
+		return
+	}
+	m, err := runstate.EnqueueSteer(ps.RunLogsRoot(), req.Message, "api", ps.Status().CurrentNodeID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, fmt.Sprintf("queue steering message: %v", err))
+		return
+	}
+	writeJSON(w, http.StatusAccepted, map[string]string{"status": "queued", "steer_id": m.ID, "node_id": m.NodeID})
+}
+
+// activePipeline resolves the {id} pipeline for operator requests, which need
+// a started, unfinished run with a logs root. It writes the error response
+// and returns false otherwise.
+func (s *Server) activePipeline(w http.ResponseWriter, r *http.Request) (*PipelineState, bool) {
+	runID := r.PathValue("id")
+	if runID == "" {
+		writeError(w, http.StatusBadRequest, "run_id is required")
+		return nil, false
+	}
+
+	ps, ok := s.registry.Get(runID)
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("pipeline %s not found", runID))
+		return nil, false
+	}
+	if ps.Done() {
+		writeError(w, http.StatusConflict, fmt.Sprintf("pipeline %s has finished", runID))
+		return nil, false
+	}
+	if ps.RunLogsRoot() == "" {
+		writeError(w, http.StatusConflict, fmt.Sprintf("pipeline %s has not started yet", runID))
+		return nil, false
+	}
+	return ps, true
+}
+
 func (s *Server) handleGetContext(w http.ResponseWriter, r *http.Request) {
 	runID := r.PathValue("id")
 	if runID == "" {
@@ -7,11 +7,15 @@ import (
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/danshapiro/kilroy/internal/attractor/engine"
+	"github.com/danshapiro/kilroy/internal/attractor/runstate"
 )
 
 // newTestServer creates a Server and wraps its mux in httptest.Server.
@@ -575,3 +579,286 @@ func TestIntegration_FailedPipelineStatus(t *testing.T) {
 		t.Errorf("expected failure reason, got %q", status.FailureReason)
 	}
 }
+
+func TestIntegration_PauseUnpauseStepPipeline(t *testing.T) {
+	srv, ts := newTestServer(t)
+	runID := "test-pause-001"
+	ps, b, _ := registerTestPipeline(t, srv, runID)
+
+	post := func(action string) int {
+		t.Helper()
+		resp, err := http.Post(ts.URL+"/pipelines/"+runID+"/"+action, "application/json", nil)
+		if err != nil {
+			t.Fatalf("POST %s: %v", action, err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	// No logs root until the engine is ready.
+	if code := post("pause"); code != http.StatusConflict {
+		t.Fatalf("pause before start: got %d want 409", code)
+	}
+
+	ps.LogsRoot = t.TempDir()
+	if code := post("pause"); code != http.StatusOK {
+		t.Fatalf("pause: got %d", code)
+	}
+	b.Send(map[string]any{"event": "run_paused", "node_id": "verify"})
+	var status PipelineStatus
+	resp, err := http.Get(ts.URL + "/pipelines/" + runID)
+	if err != nil {
+		t.Fatalf("GET status: %v", err)
+	}
+	json.NewDecoder(resp.Body).Decode(&status)
+	resp.Body.Close()
+	if !status.Paused || status.Control != "pause" || status.CurrentNodeID != "verify" {
+		t.Fatalf("status while paused: %+v", status)
+	}
+
+	for action, want := range map[string]runstate.ControlMode{"step": runstate.ControlStep, "unpause": runstate.ControlRun} {
+		if code := post(action); code != http.StatusOK {
+			t.Fatalf("%s: got %d", action, code)
+		}
+		if c, err := runstate.LoadControl(ps.LogsRoot); err != nil || c.Mode != want || c.Source != "api" {
+			t.Fatalf("%s: control %+v, %v", action, c, err)
+		}
+	}
+
+	ps.SetResult(nil, fmt.Errorf("done"))
+	if code := post("step"); code != http.StatusConflict {
+		t.Fatalf("step after finish: got %d want 409", code)
+	}
+}
+
+func TestIntegration_PauseAfterLoopRestartReachesEngine(t *testing.T) {
+	srv, ts := newTestServer(t)
+	runID := "test-pause-restart-001"
+	rp := startRestartingPipeline(t, srv, runID)
+	post := func(action string) {
+		t.Helper()
+		resp, err := http.Post(ts.URL+"/pipelines/"+runID+"/"+action, "application/json", nil)
+		if err != nil {
+			t.Fatalf("POST %s: %v", action, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("%s: got %d", action, resp.StatusCode)
+		}
+	}
+
+	rp.waitForEvent(t, "loop_restart", "check")
+	post("pause")
+	if root := rp.ps.RunLogsRoot(); root != rp.logsRoot {
+		t.Fatalf("operator root after restart = %q, want base logs root %q", root, rp.logsRoot)
+	}
+	if status := rp.ps.Status(); status.Control != "pause" {
+		t.Fatalf("status control after pause: %+v", status)
+	}
+	rp.release(t)
+	rp.waitForEvent(t, "run_paused", "check")
+	post("unpause")
+	rp.wait(t)
+}
+
+func TestIntegration_SteerAfterLoopRestartIsQueuedInBaseLogsRoot(t *testing.T) {
+	srv, ts := newTestServer(t)
+	runID := "test-steer-restart-001"
+	rp := startRestartingPipeline(t, srv, runID)
+
+	rp.waitForEvent(t, "loop_restart", "check")
+	resp, err := http.Post(ts.URL+"/pipelines/"+runID+"/steer", "application/json", strings.NewReader(`{"message":"keep the old API"}`))
+	if err != nil {
+		t.Fatalf("POST steer: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("steer: got %d", resp.StatusCode)
+	}
+	// The engine claims steering from the base logs root, not restart-N.
+	msgs, err := runstate.PendingSteers(rp.logsRoot)
+	if err != nil || len(msgs) != 1 || msgs[0].Message != "keep the old API" {
+		t.Fatalf("base root queue: %+v, %v", msgs, err)
+	}
+	if msgs, _ := runstate.PendingSteers(filepath.Join(rp.logsRoot, "restart-1")); len(msgs) != 0 {
+		t.Fatalf("steering queued in restart-1: %+v", msgs)
+	}
+	rp.release(t)
+	rp.wait(t)
+}
+
+// restartingPipeline is a real engine run registered with the server. Its
+// tool node asks for a loop_restart on the first pass and, on the second,
+// blocks until release is called.
+type restartingPipeline struct {
+	ps        *PipelineState
+	b         *Broadcaster
+	logsRoot  string
+	releaseAt string
+	done      chan error
+}
+
+func startRestartingPipeline(t *testing.T, srv *Server, runID string) *restartingPipeline {
+	t.Helper()
+	ps, b, _ := registerTestPipeline(t, srv, runID)
+	dir := t.TempDir()
+	marker, release := filepath.Join(dir, "restarted"), filepath.Join(dir, "release")
+	dot := []byte(fmt.Sprintf(`digraph G {
+  graph [goal="operate across a restart", default_max_retry=0]
+  start [shape=Mdiamond]
+  exit  [shape=Msquare]
+  work  [shape=parallelogram, tool_command="if [ -f %[1]s ]; then while [ ! -f %[2]s ]; do sleep 0.05; done; printf done; else touch %[1]s; printf again; fi"]
+  check [shape=diamond]
+  start -> work
+  work -> check
+  check -> work [condition="context.tool.output=again", loop_restart=true]
+  check -> exit [condition="context.tool.output=done"]
+  check -> exit
+}`, marker, release))
+	rp := &restartingPipeline{
+		ps:        ps,
+		b:         b,
+		logsRoot:  filepath.Join(t.TempDir(), "logs"),
+		releaseAt: release,
+		done:      make(chan error, 1),
+	}
+	repo := initServerTestRepo(t)
+	go func() {
+		res, err := engine.Run(context.Background(), dot, engine.RunOptions{
+			RepoPath:      repo,
+			RunID:         runID,
+			LogsRoot:      rp.logsRoot,
+			ProgressSink:  b.Send,
+			OnEngineReady: ps.SetEngine,
+		})
+		ps.SetResult(res, err)
+		if err == nil && res.FinalStatus != "success" {
+			err = fmt.Errorf("final status %s", res.FinalStatus)
+		}
+		rp.done <- err
+	}()
+	t.Cleanup(func() { _ = os.WriteFile(release, nil, 0o644) })
+	return rp
+}
+
+func (rp *restartingPipeline) waitForEvent(t *testing.T, event, nodeID string) {
+	t.Helper()
+	deadline := time.Now().Add(30 * time.Second)
+	for time.Now().Before(deadline) {
+		for _, ev := range rp.b.History() {
+			if ev["event"] == event && ev["node_id"] == nodeID {
+				return
+			}
+		}
+		select {
+		case err := <-rp.done:
+			t.Fatalf("run ended before %s at %s: %v", event, nodeID, err)
+		case <-time.After(20 * time.Millisecond):
+		}
+	}
+	t.Fatalf("no %s event at %s", event, nodeID)
+}
+
+func (rp *restartingPipeline) release(t *testing.T) {
+	t.Helper()
+	if err := os.WriteFile(rp.releaseAt, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func (rp *restartingPipeline) wait(t *testing.T) {
+	t.Helper()
+	select {
+	case err := <-rp.done:
+		if err != nil {
+			t.Fatalf("run: %v", err)
+		}
+	case <-time.After(30 * time.Second):
+		t.Fatal("run did not finish")
+	}
+}
+
+// initServerTestRepo creates a clean git repository with one commit.
+func initServerTestRepo(t *testing.T) string {
+	t.Helper()
+	repo := t.TempDir()
+	for _, args := range [][]string{
+		{"init"},
+		{"config", "user.name", "tester"},
+		{"config", "user.email", "tester@example.com"},
+		{"commit", "--allow-empty", "-m", "init"},
+	} {
+		if out, err := exec.Command("git", append([]string{"-C", repo}, args...)...).CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+	}
+	return repo
+}
+
+func TestIntegration_SteerPipeline(t *testing.T) {
+	srv, ts := newTestServer(t)
+	runID := "test-steer-001"
+	ps, b, _ := registerTestPipeline(t, srv, runID)
+	ps.LogsRoot = t.TempDir()
+	b.Send(map[string]any{"event": "stage_heartbeat", "node_id": "impl"})
+
+	resp, err := http.Post(ts.URL+"/pipelines/"+runID+"/steer", "application/json", strings.NewReader(`{"message":"stop refactoring the parser"}`))
+	if err != nil {
+		t.Fatalf("POST steer: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d", resp.StatusCode)
+	}
+	var body map[string]string
+	json.NewDecoder(resp.Body).Decode(&body)
+	if body["status"] != "queued" || body["node_id"] != "impl" || body["steer_id"] == "" {
+		t.Fatalf("unexpected body: %v", body)
+	}
+	msgs, err := runstate.PendingSteers(ps.LogsRoot)
+	if err != nil || len(msgs) != 1 || msgs[0].Message != "stop refactoring the parser" || msgs[0].Source != "api" {
+		t.Fatalf("queued: %+v, %v", msgs, err)
+	}
+
+	resp2, err := http.Post(ts.URL+"/pipelines/"+runID+"/steer", "application/json", strings.NewReader(`{"message":" "}`))
+	if err != nil {
+		t.Fatalf("POST steer: %v", err)
+	}
+	resp2.Body.Close()
+	if resp2.StatusCode != http.StatusBadRequest {
+		t.Fatalf("empty message: expected 400, got %d", resp2.StatusCode)
+	}
+}
+
+func TestIntegration_SubmitPipelineUnknownProfile(t *testing.T) {
+	_, ts := newTestServer(t)
+	cfgPath := filepath.Join(t.TempDir(), "run.yaml")
+	if err := os.WriteFile(cfgPath, []byte(`
+version: 1
+repo:
+  path: /tmp/repo
+cxdb:
+  binary_addr: 127.0.0.1:9009
+  http_base_url: http://127.0.0.1:9010
+modeldb:
+  openrouter_model_info_path: /tmp/catalog.json
+profiles:
+  cheap: {}
+`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	body := fmt.Sprintf(`{"dot_source":"digraph{}","config_path":%q,"profile":"offline"}`, cfgPath)
+	resp, err := http.Post(ts.URL+"/pipelines", "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("POST: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected 400 for unknown profile, got %d", resp.StatusCode)
+	}
+	var errResp map[string]string
+	_ = json.NewDecoder(resp.Body).Decode(&errResp)
+	if !strings.Contains(errResp["error"], `unknown profile "offline"`) {
+		t.Fatalf("error: %v", errResp)
+	}
+}
@@ -0,0 +1,322 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Metrics aggregates pipeline progress events into Prometheus-style counters,
+// gauges and histograms. It is fed from the same ProgressSink events that the
+// server fans out over SSE, and rendered in the Prometheus text exposition
+// format by GET /metrics.
+type Metrics struct {
+	mu         sync.Mutex
+	counters   map[string]*counterVec
+	gauges     map[string]*counterVec
+	histograms map[string]*histogramVec
+
+	sseClients int64
+}
+
+var (
+	stageDurationBuckets = []float64{1, 5, 15, 30, 60, 120, 300, 600, 1200, 1800, 3600}
+	humanWaitBuckets     = []float64{10, 30, 60, 300, 900, 1800, 3600, 14400, 86400}
+)
+
+// metricHelp documents every exported series; keys are metric names.
+var metricHelp = map[string]string{
+	"kilroy_pipelines_started_total":     "Pipelines that started executing.",
+	"kilroy_pipelines_finished_total":    "Pipelines that reached a terminal state, by final status.",
+	"kilroy_stage_attempts_total":        "Stage attempts completed, by handler type and status.",
+	"kilroy_stage_duration_seconds":      "Stage attempt duration, by handler type.",
+	"kilroy_stage_retries_total":         "Stage retries scheduled.",
+	"kilroy_loop_restarts_total":         "loop_restart transitions.",
+	"kilroy_llm_requests_total":          "LLM requests completed, by provider and model.",
+	"kilroy_llm_retries_total":           "LLM request retries, by provider and model.",
+	"kilroy_llm_tokens_total":            "LLM tokens consumed, by provider, model and direction.",
+	"kilroy_human_gate_wait_seconds":     "Time spent waiting on human gates, by outcome.",
+	"kilroy_human_gates_waiting":         "Human gates currently waiting for an answer.",
+	"kilroy_sse_clients_active":          "Connected SSE event-stream clients.",
+	"kilroy_circuit_breaker_trips_total": "Runs aborted by a deterministic failure cycle or loop_restart circuit breaker, by kind.",
+}
+
+// NewMetrics returns an empty metrics registry.
+func NewMetrics() *Metrics {
+	return &Metrics{
+		counters:   map[string]*counterVec{},
+		gauges:     map[string]*counterVec{},
+		histograms: map[string]*histogramVec{},
+	}
+}
+
+// Observe updates metrics from a single progress event.
+func (m *Metrics) Observe(ev map[string]any) {
+	if m == nil || ev == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	switch evString(ev["event"]) {
+	case "run_started":
+		m.counter("kilroy_pipelines_started_total").add(nil, 1)
+	case "run_completed", "run_failed":
+		m.counter("kilroy_pipelines_finished_total").add(labels{"status", evString(ev["status"])}, 1)
+	case "stage_attempt_end":
+		handler := evString(ev["handler_type"])
+		m.counter("kilroy_stage_attempts_total").add(labels{"handler_type", handler, "status", evString(ev["status"])}, 1)
+		if ms, ok := evNumber(ev["duration_ms"]); ok {
+			m.histogram("kilroy_stage_duration_seconds", stageDurationBuckets).observe(labels{"handler_type", handler}, ms/1000)
+		}
+	case "stage_retry_sleep":
+		m.counter("kilroy_stage_retries_total").add(nil, 1)
+	case "loop_restart":
+		m.counter("kilroy_loop_restarts_total").add(nil, 1)
+	case "llm_request":
+		l := labels{"provider", evString(ev["provider"]), "model", evString(ev["model"])}
+		m.counter("kilroy_llm_requests_total").add(l, 1)
+		if n, ok := evNumber(ev["input_tokens"]); ok && n > 0 {
+			m.counter("kilroy_llm_tokens_total").add(append(l.clone(), "direction", "input"), n)
+		}
+		if n, ok := evNumber(ev["output_tokens"]); ok && n > 0 {
+			m.counter("kilroy_llm_tokens_total").add(append(l.clone(), "direction", "output"), n)
+		}
+	case "llm_retry":
+		m.counter("kilroy_llm_retries_total").add(labels{"provider", evString(ev["provider"]), "model", evString(ev["model"])}, 1)
+	case "human_gate_waiting":
+		m.gauge("kilroy_human_gates_waiting").add(nil, 1)
+	case "human_gate_answered":
+		m.gauge("kilroy_human_gates_waiting").add(nil, -1)
+		outcome := "answered"
+		if b, _ := ev["timed_out"].(bool); b {
+			outcome = "timeout"
+		} else if b, _ := ev["skipped"].(bool); b {
+			outcome = "skipped"
+		}
+		if ms, ok := evNumber(ev["wait_ms"]); ok {
+			m.histogram("kilroy_human_gate_wait_seconds", humanWaitBuckets).observe(labels{"outcome", outcome}, ms/1000)
+		}
+	case "deterministic_failure_cycle_breaker", "loop_restart_circuit_breaker":
+		m.counter("kilroy_circuit_breaker_trips_total").add(labels{"kind", evString(ev["event"])}, 1)
+	}
+}
+
+// SSEClientConnected/SSEClientDisconnected track the active SSE client gauge.
+func (m *Metrics) SSEClientConnected() {
+	m.mu.Lock()
+	m.sseClients++
+	m.mu.Unlock()
+}
+
+func (m *Metrics) SSEClientDisconnected() {
+	m.mu.Lock()
+	m.sseClients--
+	m.mu.Unlock()
+}
+
+// WritePrometheus renders all metrics in the Prometheus text format (0.0.4).
+func (m *Metrics) WritePrometheus(w io.Writer) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	names := make([]string, 0, len(m.counters)+len(m.gauges)+len(m.histograms)+1)
+	for n := range m.counters {
+		names = append(names, n)
+	}
+	for n := range m.gauges {
+		names = append(names, n)
+	}
+	for n := range m.histograms {
+		names = append(names, n)
+	}
+	names = append(names, "kilroy_sse_clients_active")
+	sort.Strings(names)
+
+	var b strings.Builder
+	for _, name := range names {
+		if help := metricHelp[name]; help != "" {
+			fmt.Fprintf(&b, "# HELP %s %s\n", name, help)
+		}
+		switch {
+		case name == "kilroy_sse_clients_active":
+			fmt.Fprintf(&b, "# TYPE %s gauge\n%s %d\n", name, name, m.sseClients)
+		case m.counters[name] != nil:
+			writeVec(&b, name, "counter", m.counters[name])
+		case m.gauges[name] != nil:
+			writeVec(&b, name, "gauge", m.gauges[name])
+		case m.histograms[name] != nil:
+			hv := m.histograms[name]
+			fmt.Fprintf(&b, "# TYPE %s histogram\n", name)
+			for _, key := range hv.sortedKeys() {
+				h := hv.series[key]
+				for i, le := range hv.buckets {
+					fmt.Fprintf(&b, "%s_bucket%s %d\n", name, h.labels.with("le", formatFloat(le)).String(), h.counts[i])
+				}
+				fmt.Fprintf(&b, "%s_bucket%s %d\n", name, h.labels.with("le", "+Inf").String(), h.count)
+				fmt.Fprintf(&b, "%s_sum%s %s\n", name, key, formatFloat(h.sum))
+				fmt.Fprintf(&b, "%s_count%s %d\n", name, key, h.count)
+			}
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func writeVec(b *strings.Builder, name, typ string, cv *counterVec) {
+	fmt.Fprintf(b, "# TYPE %s %s\n", name, typ)
+	for _, key := range cv.sortedKeys() {
+		fmt.Fprintf(b, "%s%s %s\n", name, key, formatFloat(cv.values[key]))
+	}
+}
+
+func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	_ = s.metrics.WritePrometheus(w)
+}
+
+func (m *Metrics) counter(name string) *counterVec {
+	cv := m.counters[name]
+	if cv == nil {
+		cv = &counterVec{values: map[string]float64{}}
+		m.counters[name] = cv
+	}
+	return cv
+}
+
+func (m *Metrics) gauge(name string) *counterVec {
+	gv := m.gauges[name]
+	if gv == nil {
+		gv = &counterVec{values: map[string]float64{}}
+		m.gauges[name] = gv
+	}
+	return gv
+}
+
+func (m *Metrics) histogram(name string, buckets []float64) *histogramVec {
+	hv := m.histograms[name]
+	if hv == nil {
+		hv = &histogramVec{buckets: buckets, series: map[string]*histogram{}}
+		m.histograms[name] = hv
+	}
+	return hv
+}
+
+// labels is a flat list of name/value pairs in declaration order.
+type labels []string
+
+func (l labels) clone() labels { return append(labels{}, l...) }
+
+func (l labels) with(name, value string) labels { return append(l.clone(), name, value) }
+
+// String renders {a="b",c="d"} with Prometheus label-value escaping.
+func (l labels) String() string {
+	if len(l) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteByte('{')
+	for i := 0; i+1 < len(l); i += 2 {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(l[i])
+		b.WriteString(`="`)
+		b.WriteString(escapeLabelValue(l[i+1]))
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+func escapeLabelValue(v string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(v)
+}
+
+// counterVec holds one float per label set; it backs both counters and gauges.
+type counterVec struct {
+	values map[string]float64
+}
+
+func (c *counterVec) add(l labels, v float64) {
+	c.values[l.String()] += v
+}
+
+func (c *counterVec) sortedKeys() []string {
+	keys := make([]string, 0, len(c.values))
+	for k := range c.values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+type histogram struct {
+	labels labels
+	counts []uint64 // cumulative per bucket
+	count  uint64
+	sum    float64
+}
+
+type histogramVec struct {
+	buckets []float64
+	series  map[string]*histogram
+}
+
+func (h *histogramVec) observe(l labels, v float64) {
+	key := l.String()
+	s := h.series[key]
+	if s == nil {
+		s = &histogram{labels: l.clone(), counts: make([]uint64, len(h.buckets))}
+		h.series[key] = s
+	}
+	for i, le := range h.buckets {
+		if v <= le {
+			s.counts[i]++
+		}
+	}
+	s.count++
+	s.sum += v
+}
+
+func (h *histogramVec) sortedKeys() []string {
+	keys := make([]string, 0, len(h.series))
+	for k := range h.series {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func formatFloat(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func evString(v any) string {
+	s, _ := v.(string)
+	return strings.TrimSpace(s)
+}
+
+// evNumber accepts the numeric shapes progress events carry: Go ints from the
+// in-process sink and float64 after a JSON round trip.
+func evNumber(v any) (float64, bool) {
+	switch t := v.(type) {
+	case int:
+		return float64(t), true
+	case int64:
+		return float64(t), true
+	case float64:
+		return t, true
+	default:
+		return 0, false
+	}
+}
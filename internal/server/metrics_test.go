@@ -0,0 +1,117 @@
+package server
+
+import (
+	"bufio"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMetrics_ObserveAndRender(t *testing.T) {
+	m := NewMetrics()
+	for _, ev := range []map[string]any{
+		{"event": "run_started"},
+		{"event": "stage_attempt_end", "handler_type": "codergen", "status": "success", "duration_ms": 2500},
+		{"event": "stage_attempt_end", "handler_type": "tool", "status": "fail", "duration_ms": float64(400)},
+		{"event": "stage_retry_sleep"},
+		{"event": "loop_restart"},
+		{"event": "llm_request", "provider": "anthropic", "model": "claude", "input_tokens": 100, "output_tokens": 20},
+		{"event": "llm_request", "provider": "anthropic", "model": "claude", "input_tokens": 50, "output_tokens": 5},
+		{"event": "human_gate_waiting", "node_id": "gate"},
+		{"event": "human_gate_answered", "node_id": "gate", "wait_ms": int64(45000), "timed_out": false},
+		{"event": "run_completed", "status": "success"},
+		{"event": "unrelated"},
+	} {
+		m.Observe(ev)
+	}
+	m.SSEClientConnected()
+
+	var b strings.Builder
+	if err := m.WritePrometheus(&b); err != nil {
+		t.Fatalf("WritePrometheus: %v", err)
+	}
+	out := b.String()
+	for _, want := range []string{
+		"# TYPE kilroy_pipelines_started_total counter\nkilroy_pipelines_started_total 1\n",
+		`kilroy_pipelines_finished_total{status="success"} 1`,
+		`kilroy_stage_attempts_total{handler_type="tool",status="fail"} 1`,
+		"# TYPE kilroy_stage_duration_seconds histogram",
+		`kilroy_stage_duration_seconds_bucket{handler_type="codergen",le="1"} 0`,
+		`kilroy_stage_duration_seconds_bucket{handler_type="codergen",le="5"} 1`,
+		`kilroy_stage_duration_seconds_bucket{handler_type="codergen",le="+Inf"} 1`,
+		`kilroy_stage_duration_seconds_sum{handler_type="codergen"} 2.5`,
+		`kilroy_stage_duration_seconds_count{handler_type="tool"} 1`,
+		"kilroy_stage_retries_total 1",
+		"kilroy_loop_restarts_total 1",
+		`kilroy_llm_requests_total{provider="anthropic",model="claude"} 2`,
+		`kilroy_llm_tokens_total{provider="anthropic",model="claude",direction="input"} 150`,
+		`kilroy_llm_tokens_total{provider="anthropic",model="claude",direction="output"} 25`,
+		`kilroy_human_gate_wait_seconds_bucket{outcome="answered",le="60"} 1`,
+		"# TYPE kilroy_human_gates_waiting gauge\nkilroy_human_gates_waiting 0\n",
+		"# TYPE kilroy_sse_clients_active gauge\nkilroy_sse_clients_active 1\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("metrics output missing %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestMetrics_EscapesLabelValues(t *testing.T) {
+	m := NewMetrics()
+	m.Observe(map[string]any{"event": "llm_request", "provider": `a"b`, "model": "x\\y\nz"})
+	var b strings.Builder
+	_ = m.WritePrometheus(&b)
+	want := `kilroy_llm_requests_total{provider="a\"b",model="x\\y\nz"} 1`
+	if !strings.Contains(b.String(), want) {
+		t.Fatalf("missing escaped series %q:\n%s", want, b.String())
+	}
+}
+
+func TestIntegration_MetricsEndpoint_TracksSSEClients(t *testing.T) {
+	srv, ts := newTestServer(t)
+	_, b, _ := registerTestPipeline(t, srv, "metrics-run")
+	b.Send(map[string]any{"event": "run_started"})
+
+	resp, err := http.Get(ts.URL + "/pipelines/metrics-run/events")
+	if err != nil {
+		t.Fatalf("GET events: %v", err)
+	}
+	defer resp.Body.Close()
+	// Wait until the replayed event arrives so the client is registered.
+	if _, err := bufio.NewReader(resp.Body).ReadString('\n'); err != nil {
+		t.Fatalf("read sse: %v", err)
+	}
+
+	scrape := func() string {
+		r, err := http.Get(ts.URL + "/metrics")
+		if err != nil {
+			t.Fatalf("GET /metrics: %v", err)
+		}
+		defer r.Body.Close()
+		if ct := r.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+			t.Fatalf("content-type=%q", ct)
+		}
+		body, _ := io.ReadAll(r.Body)
+		return string(body)
+	}
+	if got := scrape(); !strings.Contains(got, "kilroy_sse_clients_active 1") {
+		t.Fatalf("expected one active SSE client:\n%s", got)
+	}
+
+	resp.Body.Close()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		got := scrape()
+		if strings.Contains(got, "kilroy_sse_clients_active 0") {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("SSE client gauge did not drop after disconnect:\n%s", got)
+		}
+		// The disconnect is noticed on the next event write or context cancel.
+		b.Send(map[string]any{"event": "ping"})
+		time.Sleep(20 * time.Millisecond)
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/danshapiro/kilroy/internal/attractor/engine"
+	"github.com/danshapiro/kilroy/internal/attractor/runstate"
 	"github.com/danshapiro/kilroy/internal/attractor/runtime"
 )
 
@@ -50,7 +51,7 @@ func (ps *PipelineState) Status() PipelineStatus {
 	status := PipelineStatus{
 		RunID:    ps.RunID,
 		State:    "running",
-		LogsRoot: ps.LogsRoot,
+		LogsRoot: ps.runLogsRootLocked(),
 	}
 	if ps.done {
 		if ps.err != nil {
@@ -82,6 +83,7 @@ func (ps *PipelineState) Status() PipelineStatus {
 			last := history[len(history)-1]
 			if evt, ok := last["event"].(string); ok {
 				status.LastEvent = evt
+				status.Paused = evt == "run_paused"
 			}
 			if ts, ok := last["ts"].(string); ok {
 				if t, err := time.Parse(time.RFC3339Nano, ts); err == nil {
@@ -90,9 +92,40 @@ func (ps *PipelineState) Status() PipelineStatus {
 			}
 		}
 	}
+	if !ps.done && status.LogsRoot != "" {
+		if c, err := runstate.LoadControl(status.LogsRoot); err == nil && c.Mode != runstate.ControlRun {
+			status.Control = string(c.Mode)
+		}
+	}
 	return status
 }
 
+// RunLogsRoot returns the directory operator requests (run control and
+// steering) are written to, or "" before the engine has started. After a
+// loop_restart this stays the base logs root the engine reads them from.
+func (ps *PipelineState) RunLogsRoot() string {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	return ps.runLogsRootLocked()
+}
+
+func (ps *PipelineState) runLogsRootLocked() string {
+	if ps.LogsRoot != "" {
+		return ps.LogsRoot
+	}
+	if ps.eng != nil {
+		return ps.eng.OperatorLogsRoot()
+	}
+	return ""
+}
+
+// Done reports whether the pipeline has finished.
+func (ps *PipelineState) Done() bool {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	return ps.done
+}
+
 // ContextValues returns the current engine context values, or nil if unavailable.
 func (ps *PipelineState) ContextValues() map[string]any {
 	ps.mu.Lock()
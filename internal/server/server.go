@@ -21,6 +21,7 @@ type Config struct {
 type Server struct {
 	config   Config
 	registry *PipelineRegistry
+	metrics  *Metrics
 	baseCtx  context.Context
 	cancel   context.CancelFunc
 	httpSrv  *http.Server
@@ -33,6 +34,7 @@ func New(cfg Config) *Server {
 	s := &Server{
 		config:   cfg,
 		registry: NewPipelineRegistry(),
+		metrics:  NewMetrics(),
 		baseCtx:  ctx,
 		cancel:   cancel,
 		logger:   log.New(os.Stderr, "[kilroy-server] ", log.LstdFlags),
@@ -42,10 +44,15 @@ func New(cfg Config) *Server {
 
 	// Go 1.22+ method+pattern routing.
 	mux.HandleFunc("GET /health", s.handleHealth)
+	mux.HandleFunc("GET /metrics", s.handleMetrics)
 	mux.HandleFunc("POST /pipelines", s.handleSubmitPipeline)
 	mux.HandleFunc("GET /pipelines/{id}", s.handleGetPipeline)
 	mux.HandleFunc("GET /pipelines/{id}/events", s.handlePipelineEvents)
 	mux.HandleFunc("POST /pipelines/{id}/cancel", s.handleCancelPipeline)
+	mux.HandleFunc("POST /pipelines/{id}/pause", s.handlePausePipeline)
+	mux.HandleFunc("POST /pipelines/{id}/unpause", s.handleUnpausePipeline)
+	mux.HandleFunc("POST /pipelines/{id}/step", s.handleStepPipeline)
+	mux.HandleFunc("POST /pipelines/{id}/steer", s.handleSteerPipeline)
 	mux.HandleFunc("GET /pipelines/{id}/context", s.handleGetContext)
 	mux.HandleFunc("GET /pipelines/{id}/questions", s.handleGetQuestions)
 	mux.HandleFunc("POST /pipelines/{id}/questions/{qid}/answer", s.handleAnswerQuestion)
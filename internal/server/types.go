@@ -20,6 +20,9 @@ type SubmitPipelineRequest struct {
 	// ForceModels maps provider -> model for overrides.
 	ForceModels map[string]string `json:"force_models,omitempty"`
 
+	// Profile selects a named profile from the run config.
+	Profile string `json:"profile,omitempty"`
+
 	// AllowTestShim enables test shim mode.
 	AllowTestShim bool `json:"allow_test_shim,omitempty"`
 }
@@ -32,6 +35,8 @@ type PipelineStatus struct {
 	LastEvent     string     `json:"last_event,omitempty"`
 	LastEventAt   *time.Time `json:"last_event_at,omitempty"`
 	FailureReason string     `json:"failure_reason,omitempty"`
+	Paused        bool       `json:"paused,omitempty"`
+	Control       string     `json:"control,omitempty"`
 	LogsRoot      string     `json:"logs_root,omitempty"`
 	WorktreeDir   string     `json:"worktree_dir,omitempty"`
 	RunBranch     string     `json:"run_branch,omitempty"`
@@ -63,6 +68,11 @@ type AnswerRequest struct {
 	Text   string   `json:"text,omitempty"`
 }
 
+// SteerRequest is the POST /pipelines/{id}/steer body.
+type SteerRequest struct {
+	Message string `json:"message"`
+}
+
 // ErrorResponse is a standard error envelope.
 type ErrorResponse struct {
 	Error   string `json:"error"`
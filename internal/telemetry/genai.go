@@ -0,0 +1,53 @@
+package telemetry
+
+import (
+	"context"
+
+	"github.com/danshapiro/kilroy/internal/llm"
+)
+
+// StartLLMRequest opens a client span for a (possibly retried) LLM call.
+// Attribute names follow the OpenTelemetry GenAI semantic conventions.
+func StartLLMRequest(ctx context.Context, req llm.Request) (context.Context, *Span) {
+	return Start(ctx, "llm.request "+req.Model, SpanKindClient, map[string]any{
+		"gen_ai.operation.name": "chat",
+		"gen_ai.system":         req.Provider,
+		"gen_ai.request.model":  req.Model,
+	})
+}
+
+// EndLLMRequest records the response (or error) and the number of retries
+// taken, then ends span.
+func EndLLMRequest(span *Span, resp llm.Response, attempts int, err error) {
+	if span == nil {
+		return
+	}
+	retries := attempts - 1
+	if retries < 0 {
+		retries = 0
+	}
+	span.SetAttribute("kilroy.retry_count", retries)
+	if err != nil {
+		span.RecordError(err)
+		span.End()
+		return
+	}
+	attrs := map[string]any{
+		"gen_ai.response.model":      resp.Model,
+		"gen_ai.response.id":         resp.ID,
+		"gen_ai.usage.input_tokens":  resp.Usage.InputTokens,
+		"gen_ai.usage.output_tokens": resp.Usage.OutputTokens,
+		"gen_ai.usage.total_tokens":  resp.Usage.TotalTokens,
+	}
+	if resp.Finish.Reason != "" {
+		attrs["gen_ai.response.finish_reasons"] = resp.Finish.Reason
+	}
+	if resp.Usage.ReasoningTokens != nil {
+		attrs["gen_ai.usage.reasoning_tokens"] = *resp.Usage.ReasoningTokens
+	}
+	if resp.Usage.CacheReadTokens != nil {
+		attrs["gen_ai.usage.cache_read_tokens"] = *resp.Usage.CacheReadTokens
+	}
+	span.SetAttributes(attrs)
+	span.End()
+}
@@ -0,0 +1,311 @@
+package telemetry
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// OTLPConfig configures the OTLP exporter.
+type OTLPConfig struct {
+	// Endpoint is the collector base URL (e.g. http://localhost:4318). For
+	// http/json the "/v1/traces" path is appended unless already present.
+	Endpoint string
+	// Protocol is "http/json" (default) or "grpc". gRPC speaks HTTP/2: with
+	// prior knowledge for http:// endpoints, negotiated over TLS for https://.
+	Protocol string
+	Headers  map[string]string
+
+	// Resource attributes; service.name defaults to "kilroy".
+	ServiceName        string
+	ResourceAttributes map[string]string
+
+	// BatchSize triggers an early flush (default 256). FlushInterval bounds
+	// how long a span waits before being sent (default 2s).
+	BatchSize     int
+	FlushInterval time.Duration
+	Timeout       time.Duration
+
+	HTTPClient *http.Client
+
+	// OnError is invoked (from the export goroutine) when a batch fails to send.
+	OnError func(error)
+}
+
+// OTLP protocols.
+const (
+	ProtocolHTTPJSON = "http/json"
+	ProtocolGRPC     = "grpc"
+)
+
+// OTLPExporter batches spans and sends them to an OTLP collector.
+type OTLPExporter struct {
+	cfg OTLPConfig
+	url string
+
+	mu      sync.Mutex
+	pending []*SpanData
+	closed  bool
+
+	kick chan struct{}
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// NewOTLPExporter starts a background exporter. Call Shutdown to flush.
+func NewOTLPExporter(cfg OTLPConfig) *OTLPExporter {
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 256
+	}
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = 2 * time.Second
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+	if cfg.Protocol == "" {
+		cfg.Protocol = ProtocolHTTPJSON
+	}
+	if cfg.HTTPClient == nil {
+		cfg.HTTPClient = &http.Client{Timeout: cfg.Timeout}
+		if cfg.Protocol == ProtocolGRPC {
+			cfg.HTTPClient.Transport = newGRPCTransport()
+		}
+	}
+	if strings.TrimSpace(cfg.ServiceName) == "" {
+		cfg.ServiceName = "kilroy"
+	}
+	e := &OTLPExporter{
+		cfg:  cfg,
+		url:  tracesURL(cfg.Endpoint, cfg.Protocol),
+		kick: make(chan struct{}, 1),
+		done: make(chan struct{}),
+	}
+	e.wg.Add(1)
+	go e.loop()
+	return e
+}
+
+func tracesURL(endpoint, protocol string) string {
+	u := strings.TrimRight(strings.TrimSpace(endpoint), "/")
+	if protocol == ProtocolGRPC {
+		return u + grpcExportPath
+	}
+	if strings.HasSuffix(u, "/v1/traces") {
+		return u
+	}
+	return u + "/v1/traces"
+}
+
+// ExportSpan queues a finished span.
+func (e *OTLPExporter) ExportSpan(s *SpanData) {
+	if e == nil || s == nil {
+		return
+	}
+	e.mu.Lock()
+	if e.closed {
+		e.mu.Unlock()
+		return
+	}
+	e.pending = append(e.pending, s)
+	full := len(e.pending) >= e.cfg.BatchSize
+	e.mu.Unlock()
+	if full {
+		select {
+		case e.kick <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Shutdown flushes pending spans and stops the export goroutine.
+func (e *OTLPExporter) Shutdown(ctx context.Context) error {
+	if e == nil {
+		return nil
+	}
+	e.mu.Lock()
+	if e.closed {
+		e.mu.Unlock()
+		return nil
+	}
+	e.closed = true
+	e.mu.Unlock()
+	close(e.done)
+	e.wg.Wait()
+	return e.flush(ctx)
+}
+
+func (e *OTLPExporter) loop() {
+	defer e.wg.Done()
+	t := time.NewTicker(e.cfg.FlushInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-e.done:
+			return
+		case <-t.C:
+		case <-e.kick:
+		}
+		if err := e.flush(context.Background()); err != nil && e.cfg.OnError != nil {
+			e.cfg.OnError(err)
+		}
+	}
+}
+
+func (e *OTLPExporter) flush(ctx context.Context) error {
+	e.mu.Lock()
+	batch := e.pending
+	e.pending = nil
+	e.mu.Unlock()
+	if len(batch) == 0 {
+		return nil
+	}
+	if e.cfg.Protocol == ProtocolGRPC {
+		return e.exportGRPC(ctx, e.encode(batch))
+	}
+	body, err := json.Marshal(e.encode(batch))
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, e.cfg.Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range e.cfg.Headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := e.cfg.HTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("otlp export: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("otlp export: %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	return nil
+}
+
+// --- OTLP JSON encoding (opentelemetry-proto, JSON mapping) ---
+
+type otlpKeyValue struct {
+	Key   string       `json:"key"`
+	Value otlpAnyValue `json:"value"`
+}
+
+type otlpAnyValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+	IntValue    *string  `json:"intValue,omitempty"`
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpSpan struct {
+	TraceID           string         `json:"traceId"`
+	SpanID            string         `json:"spanId"`
+	ParentSpanID      string         `json:"parentSpanId,omitempty"`
+	Name              string         `json:"name"`
+	Kind              int            `json:"kind"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	Status            otlpStatus     `json:"status"`
+}
+
+type otlpScopeSpans struct {
+	Scope struct {
+		Name string `json:"name"`
+	} `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpResourceSpans struct {
+	Resource struct {
+		Attributes []otlpKeyValue `json:"attributes"`
+	} `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpTraceRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+func (e *OTLPExporter) encode(batch []*SpanData) otlpTraceRequest {
+	res := map[string]any{"service.name": e.cfg.ServiceName}
+	for k, v := range e.cfg.ResourceAttributes {
+		res[k] = v
+	}
+	var rs otlpResourceSpans
+	rs.Resource.Attributes = encodeAttributes(res)
+	var ss otlpScopeSpans
+	ss.Scope.Name = "github.com/danshapiro/kilroy"
+	for _, s := range batch {
+		sp := otlpSpan{
+			TraceID:           hex.EncodeToString(s.SpanContext.TraceID[:]),
+			SpanID:            hex.EncodeToString(s.SpanContext.SpanID[:]),
+			Name:              s.Name,
+			Kind:              int(s.Kind),
+			StartTimeUnixNano: strconv.FormatInt(s.Start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(s.End.UnixNano(), 10),
+			Attributes:        encodeAttributes(s.Attributes),
+			Status:            otlpStatus{Code: int(s.StatusCode), Message: s.StatusMessage},
+		}
+		if s.Parent.IsValid() {
+			sp.ParentSpanID = hex.EncodeToString(s.Parent.SpanID[:])
+		}
+		ss.Spans = append(ss.Spans, sp)
+	}
+	rs.ScopeSpans = []otlpScopeSpans{ss}
+	return otlpTraceRequest{ResourceSpans: []otlpResourceSpans{rs}}
+}
+
+func encodeAttributes(attrs map[string]any) []otlpKeyValue {
+	keys := make([]string, 0, len(attrs))
+	for k := range attrs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	out := make([]otlpKeyValue, 0, len(keys))
+	for _, k := range keys {
+		out = append(out, otlpKeyValue{Key: k, Value: encodeValue(attrs[k])})
+	}
+	return out
+}
+
+func encodeValue(v any) otlpAnyValue {
+	switch t := v.(type) {
+	case string:
+		return otlpAnyValue{StringValue: &t}
+	case bool:
+		return otlpAnyValue{BoolValue: &t}
+	case int:
+		s := strconv.FormatInt(int64(t), 10)
+		return otlpAnyValue{IntValue: &s}
+	case int64:
+		s := strconv.FormatInt(t, 10)
+		return otlpAnyValue{IntValue: &s}
+	case float64:
+		return otlpAnyValue{DoubleValue: &t}
+	default:
+		s := fmt.Sprint(t)
+		return otlpAnyValue{StringValue: &s}
+	}
+}
@@ -0,0 +1,197 @@
+package telemetry
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// grpcExportPath is the TraceService/Export method of the OTLP collector.
+const grpcExportPath = "/opentelemetry.proto.collector.trace.v1.TraceService/Export"
+
+// newGRPCTransport speaks HTTP/2 only: gRPC has no HTTP/1.1 mapping, and
+// collectors listen for plaintext HTTP/2 (h2c) on their gRPC port.
+func newGRPCTransport() *http.Transport {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.Protocols = new(http.Protocols)
+	t.Protocols.SetHTTP2(true)
+	t.Protocols.SetUnencryptedHTTP2(true)
+	return t
+}
+
+// exportGRPC sends one ExportTraceServiceRequest as a unary gRPC call.
+func (e *OTLPExporter) exportGRPC(ctx context.Context, req otlpTraceRequest) error {
+	msg, err := marshalTraceRequest(req)
+	if err != nil {
+		return err
+	}
+	// Length-prefixed message: compressed flag, big-endian length, payload.
+	body := make([]byte, 5, 5+len(msg))
+	binary.BigEndian.PutUint32(body[1:], uint32(len(msg)))
+	body = append(body, msg...)
+
+	ctx, cancel := context.WithTimeout(ctx, e.cfg.Timeout)
+	defer cancel()
+	hreq, err := http.NewRequestWithContext(ctx, http.MethodPost, e.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	for k, v := range e.cfg.Headers {
+		hreq.Header.Set(k, v)
+	}
+	hreq.Header.Set("Content-Type", "application/grpc")
+	hreq.Header.Set("TE", "trailers")
+	resp, err := e.cfg.HTTPClient.Do(hreq)
+	if err != nil {
+		return fmt.Errorf("otlp export: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	// Trailers are only populated once the body has been read.
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("otlp export: %s", resp.Status)
+	}
+	status, message := resp.Trailer.Get("Grpc-Status"), resp.Trailer.Get("Grpc-Message")
+	if status == "" {
+		// Trailers-only response: the status arrives with the headers.
+		status, message = resp.Header.Get("Grpc-Status"), resp.Header.Get("Grpc-Message")
+	}
+	switch status {
+	case "0":
+		return nil
+	case "":
+		return fmt.Errorf("otlp export: response has no grpc-status")
+	}
+	if m, err := url.PathUnescape(message); err == nil {
+		message = m
+	}
+	return fmt.Errorf("otlp export: grpc status %s: %s", status, strings.TrimSpace(message))
+}
+
+// --- OTLP protobuf encoding (opentelemetry-proto trace/v1) ---
+//
+// The request is built by encode, the same as for http/json, and then
+// written with the protobuf field numbers of the JSON mapping's messages.
+
+func marshalTraceRequest(req otlpTraceRequest) ([]byte, error) {
+	var out []byte
+	for _, rs := range req.ResourceSpans {
+		var resource []byte
+		for _, kv := range rs.Resource.Attributes {
+			b, err := marshalKeyValue(kv)
+			if err != nil {
+				return nil, err
+			}
+			resource = appendMessageField(resource, 1, b)
+		}
+		b := appendMessageField(nil, 1, resource)
+		for _, ss := range rs.ScopeSpans {
+			scope := appendMessageField(nil, 1, appendStringField(nil, 1, ss.Scope.Name))
+			for _, sp := range ss.Spans {
+				span, err := marshalSpan(sp)
+				if err != nil {
+					return nil, err
+				}
+				scope = appendMessageField(scope, 2, span)
+			}
+			b = appendMessageField(b, 2, scope)
+		}
+		out = appendMessageField(out, 1, b)
+	}
+	return out, nil
+}
+
+func marshalSpan(sp otlpSpan) ([]byte, error) {
+	var b []byte
+	for _, id := range []struct {
+		field int
+		hex   string
+	}{{1, sp.TraceID}, {2, sp.SpanID}, {4, sp.ParentSpanID}} {
+		if id.hex == "" {
+			continue
+		}
+		raw, err := hex.DecodeString(id.hex)
+		if err != nil {
+			return nil, err
+		}
+		b = appendMessageField(b, id.field, raw)
+	}
+	b = appendStringField(b, 5, sp.Name)
+	if sp.Kind != 0 {
+		b = appendVarintField(b, 6, uint64(sp.Kind))
+	}
+	for i, ns := range []string{sp.StartTimeUnixNano, sp.EndTimeUnixNano} {
+		v, err := strconv.ParseInt(ns, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		b = binary.LittleEndian.AppendUint64(appendTag(b, 7+i, 1), uint64(v))
+	}
+	for _, kv := range sp.Attributes {
+		attr, err := marshalKeyValue(kv)
+		if err != nil {
+			return nil, err
+		}
+		b = appendMessageField(b, 9, attr)
+	}
+	status := appendStringField(nil, 2, sp.Status.Message)
+	if sp.Status.Code != 0 {
+		status = appendVarintField(status, 3, uint64(sp.Status.Code))
+	}
+	return appendMessageField(b, 15, status), nil
+}
+
+func marshalKeyValue(kv otlpKeyValue) ([]byte, error) {
+	// AnyValue is a oneof, so its field is written even when zero.
+	var v []byte
+	switch a := kv.Value; {
+	case a.StringValue != nil:
+		v = appendMessageField(nil, 1, []byte(*a.StringValue))
+	case a.BoolValue != nil:
+		n := uint64(0)
+		if *a.BoolValue {
+			n = 1
+		}
+		v = binary.AppendUvarint(appendTag(nil, 2, 0), n)
+	case a.IntValue != nil:
+		n, err := strconv.ParseInt(*a.IntValue, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		v = binary.AppendUvarint(appendTag(nil, 3, 0), uint64(n))
+	case a.DoubleValue != nil:
+		v = binary.LittleEndian.AppendUint64(appendTag(nil, 4, 1), math.Float64bits(*a.DoubleValue))
+	}
+	b := appendStringField(nil, 1, kv.Key)
+	return appendMessageField(b, 2, v), nil
+}
+
+func appendTag(b []byte, field, wireType int) []byte {
+	return binary.AppendUvarint(b, uint64(field)<<3|uint64(wireType))
+}
+
+func appendVarintField(b []byte, field int, v uint64) []byte {
+	return binary.AppendUvarint(appendTag(b, field, 0), v)
+}
+
+func appendStringField(b []byte, field int, s string) []byte {
+	if s == "" {
+		return b
+	}
+	return appendMessageField(b, field, []byte(s))
+}
+
+// appendMessageField writes a length-delimited field: a message, bytes or a
+// string.
+func appendMessageField(b []byte, field int, v []byte) []byte {
+	b = binary.AppendUvarint(appendTag(b, field, 2), uint64(len(v)))
+	return append(b, v...)
+}
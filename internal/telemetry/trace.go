@@ -0,0 +1,275 @@
+// Package telemetry provides a small, dependency-free span tracer that exports
+// OpenTelemetry-compatible spans over OTLP/HTTP (JSON encoding) or OTLP/gRPC
+// (protobuf over cleartext or TLS HTTP/2).
+//
+// Spans are carried through context.Context. Children are started with Start,
+// which is a no-op when the context carries no span and no tracer, so call
+// sites never need to check whether tracing is enabled.
+package telemetry
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SpanKind mirrors the OTLP span kind enumeration.
+type SpanKind int
+
+const (
+	SpanKindInternal SpanKind = 1
+	SpanKindServer   SpanKind = 2
+	SpanKindClient   SpanKind = 3
+)
+
+// StatusCode mirrors the OTLP status code enumeration.
+type StatusCode int
+
+const (
+	StatusUnset StatusCode = 0
+	StatusOK    StatusCode = 1
+	StatusError StatusCode = 2
+)
+
+// SpanContext identifies a span within a trace (W3C trace-context).
+type SpanContext struct {
+	TraceID [16]byte
+	SpanID  [8]byte
+	Sampled bool
+}
+
+// IsValid reports whether both trace and span IDs are non-zero.
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID != [16]byte{} && sc.SpanID != [8]byte{}
+}
+
+// Traceparent formats sc as a W3C traceparent header value.
+func (sc SpanContext) Traceparent() string {
+	if !sc.IsValid() {
+		return ""
+	}
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+	return fmt.Sprintf("00-%s-%s-%s", hex.EncodeToString(sc.TraceID[:]), hex.EncodeToString(sc.SpanID[:]), flags)
+}
+
+// ParseTraceparent parses a W3C traceparent header value.
+func ParseTraceparent(v string) (SpanContext, bool) {
+	parts := strings.Split(strings.TrimSpace(v), "-")
+	if len(parts) != 4 || len(parts[0]) != 2 || len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return SpanContext{}, false
+	}
+	if parts[0] == "ff" {
+		return SpanContext{}, false
+	}
+	var sc SpanContext
+	if _, err := hex.Decode(sc.TraceID[:], []byte(parts[1])); err != nil {
+		return SpanContext{}, false
+	}
+	if _, err := hex.Decode(sc.SpanID[:], []byte(parts[2])); err != nil {
+		return SpanContext{}, false
+	}
+	flags, err := hex.DecodeString(parts[3])
+	if err != nil {
+		return SpanContext{}, false
+	}
+	sc.Sampled = flags[0]&0x01 == 0x01
+	if !sc.IsValid() {
+		return SpanContext{}, false
+	}
+	return sc, true
+}
+
+// Exporter receives finished spans.
+type Exporter interface {
+	ExportSpan(s *SpanData)
+	Shutdown(ctx context.Context) error
+}
+
+// SpanData is the immutable record of a finished span.
+type SpanData struct {
+	Name          string
+	Kind          SpanKind
+	SpanContext   SpanContext
+	Parent        SpanContext
+	Start         time.Time
+	End           time.Time
+	Attributes    map[string]any
+	StatusCode    StatusCode
+	StatusMessage string
+}
+
+// Tracer creates spans and hands finished spans to an exporter.
+type Tracer struct {
+	exporter Exporter
+}
+
+// NewTracer returns a tracer that exports to exp. A nil exporter yields a
+// tracer whose spans are recorded but discarded.
+func NewTracer(exp Exporter) *Tracer {
+	return &Tracer{exporter: exp}
+}
+
+// Shutdown flushes and stops the underlying exporter.
+func (t *Tracer) Shutdown(ctx context.Context) error {
+	if t == nil || t.exporter == nil {
+		return nil
+	}
+	return t.exporter.Shutdown(ctx)
+}
+
+// Start begins a span named name as a child of the span carried by ctx (or of
+// a remote parent installed with ContextWithRemoteParent) and returns a
+// context carrying the new span.
+func (t *Tracer) Start(ctx context.Context, name string, kind SpanKind, attrs map[string]any) (context.Context, *Span) {
+	if t == nil {
+		return ctx, nil
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	s := &Span{
+		tracer: t,
+		data: SpanData{
+			Name:       name,
+			Kind:       kind,
+			Start:      time.Now(),
+			Attributes: map[string]any{},
+		},
+	}
+	if parent := SpanFromContext(ctx); parent != nil {
+		s.data.Parent = parent.data.SpanContext
+	} else if remote, ok := ctx.Value(remoteParentKey{}).(SpanContext); ok {
+		s.data.Parent = remote
+	}
+	if s.data.Parent.IsValid() {
+		s.data.SpanContext.TraceID = s.data.Parent.TraceID
+	} else {
+		_, _ = rand.Read(s.data.SpanContext.TraceID[:])
+	}
+	_, _ = rand.Read(s.data.SpanContext.SpanID[:])
+	s.data.SpanContext.Sampled = true
+	for k, v := range attrs {
+		s.data.Attributes[k] = v
+	}
+	return context.WithValue(ctx, spanKey{}, s), s
+}
+
+// Span is an in-flight span. All methods are safe on a nil receiver.
+type Span struct {
+	tracer *Tracer
+
+	mu    sync.Mutex
+	data  SpanData
+	ended bool
+}
+
+// SetAttributes merges attrs into the span's attributes.
+func (s *Span) SetAttributes(attrs map[string]any) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for k, v := range attrs {
+		s.data.Attributes[k] = v
+	}
+}
+
+// SetAttribute sets a single attribute.
+func (s *Span) SetAttribute(key string, v any) {
+	s.SetAttributes(map[string]any{key: v})
+}
+
+// SetStatus records the span status. An empty message is allowed.
+func (s *Span) SetStatus(code StatusCode, msg string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.StatusCode = code
+	s.data.StatusMessage = msg
+}
+
+// RecordError marks the span as failed with err's message. A nil err is ignored.
+func (s *Span) RecordError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.SetStatus(StatusError, err.Error())
+}
+
+// SpanContext returns the span's identity.
+func (s *Span) SpanContext() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+	return s.data.SpanContext
+}
+
+// End finishes the span and hands it to the exporter. Subsequent calls are no-ops.
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.data.End = time.Now()
+	out := s.data
+	out.Attributes = make(map[string]any, len(s.data.Attributes))
+	for k, v := range s.data.Attributes {
+		out.Attributes[k] = v
+	}
+	s.mu.Unlock()
+	if s.tracer != nil && s.tracer.exporter != nil {
+		s.tracer.exporter.ExportSpan(&out)
+	}
+}
+
+type spanKey struct{}
+type remoteParentKey struct{}
+
+// SpanFromContext returns the span carried by ctx, or nil.
+func SpanFromContext(ctx context.Context) *Span {
+	if ctx == nil {
+		return nil
+	}
+	s, _ := ctx.Value(spanKey{}).(*Span)
+	return s
+}
+
+// ContextWithRemoteParent installs sc as the parent for the next root span
+// started from ctx (for example, a TRACEPARENT inherited from CI).
+func ContextWithRemoteParent(ctx context.Context, sc SpanContext) context.Context {
+	if !sc.IsValid() {
+		return ctx
+	}
+	return context.WithValue(ctx, remoteParentKey{}, sc)
+}
+
+// Start begins a child of the span carried by ctx using the same tracer. When
+// ctx carries no span, it returns ctx unchanged and a nil span.
+func Start(ctx context.Context, name string, kind SpanKind, attrs map[string]any) (context.Context, *Span) {
+	parent := SpanFromContext(ctx)
+	if parent == nil {
+		return ctx, nil
+	}
+	return parent.tracer.Start(ctx, name, kind, attrs)
+}
+
+// TraceparentFromContext returns the W3C traceparent of the span carried by
+// ctx, or "" when tracing is inactive.
+func TraceparentFromContext(ctx context.Context) string {
+	return SpanFromContext(ctx).SpanContext().Traceparent()
+}
@@ -0,0 +1,253 @@
+package telemetry
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestTraceparent_RoundTrip(t *testing.T) {
+	tr := NewTracer(nil)
+	_, span := tr.Start(context.Background(), "root", SpanKindInternal, nil)
+	tp := span.SpanContext().Traceparent()
+	if len(tp) != 55 {
+		t.Fatalf("traceparent=%q want 55 chars", tp)
+	}
+	sc, ok := ParseTraceparent(tp)
+	if !ok {
+		t.Fatalf("ParseTraceparent(%q) failed", tp)
+	}
+	if sc != span.SpanContext() {
+		t.Fatalf("round trip mismatch: got %+v want %+v", sc, span.SpanContext())
+	}
+}
+
+func TestParseTraceparent_RejectsInvalid(t *testing.T) {
+	for _, v := range []string{
+		"",
+		"00-00000000000000000000000000000000-0000000000000000-01",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+		"00-zzf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+	} {
+		if _, ok := ParseTraceparent(v); ok {
+			t.Fatalf("ParseTraceparent(%q) unexpectedly ok", v)
+		}
+	}
+}
+
+func TestStart_ChildInheritsTraceAndRemoteParent(t *testing.T) {
+	remote, _ := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	tr := NewTracer(nil)
+	ctx := ContextWithRemoteParent(context.Background(), remote)
+	ctx, root := tr.Start(ctx, "root", SpanKindInternal, nil)
+	_, child := Start(ctx, "child", SpanKindInternal, nil)
+
+	if root.data.Parent != remote {
+		t.Fatalf("root parent=%+v want remote %+v", root.data.Parent, remote)
+	}
+	if child.SpanContext().TraceID != remote.TraceID {
+		t.Fatalf("child trace id not inherited")
+	}
+	if child.data.Parent.SpanID != root.SpanContext().SpanID {
+		t.Fatalf("child parent span id mismatch")
+	}
+}
+
+func TestStart_NoSpanInContextIsNoop(t *testing.T) {
+	ctx := context.Background()
+	got, span := Start(ctx, "x", SpanKindInternal, nil)
+	if span != nil || got != ctx {
+		t.Fatalf("expected no-op start without a parent span")
+	}
+	// nil spans must be safe to use.
+	span.SetAttribute("k", "v")
+	span.RecordError(io.EOF)
+	span.End()
+	if TraceparentFromContext(ctx) != "" {
+		t.Fatalf("expected empty traceparent")
+	}
+}
+
+func TestOTLPExporter_PostsJSONBatch(t *testing.T) {
+	var mu sync.Mutex
+	var got otlpTraceRequest
+	var path, auth string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		path = r.URL.Path
+		auth = r.Header.Get("Authorization")
+		_ = json.NewDecoder(r.Body).Decode(&got)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	exp := NewOTLPExporter(OTLPConfig{
+		Endpoint:    srv.URL,
+		Headers:     map[string]string{"Authorization": "Bearer t"},
+		ServiceName: "kilroy-test",
+	})
+	tr := NewTracer(exp)
+	ctx, root := tr.Start(context.Background(), "run", SpanKindInternal, map[string]any{"run_id": "r1"})
+	_, child := Start(ctx, "llm.request", SpanKindClient, map[string]any{"llm.usage.input_tokens": 12})
+	child.RecordError(io.EOF)
+	child.End()
+	root.End()
+	if err := tr.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if path != "/v1/traces" {
+		t.Fatalf("path=%q want /v1/traces", path)
+	}
+	if auth != "Bearer t" {
+		t.Fatalf("authorization header=%q", auth)
+	}
+	if len(got.ResourceSpans) != 1 || len(got.ResourceSpans[0].ScopeSpans) != 1 {
+		t.Fatalf("unexpected payload shape: %+v", got)
+	}
+	spans := got.ResourceSpans[0].ScopeSpans[0].Spans
+	if len(spans) != 2 {
+		t.Fatalf("spans=%d want 2", len(spans))
+	}
+	llm, run := spans[0], spans[1]
+	if llm.Name != "llm.request" || run.Name != "run" {
+		t.Fatalf("unexpected span order: %q, %q", llm.Name, run.Name)
+	}
+	if llm.ParentSpanID != run.SpanID || llm.TraceID != run.TraceID {
+		t.Fatalf("child not linked to parent")
+	}
+	if llm.Status.Code != int(StatusError) || llm.Kind != int(SpanKindClient) {
+		t.Fatalf("llm span status/kind = %+v/%d", llm.Status, llm.Kind)
+	}
+	if len(llm.Attributes) != 1 || llm.Attributes[0].Value.IntValue == nil || *llm.Attributes[0].Value.IntValue != "12" {
+		t.Fatalf("int attribute not encoded: %+v", llm.Attributes)
+	}
+	res := got.ResourceSpans[0].Resource.Attributes
+	if len(res) != 1 || res[0].Key != "service.name" || *res[0].Value.StringValue != "kilroy-test" {
+		t.Fatalf("resource attributes=%+v", res)
+	}
+}
+
+// protoFields splits one protobuf message into its fields, keyed by number.
+// Varint and fixed64 values are returned as their little-endian bytes.
+func protoFields(t *testing.T, b []byte) map[int][][]byte {
+	t.Helper()
+	out := map[int][][]byte{}
+	for len(b) > 0 {
+		tag, n := binary.Uvarint(b)
+		b = b[n:]
+		var v []byte
+		switch tag & 7 {
+		case 0:
+			x, n := binary.Uvarint(b)
+			v, b = binary.LittleEndian.AppendUint64(nil, x), b[n:]
+		case 1:
+			v, b = b[:8], b[8:]
+		case 2:
+			l, n := binary.Uvarint(b)
+			v, b = b[n:n+int(l)], b[n+int(l):]
+		default:
+			t.Fatalf("unexpected wire type %d", tag&7)
+		}
+		out[int(tag>>3)] = append(out[int(tag>>3)], v)
+	}
+	return out
+}
+
+func TestOTLPExporter_SendsGRPCOverCleartextHTTP2(t *testing.T) {
+	var mu sync.Mutex
+	var msg []byte
+	var proto, path, contentType, auth string
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		proto, path, contentType, auth = r.Proto, r.URL.Path, r.Header.Get("Content-Type"), r.Header.Get("Authorization")
+		body, _ := io.ReadAll(r.Body)
+		if len(body) >= 5 && int(binary.BigEndian.Uint32(body[1:5])) == len(body)-5 {
+			msg = body[5:]
+		}
+		w.Header().Set("Content-Type", "application/grpc")
+		_, _ = w.Write([]byte{0, 0, 0, 0, 0})
+		w.Header().Set(http.TrailerPrefix+"Grpc-Status", "0")
+	}))
+	srv.Config.Protocols = new(http.Protocols)
+	srv.Config.Protocols.SetUnencryptedHTTP2(true)
+	srv.Start()
+	defer srv.Close()
+
+	exp := NewOTLPExporter(OTLPConfig{
+		Endpoint:    srv.URL,
+		Protocol:    ProtocolGRPC,
+		Headers:     map[string]string{"Authorization": "Bearer t"},
+		ServiceName: "kilroy-test",
+	})
+	tr := NewTracer(exp)
+	ctx, root := tr.Start(context.Background(), "run", SpanKindInternal, nil)
+	_, child := Start(ctx, "llm.request", SpanKindClient, map[string]any{"llm.usage.input_tokens": 12})
+	child.RecordError(io.EOF)
+	child.End()
+	root.End()
+	if err := tr.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if proto != "HTTP/2.0" || path != grpcExportPath || contentType != "application/grpc" || auth != "Bearer t" {
+		t.Fatalf("request: proto=%q path=%q content-type=%q auth=%q", proto, path, contentType, auth)
+	}
+	rs := protoFields(t, protoFields(t, msg)[1][0])
+	resourceAttr := protoFields(t, protoFields(t, rs[1][0])[1][0])
+	if string(resourceAttr[1][0]) != "service.name" || string(protoFields(t, resourceAttr[2][0])[1][0]) != "kilroy-test" {
+		t.Fatalf("resource attribute: %q", resourceAttr)
+	}
+	spans := protoFields(t, rs[2][0])[2]
+	if len(spans) != 2 {
+		t.Fatalf("spans=%d want 2", len(spans))
+	}
+	llm, run := protoFields(t, spans[0]), protoFields(t, spans[1])
+	if string(llm[5][0]) != "llm.request" || string(run[5][0]) != "run" {
+		t.Fatalf("span names: %q, %q", llm[5][0], run[5][0])
+	}
+	if string(llm[4][0]) != string(run[2][0]) || string(llm[1][0]) != string(run[1][0]) || len(run[1][0]) != 16 {
+		t.Fatalf("child not linked to parent")
+	}
+	if llm[6][0][0] != byte(SpanKindClient) || protoFields(t, llm[15][0])[3][0][0] != byte(StatusError) {
+		t.Fatalf("llm span kind/status: %v/%v", llm[6], llm[15])
+	}
+	attr := protoFields(t, llm[9][0])
+	if string(attr[1][0]) != "llm.usage.input_tokens" || protoFields(t, attr[2][0])[3][0][0] != 12 {
+		t.Fatalf("int attribute: %q", attr)
+	}
+}
+
+func TestOTLPExporter_ReportsGRPCStatus(t *testing.T) {
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(io.Discard, r.Body)
+		w.Header().Set("Content-Type", "application/grpc")
+		w.Header().Set("Grpc-Status", "16")
+		w.Header().Set("Grpc-Message", "missing%20api%20key")
+		w.WriteHeader(http.StatusOK)
+	}))
+	srv.Config.Protocols = new(http.Protocols)
+	srv.Config.Protocols.SetUnencryptedHTTP2(true)
+	srv.Start()
+	defer srv.Close()
+
+	exp := NewOTLPExporter(OTLPConfig{Endpoint: srv.URL, Protocol: ProtocolGRPC})
+	exp.ExportSpan(&SpanData{Name: "run", Start: time.Now(), End: time.Now()})
+	err := exp.Shutdown(context.Background())
+	if err == nil || err.Error() != "otlp export: grpc status 16: missing api key" {
+		t.Fatalf("err=%v", err)
+	}
+}